@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/job"
+	"github.com/spf13/pflag"
+)
+
+// nameCollisions returns the other cronmgr processes running the job name with another command
+// than command, whose metrics are merged with those of the job. Processes are only listed on Linux.
+func nameCollisions(name string, command []string) []string {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var found []string
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		// Processes may exit or hide their command line from other users
+		cmdline, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		otherName, otherCommand, ok := jobOfArgs(strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00"))
+		if ok && otherName == name && !slices.Equal(otherCommand, command) {
+			found = append(found, fmt.Sprintf("pid %d running %s", pid, job.CommandLine(otherCommand[0], otherCommand[1:])))
+		}
+	}
+	return found
+}
+
+// jobOfArgs returns the job name and command of a cronmgr process from its arguments. ok is false for other
+// programs, subcommands and commands that cannot be told from the arguments, e.g. read from --cmd-file.
+func jobOfArgs(args []string) (name string, command []string, ok bool) {
+	if len(args) < 2 {
+		return "", nil, false
+	}
+	if base := filepath.Base(args[0]); base != "cronmgr" && base != legacyName {
+		return "", nil, false
+	}
+	// Only the flags telling the job are defined, the values of the others are skipped
+	flags := pflag.NewFlagSet(args[0], pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.ParseErrorsAllowlist.UnknownFlags = true
+	namePtr := flags.StringP("name", "n", "", "")
+	commandPtr := flags.StringP("command", "c", "", "")
+	if err := flags.Parse(args[1:]); err != nil || *namePtr == "" {
+		return "", nil, false
+	}
+	commandLine, hasSeparator, err := argsAfterSeparator(flags)
+	switch {
+	case err != nil:
+		return "", nil, false
+	case *commandPtr != "" && !hasSeparator:
+		bin, binArgs, _ := legacyCommand(*commandPtr, false)
+		return *namePtr, append([]string{bin}, binArgs...), true
+	case *commandPtr == "" && len(commandLine) > 0:
+		return *namePtr, commandLine, true
+	}
+	return "", nil, false
+}
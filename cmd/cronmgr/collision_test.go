@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJobOfArgs tests telling the job of a cronmgr process from its arguments
+func TestJobOfArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantName    string
+		wantCommand []string
+		wantOK      bool
+	}{
+		{
+			name:        "command after separator",
+			args:        []string{"/usr/local/bin/cronmgr", "--log", "/var/log/backup.log", "-n", "backup", "--quiet", "--", "/usr/bin/backup", "--full"},
+			wantName:    "backup",
+			wantCommand: []string{"/usr/bin/backup", "--full"},
+			wantOK:      true,
+		},
+		{
+			name:        "name with equal sign",
+			args:        []string{"cronmgr", "--name=backup", "--idle", "60", "--", "tar", "-czf", "/tmp/x.tgz", "--", "/srv"},
+			wantName:    "backup",
+			wantCommand: []string{"tar", "-czf", "/tmp/x.tgz", "--", "/srv"},
+			wantOK:      true,
+		},
+		{
+			name:        "legacy command",
+			args:        []string{"cronmanager", "-n", "backup", "-c", "/usr/bin/backup > /tmp/out"},
+			wantName:    "backup",
+			wantCommand: []string{"sh", "-c", "/usr/bin/backup > /tmp/out"},
+			wantOK:      true,
+		},
+		{
+			name: "command file",
+			args: []string{"cronmgr", "-n", "backup", "--cmd-file", "/etc/cronmgr/backup.cmd"},
+		},
+		{
+			name: "subcommand",
+			args: []string{"cronmgr", "watchdog", "--name", "backup", "--", "/usr/bin/backup"},
+		},
+		{
+			name: "other program",
+			args: []string{"/usr/bin/backup", "-n", "backup", "--", "/usr/bin/backup"},
+		},
+		{
+			name: "no name",
+			args: []string{"cronmgr", "drop-privileges", "--no-new-privs", "--", "/usr/bin/backup"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, command, ok := jobOfArgs(tt.args)
+			if name != tt.wantName || !slices.Equal(command, tt.wantCommand) || ok != tt.wantOK {
+				t.Errorf("jobOfArgs() = %q, %q, %v, want %q, %q, %v", name, command, ok, tt.wantName, tt.wantCommand, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestNameCollisions tests finding another cronmgr process running the job name with a different command
+func TestNameCollisions(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("processes are only listed on Linux")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+	// A shell whose arguments look like a cronmgr invocation with --command
+	other := exec.Command(sh)
+	other.Args = []string{"cronmgr", "-c", "sleep 30; exit", "-n", "collision_test"}
+	if err := other.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() {
+		_ = other.Process.Kill()
+		_ = other.Wait()
+	}()
+
+	// The new process may not have its arguments set yet
+	var found []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if found = nameCollisions("collision_test", []string{"/usr/bin/backup"}); len(found) > 0 {
+			break
+		}
+	}
+	if len(found) != 1 || !strings.HasSuffix(found[0], "running sh -c 'sleep 30; exit'") {
+		t.Errorf("nameCollisions() = %q, want the other process", found)
+	}
+	if found := nameCollisions("collision_test", []string{"sh", "-c", "sleep 30; exit"}); len(found) != 0 {
+		t.Errorf("nameCollisions() = %q, want none for the same command", found)
+	}
+	if found := nameCollisions("other_job", []string{"/usr/bin/backup"}); len(found) != 0 {
+		t.Errorf("nameCollisions() = %q, want none for another name", found)
+	}
+}
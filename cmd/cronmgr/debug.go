@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/pprof"
+	"syscall"
+	"time"
+)
+
+// dumpGoroutinesOnQuit makes SIGQUIT write the stacks of all goroutines of cronmgr to stderr, and to
+// file unless it is empty, instead of the Go runtime writing them and exiting. A hanging run can be
+// inspected this way without killing the job.
+func dumpGoroutinesOnQuit(file string) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGQUIT)
+	go func() {
+		for range quit {
+			writeGoroutines(os.Stderr, time.Now())
+			if file == "" {
+				continue
+			}
+			if err := dumpGoroutines(file); err != nil {
+				log.Printf("Failed to write the goroutines: %v", err)
+			}
+		}
+	}()
+}
+
+// dumpGoroutines writes the stacks of all goroutines to file, replacing a previous dump
+func dumpGoroutines(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	writeGoroutines(f, time.Now())
+	return f.Close()
+}
+
+// writeGoroutines writes the stacks of all goroutines of cronmgr at now to w
+func writeGoroutines(w io.Writer, now time.Time) {
+	fmt.Fprintf(w, "cronmgr: goroutines of pid %d at %s\n", os.Getpid(), now.Format(time.RFC3339))
+	_ = pprof.Lookup("goroutine").WriteTo(w, 2)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDumpGoroutines tests writing the stacks of the goroutines of cronmgr to a file
+func TestDumpGoroutines(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "artifacts", "backup.goroutines.txt")
+	if err := dumpGoroutines(file); err != nil {
+		t.Fatalf("dumpGoroutines() error = %v", err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"cronmgr: goroutines of pid", "goroutine ", "TestDumpGoroutines"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Expected %q in:\n%s", want, content)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/spf13/pflag"
+)
+
+// keyFlags are the flags providing the encryption key, shared by job runs and subcommands
+type keyFlags struct {
+	file    *string
+	command *string
+}
+
+// addKeyFlags registers the encryption key flags on flags
+func addKeyFlags(flags *pflag.FlagSet) *keyFlags {
+	return &keyFlags{
+		file:    flags.String("encryption-key-file", "", "File holding a 32 byte AES key (hex, base64 or raw) encrypting the log file and run history at rest"),
+		command: flags.String("encryption-key-command", "", "Shell command printing the encryption key, e.g. a KMS client decrypting a data key"),
+	}
+}
+
+// cipher loads the key from the parsed flags, it returns nil if encryption is not configured
+func (f *keyFlags) cipher() (*crypt.Cipher, error) {
+	var key []byte
+	var err error
+	switch {
+	case *f.file != "" && *f.command != "":
+		return nil, errors.New("--encryption-key-file and --encryption-key-command cannot be combined")
+	case *f.file != "":
+		key, err = crypt.KeyFromFile(*f.file)
+	case *f.command != "":
+		key, err = crypt.KeyFromCommand(*f.command)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	return crypt.NewCipher(key)
+}
+
+// runDecrypt writes the decrypted content of encrypted log files to stdout
+func runDecrypt(args []string) int {
+	flags := pflag.NewFlagSet("decrypt", pflag.ContinueOnError)
+	flags.SortFlags = false
+	keyFlags := addKeyFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr decrypt --encryption-key-file <file> [file...]
+
+Decrypt log files written with an encryption key to stdout, standard input is read without files.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	c, err := keyFlags.cipher()
+	if err == nil && c == nil {
+		err = errors.New("--encryption-key-file or --encryption-key-command is required")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	if flags.NArg() == 0 {
+		if err := c.Decrypt(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	for _, path := range flags.Args() {
+		if err := decryptFile(c, path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// decryptFile writes the decrypted content of the file at path to stdout
+func decryptFile(c *crypt.Cipher, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	return c.Decrypt(file, os.Stdout)
+}
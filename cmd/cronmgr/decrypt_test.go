@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/spf13/pflag"
+)
+
+// TestKeyFlags tests loading the encryption key from the flags
+func TestKeyFlags(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyPath, []byte(hex.EncodeToString(bytes.Repeat([]byte{1}, crypt.KeySize))), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCipher bool
+		wantError  bool
+	}{
+		{name: "disabled"},
+		{name: "key file", args: []string{"--encryption-key-file", keyPath}, wantCipher: true},
+		{name: "key command", args: []string{"--encryption-key-command", "cat " + keyPath}, wantCipher: true},
+		{name: "missing key file", args: []string{"--encryption-key-file", keyPath + ".missing"}, wantError: true},
+		{name: "both", args: []string{"--encryption-key-file", keyPath, "--encryption-key-command", "cat " + keyPath}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			keyFlags := addKeyFlags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			c, err := keyFlags.cipher()
+			if (err != nil) != tt.wantError {
+				t.Fatalf("cipher() error = %v, wantError %v", err, tt.wantError)
+			}
+			if (c != nil) != tt.wantCipher {
+				t.Errorf("cipher() = %v, want cipher %v", c, tt.wantCipher)
+			}
+		})
+	}
+}
+
+// TestRunDecrypt tests the decrypt subcommand
+func TestRunDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{1}, crypt.KeySize)
+	keyPath := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyPath, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	c, err := crypt.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	logPath := filepath.Join(dir, "job.log")
+	if err := os.WriteFile(logPath, append(c.SealLine([]byte("output\n")), '\n'), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "missing key", args: []string{logPath}, want: 1},
+		{name: "decrypts file", args: []string{"--encryption-key-file", keyPath, logPath}, want: 0},
+		{name: "missing file", args: []string{"--encryption-key-file", keyPath, logPath + ".missing"}, want: 1},
+		{name: "plain file", args: []string{"--encryption-key-file", keyPath, keyPath}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := runDecrypt(tt.args); code != tt.want {
+				t.Errorf("runDecrypt() = %v, want %v", code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/job"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// runLog is the end of the log of a run compared by cronmgr diff
+type runLog struct {
+	path  string
+	lines []string
+	// truncated is true if the log has more lines than were read
+	truncated bool
+	// err is why the log could not be read
+	err error
+}
+
+// runDiff compares two recorded runs: their outcome, command, environment and log
+func runDiff(args []string) int {
+	flags := pflag.NewFlagSet("diff", pflag.ContinueOnError)
+	flags.SortFlags = false
+	stateDir := flags.String("state-dir", "", "Directory recording the state of each job (required)")
+	name := flags.StringP("name", "n", "", "Only look for the runs among the runs of this job (default: all jobs)")
+	maxLogLines := flags.Int("max-log-lines", 2000, "Compare at most this many lines at the end of each log")
+	contextLines := flags.Int("context", 3, "Lines of context around each change of the logs")
+	keyFlags := addKeyFlags(flags)
+	noColor := addNoColorFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr diff <run-id-a> <run-id-b> --state-dir <dir> [options]
+
+Compare two runs recorded with --state-dir, e.g. last night's success and tonight's failure:
+their status, exit code, duration and attempts, their command and environment, and a unified
+diff of the end of their logs.
+
+Example:
+  cronmgr diff 20240501T020000Z-4242 20240502T020000Z-5151 --state-dir /var/lib/cronmgr
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	var err error
+	switch {
+	case flags.NArg() != 2:
+		err = fmt.Errorf("exactly two run IDs are required")
+	case *stateDir == "":
+		err = fmt.Errorf("--state-dir is required")
+	case *maxLogLines <= 0:
+		err = fmt.Errorf("--max-log-lines must be positive")
+	case *contextLines < 0:
+		err = fmt.Errorf("--context must not be negative")
+	}
+	var c *crypt.Cipher
+	if err == nil {
+		c, err = keyFlags.cipher()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	var journalOpts []history.Option
+	if c != nil {
+		journalOpts = append(journalOpts, history.WithCipher(c))
+	}
+	journal := history.NewJournal(afero.NewOsFs(), filepath.Join(*stateDir, runner.HistoryDir), journalOpts...)
+	var records [2]history.Record
+	var logs [2]runLog
+	for i := range records {
+		if records[i], err = findRun(journal, *name, flags.Arg(i)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		logs[i] = readRunLog(records[i].LogFile, c, *maxLogLines)
+	}
+	if err := writeRunDiff(os.Stdout, records[0], records[1], logs[0], logs[1], *contextLines, useColor(*noColor, os.Stdout)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// readRunLog reads the last maxLines lines of the log file at path, decrypted with c
+func readRunLog(path string, c *crypt.Cipher, maxLines int) runLog {
+	result := runLog{path: path}
+	if path == "" {
+		return result
+	}
+	var buf bytes.Buffer
+	if result.err = showLog(&buf, path, time.Time{}, c, nil, maxLines+1); result.err != nil {
+		return result
+	}
+	result.lines = strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if buf.Len() == 0 {
+		result.lines = nil
+	}
+	if len(result.lines) > maxLines {
+		result.lines, result.truncated = result.lines[1:], true
+	}
+	return result
+}
+
+// writeRunDiff writes the comparison of the runs a and b to w, changes are only colored if color is true
+func writeRunDiff(w io.Writer, a, b history.Record, logA, logB runLog, context int, color bool) error {
+	t := newTable("", "RUN A", "RUN B")
+	row := func(field, valueA, valueB string) {
+		rowColor := ""
+		if valueA != valueB {
+			rowColor = colorYellow
+		}
+		t.add(rowColor, field, valueA, valueB)
+	}
+	durationA, durationB := secondsDuration(a.DurationSeconds), secondsDuration(b.DurationSeconds)
+	row("Run", a.RunID, b.RunID)
+	row("Job", a.Name, b.Name)
+	row("Started", a.StartTime.Local().Format(time.RFC3339), b.StartTime.Local().Format(time.RFC3339))
+	row("Status", runOutcome(a), runOutcome(b))
+	row("Exit code", strconv.Itoa(a.ExitCode), strconv.Itoa(b.ExitCode))
+	t.add("", "Duration", formatDuration(durationA), formatDuration(durationB)+" ("+signedDuration(durationB-durationA)+")")
+	row("Attempts", strconv.Itoa(a.Attempts), strconv.Itoa(b.Attempts))
+	row("Command", recordCommand(a), recordCommand(b))
+	row("Directory", a.Dir, b.Dir)
+	row("Log file", a.LogFile, b.LogFile)
+	if err := t.write(w, color); err != nil {
+		return err
+	}
+
+	var lines []string
+	if env := diffEnv(a.Env, b.Env); len(env) > 0 {
+		lines = append(lines, "", "Environment:")
+		lines = append(lines, env...)
+	}
+	lines = append(lines, "")
+	switch {
+	case logA.path == "" || logB.path == "":
+		lines = append(lines, "Log: not recorded for both runs")
+	case logA.err != nil:
+		lines = append(lines, fmt.Sprintf("Log: %s: %v", logA.path, logA.err))
+	case logB.err != nil:
+		lines = append(lines, fmt.Sprintf("Log: %s: %v", logB.path, logB.err))
+	default:
+		hunks := unifiedDiff(diffLines(logA.lines, logB.lines), context)
+		if len(hunks) == 0 {
+			lines = append(lines, "Log: identical")
+			break
+		}
+		if logA.truncated || logB.truncated {
+			lines = append(lines, "Log (the end of each log, line numbers are relative to it):")
+		} else {
+			lines = append(lines, "Log:")
+		}
+		lines = append(lines, "--- "+logA.path, "+++ "+logB.path)
+		lines = append(lines, hunks...)
+	}
+	for _, line := range lines {
+		if color {
+			line = colorLine(line)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runOutcome describes the outcome of a run, with the error type of failed runs
+func runOutcome(record history.Record) string {
+	if record.ErrorType == "" {
+		return record.Status
+	}
+	return record.Status + " (" + record.ErrorType + ")"
+}
+
+// recordCommand returns the command line of a run, empty if it was not recorded
+func recordCommand(record history.Record) string {
+	if len(record.Args) == 0 {
+		return ""
+	}
+	return job.CommandLine(record.Args[0], record.Args[1:])
+}
+
+// signedDuration formats d with its sign, e.g. +34s
+func signedDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatDuration(-d)
+	}
+	return "+" + formatDuration(d)
+}
+
+// colorLine colors the removed, added and hunk lines of a diff
+func colorLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++"):
+		return line
+	case strings.HasPrefix(line, "-"):
+		return colorRed + line + colorReset
+	case strings.HasPrefix(line, "+"):
+		return colorGreen + line + colorReset
+	case strings.HasPrefix(line, "@@"):
+		return colorYellow + line + colorReset
+	}
+	return line
+}
+
+// diffEnv returns the variables of the environment a that b does not have or changes, prefixed with -,
+// followed by those of b that a does not have or changes, prefixed with +, each sorted by name
+func diffEnv(a, b []string) []string {
+	var removed, added []string
+	for _, entry := range a {
+		if !slices.Contains(b, entry) {
+			removed = append(removed, "-"+entry)
+		}
+	}
+	for _, entry := range b {
+		if !slices.Contains(a, entry) {
+			added = append(added, "+"+entry)
+		}
+	}
+	slices.Sort(removed)
+	slices.Sort(added)
+	return append(removed, added...)
+}
+
+// diffOp is a line of an edit script: kept (' '), removed ('-') or added ('+')
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns an edit script turning a into b with the fewest removed and added lines
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i*(m+1)+j] is the length of the longest common subsequence of midA[i:] and midB[j:]
+	n, m := len(midA), len(midB)
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case midA[i] == midB[j]:
+			ops = append(ops, diffOp{' ', midA[i]})
+			i, j = i+1, j+1
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			ops = append(ops, diffOp{'-', midA[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', midB[j]})
+			j++
+		}
+	}
+	for _, line := range midA[i:] {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range midB[j:] {
+		ops = append(ops, diffOp{'+', line})
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// unifiedDiff returns the hunks of the edit script ops in the unified format, with context kept lines
+// around each change. It returns nothing if ops has no change.
+func unifiedDiff(ops []diffOp, context int) []string {
+	// posA[k] and posB[k] are the number of lines of a and b before ops[k]
+	posA, posB := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for k, op := range ops {
+		posA[k+1], posB[k+1] = posA[k], posB[k]
+		if op.kind != '+' {
+			posA[k+1]++
+		}
+		if op.kind != '-' {
+			posB[k+1]++
+		}
+	}
+
+	var lines []string
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		start, end := max(0, k-context), k
+		// Extend the hunk over the changes separated by at most twice the context
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			kept := end
+			for kept < len(ops) && ops[kept].kind == ' ' {
+				kept++
+			}
+			if kept == len(ops) || kept-end > 2*context {
+				end = min(len(ops), end+context)
+				break
+			}
+			end = kept
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%s +%s @@",
+			hunkRange(posA[start], posA[end]-posA[start]), hunkRange(posB[start], posB[end]-posB[start])))
+		for _, op := range ops[start:end] {
+			lines = append(lines, string(op.kind)+op.line)
+		}
+		k = end
+	}
+	return lines
+}
+
+// hunkRange formats the range of a hunk of count lines after the first before lines of a file
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return strconv.Itoa(before + 1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/history"
+)
+
+// TestUnifiedDiff tests the hunks against those of diff -u
+func TestUnifiedDiff(t *testing.T) {
+	lines := strings.Split("a b c d e f g h i j", " ")
+	tests := []struct {
+		name    string
+		a, b    []string
+		context int
+		want    []string
+	}{
+		{name: "identical", a: lines, b: lines, context: 3},
+		{
+			name: "separate hunks", a: lines, b: strings.Split("a b X d e f g h i j k", " "), context: 1,
+			want: []string{"@@ -2,3 +2,3 @@", " b", "-c", "+X", " d", "@@ -10 +10,2 @@", " j", "+k"},
+		},
+		{
+			name: "merged hunk", a: lines, b: strings.Split("a b X d e f g h i j k", " "), context: 4,
+			want: []string{"@@ -1,10 +1,11 @@", " a", " b", "-c", "+X", " d", " e", " f", " g", " h", " i", " j", "+k"},
+		},
+		{name: "added file", b: []string{"a", "b"}, context: 3, want: []string{"@@ -0,0 +1,2 @@", "+a", "+b"}},
+		{name: "removed lines", a: lines[:3], b: lines[:1], context: 0, want: []string{"@@ -2,2 +1,0 @@", "-b", "-c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff(diffLines(tt.a, tt.b), tt.context); !slices.Equal(got, tt.want) {
+				t.Errorf("unifiedDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDiffEnv tests listing the changed environment variables
+func TestDiffEnv(t *testing.T) {
+	got := diffEnv([]string{"PATH=/bin", "MODE=full", "OLD=1"}, []string{"PATH=/bin", "NEW=2", "MODE=incremental"})
+	want := []string{"-MODE=full", "-OLD=1", "+MODE=incremental", "+NEW=2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("diffEnv() = %q, want %q", got, want)
+	}
+}
+
+// TestReadRunLog tests reading the end of the log of a run
+func TestReadRunLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.log")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRunLog(path, nil, 3); !slices.Equal(got.lines, []string{"one", "two", "three"}) || got.truncated || got.err != nil {
+		t.Errorf("readRunLog() = %+v, want the whole log", got)
+	}
+	if got := readRunLog(path, nil, 2); !slices.Equal(got.lines, []string{"two", "three"}) || !got.truncated {
+		t.Errorf("readRunLog() = %+v, want the last 2 lines", got)
+	}
+	if got := readRunLog(filepath.Join(t.TempDir(), "missing.log"), nil, 2); got.err == nil {
+		t.Errorf("readRunLog() of a missing log = %+v, want an error", got)
+	}
+}
+
+// TestWriteRunDiff tests the comparison of two runs
+func TestWriteRunDiff(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	a := history.Record{Name: "backup", RunID: "run-1", StartTime: start, DurationSeconds: 12, Status: "success", Attempts: 1,
+		Args: []string{"/usr/bin/backup"}, Env: []string{"MODE=full"}, LogFile: "/logs/run-1.log"}
+	b := history.Record{Name: "backup", RunID: "run-2", StartTime: start.Add(24 * time.Hour), DurationSeconds: 46, Status: "failed",
+		ErrorType: "job", ExitCode: 2, Attempts: 3, Args: []string{"/usr/bin/backup"}, Env: []string{"MODE=incremental"}, LogFile: "/logs/run-2.log"}
+	logA := runLog{path: a.LogFile, lines: []string{"starting", "done"}}
+	logB := runLog{path: b.LogFile, lines: []string{"starting", "disk full"}}
+
+	var buf bytes.Buffer
+	if err := writeRunDiff(&buf, a, b, logA, logB, 3, false); err != nil {
+		t.Fatalf("writeRunDiff() error = %v", err)
+	}
+	for _, want := range []string{
+		"Status     success               failed (job)\n",
+		"Exit code  0                     2\n",
+		"Duration   12s                   46s (+34s)\n",
+		"Environment:\n-MODE=full\n+MODE=incremental\n",
+		"--- /logs/run-1.log\n+++ /logs/run-2.log\n@@ -1,2 +1,2 @@\n starting\n-done\n+disk full\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("writeRunDiff() output misses %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// runHistory dispatches the history subcommands
+func runHistory(args []string) int {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprintf(os.Stderr, "Usage: cronmgr history export --state-dir <dir> [options]\n")
+		return 1
+	}
+	return runHistoryExport(args[1:])
+}
+
+// runHistoryExport writes the recorded runs of jobs as CSV or JSON to stdout
+func runHistoryExport(args []string) int {
+	flags := pflag.NewFlagSet("history export", pflag.ContinueOnError)
+	flags.SortFlags = false
+	stateDir := flags.String("state-dir", "", "Directory recording the state of each job (required)")
+	format := flags.String("format", history.FormatCSV, "Output format: csv, json or table")
+	since := flags.String("since", "", "Only export runs started within this age, e.g. 30d or 12h (default: all runs)")
+	name := flags.StringP("name", "n", "", "Only export runs of this job (default: all jobs)")
+	keyFlags := addKeyFlags(flags)
+	daily := flags.Bool("daily", false, "Export the daily aggregates of compacted runs instead of individual runs")
+	noColor := addNoColorFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr history export --state-dir <dir> [options]
+
+Export the runs recorded with --state-dir, oldest first, e.g. for spreadsheets or notebooks.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *stateDir == "" {
+		fmt.Fprintf(os.Stderr, "Error: --state-dir is required\n\n")
+		flags.Usage()
+		return 1
+	}
+	var sinceTime time.Time
+	if *since != "" {
+		age, err := parseAge(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --since: %v\n\n", err)
+			flags.Usage()
+			return 1
+		}
+		sinceTime = time.Now().Add(-age)
+	}
+
+	c, err := keyFlags.cipher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+	var journalOpts []history.Option
+	if c != nil {
+		journalOpts = append(journalOpts, history.WithCipher(c))
+	}
+
+	journal := history.NewJournal(afero.NewOsFs(), filepath.Join(*stateDir, runner.HistoryDir), journalOpts...)
+	color := useColor(*noColor, os.Stdout)
+	if *daily {
+		return exportDaily(journal, *format, *name, sinceTime, color)
+	}
+	var records []history.Record
+	if *name != "" {
+		records, err = journal.Read(*name, sinceTime)
+	} else {
+		records, err = journal.ReadAll(sinceTime)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *format == outputTable {
+		err = writeRecords(os.Stdout, records, color)
+	} else {
+		err = history.Export(os.Stdout, *format, records)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// exportDaily writes the daily aggregates of jobs that started at or after since to stdout
+func exportDaily(journal *history.Journal, format, name string, since time.Time, color bool) int {
+	var daily []history.Daily
+	var err error
+	if name != "" {
+		daily, err = journal.ReadDaily(name)
+	} else {
+		daily, err = journal.ReadAllDaily()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	sinceDay := since.UTC().Format(time.DateOnly)
+	daily = slices.DeleteFunc(daily, func(d history.Daily) bool { return d.Day < sinceDay })
+	if format == outputTable {
+		err = writeDaily(os.Stdout, daily, color)
+	} else {
+		err = history.ExportDaily(os.Stdout, format, daily)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeRecords writes records to w as a table, rows are colored by status if color is true
+func writeRecords(w io.Writer, records []history.Record, color bool) error {
+	t := newTable("JOB", "STARTED", "DURATION", "STATUS", "ERROR", "EXIT", "ATTEMPTS", "RUN")
+	for _, record := range records {
+		t.add(statusColor(record.Status), record.Name, record.StartTime.Local().Format(time.DateTime),
+			formatDuration(secondsDuration(record.DurationSeconds)), record.Status, orDash(record.ErrorType),
+			strconv.Itoa(record.ExitCode), strconv.Itoa(record.Attempts), orDash(record.RunID))
+	}
+	return t.write(w, color)
+}
+
+// writeDaily writes daily aggregates to w as a table, days with failures are colored if color is true
+func writeDaily(w io.Writer, daily []history.Daily, color bool) error {
+	t := newTable("JOB", "DAY", "RUNS", "FAILURES", "P50", "P95")
+	for _, d := range daily {
+		rowColor := ""
+		if d.Failures > 0 {
+			rowColor = colorRed
+		}
+		t.add(rowColor, d.Name, d.Day, strconv.Itoa(d.Runs), strconv.Itoa(d.Failures),
+			formatDuration(secondsDuration(d.P50Seconds)), formatDuration(secondsDuration(d.P95Seconds)))
+	}
+	return t.write(w, color)
+}
+
+// parseRetention parses the history retention flags, empty values disable the retention
+func parseRetention(runs, daily string) (history.Retention, error) {
+	var retention history.Retention
+	var err error
+	if runs != "" {
+		if retention.Runs, err = parseAge(runs); err != nil {
+			return retention, fmt.Errorf("--history-retention: %w", err)
+		}
+	}
+	if daily != "" {
+		if retention.Daily, err = parseAge(daily); err != nil {
+			return retention, fmt.Errorf("--history-daily-retention: %w", err)
+		}
+	}
+	return retention, nil
+}
+
+// parseAge parses a duration that may also be given in days, e.g. 30d
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
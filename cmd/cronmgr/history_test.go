@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/history"
+)
+
+// TestRunHistory tests argument handling of the history subcommand
+func TestRunHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "no subcommand", want: 1},
+		{name: "unknown subcommand", args: []string{"import"}, want: 1},
+		{name: "missing state dir", args: []string{"export"}, want: 1},
+		{name: "invalid since", args: []string{"export", "--state-dir", "/nonexistent", "--since", "soon"}, want: 1},
+		{name: "invalid format", args: []string{"export", "--state-dir", "/nonexistent", "--format", "xml"}, want: 1},
+		{name: "empty history", args: []string{"export", "--state-dir", "/nonexistent"}, want: 0},
+		{name: "empty daily aggregates", args: []string{"export", "--state-dir", "/nonexistent", "--daily", "--since", "30d"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := runHistory(tt.args); code != tt.want {
+				t.Errorf("runHistory() = %v, want %v", code, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseAge tests parsing ages given as durations or days
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      time.Duration
+		wantError bool
+	}{
+		{value: "30d", want: 30 * 24 * time.Hour},
+		{value: "12h", want: 12 * time.Hour},
+		{value: "0d", want: 0},
+		{value: "d", wantError: true},
+		{value: "-1d", wantError: true},
+		{value: "soon", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseAge(tt.value)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("parseAge() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("parseAge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseRetention tests parsing the history retention flags
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		runs      string
+		daily     string
+		want      history.Retention
+		wantError bool
+	}{
+		{name: "disabled"},
+		{name: "runs and daily", runs: "7d", daily: "365d", want: history.Retention{Runs: 7 * 24 * time.Hour, Daily: 365 * 24 * time.Hour}},
+		{name: "invalid runs", runs: "week", wantError: true},
+		{name: "invalid daily", daily: "year", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRetention(tt.runs, tt.daily)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("parseRetention() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !tt.wantError && got != tt.want {
+				t.Errorf("parseRetention() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteRecords tests the table output of history export
+func TestWriteRecords(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	records := []history.Record{
+		{Name: "backup", RunID: "20240101T020000Z-42", StartTime: start, DurationSeconds: 90, Status: "failed", ErrorType: "job", ExitCode: 2, Attempts: 1},
+		{Name: "backup", StartTime: start.Add(time.Hour), DurationSeconds: 30, Status: "success", Attempts: 1},
+	}
+	var buf bytes.Buffer
+	if err := writeRecords(&buf, records, true); err != nil {
+		t.Fatalf("writeRecords() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("writeRecords() = %q, want a header and two rows", buf.String())
+	}
+	if !strings.HasPrefix(lines[1], colorRed) || !strings.Contains(lines[1], "1m30s") || !strings.Contains(lines[1], "20240101T020000Z-42") {
+		t.Errorf("failed row = %q, want red row with duration and run ID", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], colorGreen) || !strings.Contains(lines[2], "30s") {
+		t.Errorf("success row = %q, want green row with duration", lines[2])
+	}
+}
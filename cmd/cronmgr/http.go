@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/httpclient"
+	"github.com/alswl/cron-manager/internal/netdial"
+	"github.com/alswl/cron-manager/internal/secret"
+	"github.com/spf13/pflag"
+)
+
+// httpFlags are the flags configuring the HTTP client of the push backends and notifiers
+type httpFlags struct {
+	proxy             *string
+	proxyPasswordFile *string
+	caFile            *string
+	certFile          *string
+	keyFile           *string
+	timeout           *time.Duration
+	bindInterface     *string
+}
+
+// addHTTPFlags registers the HTTP client flags on flags
+func addHTTPFlags(flags *pflag.FlagSet) *httpFlags {
+	return &httpFlags{
+		proxy:             flags.String("http-proxy", "", "Send the requests of the push backends and notifiers through this proxy, e.g. http://user@proxy:3128 (default: $HTTPS_PROXY, $HTTP_PROXY and $NO_PROXY)"),
+		proxyPasswordFile: flags.String("http-proxy-password-file", "", "File containing the password of the --http-proxy user, read again for each connection (default: $CRONMGR_PROXY_PASSWORD_FILE or $CRONMGR_PROXY_PASSWORD)"),
+		caFile:            flags.String("http-ca-file", "", "PEM file of CAs trusted in addition to the system roots, e.g. of a TLS-inspecting proxy"),
+		certFile:          flags.String("http-cert-file", "", "PEM file of the client certificate presented to the servers asking for one"),
+		keyFile:           flags.String("http-key-file", "", "PEM file of the key of the client certificate"),
+		timeout:           flags.Duration("http-timeout", httpclient.DefaultTimeout, "Timeout of each request of the push backends and notifiers"),
+		bindInterface:     flags.String("bind-interface", "", "Connect to the push backends, notifiers and MQTT broker from this interface or local address, e.g. eth1 or 2001:db8::10"),
+	}
+}
+
+// client builds the HTTP client from the parsed flags, falling back to the addresses of dnsCache while DNS
+// fails if it is not nil. With a proxy, its password is read from the password file, or else from the file
+// of $CRONMGR_PROXY_PASSWORD_FILE or from $CRONMGR_PROXY_PASSWORD.
+func (f *httpFlags) client(dnsCache *netdial.Cache) (*http.Client, error) {
+	cfg := httpclient.Config{
+		Proxy:         *f.proxy,
+		CAFile:        *f.caFile,
+		CertFile:      *f.certFile,
+		KeyFile:       *f.keyFile,
+		Timeout:       *f.timeout,
+		BindInterface: *f.bindInterface,
+		DNSCache:      dnsCache,
+	}
+	if *f.proxy != "" || *f.proxyPasswordFile != "" {
+		cfg.ProxyPassword = secret.Lookup(*f.proxyPasswordFile, httpclient.ProxyPasswordEnv)
+	}
+	if _, err := cfg.ProxyPassword.Get(); err != nil {
+		return nil, fmt.Errorf("proxy password: %w", err)
+	}
+	client, err := httpclient.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP client: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/httpclient"
+	"github.com/spf13/pflag"
+)
+
+// TestHTTPFlags tests building the HTTP client from the --http-* flags, with the proxy password of a file or the environment
+func TestHTTPFlags(t *testing.T) {
+	var gotAuthorization string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuthorization = r.Header.Get("Proxy-Authorization")
+	}))
+	defer proxy.Close()
+	proxyURL := "http://batch@" + proxy.Listener.Addr().String()
+	passwordFile := filepath.Join(t.TempDir(), "proxy-password")
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		args              []string
+		env               string
+		wantAuthorization string
+		wantError         bool
+	}{
+		{name: "default"},
+		{name: "password file", args: []string{"--http-proxy", proxyURL, "--http-proxy-password-file", passwordFile}, env: "from-env", wantAuthorization: "batch:from-file"},
+		{name: "password env", args: []string{"--http-proxy", proxyURL}, env: "from-env", wantAuthorization: "batch:from-env"},
+		{name: "missing password file", args: []string{"--http-proxy", proxyURL, "--http-proxy-password-file", passwordFile + ".missing"}, wantError: true},
+		{name: "password without proxy", args: []string{"--http-proxy-password-file", passwordFile}, wantError: true},
+		{name: "key without certificate", args: []string{"--http-key-file", passwordFile}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(httpclient.ProxyPasswordEnv, tt.env)
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			httpFlags := addHTTPFlags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			client, err := httpFlags.client(nil)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("client() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantAuthorization == "" {
+				return
+			}
+			resp, err := client.Get("http://pushgateway.example.com:9091/metrics")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			_ = resp.Body.Close()
+			if want := "Basic " + base64.StdEncoding.EncodeToString([]byte(tt.wantAuthorization)); gotAuthorization != want {
+				t.Errorf("Proxy-Authorization = %q, want %q", gotAuthorization, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/precheck"
+)
+
+// gcOff disables the garbage collector with --gogc, as the GOGC environment variable does
+const gcOff = "off"
+
+// parseGCPercent parses the --gogc value, a percentage or "off"
+func parseGCPercent(value string) (int, error) {
+	if strings.EqualFold(value, gcOff) {
+		return -1, nil
+	}
+	percent, err := strconv.Atoi(value)
+	if err != nil || percent < 0 {
+		return 0, fmt.Errorf("invalid value %q, must be a non-negative percentage or %q", value, gcOff)
+	}
+	return percent, nil
+}
+
+// applyRuntimeLimits tunes the garbage collector of cronmgr itself, empty values keep the defaults.
+// Unlike the GOMEMLIMIT and GOGC environment variables, this does not affect Go programs run as the job.
+func applyRuntimeLimits(memoryLimit, gcPercent string) error {
+	if memoryLimit != "" {
+		limit, err := precheck.ParseBytes(memoryLimit)
+		if err != nil {
+			return fmt.Errorf("--gomemlimit: %w", err)
+		}
+		debug.SetMemoryLimit(int64(min(limit, math.MaxInt64)))
+	}
+	if gcPercent != "" {
+		percent, err := parseGCPercent(gcPercent)
+		if err != nil {
+			return fmt.Errorf("--gogc: %w", err)
+		}
+		debug.SetGCPercent(percent)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestParseGCPercent tests the accepted --gogc values
+func TestParseGCPercent(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "50", want: 50},
+		{value: "0", want: 0},
+		{value: "off", want: -1},
+		{value: "OFF", want: -1},
+		{value: "-1", wantErr: true},
+		{value: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseGCPercent(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGCPercent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseGCPercent() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestApplyRuntimeLimitsInvalid tests that invalid limits are rejected
+func TestApplyRuntimeLimitsInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		memoryLimit string
+		gcPercent   string
+	}{
+		{name: "memory limit", memoryLimit: "lots"},
+		{name: "gc percent", gcPercent: "fast"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := applyRuntimeLimits(tt.memoryLimit, tt.gcPercent); err == nil {
+				t.Errorf("applyRuntimeLimits() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/registry"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// runList lists the jobs recorded in the registry of the host
+func runList(args []string) int {
+	flags := pflag.NewFlagSet("list", pflag.ContinueOnError)
+	flags.SortFlags = false
+	registryFile := flags.String("registry", registry.DefaultPath, "Registry file the jobs record their runs in with --registry")
+	output := flags.StringP("output", "o", outputTable, "Output format: table or json")
+	noColor := addNoColorFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr list [options]
+
+List every job run with --registry on this host: its command, schedule, owner, user and last run.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *output != outputTable && *output != outputJSON {
+		fmt.Fprintf(os.Stderr, "Error: unsupported output %q, use %s or %s\n\n", *output, outputTable, outputJSON)
+		flags.Usage()
+		return 1
+	}
+
+	jobs, err := registry.New(afero.NewOsFs(), *registryFile).List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := writeJobs(os.Stdout, jobs, *output, useColor(*noColor, os.Stdout)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeJobs writes the registered jobs to w as a table or JSON
+func writeJobs(w io.Writer, jobs []registry.Job, output string, color bool) error {
+	if output == outputJSON {
+		if jobs == nil {
+			jobs = []registry.Job{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jobs)
+	}
+	t := newTable("JOB", "OWNER", "USER", "SCHEDULE", "LAST RUN", "COMMAND")
+	for _, j := range jobs {
+		t.add("", j.Name, orDash(j.Owner), orDash(j.User), orDash(j.Schedule), j.LastRun.Local().Format(time.DateTime), j.Command)
+	}
+	return t.write(w, color)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/registry"
+)
+
+// TestWriteJobs tests the table and JSON outputs of the registered jobs
+func TestWriteJobs(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	jobs := []registry.Job{
+		{Name: "backup", Command: "/usr/bin/backup --full", Schedule: "0 2 * * *", User: "root", FirstSeen: start, LastRun: start},
+		{Name: "report", Owner: "team-a", Command: "sh -c 'report > /tmp/out'", LastRun: start},
+	}
+
+	tests := []struct {
+		output string
+		jobs   []registry.Job
+		want   []string
+	}{
+		{output: outputTable, jobs: jobs, want: []string{"JOB", "backup  -       root", "0 2 * * *", "/usr/bin/backup --full", "report  team-a  -"}},
+		{output: outputJSON, jobs: jobs, want: []string{`"name": "backup"`, `"schedule": "0 2 * * *"`, `"owner": "team-a"`}},
+		{output: outputJSON, want: []string{"[]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeJobs(&buf, tt.jobs, tt.output, false); err != nil {
+				t.Fatalf("writeJobs() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("writeJobs() = %q, want it to contain %q", buf.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/logwriter"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// runLogs writes the log of a run of a job to stdout, optionally filtered and limited to its last lines
+func runLogs(args []string) int {
+	flags := pflag.NewFlagSet("logs", pflag.ContinueOnError)
+	flags.SortFlags = false
+	stateDir := flags.String("state-dir", "", "Directory recording the state of each job (required)")
+	runID := flags.String("run", "", "ID of the run to show, as listed by cronmgr history export (default: the latest run)")
+	grep := flags.String("grep", "", "Only show lines matching this regular expression")
+	tail := flags.Int("tail", 0, "Only show the last N lines, 0 shows all lines")
+	sinceFlag := flags.String("since", "", "Only show the output written since this time, as HH:MM, RFC 3339 or an age like 30m, seeking with the index of logs written with --log-chunk-size")
+	keyFlags := addKeyFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr logs <job> --state-dir <dir> [options]
+
+Show the log of a run recorded with --state-dir, wherever it was written: the log file, the
+fallback directory or a compressed copy left by log rotation.
+
+Example:
+  cronmgr logs job_cron --state-dir /var/lib/cronmgr --since 02:15
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	var err error
+	switch {
+	case flags.NArg() != 1:
+		err = fmt.Errorf("exactly one job name is required")
+	case *stateDir == "":
+		err = fmt.Errorf("--state-dir is required")
+	case *tail < 0:
+		err = fmt.Errorf("--tail must not be negative")
+	}
+	var since time.Time
+	if err == nil && *sinceFlag != "" {
+		if since, err = parseSince(*sinceFlag, time.Now()); err != nil {
+			err = fmt.Errorf("--since: %w", err)
+		}
+	}
+	var pattern *regexp.Regexp
+	if err == nil && *grep != "" {
+		if pattern, err = regexp.Compile(*grep); err != nil {
+			err = fmt.Errorf("--grep: %w", err)
+		}
+	}
+	var c *crypt.Cipher
+	if err == nil {
+		c, err = keyFlags.cipher()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	var journalOpts []history.Option
+	if c != nil {
+		journalOpts = append(journalOpts, history.WithCipher(c))
+	}
+	fs := afero.NewOsFs()
+	store := state.NewStore(fs, *stateDir)
+	journal := history.NewJournal(fs, filepath.Join(*stateDir, runner.HistoryDir), journalOpts...)
+	path, err := resolveLog(store, journal, flags.Arg(0), *runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := showLog(os.Stdout, path, since, c, pattern, *tail); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+		return 1
+	}
+	return 0
+}
+
+// resolveLog returns the log file of the run runID of the job name, or of its latest run if runID is empty.
+// The latest run is taken from the state store, it may still be running; earlier runs from the run history.
+func resolveLog(store *state.Store, journal *history.Journal, name, runID string) (string, error) {
+	latest, found, err := store.Load(name)
+	if err != nil {
+		return "", err
+	}
+	logFile := ""
+	switch {
+	case runID == "" && !found:
+		return "", fmt.Errorf("job %s has no recorded run", name)
+	case runID == "" || latest.RunID == runID:
+		runID, logFile = latest.RunID, latest.LogFile
+	default:
+		records, err := journal.Read(name, time.Time{})
+		if err != nil {
+			return "", err
+		}
+		index := slices.IndexFunc(records, func(record history.Record) bool { return record.RunID == runID })
+		if index == -1 {
+			return "", fmt.Errorf("run %s of job %s not found", runID, name)
+		}
+		logFile = records[index].LogFile
+	}
+	if logFile == "" {
+		return "", fmt.Errorf("no log file recorded for run %s of job %s", runID, name)
+	}
+	return logFile, nil
+}
+
+// parseSince parses the --since time: a time of day HH:MM, the latest one before now, an RFC 3339 time or an age
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if clock, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		since := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+		if since.After(now) {
+			since = since.AddDate(0, 0, -1)
+		}
+		return since, nil
+	}
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected HH:MM, RFC 3339 or an age like 30m", value)
+	}
+	return now.Add(-age), nil
+}
+
+// showLog writes the lines of the log file at path matching pattern to w, only the last tail ones if tail is positive.
+// A non-zero since starts at the output written since then, found with the index of chunked log files.
+// Encrypted log files are decrypted with c.
+func showLog(w io.Writer, path string, since time.Time, c *crypt.Cipher, pattern *regexp.Regexp, tail int) error {
+	var file io.ReadCloser
+	var err error
+	if since.IsZero() {
+		file, err = logwriter.Open(path)
+	} else if file, err = logwriter.OpenSince(path, since); errors.Is(err, fs.ErrNotExist) {
+		err = fmt.Errorf("%w, --since needs a log written with --log-chunk-size", err)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	var content io.Reader = file
+	if c != nil {
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(c.Decrypt(file, writer))
+		}()
+		// Unblock the decryption if reading stops early
+		defer func() { _ = reader.Close() }()
+		content = reader
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if pattern != nil && !pattern.MatchString(line) {
+			continue
+		}
+		if tail == 0 {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) > tail {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/logwriter"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+)
+
+// TestResolveLog tests finding the log file of the latest or a given run
+func TestResolveLog(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	store := state.NewStore(fs, "/state")
+	journal := history.NewJournal(fs, "/state/history")
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	for _, record := range []history.Record{
+		{Name: "backup", RunID: "run-1", StartTime: start, LogFile: "/logs/run-1.log"},
+		{Name: "backup", RunID: "run-2", StartTime: start.Add(time.Hour)},
+	} {
+		if err := journal.Append(record); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	if err := store.Save(state.RunState{Name: "backup", RunID: "run-3", Running: true, LogFile: "/logs/run-3.log"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		job       string
+		runID     string
+		want      string
+		wantError bool
+	}{
+		{name: "latest run", job: "backup", want: "/logs/run-3.log"},
+		{name: "latest run by id", job: "backup", runID: "run-3", want: "/logs/run-3.log"},
+		{name: "earlier run", job: "backup", runID: "run-1", want: "/logs/run-1.log"},
+		{name: "run without log file", job: "backup", runID: "run-2", wantError: true},
+		{name: "unknown run", job: "backup", runID: "run-4", wantError: true},
+		{name: "unknown job", job: "restore", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveLog(store, journal, tt.job, tt.runID)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("resolveLog() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("resolveLog() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestShowLog tests filtering and tailing plain and encrypted log files
+func TestShowLog(t *testing.T) {
+	dir := t.TempDir()
+	content := "starting\nerror: disk full\nretrying\nerror: disk still full\ndone\n"
+	plainPath := filepath.Join(dir, "plain.log")
+	if err := os.WriteFile(plainPath, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	c, err := crypt.NewCipher(bytes.Repeat([]byte{1}, crypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	var encrypted bytes.Buffer
+	if _, err := c.NewWriter(&encrypted).Write([]byte(content)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	encryptedPath := filepath.Join(dir, "encrypted.log")
+	if err := os.WriteFile(encryptedPath, encrypted.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	chunkedPath := filepath.Join(dir, "chunked.log")
+	lw, err := logwriter.NewLogWriter(chunkedPath, logwriter.WithChunkSize(16))
+	if err != nil {
+		t.Fatalf("NewLogWriter() error = %v", err)
+	}
+	if _, err := lw.Write([]byte(content)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := errors.Join(lw.Wait(), lw.Close()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		path      string
+		since     time.Time
+		cipher    *crypt.Cipher
+		grep      string
+		tail      int
+		want      string
+		wantError bool
+	}{
+		{name: "all", path: plainPath, want: content},
+		{name: "grep", path: plainPath, grep: "^error", want: "error: disk full\nerror: disk still full\n"},
+		{name: "tail", path: plainPath, tail: 2, want: "error: disk still full\ndone\n"},
+		{name: "grep and tail", path: plainPath, grep: "error", tail: 1, want: "error: disk still full\n"},
+		{name: "encrypted", path: encryptedPath, cipher: c, grep: "full", tail: 1, want: "error: disk still full\n"},
+		{name: "missing", path: filepath.Join(dir, "missing.log"), wantError: true},
+		{name: "chunked", path: chunkedPath, grep: "^error", want: "error: disk full\nerror: disk still full\n"},
+		{name: "chunked since", path: chunkedPath, since: now.Add(-time.Hour), tail: 1, want: "done\n"},
+		{name: "chunked since later", path: chunkedPath, since: now.Add(time.Hour)},
+		{name: "since without index", path: plainPath, since: now.Add(-time.Hour), wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pattern *regexp.Regexp
+			if tt.grep != "" {
+				pattern = regexp.MustCompile(tt.grep)
+			}
+			var buf bytes.Buffer
+			err := showLog(&buf, tt.path, tt.since, tt.cipher, pattern, tt.tail)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("showLog() error = %v, wantError %v", err, tt.wantError)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("showLog() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestParseSince tests parsing the --since times of day, RFC 3339 times and ages
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		value     string
+		want      time.Time
+		wantError bool
+	}{
+		{name: "time of day", value: "02:15", want: time.Date(2024, 5, 1, 2, 15, 0, 0, time.UTC)},
+		{name: "time of day yesterday", value: "23:00", want: time.Date(2024, 4, 30, 23, 0, 0, 0, time.UTC)},
+		{name: "RFC 3339", value: "2024-04-28T08:00:00Z", want: time.Date(2024, 4, 28, 8, 0, 0, 0, time.UTC)},
+		{name: "age", value: "30m", want: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{name: "days", value: "2d", want: time.Date(2024, 4, 29, 10, 30, 0, 0, time.UTC)},
+		{name: "invalid", value: "yesterday", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSince(tt.value, now)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("parseSince() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,19 +1,48 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"math"
+	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/alswl/cron-manager/internal/calendar"
+	"github.com/alswl/cron-manager/internal/capacity"
+	"github.com/alswl/cron-manager/internal/cloudmonitoring"
+	"github.com/alswl/cron-manager/internal/cloudwatch"
+	"github.com/alswl/cron-manager/internal/config"
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/events"
 	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/fileperm"
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/alswl/cron-manager/internal/fssnapshot"
+	"github.com/alswl/cron-manager/internal/health"
+	"github.com/alswl/cron-manager/internal/influx"
+	"github.com/alswl/cron-manager/internal/inventory"
 	"github.com/alswl/cron-manager/internal/job"
+	"github.com/alswl/cron-manager/internal/lease"
 	"github.com/alswl/cron-manager/internal/logwriter"
+	"github.com/alswl/cron-manager/internal/netdial"
+	"github.com/alswl/cron-manager/internal/pglock"
+	"github.com/alswl/cron-manager/internal/precheck"
+	"github.com/alswl/cron-manager/internal/registry"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/alswl/cron-manager/internal/secret"
 	"github.com/alswl/cron-manager/internal/version"
+	"github.com/alswl/cron-manager/internal/watchdog"
+	"github.com/spf13/afero"
 	"github.com/spf13/pflag"
 )
 
@@ -46,26 +75,326 @@ func extractCommandAfterSeparator(args []string) (command string, arguments []st
 		return "", nil, fmt.Errorf("command is required after '%s' separator", separator)
 	}
 
+	if commandArgs[0] == "" {
+		return "", nil, fmt.Errorf("command after '%s' separator is empty", separator)
+	}
+
 	// First element is the command, rest are arguments
 	command = commandArgs[0]
 	arguments = commandArgs[1:]
 	return command, arguments, nil
 }
 
+// exporterFlags are the flags configuring the Prometheus exporter, shared by job runs and subcommands
+type exporterFlags struct {
+	dir      *string
+	textfile *string
+	metric   *string
+	noMetric *bool
+	owner    *string
+	chmod    *string
+	labels   *map[string]string
+	lock     *string
+	lockDir  *string
+	lockMode *string
+	shards   *int
+}
+
+// addExporterFlags registers the exporter flags on flags
+func addExporterFlags(flags *pflag.FlagSet) *exporterFlags {
+	return &exporterFlags{
+		dir:      flags.StringP("dir", "d", "", "Directory for Prometheus exporter file (default: /var/lib/prometheus/node-exporter or COLLECTOR_TEXTFILE_PATH env var)"),
+		textfile: flags.String("textfile", "crons.prom", "Filename for Prometheus exporter file"),
+		metric:   flags.String("metric", "crontab", "Metric name for Prometheus metrics"),
+		noMetric: flags.Bool("no-metric", false, "Disable metric writing to Prometheus exporter file"),
+		chmod:    flags.String("metric-chmod", "", "Permission of the Prometheus exporter file, e.g. 0640 (default: 0644 before umask)"),
+		owner:    flags.String("owner", "", "Write metrics to a separate file for this owner (e.g. crons_<owner>.prom), labeled with owner=\"<owner>\""),
+		labels:   flags.StringToString("label", nil, "Constant labels added to every series as key=value pairs, e.g. env=prod,dc=eu (repeatable)"),
+		lock:     flags.String("lock-backend", fslock.DefaultBackend, "Locking of the exporter and state files: flock, fcntl (POSIX locks, e.g. for NFS) or dotfile (exclusive lock files)"),
+		lockDir:  flags.String("lock-dir", "", "Directory of the lock files, e.g. one writable by all the users running jobs (default: next to the locked files)"),
+		lockMode: flags.String("lock-mode", "", "Permission of the lock files, e.g. 0666 to share them between users (default: 0644)"),
+		shards:   flags.Int("textfile-shards", 0, "Spread the series of the jobs over this many exporter files by a hash of the job name, e.g. crons_shard3.prom (0 = a single file)"),
+	}
+}
+
+// options builds the exporter options from the parsed flags, and selects the lock backend of the process
+func (f *exporterFlags) options() ([]exporter.Option, error) {
+	if err := fslock.SetBackend(*f.lock); err != nil {
+		return nil, fmt.Errorf("--lock-backend: %w", err)
+	}
+	if *f.lockDir != "" {
+		fslock.SetDir(fslock.Canonical(*f.lockDir))
+	}
+	if *f.lockMode != "" {
+		mode, err := fileperm.ParseMode(*f.lockMode)
+		if err != nil {
+			return nil, fmt.Errorf("--lock-mode: %w", err)
+		}
+		fslock.SetMode(mode)
+	}
+	var opts []exporter.Option
+	if *f.dir != "" {
+		opts = append(opts, exporter.WithExporterDir(fslock.Canonical(*f.dir)))
+	}
+	if *f.textfile != "" {
+		opts = append(opts, exporter.WithExporterFilename(*f.textfile))
+	}
+	if *f.metric != "" {
+		opts = append(opts, exporter.WithMetricName(*f.metric))
+	}
+	if *f.noMetric {
+		opts = append(opts, exporter.WithMetricDisabled(true))
+	}
+	if *f.owner != "" {
+		opts = append(opts, exporter.WithOwner(*f.owner))
+	}
+	if *f.chmod != "" {
+		mode, err := fileperm.ParseMode(*f.chmod)
+		if err != nil {
+			return nil, fmt.Errorf("--metric-chmod: %w", err)
+		}
+		opts = append(opts, exporter.WithFileMode(mode))
+	}
+	if *f.shards < 0 {
+		return nil, fmt.Errorf("--textfile-shards must not be negative")
+	}
+	if *f.shards > 1 {
+		opts = append(opts, exporter.WithShards(*f.shards))
+	}
+	if len(*f.labels) > 0 {
+		if err := exporter.ValidateLabels(*f.labels); err != nil {
+			return nil, fmt.Errorf("--label: %w", err)
+		}
+		opts = append(opts, exporter.WithLabels(*f.labels))
+	}
+	return opts, nil
+}
+
+// args returns the command line arguments reproducing the parsed flags, to configure a child process the same way
+func (f *exporterFlags) args() []string {
+	args := []string{"--textfile", *f.textfile, "--metric", *f.metric}
+	if *f.dir != "" {
+		args = append(args, "--dir", *f.dir)
+	}
+	if *f.noMetric {
+		args = append(args, "--no-metric")
+	}
+	if *f.owner != "" {
+		args = append(args, "--owner", *f.owner)
+	}
+	if *f.chmod != "" {
+		args = append(args, "--metric-chmod", *f.chmod)
+	}
+	for _, name := range slices.Sorted(maps.Keys(*f.labels)) {
+		args = append(args, "--label", name+"="+(*f.labels)[name])
+	}
+	if *f.lock != fslock.DefaultBackend {
+		args = append(args, "--lock-backend", *f.lock)
+	}
+	if *f.lockDir != "" {
+		args = append(args, "--lock-dir", *f.lockDir)
+	}
+	if *f.lockMode != "" {
+		args = append(args, "--lock-mode", *f.lockMode)
+	}
+	if *f.shards > 1 {
+		args = append(args, "--textfile-shards", strconv.Itoa(*f.shards))
+	}
+	return args
+}
+
+// logFileOptions builds the log file options from the --log-chmod, --log-chown and --log-chunk-size flags
+func logFileOptions(chmod, chown, chunkSize string) ([]logwriter.Option, error) {
+	var opts []logwriter.Option
+	if chmod != "" {
+		mode, err := fileperm.ParseMode(chmod)
+		if err != nil {
+			return nil, fmt.Errorf("--log-chmod: %w", err)
+		}
+		opts = append(opts, logwriter.WithFileMode(mode))
+	}
+	if chown != "" {
+		uid, gid, err := fileperm.ParseOwner(chown)
+		if err != nil {
+			return nil, fmt.Errorf("--log-chown: %w", err)
+		}
+		opts = append(opts, logwriter.WithOwner(uid, gid))
+	}
+	if chunkSize != "" {
+		size, err := precheck.ParseBytes(chunkSize)
+		if err != nil {
+			return nil, fmt.Errorf("--log-chunk-size: %w", err)
+		}
+		if size > 0 {
+			opts = append(opts, logwriter.WithChunkSize(int64(min(size, math.MaxInt64))))
+		}
+	}
+	return opts, nil
+}
+
+// subcommands maps subcommand names to their entry point, which returns the exit code
+var subcommands = map[string]func(args []string) int{
+	"decrypt":         runDecrypt,
+	"diff":            runDiff,
+	"drop-privileges": runDropPrivileges,
+	"history":         runHistory,
+	"list":            runList,
+	"logs":            runLogs,
+	"migrate-metrics": runMigrateMetrics,
+	"notify":          runNotify,
+	"reconcile":       runReconcile,
+	"replay":          runReplay,
+	"status":          runStatus,
+	"top":             runTop,
+	"watchdog":        runWatchdog,
+}
+
 func main() {
+	// Dispatch subcommands, anything else runs a job
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(subcommand(os.Args[2:]))
+		}
+	}
+
 	// Define flags with both short and long options
 	jobnamePtr := pflag.StringP("name", "n", "", "Job name (required, will appear in alerts)")
-	logfilePtr := pflag.StringP("log", "l", "", "Log file path to store the cron job output")
+	logfilePtr := pflag.StringP("log", "l", "", "Log file path to store the cron job output, {run_id} is replaced with the run ID to keep one file per run")
+	errorLogPtr := pflag.String("error-log", "", "File storing only the stderr of the command, in addition to --log, e.g. to keep the diagnostics of a job with huge stdout")
+	logChmodPtr := pflag.String("log-chmod", "", "Permission of the log file, e.g. 0640 (default: 0666 before umask)")
+	logChownPtr := pflag.String("log-chown", "", "Owner of the log file as user[:group], e.g. root:adm")
+	logChunkSizePtr := pflag.String("log-chunk-size", "", "Split the log file in chunks of this size, e.g. 100M, with an index to read it from a given minute with cronmgr logs --since")
 	idleSeconds := pflag.IntP("idle", "i", 0, "Idle wait duration in seconds (0 = disabled). Ensures job runs for at least this duration for Prometheus detection")
-	exporterDirPtr := pflag.StringP("dir", "d", "", "Directory for Prometheus exporter file (default: /var/lib/prometheus/node-exporter or COLLECTOR_TEXTFILE_PATH env var)")
-	textfilePtr := pflag.String("textfile", "crons.prom", "Filename for Prometheus exporter file")
-	metricNamePtr := pflag.String("metric", "crontab", "Metric name for Prometheus metrics")
-	noMetricPtr := pflag.Bool("no-metric", false, "Disable metric writing to Prometheus exporter file")
+	exporterFlags := addExporterFlags(pflag.CommandLine)
+	provenancePtr := pflag.StringToString("provenance", nil, "Origin of the job definition as key=value pairs, e.g. repo=infra,commit=abc123, exported as provenance_info and added to the summary")
+	keyFlags := addKeyFlags(pflag.CommandLine)
+	loginShellPtr := pflag.String("login-shell", "", "Run the command through a login shell (bash -lc) so profile-managed PATH and environment are loaded; optionally set the shell, e.g. --login-shell=/bin/zsh")
+	pflag.Lookup("login-shell").NoOptDefVal = job.DefaultLoginShell
+	resolvePathPtr := pflag.Bool("resolve-path", false, "Resolve the command from common locations (/usr/local/bin, ~/bin, version manager shims) if it is not found in PATH")
+	pushgatewayPtr := pflag.String("pushgateway", "", "Push the final job state to this Prometheus Pushgateway URL, so short-lived jobs are seen without --idle")
+	cloudWatchNamespacePtr := pflag.String("cloudwatch-namespace", "", "Put the final job state to AWS CloudWatch in this namespace, e.g. Cron, with the credentials of the environment or the EC2 instance role")
+	cloudWatchRegionPtr := pflag.String("cloudwatch-region", "", "AWS region of CloudWatch (default: $AWS_REGION or the region of the EC2 instance)")
+	cloudWatchDimensionsPtr := pflag.StringToString("cloudwatch-dimension", nil, "Rename a label to a CloudWatch dimension as label=Dimension, e.g. name=JobName (repeatable)")
+	cloudWatchEndpointPtr := pflag.String("cloudwatch-endpoint", "", "CloudWatch endpoint URL, e.g. of a VPC endpoint (default: the endpoint of the region)")
+	cloudMonitoringPtr := pflag.Bool("cloud-monitoring", false, "Write the final job state to Google Cloud Monitoring as custom.googleapis.com/<metric>/<name>, with the instance service account or $GOOGLE_APPLICATION_CREDENTIALS")
+	cloudMonitoringProjectPtr := pflag.String("cloud-monitoring-project", "", "Project of the Cloud Monitoring time series (default: the project of the instance or the service account key)")
+	influxURLPtr := pflag.String("influx-url", "", "Write the final job state to this InfluxDB v2 URL, e.g. http://influxdb:8086")
+	influxOrgPtr := pflag.String("influx-org", "", "InfluxDB organization")
+	influxBucketPtr := pflag.String("influx-bucket", "", "InfluxDB bucket")
+	influxTokenFilePtr := pflag.String("influx-token-file", "", "File containing the InfluxDB API token, read again for each write (default: $INFLUX_TOKEN_FILE or $INFLUX_TOKEN)")
+	influxFilePtr := pflag.String("influx-file", "", "Append the final job state to this file in the InfluxDB line protocol, e.g. for Telegraf's tail input")
+	spoolDirPtr := pflag.String("spool-dir", "", "Keep the submissions to the Pushgateway, CloudWatch and InfluxDB that failed, e.g. during a network outage, in this directory and replay them with the next runs")
+	spoolMaxAgePtr := pflag.Duration("spool-max-age", 24*time.Hour, "Drop the spooled submissions older than this duration (0 = keep them until they are replayed)")
+	signingKeyPtr := pflag.String("signing-key-file", "", "File holding an ed25519 key (PKCS #8 PEM or 32 byte seed) signing the webhook notifications and spooled submissions")
+	httpFlags := addHTTPFlags(pflag.CommandLine)
+	mqttFlags := addMQTTFlags(pflag.CommandLine)
+	notifyFlags := addNotifyFlags(pflag.CommandLine)
+	notifyLimitPtr := pflag.String("notify-limit", "", "Notify at most this many failures of the job per window, e.g. 3/1h; the others are batched into its next notification (requires --state-dir)")
+	notifyGlobalLimitPtr := pflag.String("notify-global-limit", "", "Notify at most this many failures of all jobs sharing --state-dir per window, e.g. 20/1h; the others are dropped")
+	severityMapPtr := pflag.String("severity-map", "", "File mapping exit codes to severities, e.g. 'exit 1 => warning', labeling runs_total and routing notifications, e.g. 'notify warning => file'")
+	metricTimestampsPtr := pflag.Bool("metric-timestamps", false, "Write final metrics with the job completion time as sample timestamp (not supported by node_exporter's textfile collector)")
+	maxLoadPtr := pflag.Float64("max-load", 0, "Do not start the job while the 1-minute load average is above this value (0 = disabled, Linux only)")
+	minFreeMemoryPtr := pflag.String("min-free-memory", "", "Do not start the job while less memory is available, e.g. 2G (Linux only)")
+	onlyOnACPtr := pflag.Bool("only-on-ac", false, "Do not start the job while the host runs on battery (Linux only)")
+	minBatteryPtr := pflag.Int("min-battery", 0, "Do not start the job while the battery is below this percentage (0 = disabled, Linux only)")
+	featureFlagURLPtr := pflag.String("feature-flag-url", "", "Do not start the job while the feature flag returned as JSON by this endpoint is off, e.g. to disable jobs during an incident")
+	featureFlagPtr := pflag.String("feature-flag", "", "Key of the flag in the JSON object returned by --feature-flag-url (default: the whole document)")
+	featureFlagTokenFilePtr := pflag.String("feature-flag-token-file", "", "File containing the bearer token of --feature-flag-url (default: $"+precheck.FlagTokenEnv+"_FILE or $"+precheck.FlagTokenEnv+")")
+	scheduleICSPtr := pflag.StringArray("schedule-ics", nil, "Only execute the job on the days of the events of this .ics file, expanding their RRULE, e.g. the last business day of the month; run cronmgr daily from cron (repeatable)")
+	intervalSinceFinishPtr := pflag.Duration("interval-since-finish", 0, "Only start the job this long after its previous run finished, e.g. 15m, skipping the earlier runs and those overlapping it; run cronmgr often from cron (requires --state-dir)")
+	excludeDatesPtr := pflag.StringArray("exclude-dates", nil, "Skip the runs on the dates of this calendar, an .ics file or a list of YYYY-MM-DD dates, e.g. public holidays (repeatable)")
+	canaryPtr := pflag.Int("canary", 0, "Only execute the job on this percentage of hosts, chosen by a hash of the hostname; the others skip the run (0 = all hosts)")
+	pgAdvisoryLockPtr := pflag.String("pg-advisory-lock", "", "Hold a PostgreSQL advisory lock or MySQL named lock during the run, given as \"DSN KEY\", skipping the run if it is held, e.g. \"postgres://cron@db/app nightly_report\" or \"mysql://cron@db/app nightly_report\"")
+	pgAdvisoryLockWaitPtr := pflag.Duration("pg-advisory-lock-wait", 0, "Wait up to this duration for the --pg-advisory-lock held by another session, e.g. 5m (0 = skip the run immediately)")
+	leasePtr := pflag.String("lease", "", "Hold a lease in this file on storage shared by the hosts running the job, e.g. NFS, so only one of them runs it; the command gets its fencing token in $"+lease.TokenEnv)
+	leaseTTLPtr := pflag.Duration("lease-ttl", 30*time.Second, "Time after which the --lease of a host that stopped renewing it is taken over; the command is stopped if it cannot be renewed within two thirds of it")
+	waitForURLPtr := pflag.StringArray("wait-for-url", nil, "Do not start the job until this URL answers with a 2xx status, e.g. the health check of a dependency in maintenance (repeatable)")
+	waitForTCPPtr := pflag.StringArray("wait-for-tcp", nil, "Do not start the job until this host:port accepts connections, e.g. of a database restarting nightly (repeatable)")
+	cpuRequestPtr := pflag.Float64("cpu-request", 0, "Approximate CPU cores the job needs; its start is deferred while the jobs running on the host reserved the others (0 = none)")
+	memoryRequestPtr := pflag.String("memory-request", "", "Approximate memory the job needs, e.g. 4G; its start is deferred while the jobs running on the host reserved the rest (Linux only)")
+	reservationsPtr := pflag.String("reservations", capacity.DefaultPath, "Host-wide file of the resources reserved by the running jobs with --cpu-request or --memory-request")
+	capacityWaitPtr := pflag.Duration("capacity-wait", time.Hour, "Defer the start up to this duration while the host has no room for --cpu-request and --memory-request, then skip the run")
+	requireFilePtr := pflag.StringArray("require-file", nil, "Do not start the job unless this input file exists and is fresher than --require-file-max-age (repeatable)")
+	requireFileMaxAgePtr := pflag.Duration("require-file-max-age", 0, "Maximum age of the modification time of the --require-file inputs, e.g. 2h (0 = only require them to exist)")
+	requireFileActionPtr := pflag.String("require-file-action", "skip", "What to do when a --require-file input is missing or stale: skip or fail the run")
+	waitTimeoutPtr := pflag.Duration("wait-timeout", 0, "Poll the --wait-for-url and --wait-for-tcp dependencies up to this duration before skipping the run, e.g. 2m (0 = check once)")
+	precheckWaitPtr := pflag.Duration("precheck-wait", 0, "Delay the start up to this duration while the host is busy, e.g. 10m (0 = skip the run immediately)")
+	retriesPtr := pflag.Int("retries", 0, "Retry a failed attempt up to this many times")
+	retryDelayPtr := pflag.Duration("retry-delay", 10*time.Second, "Delay before the first retry, doubled after each attempt")
+	retryOnExitCodesPtr := pflag.String("retry-on-exit-codes", "", "Only retry attempts exiting with one of these comma separated codes, e.g. \"75,111\" (default: any failure)")
+	retryJitterPtr := pflag.Float64("retry-jitter", 0, "Randomly shorten each retry delay by up to this fraction (0-1), so a fleet does not retry in lockstep")
+	retryMaxElapsedPtr := pflag.Duration("retry-max-elapsed", 0, "Do not start a retry this long after the run started, running attempts are not killed (0 = no limit)")
+	snapshotPtr := pflag.StringArray("snapshot", nil, "Snapshot a file system before the command starts, dropped after success and kept after failure: lvm:VG/LV[:SIZE], zfs:DATASET or btrfs:PATH[:DIR] (repeatable)")
+	assertReadOnlyPtr := pflag.StringArray("assert-readonly", nil, "Fail the run if the command changes this file or directory tree, e.g. for side-effect free verification jobs (repeatable, Linux)")
+	artifactDirPtr := pflag.String("artifact-dir", "", "Keep the artifacts of each run in <dir>/<run_id>: the core dump and backtrace of a crashed command (Linux), and the goroutines of cronmgr dumped on SIGQUIT in <dir>/<name>.goroutines.txt")
+	auditPtr := pflag.String("audit", "", "Write a JSON summary of the programs executed, files opened and addresses connected to by the job to this file, {run_id} being replaced by the run ID (Linux with eBPF, needs root)")
+	checkpointDirPtr := pflag.String("checkpoint-dir", "", "Directory of per-job checkpoint directories passed to the command as CRONMGR_CHECKPOINT_DIR, kept across retries and removed after success")
+	touchFilePtr := pflag.String("touch-file", "", "File whose modification time is set after each successful run, for monitors alerting on its age, e.g. /var/run/job.ok")
+	customMetricsPtr := pflag.Bool("custom-metrics", false, "Export lines 'cronmgr-metric <name> <value>' the command writes to $CRONMGR_METRICS_FILE as custom{metric=\"<name>\"} gauges")
+	attemptTimeoutPtr := pflag.Duration("attempt-timeout", 0, "Kill an attempt running longer than this duration, e.g. 30m (0 = no limit)")
+	overallDeadlinePtr := pflag.Duration("overall-deadline", 0, "Kill the run once all attempts and retry delays take longer than this duration, no retry starts after it (0 = no limit)")
+	stopSignalPtr := pflag.String("stop-signal", "", "Signal asking an attempt to stop when it reaches --attempt-timeout or --overall-deadline, or cronmgr receives SIGTERM or SIGINT, e.g. SIGINT; it is killed after --stop-grace (default: kill right away)")
+	stopGracePtr := pflag.Duration("stop-grace", 30*time.Second, "Time an attempt sent --stop-signal has to exit before it is killed")
+	timeoutWarningPtr := pflag.Int("timeout-warning", 80, "Warn the notifiers and set timeout_approaching once an attempt reaches this percentage of --attempt-timeout or --overall-deadline (0 = no warning)")
+	queueDirPtr := pflag.String("queue", "", "Work queue directory: claim one item from <dir>/pending per run, pass its path as the last argument, then move it to done/ or failed/")
+	forEachLinePtr := pflag.String("for-each-line", "", "Run the command once per non-empty line of the file (\"-\" for stdin), passing the line as the last argument")
+	forEachGlobPtr := pflag.String("for-each-glob", "", "Run the command once per path matching the glob pattern, passing the path as the last argument")
+	parallelPtr := pflag.Int("parallel", 1, "Maximum number of for-each items processed at the same time")
+	textfileMaxSizePtr := pflag.String("textfile-max-size", "", "Warn and set textfile_over_limit when the exporter file grows over this size, e.g. 4M (default: no limit)")
+	textfileMaxSeriesPtr := pflag.Int("textfile-max-series", 0, "Warn and set textfile_over_limit when the exporter file holds more series than this (0 = no limit)")
+	fallbackDirPtr := pflag.String("fallback-dir", "", "Alternate writable directory for metrics and the log file when writing them is denied, e.g. by SELinux or AppArmor")
+	registryPtr := pflag.String("registry", "", "Record the job, its command, schedule and owner in this host-wide registry file on each run, listed by cronmgr list, e.g. "+registry.DefaultPath)
+	inventoryURLPtr := pflag.String("inventory-url", "", "Push the --registry file with the host metadata to this central HTTP endpoint, at most once per --inventory-interval for all jobs of the host")
+	inventoryIntervalPtr := pflag.Duration("inventory-interval", inventory.DefaultInterval, "Minimum time between two pushes of the inventory of the host")
+	inventoryKeyFilePtr := pflag.String("inventory-key-file", "", "File containing the key signing the inventory pushes with HMAC-SHA256 (default: $CRONMGR_INVENTORY_KEY_FILE or $CRONMGR_INVENTORY_KEY)")
+	schedulePtr := pflag.String("schedule", "", "When the job runs, e.g. its cron expression \"0 2 * * *\", recorded in the --registry file")
+	stateDirPtr := pflag.String("state-dir", "", "Directory recording the state and run history of each job, used to detect runs that never finished (default: disabled)")
+	historyRetentionPtr := pflag.String("history-retention", "", "Compact runs older than this age into daily aggregates in the run history, e.g. 7d (default: keep all runs)")
+	historyDailyRetentionPtr := pflag.String("history-daily-retention", "", "Remove daily aggregates of the run history older than this age, e.g. 365d (default: keep forever)")
+	eventsFilePtr := pflag.String("events-file", "", "Append the lifecycle events of the run (started, retrying, timeout, skipped, finished) as JSON lines to this host-wide file, or send them to a unix socket given as unix:/path")
+	cmdFilePtr := pflag.String("cmd-file", "", "File holding the command and its arguments, one per line, instead of a command after --")
+	commandPtr := pflag.StringP("command", "c", "", "Command line run through sh -c instead of a command after --, as accepted by cronmanager")
+	sshForceCommandPtr := pflag.Bool("ssh-force-command", false, "Run the command requested by the SSH client in SSH_ORIGINAL_COMMAND if the ssh_commands of --config allow it, as the ForceCommand of sshd")
+	legacyMetricsPtr := pflag.Bool("legacy-metrics", invokedAs(os.Args[0], legacyName), "Also write the {prefix}{name,dimension} series of cronmanager while dashboards migrate (default when invoked as cronmanager)")
+	timePrecisionPtr := pflag.Int("time-precision", 3, "Decimals of the duration and timestamp metrics, all written as float seconds, e.g. 6 for microseconds")
+	legacyTimeFormatPtr := pflag.Bool("legacy-time-format", invokedAs(os.Args[0], legacyName), "Write durations with 2 decimals and timestamps in whole seconds, as before --time-precision, for dashboards matching them (default when invoked as cronmanager)")
+	watchdogPtr := pflag.Bool("watchdog", false, "Start a watchdog process reporting wrapper_crashed if cronmgr itself dies, e.g. panic or OOM kill")
+	watchdogNotifyPtr := pflag.String("watchdog-notify", "", "Shell command the watchdog runs if cronmgr crashed, with the job name in CRONMGR_JOB_NAME")
+	healthListenPtr := pflag.String("health-listen", "", "Serve the liveness and elapsed time of the command on http://ADDR/healthz while it runs, e.g. :8081, for Kubernetes or monit health checks of long-running commands")
+	systemdScopePtr := pflag.Bool("systemd-scope", false, "Run the command in a transient scope with systemd-run --scope, for systemd resource accounting and limits")
+	systemdSlicePtr := pflag.String("systemd-slice", "", "Slice of the systemd scope, e.g. batch.slice")
+	systemdMemoryMaxPtr := pflag.String("systemd-memory-max", "", "Memory limit of the systemd scope (MemoryMax), e.g. 2G")
+	systemdCPUQuotaPtr := pflag.String("systemd-cpu-quota", "", "CPU time limit of the systemd scope (CPUQuota), e.g. 50%")
+	systemdPropertiesPtr := pflag.StringArray("systemd-property", nil, "Other property of the systemd scope, e.g. IOWeight=50 (repeatable)")
+	dropCapsPtr := pflag.Bool("drop-caps", false, "Drop all Linux capabilities of the command, including from its bounding set, when cronmgr runs as root")
+	noNewPrivsPtr := pflag.Bool("no-new-privs", false, "Set no_new_privs on the command, so setuid executables and file capabilities grant it nothing (Linux)")
+	seccompProfilePtr := pflag.String("seccomp-profile", "", "Filter the syscalls of the command with this seccomp profile in the JSON format of Docker, implies --no-new-privs (Linux)")
+	maxCapturedOutputPtr := pflag.String("max-captured-output", "64K", "Memory kept for the end of the command output when no log file is written, e.g. 1M (0 discards the output)")
+	gomemlimitPtr := pflag.String("gomemlimit", "", "Soft memory limit of cronmgr itself like GOMEMLIMIT, without passing it to the job, e.g. 32M (default: no limit)")
+	gogcPtr := pflag.String("gogc", "", "Garbage collection target percentage of cronmgr itself like GOGC, or off (default: 100)")
+	printArgvPtr := pflag.Bool("print-argv", false, "Print the command and arguments exactly as they would be executed, one per line, and exit without running it")
+	configPtr := pflag.String("config", config.DefaultPath, "Config file holding the profiles and the ssh_commands allowed by --ssh-force-command")
+	profilePtr := pflag.String("profile", "", "Profile of the config file setting flags not given on the command line, e.g. prod (default: CRONMGR_PROFILE env var)")
+	noSummaryPtr := pflag.Bool("no-summary", false, "Do not print a one-line summary of failed runs (job, exit code, duration, log path) to stderr for cron's mail")
+	quietPtr := pflag.BoolP("quiet", "q", false, "Only log problems, not progress like retries or skips, so cron mails only report real problems")
 	pflag.BoolVarP(&flgVersion, "version", "v", false, "Display version information and exit")
 
 	// Set usage function
 	pflag.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Usage: cronmgr --name <jobname> [options] -- <command> [args...]
+       cronmgr --name <jobname> [options] --command "<command line>"
+       cronmgr --name <jobname> [options] --cmd-file <file>
+       cronmgr reconcile --state-dir <dir> [options]
+       cronmgr status --state-dir <dir> [--output table|json]
+       cronmgr list [--registry <file>] [--output table|json]
+       cronmgr history export --state-dir <dir> [options]
+       cronmgr logs <job> --state-dir <dir> [--run <id>] [--grep <pattern>] [--tail <n>]
+       cronmgr replay <run-id> --state-dir <dir> [--interactive]
+       cronmgr diff <run-id-a> <run-id-b> --state-dir <dir> [options]
+       cronmgr top --state-dir <dir> [options]
+       cronmgr decrypt --encryption-key-file <file> [file...]
+       cronmgr notify test [--channel <channel>] [options]
+       cronmgr migrate-metrics --from legacy|per-metric --to per-metric|legacy [options]
 
 Execute and monitor a cron job, publishing metrics to Prometheus.
 
@@ -76,8 +405,51 @@ Options:
 Examples:
   cronmgr --name update_entities_cron -- /usr/bin/php /var/www/app/console task:run
   cronmgr -n job_cron --log /var/log/cron.log -- /usr/bin/python3 script.py
+  cronmgr -n job_cron --log /var/log/cron.log --log-chmod 0640 --log-chown root:adm --metric-chmod 0640 -- /usr/bin/command
   cronmgr -n job_cron --idle 60 --metric my_metric -- /usr/bin/command arg1 arg2
   cronmgr -n job_cron --no-metric -- /usr/bin/command
+  cronmgr -n job_cron --login-shell -- bundle exec rake task
+  cronmgr -n job_cron --resolve-path -- node script.js
+  cronmgr -n job_cron --pushgateway http://pushgateway:9091 -- /usr/bin/command
+  cronmgr -n job_cron --cloudwatch-namespace Cron --cloudwatch-dimension name=JobName -- /usr/bin/command
+  cronmgr -n job_cron --cloud-monitoring -- /usr/bin/command
+  cronmgr -n job_cron --influx-url http://influxdb:8086 --influx-org ops --influx-bucket cron -- /usr/bin/command
+  cronmgr -n job_cron --mqtt-url ssl://broker:8883 --mqtt-username edge -- /usr/bin/command
+  cronmgr -n job_cron --notify-slack-webhook https://hooks.slack.com/services/T0/B0/X -- /usr/bin/command
+  cronmgr -n job_cron --owner team-a -- /usr/bin/command
+  cronmgr -n job_cron --provenance repo=infra,commit=abc123 -- /usr/bin/command
+  cronmgr -n backup --registry /var/lib/cronmgr/registry.json --schedule "0 2 * * *" -- /usr/bin/backup
+  cronmgr -n import_cron --queue /var/spool/imports -- /usr/bin/import --file
+  cronmgr -n sync_cron --retries 3 --attempt-timeout 10m --overall-deadline 45m -- /usr/bin/sync
+  cronmgr -n db_dump --attempt-timeout 2h --stop-signal SIGINT --stop-grace 120s -- /usr/bin/dump
+  cronmgr -n compress_logs --for-each-glob '/var/log/app/*.log' --parallel 4 -- gzip -9
+  cronmgr -n job_cron --max-load 8 --min-free-memory 2G --precheck-wait 10m -- /usr/bin/command
+  cronmgr -n sync_cron --wait-for-url https://api.example.com/health --wait-timeout 2m -- /usr/bin/sync
+  cronmgr -n etl_cron --wait-for-tcp db.example.com:5432 --wait-for-tcp mq.example.com:5672 --wait-timeout 5m -- /usr/bin/etl
+  cronmgr -n import_cron --require-file /data/incoming/export.csv --require-file-max-age 2h -- /usr/bin/import
+  cronmgr -n report --lease /mnt/shared/locks/report.lease --lease-ttl 1m -- /usr/bin/report
+  cronmgr -n rebuild_index --cpu-request 4 --memory-request 8G -- /usr/bin/rebuild-index
+  cronmgr -n report --pg-advisory-lock "postgres://cron@db.example.com/app nightly_report" -- /usr/bin/report
+  cronmgr -n job_cron --only-on-ac --min-battery 30 -- /usr/bin/command
+  cronmgr -n job_cron --canary 10 -- /usr/bin/command
+  cronmgr -n month_end_close --schedule-ics /etc/cronmgr/month-end.ics -- /usr/bin/close-books
+  cronmgr -n poll_orders --state-dir /var/lib/cronmgr/state --interval-since-finish 15m -- /usr/bin/poll-orders
+  cronmgr -n invoice_cron --exclude-dates /etc/cronmgr/holidays.ics -- /usr/bin/invoice
+  cronmgr -n job_cron --feature-flag-url https://flags.example.com/cron.json --feature-flag job_cron -- /usr/bin/command
+  cronmgr -n job_cron --quiet --retries 3 -- /usr/bin/command
+  cronmgr -n report --cmd-file /etc/cronmgr/jobs.d/report.cmd
+  cronmgr -n job_cron --legacy-metrics -c "/usr/bin/command arg1 > /tmp/out"
+  cronmgr -n job_cron --gomemlimit 32M --max-captured-output 16K -- /usr/bin/command
+  CRONMGR_PROFILE=prod cronmgr -n job_cron -- /usr/bin/command
+  cronmgr -n job_cron --systemd-scope --systemd-slice batch.slice --systemd-memory-max 2G -- /usr/bin/command
+  cronmgr -n job_cron --drop-caps --no-new-privs -- /usr/bin/command
+  cronmgr -n parse_upload --seccomp-profile /etc/cronmgr/parser-seccomp.json -- /usr/bin/parse
+  cronmgr -n migrate_db --snapshot zfs:tank/pgdata -- /usr/local/bin/migrate
+  cronmgr -n verify_backup --assert-readonly /srv/backups -- /usr/bin/verify-backup
+  cronmgr -n report --artifact-dir /var/lib/cronmgr/artifacts -- /usr/bin/report
+  cronmgr -n backup --audit '/var/log/cronmgr/audit/{run_id}.json' -- /usr/bin/backup.sh
+  cronmgr --ssh-force-command --dir /var/lib/node_exporter
+  cronmgr -n job_cron --watchdog --watchdog-notify "mail -s crashed ops@example.com < /dev/null" -- /usr/bin/command
 
 For more information, visit: https://github.com/alswl/cron-manager
 `)
@@ -93,153 +465,788 @@ For more information, visit: https://github.com/alswl/cron-manager
 		os.Exit(0)
 	}
 
+	if err := loadProfile(afero.NewOsFs(), pflag.CommandLine, *configPtr, *profilePtr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	// Parse command and arguments from -- separator
+	commandLine, hasSeparator, err := argsAfterSeparator(pflag.CommandLine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	// As a ForceCommand, the command and job name come from the ssh_commands entry allowing the requested command
+	var sshArgv []string
+	if *sshForceCommandPtr {
+		var sshName string
+		sshName, sshArgv, err = sshForceCommand(afero.NewOsFs(), *configPtr, os.Getenv(sshOriginalCommandEnv), hasSeparator || *cmdFilePtr != "" || *commandPtr != "")
+		if err != nil {
+			// The error goes back to the SSH client, which has no use for the usage
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *jobnamePtr == "" {
+			*jobnamePtr = sshName
+		}
+		if client := sshClient(os.Getenv(sshConnectionEnv)); client != "" {
+			if *provenancePtr == nil {
+				*provenancePtr = make(map[string]string)
+			}
+			(*provenancePtr)["ssh_client"] = client
+		}
+	}
+
 	if *jobnamePtr == "" {
 		fmt.Fprintf(os.Stderr, "Error: --name is required\n\n")
 		pflag.Usage()
 		os.Exit(1)
 	}
 
-	// Build exporter options
-	var opts []exporter.Option
-	if *exporterDirPtr != "" {
-		opts = append(opts, exporter.WithExporterDir(*exporterDirPtr))
+	var cmdBin string
+	var cmdArgsOnly []string
+	if *sshForceCommandPtr {
+		cmdBin, cmdArgsOnly = sshArgv[0], sshArgv[1:]
+	} else if *cmdFilePtr != "" && *commandPtr != "" {
+		err = errors.New("--cmd-file and --command cannot be combined")
+	} else if *cmdFilePtr != "" {
+		cmdBin, cmdArgsOnly, err = commandFromFile(*cmdFilePtr, hasSeparator)
+	} else if *commandPtr != "" {
+		cmdBin, cmdArgsOnly, err = legacyCommand(*commandPtr, hasSeparator)
+	} else if !hasSeparator {
+		err = fmt.Errorf("command separator '--' not found")
+	} else {
+		cmdBin, cmdArgsOnly, err = extractCommandAfterSeparator(append([]string{"--"}, commandLine...))
 	}
-	if *textfilePtr != "" {
-		opts = append(opts, exporter.WithExporterFilename(*textfilePtr))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
 	}
-	if *metricNamePtr != "" {
-		opts = append(opts, exporter.WithMetricName(*metricNamePtr))
+
+	// Build prechecks evaluated before the command is started
+	var prechecks []precheck.Check
+	if *maxLoadPtr > 0 || *minFreeMemoryPtr != "" {
+		loadCheck := precheck.LoadCheck{MaxLoad: *maxLoadPtr}
+		if *minFreeMemoryPtr != "" {
+			minFree, err := precheck.ParseBytes(*minFreeMemoryPtr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --min-free-memory: %v\n\n", err)
+				pflag.Usage()
+				os.Exit(1)
+			}
+			loadCheck.MinFreeMemory = minFree
+		}
+		prechecks = append(prechecks, loadCheck)
 	}
-	if *noMetricPtr {
-		opts = append(opts, exporter.WithMetricDisabled(true))
+	if *onlyOnACPtr {
+		prechecks = append(prechecks, precheck.ACCheck{})
+	}
+	if *minBatteryPtr > 0 {
+		prechecks = append(prechecks, precheck.BatteryCheck{MinPercent: *minBatteryPtr})
 	}
 
-	// Create exporter instance with options
-	exp := exporter.NewExporter(opts...)
+	forEach, items, err := forEachItems(*forEachLinePtr, *forEachGlobPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
 
-	// Parse command and arguments from -- separator
-	// Note: pflag.Parse() stops parsing flags when it encounters "--",
-	// so pflag.Args() returns all arguments after "--" (without "--" itself)
-	// We need to check os.Args to verify "--" was provided, then use pflag.Args()
-	// which contains everything after "--"
-	hasSeparator := false
-	for _, arg := range os.Args {
-		if arg == "--" {
-			hasSeparator = true
-			break
+	retryOnExitCodes, err := parseExitCodes(*retryOnExitCodesPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --retry-on-exit-codes: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	var stopSignal os.Signal
+	if *stopSignalPtr != "" {
+		if stopSignal, err = job.ParseSignal(*stopSignalPtr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --stop-signal: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
 		}
 	}
 
-	if !hasSeparator {
-		fmt.Fprintf(os.Stderr, "Error: command separator '--' not found\n\n")
+	historyRetention, err := parseRetention(*historyRetentionPtr, *historyDailyRetentionPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
 		pflag.Usage()
 		os.Exit(1)
 	}
 
-	// pflag.Args() contains all arguments after "--", so we can treat them as command args
-	// We need to reconstruct the full args list with "--" to use extractCommandAfterSeparator
-	args := append([]string{"--"}, pflag.Args()...)
-	cmdBin, cmdArgsOnly, err := extractCommandAfterSeparator(args)
+	cipher, err := keyFlags.cipher()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
 		pflag.Usage()
 		os.Exit(1)
 	}
+	var signer *crypt.Signer
+	if *signingKeyPtr != "" {
+		if signer, err = crypt.SignerFromFile(*signingKeyPtr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --signing-key-file: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
+		}
+	}
 
-	//Record the start time of the job
-	jobStartTime := time.Now()
-	//Start a ticker in a goroutine that will write an alarm metric if the job exceeds the time
-	go func() {
-		for range time.Tick(time.Second) {
-			jobDuration := time.Since(jobStartTime).Seconds()
-			// Log current duration with 2 decimal precision
-			exp.WriteGauge("duration_seconds", *jobnamePtr, strconv.FormatFloat(jobDuration, 'f', 2, 64), "Duration of the last job execution in seconds")
-			// Store last timestamp
-			exp.WriteGauge("last_run_timestamp_seconds", *jobnamePtr, fmt.Sprintf("%d", time.Now().Unix()), "Timestamp of the last job execution")
+	exporterOpts, err := exporterFlags.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	var textfileMaxSize uint64
+	if *textfileMaxSizePtr != "" {
+		if textfileMaxSize, err = precheck.ParseBytes(*textfileMaxSizePtr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --textfile-max-size: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
 		}
-	}()
+	}
+	if *textfileMaxSeriesPtr < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --textfile-max-series must not be negative\n\n")
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if textfileMaxSize > 0 || *textfileMaxSeriesPtr > 0 {
+		exporterOpts = append(exporterOpts, exporter.WithSizeLimit(int64(textfileMaxSize), *textfileMaxSeriesPtr))
+	}
+	logOpts, err := logFileOptions(*logChmodPtr, *logChownPtr, *logChunkSizePtr)
+	if err == nil && *logChunkSizePtr != "" && cipher != nil {
+		err = fmt.Errorf("--log-chunk-size cannot be combined with encryption")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
 
-	// Job started - increment run counter and set running status
-	exp.IncrementCounter("runs_total", *jobnamePtr, map[string]string{"status": "started"}, "Total number of job runs")
-	exp.WriteGauge("running", *jobnamePtr, "1", "Whether the job is currently running (1 = running, 0 = finished)")
+	maxCapturedOutput, err := precheck.ParseBytes(*maxCapturedOutputPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --max-captured-output: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if err := applyRuntimeLimits(*gomemlimitPtr, *gogcPtr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
 
-	// Execute the command with arguments
-	cmd := exec.Command(cmdBin, cmdArgsOnly...)
+	scope, err := systemdScope(*systemdScopePtr, *systemdSlicePtr, *systemdMemoryMaxPtr, *systemdCPUQuotaPtr, *systemdPropertiesPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if scope != nil {
+		scope.Description = "cronmgr job " + *jobnamePtr
+	}
+	var advisoryLock *pglock.Target
+	if *pgAdvisoryLockPtr != "" {
+		target, err := pglock.Parse(*pgAdvisoryLockPtr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --pg-advisory-lock: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
+		}
+		advisoryLock = &target
+	}
+	var jobLease *lease.Lease
+	if *leasePtr != "" {
+		if *leaseTTLPtr < 3*time.Second {
+			fmt.Fprintf(os.Stderr, "Error: --lease-ttl must be at least 3s, got %v\n\n", *leaseTTLPtr)
+			pflag.Usage()
+			os.Exit(1)
+		}
+		hostname, _ := os.Hostname()
+		jobLease = lease.New(afero.NewOsFs(), fslock.Canonical(*leasePtr), hostname+":"+strconv.Itoa(os.Getpid()), *leaseTTLPtr)
+	}
+	snapshots, err := snapshotSpecs(*snapshotPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	readOnly, err := readOnlyPaths(*assertReadOnlyPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	dropped, err := privileges(*dropCapsPtr, *noNewPrivsPtr, *seccompProfilePtr, os.Geteuid())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
 
-	var buf bytes.Buffer
-	var logWriter *logwriter.LogWriter
+	// Push backends fall back to the addresses they were last reached at while DNS is down
+	var dnsCache *netdial.Cache
+	if *stateDirPtr != "" {
+		dnsCache = netdial.NewCache(afero.NewOsFs(), filepath.Join(*stateDirPtr, netdial.CacheFile))
+	}
+	httpClient, err := httpFlags.client(dnsCache)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if *featureFlagPtr != "" && *featureFlagURLPtr == "" {
+		fmt.Fprintf(os.Stderr, "Error: --feature-flag requires --feature-flag-url\n\n")
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if *featureFlagURLPtr != "" {
+		prechecks = append(prechecks, precheck.FlagCheck{
+			URL:    *featureFlagURLPtr,
+			Flag:   *featureFlagPtr,
+			Token:  secret.Lookup(*featureFlagTokenFilePtr, precheck.FlagTokenEnv),
+			Client: httpClient,
+		})
+	}
+	if *waitTimeoutPtr != 0 && len(*waitForURLPtr) == 0 && len(*waitForTCPPtr) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: --wait-timeout requires --wait-for-url or --wait-for-tcp\n\n")
+		pflag.Usage()
+		os.Exit(1)
+	}
+	var readiness []precheck.Check
+	for _, value := range *waitForURLPtr {
+		check, err := precheck.ParseURL(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --wait-for-url: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
+		}
+		check.Client = httpClient
+		readiness = append(readiness, check)
+	}
+	for _, value := range *waitForTCPPtr {
+		check, err := precheck.ParseTCP(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --wait-for-tcp: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
+		}
+		readiness = append(readiness, check)
+	}
 
-	// Setup log writer if log file is specified
-	if *logfilePtr != "" {
-		logWriter, err = logwriter.NewLogWriter(*logfilePtr)
+	if len(*requireFilePtr) == 0 && (*requireFileMaxAgePtr != 0 || pflag.CommandLine.Changed("require-file-action")) {
+		fmt.Fprintf(os.Stderr, "Error: --require-file-max-age and --require-file-action require --require-file\n\n")
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if *requireFileMaxAgePtr < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --require-file-max-age must not be negative\n\n")
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if *requireFileActionPtr != "skip" && *requireFileActionPtr != "fail" {
+		fmt.Fprintf(os.Stderr, "Error: --require-file-action must be skip or fail, got %q\n\n", *requireFileActionPtr)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	var resources capacity.Resources
+	var capacityLedger *capacity.Ledger
+	if *cpuRequestPtr < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --cpu-request must not be negative\n\n")
+		pflag.Usage()
+		os.Exit(1)
+	}
+	resources.CPU = *cpuRequestPtr
+	if *memoryRequestPtr != "" {
+		memory, err := precheck.ParseBytes(*memoryRequestPtr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --memory-request: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
+		}
+		resources.Memory = memory
+	}
+	if resources != (capacity.Resources{}) {
+		// The capacity is unknown where the memory of the host cannot be read, memory is not accounted then
+		hostMemory, _ := precheck.TotalMemory()
+		capacityLedger = capacity.New(afero.NewOsFs(), *reservationsPtr, capacity.Resources{CPU: float64(runtime.NumCPU()), Memory: hostMemory})
+	}
+	if *timePrecisionPtr < 1 || *timePrecisionPtr > runner.MaxTimePrecision {
+		fmt.Fprintf(os.Stderr, "Error: --time-precision must be between 1 and %d\n\n", runner.MaxTimePrecision)
+		pflag.Usage()
+		os.Exit(1)
+	}
+	timePrecision := *timePrecisionPtr
+	if *legacyTimeFormatPtr {
+		if pflag.CommandLine.Changed("time-precision") {
+			fmt.Fprintf(os.Stderr, "Error: --time-precision cannot be used with --legacy-time-format\n\n")
+			pflag.Usage()
+			os.Exit(1)
+		}
+		timePrecision = 0
+	}
+	var healthServer *health.Server
+	if *healthListenPtr != "" {
+		if forEach {
+			fmt.Fprintf(os.Stderr, "Error: --health-listen cannot be used with --for-each-line or --for-each-glob\n\n")
+			pflag.Usage()
+			os.Exit(1)
+		}
+		healthServer = health.New(*jobnamePtr)
+	}
+	if *intervalSinceFinishPtr < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --interval-since-finish must not be negative\n\n")
+		pflag.Usage()
+		os.Exit(1)
+	}
+	if *intervalSinceFinishPtr > 0 && *stateDirPtr == "" {
+		fmt.Fprintf(os.Stderr, "Error: --interval-since-finish requires --state-dir\n\n")
+		pflag.Usage()
+		os.Exit(1)
+	}
+	var scheduleDates *calendar.Calendar
+	if len(*scheduleICSPtr) > 0 {
+		scheduleDates, err = calendar.Load(*scheduleICSPtr...)
 		if err != nil {
-			log.Fatalf("Failed to create log writer: %v", err)
+			fmt.Fprintf(os.Stderr, "Error: --schedule-ics: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
 		}
-		defer func() { _ = logWriter.Close() }()
+	}
+	var holidays *calendar.Calendar
+	if len(*excludeDatesPtr) > 0 {
+		holidays, err = calendar.Load(*excludeDatesPtr...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --exclude-dates: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
+		}
+	}
+	var requiredFiles []precheck.FileCheck
+	for _, path := range *requireFilePtr {
+		requiredFiles = append(requiredFiles, precheck.FileCheck{Path: path, MaxAge: *requireFileMaxAgePtr})
+	}
+
+	var cloudWatch *cloudwatch.Client
+	if *cloudWatchNamespacePtr != "" {
+		cloudWatch = cloudwatch.NewClient(cloudwatch.Config{
+			Namespace:  *cloudWatchNamespacePtr,
+			Region:     *cloudWatchRegionPtr,
+			Dimensions: *cloudWatchDimensionsPtr,
+			Endpoint:   *cloudWatchEndpointPtr,
+			HTTPClient: httpClient,
+		})
+	}
+
+	influxDB, err := influxWriter(*influxURLPtr, *influxOrgPtr, *influxBucketPtr, *influxTokenFilePtr, httpClient)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	inventoryPush, err := inventoryPusher(*inventoryURLPtr, *inventoryKeyFilePtr, *inventoryIntervalPtr, *registryPtr, httpClient)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	// The log path is resolved once, so the history and the registry show where the output really is
+	logFile := *logfilePtr
+	if logFile != "" {
+		logFile = fslock.Canonical(logFile)
+	}
+
+	notifyLimit, notifyGlobalLimit, err := notifyLimits(*notifyLimitPtr, *notifyGlobalLimitPtr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	notifyTemplate, err := notifyFlags.template()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	notifiers, err := notifyFlags.notifiers(httpClient, signer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	severityMap, err := severities(*severityMapPtr, notifiers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	mqttPublisher, err := mqttFlags.publisher(*httpFlags.bindInterface, dnsCache)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
 
-		if err := logWriter.SetupPipes(cmd); err != nil {
-			log.Fatalf("Failed to setup pipes: %v", err)
+	var cloudMonitoring *cloudmonitoring.Client
+	if *cloudMonitoringPtr {
+		cloudMonitoring = cloudmonitoring.NewClient(cloudmonitoring.Config{
+			Project:      *cloudMonitoringProjectPtr,
+			MetricPrefix: "custom.googleapis.com/" + *exporterFlags.metric,
+			HTTPClient:   httpClient,
+		})
+	}
+
+	r, err := runner.NewRunner(runner.RunnerOptions{
+		Name:              *jobnamePtr,
+		Command:           cmdBin,
+		Args:              cmdArgsOnly,
+		LogFile:           logFile,
+		LogFileOptions:    logOpts,
+		ErrorLog:          *errorLogPtr,
+		MaxCapturedOutput: int(min(maxCapturedOutput, math.MaxInt)),
+		IdleSeconds:       *idleSeconds,
+		LoginShell:        *loginShellPtr,
+		ResolvePath:       *resolvePathPtr,
+		SystemdScope:      scope,
+		Privileges:        dropped,
+		PushgatewayURL:    *pushgatewayPtr,
+		HTTPClient:        httpClient,
+		CloudWatch:        cloudWatch,
+		CloudMonitoring:   cloudMonitoring,
+		Influx:            influxDB,
+		InfluxFile:        *influxFilePtr,
+		SpoolDir:          *spoolDirPtr,
+		SpoolMaxAge:       *spoolMaxAgePtr,
+		Signer:            signer,
+		MQTT:              mqttPublisher,
+		MQTTTopic:         *mqttFlags.topic,
+		Notifiers:         notifiers,
+		NotifyFallback:    notifyFlags.fallback(),
+		NotifyTemplate:    notifyTemplate,
+		NotifyRunURL:      *notifyFlags.runURL,
+		NotifyLimit:       notifyLimit,
+		NotifyGlobalLimit: notifyGlobalLimit,
+		Severities:        severityMap,
+		SampleTimestamps:  *metricTimestampsPtr,
+		Health:            healthServer,
+		Quiet:             *quietPtr,
+		LegacyMetrics:     *legacyMetricsPtr,
+		TimePrecision:     timePrecision,
+		Prechecks:         prechecks,
+		PrecheckWait:      *precheckWaitPtr,
+		Readiness:         readiness,
+		ReadinessTimeout:  *waitTimeoutPtr,
+		RequiredFiles:     requiredFiles,
+		Capacity:          capacityLedger,
+		Resources:         resources,
+		CapacityWait:      *capacityWaitPtr,
+		FailOnStaleInput:  *requireFileActionPtr == "fail",
+		AdvisoryLock:      advisoryLock,
+		Lease:             jobLease,
+		AdvisoryLockWait:  *pgAdvisoryLockWaitPtr,
+		Canary:            *canaryPtr,
+		ScheduleDates:     scheduleDates,
+		Holidays:          holidays,
+		IntervalAfterRun:  *intervalSinceFinishPtr,
+		Retries:           *retriesPtr,
+		RetryDelay:        *retryDelayPtr,
+		RetryJitter:       *retryJitterPtr,
+		RetryOnExitCodes:  retryOnExitCodes,
+		RetryMaxElapsed:   *retryMaxElapsedPtr,
+		ReadOnlyPaths:     readOnly,
+		Snapshots:         snapshots,
+		AuditFile:         *auditPtr,
+		ArtifactDir:       *artifactDirPtr,
+		CheckpointDir:     *checkpointDirPtr,
+		CustomMetrics:     *customMetricsPtr,
+		TouchFile:         *touchFilePtr,
+		AttemptTimeout:    *attemptTimeoutPtr,
+		OverallDeadline:   *overallDeadlinePtr,
+		StopSignal:        stopSignal,
+		StopGrace:         *stopGracePtr,
+		ShutdownSignals:   []os.Signal{syscall.SIGTERM, os.Interrupt},
+		TimeoutWarning:    *timeoutWarningPtr,
+		StateDir:          *stateDirPtr,
+		HistoryRetention:  historyRetention,
+		Cipher:            cipher,
+		FallbackDir:       *fallbackDirPtr,
+		QueueDir:          *queueDirPtr,
+		ForEach:           forEach,
+		Items:             items,
+		Parallelism:       *parallelPtr,
+		Provenance:        *provenancePtr,
+		RegistryFile:      *registryPtr,
+		Events:            eventsWriter(*eventsFilePtr),
+		Schedule:          *schedulePtr,
+		Inventory:         inventoryPush,
+		Collisions:        nameCollisions(*jobnamePtr, append([]string{cmdBin}, cmdArgsOnly...)),
+		ExporterOptions:   exporterOpts,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		pflag.Usage()
+		os.Exit(1)
+	}
+
+	if *printArgvPtr {
+		printArgv(os.Stdout, r.Argv())
+		os.Exit(0)
+	}
+
+	var goroutinesFile string
+	if *artifactDirPtr != "" {
+		goroutinesFile = filepath.Join(*artifactDirPtr, *jobnamePtr+".goroutines.txt")
+	}
+	dumpGoroutinesOnQuit(goroutinesFile)
+
+	if healthServer != nil {
+		if err := healthServer.Listen(*healthListenPtr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --health-listen: %v\n\n", err)
+			pflag.Usage()
+			os.Exit(1)
 		}
-	} else {
-		cmd.Stdout = &buf
-		cmd.Stderr = &buf
 	}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
+	// The watchdog reports a crash if this process dies before telling it the run is over
+	var wd *watchdog.Watchdog
+	if *watchdogPtr {
+		if wd, err = watchdog.Start(watchdogArgs(*jobnamePtr, *watchdogNotifyPtr, exporterFlags)...); err != nil {
+			log.Printf("Failed to start watchdog: %v", err)
+		}
+	}
+	result, err := r.Run()
+	if wd != nil {
+		if doneErr := wd.Done(); doneErr != nil {
+			log.Printf("Watchdog failed: %v", doneErr)
+		}
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
+	os.Exit(reportRun(os.Stderr, *jobnamePtr, result, r.MetricsErr(), !*noSummaryPtr))
+}
+
+// reportRun writes the summary of a failed run, unless summary is false, and the metrics that could not be
+// written to stderr, and returns the exit code of cronmgr. Without any other integration, cron mails these
+// lines to MAILTO.
+func reportRun(stderr io.Writer, name string, result runner.Result, metricsErr error, summary bool) int {
+	if result.Failed() && summary {
+		fmt.Fprintln(stderr, result.Summary(name))
+	}
+	exitCode := result.ExitCode()
+	if metricsErr != nil {
+		fmt.Fprintf(stderr, "cronmgr: metrics of job %s not written: %v\n", name, metricsErr)
+		if exitCode == 0 {
+			exitCode = runner.ExitMetricsError
+		}
+	}
+	return exitCode
+}
+
+// legacyName is the name of the original cronmanager binary, cronmgr can be installed under it as an alias
+const legacyName = "cronmanager"
 
-	// Start copying stdout/stderr to log file if log writer is configured
-	if logWriter != nil {
-		logWriter.Start()
+// invokedAs reports whether the program path arg0 runs under name, e.g. through a symlink
+func invokedAs(arg0, name string) bool {
+	return strings.TrimSuffix(filepath.Base(arg0), ".exe") == name
+}
+
+// influxWriter builds the InfluxDB writer from the --influx-* flags, nil without a URL. The token is read
+// from tokenFile, or else from INFLUX_TOKEN, so that it does not show in the process list.
+func influxWriter(baseURL, org, bucket, tokenFile string, client *http.Client) (*influx.Writer, error) {
+	if baseURL == "" {
+		return nil, nil
+	}
+	if org == "" || bucket == "" {
+		return nil, fmt.Errorf("--influx-url requires --influx-org and --influx-bucket")
+	}
+	token := secret.Lookup(tokenFile, influx.TokenEnv)
+	if _, err := token.Get(); err != nil {
+		return nil, fmt.Errorf("InfluxDB token: %w", err)
 	}
+	return influx.NewWriter(influx.Config{URL: baseURL, Org: org, Bucket: bucket, Token: token, HTTPClient: client}), nil
+}
+
+// inventoryPusher returns the pusher of the --registry file to --inventory-url, nil if it is not set
+func inventoryPusher(endpoint, keyFile string, interval time.Duration, registryFile string, client *http.Client) (*inventory.Pusher, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	if registryFile == "" {
+		return nil, fmt.Errorf("--inventory-url requires --registry")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("--inventory-interval must be positive, got %v", interval)
+	}
+	key := secret.Lookup(keyFile, inventory.KeyEnv)
+	value, err := key.Get()
+	if err != nil {
+		return nil, fmt.Errorf("inventory key: %w", err)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("--inventory-url requires a signing key, set --inventory-key-file or $%s", inventory.KeyEnv)
+	}
+	return inventory.NewPusher(inventory.Config{URL: endpoint, Key: key, Interval: interval, HTTPClient: client}), nil
+}
+
+// eventsWriter returns the writer of the --events-file events, nil if it is not set
+func eventsWriter(dest string) *events.Writer {
+	if dest == "" {
+		return nil
+	}
+	return events.NewWriter(dest)
+}
 
-	// Wait for log copying to complete first — the pipes are closed by the OS
-	// when the child process exits, so the copy goroutines will finish naturally.
-	// Waiting here before cmd.Wait() avoids a race where cmd.Wait() closes the
-	// pipe read ends while the goroutines are still reading from them.
-	if logWriter != nil {
-		if flushErr := logWriter.Wait(); flushErr != nil {
-			log.Printf("Error flushing log file: %v", flushErr)
+// snapshotSpecs parses the --snapshot flags
+func snapshotSpecs(specs []string) ([]fssnapshot.Spec, error) {
+	parsed := make([]fssnapshot.Spec, 0, len(specs))
+	for _, spec := range specs {
+		s, err := fssnapshot.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("--snapshot: %w", err)
 		}
+		parsed = append(parsed, s)
 	}
+	return parsed, nil
+}
 
-	// Wait for the command to complete and get its exit status
-	err = cmd.Wait()
+// readOnlyPaths returns the absolute paths of the --assert-readonly flags, which must exist
+func readOnlyPaths(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("--assert-readonly: %w", errors.ErrUnsupported)
+	}
+	absolute := make([]string, 0, len(paths))
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("--assert-readonly: %w", err)
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return nil, fmt.Errorf("--assert-readonly: %w", err)
+		}
+		absolute = append(absolute, abs)
+	}
+	return absolute, nil
+}
 
-	// wait if idle is active
-	if *idleSeconds > 0 {
-		job.IdleWait(jobStartTime, *idleSeconds)
+// systemdScope builds the systemd scope of the command from the --systemd-* flags, nil if enabled is false.
+// The scope is created by the user's service manager unless cronmgr runs as root.
+func systemdScope(enabled bool, slice, memoryMax, cpuQuota string, properties []string) (*job.SystemdScope, error) {
+	if !enabled {
+		if slice != "" || memoryMax != "" || cpuQuota != "" || len(properties) > 0 {
+			return nil, errors.New("--systemd-slice, --systemd-memory-max, --systemd-cpu-quota and --systemd-property require --systemd-scope")
+		}
+		return nil, nil
+	}
+	scope := &job.SystemdScope{Slice: slice, User: os.Geteuid() != 0}
+	if memoryMax != "" {
+		scope.Properties = append(scope.Properties, "MemoryMax="+memoryMax)
 	}
+	if cpuQuota != "" {
+		scope.Properties = append(scope.Properties, "CPUQuota="+cpuQuota)
+	}
+	for _, property := range properties {
+		if !strings.Contains(property, "=") {
+			return nil, fmt.Errorf("--systemd-property: %q is not a NAME=VALUE property", property)
+		}
+	}
+	scope.Properties = append(scope.Properties, properties...)
+	return scope, nil
+}
+
+// argsAfterSeparator returns the arguments following the "--" separator on the parsed flags,
+// verbatim: later separators, leading dashes and empty strings are passed to the command unchanged.
+// Arguments before the separator that are not flags are rejected, instead of being taken as the command.
+func argsAfterSeparator(flags *pflag.FlagSet) (args []string, hasSeparator bool, err error) {
+	hasSeparator = flags.ArgsLenAtDash() != -1
+	if dashAt := flags.ArgsLenAtDash(); dashAt > 0 || (!hasSeparator && flags.NArg() > 0) {
+		return nil, hasSeparator, fmt.Errorf("unexpected argument %q, the command must follow the '--' separator", flags.Arg(0))
+	}
+	return flags.Args(), hasSeparator, nil
+}
 
-	// Calculate final duration
-	finalDuration := time.Since(jobStartTime).Seconds()
+// printArgv writes argv quoted one argument per line, making spaces, quotes and empty arguments visible
+func printArgv(w io.Writer, argv []string) {
+	for i, arg := range argv {
+		fmt.Fprintf(w, "argv[%d] = %s\n", i, strconv.Quote(arg))
+	}
+}
 
+// legacyCommand returns the command running the command line given with --command through a shell
+func legacyCommand(commandLine string, hasSeparator bool) (string, []string, error) {
+	if hasSeparator {
+		return "", nil, errors.New("--command cannot be combined with a command after '--'")
+	}
+	return "sh", []string{"-c", commandLine}, nil
+}
+
+// commandFromFile reads the command and its arguments from path, one argument per line.
+// Empty lines and lines starting with # are ignored, other lines are taken verbatim without any quoting.
+func commandFromFile(path string, hasSeparator bool) (string, []string, error) {
+	if hasSeparator {
+		return "", nil, errors.New("--cmd-file cannot be combined with a command after '--'")
+	}
+	content, err := os.ReadFile(path)
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if waitStatus, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				exitCode := waitStatus.ExitStatus()
-				// Job failed
-				exp.WriteGauge("failed", *jobnamePtr, "1", "Whether the job failed (1 = failed, 0 = success)")
-				exp.WriteGauge("exit_code", *jobnamePtr, strconv.Itoa(exitCode), "Exit code of the last job execution")
-				// Increment failed counter
-				exp.IncrementCounter("runs_total", *jobnamePtr, map[string]string{"status": "failed"}, "Total number of job runs")
-			}
-		} else {
-			log.Fatalf("cmd.Wait: %v", err)
+		return "", nil, fmt.Errorf("--cmd-file: %w", err)
+	}
+	var argv []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
-	} else {
-		// The job succeeded
-		exp.WriteGauge("failed", *jobnamePtr, "0", "Whether the job failed (1 = failed, 0 = success)")
-		exp.WriteGauge("exit_code", *jobnamePtr, "0", "Exit code of the last job execution")
-		// Increment success counter
-		exp.IncrementCounter("runs_total", *jobnamePtr, map[string]string{"status": "success"}, "Total number of job runs")
-	}
-
-	// Job is no longer running
-	exp.WriteGauge("running", *jobnamePtr, "0", "Whether the job is currently running (1 = running, 0 = finished)")
-	// Store final duration and last timestamp
-	exp.WriteGauge("duration_seconds", *jobnamePtr, strconv.FormatFloat(finalDuration, 'f', 2, 64), "Duration of the last job execution in seconds")
-	exp.WriteGauge("last_run_timestamp_seconds", *jobnamePtr, fmt.Sprintf("%d", time.Now().Unix()), "Timestamp of the last job execution")
+		argv = append(argv, line)
+	}
+	if len(argv) == 0 {
+		return "", nil, fmt.Errorf("--cmd-file: no command in %s", path)
+	}
+	return argv[0], argv[1:], nil
+}
+
+// forEachItems reads the items of a for-each run from --for-each-line or --for-each-glob
+func forEachItems(linesPath, pattern string) (bool, []string, error) {
+	switch {
+	case linesPath != "" && pattern != "":
+		return false, nil, errors.New("--for-each-line and --for-each-glob cannot be combined")
+	case linesPath != "":
+		items, err := runner.ItemsFromLines(linesPath)
+		if err != nil {
+			return false, nil, fmt.Errorf("--for-each-line: %w", err)
+		}
+		return true, items, nil
+	case pattern != "":
+		items, err := runner.ItemsFromGlob(pattern)
+		if err != nil {
+			return false, nil, fmt.Errorf("--for-each-glob: %w", err)
+		}
+		return true, items, nil
+	}
+	return false, nil, nil
+}
+
+// parseExitCodes parses a comma separated list of exit codes, an empty list returns nil
+func parseExitCodes(value string) ([]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var codes []int
+	for _, field := range strings.Split(value, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || code < 0 || code > 255 {
+			return nil, fmt.Errorf("invalid exit code %q", field)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
 }
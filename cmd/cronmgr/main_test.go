@@ -1,8 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/fssnapshot"
+	"github.com/alswl/cron-manager/internal/inventory"
+	"github.com/alswl/cron-manager/internal/job"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/alswl/cron-manager/internal/secret"
+	"github.com/spf13/afero"
 	"github.com/spf13/pflag"
 )
 
@@ -178,6 +193,14 @@ func TestExtractCommandAfterSeparator(t *testing.T) {
 			wantArgs:  []string{"--", "cmd2"},
 			wantError: false,
 		},
+		{
+			name:      "empty command",
+			args:      []string{"--", "", "arg1"},
+			wantCmd:   "",
+			wantArgs:  nil,
+			wantError: true,
+			errorMsg:  "command after '--' separator is empty",
+		},
 		{
 			name:      "command with spaces in path",
 			args:      []string{"--", "/usr/bin/my script", "arg1"},
@@ -220,3 +243,452 @@ func TestExtractCommandAfterSeparator(t *testing.T) {
 		})
 	}
 }
+
+// TestLogFileOptions tests the logFileOptions function
+func TestLogFileOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		chmod     string
+		chown     string
+		chunkSize string
+		wantCount int
+		wantError bool
+	}{
+		{name: "no options"},
+		{name: "mode and owner", chmod: "0640", chown: "0:0", wantCount: 2},
+		{name: "invalid mode", chmod: "rw-r-----", wantError: true},
+		{name: "invalid owner", chown: ":", wantError: true},
+		{name: "chunk size", chunkSize: "100M", wantCount: 1},
+		{name: "zero chunk size", chunkSize: "0"},
+		{name: "invalid chunk size", chunkSize: "100X", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := logFileOptions(tt.chmod, tt.chown, tt.chunkSize)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("logFileOptions() error = %v, wantError %v", err, tt.wantError)
+			}
+			if len(opts) != tt.wantCount {
+				t.Errorf("logFileOptions() returned %d options, want %d", len(opts), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestForEachItems(t *testing.T) {
+	tests := []struct {
+		name        string
+		linesPath   string
+		pattern     string
+		wantForEach bool
+		wantError   bool
+	}{
+		{name: "disabled"},
+		{name: "glob", pattern: "*.go", wantForEach: true},
+		{name: "missing lines file", linesPath: "does-not-exist", wantError: true},
+		{name: "both", linesPath: "items", pattern: "*.go", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEach, _, err := forEachItems(tt.linesPath, tt.pattern)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("forEachItems() error = %v, wantError %v", err, tt.wantError)
+			}
+			if forEach != tt.wantForEach {
+				t.Errorf("forEachItems() forEach = %v, want %v", forEach, tt.wantForEach)
+			}
+		})
+	}
+}
+
+func TestParseExitCodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		want      []int
+		wantError bool
+	}{
+		{name: "empty"},
+		{name: "single", value: "75", want: []int{75}},
+		{name: "list with spaces", value: "75, 111", want: []int{75, 111}},
+		{name: "not a number", value: "75,x", wantError: true},
+		{name: "out of range", value: "256", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExitCodes(tt.value)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("parseExitCodes() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseExitCodes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvokedAs(t *testing.T) {
+	tests := []struct {
+		arg0 string
+		want bool
+	}{
+		{arg0: "/usr/local/bin/cronmanager", want: true},
+		{arg0: "cronmanager", want: true},
+		{arg0: "/opt/bin/cronmanager.exe", want: true},
+		{arg0: "/usr/local/bin/cronmgr", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg0, func(t *testing.T) {
+			if got := invokedAs(filepath.FromSlash(tt.arg0), legacyName); got != tt.want {
+				t.Errorf("invokedAs(%q) = %v, want %v", tt.arg0, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyCommand(t *testing.T) {
+	bin, args, err := legacyCommand("echo hello > /tmp/out", false)
+	if err != nil {
+		t.Fatalf("legacyCommand() error = %v", err)
+	}
+	if bin != "sh" || !slices.Equal(args, []string{"-c", "echo hello > /tmp/out"}) {
+		t.Errorf("legacyCommand() = %s %v, want sh -c with the command line", bin, args)
+	}
+	if _, _, err := legacyCommand("echo hello", true); err == nil {
+		t.Errorf("legacyCommand() with a command after -- should fail")
+	}
+}
+
+// TestCommandFromFile tests reading the argv of the command from a file
+func TestCommandFromFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		hasSeparator bool
+		wantBin      string
+		wantArgs     []string
+		wantErr      bool
+	}{
+		{
+			name:     "one argument per line",
+			content:  "/usr/bin/report\n--title\nDaily report: it's \"done\"\n",
+			wantBin:  "/usr/bin/report",
+			wantArgs: []string{"--title", `Daily report: it's "done"`},
+		},
+		{
+			name:     "comments, blank lines and CRLF",
+			content:  "# managed by config management\r\n/usr/bin/report\r\n\r\n  indented arg\r\n",
+			wantBin:  "/usr/bin/report",
+			wantArgs: []string{"  indented arg"},
+		},
+		{name: "no command", content: "# empty\n\n", wantErr: true},
+		{name: "with separator", content: "/usr/bin/report\n", hasSeparator: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "job.cmd")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			bin, args, err := commandFromFile(path, tt.hasSeparator)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("commandFromFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if bin != tt.wantBin || !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("commandFromFile() = %q %q, want %q %q", bin, args, tt.wantBin, tt.wantArgs)
+			}
+		})
+	}
+
+	if _, _, err := commandFromFile(filepath.Join(t.TempDir(), "missing.cmd"), false); err == nil {
+		t.Errorf("commandFromFile() of a missing file should fail")
+	}
+}
+
+// TestArgsAfterSeparator tests that arguments after "--" reach the command verbatim
+func TestArgsAfterSeparator(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		wantArgs      []string
+		wantSeparator bool
+		wantErr       bool
+	}{
+		{name: "command", args: []string{"-n", "job", "--", "echo", "hello"}, wantArgs: []string{"echo", "hello"}, wantSeparator: true},
+		{name: "later separators", args: []string{"-n", "job", "--", "git", "log", "--", "README.md"}, wantArgs: []string{"git", "log", "--", "README.md"}, wantSeparator: true},
+		{name: "leading dashes", args: []string{"-n", "job", "--", "grep", "-e", "--name", "-"}, wantArgs: []string{"grep", "-e", "--name", "-"}, wantSeparator: true},
+		{name: "empty strings", args: []string{"-n", "job", "--", "printf", "%s|", "", ""}, wantArgs: []string{"printf", "%s|", "", ""}, wantSeparator: true},
+		{name: "flag-like command", args: []string{"-n", "job", "--", "-n", "other"}, wantArgs: []string{"-n", "other"}, wantSeparator: true},
+		{name: "no command", args: []string{"-n", "job"}, wantArgs: []string{}},
+		{name: "argument before separator", args: []string{"-n", "job", "echo", "--", "hello"}, wantSeparator: true, wantErr: true},
+		{name: "missing separator", args: []string{"-n", "job", "echo", "hello"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			fs.StringP("name", "n", "", "Job name")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			args, hasSeparator, err := argsAfterSeparator(fs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("argsAfterSeparator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if hasSeparator != tt.wantSeparator {
+				t.Errorf("argsAfterSeparator() hasSeparator = %v, want %v", hasSeparator, tt.wantSeparator)
+			}
+			if !tt.wantErr && !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("argsAfterSeparator() = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestPrintArgv tests that spaces, quotes and empty arguments are visible
+func TestPrintArgv(t *testing.T) {
+	var buf bytes.Buffer
+	printArgv(&buf, []string{"/usr/bin/report", "it's \"done\"", "", "--"})
+	want := `argv[0] = "/usr/bin/report"
+argv[1] = "it's \"done\""
+argv[2] = ""
+argv[3] = "--"
+`
+	if buf.String() != want {
+		t.Errorf("printArgv() = %q, want %q", buf.String(), want)
+	}
+}
+
+// TestReportRun tests the stderr lines and exit code of cronmgr at the end of a run
+func TestReportRun(t *testing.T) {
+	metricsErr := errors.New("read-only file system")
+	tests := []struct {
+		name       string
+		result     runner.Result
+		metricsErr error
+		summary    bool
+		wantCode   int
+		wantStderr []string
+	}{
+		{name: "success", summary: true},
+		{
+			name:       "failed job",
+			result:     runner.Result{ExitStatus: job.ExitStatus{Code: 2}},
+			summary:    true,
+			wantStderr: []string{"status=failed"},
+		},
+		{name: "failed job without summary", result: runner.Result{ExitStatus: job.ExitStatus{Code: 2}}},
+		{
+			name:       "metrics not written",
+			metricsErr: metricsErr,
+			wantCode:   runner.ExitMetricsError,
+			wantStderr: []string{"metrics of job backup not written: read-only file system"},
+		},
+		{
+			name:       "exec error and metrics not written",
+			result:     runner.Result{ExecError: job.ExecErrorNotFound},
+			metricsErr: metricsErr,
+			summary:    true,
+			wantCode:   127,
+			wantStderr: []string{"exec_error=not_found", "metrics of job backup not written"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			if code := reportRun(&stderr, "backup", tt.result, tt.metricsErr, tt.summary); code != tt.wantCode {
+				t.Errorf("reportRun() = %d, want %d", code, tt.wantCode)
+			}
+			if lines := strings.Count(stderr.String(), "\n"); lines != len(tt.wantStderr) {
+				t.Errorf("stderr = %q, want %d lines", stderr.String(), len(tt.wantStderr))
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr = %q, want %q", stderr.String(), want)
+				}
+			}
+		})
+	}
+}
+
+// TestReportRunMetricsErr tests that the metric writes failing during a run are reported at its end
+func TestReportRunMetricsErr(t *testing.T) {
+	fs := afero.NewReadOnlyFs(afero.NewMemMapFs())
+	r, err := runner.NewRunner(runner.RunnerOptions{
+		Name:            "backup",
+		Command:         "true",
+		ExporterOptions: []exporter.Option{exporter.WithFileSystem(fs), exporter.WithExporterDir("/metrics")},
+	})
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	result, err := r.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	var stderr bytes.Buffer
+	if code := reportRun(&stderr, "backup", result, r.MetricsErr(), true); code != runner.ExitMetricsError {
+		t.Errorf("reportRun() = %d, want %d, stderr %q", code, runner.ExitMetricsError, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "metrics of job backup not written") {
+		t.Errorf("stderr = %q, want the metrics error", stderr.String())
+	}
+}
+
+// TestInfluxWriter tests building the InfluxDB writer from the --influx-* flags
+func TestInfluxWriter(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		url        string
+		org        string
+		bucket     string
+		tokenFile  string
+		wantWriter bool
+		wantError  bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", url: "http://influxdb:8086", org: "ops", bucket: "cron", wantWriter: true},
+		{name: "token file", url: "http://influxdb:8086", org: "ops", bucket: "cron", tokenFile: tokenFile, wantWriter: true},
+		{name: "missing bucket", url: "http://influxdb:8086", org: "ops", wantError: true},
+		{name: "missing token file", url: "http://influxdb:8086", org: "ops", bucket: "cron", tokenFile: tokenFile + ".missing", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := influxWriter(tt.url, tt.org, tt.bucket, tt.tokenFile, nil)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("influxWriter() error = %v, wantError %v", err, tt.wantError)
+			}
+			if (w != nil) != tt.wantWriter {
+				t.Errorf("influxWriter() = %v, wantWriter %v", w, tt.wantWriter)
+			}
+		})
+	}
+}
+
+// TestInventoryPusher tests validating the inventory push flags
+func TestInventoryPusher(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(inventory.KeyEnv, "")
+	t.Setenv(inventory.KeyEnv+secret.FileSuffix, "")
+	const registryFile = "/var/lib/cronmgr/registry.json"
+	tests := []struct {
+		name       string
+		url        string
+		keyFile    string
+		interval   time.Duration
+		registry   string
+		wantPusher bool
+		wantError  bool
+	}{
+		{name: "disabled", registry: registryFile},
+		{name: "enabled", url: "https://inventory.example.com/hosts", keyFile: keyFile, interval: 24 * time.Hour, registry: registryFile, wantPusher: true},
+		{name: "missing key", url: "https://inventory.example.com/hosts", interval: 24 * time.Hour, registry: registryFile, wantError: true},
+		{name: "missing key file", url: "https://inventory.example.com/hosts", keyFile: keyFile + ".missing", interval: 24 * time.Hour, registry: registryFile, wantError: true},
+		{name: "missing registry", url: "https://inventory.example.com/hosts", keyFile: keyFile, interval: 24 * time.Hour, wantError: true},
+		{name: "zero interval", url: "https://inventory.example.com/hosts", keyFile: keyFile, registry: registryFile, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := inventoryPusher(tt.url, tt.keyFile, tt.interval, tt.registry, nil)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("inventoryPusher() error = %v, wantError %v", err, tt.wantError)
+			}
+			if (p != nil) != tt.wantPusher {
+				t.Errorf("inventoryPusher() = %v, wantPusher %v", p, tt.wantPusher)
+			}
+		})
+	}
+}
+
+// TestReadOnlyPaths tests resolving the --assert-readonly paths
+func TestReadOnlyPaths(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("read-only paths are watched with inotify")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.Mkdir("data", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readOnlyPaths([]string{"data", dir})
+	if err != nil {
+		t.Fatalf("readOnlyPaths() error = %v", err)
+	}
+	if want := []string{filepath.Join(dir, "data"), dir}; !slices.Equal(got, want) {
+		t.Errorf("readOnlyPaths() = %v, want %v", got, want)
+	}
+	if got, err := readOnlyPaths(nil); got != nil || err != nil {
+		t.Errorf("readOnlyPaths(nil) = %v, %v, want nil", got, err)
+	}
+	if _, err := readOnlyPaths([]string{"missing"}); err == nil {
+		t.Error("readOnlyPaths() of a missing path succeeded")
+	}
+}
+
+// TestSystemdScope tests building the systemd scope from the --systemd-* flags
+func TestSystemdScope(t *testing.T) {
+	tests := []struct {
+		name           string
+		enabled        bool
+		slice          string
+		memoryMax      string
+		cpuQuota       string
+		properties     []string
+		wantNil        bool
+		wantProperties []string
+		wantErr        bool
+	}{
+		{name: "disabled", wantNil: true},
+		{name: "defaults", enabled: true},
+		{name: "limits", enabled: true, slice: "batch.slice", memoryMax: "2G", cpuQuota: "50%", properties: []string{"IOWeight=50"},
+			wantProperties: []string{"MemoryMax=2G", "CPUQuota=50%", "IOWeight=50"}},
+		{name: "limits without scope", memoryMax: "2G", wantErr: true},
+		{name: "invalid property", enabled: true, properties: []string{"IOWeight"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := systemdScope(tt.enabled, tt.slice, tt.memoryMax, tt.cpuQuota, tt.properties)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("systemdScope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (scope == nil) != tt.wantNil {
+				t.Fatalf("systemdScope() = %v, want nil %v", scope, tt.wantNil)
+			}
+			if scope == nil {
+				return
+			}
+			if scope.Slice != tt.slice || !slices.Equal(scope.Properties, tt.wantProperties) || scope.User != (os.Geteuid() != 0) {
+				t.Errorf("systemdScope() = %+v", *scope)
+			}
+		})
+	}
+}
+
+// TestSnapshotSpecs tests parsing the --snapshot flags
+func TestSnapshotSpecs(t *testing.T) {
+	specs, err := snapshotSpecs([]string{"zfs:tank/pgdata", "lvm:vg0/data:5G"})
+	if err != nil {
+		t.Fatalf("snapshotSpecs() error = %v", err)
+	}
+	want := []fssnapshot.Spec{{Kind: fssnapshot.ZFS, Target: "tank/pgdata"}, {Kind: fssnapshot.LVM, Target: "vg0/data", Option: "5G"}}
+	if !slices.Equal(specs, want) {
+		t.Errorf("snapshotSpecs() = %+v, want %+v", specs, want)
+	}
+	if _, err := snapshotSpecs([]string{"ext4:/srv"}); err == nil || !strings.HasPrefix(err.Error(), "--snapshot: ") {
+		t.Errorf("snapshotSpecs() error = %v, want --snapshot error", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/state"
+)
+
+// jobMetrics reads the gauges of jobs from their exporter files with Exporter.ReadSnapshot, which takes no
+// lock, so that status and top never delay the running jobs writing their metrics. Each file is read once.
+type jobMetrics struct {
+	opts []exporter.Option
+	// warnings receives the files that could not be read, the commands then show the jobs without their metrics
+	warnings  io.Writer
+	exporters map[string]*exporter.Exporter
+	snapshots map[string]exporter.Snapshot
+}
+
+// newJobMetrics creates the jobMetrics of the exporter files configured by opts
+func newJobMetrics(opts []exporter.Option, warnings io.Writer) *jobMetrics {
+	return &jobMetrics{
+		opts:      opts,
+		warnings:  warnings,
+		exporters: make(map[string]*exporter.Exporter),
+		snapshots: make(map[string]exporter.Snapshot),
+	}
+}
+
+// gauge returns the value of the gauge metric of the job of runState, read from the file of its owner.
+// It returns false if the job has no such series or metrics are disabled.
+func (m *jobMetrics) gauge(runState state.RunState, metric string) (float64, bool) {
+	owner := runState.Owner
+	exp, ok := m.exporters[owner]
+	if !ok {
+		exp = exporter.NewExporter(append(slices.Clone(m.opts), exporter.WithOwner(owner))...)
+		m.exporters[owner] = exp
+		if !exp.IsMetricDisabled() {
+			snapshot, err := exp.ReadSnapshot()
+			if err != nil {
+				fmt.Fprintf(m.warnings, "Warning: metrics not shown: %v\n", err)
+			}
+			m.snapshots[owner] = snapshot
+		}
+	}
+	snapshot, ok := m.snapshots[owner]
+	if !ok {
+		return 0, false
+	}
+	return snapshot.Value(exp.FullMetricName(metric), runState.Name, exp.ConstLabels())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+)
+
+// TestJobMetrics tests reading the gauges of jobs from the exporter file of their owner
+func TestJobMetrics(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	opts := []exporter.Option{exporter.WithFileSystem(fs), exporter.WithExporterDir("/metrics"), exporter.WithLabels(map[string]string{"env": "prod"})}
+	exporter.NewExporter(opts...).WriteGauge("duration_seconds", "backup", "12.5", "Duration")
+	exporter.NewExporter(append(opts, exporter.WithOwner("team-a"))...).WriteGauge("duration_seconds", "report", "3", "Duration")
+
+	tests := []struct {
+		name     string
+		opts     []exporter.Option
+		runState state.RunState
+		want     float64
+		wantOK   bool
+	}{
+		{name: "without owner", opts: opts, runState: state.RunState{Name: "backup"}, want: 12.5, wantOK: true},
+		{name: "owner file", opts: opts, runState: state.RunState{Name: "report", Owner: "team-a"}, want: 3, wantOK: true},
+		{name: "other owner file", opts: opts, runState: state.RunState{Name: "backup", Owner: "team-a"}},
+		{name: "not written", opts: opts, runState: state.RunState{Name: "cleanup"}},
+		{name: "metrics disabled", opts: append(opts, exporter.WithMetricDisabled(true)), runState: state.RunState{Name: "backup"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings bytes.Buffer
+			got, ok := newJobMetrics(tt.opts, &warnings).gauge(tt.runState, "duration_seconds")
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("gauge() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if warnings.Len() > 0 {
+				t.Errorf("unexpected warnings: %s", warnings.String())
+			}
+		})
+	}
+
+	// An unreadable file is reported, the job is shown without its metrics
+	if err := afero.WriteFile(fs, "/broken/crons.prom", []byte("crontab_duration_seconds{name=\"backup} 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var warnings bytes.Buffer
+	metrics := newJobMetrics([]exporter.Option{exporter.WithFileSystem(fs), exporter.WithExporterDir("/broken")}, &warnings)
+	if _, ok := metrics.gauge(state.RunState{Name: "backup"}, "duration_seconds"); ok || warnings.Len() == 0 {
+		t.Errorf("gauge() of an invalid file = %v with warnings %q, want not found with a warning", ok, warnings.String())
+	}
+}
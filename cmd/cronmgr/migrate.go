@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/spf13/pflag"
+)
+
+// Metric schemas of migrate-metrics
+const (
+	schemaLegacy    = "legacy"
+	schemaPerMetric = "per-metric"
+)
+
+// runMigrateMetrics rewrites the exporter file from one metric schema to the other
+func runMigrateMetrics(args []string) int {
+	flags := pflag.NewFlagSet("migrate-metrics", pflag.ContinueOnError)
+	flags.SortFlags = false
+	from := flags.String("from", "", "Schema of the series to rewrite: legacy ({prefix}{name,dimension} of cronmanager) or per-metric ({prefix}_<metric>{name}) (required)")
+	to := flags.String("to", "", "Schema to rewrite the series to: per-metric or legacy (required)")
+	keep := flags.Bool("keep", false, "Keep the --from series as well, like --legacy-metrics writes both schemas")
+	exporterFlags := addExporterFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr migrate-metrics --from legacy|per-metric --to per-metric|legacy [options]
+
+Rewrite the run, failed, duration and last series of the exporter file from one metric schema to the
+other in a single atomic write, so dashboards can switch without a gap or duplicate series.
+With --owner, the file of that owner is migrated.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	schemas := []string{schemaLegacy, schemaPerMetric}
+	if !slices.Contains(schemas, *from) || !slices.Contains(schemas, *to) || *from == *to {
+		fmt.Fprintf(os.Stderr, "Error: --from and --to must be %s and %s, in either order\n\n", schemaLegacy, schemaPerMetric)
+		flags.Usage()
+		return 1
+	}
+
+	exporterOpts, err := exporterFlags.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+	exp := exporter.NewExporter(exporterOpts...)
+	migrated, err := exp.MigrateLegacy(runner.LegacyGauges(), *to == schemaLegacy, *keep)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s: migrated %d series from %s to %s\n", exp.GetExporterPath(), migrated, *from, *to)
+	return 0
+}
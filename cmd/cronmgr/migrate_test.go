@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunMigrateMetrics tests the migrate-metrics subcommand
+func TestRunMigrateMetrics(t *testing.T) {
+	for _, args := range [][]string{
+		{"--to", "per-metric"},
+		{"--from", "legacy", "--to", "legacy"},
+		{"--from", "cron_job", "--to", "crontab"},
+	} {
+		if code := runMigrateMetrics(append(args, "--dir", t.TempDir())); code != 1 {
+			t.Errorf("runMigrateMetrics(%v) = %v, want 1", args, code)
+		}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "crons.prom")
+	legacy := "# HELP crontab Cron job execution metrics\n# TYPE crontab gauge\n" +
+		"crontab{name=\"backup\",dimension=\"failed\"} 0\ncrontab{name=\"backup\",dimension=\"duration\"} 12.50\n"
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runMigrateMetrics([]string{"--from", "legacy", "--to", "per-metric", "--dir", dir}); code != 0 {
+		t.Fatalf("runMigrateMetrics() = %v, want 0", code)
+	}
+	content, _ := os.ReadFile(path)
+	for _, want := range []string{`crontab_failed{name="backup"} 0`, `crontab_duration_seconds{name="backup"} 12.50`} {
+		if !strings.Contains(string(content), want+"\n") {
+			t.Errorf("Expected %s, got:\n%s", want, content)
+		}
+	}
+	if strings.Contains(string(content), "dimension=") || strings.Contains(string(content), "# TYPE crontab gauge") {
+		t.Errorf("Expected the legacy series and headers to be removed, got:\n%s", content)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/alswl/cron-manager/internal/mqtt"
+	"github.com/alswl/cron-manager/internal/netdial"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/alswl/cron-manager/internal/secret"
+	"github.com/spf13/pflag"
+)
+
+// mqttFlags are the flags configuring the publication of the results to an MQTT broker
+type mqttFlags struct {
+	url          *string
+	topic        *string
+	qos          *uint8
+	retain       *bool
+	username     *string
+	passwordFile *string
+	caFile       *string
+	certFile     *string
+	keyFile      *string
+}
+
+// addMQTTFlags registers the MQTT flags on flags
+func addMQTTFlags(flags *pflag.FlagSet) *mqttFlags {
+	return &mqttFlags{
+		url:          flags.String("mqtt-url", "", "Publish the result of each run as JSON to this MQTT broker, e.g. tcp://broker:1883 or ssl://broker:8883"),
+		topic:        flags.String("mqtt-topic", runner.DefaultMQTTTopic, "MQTT topic of the results, {host} and {job} are replaced by the host and job names"),
+		qos:          flags.Uint8("mqtt-qos", 1, "MQTT quality of service of the results: 0, 1 or 2"),
+		retain:       flags.Bool("mqtt-retain", false, "Ask the broker to retain the last result of each job for new subscribers"),
+		username:     flags.String("mqtt-username", "", "MQTT user name"),
+		passwordFile: flags.String("mqtt-password-file", "", "File containing the MQTT password, read again for each publish (default: $MQTT_PASSWORD_FILE or $MQTT_PASSWORD)"),
+		caFile:       flags.String("mqtt-ca-file", "", "PEM file of the CAs the broker certificate is verified with (default: the system roots)"),
+		certFile:     flags.String("mqtt-cert-file", "", "PEM file of the client certificate authenticating to the broker"),
+		keyFile:      flags.String("mqtt-key-file", "", "PEM file of the key of the client certificate"),
+	}
+}
+
+// publisher builds the MQTT publisher from the parsed flags, nil without a URL, connecting from
+// bindInterface if set and falling back to the address of dnsCache while DNS fails if it is not nil.
+// The password is read from the password file, or else from the file of $MQTT_PASSWORD_FILE or from
+// $MQTT_PASSWORD
+func (f *mqttFlags) publisher(bindInterface string, dnsCache *netdial.Cache) (*mqtt.Publisher, error) {
+	if *f.url == "" {
+		return nil, nil
+	}
+	cfg := mqtt.Config{URL: *f.url, Username: *f.username, Password: secret.Lookup(*f.passwordFile, mqtt.PasswordEnv), QoS: *f.qos, Retain: *f.retain, BindInterface: bindInterface, DNSCache: dnsCache}
+	if _, err := cfg.Password.Get(); err != nil {
+		return nil, fmt.Errorf("MQTT password: %w", err)
+	}
+
+	if (*f.certFile == "") != (*f.keyFile == "") {
+		return nil, errors.New("--mqtt-cert-file and --mqtt-key-file must be set together")
+	}
+	if *f.caFile != "" || *f.certFile != "" {
+		cfg.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if *f.caFile != "" {
+		content, err := os.ReadFile(*f.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("--mqtt-ca-file: %w", err)
+		}
+		cfg.TLS.RootCAs = x509.NewCertPool()
+		if !cfg.TLS.RootCAs.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("--mqtt-ca-file: no PEM certificate in %s", *f.caFile)
+		}
+	}
+	if *f.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*f.certFile, *f.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("--mqtt-cert-file: %w", err)
+		}
+		cfg.TLS.Certificates = []tls.Certificate{cert}
+	}
+
+	p, err := mqtt.NewPublisher(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("--mqtt-url: %w", err)
+	}
+	return p, nil
+}
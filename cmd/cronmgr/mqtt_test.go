@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// writeCertificate writes a self-signed certificate and its key as PEM files in dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "edge-device"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// TestMQTTFlags tests building the MQTT publisher from the --mqtt-* flags
+func TestMQTTFlags(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantPublisher bool
+		wantError     bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", args: []string{"--mqtt-url", "tcp://broker"}, wantPublisher: true},
+		{name: "password file", args: []string{"--mqtt-url", "tcp://broker", "--mqtt-username", "edge", "--mqtt-password-file", passwordFile}, wantPublisher: true},
+		{name: "tls", args: []string{"--mqtt-url", "ssl://broker", "--mqtt-ca-file", certFile, "--mqtt-cert-file", certFile, "--mqtt-key-file", keyFile}, wantPublisher: true},
+		{name: "missing password file", args: []string{"--mqtt-url", "tcp://broker", "--mqtt-password-file", passwordFile + ".missing"}, wantError: true},
+		{name: "invalid ca file", args: []string{"--mqtt-url", "ssl://broker", "--mqtt-ca-file", passwordFile}, wantError: true},
+		{name: "cert without key", args: []string{"--mqtt-url", "ssl://broker", "--mqtt-cert-file", certFile}, wantError: true},
+		{name: "invalid qos", args: []string{"--mqtt-url", "tcp://broker", "--mqtt-qos", "3"}, wantError: true},
+		{name: "invalid url", args: []string{"--mqtt-url", "http://broker"}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			mqttFlags := addMQTTFlags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			p, err := mqttFlags.publisher("", nil)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("publisher() error = %v, wantError %v", err, tt.wantError)
+			}
+			if (p != nil) != tt.wantPublisher {
+				t.Errorf("publisher() = %v, want publisher %v", p, tt.wantPublisher)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/config"
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/notify"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/alswl/cron-manager/internal/secret"
+	"github.com/alswl/cron-manager/internal/severity"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// notifyFlags are the flags configuring the notifiers of failed runs, shared by job runs and cronmgr notify test
+type notifyFlags struct {
+	slackWebhook     *string
+	slackWebhookFile *string
+	webhook          *string
+	exec             *string
+	file             *string
+	chain            *[]string
+	templateFile     *string
+	runURL           *string
+}
+
+// addNotifyFlags registers the notifier flags on flags
+func addNotifyFlags(flags *pflag.FlagSet) *notifyFlags {
+	return &notifyFlags{
+		slackWebhook:     flags.String("notify-slack-webhook", "", "Notify failed runs to this Slack incoming webhook URL"),
+		slackWebhookFile: flags.String("notify-slack-webhook-file", "", "File containing the Slack incoming webhook URL, read again for each notification so it can be rotated"),
+		webhook:          flags.String("notify-webhook", "", "Notify failed runs by posting them as JSON to this URL"),
+		exec:             flags.String("notify-exec", "", "Notify failed runs by running this shell command with the run as JSON on stdin"),
+		file:             flags.String("notify-file", "", "Notify failed runs by appending them as JSON lines to this file, e.g. as the last resort of --notify-chain"),
+		chain:            flags.StringSlice("notify-chain", nil, "Channels tried in order until one delivers the notification, e.g. exec,webhook,file (default: notify all channels)"),
+		templateFile:     flags.String("notify-template", "", "File holding a Go template rendering the text of notifications, e.g. {{.Name}} {{.Status}} after {{.Duration}}"),
+		runURL:           flags.String("notify-run-url", "", "Link to each run passed to notifications, {job}, {run_id} and {host} are replaced, e.g. https://grafana/d/cron?var-run={run_id}"),
+	}
+}
+
+// template parses the --notify-template file, it returns nil if it is not set
+func (f *notifyFlags) template() (*notify.Template, error) {
+	if *f.templateFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(*f.templateFile)
+	if err != nil {
+		return nil, fmt.Errorf("--notify-template: %w", err)
+	}
+	tmpl, err := notify.ParseTemplate(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("--notify-template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// notifiers builds the configured notifiers from the parsed flags, sending their HTTP requests with client,
+// in the order of --notify-chain if it is set. Webhook notifications are signed with signer if it is not nil.
+func (f *notifyFlags) notifiers(client *http.Client, signer *crypt.Signer) ([]notify.Notifier, error) {
+	var notifiers []notify.Notifier
+	switch {
+	case *f.slackWebhook != "" && *f.slackWebhookFile != "":
+		return nil, fmt.Errorf("--notify-slack-webhook and --notify-slack-webhook-file are mutually exclusive")
+	case *f.slackWebhookFile != "":
+		webhook := secret.File(*f.slackWebhookFile)
+		if _, err := webhook.Get(); err != nil {
+			return nil, fmt.Errorf("--notify-slack-webhook-file: %w", err)
+		}
+		notifiers = append(notifiers, notify.NewSlack(webhook, client))
+	case *f.slackWebhook != "":
+		notifiers = append(notifiers, notify.NewSlack(secret.Value(*f.slackWebhook), client))
+	}
+	if *f.webhook != "" {
+		notifiers = append(notifiers, notify.NewWebhook(*f.webhook, client, signer))
+	}
+	if *f.exec != "" {
+		notifiers = append(notifiers, notify.NewExec(*f.exec, notify.DefaultTimeout))
+	}
+	if *f.file != "" {
+		notifiers = append(notifiers, notify.NewFile(*f.file))
+	}
+	if !f.fallback() {
+		return notifiers, nil
+	}
+
+	chained := make([]notify.Notifier, 0, len(notifiers))
+	for _, channel := range *f.chain {
+		i := slices.IndexFunc(notifiers, func(n notify.Notifier) bool { return n != nil && n.Channel() == channel })
+		if i < 0 {
+			return nil, fmt.Errorf("--notify-chain: no %s notifier configured, or listed twice", channel)
+		}
+		chained = append(chained, notifiers[i])
+		notifiers[i] = nil
+	}
+	for _, n := range notifiers {
+		if n != nil {
+			return nil, fmt.Errorf("--notify-chain: the %s notifier is configured but not in the chain", n.Channel())
+		}
+	}
+	return chained, nil
+}
+
+// fallback reports whether notifications go to the first notifier of the chain delivering them rather than to all notifiers
+func (f *notifyFlags) fallback() bool {
+	return len(*f.chain) > 0
+}
+
+// notifyLimits parses the --notify-limit and --notify-global-limit flags, empty values disable the limit
+func notifyLimits(job, global string) (notify.Limit, notify.Limit, error) {
+	var jobLimit, globalLimit notify.Limit
+	var err error
+	if job != "" {
+		if jobLimit, err = notify.ParseLimit(job); err != nil {
+			return notify.Limit{}, notify.Limit{}, fmt.Errorf("--notify-limit: %w", err)
+		}
+	}
+	if global != "" {
+		if globalLimit, err = notify.ParseLimit(global); err != nil {
+			return notify.Limit{}, notify.Limit{}, fmt.Errorf("--notify-global-limit: %w", err)
+		}
+	}
+	return jobLimit, globalLimit, nil
+}
+
+// severities loads the --severity-map file, it returns nil if it is not set. Each channel it routes
+// severities to must be one of notifiers.
+func severities(path string, notifiers []notify.Notifier) (*severity.Map, error) {
+	if path == "" {
+		return nil, nil
+	}
+	m, err := severity.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("--severity-map: %w", err)
+	}
+	for _, channel := range m.RoutedChannels() {
+		if !slices.ContainsFunc(notifiers, func(n notify.Notifier) bool { return n.Channel() == channel }) {
+			return nil, fmt.Errorf("--severity-map: no %s notifier configured", channel)
+		}
+	}
+	return m, nil
+}
+
+// runNotify runs the notify subcommand, only notify test exists
+func runNotify(args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintf(os.Stderr, "Usage: cronmgr notify test [options]\n")
+		return 1
+	}
+
+	flags := pflag.NewFlagSet("notify test", pflag.ContinueOnError)
+	flags.SortFlags = false
+	channel := flags.String("channel", "", "Only test the notifiers of this channel, e.g. slack (default: all)")
+	name := flags.StringP("name", "n", "cronmgr-notify-test", "Job name of the synthetic notification")
+	notifyFlags := addNotifyFlags(flags)
+	httpFlags := addHTTPFlags(flags)
+	signingKey := flags.String("signing-key-file", "", "File holding an ed25519 key (PKCS #8 PEM or 32 byte seed) signing the webhook notification")
+	configPath := flags.String("config", config.DefaultPath, "Config file holding the profiles")
+	profile := flags.String("profile", "", "Profile of the config file setting the notifier flags not given on the command line (default: CRONMGR_PROFILE env var)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr notify test [options]
+
+Send a synthetic failure notification through each configured notifier and report whether it was delivered.
+Notifiers are configured with the same flags as job runs, or with the notifier flags of a profile.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return 1
+	}
+	values, err := profileValues(afero.NewOsFs(), *configPath, *profile)
+	if err == nil {
+		// A profile also sets flags of job runs, only the notifier flags apply here
+		maps.DeleteFunc(values, func(name string, _ string) bool { return flags.Lookup(name) == nil })
+		err = applyProfile(flags, values)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	tmpl, err := notifyFlags.template()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+	msg, err := testMessage(*name, tmpl, *notifyFlags.runURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	client, err := httpFlags.client(nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+	var signer *crypt.Signer
+	if *signingKey != "" {
+		if signer, err = crypt.SignerFromFile(*signingKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --signing-key-file: %v\n\n", err)
+			flags.Usage()
+			return 1
+		}
+	}
+	notifiers, err := notifyFlags.notifiers(client, signer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+	if err := testNotifiers(os.Stdout, notifiers, *channel, msg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// testMessage returns the synthetic failure of the job name, with the run URL built from runURL
+// and rendered with tmpl if it is not nil, so the formatting can be checked too
+func testMessage(name string, tmpl *notify.Template, runURL string) (notify.Message, error) {
+	start := time.Now()
+	msg := notify.Message{
+		Name:      name,
+		RunID:     runner.RunID(start, os.Getpid()),
+		Status:    "failed",
+		ErrorType: "job",
+		ExitCode:  1,
+		Attempts:  1,
+		StartTime: start,
+		LogTail:   "This is a test notification sent by cronmgr notify test",
+		Test:      true,
+	}
+	msg.Host, _ = os.Hostname()
+	if runURL != "" {
+		msg.RunURL = notify.RunURL(runURL, msg)
+	}
+	if tmpl != nil {
+		if err := tmpl.Apply(&msg); err != nil {
+			return notify.Message{}, fmt.Errorf("--notify-template: %w", err)
+		}
+	}
+	return msg, nil
+}
+
+// testNotifiers sends the synthetic msg through the notifiers of channel, or all notifiers if it is empty,
+// and writes the delivery result of each notifier to w. It fails if any delivery failed.
+func testNotifiers(w io.Writer, notifiers []notify.Notifier, channel string, msg notify.Message) error {
+	tested, failed := 0, 0
+	for _, n := range notifiers {
+		if channel != "" && n.Channel() != channel {
+			continue
+		}
+		tested++
+		sent := time.Now()
+		if err := n.Notify(context.Background(), msg); err != nil {
+			failed++
+			_, _ = fmt.Fprintf(w, "%s: failed: %v\n", n.Channel(), err)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s: delivered in %s\n", n.Channel(), time.Since(sent).Round(time.Millisecond))
+	}
+	switch {
+	case tested == 0 && channel != "":
+		return fmt.Errorf("no %s notifier configured", channel)
+	case tested == 0:
+		return fmt.Errorf("no notifier configured")
+	case failed > 0:
+		return fmt.Errorf("%d of %d notifications failed", failed, tested)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/notify"
+	"github.com/alswl/cron-manager/internal/secret"
+	"github.com/spf13/pflag"
+)
+
+// TestNotifyFlags tests building the notifiers from the --notify-* flags
+func TestNotifyFlags(t *testing.T) {
+	webhookFile := filepath.Join(t.TempDir(), "slack-webhook")
+	if err := os.WriteFile(webhookFile, []byte("https://hooks.slack.com/services/T0/B0/X\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		args         []string
+		wantChannels []string
+		wantFallback bool
+		wantError    bool
+	}{
+		{name: "none"},
+		{name: "slack", args: []string{"--notify-slack-webhook", "https://hooks.slack.com/services/T0/B0/X"}, wantChannels: []string{"slack"}},
+		{name: "slack webhook file", args: []string{"--notify-slack-webhook-file", webhookFile}, wantChannels: []string{"slack"}},
+		{name: "missing slack webhook file", args: []string{"--notify-slack-webhook-file", webhookFile + ".missing"}, wantError: true},
+		{name: "slack webhook and file", args: []string{"--notify-slack-webhook", "https://hooks.slack.com/services/T0/B0/X", "--notify-slack-webhook-file", webhookFile}, wantError: true},
+		{name: "all", args: []string{"--notify-webhook", "https://alerts/cron", "--notify-exec", "/usr/local/bin/page", "--notify-slack-webhook", "https://hooks.slack.com/services/T0/B0/X",
+			"--notify-file", "/var/spool/cronmgr/notifications.jsonl"},
+			wantChannels: []string{"slack", "webhook", "exec", "file"}},
+		{name: "chain", args: []string{"--notify-webhook", "https://alerts/cron", "--notify-exec", "/usr/local/bin/page", "--notify-file", "/var/spool/cronmgr/notifications.jsonl",
+			"--notify-chain", "exec,webhook,file"},
+			wantChannels: []string{"exec", "webhook", "file"}, wantFallback: true},
+		{name: "chain not configured", args: []string{"--notify-webhook", "https://alerts/cron", "--notify-chain", "webhook,file"}, wantError: true},
+		{name: "chain twice", args: []string{"--notify-webhook", "https://alerts/cron", "--notify-chain", "webhook,webhook"}, wantError: true},
+		{name: "not in chain", args: []string{"--notify-webhook", "https://alerts/cron", "--notify-exec", "/usr/local/bin/page", "--notify-chain", "exec"}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			notifyFlags := addNotifyFlags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			notifiers, err := notifyFlags.notifiers(nil, nil)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("notifiers() error = %v, wantError %v", err, tt.wantError)
+			}
+			var channels []string
+			for _, n := range notifiers {
+				channels = append(channels, n.Channel())
+			}
+			if strings.Join(channels, ",") != strings.Join(tt.wantChannels, ",") {
+				t.Errorf("notifiers() channels = %v, want %v", channels, tt.wantChannels)
+			}
+			if !tt.wantError && notifyFlags.fallback() != tt.wantFallback {
+				t.Errorf("fallback() = %v, want %v", notifyFlags.fallback(), tt.wantFallback)
+			}
+		})
+	}
+}
+
+// TestNotifyLimits tests parsing the --notify-limit and --notify-global-limit flags
+func TestNotifyLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		job        string
+		global     string
+		wantJob    notify.Limit
+		wantGlobal notify.Limit
+		wantError  bool
+	}{
+		{name: "disabled"},
+		{name: "job", job: "3/1h", wantJob: notify.Limit{Count: 3, Window: time.Hour}},
+		{name: "both", job: "3/1h", global: "20/30m", wantJob: notify.Limit{Count: 3, Window: time.Hour},
+			wantGlobal: notify.Limit{Count: 20, Window: 30 * time.Minute}},
+		{name: "invalid job", job: "3", wantError: true},
+		{name: "invalid global", global: "many/1h", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job, global, err := notifyLimits(tt.job, tt.global)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("notifyLimits() error = %v, wantError %v", err, tt.wantError)
+			}
+			if job != tt.wantJob || global != tt.wantGlobal {
+				t.Errorf("notifyLimits() = %+v %+v, want %+v %+v", job, global, tt.wantJob, tt.wantGlobal)
+			}
+		})
+	}
+}
+
+// TestSeverities tests loading the --severity-map file and checking the channels it routes to
+func TestSeverities(t *testing.T) {
+	notifiers := []notify.Notifier{notify.NewFile(filepath.Join(t.TempDir(), "notifications.jsonl"))}
+	tests := []struct {
+		name      string
+		content   string
+		wantError bool
+	}{
+		{name: "codes", content: "exit 1 => warning\n"},
+		{name: "routed", content: "exit 1 => warning\nnotify warning => file\nnotify critical => none\n"},
+		{name: "unconfigured channel", content: "notify critical => slack\n", wantError: true},
+		{name: "invalid", content: "exit one => warning\n", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "severity.map")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			m, err := severities(path, notifiers)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("severities() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err == nil && m.Of(1) != "warning" {
+				t.Errorf("Of(1) = %s, want warning", m.Of(1))
+			}
+		})
+	}
+	if m, err := severities("", notifiers); m != nil || err != nil {
+		t.Errorf("severities(\"\") = %v, %v, want nil", m, err)
+	}
+}
+
+// TestTestMessage tests rendering the synthetic notification with the --notify-template and --notify-run-url flags
+func TestTestMessage(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.tmpl")
+	if err := os.WriteFile(valid, []byte("{{.Name}} {{.Status}} <{{.RunURL}}>\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.tmpl")
+	if err := os.WriteFile(invalid, []byte("{{.Name"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	failing := filepath.Join(dir, "failing.tmpl")
+	if err := os.WriteFile(failing, []byte("{{.Unknown}}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantText  string
+		wantError bool
+	}{
+		{name: "default", wantText: "[test] cronmgr: job backup failed"},
+		{name: "template", args: []string{"--notify-template", valid, "--notify-run-url", "https://grafana/d/cron?var-job={job}"},
+			wantText: "[test] backup failed <https://grafana/d/cron?var-job=backup>"},
+		{name: "missing template", args: []string{"--notify-template", valid + ".missing"}, wantError: true},
+		{name: "invalid template", args: []string{"--notify-template", invalid}, wantError: true},
+		{name: "failing template", args: []string{"--notify-template", failing}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			notifyFlags := addNotifyFlags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			tmpl, err := notifyFlags.template()
+			var msg notify.Message
+			if err == nil {
+				msg, err = testMessage("backup", tmpl, *notifyFlags.runURL)
+			}
+			if (err != nil) != tt.wantError {
+				t.Fatalf("error = %v, wantError %v", err, tt.wantError)
+			}
+			if !strings.HasPrefix(msg.Text(), tt.wantText) {
+				t.Errorf("Text() = %q, want prefix %q", msg.Text(), tt.wantText)
+			}
+		})
+	}
+}
+
+// TestTestNotifiers tests sending synthetic notifications and reporting their delivery
+func TestTestNotifiers(t *testing.T) {
+	var bodies []string
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b bytes.Buffer
+		_, _ = b.ReadFrom(r.Body)
+		bodies = append(bodies, b.String())
+	}))
+	defer ok.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer broken.Close()
+
+	tests := []struct {
+		name       string
+		notifiers  []notify.Notifier
+		channel    string
+		wantOutput []string
+		wantSent   int
+		wantError  bool
+	}{
+		{
+			name:       "all delivered",
+			notifiers:  []notify.Notifier{notify.NewSlack(secret.Value(ok.URL), nil), notify.NewWebhook(ok.URL, nil, nil)},
+			wantOutput: []string{"slack: delivered in ", "webhook: delivered in "},
+			wantSent:   2,
+		},
+		{
+			name:       "channel",
+			notifiers:  []notify.Notifier{notify.NewSlack(secret.Value(ok.URL), nil), notify.NewWebhook(ok.URL, nil, nil)},
+			channel:    "slack",
+			wantOutput: []string{"slack: delivered in "},
+			wantSent:   1,
+		},
+		{
+			name:       "failed",
+			notifiers:  []notify.Notifier{notify.NewSlack(secret.Value(broken.URL), nil), notify.NewWebhook(ok.URL, nil, nil)},
+			wantOutput: []string{"slack: failed: notify slack: unexpected status 403 Forbidden: invalid_token", "webhook: delivered in "},
+			wantSent:   1,
+			wantError:  true,
+		},
+		{name: "channel not configured", notifiers: []notify.Notifier{notify.NewWebhook(ok.URL, nil, nil)}, channel: "slack", wantError: true},
+		{name: "none configured", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies = nil
+			var out bytes.Buffer
+			msg, err := testMessage("backup", nil, "")
+			if err != nil {
+				t.Fatalf("testMessage() error = %v", err)
+			}
+			err = testNotifiers(&out, tt.notifiers, tt.channel, msg)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("testNotifiers() error = %v, wantError %v", err, tt.wantError)
+			}
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if out.Len() == 0 {
+				lines = nil
+			}
+			if len(lines) != len(tt.wantOutput) {
+				t.Fatalf("output = %q, want %d lines", out.String(), len(tt.wantOutput))
+			}
+			for i, want := range tt.wantOutput {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("line %d = %q, want prefix %q", i, lines[i], want)
+				}
+			}
+			if len(bodies) != tt.wantSent {
+				t.Fatalf("sent %d notifications, want %d", len(bodies), tt.wantSent)
+			}
+			for _, body := range bodies {
+				if !strings.Contains(body, "[test] cronmgr: job backup failed") {
+					t.Errorf("notification = %s, want a test failure of backup", body)
+				}
+			}
+		})
+	}
+}
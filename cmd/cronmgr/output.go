@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+)
+
+// Output formats of the listing subcommands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// ANSI colors of table rows
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// addNoColorFlag registers the --no-color flag on flags
+func addNoColorFlag(flags *pflag.FlagSet) *bool {
+	return flags.Bool("no-color", false, "Do not color the output (also disabled by the NO_COLOR environment variable or when not writing to a terminal)")
+}
+
+// useColor reports whether output to file is colored: it must be a terminal, and neither --no-color nor NO_COLOR is set
+func useColor(noColor bool, file *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// statusColor returns the color of rows of runs with status
+func statusColor(status string) string {
+	switch status {
+	case "failed", "incomplete":
+		return colorRed
+	case "running":
+		return colorYellow
+	case "success":
+		return colorGreen
+	default:
+		return ""
+	}
+}
+
+// table is a listing printed with aligned columns, each row may be colored as a whole
+type table struct {
+	header []string
+	rows   [][]string
+	colors []string
+}
+
+// newTable creates a table with the column names header
+func newTable(header ...string) *table {
+	return &table{header: header}
+}
+
+// add appends a row of cells printed in color, empty for the default color
+func (t *table) add(color string, cells ...string) {
+	t.rows = append(t.rows, cells)
+	t.colors = append(t.colors, color)
+}
+
+// write prints the table to w, rows are only colored if color is true.
+// Colors are applied to whole lines after alignment, escape codes would offset the columns otherwise.
+func (t *table) write(w io.Writer, color bool) error {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		if color && i > 0 && i <= len(t.colors) && t.colors[i-1] != "" {
+			line = t.colors[i-1] + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orDash returns value, or a dash if it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTableWrite tests column alignment and row colors
+func TestTableWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		color bool
+		want  string
+	}{
+		{
+			name: "plain",
+			want: "JOB     STATUS\n" +
+				"backup  failed\n" +
+				"report  success\n",
+		},
+		{
+			name:  "colored",
+			color: true,
+			want: "JOB     STATUS\n" +
+				colorRed + "backup  failed" + colorReset + "\n" +
+				"report  success\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newTable("JOB", "STATUS")
+			table.add(colorRed, "backup", "failed")
+			table.add("", "report", "success")
+			var buf bytes.Buffer
+			if err := table.write(&buf, tt.color); err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("write() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestUseColor tests that colors are disabled by --no-color, NO_COLOR and non-terminal output
+func TestUseColor(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	if useColor(false, file) {
+		t.Errorf("useColor() = true for a regular file")
+	}
+	if useColor(true, os.Stdout) {
+		t.Errorf("useColor() = true with --no-color")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if useColor(false, os.Stdout) {
+		t.Errorf("useColor() = true with NO_COLOR")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/alswl/cron-manager/internal/job"
+	"github.com/alswl/cron-manager/internal/seccomp"
+	"github.com/spf13/pflag"
+)
+
+// privileges builds the privileges the command drops from the --drop-caps, --no-new-privs and --seccomp-profile
+// flags, nil if none is set. euid is the effective user of cronmgr, capabilities can only be dropped by root.
+func privileges(dropCaps, noNewPrivs bool, seccompProfile string, euid int) (*job.Privileges, error) {
+	if !dropCaps && !noNewPrivs && seccompProfile == "" {
+		return nil, nil
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("--drop-caps, --no-new-privs and --seccomp-profile: %w", job.ErrPrivilegesUnsupported)
+	}
+	if dropCaps && euid != 0 {
+		return nil, errors.New("--drop-caps requires running cronmgr as root")
+	}
+	if seccompProfile != "" {
+		// Check the profile now rather than failing each run after it started
+		profile, err := seccomp.Load(seccompProfile)
+		if err != nil {
+			return nil, fmt.Errorf("--seccomp-profile: %w", err)
+		}
+		if _, err := profile.Compile(seccomp.Host{Arch: runtime.GOARCH}); err != nil {
+			return nil, fmt.Errorf("--seccomp-profile: %w", err)
+		}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("--drop-caps, --no-new-privs and --seccomp-profile: %w", err)
+	}
+	return &job.Privileges{Executable: executable, DropCaps: dropCaps, NoNewPrivs: noNewPrivs, SeccompProfile: seccompProfile}, nil
+}
+
+// runDropPrivileges drops the privileges of this process and replaces it with the command, see job.Privileges
+func runDropPrivileges(args []string) int {
+	flags := pflag.NewFlagSet(job.DropPrivilegesCommand, pflag.ContinueOnError)
+	flags.SortFlags = false
+	dropCaps := flags.Bool("drop-caps", false, "Drop all Linux capabilities")
+	noNewPrivs := flags.Bool("no-new-privs", false, "Set no_new_privs, so setuid executables grant nothing")
+	seccompProfile := flags.String("seccomp-profile", "", "Filter the syscalls of the command with this seccomp profile in the JSON format of Docker")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr drop-privileges [options] -- <command> [args...]
+
+Started by cronmgr --drop-caps, --no-new-privs or --seccomp-profile, not meant to be run directly. Drops the
+privileges of the process and replaces it with the command.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	commandArgs, hasSeparator, err := argsAfterSeparator(flags)
+	if err == nil && (!hasSeparator || len(commandArgs) == 0) {
+		err = errors.New("command is required after '--' separator")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	p := job.Privileges{DropCaps: *dropCaps, NoNewPrivs: *noNewPrivs, SeccompProfile: *seccompProfile}
+	command := commandArgs[0]
+	err = p.Exec(command, commandArgs[1:])
+	fmt.Fprintf(os.Stderr, "cronmgr: %s: %v\n", command, err)
+	if errors.Is(err, job.ErrDropPrivileges) || errors.Is(err, job.ErrPrivilegesUnsupported) {
+		return job.ExecErrorOther.ExitCode()
+	}
+	// Report exec failures with the exit codes of cronmgr running the command directly
+	return job.ClassifyExecError(command, err).ExitCode()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestPrivileges tests building the dropped privileges from the --drop-caps, --no-new-privs and --seccomp-profile flags
+func TestPrivileges(t *testing.T) {
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" && runtime.GOARCH != "arm") {
+		t.Skip("privileges are only dropped on Linux")
+	}
+	dir := t.TempDir()
+	profile := filepath.Join(dir, "profile.json")
+	if err := os.WriteFile(profile, []byte(`{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ALLOW"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"defaultAction": "SCMP_ACT_NOTIFY"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		dropCaps       bool
+		noNewPrivs     bool
+		seccompProfile string
+		euid           int
+		wantNil        bool
+		wantErr        bool
+	}{
+		{name: "disabled", wantNil: true},
+		{name: "root", dropCaps: true, noNewPrivs: true},
+		{name: "no_new_privs as user", noNewPrivs: true, euid: 1000},
+		{name: "capabilities as user", dropCaps: true, euid: 1000, wantErr: true},
+		{name: "seccomp profile", seccompProfile: profile, euid: 1000},
+		{name: "invalid seccomp profile", seccompProfile: invalid, wantErr: true},
+		{name: "missing seccomp profile", seccompProfile: filepath.Join(dir, "missing.json"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := privileges(tt.dropCaps, tt.noNewPrivs, tt.seccompProfile, tt.euid)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("privileges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (p == nil) != tt.wantNil {
+				t.Fatalf("privileges() = %v, want nil %v", p, tt.wantNil)
+			}
+			if p != nil && (p.Executable == "" || p.DropCaps != tt.dropCaps || p.NoNewPrivs != tt.noNewPrivs || p.SeccompProfile != tt.seccompProfile) {
+				t.Errorf("privileges() = %+v", *p)
+			}
+		})
+	}
+}
+
+// TestRunDropPrivileges tests the exit codes of cronmgr drop-privileges failing to execute the command
+func TestRunDropPrivileges(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("privileges are only dropped on Linux")
+	}
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "no separator", args: []string{"true"}, want: 1},
+		{name: "no command", args: []string{"--no-new-privs", "--"}, want: 1},
+		{name: "not found", args: []string{"--", "/nonexistent/cronmgr-test-command"}, want: 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runDropPrivileges(tt.args); got != tt.want {
+				t.Errorf("runDropPrivileges() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/alswl/cron-manager/internal/config"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// loadProfile applies the profile selected by profile, or CRONMGR_PROFILE if it is empty, from the config file at path
+func loadProfile(fs afero.Fs, flags *pflag.FlagSet, path, profile string) error {
+	values, err := profileValues(fs, path, profile)
+	if err != nil {
+		return err
+	}
+	return applyProfile(flags, values)
+}
+
+// profileValues returns the flag values of the profile selected by profile, or CRONMGR_PROFILE if it is empty,
+// from the config file at path. It returns nil if no profile is selected
+func profileValues(fs afero.Fs, path, profile string) (map[string]string, error) {
+	if profile == "" {
+		profile = os.Getenv(config.ProfileEnv)
+	}
+	if profile == "" {
+		return nil, nil
+	}
+	file, err := config.Load(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", profile, err)
+	}
+	return file.Profile(profile)
+}
+
+// applyProfile sets the flags of a profile, flags given on the command line take precedence
+func applyProfile(flags *pflag.FlagSet, values map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		flag := flags.Lookup(name)
+		switch {
+		case flag == nil:
+			return fmt.Errorf("profile: unknown flag --%s", name)
+		case name == "config" || name == "profile":
+			return fmt.Errorf("profile: --%s cannot be set by a profile", name)
+		case flag.Changed:
+			continue
+		}
+		if err := flags.Set(name, values[name]); err != nil {
+			return fmt.Errorf("profile: --%s: %w", name, err)
+		}
+	}
+	return nil
+}
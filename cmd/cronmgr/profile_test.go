@@ -0,0 +1,77 @@
+package main
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// TestLoadProfile tests that a profile sets the flags not given on the command line
+func TestLoadProfile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := `{"profiles": {
+  "prod": {"dir": "/var/lib/node_exporter", "pushgateway": "http://pushgateway:9091", "label": {"env": "prod"}},
+  "unknown-flag": {"colour": "red"},
+  "recursive": {"profile": "prod"},
+  "invalid": {"retries": "many"}
+}}`
+	if err := afero.WriteFile(fs, "/etc/cronmgr/config.json", []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		profile    string
+		env        string
+		wantDir    string
+		wantPush   string
+		wantLabels map[string]string
+		wantErr    bool
+	}{
+		{name: "no profile", args: []string{"--dir", "/metrics"}, wantDir: "/metrics", wantLabels: map[string]string{}},
+		{name: "profile", profile: "prod", wantDir: "/var/lib/node_exporter", wantPush: "http://pushgateway:9091", wantLabels: map[string]string{"env": "prod"}},
+		{name: "environment", env: "prod", wantDir: "/var/lib/node_exporter", wantPush: "http://pushgateway:9091", wantLabels: map[string]string{"env": "prod"}},
+		{name: "command line wins", args: []string{"--dir", "/metrics", "--label", "env=canary"}, profile: "prod",
+			wantDir: "/metrics", wantPush: "http://pushgateway:9091", wantLabels: map[string]string{"env": "canary"}},
+		{name: "unknown profile", profile: "dev", wantErr: true},
+		{name: "unknown flag", profile: "unknown-flag", wantErr: true},
+		{name: "recursive", profile: "recursive", wantErr: true},
+		{name: "invalid value", profile: "invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CRONMGR_PROFILE", tt.env)
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			exporterFlags := addExporterFlags(flags)
+			pushgateway := flags.String("pushgateway", "", "Pushgateway URL")
+			flags.Int("retries", 0, "Retries")
+			flags.String("profile", "", "Profile")
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := loadProfile(fs, flags, "/etc/cronmgr/config.json", tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *exporterFlags.dir != tt.wantDir || *pushgateway != tt.wantPush || !maps.Equal(*exporterFlags.labels, tt.wantLabels) {
+				t.Errorf("flags = dir %q, pushgateway %q, labels %v; want %q, %q, %v",
+					*exporterFlags.dir, *pushgateway, *exporterFlags.labels, tt.wantDir, tt.wantPush, tt.wantLabels)
+			}
+		})
+	}
+}
+
+// TestLoadProfileMissingConfig tests that selecting a profile without a config file is an error
+func TestLoadProfileMissingConfig(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	if err := loadProfile(afero.NewMemMapFs(), flags, "/etc/cronmgr/config.json", "prod"); err == nil {
+		t.Errorf("loadProfile() error = nil, want error")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// runReconcile clears the running flag of jobs whose recorded process no longer exists
+func runReconcile(args []string) int {
+	flags := pflag.NewFlagSet("reconcile", pflag.ContinueOnError)
+	flags.SortFlags = false
+	stateDir := flags.String("state-dir", "", "Directory recording the state of each job (required)")
+	exporterFlags := addExporterFlags(flags)
+	pruneShards := flags.Duration("prune-shards", 0, "Also remove owner metric files not written for this duration, e.g. 720h (0 = disabled)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr reconcile --state-dir <dir> [options]
+
+Clear the running flag of jobs whose cronmgr process was killed before the job finished.
+With --owner, only jobs of that owner are reconciled.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *stateDir == "" {
+		fmt.Fprintf(os.Stderr, "Error: --state-dir is required\n\n")
+		flags.Usage()
+		return 1
+	}
+
+	exporterOpts, err := exporterFlags.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+	exp := exporter.NewExporter(exporterOpts...)
+	store := state.NewStore(afero.NewOsFs(), *stateDir)
+	reconciled, err := runner.Reconcile(store, exp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, runState := range reconciled {
+		fmt.Printf("%s: cleared running flag of pid %d\n", runState.Name, runState.PID)
+	}
+
+	if *pruneShards > 0 {
+		removed, err := exp.PruneShards(*pruneShards)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, path := range removed {
+			fmt.Printf("removed stale metric file %s\n", path)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+)
+
+// TestRunReconcile tests the reconcile subcommand
+func TestRunReconcile(t *testing.T) {
+	t.Run("missing state dir", func(t *testing.T) {
+		if code := runReconcile([]string{"--dir", t.TempDir()}); code != 1 {
+			t.Errorf("runReconcile() = %v, want 1", code)
+		}
+	})
+
+	t.Run("clears running flag of killed job", func(t *testing.T) {
+		stateDir := t.TempDir()
+		metricsDir := t.TempDir()
+
+		cmd := exec.Command("sh", "-c", "exit 0")
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("Failed to run process: %v", err)
+		}
+		store := state.NewStore(afero.NewOsFs(), stateDir)
+		if err := store.Save(state.RunState{Name: "job", PID: cmd.Process.Pid, Running: true, StartTime: time.Now()}); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		if code := runReconcile([]string{"--state-dir", stateDir, "--dir", metricsDir}); code != 0 {
+			t.Fatalf("runReconcile() = %v, want 0", code)
+		}
+		content, err := os.ReadFile(filepath.Join(metricsDir, "crons.prom"))
+		if err != nil {
+			t.Fatalf("Failed to read metrics file: %v", err)
+		}
+		if !strings.Contains(string(content), `crontab_running{name="job"} 0`) {
+			t.Errorf("Expected running flag to be cleared, got:\n%s", content)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/job"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// runReplay executes the command of a recorded run again in the terminal, for debugging
+func runReplay(args []string) int {
+	flags := pflag.NewFlagSet("replay", pflag.ContinueOnError)
+	flags.SortFlags = false
+	stateDir := flags.String("state-dir", "", "Directory recording the state of each job (required)")
+	name := flags.StringP("name", "n", "", "Only look for the run among the runs of this job (default: all jobs)")
+	interactive := flags.Bool("interactive", false, "Connect the terminal to the standard input of the command, which is empty by default as under cron")
+	keyFlags := addKeyFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr replay <run-id> --state-dir <dir> [options]
+
+Execute the command of a run recorded with --state-dir again, with its arguments, environment and
+working directory, writing its whole output to the terminal. Redacted secrets are taken from the
+current environment. No metrics, state or history are written.
+
+Example:
+  cronmgr replay 20240501T020000Z-4242 --state-dir /var/lib/cronmgr
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	var err error
+	switch {
+	case flags.NArg() != 1:
+		err = fmt.Errorf("exactly one run ID is required")
+	case *stateDir == "":
+		err = fmt.Errorf("--state-dir is required")
+	}
+	var c *crypt.Cipher
+	if err == nil {
+		c, err = keyFlags.cipher()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	var journalOpts []history.Option
+	if c != nil {
+		journalOpts = append(journalOpts, history.WithCipher(c))
+	}
+	journal := history.NewJournal(afero.NewOsFs(), filepath.Join(*stateDir, runner.HistoryDir), journalOpts...)
+	record, err := findRun(journal, *name, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var stdin io.Reader
+	if *interactive {
+		stdin = os.Stdin
+	}
+	return replay(record, os.Environ(), stdin, os.Stdout, os.Stderr)
+}
+
+// findRun returns the history record of the run runID, of the job name if it is not empty
+func findRun(journal *history.Journal, name, runID string) (history.Record, error) {
+	var records []history.Record
+	var err error
+	if name != "" {
+		records, err = journal.Read(name, time.Time{})
+	} else {
+		records, err = journal.ReadAll(time.Time{})
+	}
+	if err != nil {
+		return history.Record{}, err
+	}
+	index := slices.IndexFunc(records, func(record history.Record) bool { return record.RunID == runID })
+	if index == -1 {
+		return history.Record{}, fmt.Errorf("run %s not found", runID)
+	}
+	return records[index], nil
+}
+
+// replay executes the command of record with its output on stdout and stderr, and returns its exit code.
+// The redacted values of the recorded environment are taken from environ.
+func replay(record history.Record, environ []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(record.Args) == 0 {
+		fmt.Fprintf(stderr, "Error: run %s of job %s was recorded without its command, it ran before cronmgr recorded commands\n", record.RunID, record.Name)
+		return 1
+	}
+	env, missing := restoreEnv(record.Env, environ)
+	fmt.Fprintf(stderr, "Replaying run %s of job %s started at %s, which exited with %d\n",
+		record.RunID, record.Name, record.StartTime.Local().Format(time.RFC3339), record.ExitCode)
+	fmt.Fprintf(stderr, "Command: %s\n", job.CommandLine(record.Args[0], record.Args[1:]))
+	if record.Dir != "" {
+		fmt.Fprintf(stderr, "Directory: %s\n", record.Dir)
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(stderr, "Warning: redacted variables not set in the current environment: %s\n", strings.Join(missing, ", "))
+	}
+
+	cmd := exec.Command(record.Args[0], record.Args[1:]...)
+	cmd.Dir = record.Dir
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		return exitErr.ExitCode()
+	default:
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+}
+
+// restoreEnv returns the recorded environment with its redacted values taken from environ. missing are the
+// redacted variables environ does not set, they are left out. Without a recorded environment, the command
+// inherits environ.
+func restoreEnv(recorded, environ []string) (env, missing []string) {
+	if recorded == nil {
+		return nil, nil
+	}
+	current := make(map[string]string, len(environ))
+	for _, entry := range environ {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			current[name] = value
+		}
+	}
+	env = make([]string, 0, len(recorded))
+	for _, entry := range recorded {
+		name, value, _ := strings.Cut(entry, "=")
+		if value == history.Redacted {
+			currentValue, ok := current[name]
+			if !ok {
+				missing = append(missing, name)
+				continue
+			}
+			entry = name + "=" + currentValue
+		}
+		env = append(env, entry)
+	}
+	return env, missing
+}
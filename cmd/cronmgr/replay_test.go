@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/spf13/afero"
+)
+
+// TestFindRun tests finding a recorded run by its ID
+func TestFindRun(t *testing.T) {
+	journal := history.NewJournal(afero.NewMemMapFs(), "/state/history")
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	for _, record := range []history.Record{
+		{Name: "backup", RunID: "run-1", StartTime: start},
+		{Name: "backup", RunID: "run-2", StartTime: start.Add(time.Hour), Args: []string{"/usr/bin/backup"}},
+		{Name: "sync", RunID: "run-3", StartTime: start.Add(2 * time.Hour), Args: []string{"/usr/bin/sync", "--all"}},
+	} {
+		if err := journal.Append(record); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		job       string
+		runID     string
+		wantArgs  []string
+		wantError bool
+	}{
+		{name: "any job", runID: "run-3", wantArgs: []string{"/usr/bin/sync", "--all"}},
+		{name: "given job", job: "backup", runID: "run-2", wantArgs: []string{"/usr/bin/backup"}},
+		{name: "run of another job", job: "backup", runID: "run-3", wantError: true},
+		{name: "run without command", runID: "run-1"},
+		{name: "unknown run", runID: "run-4", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findRun(journal, tt.job, tt.runID)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("findRun() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !slices.Equal(got.Args, tt.wantArgs) {
+				t.Errorf("findRun() args = %v, want %v", got.Args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestRestoreEnv tests that redacted values are taken from the current environment
+func TestRestoreEnv(t *testing.T) {
+	recorded := []string{"PATH=/usr/bin", "DB_PASSWORD=" + history.Redacted, "API_TOKEN=" + history.Redacted, "MODE=full"}
+	env, missing := restoreEnv(recorded, []string{"DB_PASSWORD=hunter2", "MODE=incremental"})
+	if want := []string{"PATH=/usr/bin", "DB_PASSWORD=hunter2", "MODE=full"}; !slices.Equal(env, want) {
+		t.Errorf("restoreEnv() env = %v, want %v", env, want)
+	}
+	if want := []string{"API_TOKEN"}; !slices.Equal(missing, want) {
+		t.Errorf("restoreEnv() missing = %v, want %v", missing, want)
+	}
+	if env, missing := restoreEnv(nil, []string{"PATH=/bin"}); env != nil || missing != nil {
+		t.Errorf("restoreEnv(nil) = %v, %v, want the current environment to be inherited", env, missing)
+	}
+}
+
+// TestReplay tests executing a recorded run again with its environment and working directory
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	record := history.Record{
+		Name:  "backup",
+		RunID: "run-1",
+		Args:  []string{"sh", "-c", `echo "$MODE in $(pwd)"; read line; echo "read $line"; exit 3`},
+		Env:   []string{"PATH=/usr/bin:/bin", "MODE=full"},
+		Dir:   dir,
+	}
+	var stdout, stderr bytes.Buffer
+	code := replay(record, nil, strings.NewReader("input\n"), &stdout, &stderr)
+	if code != 3 {
+		t.Errorf("replay() = %d, want 3; stderr:\n%s", code, stderr.String())
+	}
+	if want := "full in " + dir + "\nread input\n"; stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "Replaying run run-1 of job backup") {
+		t.Errorf("stderr = %q, want the replayed run", stderr.String())
+	}
+
+	record.Args = nil
+	if code := replay(record, nil, nil, &stdout, &stderr); code != 1 {
+		t.Errorf("replay() of a run without command = %d, want 1", code)
+	}
+}
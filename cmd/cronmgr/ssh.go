@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/config"
+	"github.com/spf13/afero"
+)
+
+// Variables set by sshd for a ForceCommand: the command requested by the client, and the addresses and ports
+// of the client and server
+const (
+	sshOriginalCommandEnv = "SSH_ORIGINAL_COMMAND"
+	sshConnectionEnv      = "SSH_CONNECTION"
+)
+
+// sshForceCommand returns the job name and command line of the ssh_commands entry of the config file at path
+// allowing requested, the command requested by the SSH client. hasCommand tells whether a command was also given
+// on the command line.
+func sshForceCommand(fs afero.Fs, path, requested string, hasCommand bool) (string, []string, error) {
+	if hasCommand {
+		return "", nil, errors.New("--ssh-force-command cannot be combined with --cmd-file, --command or a command after '--'")
+	}
+	file, err := config.Load(fs, path)
+	if err != nil {
+		return "", nil, fmt.Errorf("--ssh-force-command: %w", err)
+	}
+	name, argv, err := file.MatchSSHCommand(requested)
+	if err != nil {
+		return "", nil, fmt.Errorf("--ssh-force-command: %w", err)
+	}
+	return name, argv, nil
+}
+
+// sshClient returns the address of the SSH client from the value of SSH_CONNECTION, empty if it is not set
+func sshClient(connection string) string {
+	client, _, _ := strings.Cut(strings.TrimSpace(connection), " ")
+	return client
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// TestSSHForceCommand tests that only the commands allowed by the config file are run
+func TestSSHForceCommand(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := `{"ssh_commands": {"rotate": {"command": ["/usr/local/bin/rotate", "*"]}}}`
+	if err := afero.WriteFile(fs, "/etc/cronmgr/config.json", []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		requested  string
+		hasCommand bool
+		wantName   string
+		wantArgv   []string
+		wantErr    bool
+	}{
+		{name: "allowed", path: "/etc/cronmgr/config.json", requested: "/usr/local/bin/rotate nginx",
+			wantName: "rotate", wantArgv: []string{"/usr/local/bin/rotate", "nginx"}},
+		{name: "denied", path: "/etc/cronmgr/config.json", requested: "/bin/sh -i", wantErr: true},
+		{name: "interactive", path: "/etc/cronmgr/config.json", requested: "", wantErr: true},
+		{name: "command given", path: "/etc/cronmgr/config.json", requested: "/usr/local/bin/rotate nginx", hasCommand: true, wantErr: true},
+		{name: "missing config", path: "/missing.json", requested: "/usr/local/bin/rotate nginx", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, argv, err := sshForceCommand(fs, tt.path, tt.requested, tt.hasCommand)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sshForceCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.wantName || !slices.Equal(argv, tt.wantArgv) {
+				t.Errorf("sshForceCommand() = %s %q, want %s %q", name, argv, tt.wantName, tt.wantArgv)
+			}
+		})
+	}
+}
+
+// TestSSHClient tests that the client address is read from SSH_CONNECTION
+func TestSSHClient(t *testing.T) {
+	tests := []struct {
+		connection string
+		want       string
+	}{
+		{connection: "192.0.2.10 51234 192.0.2.1 22", want: "192.0.2.10"},
+		{connection: "2001:db8::10 51234 2001:db8::1 22", want: "2001:db8::10"},
+		{connection: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := sshClient(tt.connection); got != tt.want {
+			t.Errorf("sshClient(%q) = %q, want %q", tt.connection, got, tt.want)
+		}
+	}
+}
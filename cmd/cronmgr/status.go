@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// jobStatus is the last run of a job as listed by cronmgr status
+type jobStatus struct {
+	state.RunState
+	// Status is running, success, failed or incomplete
+	Status string `json:"status"`
+	// DurationSeconds is the duration_seconds gauge of the job, updated every second while it runs
+	DurationSeconds *float64 `json:"duration_seconds,omitempty"`
+}
+
+// statusOf returns the status of the recorded run runState
+func statusOf(runState state.RunState) string {
+	switch {
+	case runState.Incomplete || runState.Stale():
+		return "incomplete"
+	case runState.Running:
+		return "running"
+	case runState.ExitCode != 0:
+		return "failed"
+	default:
+		return "success"
+	}
+}
+
+// runStatus lists the last run of each job recorded in a state directory
+func runStatus(args []string) int {
+	flags := pflag.NewFlagSet("status", pflag.ContinueOnError)
+	flags.SortFlags = false
+	stateDir := flags.String("state-dir", "", "Directory recording the state of each job (required)")
+	output := flags.StringP("output", "o", outputTable, "Output format: table or json")
+	noColor := addNoColorFlag(flags)
+	exporterFlags := addExporterFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr status --state-dir <dir> [options]
+
+List the last run of each job recorded with --state-dir: running, success, failed or incomplete,
+with the duration read from the exporter files of the jobs without locking them.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	var err error
+	switch {
+	case *stateDir == "":
+		err = fmt.Errorf("--state-dir is required")
+	case *output != outputTable && *output != outputJSON:
+		err = fmt.Errorf("unsupported output %q, use %s or %s", *output, outputTable, outputJSON)
+	}
+	var exporterOpts []exporter.Option
+	if err == nil {
+		exporterOpts, err = exporterFlags.options()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	states, err := state.NewStore(afero.NewOsFs(), *stateDir).List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	metrics := newJobMetrics(exporterOpts, os.Stderr)
+	statuses := make([]jobStatus, 0, len(states))
+	for _, runState := range states {
+		status := jobStatus{RunState: runState, Status: statusOf(runState)}
+		if duration, ok := metrics.gauge(runState, "duration_seconds"); ok {
+			status.DurationSeconds = &duration
+		}
+		statuses = append(statuses, status)
+	}
+	if err := writeStatus(os.Stdout, statuses, *output, useColor(*noColor, os.Stdout)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeStatus writes statuses to w as a table or JSON, table rows are colored by status if color is true
+func writeStatus(w io.Writer, statuses []jobStatus, output string, color bool) error {
+	if output == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	}
+	t := newTable("JOB", "OWNER", "STATUS", "STARTED", "FINISHED", "DURATION", "EXIT", "RUN")
+	for _, s := range statuses {
+		finished, duration, exitCode := "-", "-", "-"
+		if !s.FinishTime.IsZero() {
+			finished = s.FinishTime.Local().Format(time.DateTime)
+			exitCode = strconv.Itoa(s.ExitCode)
+		}
+		if s.DurationSeconds != nil {
+			duration = formatDuration(secondsDuration(*s.DurationSeconds))
+		}
+		t.add(statusColor(s.Status), s.Name, orDash(s.Owner), s.Status, s.StartTime.Local().Format(time.DateTime),
+			finished, duration, exitCode, orDash(s.RunID))
+	}
+	return t.write(w, color)
+}
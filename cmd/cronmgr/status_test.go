@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/state"
+)
+
+// TestStatusOf tests the status of recorded runs
+func TestStatusOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		runState state.RunState
+		want     string
+	}{
+		{name: "running", runState: state.RunState{PID: os.Getpid(), Running: true}, want: "running"},
+		{name: "process gone", runState: state.RunState{PID: 999999999, Running: true}, want: "incomplete"},
+		{name: "reconciled", runState: state.RunState{Incomplete: true}, want: "incomplete"},
+		{name: "failed", runState: state.RunState{ExitCode: 2}, want: "failed"},
+		{name: "success", runState: state.RunState{}, want: "success"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statusOf(tt.runState); got != tt.want {
+				t.Errorf("statusOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteStatus tests the table and JSON outputs
+func TestWriteStatus(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	duration := 61.0
+	statuses := []jobStatus{
+		{RunState: state.RunState{Name: "backup", RunID: "20240101T020000Z-42", StartTime: start, FinishTime: start.Add(time.Minute), ExitCode: 2}, Status: "failed", DurationSeconds: &duration},
+		{RunState: state.RunState{Name: "report", Owner: "team-a", Running: true, StartTime: start}, Status: "running"},
+	}
+
+	tests := []struct {
+		output string
+		want   []string
+	}{
+		{output: outputTable, want: []string{"JOB", "backup  -", "failed", "1m1s", " 2 ", "20240101T020000Z-42", "report  team-a", "running"}},
+		{output: outputJSON, want: []string{`"name": "backup"`, `"status": "failed"`, `"exit_code": 2`, `"duration_seconds": 61`, `"status": "running"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeStatus(&buf, statuses, tt.output, false); err != nil {
+				t.Fatalf("writeStatus() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("writeStatus() = %q, want it to contain %q", buf.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/runner"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// expectedWindow is how far back runs are considered for the expected duration of a job
+const expectedWindow = 7 * 24 * time.Hour
+
+// maxTopFailures is the number of recent failures shown by cronmgr top
+const maxTopFailures = 10
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// topJob is a job shown running by cronmgr top
+type topJob struct {
+	state state.RunState
+	// expected is the typical duration of the job, zero if it is unknown
+	expected time.Duration
+	// timeoutSoon is set while the timeout_approaching gauge of the job is 1, about to be killed by a time limit
+	timeoutSoon bool
+}
+
+// topSnapshot is what cronmgr top shows at one refresh
+type topSnapshot struct {
+	running []topJob
+	// failures are the failed runs within the failure window, most recent first
+	failures []history.Record
+}
+
+// runTop shows the running jobs and recent failures recorded in a state directory, refreshing live
+func runTop(args []string) int {
+	flags := pflag.NewFlagSet("top", pflag.ContinueOnError)
+	flags.SortFlags = false
+	stateDir := flags.String("state-dir", "", "Directory recording the state of each job (required)")
+	interval := flags.Duration("interval", 2*time.Second, "Refresh interval")
+	failuresSince := flags.String("failures-since", "24h", "Show failed runs within this age, e.g. 24h or 7d")
+	once := flags.Bool("once", false, "Print a single snapshot and exit, e.g. for scripts")
+	noColor := addNoColorFlag(flags)
+	keyFlags := addKeyFlags(flags)
+	exporterFlags := addExporterFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr top --state-dir <dir> [options]
+
+Show the jobs running on this host with their elapsed time against their typical duration,
+flagging those about to reach a time limit from their exporter files, and their recent failures,
+refreshing until interrupted.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	var err error
+	var failureWindow time.Duration
+	switch {
+	case *stateDir == "":
+		err = fmt.Errorf("--state-dir is required")
+	case *interval <= 0:
+		err = fmt.Errorf("--interval must be positive")
+	default:
+		if failureWindow, err = parseAge(*failuresSince); err != nil {
+			err = fmt.Errorf("--failures-since: %w", err)
+		}
+	}
+	var c *crypt.Cipher
+	if err == nil {
+		c, err = keyFlags.cipher()
+	}
+	var exporterOpts []exporter.Option
+	if err == nil {
+		exporterOpts, err = exporterFlags.options()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	var journalOpts []history.Option
+	if c != nil {
+		journalOpts = append(journalOpts, history.WithCipher(c))
+	}
+
+	fs := afero.NewOsFs()
+	store := state.NewStore(fs, *stateDir)
+	journal := history.NewJournal(fs, filepath.Join(*stateDir, runner.HistoryDir), journalOpts...)
+	color := useColor(*noColor, os.Stdout)
+	for {
+		now := time.Now()
+		// The exporter files are read again at each refresh
+		metrics := newJobMetrics(exporterOpts, os.Stderr)
+		snapshot, err := loadTop(store, journal, metrics, now, failureWindow)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if !*once {
+			fmt.Print(clearScreen)
+		}
+		if err := renderTop(os.Stdout, snapshot, now, *failuresSince, color); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if *once {
+			return 0
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// loadTop collects the running jobs, with their metrics, and the failures within failureWindow before now
+func loadTop(store *state.Store, journal *history.Journal, metrics *jobMetrics, now time.Time, failureWindow time.Duration) (topSnapshot, error) {
+	var snapshot topSnapshot
+	states, err := store.List()
+	if err != nil {
+		return snapshot, err
+	}
+	for _, runState := range states {
+		// Runs whose process is gone are incomplete, not running
+		if !runState.Running || runState.Stale() {
+			continue
+		}
+		records, err := journal.Read(runState.Name, now.Add(-expectedWindow))
+		if err != nil {
+			return snapshot, err
+		}
+		approaching, _ := metrics.gauge(runState, "timeout_approaching")
+		snapshot.running = append(snapshot.running, topJob{state: runState, expected: history.TypicalDuration(records), timeoutSoon: approaching == 1})
+	}
+	// Longest running first
+	slices.SortFunc(snapshot.running, func(a, b topJob) int { return a.state.StartTime.Compare(b.state.StartTime) })
+
+	records, err := journal.ReadAll(now.Add(-failureWindow))
+	if err != nil {
+		return snapshot, err
+	}
+	for _, record := range slices.Backward(records) {
+		if record.Status != "failed" {
+			continue
+		}
+		snapshot.failures = append(snapshot.failures, record)
+		if len(snapshot.failures) == maxTopFailures {
+			break
+		}
+	}
+	return snapshot, nil
+}
+
+// renderTop writes snapshot taken at now to w, window describes the failure window.
+// Overdue jobs and failures are colored if color is true.
+func renderTop(w io.Writer, snapshot topSnapshot, now time.Time, window string, color bool) error {
+	fmt.Fprintf(w, "cronmgr top - %s - %d running, %d failed in the last %s\n\nRUNNING\n",
+		now.Format(time.DateTime), len(snapshot.running), len(snapshot.failures), window)
+
+	running := newTable("JOB", "OWNER", "PID", "STARTED", "ELAPSED", "EXPECTED", "PROGRESS")
+	for _, job := range snapshot.running {
+		elapsed := now.Sub(job.state.StartTime)
+		expected, progress, rowColor := "-", "-", ""
+		if job.expected > 0 {
+			expected = formatDuration(job.expected)
+			progress = fmt.Sprintf("%d%%", int(100*elapsed/job.expected))
+			if elapsed > job.expected*2 {
+				progress += " OVERDUE"
+				rowColor = colorRed
+			} else if elapsed > job.expected {
+				rowColor = colorYellow
+			}
+		}
+		if job.timeoutSoon {
+			progress = strings.TrimPrefix(progress+" TIMEOUT", "- ")
+			rowColor = colorRed
+		}
+		running.add(rowColor, job.state.Name, orDash(job.state.Owner), strconv.Itoa(job.state.PID),
+			job.state.StartTime.Local().Format(time.DateTime), formatDuration(elapsed), expected, progress)
+	}
+	if err := running.write(w, color); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nRECENT FAILURES\n")
+	failures := newTable("JOB", "FINISHED", "ERROR", "EXIT", "DURATION", "RUN")
+	for _, record := range snapshot.failures {
+		failures.add(colorRed, record.Name, record.FinishTime.Local().Format(time.DateTime), record.ErrorType,
+			strconv.Itoa(record.ExitCode), formatDuration(secondsDuration(record.DurationSeconds)), orDash(record.RunID))
+	}
+	return failures.write(w, color)
+}
+
+// formatDuration formats d rounded to seconds
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+// secondsDuration converts a duration in seconds, as recorded in the run history
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+)
+
+// TestLoadTop tests collecting running jobs with their typical duration and recent failures
+func TestLoadTop(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	store := state.NewStore(fs, "/state")
+	journal := history.NewJournal(fs, "/state/history")
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	for _, runState := range []state.RunState{
+		{Name: "backup", PID: os.Getpid(), Running: true, StartTime: now.Add(-10 * time.Minute)},
+		{Name: "report", PID: os.Getpid(), Running: true, StartTime: now.Add(-time.Hour)},
+		{Name: "cleanup", PID: os.Getpid(), StartTime: now.Add(-time.Hour), FinishTime: now.Add(-50 * time.Minute)},
+		// The process of this run is gone, it is incomplete rather than running
+		{Name: "crashed", PID: 999999999, Running: true, StartTime: now.Add(-time.Hour)},
+	} {
+		if err := store.Save(runState); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	for _, record := range []history.Record{
+		{Name: "backup", StartTime: now.Add(-72 * time.Hour), Status: "success", DurationSeconds: 300},
+		{Name: "backup", StartTime: now.Add(-48 * time.Hour), Status: "failed", ErrorType: "job", ExitCode: 1},
+		{Name: "cleanup", StartTime: now.Add(-2 * time.Hour), Status: "failed", ErrorType: "timeout", ExitCode: -1},
+		{Name: "cleanup", StartTime: now.Add(-time.Hour), Status: "failed", ErrorType: "job", ExitCode: 2},
+	} {
+		if err := journal.Append(record); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	// report is about to reach its time limit
+	opts := []exporter.Option{exporter.WithFileSystem(fs), exporter.WithExporterDir("/metrics")}
+	exporter.NewExporter(opts...).WriteGauge("timeout_approaching", "report", "1", "Timeout approaching")
+	exporter.NewExporter(opts...).WriteGauge("timeout_approaching", "backup", "0", "Timeout approaching")
+
+	var warnings bytes.Buffer
+	snapshot, err := loadTop(store, journal, newJobMetrics(opts, &warnings), now, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("loadTop() error = %v", err)
+	}
+	var running []string
+	for _, job := range snapshot.running {
+		running = append(running, job.state.Name)
+	}
+	if got := strings.Join(running, ","); got != "report,backup" {
+		t.Errorf("running = %s, want report,backup", got)
+	}
+	if got := snapshot.running[1].expected; got != 5*time.Minute {
+		t.Errorf("expected duration of backup = %v, want 5m", got)
+	}
+	if got := snapshot.running[0].expected; got != 0 {
+		t.Errorf("expected duration of report = %v, want unknown", got)
+	}
+	if !snapshot.running[0].timeoutSoon || snapshot.running[1].timeoutSoon {
+		t.Errorf("timeoutSoon = %v, %v, want only report about to time out", snapshot.running[0].timeoutSoon, snapshot.running[1].timeoutSoon)
+	}
+	if warnings.Len() > 0 {
+		t.Errorf("unexpected warnings: %s", warnings.String())
+	}
+	if len(snapshot.failures) != 2 || snapshot.failures[0].ExitCode != 2 || snapshot.failures[1].ErrorType != "timeout" {
+		t.Errorf("failures = %+v, want the two cleanup failures, most recent first", snapshot.failures)
+	}
+}
+
+// TestRenderTop tests the progress against the typical duration and the failure list
+func TestRenderTop(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	snapshot := topSnapshot{
+		running: []topJob{
+			{state: state.RunState{Name: "report", PID: 42, StartTime: now.Add(-time.Hour)}, expected: 20 * time.Minute},
+			{state: state.RunState{Name: "backup", Owner: "team-a", PID: 43, StartTime: now.Add(-10 * time.Minute)}, expected: 20 * time.Minute},
+			{state: state.RunState{Name: "sync", PID: 44, StartTime: now.Add(-time.Minute)}},
+			{state: state.RunState{Name: "import", PID: 45, StartTime: now.Add(-time.Minute)}, timeoutSoon: true},
+		},
+		failures: []history.Record{
+			{Name: "cleanup", RunID: "20240110T110000Z-7", FinishTime: now.Add(-time.Hour), ErrorType: "job", ExitCode: 2, DurationSeconds: 61},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := renderTop(&buf, snapshot, now, "24h", false); err != nil {
+		t.Fatalf("renderTop() error = %v", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix: "cronmgr top", want: []string{"4 running", "1 failed in the last 24h"}},
+		{prefix: "report ", want: []string{"1h0m0s", "20m0s", "300% OVERDUE"}},
+		{prefix: "backup ", want: []string{"team-a", "10m0s", "50%"}},
+		{prefix: "sync ", want: []string{"1m0s", "-"}},
+		{prefix: "import ", want: []string{"1m0s", " TIMEOUT"}},
+		{prefix: "cleanup ", want: []string{"job", "2", "1m1s", "20240110T110000Z-7"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			for _, line := range lines {
+				if !strings.HasPrefix(line, tt.prefix) {
+					continue
+				}
+				for _, want := range tt.want {
+					if !strings.Contains(line, want) {
+						t.Errorf("line %q does not contain %q", line, want)
+					}
+				}
+				return
+			}
+			t.Errorf("no line starting with %q in:\n%s", tt.prefix, buf.String())
+		})
+	}
+	if strings.Contains(buf.String(), "50% OVERDUE") {
+		t.Errorf("job within its typical duration shown overdue:\n%s", buf.String())
+	}
+}
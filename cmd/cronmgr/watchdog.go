@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/watchdog"
+	"github.com/spf13/pflag"
+)
+
+// helpWrapperCrashed is the HELP text of the wrapper_crashed metric
+const helpWrapperCrashed = "Whether the cronmgr process running the job died unexpectedly, e.g. panic or OOM kill (1 = crashed)"
+
+// watchdogArgs returns the arguments starting the watchdog of the job name
+func watchdogArgs(name, notify string, exporterFlags *exporterFlags) []string {
+	args := append([]string{"watchdog", "--name", name}, exporterFlags.args()...)
+	if notify != "" {
+		args = append(args, "--notify", notify)
+	}
+	return args
+}
+
+// runWatchdog watches the cronmgr process that started it through standard input, see watchdog.Start
+func runWatchdog(args []string) int {
+	flags := pflag.NewFlagSet("watchdog", pflag.ContinueOnError)
+	flags.SortFlags = false
+	name := flags.StringP("name", "n", "", "Job name (required)")
+	exporterFlags := addExporterFlags(flags)
+	notify := flags.String("notify", "", "Shell command run if cronmgr crashed, with the job name in CRONMGR_JOB_NAME")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: cronmgr watchdog --name <jobname> [options]
+
+Started by cronmgr --watchdog, not meant to be run directly. Reports the crash of the cronmgr
+process connected to its standard input.
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *name == "" {
+		fmt.Fprintf(os.Stderr, "Error: --name is required\n\n")
+		flags.Usage()
+		return 1
+	}
+	exporterOpts, err := exporterFlags.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flags.Usage()
+		return 1
+	}
+
+	crashed := watchdog.Watch(os.Stdin)
+	exp := exporter.NewExporter(exporterOpts...)
+	if err := reportWatchdog(exp, *name, crashed, *notify); err != nil {
+		log.Printf("Failed to notify the crash of job %s: %v", *name, err)
+		return 1
+	}
+	if exp.Err() != nil {
+		return 1
+	}
+	return 0
+}
+
+// reportWatchdog writes the wrapper_crashed metric of the job name and runs the notify command if cronmgr crashed
+func reportWatchdog(exp *exporter.Exporter, name string, crashed bool, notify string) error {
+	if !crashed {
+		exp.WriteGauge("wrapper_crashed", name, "0", helpWrapperCrashed)
+		return nil
+	}
+	log.Printf("cronmgr running job %s died unexpectedly", name)
+	exp.WriteGauge("wrapper_crashed", name, "1", helpWrapperCrashed)
+	if notify == "" {
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", notify)
+	cmd.Env = append(os.Environ(), "CRONMGR_JOB_NAME="+name)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/spf13/afero"
+	"github.com/spf13/pflag"
+)
+
+// TestWatchdogArgs tests that the watchdog is configured with the exporter flags of the job
+func TestWatchdogArgs(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	parsed := addExporterFlags(flags)
+	if err := flags.Parse([]string{"--dir", "/metrics", "--metric", "cron", "--owner", "team-a", "--metric-chmod", "0640", "--label", "env=prod,dc=eu", "--lock-backend", "fcntl", "--lock-dir", "/run/cronmgr", "--lock-mode", "0666", "--textfile-shards", "8"}); err != nil {
+		t.Fatal(err)
+	}
+
+	args := watchdogArgs("backup", "notify-ops", parsed)
+	if !slices.Equal(args[:3], []string{"watchdog", "--name", "backup"}) || !slices.Equal(args[len(args)-2:], []string{"--notify", "notify-ops"}) {
+		t.Fatalf("watchdogArgs() = %q", args)
+	}
+
+	child := pflag.NewFlagSet("watchdog", pflag.ContinueOnError)
+	reparsed := addExporterFlags(child)
+	if err := child.Parse(args[3 : len(args)-2]); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if *reparsed.dir != "/metrics" || *reparsed.textfile != "crons.prom" || *reparsed.metric != "cron" ||
+		*reparsed.noMetric || *reparsed.owner != "team-a" || *reparsed.chmod != "0640" ||
+		!maps.Equal(*reparsed.labels, map[string]string{"env": "prod", "dc": "eu"}) ||
+		*reparsed.lock != "fcntl" || *reparsed.lockDir != "/run/cronmgr" || *reparsed.lockMode != "0666" || *reparsed.shards != 8 {
+		t.Errorf("watchdog exporter flags differ from the job: %q", args)
+	}
+}
+
+// TestReportWatchdog tests the wrapper_crashed metric and the notify command
+func TestReportWatchdog(t *testing.T) {
+	tests := []struct {
+		name       string
+		crashed    bool
+		want       string
+		wantNotify bool
+	}{
+		{name: "finished", crashed: false, want: `crontab_wrapper_crashed{name="backup"} 0`},
+		{name: "crashed", crashed: true, want: `crontab_wrapper_crashed{name="backup"} 1`, wantNotify: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memFs := afero.NewMemMapFs()
+			exp := exporter.NewExporter(exporter.WithFileSystem(memFs), exporter.WithExporterDir("/metrics"))
+			notified := filepath.Join(t.TempDir(), "notified")
+
+			if err := reportWatchdog(exp, "backup", tt.crashed, `echo "$CRONMGR_JOB_NAME" > `+notified); err != nil {
+				t.Fatalf("reportWatchdog() error = %v", err)
+			}
+
+			content, err := afero.ReadFile(memFs, "/metrics/crons.prom")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(content), tt.want) {
+				t.Errorf("metrics = %q, want it to contain %q", content, tt.want)
+			}
+			got, err := os.ReadFile(notified)
+			if tt.wantNotify && (err != nil || string(got) != "backup\n") {
+				t.Errorf("notify command output = %q, %v, want the job name", got, err)
+			}
+			if !tt.wantNotify && err == nil {
+				t.Errorf("notify command ran although cronmgr finished normally")
+			}
+		})
+	}
+}
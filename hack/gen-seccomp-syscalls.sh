@@ -0,0 +1,30 @@
+#!/usr/bin/env bash
+# Generates the syscall tables of internal/seccomp for the Linux release architectures, from the
+# syscall numbers of golang.org/x/sys vendored by the Go toolchain.
+#
+# Usage: hack/gen-seccomp-syscalls.sh
+
+# cd root of the repo
+pushd "$(dirname "$0")/.." > /dev/null
+set -e
+
+sysnum_dir="$(go env GOROOT)/src/cmd/vendor/golang.org/x/sys/unix"
+x_sys_version=$(awk '$2 == "golang.org/x/sys" { print $3 }' "$(go env GOROOT)/src/cmd/vendor/modules.txt")
+
+for arch in amd64 arm64 arm; do
+  out="internal/seccomp/syscalls_linux_${arch}.go"
+  {
+    echo "// Code generated by hack/gen-seccomp-syscalls.sh from golang.org/x/sys ${x_sys_version}. DO NOT EDIT."
+    echo
+    echo "package seccomp"
+    echo
+    echo "// syscalls maps the syscall names of linux/${arch} to their number"
+    echo "var syscalls = map[string]uint32{"
+    awk '/^\tSYS_[A-Z0-9_]+ += [0-9]+$/ { name = tolower(substr($1, 5)); printf "\t\"%s\": %s,\n", name, $3 }' \
+      "${sysnum_dir}/zsysnum_linux_${arch}.go"
+    echo "}"
+  } > "${out}"
+  gofmt -w "${out}"
+done
+
+popd > /dev/null
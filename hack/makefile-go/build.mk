@@ -39,12 +39,10 @@ build: ## Build
 	@for target in $(TARGETS); do                                                                              \
 	  GOOS=$(GOOS) GOARCH=$(GOARCH) go build -v -o $(OUTPUT_DIR)/$${target}-$(GOOS)-$(GOARCH)                  \
 	    -ldflags "-s -w                                                                                        \
-	    -X $(ROOT)/pkg/version.Version=$(VERSION)                                                              \
-	    -X $(ROOT)/pkg/version.Commit=$(COMMIT)                                                                \
-	    -X $(ROOT)/pkg/version.Package=$(ROOT)                                                                 \
 	    -X $(ROOT)/internal/version.Version=$(VERSION)                                                         \
 	    -X $(ROOT)/internal/version.Commit=$(COMMIT)                                                           \
-	    -X $(ROOT)/internal/version.Package=$(ROOT)"                                                           \
+	    -X $(ROOT)/internal/version.Package=$(ROOT)                                                            \
+	    -X $(ROOT)/internal/version.BuildDate=$(BUILD_DATE)"                                                   \
 	    $(CMD_DIR)/$${target};                                                                                 \
 	  cp $(OUTPUT_DIR)/$${target}-$(GOOS)-$(GOARCH) $(OUTPUT_DIR)/$${target};                                  \
 	  cp $(OUTPUT_DIR)/$${target}-$(GOOS)-$(GOARCH) $(OUTPUT_DIR)/$${target}-$(GOOS)-$(GOARCH)-$(VERSION);     \
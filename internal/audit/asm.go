@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// eBPF instruction classes, sizes, modes and operations, see the kernel's Documentation/bpf/standardization
+const (
+	classLD    = 0x00
+	classLDX   = 0x01
+	classST    = 0x02
+	classSTX   = 0x03
+	classJMP   = 0x05
+	classALU64 = 0x07
+
+	sizeW  = 0x00
+	sizeB  = 0x10
+	sizeDW = 0x18
+
+	modeIMM    = 0x00
+	modeMEM    = 0x60
+	modeATOMIC = 0xc0
+
+	srcK = 0x00
+	srcX = 0x08
+
+	aluADD = 0x00
+	aluRSH = 0x70
+	aluMOV = 0xb0
+
+	jmpJA   = 0x00
+	jmpJEQ  = 0x10
+	jmpJNE  = 0x50
+	jmpJLE  = 0xb0
+	jmpCALL = 0x80
+	jmpEXIT = 0x90
+
+	// pseudoMapFD marks the immediate of a 64-bit load as the file descriptor of a map
+	pseudoMapFD = 1
+)
+
+// Registers: r0 holds return values, r1-r5 the arguments of calls and r6-r9 are preserved across calls.
+// r10 is the read-only frame pointer.
+const (
+	r0 = iota
+	r1
+	r2
+	r3
+	r4
+	r5
+	r6
+	r7
+	r8
+	r9
+	r10
+)
+
+// Helper functions called by the programs
+const (
+	helperMapLookupElem     = 1
+	helperMapUpdateElem     = 2
+	helperMapDeleteElem     = 3
+	helperGetCurrentPIDTGID = 14
+	helperProbeReadUser     = 112
+	helperProbeReadUserStr  = 114
+	helperRingbufReserve    = 131
+	helperRingbufSubmit     = 132
+)
+
+// instruction is an eBPF instruction, a jump may target a label resolved by assemble
+type instruction struct {
+	code     uint8
+	dst, src uint8
+	off      int16
+	imm      int32
+	// label is the label a jump targets, empty for other instructions
+	label string
+}
+
+// asm builds an eBPF program
+type asm struct {
+	insns  []instruction
+	labels map[string]int
+}
+
+// emit appends insn
+func (a *asm) emit(insn instruction) {
+	a.insns = append(a.insns, insn)
+}
+
+// mark defines the label name at the next instruction
+func (a *asm) mark(name string) {
+	if a.labels == nil {
+		a.labels = map[string]int{}
+	}
+	a.labels[name] = len(a.insns)
+}
+
+// movReg emits dst = src
+func (a *asm) movReg(dst, src uint8) {
+	a.emit(instruction{code: classALU64 | aluMOV | srcX, dst: dst, src: src})
+}
+
+// movImm emits dst = imm
+func (a *asm) movImm(dst uint8, imm int32) {
+	a.emit(instruction{code: classALU64 | aluMOV | srcK, dst: dst, imm: imm})
+}
+
+// addImm emits dst += imm
+func (a *asm) addImm(dst uint8, imm int32) {
+	a.emit(instruction{code: classALU64 | aluADD | srcK, dst: dst, imm: imm})
+}
+
+// rshImm emits dst >>= imm
+func (a *asm) rshImm(dst uint8, imm int32) {
+	a.emit(instruction{code: classALU64 | aluRSH | srcK, dst: dst, imm: imm})
+}
+
+// loadMap emits dst = the map of the file descriptor fd, a 64-bit load taking two instructions
+func (a *asm) loadMap(dst uint8, fd int) {
+	a.emit(instruction{code: classLD | sizeDW | modeIMM, dst: dst, src: pseudoMapFD, imm: int32(fd)})
+	a.emit(instruction{})
+}
+
+// load emits dst = *(size *)(src + off)
+func (a *asm) load(size uint8, dst, src uint8, off int16) {
+	a.emit(instruction{code: classLDX | size | modeMEM, dst: dst, src: src, off: off})
+}
+
+// store emits *(size *)(dst + off) = src
+func (a *asm) store(size uint8, dst, src uint8, off int16) {
+	a.emit(instruction{code: classSTX | size | modeMEM, dst: dst, src: src, off: off})
+}
+
+// storeImm emits *(size *)(dst + off) = imm
+func (a *asm) storeImm(size uint8, dst uint8, off int16, imm int32) {
+	a.emit(instruction{code: classST | size | modeMEM, dst: dst, off: off, imm: imm})
+}
+
+// atomicAdd emits lock *(u64 *)(dst + off) += src
+func (a *asm) atomicAdd(dst, src uint8, off int16) {
+	a.emit(instruction{code: classSTX | sizeDW | modeATOMIC, dst: dst, src: src, off: off, imm: aluADD})
+}
+
+// jumpImm emits if dst op imm goto label
+func (a *asm) jumpImm(op uint8, dst uint8, imm int32, label string) {
+	a.emit(instruction{code: classJMP | op | srcK, dst: dst, imm: imm, label: label})
+}
+
+// jump emits goto label
+func (a *asm) jump(label string) {
+	a.emit(instruction{code: classJMP | jmpJA, label: label})
+}
+
+// call emits a call of the helper function
+func (a *asm) call(helper int32) {
+	a.emit(instruction{code: classJMP | jmpCALL, imm: helper})
+}
+
+// exit emits a return with r0
+func (a *asm) exit() {
+	a.emit(instruction{code: classJMP | jmpEXIT})
+}
+
+// assemble resolves the labels and encodes the program
+func (a *asm) assemble() ([]byte, error) {
+	code := make([]byte, 0, 8*len(a.insns))
+	for pc, insn := range a.insns {
+		if insn.label != "" {
+			target, ok := a.labels[insn.label]
+			if !ok {
+				return nil, fmt.Errorf("undefined label %s", insn.label)
+			}
+			insn.off = int16(target - pc - 1)
+		}
+		code = append(code, insn.code, insn.dst|insn.src<<4)
+		code = binary.LittleEndian.AppendUint16(code, uint16(insn.off))
+		code = binary.LittleEndian.AppendUint32(code, uint32(insn.imm))
+	}
+	return code, nil
+}
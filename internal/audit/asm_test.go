@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestAssemble tests encoding instructions and resolving labels
+func TestAssemble(t *testing.T) {
+	var a asm
+	a.movImm(r0, 0)
+	a.loadMap(r1, 7)
+	a.jumpImm(jmpJEQ, r1, 0, "out")
+	a.store(sizeW, r10, r1, -4)
+	a.mark("out")
+	a.exit()
+	got, err := a.assemble()
+	if err != nil {
+		t.Fatalf("assemble() error = %v", err)
+	}
+	want := []byte{
+		0xb7, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x18, 0x11, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x15, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x63, 0x1a, 0xfc, 0xff, 0x00, 0x00, 0x00, 0x00,
+		0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("assemble() = % x, want % x", got, want)
+	}
+
+	var undefined asm
+	undefined.jump("missing")
+	if _, err := undefined.assemble(); err == nil {
+		t.Error("assemble() error = nil, want an error for an undefined label")
+	}
+}
+
+// TestPrograms tests that all the programs assemble
+func TestPrograms(t *testing.T) {
+	m := maps{tracked: 3, events: 4, drops: 5}
+	for name, build := range map[string]func() ([]byte, error){
+		"path":    func() ([]byte, error) { return pathProgram(m, kindOpen, 24, 32) },
+		"exec":    func() ([]byte, error) { return pathProgram(m, kindExec, 16, -1) },
+		"connect": func() ([]byte, error) { return connectProgram(m, 24, 32) },
+		"fork":    func() ([]byte, error) { return forkProgram(m, 20) },
+		"exit":    func() ([]byte, error) { return exitProgram(m) },
+	} {
+		code, err := build()
+		if err != nil || len(code) == 0 || len(code)%8 != 0 {
+			t.Errorf("%s program = %d bytes, %v", name, len(code), err)
+		}
+	}
+}
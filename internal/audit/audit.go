@@ -0,0 +1,264 @@
+package audit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxEntries bounds the different executables, files and connections kept in a summary, further ones are
+// only counted
+const MaxEntries = 10000
+
+// Flags of open(2) which make an open a write, the same on all the supported architectures
+const (
+	openWriteOnly = 0x1
+	openReadWrite = 0x2
+	openCreate    = 0x40
+	openTruncate  = 0x200
+	openAppend    = 0x400
+	openWrite     = openWriteOnly | openReadWrite | openCreate | openTruncate | openAppend
+)
+
+// Socket address families
+const (
+	afUnix  = 1
+	afInet  = 2
+	afInet6 = 10
+)
+
+// Summary is what the processes of a job did during a run
+type Summary struct {
+	Name       string    `json:"name,omitempty"`
+	RunID      string    `json:"run_id,omitempty"`
+	StartTime  time.Time `json:"start_time"`
+	FinishTime time.Time `json:"finish_time"`
+	// Execs are the executed programs
+	Execs []Exec `json:"execs"`
+	// Files are the opened files
+	Files []File `json:"files"`
+	// Connections are the addresses connected to
+	Connections []Connection `json:"connections"`
+	// Omitted counts the entries left out beyond MaxEntries
+	Omitted int `json:"omitted,omitempty"`
+	// LostEvents counts the events lost because they came faster than they were read
+	LostEvents uint64 `json:"lost_events,omitempty"`
+}
+
+// Exec is a program executed during a run
+type Exec struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+// File is a file opened during a run
+type File struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+	// Write is set if the file was opened for writing at least once
+	Write bool `json:"write,omitempty"`
+}
+
+// Connection is an address connected to during a run, ip:port or the path of a unix socket
+type Connection struct {
+	Address string `json:"address"`
+	Count   int    `json:"count"`
+}
+
+// WriteFile writes the summary as indented JSON to path, creating its directory
+func (s *Summary) WriteFile(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// collector aggregates the records sent by the programs into a summary
+type collector struct {
+	execs       map[string]*Exec
+	files       map[string]*File
+	connections map[string]*Connection
+	omitted     int
+}
+
+// newCollector returns an empty collector
+func newCollector() *collector {
+	return &collector{
+		execs:       make(map[string]*Exec),
+		files:       make(map[string]*File),
+		connections: make(map[string]*Connection),
+	}
+}
+
+// add aggregates a record, ignoring those which are malformed or whose data could not be read
+func (c *collector) add(record []byte) {
+	if len(record) < recordSize {
+		return
+	}
+	kind := binary.LittleEndian.Uint32(record[0:])
+	length := int32(binary.LittleEndian.Uint32(record[8:]))
+	flags := binary.LittleEndian.Uint32(record[12:])
+	data := record[recordDataOffset:recordSize]
+	if length <= 0 || int(length) > len(data) {
+		return
+	}
+	switch kind {
+	case kindOpen:
+		path := cString(data)
+		if path == "" {
+			return
+		}
+		f, ok := c.files[path]
+		if !ok {
+			if !c.room(len(c.files)) {
+				return
+			}
+			f = &File{Path: path}
+			c.files[path] = f
+		}
+		f.Count++
+		f.Write = f.Write || flags&openWrite != 0
+	case kindExec:
+		path := cString(data)
+		if path == "" {
+			return
+		}
+		e, ok := c.execs[path]
+		if !ok {
+			if !c.room(len(c.execs)) {
+				return
+			}
+			e = &Exec{Path: path}
+			c.execs[path] = e
+		}
+		e.Count++
+	case kindConnect:
+		address := sockaddr(data[:length])
+		if address == "" {
+			return
+		}
+		conn, ok := c.connections[address]
+		if !ok {
+			if !c.room(len(c.connections)) {
+				return
+			}
+			conn = &Connection{Address: address}
+			c.connections[address] = conn
+		}
+		conn.Count++
+	}
+}
+
+// room reports whether a new entry can be kept besides the n ones, counting it as omitted if not
+func (c *collector) room(n int) bool {
+	if n >= MaxEntries {
+		c.omitted++
+		return false
+	}
+	return true
+}
+
+// summary returns the aggregated records sorted by path and address
+func (c *collector) summary() *Summary {
+	s := &Summary{Execs: []Exec{}, Files: []File{}, Connections: []Connection{}, Omitted: c.omitted}
+	for _, e := range c.execs {
+		s.Execs = append(s.Execs, *e)
+	}
+	for _, f := range c.files {
+		s.Files = append(s.Files, *f)
+	}
+	for _, conn := range c.connections {
+		s.Connections = append(s.Connections, *conn)
+	}
+	slices.SortFunc(s.Execs, func(a, b Exec) int { return strings.Compare(a.Path, b.Path) })
+	slices.SortFunc(s.Files, func(a, b File) int { return strings.Compare(a.Path, b.Path) })
+	slices.SortFunc(s.Connections, func(a, b Connection) int { return strings.Compare(a.Address, b.Address) })
+	return s
+}
+
+// cString returns the NUL terminated string at the start of b
+func cString(b []byte) string {
+	if i := slices.Index(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// sockaddr formats a socket address as ip:port, or the path of a unix socket with abstract ones prefixed
+// by @. Other families, e.g. AF_UNSPEC used to disconnect a datagram socket, return "".
+func sockaddr(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	switch binary.LittleEndian.Uint16(b) {
+	case afInet:
+		if len(b) < 8 {
+			return ""
+		}
+		port := binary.BigEndian.Uint16(b[2:])
+		return net.JoinHostPort(net.IP(b[4:8]).String(), strconv.Itoa(int(port)))
+	case afInet6:
+		if len(b) < 24 {
+			return ""
+		}
+		port := binary.BigEndian.Uint16(b[2:])
+		return net.JoinHostPort(net.IP(b[8:24]).String(), strconv.Itoa(int(port)))
+	case afUnix:
+		path := b[2:]
+		if len(path) > 0 && path[0] == 0 {
+			name := strings.TrimRight(string(path[1:]), "\x00")
+			if name == "" {
+				return ""
+			}
+			return "@" + name
+		}
+		return cString(path)
+	}
+	return ""
+}
+
+// parseFormat returns the offsets of the fields of a tracepoint from its format file
+func parseFormat(format string) map[string]int16 {
+	offsets := make(map[string]int16)
+	for _, line := range strings.Split(format, "\n") {
+		var name string
+		offset := -1
+		for _, part := range strings.Split(line, ";") {
+			part = strings.TrimSpace(part)
+			if decl, ok := strings.CutPrefix(part, "field:"); ok {
+				fields := strings.Fields(decl)
+				if len(fields) > 0 {
+					name, _, _ = strings.Cut(fields[len(fields)-1], "[")
+				}
+			} else if value, ok := strings.CutPrefix(part, "offset:"); ok {
+				if n, err := strconv.Atoi(value); err == nil {
+					offset = n
+				}
+			}
+		}
+		if name != "" && offset >= 0 {
+			offsets[name] = int16(offset)
+		}
+	}
+	return offsets
+}
+
+// field returns the offset of the field name of a tracepoint parsed by parseFormat
+func field(offsets map[string]int16, tracepoint, name string) (int16, error) {
+	offset, ok := offsets[name]
+	if !ok {
+		return 0, fmt.Errorf("tracepoint %s has no field %s", tracepoint, name)
+	}
+	return offset, nil
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// record returns a record of kind with data, whose length is that of data plus its NUL
+func record(kind uint32, flags uint32, data []byte, length int32) []byte {
+	b := make([]byte, recordSize)
+	binary.LittleEndian.PutUint32(b[0:], kind)
+	binary.LittleEndian.PutUint32(b[4:], 42)
+	binary.LittleEndian.PutUint32(b[8:], uint32(length))
+	binary.LittleEndian.PutUint32(b[12:], flags)
+	copy(b[recordDataOffset:], data)
+	return b
+}
+
+// path returns a record of kind for a path
+func path(kind uint32, flags uint32, p string) []byte {
+	return record(kind, flags, []byte(p), int32(len(p)+1))
+}
+
+// TestCollector tests aggregating records into a summary
+func TestCollector(t *testing.T) {
+	inet := []byte{2, 0, 0x01, 0xbb, 10, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+	c := newCollector()
+	for _, r := range [][]byte{
+		path(kindExec, 0, "/usr/bin/rsync"),
+		path(kindExec, 0, "/bin/sh"),
+		path(kindExec, 0, "/usr/bin/rsync"),
+		path(kindOpen, 0, "/etc/hosts"),
+		path(kindOpen, openWriteOnly|openCreate, "/var/backup/db.tar"),
+		path(kindOpen, 0, "/var/backup/db.tar"),
+		record(kindConnect, 0, inet, int32(len(inet))),
+		record(kindConnect, 0, inet, int32(len(inet))),
+		// The path could not be read
+		record(kindOpen, 0, nil, -14),
+		// Truncated
+		path(kindOpen, 0, "/etc/passwd")[:recordSize-1],
+		path(99, 0, "/unknown"),
+	} {
+		c.add(r)
+	}
+	want := &Summary{
+		Execs: []Exec{{Path: "/bin/sh", Count: 1}, {Path: "/usr/bin/rsync", Count: 2}},
+		Files: []File{
+			{Path: "/etc/hosts", Count: 1},
+			{Path: "/var/backup/db.tar", Count: 2, Write: true},
+		},
+		Connections: []Connection{{Address: "10.0.0.1:443", Count: 2}},
+	}
+	if got := c.summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("summary() = %+v, want %+v", got, want)
+	}
+}
+
+// TestCollectorOmitted tests counting the entries beyond MaxEntries
+func TestCollectorOmitted(t *testing.T) {
+	c := newCollector()
+	for i := 0; i < MaxEntries+3; i++ {
+		c.add(path(kindOpen, 0, fmt.Sprintf("/tmp/%d", i)))
+	}
+	// Kept entries are still counted
+	c.add(path(kindOpen, 0, "/tmp/0"))
+	s := c.summary()
+	if len(s.Files) != MaxEntries || s.Omitted != 3 || s.Files[0].Count != 2 {
+		t.Errorf("summary() = %d files, %d omitted, want %d files, 3 omitted", len(s.Files), s.Omitted, MaxEntries)
+	}
+}
+
+// TestSockaddr tests formatting socket addresses
+func TestSockaddr(t *testing.T) {
+	inet6 := make([]byte, 28)
+	inet6[0] = afInet6
+	binary.BigEndian.PutUint16(inet6[2:], 5432)
+	inet6[8], inet6[9], inet6[23] = 0x20, 0x01, 0x01
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"inet", []byte{2, 0, 0x00, 0x50, 192, 168, 1, 10, 0, 0, 0, 0, 0, 0, 0, 0}, "192.168.1.10:80"},
+		{"inet6", inet6, "[2001::1]:5432"},
+		{"unix", append([]byte{1, 0}, "/run/docker.sock\x00"...), "/run/docker.sock"},
+		{"abstract unix", append([]byte{1, 0, 0}, "dbus\x00\x00"...), "@dbus"},
+		{"unnamed unix", []byte{1, 0}, ""},
+		{"unspec", []byte{0, 0, 0, 0}, ""},
+		{"short inet", []byte{2, 0, 0, 80}, ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sockaddr(tt.b); got != tt.want {
+				t.Errorf("sockaddr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseFormat tests reading the offsets of the fields of a tracepoint
+func TestParseFormat(t *testing.T) {
+	format := `name: sys_enter_openat
+ID: 700
+format:
+	field:unsigned short common_type;	offset:0;	size:2;	signed:0;
+	field:int __syscall_nr;	offset:8;	size:4;	signed:1;
+	field:const char * filename;	offset:24;	size:8;	signed:0;
+	field:int flags;	offset:32;	size:8;	signed:0;
+	field:char comm[16];	offset:40;	size:16;	signed:0;
+
+print fmt: "dfd: 0x%08lx", ((unsigned long)(REC->dfd))
+`
+	offsets := parseFormat(format)
+	for name, want := range map[string]int16{"common_type": 0, "filename": 24, "flags": 32, "comm": 40} {
+		if got, err := field(offsets, "sys_enter_openat", name); err != nil || got != want {
+			t.Errorf("field(%s) = %d, %v, want %d", name, got, err, want)
+		}
+	}
+	if _, err := field(offsets, "sys_enter_openat", "mode"); err == nil {
+		t.Error("field(mode) error = nil, want an error")
+	}
+}
@@ -0,0 +1,168 @@
+package audit
+
+// Kinds of the records sent by the programs
+const (
+	kindOpen    = 1
+	kindExec    = 2
+	kindConnect = 3
+)
+
+// Layout of a record: kind, tgid, length and flags as u32, followed by the path or socket address
+const (
+	recordDataOffset = 16
+	recordDataSize   = 256
+	recordSize       = recordDataOffset + recordDataSize
+	// maxSockaddr is the size of the largest socket address read, sockaddr_un is 110 bytes
+	maxSockaddr = 128
+)
+
+// Values of the tracked map: the processes of tracked descendants are reported, the tracer itself only followed
+const (
+	trackedFollow = 1
+	trackedReport = 2
+)
+
+// maps are the file descriptors of the maps shared by the programs
+type maps struct {
+	// tracked holds the IDs of the followed processes and threads
+	tracked int
+	// events is the ring buffer the records are sent to
+	events int
+	// drops counts the records lost when the ring buffer was full
+	drops int
+}
+
+// reportPrologue emits the start of a program reporting a record of kind: it returns unless the current
+// process is a reported one, and reserves a record in r8. The tracepoint context is kept in r6, the tgid in r7.
+func reportPrologue(a *asm, m maps, kind int32) {
+	a.movReg(r6, r1)
+	a.call(helperGetCurrentPIDTGID)
+	a.movReg(r7, r0)
+	a.rshImm(r7, 32)
+	a.store(sizeW, r10, r7, -4)
+	a.loadMap(r1, m.tracked)
+	a.movReg(r2, r10)
+	a.addImm(r2, -4)
+	a.call(helperMapLookupElem)
+	a.jumpImm(jmpJEQ, r0, 0, "out")
+	a.load(sizeW, r1, r0, 0)
+	a.jumpImm(jmpJNE, r1, trackedReport, "out")
+
+	a.loadMap(r1, m.events)
+	a.movImm(r2, recordSize)
+	a.movImm(r3, 0)
+	a.call(helperRingbufReserve)
+	a.jumpImm(jmpJEQ, r0, 0, "drop")
+	a.movReg(r8, r0)
+	a.storeImm(sizeW, r8, 0, kind)
+	a.store(sizeW, r8, r7, 4)
+}
+
+// reportEpilogue emits the end of a program started by reportPrologue: it submits the record, or counts
+// it as dropped if none could be reserved
+func reportEpilogue(a *asm, m maps) {
+	a.movReg(r1, r8)
+	a.movImm(r2, 0)
+	a.call(helperRingbufSubmit)
+	a.jump("out")
+
+	a.mark("drop")
+	a.storeImm(sizeW, r10, -8, 0)
+	a.loadMap(r1, m.drops)
+	a.movReg(r2, r10)
+	a.addImm(r2, -8)
+	a.call(helperMapLookupElem)
+	a.jumpImm(jmpJEQ, r0, 0, "out")
+	a.movImm(r1, 1)
+	a.atomicAdd(r0, r1, 0)
+
+	a.mark("out")
+	a.movImm(r0, 0)
+	a.exit()
+}
+
+// pathProgram reports the path at the user pointer pathOffset of a syscall tracepoint, with the flags at
+// flagsOffset if it is not negative, e.g. for openat and execve
+func pathProgram(m maps, kind int32, pathOffset, flagsOffset int16) ([]byte, error) {
+	var a asm
+	reportPrologue(&a, m, kind)
+	a.movReg(r1, r8)
+	a.addImm(r1, recordDataOffset)
+	a.movImm(r2, recordDataSize)
+	a.load(sizeDW, r3, r6, pathOffset)
+	a.call(helperProbeReadUserStr)
+	a.store(sizeW, r8, r0, 8)
+	if flagsOffset >= 0 {
+		a.load(sizeW, r1, r6, flagsOffset)
+		a.store(sizeW, r8, r1, 12)
+	} else {
+		a.storeImm(sizeW, r8, 12, 0)
+	}
+	reportEpilogue(&a, m)
+	return a.assemble()
+}
+
+// connectProgram reports the socket address at the user pointer addrOffset of the connect tracepoint,
+// of the length at lenOffset
+func connectProgram(m maps, addrOffset, lenOffset int16) ([]byte, error) {
+	var a asm
+	reportPrologue(&a, m, kindConnect)
+	a.load(sizeDW, r3, r6, addrOffset)
+	a.load(sizeW, r2, r6, lenOffset)
+	a.jumpImm(jmpJLE, r2, maxSockaddr, "read")
+	a.movImm(r2, maxSockaddr)
+	a.mark("read")
+	a.store(sizeW, r8, r2, 8)
+	a.storeImm(sizeW, r8, 12, 0)
+	a.movReg(r1, r8)
+	a.addImm(r1, recordDataOffset)
+	a.call(helperProbeReadUser)
+	reportEpilogue(&a, m)
+	return a.assemble()
+}
+
+// forkProgram follows the children of the followed processes from the sched_process_fork tracepoint, with
+// the pid of the child at childOffset. Children are reported, including those of the tracer itself.
+func forkProgram(m maps, childOffset int16) ([]byte, error) {
+	var a asm
+	a.movReg(r6, r1)
+	a.call(helperGetCurrentPIDTGID)
+	a.rshImm(r0, 32)
+	a.store(sizeW, r10, r0, -4)
+	a.loadMap(r1, m.tracked)
+	a.movReg(r2, r10)
+	a.addImm(r2, -4)
+	a.call(helperMapLookupElem)
+	a.jumpImm(jmpJEQ, r0, 0, "out")
+
+	a.load(sizeW, r1, r6, childOffset)
+	a.store(sizeW, r10, r1, -8)
+	a.storeImm(sizeW, r10, -12, trackedReport)
+	a.loadMap(r1, m.tracked)
+	a.movReg(r2, r10)
+	a.addImm(r2, -8)
+	a.movReg(r3, r10)
+	a.addImm(r3, -12)
+	a.movImm(r4, 0)
+	a.call(helperMapUpdateElem)
+
+	a.mark("out")
+	a.movImm(r0, 0)
+	a.exit()
+	return a.assemble()
+}
+
+// exitProgram stops following exited threads and processes from the sched_process_exit tracepoint,
+// so that the IDs of exited processes can be reused
+func exitProgram(m maps) ([]byte, error) {
+	var a asm
+	a.call(helperGetCurrentPIDTGID)
+	a.store(sizeW, r10, r0, -4)
+	a.loadMap(r1, m.tracked)
+	a.movReg(r2, r10)
+	a.addImm(r2, -4)
+	a.call(helperMapDeleteElem)
+	a.movImm(r0, 0)
+	a.exit()
+	return a.assemble()
+}
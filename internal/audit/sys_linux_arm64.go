@@ -0,0 +1,4 @@
+package audit
+
+// sysBPF is the number of bpf(2), missing from package syscall
+const sysBPF = 280
@@ -0,0 +1,455 @@
+//go:build linux && (amd64 || arm64)
+
+package audit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Commands of bpf(2)
+const (
+	bpfMapCreate     = 0
+	bpfMapLookupElem = 1
+	bpfMapUpdateElem = 2
+	bpfProgLoad      = 5
+)
+
+// Types of maps and programs
+const (
+	mapTypeHash        = 1
+	mapTypeArray       = 2
+	mapTypeRingbuf     = 27
+	progTypeTracepoint = 5
+)
+
+// perf_event_open(2) constants to attach a program to a tracepoint
+const (
+	perfTypeTracepoint = 2
+	perfSampleRaw      = 1 << 10
+	perfFlagFDCloexec  = 1 << 3
+	perfIocEnable      = 0x2400
+	perfIocSetBPF      = 0x40042408
+)
+
+// Ring buffer settings: its size, how often it is read, and the bits of the header of a record
+const (
+	ringSize      = 1 << 20
+	pollInterval  = 100 * time.Millisecond
+	ringBusy      = 1 << 31
+	ringDiscard   = 1 << 30
+	ringHeaderLen = 8
+)
+
+// maxTracked bounds the processes and threads followed at the same time
+const maxTracked = 16384
+
+// rlimitMemlock is RLIMIT_MEMLOCK, which bounds the memory of maps on kernels before 5.11
+const rlimitMemlock = 8
+
+// tracefsDirs are where tracefs is mounted, the older path being below debugfs
+var tracefsDirs = []string{"/sys/kernel/tracing", "/sys/kernel/debug/tracing"}
+
+// Tracer follows the processes started by cronmgr once it started, with eBPF programs attached to the
+// tracepoints of the syscalls opening files, executing programs and connecting sockets. The programs
+// run in the kernel and send the paths and addresses to a ring buffer read every 100ms.
+type Tracer struct {
+	maps      maps
+	progs     []int
+	events    []int
+	consumer  []byte
+	producer  []byte
+	collector *collector
+	summary   *Summary
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// mapCreateAttr is the bpf_attr of BPF_MAP_CREATE
+type mapCreateAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	mapFlags   uint32
+}
+
+// mapElemAttr is the bpf_attr of BPF_MAP_*_ELEM
+type mapElemAttr struct {
+	mapFd uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+// progLoadAttr is the bpf_attr of BPF_PROG_LOAD
+type progLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+	progName    [16]byte
+}
+
+// perfEventAttr is the perf_event_attr of perf_event_open(2), the fields after wakeup_events are left zero
+type perfEventAttr struct {
+	typ          uint32
+	size         uint32
+	config       uint64
+	samplePeriod uint64
+	sampleType   uint64
+	readFormat   uint64
+	bits         uint64
+	wakeupEvents uint32
+	bpType       uint32
+	_            [64]byte
+}
+
+// program is a program to attach to a tracepoint, optional ones are skipped if the kernel lacks them
+type program struct {
+	tracepoint string
+	optional   bool
+	build      func(offsets map[string]int16) ([]byte, error)
+}
+
+// Start starts following the processes started from now on. It needs root, or CAP_BPF and CAP_PERFMON,
+// and Linux 5.8 or later.
+func Start() (*Tracer, error) {
+	tracefs, err := findTracefs()
+	if err != nil {
+		return nil, err
+	}
+	raiseMemlock()
+	t := &Tracer{collector: newCollector(), stop: make(chan struct{}), done: make(chan struct{})}
+	if err := t.start(tracefs); err != nil {
+		t.close()
+		return nil, err
+	}
+	go t.poll()
+	return t, nil
+}
+
+// start creates the maps, loads and attaches the programs and maps the ring buffer
+func (t *Tracer) start(tracefs string) error {
+	t.maps = maps{tracked: -1, events: -1, drops: -1}
+	var err error
+	if t.maps.tracked, err = createMap(mapTypeHash, 4, 4, maxTracked); err != nil {
+		return fmt.Errorf("failed to create the map of processes: %w", err)
+	}
+	if t.maps.events, err = createMap(mapTypeRingbuf, 0, 0, ringSize); err != nil {
+		return fmt.Errorf("failed to create the ring buffer: %w", err)
+	}
+	if t.maps.drops, err = createMap(mapTypeArray, 4, 8, 1); err != nil {
+		return fmt.Errorf("failed to create the map of drops: %w", err)
+	}
+	// Processes are followed from cronmgr itself, which is not reported
+	if err := updateElem(t.maps.tracked, uint32(os.Getpid()), trackedFollow); err != nil {
+		return fmt.Errorf("failed to follow cronmgr: %w", err)
+	}
+
+	for _, p := range t.programs() {
+		dir := filepath.Join(tracefs, "events", p.tracepoint)
+		format, err := os.ReadFile(filepath.Join(dir, "format"))
+		if err != nil {
+			if p.optional && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to read tracepoint %s: %w", p.tracepoint, err)
+		}
+		id, err := os.ReadFile(filepath.Join(dir, "id"))
+		if err != nil {
+			return fmt.Errorf("failed to read tracepoint %s: %w", p.tracepoint, err)
+		}
+		tracepoint, err := strconv.ParseUint(strings.TrimSpace(string(id)), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id of tracepoint %s: %w", p.tracepoint, err)
+		}
+		code, err := p.build(parseFormat(string(format)))
+		if err != nil {
+			return fmt.Errorf("tracepoint %s: %w", p.tracepoint, err)
+		}
+		prog, err := loadProgram(code)
+		if err != nil {
+			return fmt.Errorf("failed to load the program of %s: %w", p.tracepoint, err)
+		}
+		t.progs = append(t.progs, prog)
+		event, err := attach(tracepoint, prog)
+		if err != nil {
+			return fmt.Errorf("failed to attach the program of %s: %w", p.tracepoint, err)
+		}
+		t.events = append(t.events, event)
+	}
+
+	pageSize := os.Getpagesize()
+	if t.consumer, err = syscall.Mmap(t.maps.events, 0, pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED); err != nil {
+		return fmt.Errorf("failed to map the ring buffer: %w", err)
+	}
+	// The data pages are mapped twice in a row, so that records wrapping around are contiguous
+	if t.producer, err = syscall.Mmap(t.maps.events, int64(pageSize), pageSize+2*ringSize, syscall.PROT_READ, syscall.MAP_SHARED); err != nil {
+		return fmt.Errorf("failed to map the ring buffer: %w", err)
+	}
+	return nil
+}
+
+// programs returns the programs to attach, the fork and exit ones first so that no child is missed
+func (t *Tracer) programs() []program {
+	m := t.maps
+	path := func(kind int32, tracepoint, name, flags string) func(map[string]int16) ([]byte, error) {
+		return func(offsets map[string]int16) ([]byte, error) {
+			pathOffset, err := field(offsets, tracepoint, name)
+			if err != nil {
+				return nil, err
+			}
+			flagsOffset := int16(-1)
+			if flags != "" {
+				if flagsOffset, err = field(offsets, tracepoint, flags); err != nil {
+					return nil, err
+				}
+			}
+			return pathProgram(m, kind, pathOffset, flagsOffset)
+		}
+	}
+	return []program{
+		{tracepoint: "sched/sched_process_fork", build: func(offsets map[string]int16) ([]byte, error) {
+			child, err := field(offsets, "sched_process_fork", "child_pid")
+			if err != nil {
+				return nil, err
+			}
+			return forkProgram(m, child)
+		}},
+		{tracepoint: "sched/sched_process_exit", build: func(map[string]int16) ([]byte, error) {
+			return exitProgram(m)
+		}},
+		{tracepoint: "syscalls/sys_enter_openat", build: path(kindOpen, "sys_enter_openat", "filename", "flags")},
+		{tracepoint: "syscalls/sys_enter_open", optional: true, build: path(kindOpen, "sys_enter_open", "filename", "flags")},
+		{tracepoint: "syscalls/sys_enter_openat2", optional: true, build: path(kindOpen, "sys_enter_openat2", "filename", "")},
+		{tracepoint: "syscalls/sys_enter_execve", build: path(kindExec, "sys_enter_execve", "filename", "")},
+		{tracepoint: "syscalls/sys_enter_execveat", optional: true, build: path(kindExec, "sys_enter_execveat", "filename", "")},
+		{tracepoint: "syscalls/sys_enter_connect", build: func(offsets map[string]int16) ([]byte, error) {
+			addr, err := field(offsets, "sys_enter_connect", "uservaddr")
+			if err != nil {
+				return nil, err
+			}
+			length, err := field(offsets, "sys_enter_connect", "addrlen")
+			if err != nil {
+				return nil, err
+			}
+			return connectProgram(m, addr, length)
+		}},
+	}
+}
+
+// Stop detaches the programs, reads the remaining records and returns the summary of the processes
+// followed. Stopping again returns the same summary.
+func (t *Tracer) Stop() *Summary {
+	if t.summary != nil {
+		return t.summary
+	}
+	for _, fd := range t.events {
+		_ = syscall.Close(fd)
+	}
+	t.events = nil
+	close(t.stop)
+	<-t.done
+	t.read()
+	t.summary = t.collector.summary()
+	t.summary.LostEvents = t.drops()
+	t.close()
+	return t.summary
+}
+
+// poll reads the ring buffer until the tracer stops
+func (t *Tracer) poll() {
+	defer close(t.done)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.read()
+		}
+	}
+}
+
+// read passes the records submitted to the ring buffer to the collector
+func (t *Tracer) read() {
+	consumerPos := (*uint64)(unsafe.Pointer(&t.consumer[0]))
+	producerPos := (*uint64)(unsafe.Pointer(&t.producer[0]))
+	data := t.producer[os.Getpagesize():]
+	pos := atomic.LoadUint64(consumerPos)
+	for pos < atomic.LoadUint64(producerPos) {
+		offset := pos & (ringSize - 1)
+		header := atomic.LoadUint32((*uint32)(unsafe.Pointer(&data[offset])))
+		if header&ringBusy != 0 {
+			break
+		}
+		length := uint64(header &^ (ringBusy | ringDiscard))
+		if header&ringDiscard == 0 {
+			start := offset + ringHeaderLen
+			t.collector.add(data[start : start+length])
+		}
+		pos += (ringHeaderLen + length + 7) &^ 7
+		atomic.StoreUint64(consumerPos, pos)
+	}
+}
+
+// drops returns the records the programs could not send because the ring buffer was full
+func (t *Tracer) drops() uint64 {
+	var key uint32
+	var value [8]byte
+	attr := mapElemAttr{
+		mapFd: uint32(t.maps.drops),
+		key:   uint64(uintptr(unsafe.Pointer(&key))),
+		value: uint64(uintptr(unsafe.Pointer(&value[0]))),
+	}
+	_, err := bpf(bpfMapLookupElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(&key)
+	runtime.KeepAlive(&value)
+	if err != nil {
+		return 0
+	}
+	return binary.NativeEndian.Uint64(value[:])
+}
+
+// close releases the ring buffer, the programs and the maps
+func (t *Tracer) close() {
+	for _, fd := range t.events {
+		_ = syscall.Close(fd)
+	}
+	if t.producer != nil {
+		_ = syscall.Munmap(t.producer)
+	}
+	if t.consumer != nil {
+		_ = syscall.Munmap(t.consumer)
+	}
+	for _, fd := range t.progs {
+		_ = syscall.Close(fd)
+	}
+	for _, fd := range []int{t.maps.tracked, t.maps.events, t.maps.drops} {
+		if fd >= 0 {
+			_ = syscall.Close(fd)
+		}
+	}
+	t.events, t.producer, t.consumer, t.progs = nil, nil, nil, nil
+	t.maps = maps{tracked: -1, events: -1, drops: -1}
+}
+
+// findTracefs returns where tracefs is mounted
+func findTracefs() (string, error) {
+	for _, dir := range tracefsDirs {
+		if _, err := os.Stat(filepath.Join(dir, "events")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", errors.New("tracefs is not mounted, mount it with: mount -t tracefs tracefs /sys/kernel/tracing")
+}
+
+// raiseMemlock lifts the limit of locked memory, which bounds the memory of maps before Linux 5.11
+func raiseMemlock() {
+	limit := syscall.Rlimit{Cur: ^uint64(0), Max: ^uint64(0)}
+	_ = syscall.Setrlimit(rlimitMemlock, &limit)
+}
+
+// bpf calls bpf(2) with the command and its attributes
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := syscall.Syscall(sysBPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// createMap creates a map and returns its file descriptor
+func createMap(mapType, keySize, valueSize, maxEntries uint32) (int, error) {
+	attr := mapCreateAttr{mapType: mapType, keySize: keySize, valueSize: valueSize, maxEntries: maxEntries}
+	return bpf(bpfMapCreate, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+}
+
+// updateElem sets the value of key in a map of u32 keys and values
+func updateElem(fd int, key, value uint32) error {
+	attr := mapElemAttr{
+		mapFd: uint32(fd),
+		key:   uint64(uintptr(unsafe.Pointer(&key))),
+		value: uint64(uintptr(unsafe.Pointer(&value))),
+	}
+	_, err := bpf(bpfMapUpdateElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(&key)
+	runtime.KeepAlive(&value)
+	return err
+}
+
+// loadProgram loads a tracepoint program. If the verifier rejects it, it is loaded again with the log
+// of the verifier, whose last lines tell why.
+func loadProgram(code []byte) (int, error) {
+	license := []byte("GPL\x00")
+	attr := progLoadAttr{
+		progType: progTypeTracepoint,
+		insnCnt:  uint32(len(code) / 8),
+		insns:    uint64(uintptr(unsafe.Pointer(&code[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+	}
+	copy(attr.progName[:], "cronmgr_audit")
+	defer runtime.KeepAlive(code)
+	defer runtime.KeepAlive(license)
+	fd, err := bpf(bpfProgLoad, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if !errors.Is(err, syscall.EACCES) && !errors.Is(err, syscall.EINVAL) {
+		return fd, err
+	}
+	logBuf := make([]byte, 64*1024)
+	defer runtime.KeepAlive(logBuf)
+	attr.logLevel, attr.logSize, attr.logBuf = 1, uint32(len(logBuf)), uint64(uintptr(unsafe.Pointer(&logBuf[0])))
+	if fd, err := bpf(bpfProgLoad, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err == nil {
+		return fd, nil
+	}
+	lines := strings.Split(strings.TrimSpace(cString(logBuf)), "\n")
+	if len(lines) > 3 {
+		lines = lines[len(lines)-3:]
+	}
+	return -1, fmt.Errorf("%w: %s", err, strings.Join(lines, "; "))
+}
+
+// attach attaches a program to the tracepoint of id for all processes, returning the perf event to close
+// to detach it
+func attach(tracepoint uint64, prog int) (int, error) {
+	attr := perfEventAttr{
+		typ:          perfTypeTracepoint,
+		config:       tracepoint,
+		samplePeriod: 1,
+		sampleType:   perfSampleRaw,
+		wakeupEvents: 1,
+	}
+	attr.size = uint32(unsafe.Sizeof(attr))
+	anyPid, noGroup := -1, -1
+	fd, _, errno := syscall.Syscall6(syscall.SYS_PERF_EVENT_OPEN, uintptr(unsafe.Pointer(&attr)), uintptr(anyPid), 0,
+		uintptr(noGroup), perfFlagFDCloexec, 0)
+	if errno != 0 {
+		return -1, fmt.Errorf("perf_event_open: %w", errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, perfIocSetBPF, uintptr(prog)); errno != 0 {
+		_ = syscall.Close(int(fd))
+		return -1, fmt.Errorf("set bpf: %w", errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, perfIocEnable, 0); errno != 0 {
+		_ = syscall.Close(int(fd))
+		return -1, fmt.Errorf("enable: %w", errno)
+	}
+	return int(fd), nil
+}
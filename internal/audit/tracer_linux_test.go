@@ -0,0 +1,64 @@
+//go:build linux && (amd64 || arm64)
+
+package audit
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// TestTracer tests summarizing the files, programs and connections of a child process
+func TestTracer(t *testing.T) {
+	tracer, err := Start()
+	if err != nil {
+		t.Skipf("eBPF tracing is not available: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tracer.Stop()
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+	dir := t.TempDir()
+	written := filepath.Join(dir, "out.txt")
+	read := filepath.Join(dir, "in.txt")
+	if err := os.WriteFile(read, []byte("x"), 0644); err != nil {
+		tracer.Stop()
+		t.Fatal(err)
+	}
+	script := "cat " + read + " > " + written + "; exec 3<>/dev/tcp/127.0.0.1/" + strconv.Itoa(port) + " 2>/dev/null || true"
+	cmd := exec.Command("bash", "-c", script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		tracer.Stop()
+		t.Fatalf("bash error = %v: %s", err, out)
+	}
+	// Opened by the test itself, which is not followed
+	_ = os.WriteFile(filepath.Join(dir, "self.txt"), []byte("x"), 0644)
+	s := tracer.Stop()
+
+	if !slices.ContainsFunc(s.Execs, func(e Exec) bool { return filepath.Base(e.Path) == "cat" }) {
+		t.Errorf("Execs = %v, want cat", s.Execs)
+	}
+	want := map[string]bool{read: false, written: true}
+	for path, write := range want {
+		i := slices.IndexFunc(s.Files, func(f File) bool { return f.Path == path })
+		if i < 0 {
+			t.Errorf("Files = %v, want %s", s.Files, path)
+		} else if s.Files[i].Write != write {
+			t.Errorf("Files[%s].Write = %v, want %v", path, s.Files[i].Write, write)
+		}
+	}
+	if slices.ContainsFunc(s.Files, func(f File) bool { return filepath.Base(f.Path) == "self.txt" }) {
+		t.Errorf("Files = %v, want the files of the test itself left out", s.Files)
+	}
+	address := "127.0.0.1:" + strconv.Itoa(port)
+	if !slices.ContainsFunc(s.Connections, func(c Connection) bool { return c.Address == address }) {
+		t.Errorf("Connections = %v, want %s", s.Connections, address)
+	}
+}
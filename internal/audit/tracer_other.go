@@ -0,0 +1,18 @@
+//go:build !linux || !(amd64 || arm64)
+
+package audit
+
+import "errors"
+
+// Tracer is only available on Linux amd64 and arm64
+type Tracer struct{}
+
+// Start returns errors.ErrUnsupported, tracing needs eBPF
+func Start() (*Tracer, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Stop returns an empty summary
+func (t *Tracer) Stop() *Summary {
+	return newCollector().summary()
+}
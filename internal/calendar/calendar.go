@@ -0,0 +1,215 @@
+package calendar
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// dateLayout is the layout of the dates of a date list
+const dateLayout = "2006-01-02"
+
+// Calendar is a set of dates, e.g. the public holidays excluded from the runs of a job, or the days a job
+// whose schedule cannot be written as a cron expression runs on
+type Calendar struct {
+	// dates maps the dates as YYYY-MM-DD to their name, empty if they have none
+	dates map[string]string
+	// events are the recurring events, whose occurrences are computed from their rule
+	events []event
+}
+
+// Load reads the dates of the files at paths. A file is either an iCalendar (.ics) file, whose events
+// are expanded by day, or a list of YYYY-MM-DD dates, one per line, each optionally followed by a name;
+// blank lines and lines starting with # are ignored.
+func Load(paths ...string) (*Calendar, error) {
+	c := &Calendar{dates: map[string]string{}}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(content), []byte("BEGIN:VCALENDAR")) {
+			err = c.parseICS(content)
+		} else {
+			err = c.parseList(content)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+// Contains reports whether the date of t, in its location, is in the calendar, and the name of the date
+func (c *Calendar) Contains(t time.Time) (bool, string) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if name, ok := c.dates[day.Format(dateLayout)]; ok {
+		return true, name
+	}
+	for _, e := range c.events {
+		if e.occursOn(day) {
+			return true, e.summary
+		}
+	}
+	return false, ""
+}
+
+// parseList parses a list of dates
+func (c *Calendar) parseList(content []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		date, name, _ := strings.Cut(line, " ")
+		day, err := time.Parse(dateLayout, date)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid date %q, expected YYYY-MM-DD", n, date)
+		}
+		c.dates[day.Format(dateLayout)] = strings.TrimSpace(name)
+	}
+	return scanner.Err()
+}
+
+// event is an event of an iCalendar file, covering whole days
+type event struct {
+	summary string
+	start   time.Time
+	end     time.Time
+	// days is how many days each occurrence covers, at least 1
+	days    int
+	rule    *rule
+	rdates  []time.Time
+	exdates map[time.Time]bool
+}
+
+// occursOn reports whether an occurrence of the recurring event e covers day
+func (e event) occursOn(day time.Time) bool {
+	for k := range e.days {
+		start := day.AddDate(0, 0, -k)
+		if !e.exdates[start] && e.rule.occurs(e.start, start) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseICS parses the events of an iCalendar file (RFC 5545). Each occurrence of an event covers the days
+// from its DTSTART until its DTEND, or only its first day without one; the times of day are ignored.
+// Events repeat with RRULE and RDATE, minus the EXDATE dates.
+func (c *Calendar) parseICS(content []byte) error {
+	var e *event
+	var rrule string
+	for _, line := range unfoldICS(content) {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// Parameters such as VALUE=DATE or TZID follow the property name
+		name, _, _ := strings.Cut(key, ";")
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				e, rrule = &event{exdates: map[time.Time]bool{}}, ""
+			}
+		case "END":
+			if strings.EqualFold(value, "VEVENT") && e != nil {
+				if err := c.addEvent(e, rrule); err != nil {
+					return fmt.Errorf("event %q: %w", e.summary, err)
+				}
+				e = nil
+			}
+		}
+		if e == nil {
+			continue
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "SUMMARY":
+			e.summary = unescapeICS(value)
+		case "DTSTART":
+			e.start, err = parseICSDate(value)
+		case "DTEND":
+			e.end, err = parseICSDate(value)
+		case "RRULE":
+			rrule = value
+		case "RDATE", "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				var day time.Time
+				if day, err = parseICSDate(v); err != nil {
+					break
+				}
+				if strings.EqualFold(name, "RDATE") {
+					e.rdates = append(e.rdates, day)
+				} else {
+					e.exdates[day] = true
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("event %q: %w", e.summary, err)
+		}
+	}
+	return nil
+}
+
+// addEvent adds the dates of e, repeated by rrule unless it is empty
+func (c *Calendar) addEvent(e *event, rrule string) error {
+	if e.start.IsZero() {
+		return fmt.Errorf("no DTSTART")
+	}
+	e.days = 1
+	if e.end.After(e.start) {
+		e.days = int(e.end.Sub(e.start).Hours()/24 + 0.5)
+	}
+	for _, start := range append([]time.Time{e.start}, e.rdates...) {
+		if e.exdates[start] {
+			continue
+		}
+		for k := range e.days {
+			c.dates[start.AddDate(0, 0, k).Format(dateLayout)] = e.summary
+		}
+	}
+	if rrule == "" {
+		return nil
+	}
+	r, err := parseRule(rrule, e.start)
+	if err != nil {
+		return err
+	}
+	e.rule = r
+	c.events = append(c.events, *e)
+	return nil
+}
+
+// parseICSDate parses the date of a DATE or DATE-TIME value, the time is ignored
+func parseICSDate(value string) (time.Time, error) {
+	date, _, _ := strings.Cut(strings.TrimSpace(value), "T")
+	day, err := time.Parse("20060102", date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return day, nil
+}
+
+// unfoldICS returns the content lines of an iCalendar file, joining the lines folded with a leading space
+func unfoldICS(content []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// unescapeICS unescapes a TEXT value
+func unescapeICS(value string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(value)
+}
@@ -0,0 +1,92 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to a file of the test's temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoad tests the dates of date lists and iCalendar files
+func TestLoad(t *testing.T) {
+	list := writeFile(t, "holidays.txt", `# Public holidays
+2025-01-01 New Year's Day
+
+2025-12-25
+`)
+	ics := writeFile(t, "holidays.ics", "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"+
+		"BEGIN:VEVENT\r\nSUMMARY:Spring Festival\r\nDTSTART;VALUE=DATE:20250129\r\nDTEND;VALUE=DATE:20250201\r\nEND:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\nSUMMARY:Labour\r\n  Day\r\nDTSTART;VALUE=DATE:20250501\r\nRRULE:FREQ=YEARLY\r\nEND:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\nSUMMARY:Offsite\\, all hands\r\nDTSTART;TZID=Europe/Paris:20250612T090000\r\nEND:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\nSUMMARY:Month end close\r\nDTSTART;VALUE=DATE:20250227\r\nRRULE:FREQ=MONTHLY;BYMONTHDAY=-1\r\n"+
+		"EXDATE;VALUE=DATE:20250228\r\nRDATE;VALUE=DATE:20250226\r\nEND:VEVENT\r\n"+
+		"END:VCALENDAR\r\n")
+	c, err := Load(list, ics)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		date     string
+		want     bool
+		wantName string
+	}{
+		{date: "2025-01-01", want: true, wantName: "New Year's Day"},
+		{date: "2025-12-25", want: true},
+		{date: "2025-01-02"},
+		{date: "2025-01-28"},
+		{date: "2025-01-29", want: true, wantName: "Spring Festival"},
+		{date: "2025-01-31", want: true, wantName: "Spring Festival"},
+		// DTEND is exclusive
+		{date: "2025-02-01"},
+		{date: "2027-05-01", want: true, wantName: "Labour Day"},
+		{date: "2024-05-01"},
+		{date: "2025-06-12", want: true, wantName: "Offsite, all hands"},
+		{date: "2025-06-13"},
+		{date: "2025-03-31", want: true, wantName: "Month end close"},
+		{date: "2025-02-26", want: true, wantName: "Month end close"},
+		{date: "2025-02-28"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			day, _ := time.ParseInLocation(dateLayout, tt.date, time.Local)
+			got, name := c.Contains(day.Add(15 * time.Hour))
+			if got != tt.want || name != tt.wantName {
+				t.Errorf("Contains() = %v, %q, want %v, %q", got, name, tt.want, tt.wantName)
+			}
+		})
+	}
+}
+
+// TestLoadInvalid tests that malformed calendars are refused rather than excluding nothing
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "bad date", content: "2025-13-01\n"},
+		{name: "other layout", content: "01/01/2025\n"},
+		{name: "no DTSTART", content: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:Holiday\nEND:VEVENT\nEND:VCALENDAR\n"},
+		{name: "hourly", content: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:20250106\nRRULE:FREQ=HOURLY\nEND:VEVENT\nEND:VCALENDAR\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeFile(t, "holidays", tt.content)); err == nil {
+				t.Error("Load() error = nil, want an error")
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.ics")); err == nil {
+		t.Error("Load() of a missing file error = nil, want an error")
+	}
+}
@@ -0,0 +1,322 @@
+package calendar
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays maps the weekdays of RRULE to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// byDay is a weekday of BYDAY, with the ordinal of the weekday within the month, e.g. 2 for 2TU or -1 for
+// -1FR, or 0 for every such weekday
+type byDay struct {
+	n       int
+	weekday time.Weekday
+}
+
+// rule is a recurrence rule (RRULE) by day: DAILY, WEEKLY, MONTHLY or YEARLY, with INTERVAL, COUNT, UNTIL,
+// BYMONTH, BYMONTHDAY, BYDAY, BYSETPOS and WKST. That covers schedules such as "the last business day of
+// the month" (FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1) or "every 2nd Tuesday" (FREQ=MONTHLY;BYDAY=2TU).
+type rule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byMonth    []int
+	byMonthDay []int
+	byDay      []byDay
+	bySetPos   []int
+	weekStart  time.Weekday
+}
+
+// parseRule parses the RRULE value of an event starting on start
+func parseRule(value string, start time.Time) (*rule, error) {
+	r := &rule{interval: 1, weekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		key, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(v)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+			if err == nil && r.count < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "UNTIL":
+			r.until, err = parseICSDate(v)
+		case "BYMONTH":
+			r.byMonth, err = parseInts(v, 1, 12, false)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseInts(v, 1, 31, true)
+		case "BYSETPOS":
+			r.bySetPos, err = parseInts(v, 1, 366, true)
+		case "BYDAY":
+			r.byDay, err = parseByDay(v)
+		case "WKST":
+			var ok bool
+			if r.weekStart, ok = weekdays[strings.ToUpper(v)]; !ok {
+				err = fmt.Errorf("unknown weekday")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE %s=%s: %w", key, v, err)
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	case "":
+		return nil, fmt.Errorf("RRULE %q has no FREQ", value)
+	default:
+		return nil, fmt.Errorf("unsupported RRULE FREQ=%s, expected DAILY, WEEKLY, MONTHLY or YEARLY", r.freq)
+	}
+	for _, d := range r.byDay {
+		if d.n != 0 && r.freq != "MONTHLY" && (r.freq != "YEARLY" || len(r.byMonth) == 0) {
+			return nil, fmt.Errorf("BYDAY ordinals are only supported with FREQ=MONTHLY, or FREQ=YEARLY with BYMONTH")
+		}
+	}
+	if len(r.byMonthDay) > 0 && r.freq == "WEEKLY" {
+		return nil, fmt.Errorf("BYMONTHDAY is not supported with FREQ=WEEKLY")
+	}
+	if !r.until.IsZero() && r.until.Before(start) {
+		return nil, fmt.Errorf("RRULE UNTIL is before DTSTART")
+	}
+	return r, nil
+}
+
+// parseInts parses a list of integers between lo and hi, or their opposites if negative is set
+func parseInts(value string, lo, hi int, negative bool) ([]int, error) {
+	var values []int
+	for _, v := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		if abs := max(n, -n); abs < lo || abs > hi || (n < 0 && !negative) {
+			return nil, fmt.Errorf("%d is out of range", n)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+// parseByDay parses the weekdays of BYDAY, e.g. MO,TU or 2TU or -1FR
+func parseByDay(value string) ([]byDay, error) {
+	var days []byDay
+	for _, v := range strings.Split(strings.ToUpper(value), ",") {
+		if len(v) < 2 {
+			return nil, fmt.Errorf("unknown weekday %q", v)
+		}
+		weekday, ok := weekdays[v[len(v)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", v)
+		}
+		d := byDay{weekday: weekday}
+		if ordinal := v[:len(v)-2]; ordinal != "" {
+			n, err := strconv.Atoi(ordinal)
+			if err != nil || n == 0 || n < -5 || n > 5 {
+				return nil, fmt.Errorf("invalid weekday %q", v)
+			}
+			d.n = n
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// occurs reports whether the rule of an event starting on start has an occurrence on day
+func (r *rule) occurs(start, day time.Time) bool {
+	if day.Before(start) || (!r.until.IsZero() && day.After(r.until)) {
+		return false
+	}
+	if r.count == 0 {
+		// Without COUNT only the period of day matters
+		if r.periods(start, day)%r.interval != 0 {
+			return false
+		}
+		return slices.ContainsFunc(r.candidates(r.periodStart(day), start), day.Equal)
+	}
+	n := 0
+	for period := r.periodStart(start); !period.After(day); period = r.next(period) {
+		for _, c := range r.candidates(period, start) {
+			if c.Before(start) || (!r.until.IsZero() && c.After(r.until)) {
+				continue
+			}
+			if n++; n > r.count {
+				return false
+			}
+			if c.Equal(day) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// periodStart returns the first day of the period of the rule holding day
+func (r *rule) periodStart(day time.Time) time.Time {
+	switch r.freq {
+	case "WEEKLY":
+		return day.AddDate(0, 0, -int((day.Weekday()-r.weekStart+7)%7))
+	case "MONTHLY":
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "YEARLY":
+		return time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// next returns the first day of the INTERVAL-th period after period
+func (r *rule) next(period time.Time) time.Time {
+	switch r.freq {
+	case "WEEKLY":
+		return period.AddDate(0, 0, 7*r.interval)
+	case "MONTHLY":
+		return period.AddDate(0, r.interval, 0)
+	case "YEARLY":
+		return period.AddDate(r.interval, 0, 0)
+	}
+	return period.AddDate(0, 0, r.interval)
+}
+
+// periods returns the number of periods of the rule from the period of start to that of day
+func (r *rule) periods(start, day time.Time) int {
+	switch r.freq {
+	case "WEEKLY":
+		return int(r.periodStart(day).Sub(r.periodStart(start)).Hours()/24+0.5) / 7
+	case "MONTHLY":
+		return (day.Year()-start.Year())*12 + int(day.Month()) - int(start.Month())
+	case "YEARLY":
+		return day.Year() - start.Year()
+	}
+	return int(day.Sub(start).Hours()/24 + 0.5)
+}
+
+// candidates returns the sorted occurrences of the rule within the period starting on period, before
+// DTSTART, UNTIL and COUNT are applied
+func (r *rule) candidates(period, start time.Time) []time.Time {
+	var days []time.Time
+	switch r.freq {
+	case "DAILY":
+		if r.matchesMonth(period.Month()) && r.matchesMonthDay(period) && r.matchesWeekday(period) {
+			days = append(days, period)
+		}
+	case "WEEKLY":
+		for i := range 7 {
+			day := period.AddDate(0, 0, i)
+			if len(r.byDay) == 0 && day.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) && r.matchesMonth(day.Month()) {
+				days = append(days, day)
+			}
+		}
+	case "MONTHLY":
+		if r.matchesMonth(period.Month()) {
+			days = r.monthDays(period, start)
+		}
+	case "YEARLY":
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []int{int(start.Month())}
+			if len(r.byMonthDay) > 0 || len(r.byDay) > 0 {
+				months = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+			}
+		}
+		slices.Sort(months)
+		for _, m := range months {
+			days = append(days, r.monthDays(time.Date(period.Year(), time.Month(m), 1, 0, 0, 0, 0, time.UTC), start)...)
+		}
+	}
+	return r.setPos(days)
+}
+
+// monthDays returns the days of the month starting on first selected by BYMONTHDAY and BYDAY, or the day
+// of the month of start without them
+func (r *rule) monthDays(first, start time.Time) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	if len(r.byMonthDay) == 0 && len(r.byDay) == 0 {
+		// Months without that day, e.g. the 31st, are skipped
+		if start.Day() > last {
+			return nil
+		}
+		return []time.Time{first.AddDate(0, 0, start.Day()-1)}
+	}
+	var days []time.Time
+	for i := range last {
+		day := first.AddDate(0, 0, i)
+		if r.matchesMonthDay(day) && r.matchesWeekday(day) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// matchesMonth reports whether month is selected by BYMONTH
+func (r *rule) matchesMonth(month time.Month) bool {
+	return len(r.byMonth) == 0 || slices.Contains(r.byMonth, int(month))
+}
+
+// matchesMonthDay reports whether day is selected by BYMONTHDAY, whose negative values count from the end
+// of the month
+func (r *rule) matchesMonthDay(day time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, d := range r.byMonthDay {
+		if d == day.Day() || last+d+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWeekday reports whether day is selected by BYDAY, whose ordinals count the weekdays of the month
+func (r *rule) matchesWeekday(day time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, d := range r.byDay {
+		if d.weekday != day.Weekday() {
+			continue
+		}
+		if d.n == 0 || d.n == (day.Day()-1)/7+1 || -d.n == (last-day.Day())/7+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// setPos keeps the days at the BYSETPOS positions, negative positions counting from the end
+func (r *rule) setPos(days []time.Time) []time.Time {
+	if len(r.bySetPos) == 0 {
+		return days
+	}
+	var kept []time.Time
+	for i, day := range days {
+		for _, pos := range r.bySetPos {
+			if pos == i+1 || pos == i-len(days) {
+				kept = append(kept, day)
+				break
+			}
+		}
+	}
+	return kept
+}
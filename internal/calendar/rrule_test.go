@@ -0,0 +1,133 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRuleOccurs tests the occurrences of recurrence rules
+func TestRuleOccurs(t *testing.T) {
+	tests := []struct {
+		name  string
+		rrule string
+		start string
+		want  []string
+		not   []string
+	}{
+		{
+			name:  "last business day of the month",
+			rrule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+			start: "2025-01-01",
+			want:  []string{"2025-01-31", "2025-05-30", "2025-08-29", "2025-11-28"},
+			not:   []string{"2025-01-30", "2025-05-31", "2025-08-31", "2025-11-30"},
+		},
+		{
+			name:  "every 2nd Tuesday",
+			rrule: "FREQ=MONTHLY;BYDAY=2TU",
+			start: "2025-01-01",
+			want:  []string{"2025-01-14", "2025-02-11", "2025-09-09"},
+			not:   []string{"2025-01-07", "2025-01-21", "2025-09-02"},
+		},
+		{
+			name:  "last Friday",
+			rrule: "FREQ=MONTHLY;BYDAY=-1FR",
+			start: "2025-01-01",
+			want:  []string{"2025-01-31", "2025-02-28"},
+			not:   []string{"2025-01-24", "2025-02-21"},
+		},
+		{
+			name:  "end of month",
+			rrule: "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: "2024-01-31",
+			want:  []string{"2024-02-29", "2025-02-28", "2025-04-30"},
+			not:   []string{"2025-04-29", "2025-05-30"},
+		},
+		{
+			name:  "every other week on Monday and Thursday",
+			rrule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+			start: "2025-01-06",
+			want:  []string{"2025-01-06", "2025-01-09", "2025-01-20", "2025-01-23"},
+			not:   []string{"2025-01-13", "2025-01-16", "2025-01-07"},
+		},
+		{
+			name:  "weekly on the weekday of the start",
+			rrule: "FREQ=WEEKLY",
+			start: "2025-01-08",
+			want:  []string{"2025-01-08", "2025-03-05"},
+			not:   []string{"2025-01-01", "2025-01-09"},
+		},
+		{
+			name:  "quarter ends",
+			rrule: "FREQ=YEARLY;BYMONTH=3,6,9,12;BYMONTHDAY=-1",
+			start: "2025-01-01",
+			want:  []string{"2025-03-31", "2025-06-30", "2026-12-31"},
+			not:   []string{"2025-04-30", "2025-06-29"},
+		},
+		{
+			name:  "first Monday of September",
+			rrule: "FREQ=YEARLY;BYMONTH=9;BYDAY=1MO",
+			start: "2025-01-01",
+			want:  []string{"2025-09-01", "2026-09-07"},
+			not:   []string{"2025-09-08", "2026-09-14"},
+		},
+		{
+			name:  "31st of the month",
+			rrule: "FREQ=MONTHLY",
+			start: "2025-01-31",
+			want:  []string{"2025-01-31", "2025-03-31"},
+			not:   []string{"2025-02-28", "2025-04-30"},
+		},
+		{
+			name:  "weekdays with a count",
+			rrule: "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=3",
+			start: "2025-01-02",
+			want:  []string{"2025-01-02", "2025-01-03", "2025-01-06"},
+			not:   []string{"2025-01-04", "2025-01-07", "2025-01-01"},
+		},
+		{
+			name:  "until",
+			rrule: "FREQ=DAILY;INTERVAL=3;UNTIL=20250110T235959Z",
+			start: "2025-01-01",
+			want:  []string{"2025-01-01", "2025-01-04", "2025-01-10"},
+			not:   []string{"2025-01-02", "2025-01-13"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, _ := time.Parse(dateLayout, tt.start)
+			r, err := parseRule(tt.rrule, start)
+			if err != nil {
+				t.Fatalf("parseRule() error = %v", err)
+			}
+			for _, date := range append(tt.want, tt.not...) {
+				day, _ := time.Parse(dateLayout, date)
+				want := !strings.Contains(strings.Join(tt.not, " "), date)
+				if got := r.occurs(start, day); got != want {
+					t.Errorf("occurs(%s) = %v, want %v", date, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestParseRuleInvalid tests that rules that would be expanded wrongly are refused
+func TestParseRuleInvalid(t *testing.T) {
+	start, _ := time.Parse(dateLayout, "2025-01-01")
+	for _, rrule := range []string{
+		"BYDAY=MO",
+		"FREQ=HOURLY",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;INTERVAL=0",
+		"FREQ=YEARLY;BYWEEKNO=20",
+		"FREQ=YEARLY;BYDAY=20MO",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=DAILY;UNTIL=20241231",
+	} {
+		if _, err := parseRule(rrule, start); err == nil {
+			t.Errorf("parseRule(%q) error = nil, want an error", rrule)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package capacity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/alswl/cron-manager/internal/precheck"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/spf13/afero"
+)
+
+// DefaultPath is the host-wide file of the reservations of the running jobs
+const DefaultPath = "/var/lib/cronmgr/reservations.json"
+
+// Resources are CPU cores and bytes of memory, needed by a job or available on the host.
+// Zero means none is needed, or that the capacity of the host is unknown.
+type Resources struct {
+	CPU    float64
+	Memory uint64
+}
+
+// reservation records the resources reserved by a running job
+type reservation struct {
+	Name   string    `json:"name"`
+	PID    int       `json:"pid"`
+	CPU    float64   `json:"cpu,omitempty"`
+	Memory uint64    `json:"memory,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// Ledger keeps the resources reserved by the jobs running on the host in a file shared by their cronmgr
+// processes, so that jobs whose combined needs exceed the capacity of the host are not started together
+type Ledger struct {
+	fs        afero.Fs
+	path      string
+	capacity  Resources
+	now       func() time.Time
+	useOsLock bool
+}
+
+// New creates a Ledger of the host with capacity, keeping the reservations in the file path
+func New(fs afero.Fs, path string, capacity Resources) *Ledger {
+	_, isOsFs := fs.(*afero.OsFs)
+	return &Ledger{fs: fs, path: path, capacity: capacity, now: time.Now, useOsLock: isOsFs}
+}
+
+// Reserve reserves need for the job name run by the process pid if the host has room for it beside the
+// reservations of the other running jobs. A job is always admitted while no other one holds a reservation,
+// even if it needs more than the host has. Otherwise ok is false and detail tells what is missing.
+func (l *Ledger) Reserve(name string, pid int, need Resources) (ok bool, detail string, err error) {
+	err = l.update(func(reservations []reservation) []reservation {
+		var used Resources
+		for _, r := range reservations {
+			used.CPU += r.CPU
+			used.Memory += r.Memory
+		}
+		if len(reservations) > 0 {
+			if detail = l.missing(used, need); detail != "" {
+				return reservations
+			}
+		}
+		ok = true
+		return append(reservations, reservation{Name: name, PID: pid, CPU: need.CPU, Memory: need.Memory, Since: l.now()})
+	})
+	return ok, detail, err
+}
+
+// missing describes the resource of the capacity need does not fit in beside used, empty if it fits
+func (l *Ledger) missing(used, need Resources) string {
+	if l.capacity.CPU > 0 && need.CPU > 0 && used.CPU+need.CPU > l.capacity.CPU {
+		return fmt.Sprintf("%s of %s CPUs reserved by running jobs, %s more needed",
+			formatCPU(used.CPU), formatCPU(l.capacity.CPU), formatCPU(need.CPU))
+	}
+	if l.capacity.Memory > 0 && need.Memory > 0 && used.Memory+need.Memory > l.capacity.Memory {
+		return fmt.Sprintf("%s of %s memory reserved by running jobs, %s more needed",
+			precheck.FormatBytes(used.Memory), precheck.FormatBytes(l.capacity.Memory), precheck.FormatBytes(need.Memory))
+	}
+	return ""
+}
+
+// Release removes the reservation of the process pid
+func (l *Ledger) Release(pid int) error {
+	return l.update(func(reservations []reservation) []reservation {
+		return slices.DeleteFunc(reservations, func(r reservation) bool { return r.PID == pid })
+	})
+}
+
+// update applies fn to the reservations under the lock of the file. The reservations of processes that
+// exited without releasing them, e.g. killed, are dropped first.
+func (l *Ledger) update(fn func([]reservation) []reservation) error {
+	if err := l.fs.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	locker := fslock.NewLocker(l.path, l.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return fmt.Errorf("couldn't lock %s: %w", l.path, err)
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	var reservations []reservation
+	content, err := afero.ReadFile(l.fs, l.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(content, &reservations); err != nil {
+			return fmt.Errorf("invalid reservations %s: %w", l.path, err)
+		}
+	}
+	reservations = slices.DeleteFunc(reservations, func(r reservation) bool { return !state.ProcessAlive(r.PID) })
+	reservations = fn(reservations)
+
+	content, err = json.Marshal(reservations)
+	if err != nil {
+		return err
+	}
+	tmpPath := l.path + ".tmp"
+	if err := afero.WriteFile(l.fs, tmpPath, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return l.fs.Rename(tmpPath, l.path)
+}
+
+// formatCPU formats a number of cores
+func formatCPU(cpu float64) string {
+	return strconv.FormatFloat(cpu, 'f', -1, 64)
+}
@@ -0,0 +1,55 @@
+package capacity
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// TestReserve tests admitting jobs while their combined needs fit in the capacity of the host
+func TestReserve(t *testing.T) {
+	l := New(afero.NewMemMapFs(), "/var/lib/cronmgr/reservations.json", Resources{CPU: 4, Memory: 8 << 30})
+	// The reservations must belong to live processes, or they are dropped as left over by killed jobs
+	pid := os.Getpid()
+	steps := []struct {
+		name   string
+		pid    int
+		need   Resources
+		wantOK bool
+	}{
+		{name: "backup", pid: pid, need: Resources{CPU: 3, Memory: 2 << 30}, wantOK: true},
+		{name: "report", pid: os.Getppid(), need: Resources{CPU: 2}},
+		{name: "report", pid: os.Getppid(), need: Resources{CPU: 1, Memory: 7 << 30}},
+		{name: "report", pid: os.Getppid(), need: Resources{CPU: 1, Memory: 6 << 30}, wantOK: true},
+	}
+	for _, step := range steps {
+		ok, detail, err := l.Reserve(step.name, step.pid, step.need)
+		if err != nil {
+			t.Fatalf("Reserve(%s) error = %v", step.name, err)
+		}
+		if ok != step.wantOK || ok == (detail != "") {
+			t.Errorf("Reserve(%s, %+v) = %v, %q, want %v", step.name, step.need, ok, detail, step.wantOK)
+		}
+	}
+
+	if err := l.Release(os.Getppid()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if ok, detail, _ := l.Reserve("report", os.Getppid(), Resources{CPU: 1}); !ok {
+		t.Errorf("Reserve() after release = false, %q", detail)
+	}
+}
+
+// TestReserveAlone tests that a job needing more than the host has runs when no other job does, and that
+// the reservations of exited processes are dropped
+func TestReserveAlone(t *testing.T) {
+	l := New(afero.NewMemMapFs(), "/var/lib/cronmgr/reservations.json", Resources{CPU: 2})
+	// No process has this PID, its reservation is left over by a killed job
+	if ok, _, err := l.Reserve("crashed", 1<<30, Resources{CPU: 2}); !ok || err != nil {
+		t.Fatalf("Reserve() = %v, %v", ok, err)
+	}
+	if ok, detail, err := l.Reserve("rebuild", os.Getpid(), Resources{CPU: 16}); !ok || err != nil {
+		t.Errorf("Reserve() = %v, %q, %v, want the job admitted alone", ok, detail, err)
+	}
+}
@@ -0,0 +1,32 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRealClock tests that the system clock follows the time package
+func TestRealClock(t *testing.T) {
+	c := New()
+
+	before := time.Now()
+	now := c.Now()
+	if now.Before(before) {
+		t.Errorf("Now() = %v, want not before %v", now, before)
+	}
+	if c.Since(before) < 0 {
+		t.Errorf("Since() = %v, want non-negative", c.Since(before))
+	}
+
+	select {
+	case <-c.After(time.Millisecond):
+	case <-time.After(time.Second):
+		t.Fatal("After() did not fire")
+	}
+
+	start := time.Now()
+	c.Sleep(10 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Sleep() returned after %v, want at least 10ms", elapsed)
+	}
+}
@@ -0,0 +1,188 @@
+package cloudmonitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of a write when none is configured
+const DefaultTimeout = 10 * time.Second
+
+// DefaultEndpoint is the endpoint of the Cloud Monitoring API
+const DefaultEndpoint = "https://monitoring.googleapis.com"
+
+// Point is a gauge value written to Cloud Monitoring
+type Point struct {
+	// Name is the last part of the metric type, e.g. "failed"
+	Name  string
+	Value float64
+}
+
+// Resource is the monitored resource the time series are written for
+type Resource struct {
+	// Type is the resource type, e.g. "gce_instance" or "global"
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+// Config configures a Client
+type Config struct {
+	// Project is the project the time series are written to, empty takes the project
+	// of the service account key or of the instance
+	Project string
+	// MetricPrefix is the prefix of the metric types, e.g. "custom.googleapis.com/crontab"
+	// writes the point "failed" as custom.googleapis.com/crontab/failed
+	MetricPrefix string
+	// Endpoint overrides DefaultEndpoint
+	Endpoint string
+	// Timeout bounds each write, 0 uses DefaultTimeout
+	Timeout time.Duration
+	// HTTPClient sends the writes and token exchanges, e.g. through a proxy, nil uses a client with Timeout.
+	// The metadata server is always read directly.
+	HTTPClient *http.Client
+}
+
+// Client writes the final state of a job to Google Cloud Monitoring, so that existing alerting
+// policies can alert on it. On Compute Engine the time series belong to the gce_instance resource
+// and are written with the instance service account; elsewhere a service account key file set in
+// GOOGLE_APPLICATION_CREDENTIALS authenticates them and they belong to the global resource.
+type Client struct {
+	cfg      Config
+	metadata *metadata
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewClient creates a Client for cfg
+func NewClient(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultEndpoint
+	}
+	metadataURL := DefaultMetadataURL
+	if host := os.Getenv(MetadataHostEnv); host != "" {
+		metadataURL = "http://" + host
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	return &Client{
+		cfg:      cfg,
+		metadata: &metadata{url: metadataURL, client: &http.Client{Timeout: metadataTimeout}},
+		client:   client,
+		now:      time.Now,
+	}
+}
+
+// Put writes points as gauges with the metric labels labels
+func (c *Client) Put(ctx context.Context, labels map[string]string, points []Point) error {
+	var account *serviceAccount
+	var token string
+	var err error
+	if path := os.Getenv(CredentialsEnv); path != "" {
+		if account, err = loadServiceAccount(path); err == nil {
+			token, err = account.token(ctx, c.client, c.now())
+		}
+	} else {
+		token, err = c.metadata.token(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("write to cloud monitoring: no credentials: %w", err)
+	}
+
+	project := c.cfg.Project
+	if project == "" && account != nil {
+		project = account.ProjectID
+	}
+	resource, err := c.metadata.resource(ctx)
+	if err != nil {
+		// Outside Compute Engine, only a service account key can have authenticated the write
+		if project == "" {
+			return fmt.Errorf("write to cloud monitoring: no project configured: %w", err)
+		}
+		resource = Resource{Type: "global", Labels: map[string]string{"project_id": project}}
+	}
+	if project == "" {
+		project = resource.Labels["project_id"]
+	}
+
+	body, err := json.Marshal(c.request(resource, labels, points))
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimSuffix(c.cfg.Endpoint, "/") + "/v3/projects/" + url.PathEscape(project) + "/timeSeries"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("write to cloud monitoring: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("write to cloud monitoring: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
+
+// timeSeriesRequest is the body of projects.timeSeries.create
+type timeSeriesRequest struct {
+	TimeSeries []timeSeries `json:"timeSeries"`
+}
+
+type timeSeries struct {
+	Metric struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels,omitempty"`
+	} `json:"metric"`
+	Resource   Resource `json:"resource"`
+	MetricKind string   `json:"metricKind"`
+	ValueType  string   `json:"valueType"`
+	Points     []point  `json:"points"`
+}
+
+type point struct {
+	Interval struct {
+		EndTime string `json:"endTime"`
+	} `json:"interval"`
+	Value struct {
+		DoubleValue float64 `json:"doubleValue"`
+	} `json:"value"`
+}
+
+// request builds the request writing one gauge time series per point
+func (c *Client) request(resource Resource, labels map[string]string, points []Point) timeSeriesRequest {
+	endTime := c.now().UTC().Format(time.RFC3339Nano)
+	var req timeSeriesRequest
+	for _, p := range points {
+		var series timeSeries
+		series.Metric.Type = strings.TrimSuffix(c.cfg.MetricPrefix, "/") + "/" + p.Name
+		series.Metric.Labels = labels
+		series.Resource = resource
+		series.MetricKind = "GAUGE"
+		series.ValueType = "DOUBLE"
+		var sample point
+		sample.Interval.EndTime = endTime
+		sample.Value.DoubleValue = p.Value
+		series.Points = []point{sample}
+		req.TimeSeries = append(req.TimeSeries, series)
+	}
+	return req
+}
@@ -0,0 +1,160 @@
+package cloudmonitoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// written is a timeSeries.create request received by the fake Cloud Monitoring
+type written struct {
+	path          string
+	authorization string
+	body          timeSeriesRequest
+}
+
+// newFakeGoogle starts a server acting as Cloud Monitoring answering with status, as the token
+// endpoint of service accounts and, if gce is set, as the metadata server of a Compute Engine instance
+func newFakeGoogle(t *testing.T, gce bool, status int) (*httptest.Server, *[]written) {
+	t.Helper()
+	var writes []written
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metadata := map[string]string{
+			"/computeMetadata/v1/instance/service-accounts/default/token": `{"access_token":"instance-token","expires_in":3599,"token_type":"Bearer"}`,
+			"/computeMetadata/v1/project/project-id":                      "gce-project",
+			"/computeMetadata/v1/instance/id":                             "4242",
+			"/computeMetadata/v1/instance/zone":                           "projects/123/zones/europe-west1-b",
+		}
+		if content, ok := metadata[r.URL.Path]; ok {
+			if !gce || r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		switch r.URL.Path {
+		case "/token":
+			_, _ = w.Write([]byte(`{"access_token":"key-token","expires_in":3599,"token_type":"Bearer"}`))
+		default:
+			write := written{path: r.URL.Path, authorization: r.Header.Get("Authorization")}
+			if err := json.NewDecoder(r.Body).Decode(&write.body); err != nil {
+				t.Errorf("Decode() error = %v", err)
+			}
+			writes = append(writes, write)
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &writes
+}
+
+// newTestClient creates a Client using server for Cloud Monitoring at a fixed time
+func newTestClient(server *httptest.Server, cfg Config) *Client {
+	cfg.Endpoint = server.URL
+	c := NewClient(cfg)
+	c.now = func() time.Time { return time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC) }
+	return c
+}
+
+// TestClientPut tests writing gauges from a Compute Engine instance and with a service account key
+func TestClientPut(t *testing.T) {
+	tests := []struct {
+		name              string
+		gce               bool
+		keyFile           bool
+		project           string
+		status            int
+		wantPath          string
+		wantAuthorization string
+		wantResource      Resource
+		wantError         bool
+	}{
+		{
+			name:              "compute engine",
+			gce:               true,
+			status:            http.StatusOK,
+			wantPath:          "/v3/projects/gce-project/timeSeries",
+			wantAuthorization: "Bearer instance-token",
+			wantResource: Resource{Type: "gce_instance", Labels: map[string]string{
+				"project_id": "gce-project", "instance_id": "4242", "zone": "europe-west1-b",
+			}},
+		},
+		{
+			name:              "configured project",
+			gce:               true,
+			project:           "monitoring-project",
+			status:            http.StatusOK,
+			wantPath:          "/v3/projects/monitoring-project/timeSeries",
+			wantAuthorization: "Bearer instance-token",
+			wantResource: Resource{Type: "gce_instance", Labels: map[string]string{
+				"project_id": "gce-project", "instance_id": "4242", "zone": "europe-west1-b",
+			}},
+		},
+		{
+			name:              "service account key",
+			keyFile:           true,
+			status:            http.StatusOK,
+			wantPath:          "/v3/projects/key-project/timeSeries",
+			wantAuthorization: "Bearer key-token",
+			wantResource:      Resource{Type: "global", Labels: map[string]string{"project_id": "key-project"}},
+		},
+		{name: "no credentials", status: http.StatusOK, wantError: true},
+		{name: "permission denied", gce: true, status: http.StatusForbidden, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, writes := newFakeGoogle(t, tt.gce, tt.status)
+			t.Setenv(MetadataHostEnv, strings.TrimPrefix(server.URL, "http://"))
+			t.Setenv(CredentialsEnv, "")
+			if tt.keyFile {
+				path, _ := writeServiceAccount(t, server.URL+"/token")
+				t.Setenv(CredentialsEnv, path)
+			}
+			c := newTestClient(server, Config{Project: tt.project, MetricPrefix: "custom.googleapis.com/crontab"})
+			err := c.Put(context.Background(), map[string]string{"name": "backup"}, []Point{
+				{Name: "failed", Value: 1},
+				{Name: "duration_seconds", Value: 12.5},
+			})
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Put() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantPath == "" {
+				return
+			}
+
+			if len(*writes) != 1 {
+				t.Fatalf("got %d writes, want 1", len(*writes))
+			}
+			write := (*writes)[0]
+			if write.path != tt.wantPath {
+				t.Errorf("path = %s, want %s", write.path, tt.wantPath)
+			}
+			if write.authorization != tt.wantAuthorization {
+				t.Errorf("Authorization = %q, want %q", write.authorization, tt.wantAuthorization)
+			}
+			series := write.body.TimeSeries
+			if len(series) != 2 {
+				t.Fatalf("got %d time series, want 2", len(series))
+			}
+			if series[0].Metric.Type != "custom.googleapis.com/crontab/failed" || series[0].Metric.Labels["name"] != "backup" {
+				t.Errorf("metric = %+v, want custom.googleapis.com/crontab/failed with name backup", series[0].Metric)
+			}
+			if series[1].Points[0].Value.DoubleValue != 12.5 || series[1].Points[0].Interval.EndTime != "2024-05-01T02:00:00Z" {
+				t.Errorf("point = %+v, want 12.5 at 2024-05-01T02:00:00Z", series[1].Points[0])
+			}
+			if series[0].MetricKind != "GAUGE" || series[0].ValueType != "DOUBLE" {
+				t.Errorf("kind = %s %s, want GAUGE DOUBLE", series[0].MetricKind, series[0].ValueType)
+			}
+			resource, _ := json.Marshal(series[0].Resource)
+			want, _ := json.Marshal(tt.wantResource)
+			if string(resource) != string(want) {
+				t.Errorf("resource = %s, want %s", resource, want)
+			}
+		})
+	}
+}
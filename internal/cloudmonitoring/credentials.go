@@ -0,0 +1,199 @@
+package cloudmonitoring
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultMetadataURL is the metadata server of Compute Engine, serving the token of the instance service account
+const DefaultMetadataURL = "http://metadata.google.internal"
+
+// MetadataHostEnv is the environment variable overriding the host of the metadata server, as in the Google Cloud SDKs
+const MetadataHostEnv = "GCE_METADATA_HOST"
+
+// CredentialsEnv is the environment variable with the path of a service account key file,
+// used instead of the instance service account, e.g. on hosts outside Google Cloud
+const CredentialsEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// writeScope is the OAuth scope allowing to write time series
+const writeScope = "https://www.googleapis.com/auth/monitoring.write"
+
+// metadataTimeout bounds the requests to the metadata server, which does not answer outside Compute Engine
+const metadataTimeout = 3 * time.Second
+
+// metadata reads the Compute Engine metadata server
+type metadata struct {
+	url    string
+	client *http.Client
+}
+
+// get returns the content of the metadata path, e.g. /computeMetadata/v1/project/project-id
+func (m *metadata) get(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("metadata server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("metadata server: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("metadata server: unexpected status %s for %s", resp.Status, path)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// token returns an access token of the service account of the instance
+func (m *metadata) token(ctx context.Context) (string, error) {
+	content, err := m.get(ctx, "/computeMetadata/v1/instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	return parseToken([]byte(content))
+}
+
+// resource returns the gce_instance monitored resource of the instance
+func (m *metadata) resource(ctx context.Context) (Resource, error) {
+	labels := map[string]string{}
+	for label, path := range map[string]string{
+		"project_id":  "/computeMetadata/v1/project/project-id",
+		"instance_id": "/computeMetadata/v1/instance/id",
+		"zone":        "/computeMetadata/v1/instance/zone",
+	} {
+		value, err := m.get(ctx, path)
+		if err != nil {
+			return Resource{}, err
+		}
+		// The zone is returned as projects/<number>/zones/<zone>
+		labels[label] = value[strings.LastIndex(value, "/")+1:]
+	}
+	return Resource{Type: "gce_instance", Labels: labels}, nil
+}
+
+// serviceAccount is a service account key file, as downloaded from the Cloud Console
+type serviceAccount struct {
+	ProjectID    string `json:"project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// loadServiceAccount reads the service account key file at path
+func loadServiceAccount(path string) (*serviceAccount, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(content, &account); err != nil {
+		return nil, fmt.Errorf("invalid service account key %s: %w", path, err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" || account.TokenURI == "" {
+		return nil, fmt.Errorf("invalid service account key %s: client_email, private_key and token_uri are required", path)
+	}
+	return &account, nil
+}
+
+// token exchanges a JWT signed with the key of the service account for an access token
+func (a *serviceAccount) token(ctx context.Context, client *http.Client, now time.Time) (string, error) {
+	assertion, err := a.assertion(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("token exchange: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return parseToken(body)
+}
+
+// assertion returns the JWT asserting the identity of the service account, signed with RS256
+func (a *serviceAccount) assertion(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(a.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("service account %s: private_key is not PEM encoded", a.ClientEmail)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("service account %s: %w", a.ClientEmail, err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account %s: private_key is not an RSA key", a.ClientEmail)
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": a.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   a.ClientEmail,
+		"scope": writeScope,
+		"aud":   a.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseToken returns the access token of an OAuth token response
+func parseToken(content []byte) (string, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(content, &token); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("invalid token response: no access_token")
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,124 @@
+package cloudmonitoring
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeServiceAccount writes a service account key file using tokenURI and returns its path and public key
+func writeServiceAccount(t *testing.T, tokenURI string) (string, *rsa.PublicKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "key-project",
+		"client_email":   "cron@key-project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURI,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, &key.PublicKey
+}
+
+// verifyAssertion checks the RS256 signature of the JWT assertion and returns its claims
+func verifyAssertion(t *testing.T, assertion string, public *rsa.PublicKey) map[string]any {
+	t.Helper()
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion has %d parts, want 3", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("assertion signature: %v", err)
+	}
+	content, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(content, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+// TestServiceAccountAssertion tests the JWT asserting the identity of a service account
+func TestServiceAccountAssertion(t *testing.T) {
+	path, public := writeServiceAccount(t, "https://oauth2.example/token")
+	account, err := loadServiceAccount(path)
+	if err != nil {
+		t.Fatalf("loadServiceAccount() error = %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	assertion, err := account.assertion(now)
+	if err != nil {
+		t.Fatalf("assertion() error = %v", err)
+	}
+	claims := verifyAssertion(t, assertion, public)
+	for name, want := range map[string]any{
+		"iss":   "cron@key-project.iam.gserviceaccount.com",
+		"scope": writeScope,
+		"aud":   "https://oauth2.example/token",
+		"iat":   float64(now.Unix()),
+		"exp":   float64(now.Add(time.Hour).Unix()),
+	} {
+		if claims[name] != want {
+			t.Errorf("claim %s = %v, want %v", name, claims[name], want)
+		}
+	}
+}
+
+// TestLoadServiceAccount tests rejecting key files without the fields needed to get a token
+func TestLoadServiceAccount(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "not json", content: "key"},
+		{name: "missing private key", content: `{"client_email":"cron@example","token_uri":"https://oauth2.example/token"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "key.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadServiceAccount(path); err == nil {
+				t.Error("loadServiceAccount() succeeded, want error")
+			}
+		})
+	}
+	if _, err := loadServiceAccount(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("loadServiceAccount() of a missing file error = %v, want not exist", err)
+	}
+}
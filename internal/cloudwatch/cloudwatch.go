@@ -0,0 +1,160 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of a put when none is configured
+const DefaultTimeout = 10 * time.Second
+
+// Datum is a value put to CloudWatch
+type Datum struct {
+	// Name is the metric name, e.g. "failed"
+	Name  string
+	Value float64
+	// Unit is the CloudWatch unit, e.g. "Seconds", empty for none
+	Unit string
+	// Timestamp is the time of the value, zero for the time it is received
+	Timestamp time.Time
+}
+
+// Config configures a Client
+type Config struct {
+	// Namespace groups the metrics in CloudWatch, e.g. "Cron"
+	Namespace string
+	// Region is the AWS region, empty takes AWS_REGION, AWS_DEFAULT_REGION or the region of the EC2 instance
+	Region string
+	// Dimensions renames labels to dimension names, e.g. name=JobName; other labels keep their name
+	Dimensions map[string]string
+	// Endpoint overrides the CloudWatch endpoint of the region, e.g. with a VPC endpoint
+	Endpoint string
+	// Timeout bounds each put, 0 uses DefaultTimeout
+	Timeout time.Duration
+	// HTTPClient sends the puts, e.g. through a proxy, nil uses a client with Timeout.
+	// The instance metadata is always read directly.
+	HTTPClient *http.Client
+}
+
+// Client puts the final state of a job to AWS CloudWatch with PutMetricData, so that CloudWatch
+// alarms can alert on it. Requests are signed with the credentials of the AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY environment variables, or else of the IAM role of the EC2 instance.
+type Client struct {
+	cfg      Config
+	metadata *metadata
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewClient creates a Client for cfg
+func NewClient(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	return &Client{
+		cfg:      cfg,
+		metadata: &metadata{url: DefaultMetadataURL, client: &http.Client{Timeout: cfg.Timeout}},
+		client:   client,
+		now:      time.Now,
+	}
+}
+
+// Target identifies the namespace and endpoint the client puts data to
+func (c *Client) Target() string {
+	return strings.TrimSpace(c.cfg.Namespace + " " + c.cfg.Region + " " + c.cfg.Endpoint)
+}
+
+// Put puts data with the dimensions of labels, renamed as configured. Labels with an empty value are skipped.
+func (c *Client) Put(ctx context.Context, labels map[string]string, data []Datum) error {
+	region := c.cfg.Region
+	if region == "" {
+		region = envRegion()
+	}
+	if region == "" {
+		var err error
+		if region, err = c.metadata.get(ctx, "/latest/meta-data/placement/region"); err != nil {
+			return fmt.Errorf("put to cloudwatch: no region configured: %w", err)
+		}
+	}
+	creds, ok, err := envCredentials()
+	if err != nil {
+		return fmt.Errorf("put to cloudwatch: %w", err)
+	}
+	if !ok {
+		if creds, err = c.metadata.roleCredentials(ctx); err != nil {
+			return fmt.Errorf("put to cloudwatch: no credentials: %w", err)
+		}
+	}
+
+	endpoint := c.cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://monitoring." + region + ".amazonaws.com/"
+	}
+	payload := []byte(c.form(labels, data).Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	sign(req, payload, creds, region, "monitoring", c.now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("put to cloudwatch: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("put to cloudwatch: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// form builds the PutMetricData request of data with the dimensions of labels
+func (c *Client) form(labels map[string]string, data []Datum) url.Values {
+	form := url.Values{
+		"Action":    {"PutMetricData"},
+		"Version":   {"2010-08-01"},
+		"Namespace": {c.cfg.Namespace},
+	}
+	for i, datum := range data {
+		member := "MetricData.member." + strconv.Itoa(i+1) + "."
+		form.Set(member+"MetricName", datum.Name)
+		form.Set(member+"Value", strconv.FormatFloat(datum.Value, 'g', -1, 64))
+		if datum.Unit != "" {
+			form.Set(member+"Unit", datum.Unit)
+		}
+		if !datum.Timestamp.IsZero() {
+			form.Set(member+"Timestamp", datum.Timestamp.UTC().Format(time.RFC3339))
+		}
+		n := 0
+		for _, label := range slices.Sorted(maps.Keys(labels)) {
+			if labels[label] == "" {
+				continue
+			}
+			name := label
+			if renamed, ok := c.cfg.Dimensions[label]; ok {
+				name = renamed
+			}
+			n++
+			dimension := member + "Dimensions.member." + strconv.Itoa(n) + "."
+			form.Set(dimension+"Name", name)
+			form.Set(dimension+"Value", labels[label])
+		}
+	}
+	return form
+}
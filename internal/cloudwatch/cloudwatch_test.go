@@ -0,0 +1,202 @@
+package cloudwatch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// putRequest is a PutMetricData request received by the fake CloudWatch
+type putRequest struct {
+	form          url.Values
+	authorization string
+	token         string
+}
+
+// newFakeAWS starts a server acting as the instance metadata service with the IAM role role,
+// no role if empty, and as CloudWatch answering with status
+func newFakeAWS(t *testing.T, role string, status int) (*httptest.Server, *[]putRequest) {
+	t.Helper()
+	var puts []putRequest
+	const rolesPath = "/latest/meta-data/iam/security-credentials/"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest/api/token" && strings.HasPrefix(r.URL.Path, "/latest/") &&
+			r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			_, _ = w.Write([]byte("imds-token"))
+		case r.URL.Path == "/latest/meta-data/placement/region":
+			_, _ = w.Write([]byte("eu-west-1"))
+		case r.URL.Path == rolesPath && role != "":
+			_, _ = w.Write([]byte(role + "\n"))
+		case r.URL.Path == rolesPath+role && role != "":
+			_, _ = w.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIAROLE","SecretAccessKey":"secret","Token":"session"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/":
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("ParseForm() error = %v", err)
+			}
+			puts = append(puts, putRequest{
+				form:          r.PostForm,
+				authorization: r.Header.Get("Authorization"),
+				token:         r.Header.Get("X-Amz-Security-Token"),
+			})
+			w.WriteHeader(status)
+			if status != http.StatusOK {
+				_, _ = w.Write([]byte("<Error><Code>AccessDenied</Code></Error>"))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &puts
+}
+
+// newTestClient creates a Client using server for CloudWatch and the instance metadata
+func newTestClient(server *httptest.Server, cfg Config) *Client {
+	cfg.Endpoint = server.URL + "/"
+	c := NewClient(cfg)
+	c.metadata.url = server.URL
+	return c
+}
+
+// TestClientPut tests the PutMetricData request with the environment credentials
+func TestClientPut(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "us-east-2")
+	server, puts := newFakeAWS(t, "", http.StatusOK)
+	c := newTestClient(server, Config{Namespace: "Cron", Dimensions: map[string]string{"name": "JobName"}})
+
+	err := c.Put(context.Background(), map[string]string{"name": "backup", "env": "prod", "owner": ""}, []Datum{
+		{Name: "failed", Value: 1},
+		{Name: "duration_seconds", Value: 12.5, Unit: "Seconds", Timestamp: time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if len(*puts) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*puts))
+	}
+	put := (*puts)[0]
+	for key, want := range map[string]string{
+		"Action":                         "PutMetricData",
+		"Namespace":                      "Cron",
+		"MetricData.member.1.MetricName": "failed",
+		"MetricData.member.1.Value":      "1",
+		"MetricData.member.1.Dimensions.member.1.Name":  "env",
+		"MetricData.member.1.Dimensions.member.1.Value": "prod",
+		"MetricData.member.1.Dimensions.member.2.Name":  "JobName",
+		"MetricData.member.1.Dimensions.member.2.Value": "backup",
+		"MetricData.member.2.MetricName":                "duration_seconds",
+		"MetricData.member.2.Value":                     "12.5",
+		"MetricData.member.2.Unit":                      "Seconds",
+		"MetricData.member.2.Timestamp":                 "2024-05-01T02:00:00Z",
+	} {
+		if got := put.form.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if put.form.Has("MetricData.member.1.Timestamp") {
+		t.Error("Data without timestamp should be timestamped when received")
+	}
+	if put.form.Has("MetricData.member.1.Dimensions.member.3.Name") {
+		t.Error("Labels with an empty value should be skipped")
+	}
+	if !strings.Contains(put.authorization, "Credential=AKIDENV/") || !strings.Contains(put.authorization, "/us-east-2/monitoring/aws4_request") {
+		t.Errorf("Authorization = %q, want environment credentials for us-east-2", put.authorization)
+	}
+}
+
+// TestClientPutCredentialsFile tests the credentials of the files named by the _FILE environment variables,
+// read again by each put so rotated credentials are used
+func TestClientPutCredentialsFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, secretFile := filepath.Join(dir, "access-key-id"), filepath.Join(dir, "secret-access-key")
+	for path, content := range map[string]string{keyFile: "AKIDFILE\n", secretFile: "secret\n"} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_SESSION_TOKEN_FILE"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID_FILE", keyFile)
+	t.Setenv("AWS_SECRET_ACCESS_KEY_FILE", secretFile)
+	t.Setenv("AWS_REGION", "us-east-2")
+	server, puts := newFakeAWS(t, "", http.StatusOK)
+	c := newTestClient(server, Config{Namespace: "Cron"})
+
+	if err := c.Put(context.Background(), map[string]string{"name": "backup"}, []Datum{{Name: "failed", Value: 0}}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := os.WriteFile(keyFile, []byte("AKIDROTATED\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(context.Background(), map[string]string{"name": "backup"}, []Datum{{Name: "failed", Value: 0}}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	for i, want := range []string{"Credential=AKIDFILE/", "Credential=AKIDROTATED/"} {
+		if !strings.Contains((*puts)[i].authorization, want) {
+			t.Errorf("Authorization of put %d = %q, want %s", i, (*puts)[i].authorization, want)
+		}
+	}
+
+	if err := os.Remove(secretFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(context.Background(), map[string]string{"name": "backup"}, []Datum{{Name: "failed", Value: 0}}); err == nil {
+		t.Error("Put() with a missing credentials file succeeded")
+	}
+}
+
+// TestClientPutInstanceRole tests the credentials and region of the EC2 instance
+func TestClientPutInstanceRole(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+		t.Setenv(name, "")
+	}
+
+	tests := []struct {
+		name      string
+		role      string
+		status    int
+		wantError bool
+	}{
+		{name: "role", role: "cron-role", status: http.StatusOK},
+		{name: "no role", status: http.StatusOK, wantError: true},
+		{name: "access denied", role: "cron-role", status: http.StatusForbidden, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, puts := newFakeAWS(t, tt.role, tt.status)
+			c := newTestClient(server, Config{Namespace: "Cron"})
+			err := c.Put(context.Background(), map[string]string{"name": "backup"}, []Datum{{Name: "failed", Value: 0}})
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Put() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.role == "" {
+				if len(*puts) != 0 {
+					t.Errorf("got %d requests without credentials, want 0", len(*puts))
+				}
+				return
+			}
+			put := (*puts)[0]
+			if put.token != "session" {
+				t.Errorf("X-Amz-Security-Token = %q, want session", put.token)
+			}
+			if !strings.Contains(put.authorization, "Credential=ASIAROLE/") || !strings.Contains(put.authorization, "/eu-west-1/monitoring/") {
+				t.Errorf("Authorization = %q, want role credentials for eu-west-1", put.authorization)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package cloudwatch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// DefaultMetadataURL is the instance metadata service of EC2, serving the credentials of the instance IAM role
+const DefaultMetadataURL = "http://169.254.169.254"
+
+// Credentials are the AWS credentials signing the requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials, e.g. of an IAM role
+	SessionToken string
+}
+
+// envCredentials returns the credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables, or of the files named by the same variables with the
+// _FILE suffix, false if they are not set
+func envCredentials() (Credentials, bool, error) {
+	var creds Credentials
+	for _, v := range []struct {
+		env   string
+		value *string
+	}{
+		{env: "AWS_ACCESS_KEY_ID", value: &creds.AccessKeyID},
+		{env: "AWS_SECRET_ACCESS_KEY", value: &creds.SecretAccessKey},
+		{env: "AWS_SESSION_TOKEN", value: &creds.SessionToken},
+	} {
+		value, err := secret.Lookup("", v.env).Get()
+		if err != nil {
+			return Credentials{}, false, fmt.Errorf("%s: %w", v.env, err)
+		}
+		*v.value = value
+	}
+	return creds, creds.AccessKeyID != "" && creds.SecretAccessKey != "", nil
+}
+
+// envRegion returns the region of the AWS_REGION or AWS_DEFAULT_REGION environment variables
+func envRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// metadata reads the EC2 instance metadata service with IMDSv2 session tokens
+type metadata struct {
+	url    string
+	client *http.Client
+	token  string
+}
+
+// get returns the content of the metadata path, e.g. /latest/meta-data/placement/region
+func (m *metadata) get(ctx context.Context, path string) (string, error) {
+	if m.token == "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, m.url+"/latest/api/token", nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+		token, err := m.do(req)
+		if err != nil {
+			return "", err
+		}
+		m.token = token
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", m.token)
+	return m.do(req)
+}
+
+// do sends a request to the metadata service and returns its body
+func (m *metadata) do(req *http.Request) (string, error) {
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("instance metadata: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("instance metadata: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("instance metadata: unexpected status %s for %s", resp.Status, req.URL.Path)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// roleCredentials returns the temporary credentials of the IAM role of the instance
+func (m *metadata) roleCredentials(ctx context.Context) (Credentials, error) {
+	const rolesPath = "/latest/meta-data/iam/security-credentials/"
+	roles, err := m.get(ctx, rolesPath)
+	if err != nil {
+		return Credentials{}, err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(roles))
+	if !scanner.Scan() || scanner.Text() == "" {
+		return Credentials{}, fmt.Errorf("instance metadata: no IAM role attached to the instance")
+	}
+	content, err := m.get(ctx, rolesPath+scanner.Text())
+	if err != nil {
+		return Credentials{}, err
+	}
+	var role struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.Unmarshal([]byte(content), &role); err != nil {
+		return Credentials{}, fmt.Errorf("instance metadata: invalid credentials of role %s: %w", scanner.Text(), err)
+	}
+	return Credentials{AccessKeyID: role.AccessKeyID, SecretAccessKey: role.SecretAccessKey, SessionToken: role.Token}, nil
+}
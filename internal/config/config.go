@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// DefaultPath is the config file read when no other path is given
+const DefaultPath = "/etc/cronmgr/config.json"
+
+// ProfileEnv is the environment variable selecting the profile when --profile is not set
+const ProfileEnv = "CRONMGR_PROFILE"
+
+// File is the cronmgr config file, e.g.
+//
+//	{
+//	  "profiles": {
+//	    "prod": {"dir": "/var/lib/node_exporter", "pushgateway": "http://pushgateway:9091", "label": {"env": "prod"}},
+//	    "staging": {"dir": "/tmp/metrics", "label": {"env": "staging"}}
+//	  },
+//	  "ssh_commands": {
+//	    "backup": {"command": ["/usr/local/bin/backup", "--full"]},
+//	    "rotate": {"command": ["/usr/local/bin/rotate", "*"]}
+//	  }
+//	}
+type File struct {
+	// Profiles maps profile names to flag values, keyed by the long flag name
+	Profiles map[string]map[string]any `json:"profiles"`
+	// SSHCommands maps job names to the commands remote users may run with --ssh-force-command
+	SSHCommands map[string]SSHCommand `json:"ssh_commands"`
+}
+
+// SSHCommand is a command allowed by the ssh_commands allowlist
+type SSHCommand struct {
+	// Command is the command and its arguments, an argument * matches any single argument
+	Command []string `json:"command"`
+}
+
+// sshUnsafeChars are the characters a requested SSH command may not contain: it is not run by a shell,
+// so they are most likely an attempt to chain or redirect commands
+const sshUnsafeChars = "'\"\\`$;&|<>(){}*?[]~!#\n\r"
+
+// Load reads the config file at path
+func Load(fs afero.Fs, path string) (*File, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// Profile returns the flag values of the profile name, formatted as they are passed on the command line
+func (f *File) Profile(name string) (map[string]string, error) {
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, available: %s", name, strings.Join(slices.Sorted(maps.Keys(f.Profiles)), ", "))
+	}
+	values := make(map[string]string, len(profile))
+	for flag, value := range profile {
+		formatted, err := flagValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %s: %w", name, flag, err)
+		}
+		values[flag] = formatted
+	}
+	return values, nil
+}
+
+// flagValue formats a JSON value as a flag value: objects become key=value lists and arrays comma separated lists
+func flagValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			formatted, err := flagValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, formatted)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		pairs := make([]string, 0, len(v))
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			formatted, err := flagValue(v[key])
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, key+"="+formatted)
+		}
+		return strings.Join(pairs, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// MatchSSHCommand returns the job name and the command line of the ssh_commands entry allowing line, the
+// SSH_ORIGINAL_COMMAND requested by a remote user. The line is split on whitespace without any quoting.
+func (f *File) MatchSSHCommand(line string) (string, []string, error) {
+	if i := strings.IndexAny(line, sshUnsafeChars); i >= 0 {
+		return "", nil, fmt.Errorf("command %q contains %q", line, line[i])
+	}
+	argv := strings.Fields(line)
+	if len(argv) == 0 {
+		return "", nil, errors.New("no command requested, interactive sessions are not allowed")
+	}
+	for _, name := range slices.Sorted(maps.Keys(f.SSHCommands)) {
+		if f.SSHCommands[name].matches(argv) {
+			return name, argv, nil
+		}
+	}
+	return "", nil, fmt.Errorf("command %q is not allowed", line)
+}
+
+// matches tells whether argv is allowed by the command
+func (c SSHCommand) matches(argv []string) bool {
+	if len(c.Command) == 0 || len(argv) != len(c.Command) {
+		return false
+	}
+	for i, arg := range c.Command {
+		// The program itself must be named
+		if arg == "*" && i > 0 {
+			continue
+		}
+		if arg != argv[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// TestProfile tests that profile values are formatted as flag values
+func TestProfile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := `{
+  "profiles": {
+    "prod": {
+      "dir": "/var/lib/node_exporter",
+      "retries": 3,
+      "retry-jitter": 0.5,
+      "legacy-metrics": true,
+      "retry-on-exit-codes": [75, 111],
+      "label": {"env": "prod", "dc": "eu"}
+    },
+    "staging": {"dir": "/tmp/metrics"},
+    "broken": {"dir": null}
+  }
+}`
+	if err := afero.WriteFile(fs, "/etc/cronmgr/config.json", []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := Load(fs, "/etc/cronmgr/config.json")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		profile string
+		want    map[string]string
+		wantErr bool
+	}{
+		{profile: "prod", want: map[string]string{
+			"dir":                 "/var/lib/node_exporter",
+			"retries":             "3",
+			"retry-jitter":        "0.5",
+			"legacy-metrics":      "true",
+			"retry-on-exit-codes": "75,111",
+			"label":               "dc=eu,env=prod",
+		}},
+		{profile: "staging", want: map[string]string{"dir": "/tmp/metrics"}},
+		{profile: "broken", wantErr: true},
+		{profile: "dev", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			got, err := file.Profile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Profile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("Profile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoadErrors tests missing and malformed config files
+func TestLoadErrors(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/bad.json", []byte("profiles: prod"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/missing.json", "/bad.json"} {
+		if _, err := Load(fs, path); err == nil {
+			t.Errorf("Load(%s) error = nil, want error", path)
+		}
+	}
+}
+
+// TestMatchSSHCommand tests that only the commands of the ssh_commands allowlist are accepted
+func TestMatchSSHCommand(t *testing.T) {
+	file := &File{SSHCommands: map[string]SSHCommand{
+		"backup": {Command: []string{"/usr/local/bin/backup", "--full"}},
+		"rotate": {Command: []string{"/usr/local/bin/rotate", "*"}},
+		"any":    {Command: []string{"*"}},
+	}}
+	tests := []struct {
+		line     string
+		wantName string
+		wantArgv []string
+		wantErr  bool
+	}{
+		{line: "/usr/local/bin/backup --full", wantName: "backup", wantArgv: []string{"/usr/local/bin/backup", "--full"}},
+		{line: "  /usr/local/bin/backup   --full ", wantName: "backup", wantArgv: []string{"/usr/local/bin/backup", "--full"}},
+		{line: "/usr/local/bin/rotate nginx", wantName: "rotate", wantArgv: []string{"/usr/local/bin/rotate", "nginx"}},
+		{line: "/usr/local/bin/backup", wantErr: true},
+		{line: "/usr/local/bin/backup --full --dry-run", wantErr: true},
+		{line: "/usr/local/bin/rotate", wantErr: true},
+		{line: "/usr/local/bin/rotate nginx; rm -rf /", wantErr: true},
+		{line: "/usr/local/bin/rotate $(id)", wantErr: true},
+		{line: "/usr/local/bin/rotate '*'", wantErr: true},
+		{line: "/usr/local/bin/backup --full\nid", wantErr: true},
+		{line: "/bin/sh", wantErr: true},
+		{line: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			name, argv, err := file.MatchSSHCommand(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MatchSSHCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.wantName || !slices.Equal(argv, tt.wantArgv) {
+				t.Errorf("MatchSSHCommand() = %s %q, want %s %q", name, argv, tt.wantName, tt.wantArgv)
+			}
+		})
+	}
+}
+
+// TestLoadSSHCommands tests that the ssh_commands allowlist is read from the config file
+func TestLoadSSHCommands(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := `{"ssh_commands": {"backup": {"command": ["/usr/local/bin/backup", "--full"]}}}`
+	if err := afero.WriteFile(fs, "/config.json", []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := Load(fs, "/config.json")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if name, _, err := file.MatchSSHCommand("/usr/local/bin/backup --full"); err != nil || name != "backup" {
+		t.Errorf("MatchSSHCommand() = %s, %v, want backup", name, err)
+	}
+}
@@ -0,0 +1,147 @@
+package coredump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backtraceTimeout bounds the time gdb may take to write a backtrace
+const backtraceTimeout = 2 * time.Minute
+
+// Dump is a core dump collected after a crash
+type Dump struct {
+	// Core is the path of the core file
+	Core string
+	// Backtrace is the path of the backtraces of all threads, empty if they could not be written
+	Backtrace string
+}
+
+// Process is a crashed process whose core is collected
+type Process struct {
+	// PID is the process ID
+	PID int
+	// Executable is the path of the program the process ran
+	Executable string
+	// Dir is the working directory of the process, where relative core paths are written
+	Dir string
+}
+
+// expandPattern returns the glob matching the core files written for p by a core_pattern(5) pattern.
+// Specifiers unknown to cronmgr, e.g. the time of the dump, match anything.
+func expandPattern(pattern string, p Process, host string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' || i+1 == len(pattern) {
+			b.WriteString(escapeGlob(string(c)))
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case '%':
+			b.WriteString("%")
+		case 'p', 'P':
+			b.WriteString(strconv.Itoa(p.PID))
+		case 'e':
+			// The command name of the process, truncated by the kernel
+			name := filepath.Base(p.Executable)
+			if len(name) > 15 {
+				name = name[:15]
+			}
+			b.WriteString(escapeGlob(name))
+		case 'f':
+			b.WriteString(escapeGlob(filepath.Base(p.Executable)))
+		case 'E':
+			b.WriteString(escapeGlob(strings.ReplaceAll(p.Executable, "/", "!")))
+		case 'h':
+			b.WriteString(escapeGlob(host))
+		default:
+			b.WriteString("*")
+		}
+	}
+	return b.String()
+}
+
+// escapeGlob escapes the characters of s that are special in a glob
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// newest returns the most recently modified of the files matching glob
+func newest(glob string) (string, error) {
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return "", err
+	}
+	var path string
+	var modTime time.Time
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if path == "" || info.ModTime().After(modTime) {
+			path, modTime = match, info.ModTime()
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("no core file matches %s", glob)
+	}
+	return path, nil
+}
+
+// move moves the file src to dst, copying it across file systems
+func move(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// writeBacktrace writes the backtraces of all threads of core to path with gdb
+func writeBacktrace(executable, core, path string) error {
+	gdb, err := exec.LookPath("gdb")
+	if err != nil {
+		return errors.New("gdb is not installed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), backtraceTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, gdb, "-batch", "-nx", "-ex", "thread apply all bt", executable, core).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("gdb: %w", err)
+	}
+	return os.WriteFile(path, out, 0600)
+}
@@ -0,0 +1,115 @@
+//go:build linux
+
+package coredump
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Kernel settings telling where cores are written
+const (
+	corePatternFile = "/proc/sys/kernel/core_pattern"
+	coreUsesPIDFile = "/proc/sys/kernel/core_uses_pid"
+)
+
+// Enable raises the limit of the size of core dumps to its maximum, so the commands started afterwards
+// dump their core when they crash
+func Enable() error {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &limit); err != nil {
+		return err
+	}
+	limit.Cur = limit.Max
+	return syscall.Setrlimit(syscall.RLIMIT_CORE, &limit)
+}
+
+// Collect moves the core dumped by the crashed process p into dir as core.<pid>, and writes the
+// backtraces of its threads next to it as backtrace.<pid>.txt if gdb is installed. Cores piped to
+// systemd-coredump are exported with coredumpctl, which also writes the backtraces. If only the backtraces
+// could not be written, the dump is returned with the error and an empty Backtrace.
+func Collect(p Process, dir string) (Dump, error) {
+	content, err := os.ReadFile(corePatternFile)
+	if err != nil {
+		return Dump{}, err
+	}
+	pattern := strings.TrimSpace(string(content))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Dump{}, err
+	}
+	dump := Dump{
+		Core:      filepath.Join(dir, "core."+strconv.Itoa(p.PID)),
+		Backtrace: filepath.Join(dir, "backtrace."+strconv.Itoa(p.PID)+".txt"),
+	}
+	if helper, ok := strings.CutPrefix(pattern, "|"); ok {
+		if !strings.Contains(helper, "systemd-coredump") {
+			program, _, _ := strings.Cut(strings.TrimSpace(helper), " ")
+			return Dump{}, fmt.Errorf("cores are piped to %s, only cores written to files or systemd-coredump are collected", program)
+		}
+		return collectCoredumpctl(p, dump)
+	}
+
+	glob := expandPattern(pattern, p, hostname())
+	if !strings.Contains(pattern, "%p") && !strings.Contains(pattern, "%P") {
+		if uses, err := os.ReadFile(coreUsesPIDFile); err == nil && strings.TrimSpace(string(uses)) == "1" {
+			glob += "." + strconv.Itoa(p.PID)
+		}
+	}
+	if !filepath.IsAbs(glob) {
+		dir := p.Dir
+		if dir == "" {
+			if dir, err = os.Getwd(); err != nil {
+				return Dump{}, err
+			}
+		}
+		glob = filepath.Join(escapeGlob(dir), glob)
+	}
+	core, err := newest(glob)
+	if err != nil {
+		return Dump{}, err
+	}
+	if err := move(core, dump.Core); err != nil {
+		return Dump{}, fmt.Errorf("failed to move the core: %w", err)
+	}
+	if err := writeBacktrace(p.Executable, dump.Core, dump.Backtrace); err != nil {
+		dump.Backtrace = ""
+		return dump, err
+	}
+	return dump, nil
+}
+
+// collectCoredumpctl exports the core of p kept by systemd-coredump with its information, which includes
+// the backtraces
+func collectCoredumpctl(p Process, dump Dump) (Dump, error) {
+	coredumpctl, err := exec.LookPath("coredumpctl")
+	if err != nil {
+		return Dump{}, errors.New("cores are piped to systemd-coredump and coredumpctl is not installed")
+	}
+	pid := strconv.Itoa(p.PID)
+	if out, err := exec.Command(coredumpctl, "--no-pager", "dump", pid, "--output", dump.Core).CombinedOutput(); err != nil {
+		return Dump{}, fmt.Errorf("coredumpctl dump: %w: %s", err, bytes.TrimSpace(out))
+	}
+	info, err := exec.Command(coredumpctl, "--no-pager", "info", pid).Output()
+	if err != nil {
+		dump.Backtrace = ""
+		return dump, fmt.Errorf("coredumpctl info: %w", err)
+	}
+	if err := os.WriteFile(dump.Backtrace, info, 0600); err != nil {
+		dump.Backtrace = ""
+		return dump, err
+	}
+	return dump, nil
+}
+
+// hostname returns the name of the host, empty if it is unknown
+func hostname() string {
+	host, _ := os.Hostname()
+	return host
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package coredump
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/job"
+)
+
+// TestCollect tests collecting the core dumped by a crashed shell
+func TestCollect(t *testing.T) {
+	pattern, err := os.ReadFile(corePatternFile)
+	if err != nil || strings.HasPrefix(string(pattern), "|") {
+		t.Skipf("cores are not written to files: %s", pattern)
+	}
+	if err := Enable(); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	dir := t.TempDir()
+	cmd := exec.Command("sh", "-c", "kill -SEGV $$")
+	cmd.Dir = dir
+	status, ok := job.ExitStatusFromError(cmd.Run())
+	if !ok || !status.CoreDumped {
+		t.Skipf("no core dumped: %+v", status)
+	}
+
+	dest := filepath.Join(t.TempDir(), "artifacts")
+	dump, err := Collect(Process{PID: cmd.Process.Pid, Executable: cmd.Path, Dir: dir}, dest)
+	if err != nil && dump.Core == "" {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if dump.Core != filepath.Join(dest, "core."+strconv.Itoa(cmd.Process.Pid)) {
+		t.Errorf("Core = %s", dump.Core)
+	}
+	if info, err := os.Stat(dump.Core); err != nil || info.Size() == 0 {
+		t.Errorf("core not collected: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("core left in the working directory: %v", entries)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package coredump
+
+import "errors"
+
+// Enable does nothing, cores are only collected on Linux
+func Enable() error {
+	return nil
+}
+
+// Collect returns errors.ErrUnsupported, cores are only collected on Linux
+func Collect(p Process, dir string) (Dump, error) {
+	return Dump{}, errors.ErrUnsupported
+}
@@ -0,0 +1,27 @@
+package coredump
+
+import "testing"
+
+// TestExpandPattern tests turning core patterns into globs of the core files of a process
+func TestExpandPattern(t *testing.T) {
+	p := Process{PID: 4242, Executable: "/opt/app/bin/report-generator-daily"}
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "core", want: "core"},
+		{pattern: "core.%p", want: "core.4242"},
+		{pattern: "/var/crash/%e.%p.%t", want: "/var/crash/report-generato.4242.*"},
+		{pattern: "/var/crash/%f-%h-%s", want: "/var/crash/report-generator-daily-web-1-*"},
+		{pattern: "/cores/%E", want: "/cores/!opt!app!bin!report-generator-daily"},
+		{pattern: "core%%%p[1]", want: `core%4242\[1]`},
+		{pattern: "core%", want: "core%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := expandPattern(tt.pattern, p, "web-1"); got != tt.want {
+				t.Errorf("expandPattern() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// KeySize is the size of the AES-256 keys used to encrypt data at rest
+const KeySize = 32
+
+// Cipher encrypts data at rest with AES-256-GCM.
+// Encrypted files consist of lines, each holding the base64 of a random nonce followed by the sealed data.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a Cipher using key, which must be KeySize bytes long
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// ParseKey decodes a key given as hex or base64 text, or as raw bytes
+func ParseKey(content []byte) ([]byte, error) {
+	text := bytes.TrimSpace(content)
+	if key, err := hex.DecodeString(string(text)); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(string(text)); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if len(content) == KeySize {
+		return content, nil
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes, as hex, base64 or raw bytes", KeySize)
+}
+
+// KeyFromFile reads the key stored in the file at path
+func KeyFromFile(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(content)
+}
+
+// KeyFromCommand runs command with the shell and reads the key from its output,
+// e.g. to decrypt a data key with a KMS command line client
+func KeyFromCommand(command string) ([]byte, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("key command failed: %w", err)
+	}
+	return ParseKey(output)
+}
+
+// SealLine encrypts plaintext into a line of text, without the trailing newline
+func (c *Cipher) SealLine(plaintext []byte) []byte {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, plaintext, nil)
+	line := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(line, sealed)
+	return line
+}
+
+// OpenLine decrypts a line produced by SealLine
+func (c *Cipher) OpenLine(line []byte) ([]byte, error) {
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(sealed, bytes.TrimSpace(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted line: %w", err)
+	}
+	sealed = sealed[:n]
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("invalid encrypted line: too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt line, wrong key or corrupted data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Writer encrypts each write to an underlying writer as one line
+type Writer struct {
+	cipher *Cipher
+	w      io.Writer
+}
+
+// NewWriter returns a Writer encrypting to w
+func (c *Cipher) NewWriter(w io.Writer) *Writer {
+	return &Writer{cipher: c, w: w}
+}
+
+// Write encrypts p as one line
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	line := append(w.cipher.SealLine(p), '\n')
+	if _, err := w.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Decrypt writes the decrypted content of the encrypted lines read from r to w
+func (c *Cipher) Decrypt(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	// A line holds a whole write, which may be larger than the default token size
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		plaintext, err := c.OpenLine(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
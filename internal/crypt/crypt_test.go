@@ -0,0 +1,95 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKey is a valid key for tests
+var testKey = bytes.Repeat([]byte{7}, KeySize)
+
+// TestParseKey tests the accepted key encodings
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   []byte
+		wantError bool
+	}{
+		{name: "hex", content: []byte(hex.EncodeToString(testKey) + "\n")},
+		{name: "base64", content: []byte(base64.StdEncoding.EncodeToString(testKey))},
+		{name: "raw", content: testKey},
+		{name: "too short", content: []byte("secret"), wantError: true},
+		{name: "short hex", content: []byte("0707"), wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.content)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseKey() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !tt.wantError && !bytes.Equal(key, testKey) {
+				t.Errorf("ParseKey() = %x, want %x", key, testKey)
+			}
+		})
+	}
+}
+
+// TestKeySources tests reading keys from a file and from a command
+func TestKeySources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(testKey)), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if key, err := KeyFromFile(path); err != nil || !bytes.Equal(key, testKey) {
+		t.Errorf("KeyFromFile() = %x, %v, want %x", key, err, testKey)
+	}
+	if key, err := KeyFromCommand("cat " + path); err != nil || !bytes.Equal(key, testKey) {
+		t.Errorf("KeyFromCommand() = %x, %v, want %x", key, err, testKey)
+	}
+	if _, err := KeyFromCommand("exit 1"); err == nil {
+		t.Error("KeyFromCommand() expected error for failing command")
+	}
+}
+
+// TestWriterDecrypt tests that encrypted writes decrypt to the original content
+func TestWriterDecrypt(t *testing.T) {
+	c, err := NewCipher(testKey)
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+
+	var encrypted bytes.Buffer
+	w := c.NewWriter(&encrypted)
+	for _, chunk := range []string{"first line\nsecond ", "line\n", ""} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if strings.Contains(encrypted.String(), "line") {
+		t.Fatalf("output is not encrypted: %s", encrypted.String())
+	}
+	if lines := strings.Count(encrypted.String(), "\n"); lines != 2 {
+		t.Errorf("encrypted output has %d lines, want one per non-empty write", lines)
+	}
+
+	var decrypted bytes.Buffer
+	if err := c.Decrypt(bytes.NewReader(encrypted.Bytes()), &decrypted); err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if decrypted.String() != "first line\nsecond line\n" {
+		t.Errorf("Decrypt() = %q", decrypted.String())
+	}
+
+	other, err := NewCipher(bytes.Repeat([]byte{8}, KeySize))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	if err := other.Decrypt(bytes.NewReader(encrypted.Bytes()), &bytes.Buffer{}); err == nil {
+		t.Error("Decrypt() with another key expected error")
+	}
+}
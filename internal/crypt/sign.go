@@ -0,0 +1,94 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Signer signs the results cronmgr delivers with an ed25519 key, so their consumers can verify they were
+// sent by the cronmgr of a host and not forged or modified
+type Signer struct {
+	key ed25519.PrivateKey
+	id  string
+}
+
+// NewSigner creates a Signer with key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, id: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// ParseSigningKey decodes an ed25519 private key given as PKCS #8 PEM, e.g. written by
+// openssl genpkey -algorithm ed25519, or as a 32 byte seed in hex, base64 or raw bytes
+func ParseSigningKey(content []byte) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode(content); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("signing key: %w", err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("signing key is not an ed25519 key")
+		}
+		return edKey, nil
+	}
+	text := bytes.TrimSpace(content)
+	if seed, err := hex.DecodeString(string(text)); err == nil && len(seed) == ed25519.SeedSize {
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if seed, err := base64.StdEncoding.DecodeString(string(text)); err == nil && len(seed) == ed25519.SeedSize {
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if len(content) == ed25519.SeedSize {
+		return ed25519.NewKeyFromSeed(content), nil
+	}
+	return nil, fmt.Errorf("signing key must be an ed25519 PKCS #8 PEM key or a %d byte seed, as hex, base64 or raw bytes", ed25519.SeedSize)
+}
+
+// SignerFromFile creates a Signer with the key stored in the file at path
+func SignerFromFile(path string) (*Signer, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseSigningKey(content)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(key), nil
+}
+
+// KeyID identifies the public key, the hex of the first 8 bytes of its SHA-256, so consumers can pick the
+// key to verify with when keys are rotated
+func KeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyID returns the ID of the public key of the signer
+func (s *Signer) KeyID() string {
+	return s.id
+}
+
+// Public returns the public key verifying the signatures
+func (s *Signer) Public() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign returns the base64 signature of data
+func (s *Signer) Sign(data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data))
+}
+
+// Verify reports whether signature is a signature of data by the key of the signer
+func (s *Signer) Verify(data []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	return err == nil && ed25519.Verify(s.Public(), data, sig)
+}
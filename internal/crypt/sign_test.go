@@ -0,0 +1,83 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+)
+
+// testSeed is the seed of a valid signing key for tests
+var testSeed = bytes.Repeat([]byte{9}, ed25519.SeedSize)
+
+// pemKey returns key encoded as PKCS #8 PEM
+func pemKey(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// TestParseSigningKey tests the accepted signing key encodings
+func TestParseSigningKey(t *testing.T) {
+	want := ed25519.NewKeyFromSeed(testSeed)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		content   []byte
+		wantError bool
+	}{
+		{name: "pem", content: pemKey(t, want)},
+		{name: "hex seed", content: []byte(hex.EncodeToString(testSeed) + "\n")},
+		{name: "base64 seed", content: []byte(base64.StdEncoding.EncodeToString(testSeed))},
+		{name: "raw seed", content: testSeed},
+		{name: "not ed25519", content: pemKey(t, ecKey), wantError: true},
+		{name: "too short", content: []byte("secret"), wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseSigningKey(tt.content)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseSigningKey() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err == nil && !key.Equal(want) {
+				t.Error("ParseSigningKey() returned another key")
+			}
+		})
+	}
+}
+
+// TestSignerVerify tests verifying signatures and rejecting modified data
+func TestSignerVerify(t *testing.T) {
+	signer := NewSigner(ed25519.NewKeyFromSeed(testSeed))
+	data := []byte(`{"name":"backup","status":"failed"}`)
+	signature := signer.Sign(data)
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(signer.Public(), data, sig) {
+		t.Fatalf("Sign() = %q, want a base64 ed25519 signature", signature)
+	}
+	if !signer.Verify(data, signature) {
+		t.Error("Verify() of the signed data = false")
+	}
+	if signer.Verify([]byte(`{"name":"backup","status":"success"}`), signature) {
+		t.Error("Verify() of modified data = true")
+	}
+	if signer.Verify(data, "not base64") {
+		t.Error("Verify() of an invalid signature = true")
+	}
+	if id := signer.KeyID(); len(id) != 16 || id != KeyID(signer.Public()) {
+		t.Errorf("KeyID() = %q, want 16 hex digits", id)
+	}
+}
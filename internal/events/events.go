@@ -0,0 +1,115 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SocketPrefix marks a destination as a unix socket, e.g. unix:/run/vector/cronmgr.sock
+const SocketPrefix = "unix:"
+
+// socketTimeout bounds sending an event to a socket, a stalled reader must not hold the job
+const socketTimeout = 2 * time.Second
+
+// Lifecycle events of a run
+const (
+	Started  = "started"
+	Retrying = "retrying"
+	Timeout  = "timeout"
+	Skipped  = "skipped"
+	Finished = "finished"
+)
+
+// Event is a lifecycle event of a run, written as one JSON line
+type Event struct {
+	Time time.Time `json:"time"`
+	// Event is the kind of event: started, retrying, timeout, skipped or finished
+	Event string `json:"event"`
+	Name  string `json:"name"`
+	// Owner is the owner the metrics of the job are sharded by, empty if they are not
+	Owner string `json:"owner,omitempty"`
+	RunID string `json:"run_id"`
+	Host  string `json:"host"`
+	// PID is the process ID of the cronmgr process running the job
+	PID int `json:"pid"`
+	// Attempt is the attempt the event is about, for retrying and timeout events
+	Attempt int `json:"attempt,omitempty"`
+	// ExitCode is the exit code of the failed attempt or of the run, for retrying and finished events
+	ExitCode *int `json:"exit_code,omitempty"`
+	// DelaySeconds is the delay before the next attempt, for retrying events
+	DelaySeconds float64 `json:"delay_seconds,omitempty"`
+	// Limit is the time limit that killed the attempt, attempt or deadline, for timeout events
+	Limit string `json:"limit,omitempty"`
+	// Reason is why the run was skipped, for skipped events
+	Reason string `json:"reason,omitempty"`
+	// Status and ErrorType are the status the run was counted with in runs_total, for finished events
+	Status    string `json:"status,omitempty"`
+	ErrorType string `json:"error_type,omitempty"`
+	// DurationSeconds is the time the command took to run, for finished events
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	// Attempts is the number of times the command was started, for finished events
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Writer writes events as NDJSON to a file shared by the cronmgr processes of a host, or to a unix socket
+type Writer struct {
+	path   string
+	socket bool
+}
+
+// NewWriter creates a Writer appending to the file dest, or sending to the unix socket of dest with SocketPrefix
+func NewWriter(dest string) *Writer {
+	if path, ok := strings.CutPrefix(dest, SocketPrefix); ok {
+		return &Writer{path: path, socket: true}
+	}
+	return &Writer{path: dest}
+}
+
+// Write writes event as one line
+func (w *Writer) Write(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if w.socket {
+		return w.send(line)
+	}
+	return w.append(line)
+}
+
+// append appends line to the file with a single write, so lines of concurrent jobs do not interleave.
+// The file is opened for each event, so that it can be rotated by moving it.
+func (w *Writer) append(line []byte) error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// send sends line to a stream socket, or as a datagram to a datagram socket
+func (w *Writer) send(line []byte) error {
+	conn, err := net.DialTimeout("unix", w.path, socketTimeout)
+	if errors.Is(err, syscall.EPROTOTYPE) {
+		conn, err = net.DialTimeout("unixgram", w.path, socketTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetWriteDeadline(time.Now().Add(socketTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(line)
+	return err
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWriterFile tests appending events to a file as JSON lines
+func TestWriterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	w := NewWriter(path)
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	exitCode := 1
+	for _, event := range []Event{
+		{Time: start, Event: Started, Name: "backup", RunID: "run-1", Host: "web-1", PID: 42},
+		{Time: start.Add(time.Minute), Event: Finished, Name: "backup", RunID: "run-1", Host: "web-1", PID: 42,
+			ExitCode: &exitCode, Status: "failed", ErrorType: "job", DurationSeconds: 60, Attempts: 1},
+	} {
+		if err := w.Write(event); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"time":"2024-05-01T02:00:00Z","event":"started","name":"backup","run_id":"run-1","host":"web-1","pid":42}
+{"time":"2024-05-01T02:01:00Z","event":"finished","name":"backup","run_id":"run-1","host":"web-1","pid":42,"exit_code":1,"status":"failed","error_type":"job","duration_seconds":60,"attempts":1}
+`
+	if string(content) != want {
+		t.Errorf("events file =\n%s\nwant\n%s", content, want)
+	}
+}
+
+// TestWriterSocket tests sending events to stream and datagram unix sockets
+func TestWriterSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	t.Run("stream", func(t *testing.T) {
+		path := filepath.Join(dir, "stream.sock")
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			t.Skipf("unix sockets unavailable: %v", err)
+		}
+		defer func() { _ = listener.Close() }()
+		received := make(chan string, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			received <- line
+		}()
+
+		if err := NewWriter(SocketPrefix + path).Write(Event{Event: Started, Name: "backup"}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		checkLine(t, <-received)
+	})
+
+	t.Run("datagram", func(t *testing.T) {
+		path := filepath.Join(dir, "datagram.sock")
+		conn, err := net.ListenPacket("unixgram", path)
+		if err != nil {
+			t.Skipf("unix datagram sockets unavailable: %v", err)
+		}
+		defer func() { _ = conn.Close() }()
+
+		if err := NewWriter(SocketPrefix + path).Write(Event{Event: Started, Name: "backup"}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		buf := make([]byte, 4096)
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom() error = %v", err)
+		}
+		checkLine(t, string(buf[:n]))
+	})
+}
+
+// checkLine checks that line is the JSON line of a started event of backup
+func checkLine(t *testing.T, line string) {
+	t.Helper()
+	var event Event
+	if err := json.Unmarshal([]byte(line), &event); err != nil || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("invalid event line %q: %v", line, err)
+	}
+	if event.Event != Started || event.Name != "backup" {
+		t.Errorf("event = %+v, want the started event of backup", event)
+	}
+}
@@ -1,13 +1,30 @@
 package exporter
 
 import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/alswl/cron-manager/internal/fileperm"
 	"github.com/spf13/afero"
 )
 
+// helpDegraded is the HELP text of the degraded metric
+const helpDegraded = "Whether an output of the job was redirected because writing it was denied (1 = degraded)"
+
+// helpLegacy is the HELP text of the series in the legacy cronmanager schema
+const helpLegacy = "Cron job execution metrics"
+
 // config holds configuration for Exporter (package-private)
 type config struct {
 	// exporterDir is the directory for Prometheus exporter files
@@ -27,6 +44,25 @@ type config struct {
 	// useOsLock indicates whether to use real file system locking
 	// Default is true
 	useOsLock bool
+	// owner shards metrics into a file per owner and labels them with it
+	// Default is "" (a single shared file)
+	owner string
+	// labels are added to every series, e.g. the environment of the host
+	// Default is nil (no additional labels)
+	labels map[string]string
+	// fileMode is the permission of the exporter file
+	// Default is 0 (0644 before umask)
+	fileMode os.FileMode
+	// fallbackDir is the directory metrics are written to when writes to the exporter directory are denied
+	// Default is "" (no fallback)
+	fallbackDir string
+	// shards spreads the series of the jobs over this many files by a hash of the job name
+	// Default is 0 (a single file)
+	shards int
+	// maxBytes and maxSeries are the size and series count of the exporter file over which CheckSize warns
+	// Default is 0 (no limit)
+	maxBytes  int64
+	maxSeries int
 }
 
 // defaultConfig returns a config with default values
@@ -81,10 +117,82 @@ func WithFileSystem(fs afero.Fs) Option {
 	}
 }
 
+// WithFileMode sets the permission of the exporter file, e.g. 0640 so only the collector's group can read it
+func WithFileMode(mode os.FileMode) Option {
+	return func(c *config) {
+		c.fileMode = mode
+	}
+}
+
+// WithFallbackDir sets a directory metrics are written to when writes to the exporter directory
+// are denied, e.g. by an SELinux or AppArmor policy
+func WithFallbackDir(dir string) Option {
+	return func(c *config) {
+		c.fallbackDir = dir
+	}
+}
+
+// WithShards spreads the series of the jobs over n files by a hash of the job name (e.g. "crons_shard3.prom"),
+// so hosts running thousands of jobs do not rewrite one large file on every write. 0 or 1 writes a single file.
+func WithShards(n int) Option {
+	return func(c *config) {
+		c.shards = n
+	}
+}
+
+// WithSizeLimit sets the size in bytes and the series count of the exporter file over which CheckSize warns,
+// 0 disables either limit
+func WithSizeLimit(maxBytes int64, maxSeries int) Option {
+	return func(c *config) {
+		c.maxBytes = maxBytes
+		c.maxSeries = maxSeries
+	}
+}
+
+// WithOwner writes metrics to a separate file for the owner, labeled with owner="<owner>",
+// so teams sharing a host can have separate file permissions and cannot clobber each other's metrics
+func WithOwner(owner string) Option {
+	return func(c *config) {
+		c.owner = owner
+	}
+}
+
+// WithLabels adds constant labels to every series, e.g. env="prod", see ValidateLabels
+func WithLabels(labels map[string]string) Option {
+	return func(c *config) {
+		c.labels = labels
+	}
+}
+
+// labelNamePattern matches valid Prometheus label names
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// jobShardPattern matches the names of the job shards of shardPaths without their extension
+var jobShardPattern = regexp.MustCompile(`_shard[0-9]+$`)
+
+// ValidateLabels checks that labels can be passed to WithLabels: their names must be valid
+// Prometheus label names, and not name or owner, which are set by the exporter itself
+func ValidateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if name == "name" || name == "owner" {
+			return fmt.Errorf("label %q is reserved", name)
+		}
+	}
+	return nil
+}
+
 // Exporter manages Prometheus metric export configuration and operations
 type Exporter struct {
 	config       config        // Immutable configuration (package-private)
 	metricWriter *MetricWriter // Writer for low-level metric operations
+
+	mu        sync.Mutex
+	degraded  bool  // metrics are written to the fallback directory
+	diagnosed bool  // a failed write was logged, further ones are not
+	err       error // the first write that failed
 }
 
 // NewExporter creates a new Exporter instance with default settings
@@ -94,9 +202,11 @@ func NewExporter(opts ...Option) *Exporter {
 	for _, opt := range opts {
 		opt(&config)
 	}
+	metricWriter := NewMetricWriter(config.fs, config.useOsLock)
+	metricWriter.fileMode = config.fileMode
 	return &Exporter{
 		config:       config,
-		metricWriter: NewMetricWriter(config.fs, config.useOsLock),
+		metricWriter: metricWriter,
 	}
 }
 
@@ -105,10 +215,67 @@ func (e *Exporter) IsMetricDisabled() bool {
 	return e.config.metricDisabled
 }
 
+// MetricPrefix returns the base metric name prefix (default: "crontab")
+func (e *Exporter) MetricPrefix() string {
+	return e.config.metricName
+}
+
+// FullMetricName returns metricName with the metric prefix prepended,
+// unless it already starts with the prefix
+func (e *Exporter) FullMetricName(metricName string) string {
+	// Get base metric prefix from config (default: "crontab")
+	basePrefix := e.config.metricName
+
+	// If metricName doesn't start with base prefix, prepend it
+	if !strings.HasPrefix(metricName, basePrefix) {
+		return basePrefix + "_" + metricName
+	}
+	return metricName
+}
+
+// Owner returns the owner metrics are sharded by, empty if they are not
+func (e *Exporter) Owner() string {
+	return e.config.owner
+}
+
+// ConstLabels returns the labels added to every series, including the owner label when sharding by owner
+func (e *Exporter) ConstLabels() map[string]string {
+	return e.withConstLabels(map[string]string{})
+}
+
 // GetExporterPath returns the path to the Prometheus exporter file.
 // Priority for directory: config.exporterDir > COLLECTOR_TEXTFILE_PATH env var > default path
-// Filename: config.exporterFilename (default: "crons.prom")
+// Filename: config.exporterFilename (default: "crons.prom"), with the owner appended
+// before the extension when sharding by owner (e.g. "crons_team-a.prom").
+// With WithShards, the series of each job are written to a shard of this file instead.
 func (e *Exporter) GetExporterPath() string {
+	return filepath.Join(e.exporterDir(), e.shardFilename(e.config.owner))
+}
+
+// shardPaths returns the path of GetExporterPath followed by those of the shards, when sharding by job
+func (e *Exporter) shardPaths() []string {
+	paths := []string{e.GetExporterPath()}
+	filename := e.shardFilename(e.config.owner)
+	ext := filepath.Ext(filename)
+	for i := 0; i < e.config.shards && e.config.shards > 1; i++ {
+		paths = append(paths, filepath.Join(e.exporterDir(), strings.TrimSuffix(filename, ext)+"_shard"+strconv.Itoa(i)+ext))
+	}
+	return paths
+}
+
+// jobPath returns the path of the exporter file the series of the job jobName are written to, the path of
+// GetExporterPath unless sharding by job
+func (e *Exporter) jobPath(jobName string) string {
+	if e.config.shards <= 1 || jobName == "" {
+		return e.GetExporterPath()
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(jobName))
+	return e.shardPaths()[1+int(h.Sum32()%uint32(e.config.shards))]
+}
+
+// exporterDir returns the directory of the Prometheus exporter file
+func (e *Exporter) exporterDir() string {
 	var exporterDir string
 
 	// Priority 1: Custom directory from config
@@ -124,10 +291,74 @@ func (e *Exporter) GetExporterPath() string {
 		}
 	}
 
+	return exporterDir
+}
+
+// shardFilename returns the exporter filename for owner, the configured filename if owner is empty
+func (e *Exporter) shardFilename(owner string) string {
 	// Use filename from config (default is "crons.prom")
 	filename := e.config.exporterFilename
+	if owner == "" {
+		return filename
+	}
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "_" + sanitizeOwner(owner) + ext
+}
+
+// sanitizeOwner replaces characters that are unsafe in filenames with underscores
+func sanitizeOwner(owner string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, owner)
+}
+
+// PruneShards removes owner shard files that were not written for longer than olderThan,
+// e.g. of teams that no longer run jobs on the host. It returns the removed paths. The job shards of
+// WithShards are kept, they may only hold the series of jobs running less often than olderThan.
+func (e *Exporter) PruneShards(olderThan time.Duration) ([]string, error) {
+	dir := e.exporterDir()
+	ext := filepath.Ext(e.config.exporterFilename)
+	prefix := strings.TrimSuffix(e.config.exporterFilename, ext) + "_"
+	entries, err := afero.ReadDir(e.config.fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var removed []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || filepath.Ext(name) != ext || !entry.ModTime().Before(cutoff) {
+			continue
+		}
+		if jobShardPattern.MatchString(strings.TrimSuffix(name, ext)) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := e.config.fs.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
 
-	return filepath.Join(exporterDir, filename)
+// withConstLabels returns labels with the constant labels and the owner label, when sharding by owner, added.
+// Labels of the series take precedence over constant labels of the same name.
+func (e *Exporter) withConstLabels(labels map[string]string) map[string]string {
+	if e.config.owner == "" && len(e.config.labels) == 0 {
+		return labels
+	}
+	// Copy, callers may reuse their map
+	result := make(map[string]string, len(e.config.labels)+len(labels)+1)
+	maps.Copy(result, e.config.labels)
+	maps.Copy(result, labels)
+	if e.config.owner != "" {
+		result["owner"] = e.config.owner
+	}
+	return result
 }
 
 // writeMetric writes a metric to the Prometheus exporter file
@@ -143,17 +374,85 @@ func (e *Exporter) writeMetric(metricName string, metricType MetricType, jobName
 		return
 	}
 
-	// Get base metric prefix from config (default: "crontab")
-	basePrefix := e.config.metricName
+	fullMetricName := e.FullMetricName(metricName)
 
-	// If metricName doesn't start with base prefix, prepend it
-	fullMetricName := metricName
-	if !strings.HasPrefix(metricName, basePrefix) {
-		fullMetricName = basePrefix + "_" + metricName
+	e.write(jobName, func(path string) error {
+		return e.metricWriter.WriteMetric(path, fullMetricName, metricType, jobName, e.withConstLabels(labels), value, help)
+	})
+}
+
+// writePath returns the path the metrics of the job jobName are written to, in the fallback directory once degraded
+func (e *Exporter) writePath(jobName string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.degraded {
+		return filepath.Join(e.config.fallbackDir, filepath.Base(e.jobPath(jobName)))
+	}
+	return e.jobPath(jobName)
+}
+
+// write runs fn against the exporter file. Failures are logged and kept for Err instead of aborting the run;
+// a denied write switches to the fallback directory, if configured, and is retried there.
+func (e *Exporter) write(jobName string, fn func(path string) error) {
+	path := e.writePath(jobName)
+	err := fn(path)
+	if err == nil {
+		return
+	}
+	e.diagnose(path, err)
+	if errors.Is(err, fs.ErrPermission) && e.degrade(jobName) {
+		path = e.writePath(jobName)
+		if err = fn(path); err == nil {
+			return
+		}
+		e.diagnose(path, err)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Err returns the error of the first metric write that failed, even in the fallback directory, nil if all
+// succeeded. Failed writes never stop the caller, which checks Err to report them.
+func (e *Exporter) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// diagnose logs why a write failed, only once so the progress ticker does not flood the log
+func (e *Exporter) diagnose(path string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.diagnosed {
+		return
+	}
+	e.diagnosed = true
+	log.Print(fileperm.DiagnoseWriteError(path, err))
+}
+
+// degrade switches to the fallback directory and marks the job as degraded there.
+// It returns false if there is no fallback directory or the exporter already degraded.
+func (e *Exporter) degrade(jobName string) bool {
+	e.mu.Lock()
+	if e.config.fallbackDir == "" || e.degraded {
+		e.mu.Unlock()
+		return false
 	}
+	e.degraded = true
+	e.diagnosed = false
+	e.mu.Unlock()
+
+	log.Printf("Writing metrics to fallback directory %s", e.config.fallbackDir)
+	e.WriteDegraded(jobName, "metrics")
+	return true
+}
 
-	exporterPath := e.GetExporterPath()
-	e.metricWriter.WriteMetric(exporterPath, fullMetricName, metricType, jobName, labels, value, help)
+// WriteDegraded marks an output of the job, e.g. "metrics" or "log", as redirected because writing it was denied
+func (e *Exporter) WriteDegraded(jobName string, component string) {
+	e.writeMetric("degraded", MetricTypeGauge, jobName, map[string]string{"component": component}, "1", helpDegraded)
 }
 
 // WriteToExporter writes a metric to the Prometheus exporter file (legacy API with dimension label)
@@ -193,16 +492,40 @@ func (e *Exporter) WriteToExporter(jobName string, label string, metric string)
 	e.writeMetric(metricName, MetricTypeGauge, jobName, nil, metric, help)
 }
 
+// WriteLegacy writes a series in the schema of the original cronmanager, {prefix}{name="...",dimension="..."},
+// for dashboards and alerts not migrated to the per-metric names yet
+func (e *Exporter) WriteLegacy(jobName string, dimension string, value string) {
+	e.writeMetric(e.config.metricName, MetricTypeGauge, jobName, map[string]string{"dimension": dimension}, value, helpLegacy)
+}
+
 // WriteGauge writes a gauge metric to the Prometheus exporter file
 func (e *Exporter) WriteGauge(metricName string, jobName string, value string, help string) {
 	e.writeMetric(metricName, MetricTypeGauge, jobName, nil, value, help)
 }
 
+// WriteGaugeAt writes a gauge metric with an explicit sample timestamp, so the sample is
+// attributed to the time it describes instead of the scrape time.
+// Note: node_exporter's textfile collector rejects samples with timestamps.
+func (e *Exporter) WriteGaugeAt(metricName string, jobName string, value string, timestamp time.Time, help string) {
+	e.writeMetric(metricName, MetricTypeGauge, jobName, nil, value+" "+strconv.FormatInt(timestamp.UnixMilli(), 10), help)
+}
+
 // WriteGaugeWithLabels writes a gauge metric with additional labels
 func (e *Exporter) WriteGaugeWithLabels(metricName string, jobName string, labels map[string]string, value string, help string) {
 	e.writeMetric(metricName, MetricTypeGauge, jobName, labels, value, help)
 }
 
+// WriteInfo writes an info gauge with value 1 and labels, replacing the series of the job with other label values
+func (e *Exporter) WriteInfo(metricName string, jobName string, labels map[string]string, help string) {
+	if e.config.metricDisabled {
+		return
+	}
+	fullMetricName := e.FullMetricName(metricName)
+	e.write(jobName, func(path string) error {
+		return e.metricWriter.WriteInfo(path, fullMetricName, jobName, e.withConstLabels(labels), help)
+	})
+}
+
 // WriteCounter writes a counter metric to the Prometheus exporter file
 // Note: Counter values should be incremented by the caller
 func (e *Exporter) WriteCounter(metricName string, jobName string, labels map[string]string, value string, help string) {
@@ -220,6 +543,7 @@ func (e *Exporter) IncrementCounter(metricName string, jobName string, labels ma
 	basePrefix := e.config.metricName
 	fullMetricName := basePrefix + "_" + metricName
 
-	exporterPath := e.GetExporterPath()
-	e.metricWriter.IncrementCounter(exporterPath, fullMetricName, jobName, labels, help)
+	e.write(jobName, func(path string) error {
+		return e.metricWriter.IncrementCounter(path, fullMetricName, jobName, e.withConstLabels(labels), help)
+	})
 }
@@ -4,7 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
 )
@@ -473,3 +475,286 @@ func TestWriteToExporterMultipleJobs(t *testing.T) {
 		t.Errorf("Should have exactly 1 TYPE crontab_failed header, got %d", failedTypeCount)
 	}
 }
+
+// TestFullMetricName tests the FullMetricName function
+func TestFullMetricName(t *testing.T) {
+	exp := NewExporter(WithMetricName("cron"))
+	if exp.MetricPrefix() != "cron" {
+		t.Errorf("MetricPrefix() = %v, want cron", exp.MetricPrefix())
+	}
+	if result := exp.FullMetricName("failed"); result != "cron_failed" {
+		t.Errorf("FullMetricName(failed) = %v, want cron_failed", result)
+	}
+	if result := exp.FullMetricName("cron_failed"); result != "cron_failed" {
+		t.Errorf("FullMetricName(cron_failed) = %v, want cron_failed", result)
+	}
+}
+
+// TestWriteGaugeAt tests that a timestamped sample replaces the plain one and vice versa
+func TestWriteGaugeAt(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"))
+	exporterPath := filepath.Join("/test/path", "crons.prom")
+	timestamp := time.Date(2024, 1, 1, 2, 0, 0, 200*int(time.Millisecond), time.UTC)
+
+	exp.WriteGauge("failed", "job1", "1", "Failed")
+	exp.WriteGaugeAt("failed", "job1", "0", timestamp, "Failed")
+
+	content, err := afero.ReadFile(memFs, exporterPath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !strings.Contains(string(content), `crontab_failed{name="job1"} 0 1704074400200`+"\n") {
+		t.Errorf("Content should contain timestamped sample, got:\n%s", content)
+	}
+	if strings.Count(string(content), `crontab_failed{name="job1"}`) != 1 {
+		t.Errorf("Timestamped sample should replace the previous one, got:\n%s", content)
+	}
+
+	exp.WriteGauge("failed", "job1", "1", "Failed")
+	content, _ = afero.ReadFile(memFs, exporterPath)
+	if !strings.Contains(string(content), `crontab_failed{name="job1"} 1`+"\n") {
+		t.Errorf("Plain sample should replace the timestamped one, got:\n%s", content)
+	}
+}
+
+// TestWriteLegacy tests the series of the original cronmanager schema, named after the metric prefix
+func TestWriteLegacy(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{name: "default prefix", want: `crontab{name="job1",dimension="failed"} 1`},
+		{name: "custom prefix", prefix: "cron", want: `cron{name="job1",dimension="failed"} 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memFs := afero.NewMemMapFs()
+			opts := []Option{WithFileSystem(memFs), WithExporterDir("/test/path")}
+			if tt.prefix != "" {
+				opts = append(opts, WithMetricName(tt.prefix))
+			}
+			exp := NewExporter(opts...)
+
+			exp.WriteLegacy("job1", "failed", "0")
+			exp.WriteLegacy("job1", "failed", "1")
+
+			content, err := afero.ReadFile(memFs, filepath.Join("/test/path", "crons.prom"))
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if !strings.Contains(string(content), tt.want+"\n") || strings.Count(string(content), "dimension=") != 1 {
+				t.Errorf("Content should contain the single series %s, got:\n%s", tt.want, content)
+			}
+		})
+	}
+}
+
+// TestWithOwner tests that owners write labeled metrics to their own file
+func TestWithOwner(t *testing.T) {
+	tests := []struct {
+		owner    string
+		wantPath string
+	}{
+		{owner: "", wantPath: "/test/path/crons.prom"},
+		{owner: "team-a", wantPath: "/test/path/crons_team-a.prom"},
+		{owner: "../team b", wantPath: "/test/path/crons____team_b.prom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.owner, func(t *testing.T) {
+			memFs := afero.NewMemMapFs()
+			exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithOwner(tt.owner))
+			if path := exp.GetExporterPath(); path != tt.wantPath {
+				t.Errorf("GetExporterPath() = %v, want %v", path, tt.wantPath)
+			}
+
+			labels := map[string]string{"status": "success"}
+			exp.WriteGauge("failed", "job", "0", "Failed")
+			exp.IncrementCounter("runs_total", "job", labels, "Runs")
+			if len(labels) != 1 {
+				t.Errorf("Caller labels should not be modified, got %v", labels)
+			}
+
+			content, err := afero.ReadFile(memFs, tt.wantPath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			ownerLabel := ""
+			if tt.owner != "" {
+				ownerLabel = `,owner="` + strings.ReplaceAll(tt.owner, `"`, `\"`) + `"`
+			}
+			for _, want := range []string{
+				`crontab_failed{name="job"` + ownerLabel + `} 0`,
+				`crontab_runs_total{name="job"` + ownerLabel + `,status="success"} 1`,
+			} {
+				if !strings.Contains(string(content), want+"\n") {
+					t.Errorf("Content should contain %s, got:\n%s", want, content)
+				}
+			}
+		})
+	}
+}
+
+// TestWithLabels tests that constant labels are added to every series without overriding series labels
+func TestWithLabels(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithOwner("team-a"),
+		WithLabels(map[string]string{"env": "prod", "status": "constant"}))
+
+	exp.WriteGauge("failed", "job", "0", "Failed")
+	exp.IncrementCounter("runs_total", "job", map[string]string{"status": "success"}, "Runs")
+	exp.WriteInfo("build_info", "job", map[string]string{"version": "1.0.0"}, "Build")
+
+	content, err := afero.ReadFile(memFs, "/test/path/crons_team-a.prom")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	for _, want := range []string{
+		`crontab_failed{name="job",env="prod",owner="team-a",status="constant"} 0`,
+		`crontab_runs_total{name="job",env="prod",owner="team-a",status="success"} 1`,
+		`crontab_build_info{name="job",env="prod",owner="team-a",status="constant",version="1.0.0"} 1`,
+	} {
+		if !strings.Contains(string(content), want+"\n") {
+			t.Errorf("Content should contain %s, got:\n%s", want, content)
+		}
+	}
+}
+
+// TestValidateLabels tests the accepted constant label names
+func TestValidateLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{name: "valid", labels: map[string]string{"env": "prod", "_dc2": "eu"}},
+		{name: "none", labels: nil},
+		{name: "dash", labels: map[string]string{"data-center": "eu"}, wantErr: true},
+		{name: "leading digit", labels: map[string]string{"2dc": "eu"}, wantErr: true},
+		{name: "internal", labels: map[string]string{"__env": "prod"}, wantErr: true},
+		{name: "job name", labels: map[string]string{"name": "other"}, wantErr: true},
+		{name: "owner", labels: map[string]string{"owner": "team-b"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateLabels(tt.labels); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestPruneShards tests that only stale owner shards are removed, not the job shards
+func TestPruneShards(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	for _, owner := range []string{"", "old", "new"} {
+		NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithOwner(owner)).WriteGauge("failed", "job", "0", "Failed")
+	}
+	for _, owner := range []string{"", "old"} {
+		NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithOwner(owner), WithShards(2)).WriteGauge("failed", "job", "0", "Failed")
+	}
+	jobShards, _ := afero.Glob(memFs, "/test/path/*_shard*.prom")
+	if len(jobShards) != 2 {
+		t.Fatalf("job shards = %v, want one of each owner", jobShards)
+	}
+	if err := afero.WriteFile(memFs, "/test/path/other.prom", []byte{}, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for _, path := range append([]string{"/test/path/crons.prom", "/test/path/crons_old.prom", "/test/path/other.prom"}, jobShards...) {
+		if err := memFs.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to change times: %v", err)
+		}
+	}
+
+	removed, err := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path")).PruneShards(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("PruneShards() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "/test/path/crons_old.prom" {
+		t.Errorf("PruneShards() = %v, want [/test/path/crons_old.prom]", removed)
+	}
+	for _, path := range append([]string{"/test/path/crons.prom", "/test/path/crons_new.prom", "/test/path/other.prom"}, jobShards...) {
+		if exists, _ := afero.Exists(memFs, path); !exists {
+			t.Errorf("%s should not be pruned", path)
+		}
+	}
+}
+
+// denyFs is a file system denying writes below a directory, like a MAC policy would
+type denyFs struct {
+	afero.Fs
+	denied string
+}
+
+func (d denyFs) deny(op, name string) error {
+	if strings.HasPrefix(name, d.denied) {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EACCES}
+	}
+	return nil
+}
+
+func (d denyFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if err := d.deny("open", name); err != nil {
+			return nil, err
+		}
+	}
+	return d.Fs.OpenFile(name, flag, perm)
+}
+
+func (d denyFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := d.deny("mkdir", path); err != nil {
+		return err
+	}
+	return d.Fs.MkdirAll(path, perm)
+}
+
+// TestWriteDeniedFallback tests that denied writes degrade to the fallback directory instead of aborting
+func TestWriteDeniedFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		fallbackDir string
+		wantPath    string
+	}{
+		{name: "without fallback"},
+		{name: "with fallback", fallbackDir: "/fallback", wantPath: "/fallback/crons.prom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memFs := afero.NewMemMapFs()
+			fs := denyFs{Fs: memFs, denied: "/denied"}
+			exp := NewExporter(WithFileSystem(fs), WithExporterDir("/denied"), WithFallbackDir(tt.fallbackDir))
+
+			exp.WriteGauge("running", "job", "1", "Running")
+			exp.IncrementCounter("runs_total", "job", nil, "Runs")
+			exp.WriteGauge("running", "job", "0", "Running")
+
+			if exists, _ := afero.Exists(memFs, "/denied/crons.prom"); exists {
+				t.Error("No metrics should be written to the denied directory")
+			}
+			if err := exp.Err(); (err != nil) != (tt.wantPath == "") {
+				t.Errorf("Err() = %v, want an error only without fallback", err)
+			}
+			if tt.wantPath == "" {
+				return
+			}
+			content, err := afero.ReadFile(memFs, tt.wantPath)
+			if err != nil {
+				t.Fatalf("Failed to read fallback file: %v", err)
+			}
+			for _, want := range []string{
+				`crontab_degraded{name="job",component="metrics"} 1`,
+				`crontab_running{name="job"} 0`,
+				`crontab_runs_total{name="job"} 1`,
+			} {
+				if !strings.Contains(string(content), want+"\n") {
+					t.Errorf("Fallback file should contain %s, got:\n%s", want, content)
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package exporter
 
 import (
+	"bytes"
 	"fmt"
-	"log"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/alswl/cron-manager/internal/fslock"
 	"github.com/spf13/afero"
@@ -20,10 +23,65 @@ const (
 	MetricTypeCounter MetricType = "counter"
 )
 
+// patternCache holds compiled regular expressions keyed by their source.
+// Patterns only depend on metric names and labels, which repeat on every write of a run,
+// so each one is compiled once instead of on every call.
+type patternCache struct {
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// get returns the compiled pattern for expr, compiling it on first use
+func (c *patternCache) get(expr string) *regexp.Regexp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if re, exists := c.patterns[expr]; exists {
+		return re
+	}
+	re := regexp.MustCompile(expr)
+	c.patterns[expr] = re
+	return re
+}
+
+// patterns is the shared cache of series patterns
+var patterns = &patternCache{patterns: make(map[string]*regexp.Regexp)}
+
+// seriesPattern returns the pattern matching the whole line of a series
+func seriesPattern(fullMetricName, labelStr string) *regexp.Regexp {
+	return patterns.get(regexp.QuoteMeta(fullMetricName) + `\{` + regexp.QuoteMeta(labelStr) + `\}.*\n`)
+}
+
+// counterPattern returns the pattern matching the whole line of a series, capturing its numeric value
+func counterPattern(fullMetricName, labelStr string) *regexp.Regexp {
+	return patterns.get(regexp.QuoteMeta(fullMetricName) + `\{` + regexp.QuoteMeta(labelStr) + `\} (\d+(?:\.\d+)?).*\n`)
+}
+
+// jobSeriesPattern returns the pattern matching the lines of all series of a metric for the job jobName,
+// whatever their other labels
+func jobSeriesPattern(fullMetricName, jobName string) *regexp.Regexp {
+	return patterns.get(regexp.QuoteMeta(fullMetricName) + `\{` + regexp.QuoteMeta(buildLabelString(jobName, nil)) + `(,.*)?\} .*\n`)
+}
+
+// replaceMatches replaces the matched ranges of input with repl.
+// locs are the match indexes returned by a FindAll*Index call, in order;
+// this avoids scanning the file a second time to replace what was already found.
+func replaceMatches(input []byte, locs [][]int, repl []byte) []byte {
+	result := make([]byte, 0, len(input)+len(locs)*len(repl))
+	last := 0
+	for _, loc := range locs {
+		result = append(result, input[last:loc[0]]...)
+		result = append(result, repl...)
+		last = loc[1]
+	}
+	return append(result, input[last:]...)
+}
+
 // MetricWriter handles low-level metric writing operations
 type MetricWriter struct {
 	fs        afero.Fs
 	useOsLock bool
+	// fileMode is set on written files, 0 creates them with 0644 before umask
+	fileMode os.FileMode
 }
 
 // NewMetricWriter creates a new MetricWriter
@@ -45,25 +103,44 @@ func escapeLabelValue(s string) string {
 }
 
 // buildLabelString constructs a Prometheus label string from job name and additional labels
+// Additional labels are sorted by key so the same series always renders to the same line
 func buildLabelString(jobName string, labels map[string]string) string {
 	escapedJobName := escapeLabelValue(jobName)
 	labelPairs := []string{fmt.Sprintf(`name="%s"`, escapedJobName)}
-	for k, v := range labels {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
 		escapedKey := escapeLabelValue(k)
-		escapedValue := escapeLabelValue(v)
+		escapedValue := escapeLabelValue(labels[k])
 		labelPairs = append(labelPairs, fmt.Sprintf(`%s="%s"`, escapedKey, escapedValue))
 	}
 	return strings.Join(labelPairs, ",")
 }
 
 // ensureDirectoryExists ensures that the directory for the given path exists
-func (w *MetricWriter) ensureDirectoryExists(path string) {
+func (w *MetricWriter) ensureDirectoryExists(path string) error {
 	dir := filepath.Dir(path)
 	if dir != "" && dir != "." {
 		if err := w.fs.MkdirAll(dir, 0755); err != nil {
-			log.Fatal("Couldn't create directory: " + err.Error())
+			return fmt.Errorf("couldn't create directory: %w", err)
 		}
 	}
+	return nil
+}
+
+// lock locks the exporter file at path, creating its directory first as the lock files are kept next to it
+func (w *MetricWriter) lock(exporterPath string) (fslock.Locker, error) {
+	if err := w.ensureDirectoryExists(exporterPath); err != nil {
+		return nil, err
+	}
+	locker := fslock.NewLocker(exporterPath, w.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return nil, fmt.Errorf("couldn't lock %s: %w", exporterPath, err)
+	}
+	return locker, nil
 }
 
 // addMetricHeaders adds HELP and TYPE headers to the content if they don't exist
@@ -71,13 +148,11 @@ func addMetricHeaders(content []byte, fullMetricName string, metricType MetricTy
 	helpData := fmt.Sprintf("# HELP %s %s", fullMetricName, help)
 	typeData := fmt.Sprintf("# TYPE %s %s", fullMetricName, metricType)
 
-	helpRe := regexp.MustCompile(regexp.QuoteMeta(helpData))
-	typeRe := regexp.MustCompile(regexp.QuoteMeta(typeData))
-
-	if !helpRe.Match(content) {
+	// Headers are plain text, a substring search is enough
+	if !bytes.Contains(content, []byte(helpData)) {
 		content = append(content, []byte(helpData+"\n")...)
 	}
-	if !typeRe.Match(content) {
+	if !bytes.Contains(content, []byte(typeData)) {
 		content = append(content, []byte(typeData+"\n")...)
 	}
 
@@ -89,7 +164,7 @@ func (w *MetricWriter) readOrCreateFile(path string) ([]byte, error) {
 	input, err := afero.ReadFile(w.fs, path)
 	if err != nil {
 		// File doesn't exist, create empty file
-		if err := afero.WriteFile(w.fs, path, []byte{}, 0644); err != nil {
+		if err := afero.WriteFile(w.fs, path, []byte{}, w.createMode()); err != nil {
 			return nil, fmt.Errorf("couldn't read or write to the exporter file: %w", err)
 		}
 		return []byte{}, nil
@@ -97,6 +172,46 @@ func (w *MetricWriter) readOrCreateFile(path string) ([]byte, error) {
 	return input, nil
 }
 
+// createMode returns the mode files are created with
+func (w *MetricWriter) createMode() os.FileMode {
+	if w.fileMode != 0 {
+		return w.fileMode
+	}
+	return 0644
+}
+
+// writeFile atomically replaces the content of path and flushes it to disk.
+// The content is written to a temporary file which is renamed over path, so readers
+// such as the node_exporter textfile collector never see a partially written file,
+// and the final state of a run survives the process exiting right after.
+func (w *MetricWriter) writeFile(path string, content []byte) error {
+	// Named after the process, so a temporary file left by a job of another user cannot block the writes
+	tmpPath := path + "." + strconv.Itoa(os.Getpid()) + ".tmp"
+	file, err := w.fs.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, w.createMode())
+	if err != nil {
+		return err
+	}
+	// Set a configured mode explicitly, the umask or a leftover temporary file may have changed it
+	if w.fileMode != 0 {
+		if err := w.fs.Chmod(tmpPath, w.fileMode); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	if _, err := file.Write(content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return w.fs.Rename(tmpPath, path)
+}
+
 // writeMetricNoLock writes a metric without acquiring a lock (internal use)
 // Caller must hold the lock before calling this function
 func (w *MetricWriter) writeMetricNoLock(exporterPath, fullMetricName string, metricType MetricType, jobName string, labels map[string]string, value string, help string) error {
@@ -107,7 +222,9 @@ func (w *MetricWriter) writeMetricNoLock(exporterPath, fullMetricName string, me
 	metricLine := fmt.Sprintf(`%s{%s} %s`, fullMetricName, labelStr, value)
 
 	// Ensure directory exists
-	w.ensureDirectoryExists(exporterPath)
+	if err := w.ensureDirectoryExists(exporterPath); err != nil {
+		return err
+	}
 
 	// Read existing content
 	input, err := w.readOrCreateFile(exporterPath)
@@ -117,11 +234,11 @@ func (w *MetricWriter) writeMetricNoLock(exporterPath, fullMetricName string, me
 
 	// For both gauge and counter types, replace existing value or add new one
 	// (Counter increment logic is handled separately in IncrementCounter function)
-	exactPattern := regexp.MustCompile(regexp.QuoteMeta(fullMetricName) + `\{` + regexp.QuoteMeta(labelStr) + `\}.*\n`)
+	exactPattern := seriesPattern(fullMetricName, labelStr)
 
-	if exactPattern.Match(input) {
+	if locs := exactPattern.FindAllIndex(input, -1); locs != nil {
 		// Replace existing metric
-		input = exactPattern.ReplaceAll(input, []byte(metricLine+"\n"))
+		input = replaceMatches(input, locs, []byte(metricLine+"\n"))
 	} else {
 		// Metric doesn't exist, add it
 		input = addMetricHeaders(input, fullMetricName, metricType, help)
@@ -129,7 +246,7 @@ func (w *MetricWriter) writeMetricNoLock(exporterPath, fullMetricName string, me
 	}
 
 	// Write to file
-	return afero.WriteFile(w.fs, exporterPath, input, 0644)
+	return w.writeFile(exporterPath, input)
 }
 
 // WriteMetric writes a metric to the Prometheus exporter file
@@ -140,18 +257,42 @@ func (w *MetricWriter) writeMetricNoLock(exporterPath, fullMetricName string, me
 // labels: additional labels as key-value pairs (e.g., map[string]string{"status": "success"})
 // value: metric value
 // help: HELP comment for the metric
-func (w *MetricWriter) WriteMetric(exporterPath, fullMetricName string, metricType MetricType, jobName string, labels map[string]string, value string, help string) {
+func (w *MetricWriter) WriteMetric(exporterPath, fullMetricName string, metricType MetricType, jobName string, labels map[string]string, value string, help string) error {
 	// Lock filepath to prevent race conditions
-	locker := fslock.NewLocker(exporterPath, w.useOsLock)
-	if err := locker.Lock(); err != nil {
-		log.Println("Error locking file " + exporterPath)
+	locker, err := w.lock(exporterPath)
+	if err != nil {
+		return err
 	}
 	defer func() { _ = locker.Unlock() }()
 
 	// Call internal function with lock held
-	if err := w.writeMetricNoLock(exporterPath, fullMetricName, metricType, jobName, labels, value, help); err != nil {
-		log.Fatal(err)
+	return w.writeMetricNoLock(exporterPath, fullMetricName, metricType, jobName, labels, value, help)
+}
+
+// WriteInfo writes an info gauge with value 1 whose labels describe the job, e.g. the cronmgr version.
+// Series of the metric for the job with other label values are replaced, so only the current one remains.
+func (w *MetricWriter) WriteInfo(exporterPath, fullMetricName, jobName string, labels map[string]string, help string) error {
+	locker, err := w.lock(exporterPath)
+	if err != nil {
+		return err
 	}
+	defer func() { _ = locker.Unlock() }()
+
+	input, err := w.readOrCreateFile(exporterPath)
+	if err != nil {
+		return err
+	}
+
+	metricLine := []byte(fmt.Sprintf(`%s{%s} 1`, fullMetricName, buildLabelString(jobName, labels)) + "\n")
+	if locs := jobSeriesPattern(fullMetricName, jobName).FindAllIndex(input, -1); locs != nil {
+		// Drop the other series first, the first match keeps its position
+		input = replaceMatches(input, locs[1:], nil)
+		input = replaceMatches(input, locs[:1], metricLine)
+	} else {
+		input = addMetricHeaders(input, fullMetricName, MetricTypeGauge, help)
+		input = append(input, metricLine...)
+	}
+	return w.writeFile(exporterPath, input)
 }
 
 // IncrementCounter increments a counter metric by 1
@@ -160,12 +301,11 @@ func (w *MetricWriter) WriteMetric(exporterPath, fullMetricName string, metricTy
 // jobName: name of the job
 // labels: additional labels as key-value pairs
 // help: HELP comment for the metric
-func (w *MetricWriter) IncrementCounter(exporterPath, fullMetricName, jobName string, labels map[string]string, help string) {
+func (w *MetricWriter) IncrementCounter(exporterPath, fullMetricName, jobName string, labels map[string]string, help string) error {
 	// Lock filepath to prevent race conditions
-	locker := fslock.NewLocker(exporterPath, w.useOsLock)
-	if err := locker.Lock(); err != nil {
-		log.Println("Error locking file " + exporterPath)
-		return
+	locker, err := w.lock(exporterPath)
+	if err != nil {
+		return err
 	}
 	defer func() { _ = locker.Unlock() }()
 
@@ -174,37 +314,34 @@ func (w *MetricWriter) IncrementCounter(exporterPath, fullMetricName, jobName st
 	if err != nil {
 		// File doesn't exist, start with 1
 		// Call internal function without lock (we already hold the lock)
-		if err := w.writeMetricNoLock(exporterPath, fullMetricName, MetricTypeCounter, jobName, labels, "1", help); err != nil {
-			log.Fatal(err)
-		}
-		return
+		return w.writeMetricNoLock(exporterPath, fullMetricName, MetricTypeCounter, jobName, labels, "1", help)
 	}
 
 	// Build label string
 	labelStr := buildLabelString(jobName, labels)
 
 	// Find existing counter value
-	counterPattern := regexp.MustCompile(fmt.Sprintf(`%s\{%s\} (\d+(?:\.\d+)?)`, regexp.QuoteMeta(fullMetricName), regexp.QuoteMeta(labelStr)))
-	matches := counterPattern.FindSubmatch(input)
+	pattern := counterPattern(fullMetricName, labelStr)
+	locs := pattern.FindAllSubmatchIndex(input, -1)
 
 	var newValue string
-	if matches != nil {
+	if locs != nil {
 		// Parse current value and increment
-		currentStr := string(matches[1])
+		currentStr := string(input[locs[0][2]:locs[0][3]])
 		newValue = w.incrementValue(currentStr)
 
 		// Replace existing line
-		oldLine := fmt.Sprintf(`%s{%s} %s`, fullMetricName, labelStr, currentStr)
 		newLine := fmt.Sprintf(`%s{%s} %s`, fullMetricName, labelStr, newValue)
-		re := regexp.MustCompile(regexp.QuoteMeta(oldLine) + `.*\n`)
-		input = re.ReplaceAll(input, []byte(newLine+"\n"))
+		input = replaceMatches(input, locs, []byte(newLine+"\n"))
 	} else {
 		// Counter doesn't exist, start with 1
 		newValue = "1"
 		metricLine := fmt.Sprintf(`%s{%s} %s`, fullMetricName, labelStr, newValue)
 
 		// Ensure directory exists
-		w.ensureDirectoryExists(exporterPath)
+		if err := w.ensureDirectoryExists(exporterPath); err != nil {
+			return err
+		}
 
 		// Add headers and metric line
 		input = addMetricHeaders(input, fullMetricName, MetricTypeCounter, help)
@@ -212,9 +349,7 @@ func (w *MetricWriter) IncrementCounter(exporterPath, fullMetricName, jobName st
 	}
 
 	// Write to file
-	if err := afero.WriteFile(w.fs, exporterPath, input, 0644); err != nil {
-		log.Fatal(err)
-	}
+	return w.writeFile(exporterPath, input)
 }
 
 // incrementValue increments a numeric string value by 1
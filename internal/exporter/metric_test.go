@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -88,7 +89,8 @@ func TestBuildLabelString(t *testing.T) {
 				"status": "success",
 				"env":    "production",
 			},
-			// Note: map iteration order is not guaranteed, but we can check both are present
+			// Additional labels are sorted by key
+			expected: `name="test_job",env="production",status="success"`,
 		},
 		{
 			name:    "job name with special characters",
@@ -109,23 +111,8 @@ func TestBuildLabelString(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result := buildLabelString(tt.jobName, tt.labels)
-
-			// For tests with multiple labels, we need to check differently
-			// since map iteration order is not guaranteed
-			if tt.name == "job name with multiple labels" {
-				if !strings.Contains(result, `name="test_job"`) {
-					t.Errorf("buildLabelString() missing job name, got %q", result)
-				}
-				if !strings.Contains(result, `status="success"`) {
-					t.Errorf("buildLabelString() missing status label, got %q", result)
-				}
-				if !strings.Contains(result, `env="production"`) {
-					t.Errorf("buildLabelString() missing env label, got %q", result)
-				}
-			} else {
-				if result != tt.expected {
-					t.Errorf("buildLabelString(%q, %v) = %q, want %q", tt.jobName, tt.labels, result, tt.expected)
-				}
+			if result != tt.expected {
+				t.Errorf("buildLabelString(%q, %v) = %q, want %q", tt.jobName, tt.labels, result, tt.expected)
 			}
 		})
 	}
@@ -455,6 +442,38 @@ func TestMetricWriterWriteMetric(t *testing.T) {
 	}
 }
 
+// TestMetricWriterWriteInfo tests that an info metric keeps a single series per job
+func TestMetricWriterWriteInfo(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	writer := NewMetricWriter(memFs, false)
+	testPath := "/test/metrics.prom"
+
+	for _, write := range []struct {
+		job     string
+		version string
+	}{
+		{job: "job1", version: "1.0.0"},
+		{job: "job10", version: "1.0.0"},
+		{job: "job1", version: "1.1.0"},
+	} {
+		if err := writer.WriteInfo(testPath, "test_info", write.job, map[string]string{"version": write.version}, "Test info"); err != nil {
+			t.Fatalf("WriteInfo() error = %v", err)
+		}
+	}
+
+	content, err := afero.ReadFile(memFs, testPath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	want := "# HELP test_info Test info\n" +
+		"# TYPE test_info gauge\n" +
+		`test_info{name="job1",version="1.1.0"} 1` + "\n" +
+		`test_info{name="job10",version="1.0.0"} 1` + "\n"
+	if string(content) != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+}
+
 // TestMetricWriterIncrementCounter tests the IncrementCounter function
 func TestMetricWriterIncrementCounter(t *testing.T) {
 	memFs := afero.NewMemMapFs()
@@ -575,3 +594,165 @@ func TestMetricWriterConcurrentWrites(t *testing.T) {
 		t.Errorf("Expected 1 TYPE header, got %d", typeCount)
 	}
 }
+
+// TestSeriesPatternCached tests that series patterns are compiled once and reused
+func TestSeriesPatternCached(t *testing.T) {
+	first := seriesPattern("crontab_failed", `name="job1"`)
+	second := seriesPattern("crontab_failed", `name="job1"`)
+	if first != second {
+		t.Error("seriesPattern() should return the cached pattern for the same series")
+	}
+
+	other := seriesPattern("crontab_failed", `name="job2"`)
+	if first == other {
+		t.Error("seriesPattern() should return different patterns for different series")
+	}
+
+	if !first.MatchString("crontab_failed{name=\"job1\"} 1\n") {
+		t.Error("seriesPattern() should match the series line")
+	}
+	if first.MatchString("crontab_failed{name=\"job10\"} 1\n") {
+		t.Error("seriesPattern() should not match another series")
+	}
+}
+
+// TestReplaceMatches tests the replaceMatches function
+func TestReplaceMatches(t *testing.T) {
+	input := []byte("a{} 1\nb{} 2\na{} 3\nc{} 4\n")
+	locs := seriesPattern("a", "").FindAllIndex(input, -1)
+	if len(locs) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(locs))
+	}
+
+	result := replaceMatches(input, locs, []byte("a{} 9\n"))
+	expected := "a{} 9\nb{} 2\na{} 9\nc{} 4\n"
+	if string(result) != expected {
+		t.Errorf("replaceMatches() = %q, want %q", result, expected)
+	}
+
+	if result := replaceMatches(input, nil, []byte("x")); string(result) != string(input) {
+		t.Errorf("replaceMatches() without matches = %q, want %q", result, input)
+	}
+}
+
+// TestWriteMetricReplacementIsLiteral tests that values and labels containing $ are written as-is
+func TestWriteMetricReplacementIsLiteral(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	writer := NewMetricWriter(memFs, false)
+	testPath := "/test/metrics.prom"
+
+	writer.WriteMetric(testPath, "test_metric", MetricTypeGauge, "job$1", nil, "1", "Test")
+	writer.WriteMetric(testPath, "test_metric", MetricTypeGauge, "job$1", nil, "2", "Test")
+
+	content, err := afero.ReadFile(memFs, testPath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !strings.Contains(string(content), `test_metric{name="job$1"} 2`) {
+		t.Errorf("Expected literal replacement, got:\n%s", content)
+	}
+}
+
+// TestWriteFileAtomic tests that writes replace the file and leave no temporary file behind
+func TestWriteFileAtomic(t *testing.T) {
+	tmpDir := t.TempDir()
+	testPath := filepath.Join(tmpDir, "crons.prom")
+	writer := NewMetricWriter(afero.NewOsFs(), true)
+
+	writer.WriteMetric(testPath, "test_metric", MetricTypeGauge, "job1", nil, "1", "Test")
+	writer.WriteMetric(testPath, "test_metric", MetricTypeGauge, "job1", nil, "2", "Test")
+
+	content, err := os.ReadFile(testPath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !strings.Contains(string(content), `test_metric{name="job1"} 2`) {
+		t.Errorf("Expected updated value, got:\n%s", content)
+	}
+	if matches, _ := filepath.Glob(testPath + "*.tmp"); len(matches) > 0 {
+		t.Errorf("Temporary files should not remain after write: %v", matches)
+	}
+}
+
+// TestWriteMetricLock tests that the lock is taken in a new exporter directory, and that a write failing to
+// take it returns the error instead of writing without it
+func TestWriteMetricLock(t *testing.T) {
+	writer := NewMetricWriter(afero.NewOsFs(), true)
+	testPath := filepath.Join(t.TempDir(), "new", "crons.prom")
+	if err := writer.WriteMetric(testPath, "test_metric", MetricTypeGauge, "job1", nil, "1", "Test"); err != nil {
+		t.Fatalf("WriteMetric() in a new directory error = %v", err)
+	}
+
+	testPath = filepath.Join(t.TempDir(), "crons.prom")
+	// A directory in place of the lock file cannot be locked
+	if err := os.Mkdir(testPath+".lock", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteMetric(testPath, "test_metric", MetricTypeGauge, "job1", nil, "1", "Test"); err == nil {
+		t.Error("WriteMetric() without the lock should fail")
+	}
+	if _, err := os.Stat(testPath); !os.IsNotExist(err) {
+		t.Errorf("file written without the lock: %v", err)
+	}
+}
+
+// newBenchmarkWriter creates a MetricWriter with an exporter file holding metrics of many jobs,
+// similar to a host running hundreds of wrapped jobs
+func newBenchmarkWriter(b *testing.B, path string) *MetricWriter {
+	b.Helper()
+	writer := NewMetricWriter(afero.NewMemMapFs(), false)
+	for i := 0; i < 200; i++ {
+		jobName := fmt.Sprintf("job_%d", i)
+		writer.WriteMetric(path, "crontab_duration_seconds", MetricTypeGauge, jobName, nil, "1.00", "Duration of the last job execution in seconds")
+		writer.IncrementCounter(path, "crontab_runs_total", jobName, map[string]string{"status": "success"}, "Total number of job runs")
+	}
+	return writer
+}
+
+// BenchmarkWriteMetric benchmarks replacing a gauge value, the per-second hot path of a running job
+func BenchmarkWriteMetric(b *testing.B) {
+	path := "/bench/crons.prom"
+	writer := newBenchmarkWriter(b, path)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writer.WriteMetric(path, "crontab_duration_seconds", MetricTypeGauge, "job_100", nil, "2.00", "Duration of the last job execution in seconds")
+	}
+}
+
+// BenchmarkIncrementCounter benchmarks incrementing an existing counter
+func BenchmarkIncrementCounter(b *testing.B) {
+	path := "/bench/crons.prom"
+	writer := newBenchmarkWriter(b, path)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writer.IncrementCounter(path, "crontab_runs_total", "job_100", map[string]string{"status": "success"}, "Total number of job runs")
+	}
+}
+
+// BenchmarkAddMetricHeaders benchmarks the header lookup of a new metric
+func BenchmarkAddMetricHeaders(b *testing.B) {
+	content := []byte(strings.Repeat("crontab_duration_seconds{name=\"job\"} 1.00\n", 400))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		addMetricHeaders(content, "crontab_failed", MetricTypeGauge, "Whether the job failed (1 = failed, 0 = success)")
+	}
+}
+
+// TestWriteFileMode tests that a configured file mode is applied to the exporter file
+func TestWriteFileMode(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithFileMode(0640))
+	exp.WriteGauge("failed", "job", "0", "Failed")
+	exp.IncrementCounter("runs_total", "job", nil, "Runs")
+
+	info, err := memFs.Stat(exp.GetExporterPath())
+	if err != nil {
+		t.Fatalf("Failed to stat exporter file: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("exporter file mode = %v, want 0640", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,154 @@
+package exporter
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/spf13/afero"
+)
+
+// LegacyGauge is a gauge of the per-metric schema that the legacy cronmanager schema writes as a dimension
+type LegacyGauge struct {
+	// Metric is the name of the gauge without the prefix, e.g. running
+	Metric string
+	// Dimension is the value of the dimension label of the legacy series, e.g. run
+	Dimension string
+	// Help is the HELP text of the gauge, as written by the jobs
+	Help string
+}
+
+// migratedSeries is a series written by a migration
+type migratedSeries struct {
+	name string
+	// key identifies the series, its name and labels
+	key  string
+	line string
+	help string
+}
+
+// MigrateLegacy rewrites the series of the gauges in the exporter file from the legacy cronmanager schema,
+// {prefix}{name="...",dimension="..."}, to the per-metric schema, {prefix}_<metric>{name="..."}, or back
+// with toLegacy. The source series are removed unless keep is set, which leaves both schemas like
+// LegacyMetrics does. A target series that exists already is left as is, a job wrote it. The file is
+// replaced at once under its lock, so the collector never sees a gap nor both schemas. It returns the
+// number of series written. With WithShards, the unsharded file and each shard that exists are migrated.
+func (e *Exporter) MigrateLegacy(gauges []LegacyGauge, toLegacy, keep bool) (int, error) {
+	if e.config.shards <= 1 {
+		return e.migrateFile(e.GetExporterPath(), gauges, toLegacy, keep)
+	}
+	written := 0
+	for _, path := range e.shardPaths() {
+		if _, err := e.config.fs.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		n, err := e.migrateFile(path, gauges, toLegacy, keep)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// migrateFile migrates the series of the exporter file at path, see MigrateLegacy
+func (e *Exporter) migrateFile(path string, gauges []LegacyGauge, toLegacy, keep bool) (int, error) {
+	locker := fslock.NewLocker(path, e.config.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return 0, fmt.Errorf("couldn't lock %s: %w", path, err)
+	}
+	defer func() { _ = locker.Unlock() }()
+	content, err := afero.ReadFile(e.config.fs, path)
+	if err != nil {
+		return 0, err
+	}
+
+	prefix := e.config.metricName
+	var kept []string
+	var migrated []migratedSeries
+	existing := map[string]bool{}
+	sources := map[string]bool{}
+	for n, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			kept = append(kept, line)
+			continue
+		}
+		name, labels, rest, err := splitSample(trimmed)
+		if err != nil {
+			return 0, fmt.Errorf("%s:%d: %w", path, n+1, err)
+		}
+		job, hasJob := labels["name"]
+		delete(labels, "name")
+		existing[name+"{"+buildLabelString(job, labels)+"}"] = true
+		target, ok := migrateSeries(gauges, prefix, e.FullMetricName, name, labels, toLegacy)
+		if !ok || !hasJob {
+			kept = append(kept, line)
+			continue
+		}
+		sources[name] = true
+		target.key = target.name + "{" + buildLabelString(job, labels) + "}"
+		target.line = target.key + rest
+		migrated = append(migrated, target)
+		if keep {
+			kept = append(kept, line)
+		}
+	}
+
+	output := []byte(strings.Join(dropOrphanHeaders(kept, sources), "\n") + "\n")
+	written := 0
+	for _, series := range migrated {
+		if existing[series.key] {
+			continue
+		}
+		existing[series.key] = true
+		output = addMetricHeaders(output, series.name, MetricTypeGauge, series.help)
+		output = append(output, series.line+"\n"...)
+		written++
+	}
+	if written == 0 && len(sources) == 0 {
+		return 0, nil
+	}
+	return written, e.metricWriter.writeFile(path, output)
+}
+
+// migrateSeries returns the series that the series name with labels, besides the job name, migrates to, and
+// updates labels for it. ok is false if it is not a series of the schema migrated from.
+func migrateSeries(gauges []LegacyGauge, prefix string, fullName func(string) string, name string, labels map[string]string, toLegacy bool) (target migratedSeries, ok bool) {
+	for _, g := range gauges {
+		switch {
+		case toLegacy && name == fullName(g.Metric):
+			labels["dimension"] = g.Dimension
+			return migratedSeries{name: prefix, help: helpLegacy}, true
+		case !toLegacy && name == prefix && labels["dimension"] == g.Dimension:
+			delete(labels, "dimension")
+			return migratedSeries{name: fullName(g.Metric), help: g.Help}, true
+		}
+	}
+	return migratedSeries{}, false
+}
+
+// dropOrphanHeaders removes the HELP and TYPE lines of the metrics in names left without samples
+func dropOrphanHeaders(lines []string, names map[string]bool) []string {
+	remaining := map[string]bool{}
+	for _, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			name, _, _ := strings.Cut(trimmed, "{")
+			name, _, _ = strings.Cut(name, " ")
+			remaining[name] = true
+		}
+	}
+	orphans := maps.Clone(names)
+	maps.DeleteFunc(orphans, func(name string, _ bool) bool { return remaining[name] })
+	var kept []string
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "#" && (fields[1] == "HELP" || fields[1] == "TYPE") && orphans[fields[2]] {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// testLegacyGauges are the gauges migrated by the tests
+var testLegacyGauges = []LegacyGauge{
+	{Metric: "failed", Dimension: "failed", Help: "Whether the job failed (1 = failed, 0 = success)"},
+	{Metric: "running", Dimension: "run", Help: "Whether the job is currently running (1 = running, 0 = finished)"},
+}
+
+// TestMigrateLegacy tests rewriting the exporter file between the legacy and the per-metric schemas
+func TestMigrateLegacy(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	path := filepath.Join("/test/path", "crons.prom")
+	exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithLabels(map[string]string{"env": "prod"}))
+	exp.WriteLegacy("job1", "failed", "1")
+	exp.WriteLegacy("job1", "run", "0")
+	exp.WriteLegacy("job1", "custom", "3")
+	exp.WriteGauge("exit_code", "job1", "2", "Exit code of the last job execution")
+
+	n, err := exp.MigrateLegacy(testLegacyGauges, false, false)
+	if err != nil || n != 2 {
+		t.Fatalf("MigrateLegacy() = %d, %v, want 2", n, err)
+	}
+	content, _ := afero.ReadFile(memFs, path)
+	for _, want := range []string{
+		`crontab_failed{name="job1",env="prod"} 1`,
+		`crontab_running{name="job1",env="prod"} 0`,
+		`crontab{name="job1",dimension="custom",env="prod"} 3`,
+		`crontab_exit_code{name="job1",env="prod"} 2`,
+		"# HELP crontab_failed Whether the job failed (1 = failed, 0 = success)",
+	} {
+		if !strings.Contains(string(content), want+"\n") {
+			t.Errorf("Expected %s, got:\n%s", want, content)
+		}
+	}
+	if strings.Contains(string(content), `dimension="failed"`) || strings.Contains(string(content), `dimension="run"`) {
+		t.Errorf("Expected the legacy series to be removed, got:\n%s", content)
+	}
+
+	// A job writing the per-metric schema afterwards replaces the migrated series instead of duplicating it
+	exp.WriteGauge("failed", "job1", "0", testLegacyGauges[0].Help)
+	content, _ = afero.ReadFile(memFs, path)
+	if strings.Count(string(content), "crontab_failed{") != 1 || strings.Count(string(content), "# HELP crontab_failed ") != 1 {
+		t.Errorf("Expected a single crontab_failed series, got:\n%s", content)
+	}
+
+	// And back, keeping the per-metric series
+	if n, err := exp.MigrateLegacy(testLegacyGauges, true, true); err != nil || n != 2 {
+		t.Fatalf("MigrateLegacy() back = %d, %v, want 2", n, err)
+	}
+	content, _ = afero.ReadFile(memFs, path)
+	for _, want := range []string{
+		`crontab{name="job1",dimension="failed",env="prod"} 0`,
+		`crontab{name="job1",dimension="run",env="prod"} 0`,
+		`crontab_failed{name="job1",env="prod"} 0`,
+	} {
+		if !strings.Contains(string(content), want+"\n") {
+			t.Errorf("Expected %s, got:\n%s", want, content)
+		}
+	}
+	if strings.Count(string(content), "# HELP crontab ") != 1 {
+		t.Errorf("Expected a single HELP of the legacy series, got:\n%s", content)
+	}
+}
+
+// TestMigrateLegacyDropsHeaders tests that the headers of a schema left without series are removed
+func TestMigrateLegacyDropsHeaders(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"))
+	exp.WriteGauge("failed", "job1", "1", testLegacyGauges[0].Help)
+
+	if n, err := exp.MigrateLegacy(testLegacyGauges, true, false); err != nil || n != 1 {
+		t.Fatalf("MigrateLegacy() = %d, %v, want 1", n, err)
+	}
+	content, _ := afero.ReadFile(memFs, filepath.Join("/test/path", "crons.prom"))
+	if strings.Contains(string(content), "crontab_failed") {
+		t.Errorf("Expected crontab_failed and its headers to be removed, got:\n%s", content)
+	}
+	if !strings.Contains(string(content), `crontab{name="job1",dimension="failed"} 1`+"\n") {
+		t.Errorf("Expected the legacy series, got:\n%s", content)
+	}
+
+	// Nothing left to migrate
+	if n, err := exp.MigrateLegacy(testLegacyGauges, true, false); err != nil || n != 0 {
+		t.Errorf("MigrateLegacy() again = %d, %v, want 0", n, err)
+	}
+}
+
+// TestMigrateLegacyShards tests that every shard of the jobs is migrated
+func TestMigrateLegacyShards(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithShards(4))
+	jobs := []string{"job1", "job2", "job3", "job4", "job5", "job6"}
+	for _, job := range jobs {
+		exp.WriteLegacy(job, "failed", "1")
+	}
+
+	if n, err := exp.MigrateLegacy(testLegacyGauges, false, false); err != nil || n != len(jobs) {
+		t.Fatalf("MigrateLegacy() = %d, %v, want %d", n, err, len(jobs))
+	}
+	for _, job := range jobs {
+		content, _ := afero.ReadFile(memFs, exp.jobPath(job))
+		if !strings.Contains(string(content), `crontab_failed{name="`+job+`"} 1`+"\n") {
+			t.Errorf("Expected the migrated series of %s, got:\n%s", job, content)
+		}
+	}
+}
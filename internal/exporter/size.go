@@ -0,0 +1,53 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// helpOverLimit is the HELP text of the textfile_over_limit metric
+const helpOverLimit = "Whether the exporter file of the job exceeds its size or series limit (1 = over the limit)"
+
+// CheckSize exports whether the exporter file of the job exceeds the limits set with WithSizeLimit as
+// textfile_over_limit, and logs a warning if it does: collectors such as the node_exporter textfile
+// collector truncate or slow down on files with thousands of accumulated series. It does nothing without limits.
+func (e *Exporter) CheckSize(jobName string) {
+	if e.config.metricDisabled || (e.config.maxBytes <= 0 && e.config.maxSeries <= 0) {
+		return
+	}
+	path := e.writePath(jobName)
+	content, err := afero.ReadFile(e.config.fs, path)
+	if err != nil {
+		log.Printf("Failed to check the size of metrics file %s: %v", path, err)
+		return
+	}
+	var over []string
+	if size := int64(len(content)); e.config.maxBytes > 0 && size > e.config.maxBytes {
+		over = append(over, fmt.Sprintf("%d bytes, over the limit of %d", size, e.config.maxBytes))
+	}
+	if series := countSeries(content); e.config.maxSeries > 0 && series > e.config.maxSeries {
+		over = append(over, fmt.Sprintf("%d series, over the limit of %d", series, e.config.maxSeries))
+	}
+	value := "0"
+	if len(over) > 0 {
+		value = "1"
+		log.Printf("Metrics file %s has %s; spread the jobs over several files, e.g. with --textfile-shards or --owner", path, strings.Join(over, " and "))
+	}
+	e.writeMetric("textfile_over_limit", MetricTypeGauge, jobName, nil, value, helpOverLimit)
+}
+
+// countSeries returns the number of samples in the content of an exporter file
+func countSeries(content []byte) int {
+	n := 0
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && line[0] != '#' {
+			n++
+		}
+	}
+	return n
+}
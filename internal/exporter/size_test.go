@@ -0,0 +1,71 @@
+package exporter
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// TestCheckSize tests that textfile_over_limit reports files over their size or series limit
+func TestCheckSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		maxSeries int
+		want      string
+	}{
+		{name: "no limit"},
+		{name: "under the limits", maxBytes: 1 << 20, maxSeries: 100, want: `crontab_textfile_over_limit{name="job1"} 0`},
+		{name: "over the size", maxBytes: 100, want: `crontab_textfile_over_limit{name="job1"} 1`},
+		{name: "over the series", maxSeries: 3, want: `crontab_textfile_over_limit{name="job1"} 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memFs := afero.NewMemMapFs()
+			exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithSizeLimit(tt.maxBytes, tt.maxSeries))
+			for _, job := range []string{"job1", "job2", "job3", "job4"} {
+				exp.WriteGauge("failed", job, "0", "Whether the job failed")
+			}
+			exp.CheckSize("job1")
+
+			content, _ := afero.ReadFile(memFs, filepath.Join("/test/path", "crons.prom"))
+			got := strings.Contains(string(content), "textfile_over_limit")
+			if tt.want == "" && got {
+				t.Errorf("Expected no textfile_over_limit without limits, got:\n%s", content)
+			}
+			if tt.want != "" && !strings.Contains(string(content), tt.want+"\n") {
+				t.Errorf("Expected %s, got:\n%s", tt.want, content)
+			}
+		})
+	}
+}
+
+// TestWithShards tests that the series of each job are written to the shard of its name
+func TestWithShards(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/test/path"), WithOwner("team-a"), WithShards(4))
+	files := map[string]bool{}
+	for i := range 20 {
+		job := "job" + string(rune('a'+i))
+		exp.WriteGauge("failed", job, "0", "Whether the job failed")
+		exp.WriteGauge("running", job, "0", "Whether the job is running")
+
+		path := exp.jobPath(job)
+		if !strings.HasPrefix(filepath.Base(path), "crons_team-a_shard") {
+			t.Fatalf("jobPath(%s) = %s, want a shard of the owner file", job, path)
+		}
+		content, _ := afero.ReadFile(memFs, path)
+		if !strings.Contains(string(content), `crontab_running{name="`+job+`",owner="team-a"} 0`) {
+			t.Errorf("Expected the series of %s in %s, got:\n%s", job, path, content)
+		}
+		files[path] = true
+	}
+	if len(files) < 2 || len(files) > 4 {
+		t.Errorf("Jobs written to %d files, want 2 to 4", len(files))
+	}
+	if _, err := memFs.Stat(exp.GetExporterPath()); err == nil {
+		t.Error("Expected nothing to be written to the unsharded file")
+	}
+}
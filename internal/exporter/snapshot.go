@@ -0,0 +1,193 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Sample is a sample of the exporter file
+type Sample struct {
+	// Name is the full metric name, e.g. crontab_failed
+	Name string
+	// Labels are the labels of the series, including the job name in the name label
+	Labels map[string]string
+	// Value is the sample value
+	Value float64
+	// Timestamp is the sample timestamp, zero if it was written without one
+	Timestamp time.Time
+}
+
+// Snapshot is the content of the exporter file, and of its shards, at the time it was read
+type Snapshot struct {
+	// Samples are the samples in the order of the file, then of its shards
+	Samples []Sample
+	// Types and Help are the TYPE and HELP of each metric by full name
+	Types map[string]MetricType
+	Help  map[string]string
+}
+
+// ReadSnapshot returns the metrics currently in the exporter file and its shards, empty if none exists yet.
+// It takes no lock, not even a shared one: writers replace the file atomically by renaming a complete one
+// over it, so a reader never sees a partial write anyway, while a LOCK_SH held during the read would still
+// make the exclusive lock of a writer wait for it. Status commands polling it, e.g. cronmgr top, thus never
+// delay the running jobs.
+func (e *Exporter) ReadSnapshot() (Snapshot, error) {
+	snapshot := Snapshot{Types: make(map[string]MetricType), Help: make(map[string]string)}
+	for _, path := range e.shardPaths() {
+		if err := snapshot.readFile(e.config.fs, path); err != nil {
+			return snapshot, err
+		}
+	}
+	return snapshot, nil
+}
+
+// readFile appends the samples of the exporter file path to the snapshot, nothing if it does not exist
+func (s *Snapshot) readFile(fsys afero.Fs, path string) error {
+	content, err := afero.ReadFile(fsys, path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			fields := strings.SplitN(strings.TrimSpace(comment), " ", 3)
+			if len(fields) == 3 && fields[0] == "TYPE" {
+				s.Types[fields[1]] = MetricType(fields[2])
+			} else if len(fields) == 3 && fields[0] == "HELP" {
+				s.Help[fields[1]] = fields[2]
+			}
+			continue
+		}
+		sample, err := parseSample(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		s.Samples = append(s.Samples, sample)
+	}
+	return scanner.Err()
+}
+
+// Job returns the samples of the job name
+func (s Snapshot) Job(name string) []Sample {
+	var samples []Sample
+	for _, sample := range s.Samples {
+		if sample.Labels["name"] == name {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// Value returns the value of the series of the full metric name of job with exactly labels, besides name
+func (s Snapshot) Value(metric, job string, labels map[string]string) (float64, bool) {
+	for _, sample := range s.Samples {
+		if sample.Name != metric || sample.Labels["name"] != job || len(sample.Labels) != len(labels)+1 {
+			continue
+		}
+		matches := true
+		for key, value := range labels {
+			if got, ok := sample.Labels[key]; !ok || got != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return sample.Value, true
+		}
+	}
+	return 0, false
+}
+
+// parseSample parses a sample line, e.g. crontab_failed{name="job"} 1 1700000000000
+func parseSample(line string) (Sample, error) {
+	sample := Sample{}
+	var rest string
+	var err error
+	if sample.Name, sample.Labels, rest, err = splitSample(line); err != nil {
+		return sample, err
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value in %q", line)
+	}
+	sample.Value = value
+	if len(fields) == 2 {
+		millis, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return sample, fmt.Errorf("invalid timestamp in %q", line)
+		}
+		sample.Timestamp = time.UnixMilli(millis)
+	}
+	return sample, nil
+}
+
+// splitSample splits a sample line into its metric name, its labels and the rest of the line, the value
+// and the optional timestamp
+func splitSample(line string) (name string, labels map[string]string, rest string, err error) {
+	labels = make(map[string]string)
+	i := strings.IndexAny(line, "{ ")
+	switch {
+	case i < 0:
+		return "", nil, "", fmt.Errorf("invalid sample %q", line)
+	case line[i] == '{':
+		if rest, err = parseLabels(line[i+1:], labels); err != nil {
+			return "", nil, "", fmt.Errorf("invalid labels in %q: %w", line, err)
+		}
+		return line[:i], labels, rest, nil
+	}
+	return line[:i], labels, line[i:], nil
+}
+
+// parseLabels parses the label pairs of s into labels up to the closing brace, unescaping the values
+// as written by escapeLabelValue. It returns the rest of s after the brace.
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, ", ")
+		if rest, ok := strings.CutPrefix(s, "}"); ok {
+			return rest, nil
+		}
+		key, rest, ok := strings.Cut(s, `="`)
+		if !ok || key == "" {
+			return "", errors.New("missing label value")
+		}
+		var value strings.Builder
+		i := 0
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] != '\\' || i+1 == len(rest) {
+				value.WriteByte(rest[i])
+				continue
+			}
+			i++
+			switch rest[i] {
+			case 'n':
+				value.WriteByte('\n')
+			default:
+				value.WriteByte(rest[i])
+			}
+		}
+		if i == len(rest) {
+			return "", errors.New("unterminated label value")
+		}
+		labels[key] = value.String()
+		s = rest[i+1:]
+	}
+}
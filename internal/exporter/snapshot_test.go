@@ -0,0 +1,134 @@
+package exporter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/spf13/afero"
+)
+
+// TestReadSnapshot tests parsing the metrics written by the exporter
+func TestReadSnapshot(t *testing.T) {
+	exp := NewExporter(WithFileSystem(afero.NewMemMapFs()), WithExporterDir("/metrics"), WithLabels(map[string]string{"env": "prod"}))
+	if snapshot, err := exp.ReadSnapshot(); err != nil || len(snapshot.Samples) != 0 {
+		t.Fatalf("ReadSnapshot() of a missing file = %+v, %v, want empty", snapshot, err)
+	}
+
+	completed := time.UnixMilli(1700000000000)
+	exp.WriteGauge("failed", "backup", "1", "Whether the job failed")
+	exp.WriteGaugeAt("last_run_timestamp_seconds", "backup", "1700000000", completed, "Last run")
+	exp.IncrementCounter("runs_total", "backup", map[string]string{"status": "failed"}, "Runs")
+	exp.IncrementCounter("runs_total", "backup", map[string]string{"status": "failed"}, "Runs")
+	exp.WriteGaugeWithLabels("running", `odd "job"\name`+"\n", map[string]string{"host": "web-1"}, "0", "Running")
+
+	snapshot, err := exp.ReadSnapshot()
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+	tests := []struct {
+		metric string
+		job    string
+		labels map[string]string
+		want   float64
+	}{
+		{metric: "crontab_failed", job: "backup", labels: map[string]string{"env": "prod"}, want: 1},
+		{metric: "crontab_runs_total", job: "backup", labels: map[string]string{"env": "prod", "status": "failed"}, want: 2},
+		{metric: "crontab_running", job: `odd "job"\name` + "\n", labels: map[string]string{"env": "prod", "host": "web-1"}, want: 0},
+	}
+	for _, tt := range tests {
+		if got, ok := snapshot.Value(tt.metric, tt.job, tt.labels); !ok || got != tt.want {
+			t.Errorf("Value(%s, %q, %v) = %v, %v, want %v", tt.metric, tt.job, tt.labels, got, ok, tt.want)
+		}
+	}
+	if _, ok := snapshot.Value("crontab_runs_total", "backup", map[string]string{"env": "prod"}); ok {
+		t.Error("Value() should only match the exact labels")
+	}
+	backup := snapshot.Job("backup")
+	if len(backup) != 3 || !backup[1].Timestamp.Equal(completed) {
+		t.Errorf("Job(backup) = %+v, want 3 samples with the timestamp of the last run", backup)
+	}
+	if snapshot.Types["crontab_runs_total"] != MetricTypeCounter || snapshot.Help["crontab_failed"] != "Whether the job failed" {
+		t.Errorf("Types = %v, Help = %v", snapshot.Types, snapshot.Help)
+	}
+}
+
+// TestReadSnapshotShards tests merging the series of every shard with WithShards
+func TestReadSnapshotShards(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	exp := NewExporter(WithFileSystem(memFs), WithExporterDir("/metrics"), WithShards(4))
+	jobs := []string{"backup", "report", "cleanup", "sync", "import", "export"}
+	shards := map[string]bool{}
+	for i, job := range jobs {
+		exp.WriteGauge("exit_code", job, strconv.Itoa(i), "Exit code")
+		shards[exp.jobPath(job)] = true
+	}
+	if len(shards) < 2 {
+		t.Fatalf("Jobs written to %d shards, want several", len(shards))
+	}
+	// A series left in the unsharded file, e.g. written before sharding, is read as well
+	if err := afero.WriteFile(memFs, "/metrics/crons.prom", []byte("crontab_exit_code{name=\"legacy\"} 9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := exp.ReadSnapshot()
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+	if len(snapshot.Samples) != len(jobs)+1 {
+		t.Errorf("ReadSnapshot() = %d samples, want %d", len(snapshot.Samples), len(jobs)+1)
+	}
+	for i, job := range append(jobs, "legacy") {
+		want := float64(i)
+		if job == "legacy" {
+			want = 9
+		}
+		if got, ok := snapshot.Value("crontab_exit_code", job, nil); !ok || got != want {
+			t.Errorf("Value(crontab_exit_code, %s) = %v, %v, want %v", job, got, ok, want)
+		}
+	}
+	if snapshot.Types["crontab_exit_code"] != MetricTypeGauge {
+		t.Errorf("Types = %v, want the TYPE of the shards", snapshot.Types)
+	}
+}
+
+// TestReadSnapshotInvalid tests reporting the line of an invalid sample
+func TestReadSnapshotInvalid(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/metrics/crons.prom", []byte("# TYPE crontab_failed gauge\ncrontab_failed{name=\"job} 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exp := NewExporter(WithFileSystem(fs), WithExporterDir("/metrics"))
+	if _, err := exp.ReadSnapshot(); err == nil {
+		t.Error("ReadSnapshot() should fail on an unterminated label value")
+	}
+}
+
+// TestReadSnapshotWhileLocked tests that reading does not wait for a writer holding the lock
+func TestReadSnapshotWhileLocked(t *testing.T) {
+	exp := NewExporter(WithExporterDir(t.TempDir()))
+	exp.WriteGauge("running", "backup", "1", "Running")
+
+	locker := fslock.NewLocker(exp.GetExporterPath(), true)
+	if err := locker.Lock(); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer func() { _ = locker.Unlock() }()
+	done := make(chan Snapshot)
+	go func() {
+		snapshot, err := exp.ReadSnapshot()
+		if err != nil {
+			t.Errorf("ReadSnapshot() error = %v", err)
+		}
+		done <- snapshot
+	}()
+	select {
+	case snapshot := <-done:
+		if value, ok := snapshot.Value("crontab_running", "backup", nil); !ok || value != 1 {
+			t.Errorf("ReadSnapshot() = %+v, want running 1", snapshot)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadSnapshot() waited for the write lock")
+	}
+}
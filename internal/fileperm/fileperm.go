@@ -0,0 +1,63 @@
+package fileperm
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ParseMode parses an octal file permission such as "0640" or "640"
+func ParseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q, expected octal permission bits such as 0640", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ParseOwner parses "user", "user:group" or ":group" into a uid and gid, -1 for the part not given.
+// Users and groups may be names or numeric IDs.
+func ParseOwner(s string) (uid, gid int, err error) {
+	userPart, groupPart, _ := strings.Cut(s, ":")
+	if userPart == "" && groupPart == "" {
+		return -1, -1, fmt.Errorf("invalid owner %q, expected user[:group]", s)
+	}
+	uid, gid = -1, -1
+	if userPart != "" {
+		if uid, err = lookupID(userPart, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		}); err != nil {
+			return -1, -1, err
+		}
+	}
+	if groupPart != "" {
+		if gid, err = lookupID(groupPart, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return -1, -1, err
+		}
+	}
+	return uid, gid, nil
+}
+
+// lookupID returns the numeric ID of nameOrID, resolving names with lookup
+func lookupID(nameOrID string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+	id, err := lookup(nameOrID)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(id)
+}
@@ -0,0 +1,71 @@
+package fileperm
+
+import (
+	"os"
+	"os/user"
+	"testing"
+)
+
+// TestParseMode tests the ParseMode function
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  os.FileMode
+		wantError bool
+	}{
+		{input: "0640", expected: 0640},
+		{input: "600", expected: 0600},
+		{input: "0777", expected: 0777},
+		{input: "1777", wantError: true},
+		{input: "0648", wantError: true},
+		{input: "rw-r-----", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseMode(tt.input)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseMode(%q) error = %v, wantError %v", tt.input, err, tt.wantError)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseMode(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestParseOwner tests the ParseOwner function
+func TestParseOwner(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("Cannot look up current user: %v", err)
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+
+	tests := []struct {
+		input     string
+		wantUID   int
+		wantGID   int
+		wantError bool
+	}{
+		{input: "1000:1001", wantUID: 1000, wantGID: 1001},
+		{input: "1000", wantUID: 1000, wantGID: -1},
+		{input: ":1001", wantUID: -1, wantGID: 1001},
+		{input: current.Username, wantUID: uid, wantGID: -1},
+		{input: current.Username + ":" + current.Gid, wantUID: uid, wantGID: gid},
+		{input: ":", wantError: true},
+		{input: "cronmgr-no-such-user", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			gotUID, gotGID, err := ParseOwner(tt.input)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseOwner(%q) error = %v, wantError %v", tt.input, err, tt.wantError)
+			}
+			if !tt.wantError && (gotUID != tt.wantUID || gotGID != tt.wantGID) {
+				t.Errorf("ParseOwner(%q) = %v, %v, want %v, %v", tt.input, gotUID, gotGID, tt.wantUID, tt.wantGID)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package fileperm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MACPolicy returns the mandatory access control policy enforced on this host, empty if none is detected
+func MACPolicy() string {
+	return macPolicy("/sys")
+}
+
+// macPolicy detects the enforced policy from the sysfs mounted at root
+func macPolicy(root string) string {
+	if readTrimmed(filepath.Join(root, "fs/selinux/enforce")) == "1" {
+		return "SELinux"
+	}
+	if readTrimmed(filepath.Join(root, "module/apparmor/parameters/enabled")) == "Y" {
+		return "AppArmor"
+	}
+	return ""
+}
+
+// DiagnoseWriteError describes a failed write to path. When the write was denied while
+// a MAC policy is enforced, it points at the policy, since the file mode may allow the write.
+func DiagnoseWriteError(path string, err error) string {
+	return diagnoseWriteError(path, err, MACPolicy())
+}
+
+// diagnoseWriteError describes a failed write to path under policy
+func diagnoseWriteError(path string, err error, policy string) string {
+	if !errors.Is(err, fs.ErrPermission) {
+		return fmt.Sprintf("cannot write %s: %v", path, err)
+	}
+	switch policy {
+	case "SELinux":
+		return fmt.Sprintf("permission denied writing %s: %v; SELinux is enforcing, check the file context with `ls -Z %s` and denials with `ausearch -m avc -ts recent`", path, err, filepath.Dir(path))
+	case "AppArmor":
+		return fmt.Sprintf("permission denied writing %s: %v; AppArmor is enabled, check the profile confining cronmgr and denials with `journalctl -k | grep apparmor=\"DENIED\"`", path, err)
+	default:
+		return fmt.Sprintf("permission denied writing %s: %v; check the ownership and mode of %s", path, err, filepath.Dir(path))
+	}
+}
+
+// readTrimmed reads a file, returning its trimmed content or an empty string on error
+func readTrimmed(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
@@ -0,0 +1,68 @@
+package fileperm
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestMACPolicy tests detecting the enforced policy from sysfs
+func TestMACPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{name: "none", expected: ""},
+		{name: "selinux enforcing", files: map[string]string{"fs/selinux/enforce": "1"}, expected: "SELinux"},
+		{name: "selinux permissive", files: map[string]string{"fs/selinux/enforce": "0"}, expected: ""},
+		{name: "apparmor", files: map[string]string{"module/apparmor/parameters/enabled": "Y\n"}, expected: "AppArmor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create dir: %v", err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write file: %v", err)
+				}
+			}
+			if result := macPolicy(root); result != tt.expected {
+				t.Errorf("macPolicy() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestDiagnoseWriteError tests the diagnostics of failed writes
+func TestDiagnoseWriteError(t *testing.T) {
+	denied := &fs.PathError{Op: "open", Path: "/metrics/crons.prom", Err: syscall.EACCES}
+	tests := []struct {
+		name   string
+		err    error
+		policy string
+		want   string
+	}{
+		{name: "other error", err: errors.New("disk full"), policy: "SELinux", want: "cannot write"},
+		{name: "denied without policy", err: denied, want: "check the ownership and mode of /metrics"},
+		{name: "denied by selinux", err: denied, policy: "SELinux", want: "ls -Z /metrics"},
+		{name: "denied by apparmor", err: denied, policy: "AppArmor", want: "AppArmor is enabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := diagnoseWriteError("/metrics/crons.prom", tt.err, tt.policy)
+			if !strings.Contains(result, tt.want) {
+				t.Errorf("diagnoseWriteError() = %q, want it to contain %q", result, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package fslock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// useBackend selects the backend name for the test
+func useBackend(t *testing.T, name string) {
+	t.Helper()
+	if err := SetBackend(name); err != nil {
+		t.Fatalf("SetBackend(%s) error = %v", name, err)
+	}
+	t.Cleanup(func() { _ = SetBackend(DefaultBackend) })
+}
+
+// TestBackends tests that the lockers of each backend exclude each other
+func TestBackends(t *testing.T) {
+	for _, name := range Backends() {
+		t.Run(name, func(t *testing.T) {
+			useBackend(t, name)
+			path := filepath.Join(t.TempDir(), "crons.prom")
+			first := NewLocker(path, true)
+			if err := first.Lock(); err != nil {
+				t.Fatalf("Lock() error = %v", err)
+			}
+			locked := make(chan struct{})
+			go func() {
+				second := NewLocker(path, true)
+				if err := second.Lock(); err != nil {
+					t.Errorf("second Lock() error = %v", err)
+				}
+				close(locked)
+				_ = second.Unlock()
+			}()
+			select {
+			case <-locked:
+				t.Fatal("second locker acquired the held lock")
+			case <-time.After(100 * time.Millisecond):
+			}
+			if err := first.Unlock(); err != nil {
+				t.Fatalf("Unlock() error = %v", err)
+			}
+			select {
+			case <-locked:
+			case <-time.After(5 * time.Second):
+				t.Fatal("second locker did not acquire the released lock")
+			}
+		})
+	}
+}
+
+// TestSetBackend tests selecting registered backends only
+func TestSetBackend(t *testing.T) {
+	if err := SetBackend("etcd"); err == nil {
+		t.Error("SetBackend(etcd) should fail before it is registered")
+	}
+	var created []string
+	Register("test", func(path string) Locker {
+		created = append(created, path)
+		return newMemLocker(path)
+	})
+	if !slices.Contains(Backends(), "test") {
+		t.Errorf("Backends() = %v, want test registered", Backends())
+	}
+	useBackend(t, "test")
+	NewLocker("/metrics/crons.prom", true)
+	NewLocker("/metrics/crons.prom", false)
+	if !slices.Equal(created, []string{"/metrics/crons.prom"}) {
+		t.Errorf("test backend created lockers for %v, want only the OS lock", created)
+	}
+}
+
+// TestDotLockerStale tests breaking the dotfile lock of a process that died
+func TestDotLockerStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crons.prom")
+	host, _ := os.Hostname()
+	tests := []struct {
+		name   string
+		holder string
+		age    time.Duration
+		broken bool
+	}{
+		{name: "dead process", holder: fmt.Sprintf("%s %d", host, 1<<22+1), broken: true},
+		{name: "other host", holder: "other-host 42"},
+		{name: "other host expired", holder: "other-host 42", age: time.Hour, broken: true},
+		{name: "being written", holder: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locker := newDotLocker(path).(*dotLocker)
+			if err := os.WriteFile(locker.path, []byte(tt.holder+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			modTime := time.Now().Add(-tt.age)
+			if err := os.Chtimes(locker.path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+			locker.breakStale(host)
+			_, err := os.Stat(locker.path)
+			if broken := os.IsNotExist(err); broken != tt.broken {
+				t.Errorf("lock broken = %v, want %v", broken, tt.broken)
+			}
+			_ = os.Remove(locker.path)
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package fslock
+
+import "path/filepath"
+
+// Canonical returns the absolute path of path with its symlinks resolved, so that all the spellings of
+// a file, e.g. through a symlinked directory or relative to another working directory, name the same file.
+// The trailing components of path that do not exist yet are kept as they are.
+func Canonical(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	var missing []string
+	for dir := abs; ; {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+		dir = parent
+	}
+}
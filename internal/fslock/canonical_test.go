@@ -0,0 +1,77 @@
+package fslock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCanonical tests resolving symlinks and relative paths, including paths not created yet
+func TestCanonical(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "node-exporter")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "metrics")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	t.Chdir(root)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: filepath.Join(link, "crons.prom"), want: filepath.Join(target, "crons.prom")},
+		{path: filepath.Join("metrics", "crons.prom"), want: filepath.Join(target, "crons.prom")},
+		{path: filepath.Join(link, "..", "metrics", "shard", "crons.prom"), want: filepath.Join(target, "shard", "crons.prom")},
+		{path: "missing/crons.prom", want: filepath.Join(root, "missing", "crons.prom")},
+	}
+	for _, tt := range tests {
+		if got := Canonical(tt.path); got != tt.want {
+			t.Errorf("Canonical(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestNewLockerCanonical tests that the spellings of a path through a symlink share the lock, also for the
+// backends serializing the lockers of a process by path
+func TestNewLockerCanonical(t *testing.T) {
+	for _, name := range Backends() {
+		t.Run(name, func(t *testing.T) {
+			useBackend(t, name)
+			target := t.TempDir()
+			link := filepath.Join(t.TempDir(), "metrics")
+			if err := os.Symlink(target, link); err != nil {
+				t.Skipf("symlinks not supported: %v", err)
+			}
+			first := NewLocker(filepath.Join(target, "crons.prom"), true)
+			if err := first.Lock(); err != nil {
+				t.Fatalf("Lock() error = %v", err)
+			}
+			locked := make(chan struct{})
+			go func() {
+				second := NewLocker(filepath.Join(link, "crons.prom"), true)
+				if err := second.Lock(); err != nil {
+					t.Errorf("second Lock() error = %v", err)
+				}
+				close(locked)
+				_ = second.Unlock()
+			}()
+			select {
+			case <-locked:
+				t.Fatal("the lock through the symlink was acquired while held")
+			case <-time.After(100 * time.Millisecond):
+			}
+			if err := first.Unlock(); err != nil {
+				t.Fatalf("Unlock() error = %v", err)
+			}
+			<-locked
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package fslock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/state"
+)
+
+// Timing of the dotfile lockers
+const (
+	// dotPollInterval is how often a held dotfile lock is tried again
+	dotPollInterval = 50 * time.Millisecond
+	// dotStaleAfter is the age after which the dotfile lock of another host is broken, the locks guard
+	// short file updates
+	dotStaleAfter = 5 * time.Minute
+)
+
+// dotLocker holds a lock by creating a lock file exclusively, which works on any file system. The file
+// records the host and PID of its holder, so the lock of a process that died is broken by the next one.
+type dotLocker struct {
+	path string
+	// local serializes the lockers of this process, they share its PID
+	local Locker
+}
+
+// newDotLocker creates a locker of path creating path.lck
+func newDotLocker(path string) Locker {
+	return &dotLocker{path: path + ".lck", local: newMemLocker(path + ".lck")}
+}
+
+func (d *dotLocker) Lock() error {
+	if err := d.local.Lock(); err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s %d\n", host, os.Getpid())
+	for {
+		file, err := os.OpenFile(d.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, lockFileMode())
+		if err == nil {
+			_, err = file.WriteString(owner)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(d.path)
+				_ = d.local.Unlock()
+				return err
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			_ = d.local.Unlock()
+			return err
+		}
+		d.breakStale(host)
+		time.Sleep(dotPollInterval)
+	}
+}
+
+// breakStale removes the lock file if its holder died on this host, or if it was left by another host for
+// longer than dotStaleAfter
+func (d *dotLocker) breakStale(host string) {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return
+	}
+	content, err := os.ReadFile(d.path)
+	if err != nil {
+		return
+	}
+	holder, pidText, _ := strings.Cut(strings.TrimSpace(string(content)), " ")
+	if pid, err := strconv.Atoi(pidText); holder == host && err == nil {
+		if state.ProcessAlive(pid) {
+			return
+		}
+	} else if time.Since(info.ModTime()) < dotStaleAfter {
+		// Held by another host, or being written by its holder
+		return
+	}
+	// Narrow the race with another process breaking the same lock and taking it before this one removes it
+	if current, err := os.Stat(d.path); err != nil || !os.SameFile(info, current) {
+		return
+	}
+	log.Printf("Breaking the lock %s of %s, its holder no longer exists", d.path, strings.TrimSpace(string(content)))
+	_ = os.Remove(d.path)
+}
+
+func (d *dotLocker) Unlock() error {
+	err := os.Remove(d.path)
+	if unlockErr := d.local.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
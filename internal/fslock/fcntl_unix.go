@@ -0,0 +1,68 @@
+//go:build unix
+
+package fslock
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+func init() {
+	Register("fcntl", newFcntlLocker)
+}
+
+// fcntlLocker holds a POSIX record lock on a lock file, which unlike flock(2) is supported by NFS
+// servers through their lock manager
+type fcntlLocker struct {
+	path string
+	// local serializes the lockers of this process, POSIX locks are owned by the process so they do
+	// not exclude each other
+	local Locker
+	file  *os.File
+}
+
+// newFcntlLocker creates a locker of path holding a POSIX record lock on path.lock
+func newFcntlLocker(path string) Locker {
+	return &fcntlLocker{path: path + ".lock", local: newMemLocker(path + ".lock")}
+}
+
+func (f *fcntlLocker) Lock() error {
+	if err := f.local.Lock(); err != nil {
+		return err
+	}
+	if err := createLockFile(f.path); err != nil {
+		_ = f.local.Unlock()
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_RDWR, 0)
+	if err != nil {
+		_ = f.local.Unlock()
+		return err
+	}
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: io.SeekStart}
+	for {
+		err = syscall.FcntlFlock(file.Fd(), syscall.F_SETLKW, &lock)
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = f.local.Unlock()
+		return &os.PathError{Op: "fcntl", Path: f.path, Err: err}
+	}
+	f.file = file
+	return nil
+}
+
+func (f *fcntlLocker) Unlock() error {
+	// Closing the file releases the lock
+	err := f.file.Close()
+	f.file = nil
+	if unlockErr := f.local.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
@@ -1,6 +1,13 @@
 package fslock
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+
 	"github.com/gofrs/flock"
 )
 
@@ -10,31 +17,108 @@ type Locker interface {
 	Unlock() error
 }
 
-// fsLocker uses real file system locking
+// fsLocker uses real file system locking, in the order of its queue
 type fsLocker struct {
-	lock *flock.Flock
+	lock  *flock.Flock
+	queue *queue
+	// ticket is the place in queue of the held lock
+	ticket uint64
+	// fallback is used instead of lock on platforms without file locking support
+	fallback Locker
 }
 
 func (f *fsLocker) Lock() error {
-	_, err := f.lock.TryLock()
+	if err := createLockFile(f.lock.Path()); err != nil {
+		return err
+	}
+	ticket, err := f.queue.wait()
+	if errors.Is(err, errors.ErrUnsupported) {
+		// File locking is not available on this platform, only serialize within this process
+		log.Printf("File locking is not supported on this platform, falling back to process-local lock for %s", f.lock.Path())
+		f.fallback = newMemLocker(f.lock.Path())
+		return f.fallback.Lock()
+	}
 	if err != nil {
 		return err
 	}
-	// If TryLock fails to acquire, use blocking Lock
-	if !f.lock.Locked() {
-		return f.lock.Lock()
+	// Only contended by a locker that took too long to notice it was served, or an older cronmgr
+	if err := f.lock.Lock(); err != nil {
+		f.queue.leave(ticket)
+		return err
 	}
+	f.ticket = ticket
 	return nil
 }
 
 func (f *fsLocker) Unlock() error {
-	return f.lock.Unlock()
+	if f.fallback != nil {
+		return f.fallback.Unlock()
+	}
+	err := f.lock.Unlock()
+	f.queue.leave(f.ticket)
+	return err
+}
+
+// newFlockLocker creates a locker of path holding a flock(2) lock on path.lock, queued in path.lock.queue
+func newFlockLocker(path string) Locker {
+	return &fsLocker{lock: flock.New(path + ".lock"), queue: newQueue(path + ".lock.queue")}
+}
+
+// Backend creates the lockers of a locking mechanism, each locking the file at path with lock files named
+// after it, e.g. path.lock. In a lock directory set with SetDir, path is the name of the file in it.
+type Backend func(path string) Locker
+
+// DefaultBackend is the backend used until another one is selected with SetBackend
+const DefaultBackend = "flock"
+
+var (
+	backendsMu sync.Mutex
+	// backends are the registered backends by name, fcntl is registered on Unix
+	backends = map[string]Backend{
+		"flock":   newFlockLocker,
+		"dotfile": newDotLocker,
+	}
+	// backend is the name of the backend of NewLocker
+	backend = DefaultBackend
+)
+
+// Register makes a backend available to SetBackend under name, e.g. a lock kept in a distributed store
+// for exporter directories on file systems without working locks. It replaces any backend of that name.
+func Register(name string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = b
+}
+
+// Backends returns the names of the registered backends, sorted
+func Backends() []string {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	return slices.Sorted(maps.Keys(backends))
+}
+
+// SetBackend selects the backend of the lockers created by NewLocker in this process.
+// All the processes sharing a file must lock it with the same backend.
+func SetBackend(name string) error {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, ok := backends[name]; !ok {
+		return fmt.Errorf("unknown lock backend %q, available: %v", name, slices.Sorted(maps.Keys(backends)))
+	}
+	backend = name
+	return nil
 }
 
-// NewLocker creates a locker. osLock true uses file system lock, false uses memory lock (for testing)
+// NewLocker creates a locker. osLock true uses the backend selected with SetBackend on the canonical path,
+// so that jobs spelling the path differently share the lock, falling back to the lock files of the user
+// if the shared ones are denied. osLock false uses memory lock (for testing)
 func NewLocker(path string, osLock bool) Locker {
-	if osLock {
-		return &fsLocker{lock: flock.New(path + ".lock")}
+	if !osLock {
+		return newMemLocker(path)
 	}
-	return newMemLocker(path)
+	backendsMu.Lock()
+	newBackend := backends[backend]
+	backendsMu.Unlock()
+	path = Canonical(path)
+	return &userLocker{path: path, newBackend: newBackend, active: newBackend(lockBase(path))}
 }
@@ -0,0 +1,75 @@
+//go:build unix
+
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestFsLockerIsOsLock tests that the lock is visible to other flock(2) users, e.g. other cronmgr processes
+func TestFsLockerIsOsLock(t *testing.T) {
+	tmpDir := t.TempDir()
+	lockPath := filepath.Join(tmpDir, "crons.prom")
+
+	locker := NewLocker(lockPath, true)
+	if err := locker.Lock(); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	// A separate open file description must not be able to take the lock
+	file, err := os.Open(lockPath + ".lock")
+	if err != nil {
+		t.Fatalf("Expected lock file to exist: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if !errors.Is(err, syscall.EWOULDBLOCK) {
+		t.Errorf("flock() on held lock = %v, want %v", err, syscall.EWOULDBLOCK)
+	}
+
+	if err := locker.Unlock(); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+
+	// After unlocking, the lock can be taken
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Errorf("flock() after unlock = %v, want nil", err)
+	}
+	_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+// TestSetDir tests keeping the lock files in the lock directory with the lock mode
+func TestSetDir(t *testing.T) {
+	dir, lockDir := t.TempDir(), t.TempDir()
+	useLocation(t, lockDir, 0666)
+	mask := syscall.Umask(022)
+	defer syscall.Umask(mask)
+
+	path := filepath.Join(dir, "crons.prom")
+	locker := NewLocker(path, true)
+	if err := locker.Lock(); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file created next to %s, want it in the lock directory", path)
+	}
+	lockFile := filepath.Join(lockDir, lockName(Canonical(path))+".lock")
+	info, err := os.Stat(lockFile)
+	if err != nil {
+		t.Fatalf("lock file missing from the lock directory: %v", err)
+	}
+	if info.Mode().Perm() != 0666 {
+		t.Errorf("lock file mode = %v, want %v despite the umask", info.Mode().Perm(), os.FileMode(0666))
+	}
+	// Other users take tickets in the queue as well
+	if info, err := os.Stat(lockFile + ".queue"); err != nil || info.Mode().Perm() != 0666 {
+		t.Errorf("queue file = %v, %v, want mode %v", info, err, os.FileMode(0666))
+	}
+}
@@ -0,0 +1,128 @@
+package fslock
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alswl/cron-manager/internal/fileperm"
+)
+
+// DefaultMode is the permission of the lock files until another one is set with SetMode
+const DefaultMode os.FileMode = 0644
+
+var (
+	locationMu sync.Mutex
+	// lockDir is the directory of the lock files, empty keeps them next to the locked files
+	lockDir string
+	// lockMode is the permission of the lock files
+	lockMode = DefaultMode
+	// warned are the lock files whose denial was logged
+	warned sync.Map
+)
+
+// SetDir keeps the lock files of this process in dir instead of next to the locked files, e.g. in a
+// directory writable by all the users running jobs while the textfile directory is not. The lock files
+// are named after the canonical path of the locked file, so all the processes setting the same dir share them.
+func SetDir(dir string) {
+	locationMu.Lock()
+	defer locationMu.Unlock()
+	lockDir = dir
+}
+
+// SetMode sets the permission of the lock files this process creates, e.g. 0666 for lock files shared by
+// several users. The umask does not apply.
+func SetMode(mode os.FileMode) {
+	locationMu.Lock()
+	defer locationMu.Unlock()
+	lockMode = mode
+}
+
+// lockBase returns the path the lock files of the file at the canonical path are named after
+func lockBase(path string) string {
+	locationMu.Lock()
+	dir := lockDir
+	locationMu.Unlock()
+	if dir == "" {
+		return path
+	}
+	return filepath.Join(dir, lockName(path))
+}
+
+// lockName flattens path into a file name, e.g. /var/lib/node-exporter/crons.prom into
+// var!lib!node-exporter!crons.prom
+func lockName(path string) string {
+	return strings.NewReplacer("/", "!", `\`, "!", ":", "!").Replace(strings.TrimLeft(filepath.ToSlash(path), "/"))
+}
+
+// lockFileMode returns the permission of the lock files
+func lockFileMode() os.FileMode {
+	locationMu.Lock()
+	defer locationMu.Unlock()
+	return lockMode
+}
+
+// createLockFile creates the lock file at path with the mode of the lock files, unless it exists
+func createLockFile(path string) error {
+	mode := lockFileMode()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
+	// Undo the umask, which would keep the other users from opening the lock file
+	return os.Chmod(path, mode)
+}
+
+// userLockDir returns the directory of the lock files of the current user, used when the shared ones are denied
+func userLockDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = filepath.Join(os.TempDir(), "cronmgr-"+strconv.Itoa(os.Getuid()))
+	} else {
+		dir = filepath.Join(dir, "cronmgr")
+	}
+	dir = filepath.Join(dir, "locks")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// userLocker locks with the lock files of the current user when it is denied the shared ones, e.g. created
+// by another user with a mode it cannot open. Such locks only exclude the jobs of the same user.
+type userLocker struct {
+	// path is the canonical path of the locked file
+	path       string
+	newBackend Backend
+	active     Locker
+}
+
+func (u *userLocker) Lock() error {
+	err := u.active.Lock()
+	if !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+	dir, dirErr := userLockDir()
+	if dirErr != nil {
+		log.Printf("Failed to create the lock directory %s: %v", dir, dirErr)
+		return err
+	}
+	base := lockBase(u.path)
+	if _, loaded := warned.LoadOrStore(base, true); !loaded {
+		log.Printf("%s; locking in %s instead, which only excludes the jobs of the same user. "+
+			"Give all users a writable --lock-dir and --lock-mode 0666 to share the locks",
+			fileperm.DiagnoseWriteError(base+".lock", err), dir)
+	}
+	u.active = u.newBackend(filepath.Join(dir, lockName(u.path)))
+	return u.active.Lock()
+}
+
+func (u *userLocker) Unlock() error {
+	return u.active.Unlock()
+}
@@ -0,0 +1,82 @@
+package fslock
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useLocation keeps the lock files in dir with mode for the test
+func useLocation(t *testing.T, dir string, mode os.FileMode) {
+	t.Helper()
+	SetDir(dir)
+	SetMode(mode)
+	t.Cleanup(func() {
+		SetDir("")
+		SetMode(DefaultMode)
+	})
+}
+
+// TestLockName tests flattening paths into lock file names
+func TestLockName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/var/lib/node-exporter/crons.prom", want: "var!lib!node-exporter!crons.prom"},
+		{path: "crons.prom", want: "crons.prom"},
+		{path: `C:\metrics\crons.prom`, want: "C!!metrics!crons.prom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := lockName(tt.path); got != tt.want {
+				t.Errorf("lockName(%s) = %s, want %s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestUserLockerFallback tests locking in the directory of the user when the shared lock files are denied
+func TestUserLockerFallback(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	t.Setenv("LocalAppData", cache)
+	shared := t.TempDir()
+	var created []string
+	Register("denied", func(path string) Locker {
+		created = append(created, path)
+		if strings.HasPrefix(path, shared) {
+			return deniedLocker{}
+		}
+		return newMemLocker(path)
+	})
+	useBackend(t, "denied")
+
+	locker := NewLocker(filepath.Join(shared, "crons.prom"), true)
+	if err := locker.Lock(); err != nil {
+		t.Fatalf("Lock() error = %v, want the lock of the user", err)
+	}
+	if err := locker.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if len(created) != 2 {
+		t.Fatalf("lockers created for %v, want the shared one and the one of the user", created)
+	}
+	if dir, _ := userLockDir(); filepath.Dir(created[1]) != dir {
+		t.Errorf("fallback lock at %s, want it in %s", created[1], dir)
+	}
+}
+
+// deniedLocker is denied its lock file
+type deniedLocker struct{}
+
+func (deniedLocker) Lock() error {
+	return &fs.PathError{Op: "open", Path: "crons.prom.lock", Err: fs.ErrPermission}
+}
+
+func (deniedLocker) Unlock() error {
+	return nil
+}
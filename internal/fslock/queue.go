@@ -0,0 +1,200 @@
+package fslock
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/gofrs/flock"
+)
+
+// Timing of the ticket queues
+const (
+	// queuePollInterval is how often the next waiter checks whether it is served, waiters further back in
+	// the queue check proportionally less often, up to queueMaxPoll
+	queuePollInterval = time.Millisecond
+	queueMaxPoll      = 10 * time.Millisecond
+	// queueStaleAfter is the time after which a ticket whose holder stopped waiting for it is skipped, e.g.
+	// when it ran on another host and died. The locks guard short file updates
+	queueStaleAfter = time.Minute
+	// queueHeartbeat is how often a waiter records that it still waits for its ticket; polling only reads
+	// the queue otherwise
+	queueHeartbeat = queueStaleAfter / 4
+)
+
+// ticket is a place in a queue
+type ticket struct {
+	number uint64
+	// host and pid identify the process holding the ticket
+	host string
+	pid  int
+	// since is the last time the holder of the ticket waited for it, or the time it was served
+	since time.Time
+}
+
+// alive reports whether the holder of t may still use it, the holders on other hosts are given queueStaleAfter
+func (t ticket) alive(host string) bool {
+	if t.host == host && !state.ProcessAlive(t.pid) {
+		return false
+	}
+	return time.Since(t.since) < queueStaleAfter
+}
+
+// queue serves the lockers of a file in the order they asked for it, so writers updating the file every
+// second cannot starve the others as with flock(2) alone, which wakes all the waiters and lets any of them,
+// or a newcomer, win. Its state is kept in a file, written under an exclusive flock(2) lock only to take and
+// leave a ticket, and polled by the waiters under a shared one.
+type queue struct {
+	path string
+	host string
+	lock *flock.Flock
+}
+
+// newQueue creates the queue kept in the file at path
+func newQueue(path string) *queue {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return &queue{path: path, host: host, lock: flock.New(path, flock.SetPermissions(lockFileMode()))}
+}
+
+// wait takes a ticket and returns it once it is served
+func (q *queue) wait() (uint64, error) {
+	var number uint64
+	err := q.update(func(serving, next *uint64, tickets map[uint64]ticket) {
+		number = *next
+		*next++
+		tickets[number] = ticket{number: number, host: q.host, pid: os.Getpid(), since: time.Now()}
+	})
+	if err != nil {
+		return 0, err
+	}
+	heartbeat := time.Now()
+	for {
+		serving, tickets, err := q.read()
+		if err != nil {
+			q.leave(number)
+			return 0, err
+		}
+		// Skip the tickets of lockers that died before being served or while holding the lock, the next
+		// leave drops them from the queue
+		serving = q.skipDead(serving, number, tickets)
+		// A ticket skipped while its holder was too slow to notice it was served still gets the lock
+		if serving >= number {
+			return number, nil
+		}
+		if time.Since(heartbeat) >= queueHeartbeat {
+			err := q.update(func(serving, next *uint64, tickets map[uint64]ticket) {
+				if t, ok := tickets[number]; ok {
+					t.since = time.Now()
+					tickets[number] = t
+				}
+			})
+			if err != nil {
+				q.leave(number)
+				return 0, err
+			}
+			heartbeat = time.Now()
+		}
+		time.Sleep(min(time.Duration(number-serving)*queuePollInterval, queueMaxPoll))
+	}
+}
+
+// skipDead returns the first ticket from serving, up to limit, whose holder may still use it
+func (q *queue) skipDead(serving, limit uint64, tickets map[uint64]ticket) uint64 {
+	for serving < limit {
+		if t, ok := tickets[serving]; ok && t.alive(q.host) {
+			break
+		}
+		serving++
+	}
+	return serving
+}
+
+// leave returns the ticket number, serving the next live ticket if it was being served
+func (q *queue) leave(number uint64) {
+	_ = q.update(func(serving, next *uint64, tickets map[uint64]ticket) {
+		delete(tickets, number)
+		skipped := q.skipDead(*serving, *next, tickets)
+		for ; *serving < skipped; *serving++ {
+			delete(tickets, *serving)
+		}
+	})
+}
+
+// read returns the ticket served and the tickets of the queue, under a shared lock
+func (q *queue) read() (uint64, map[uint64]ticket, error) {
+	if err := q.lock.RLock(); err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = q.lock.Unlock() }()
+	content, err := os.ReadFile(q.path)
+	if err != nil {
+		return 0, nil, err
+	}
+	serving, _, tickets := parseQueue(content)
+	return serving, tickets, nil
+}
+
+// update runs fn on the state of the queue under its exclusive lock and writes the state back. The file is
+// created with the mode of the lock files, so that the lockers of other users can take tickets as well.
+func (q *queue) update(fn func(serving, next *uint64, tickets map[uint64]ticket)) error {
+	if err := createLockFile(q.path); err != nil {
+		return err
+	}
+	if err := q.lock.Lock(); err != nil {
+		return err
+	}
+	defer func() { _ = q.lock.Unlock() }()
+	content, err := os.ReadFile(q.path)
+	if err != nil {
+		return err
+	}
+	serving, next, tickets := parseQueue(content)
+	fn(&serving, &next, tickets)
+	return os.WriteFile(q.path, formatQueue(serving, next, tickets), lockFileMode())
+}
+
+// parseQueue parses the state of a queue: the ticket served and the next one on the first line, then
+// a line per ticket holding its number, host, PID and time. An invalid state is reset.
+func parseQueue(content []byte) (serving, next uint64, tickets map[uint64]ticket) {
+	tickets = make(map[uint64]ticket)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	if !scanner.Scan() {
+		return 0, 0, tickets
+	}
+	if _, err := fmt.Sscanf(scanner.Text(), "%d %d", &serving, &next); err != nil || serving > next {
+		return 0, 0, tickets
+	}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		number, err1 := strconv.ParseUint(fields[0], 10, 64)
+		pid, err2 := strconv.Atoi(fields[2])
+		since, err3 := strconv.ParseInt(fields[3], 10, 64)
+		if err1 == nil && err2 == nil && err3 == nil {
+			tickets[number] = ticket{number: number, host: fields[1], pid: pid, since: time.Unix(0, since)}
+		}
+	}
+	return serving, next, tickets
+}
+
+// formatQueue formats the state of a queue as read by parseQueue
+func formatQueue(serving, next uint64, tickets map[uint64]ticket) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d %d\n", serving, next)
+	for number := serving; number < next; number++ {
+		if t, ok := tickets[number]; ok {
+			fmt.Fprintf(&b, "%d %s %d %d\n", t.number, t.host, t.pid, t.since.UnixNano())
+		}
+	}
+	return b.Bytes()
+}
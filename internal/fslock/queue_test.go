@@ -0,0 +1,171 @@
+package fslock
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestFsLockerStress stresses the lock with many writers and checks that they never hold it together
+func TestFsLockerStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	const (
+		writers = 24
+		rounds  = 10
+		hold    = 2 * time.Millisecond
+	)
+	path := filepath.Join(t.TempDir(), "crons.prom")
+	var (
+		mu      sync.Mutex
+		holders int
+		wg      sync.WaitGroup
+	)
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				locker := NewLocker(path, true)
+				if err := locker.Lock(); err != nil {
+					t.Errorf("Lock() error = %v", err)
+					return
+				}
+				mu.Lock()
+				holders++
+				if holders > 1 {
+					t.Error("two writers hold the lock")
+				}
+				mu.Unlock()
+				time.Sleep(hold)
+				mu.Lock()
+				holders--
+				mu.Unlock()
+				if err := locker.Unlock(); err != nil {
+					t.Errorf("Unlock() error = %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// waitForTickets waits until n tickets were taken from the queue at path
+func waitForTickets(t *testing.T, path string, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		content, _ := os.ReadFile(path)
+		if _, next, _ := parseQueue(content); next >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d tickets not taken, queue:\n%s", n, content)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestQueueOrder tests that the lockers are served in the order they took their tickets, and that waiting
+// only reads the queue
+func TestQueueOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crons.prom.lock.queue")
+	q := newQueue(path)
+	first, err := q.wait()
+	if err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	served := make(chan uint64, 2)
+	for i := range uint64(2) {
+		go func() {
+			number, err := newQueue(path).wait()
+			if err != nil {
+				t.Errorf("wait() error = %v", err)
+			}
+			served <- number
+		}()
+		// The waiters take their tickets one after the other
+		waitForTickets(t, path, first+i+2)
+	}
+
+	before, _ := os.ReadFile(path)
+	time.Sleep(20 * queueMaxPoll)
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Errorf("queue rewritten while the waiters poll it:\n%s\nthen:\n%s", before, after)
+	}
+
+	q.leave(first)
+	for _, want := range []uint64{first + 1, first + 2} {
+		select {
+		case number := <-served:
+			if number != want {
+				t.Fatalf("served ticket %d, want %d", number, want)
+			}
+			q.leave(number)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("ticket %d not served after the ones ahead left", want)
+		}
+	}
+	content, _ := os.ReadFile(path)
+	if serving, next, tickets := parseQueue(content); serving != next || len(tickets) != 0 {
+		t.Errorf("queue after all the tickets left = %d, %d, %v, want empty", serving, next, tickets)
+	}
+}
+
+// TestQueueSkipsDeadTickets tests that the tickets of lockers that died do not block the queue
+func TestQueueSkipsDeadTickets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crons.prom.lock.queue")
+	host, _ := os.Hostname()
+	now := time.Now().UnixNano()
+	content := fmt.Sprintf("3 6\n3 %s %d %d\n4 other-host 42 %d\n5 other-host 43 %d\n",
+		host, 1<<22+1, now, now-int64(2*queueStaleAfter), now)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q := newQueue(path)
+	done := make(chan uint64)
+	go func() {
+		number, err := q.wait()
+		if err != nil {
+			t.Errorf("wait() error = %v", err)
+		}
+		done <- number
+	}()
+	select {
+	case number := <-done:
+		t.Fatalf("wait() = %d before the live ticket 5 left", number)
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.leave(5)
+	select {
+	case number := <-done:
+		if number != 6 {
+			t.Errorf("wait() = %d, want 6", number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait() blocked after the tickets ahead were skipped or left")
+	}
+}
+
+// TestParseQueue tests reading back the state of a queue and resetting invalid ones
+func TestParseQueue(t *testing.T) {
+	since := time.Unix(0, 1700000000000000000)
+	tickets := map[uint64]ticket{
+		7: {number: 7, host: "web-1", pid: 42, since: since},
+		8: {number: 8, host: "web-2", pid: 43, since: since},
+	}
+	serving, next, parsed := parseQueue(formatQueue(7, 9, tickets))
+	if serving != 7 || next != 9 || len(parsed) != 2 || parsed[8] != tickets[8] {
+		t.Errorf("parseQueue() = %d, %d, %+v", serving, next, parsed)
+	}
+	for _, content := range []string{"", "garbage\n", "9 7\n"} {
+		if serving, next, parsed := parseQueue([]byte(content)); serving != 0 || next != 0 || len(parsed) != 0 {
+			t.Errorf("parseQueue(%q) = %d, %d, %+v, want a reset queue", content, serving, next, parsed)
+		}
+	}
+}
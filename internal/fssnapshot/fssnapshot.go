@@ -0,0 +1,164 @@
+package fssnapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of file systems snapshots are taken of
+const (
+	LVM   = "lvm"
+	ZFS   = "zfs"
+	Btrfs = "btrfs"
+)
+
+// btrfsDir is the directory inside the subvolume holding its snapshots when no other one is given
+const btrfsDir = ".cronmgr-snapshots"
+
+// runCommand runs a snapshot command, returning its output in the error if it fails
+var runCommand = func(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Spec is a file system snapshotted before each run, parsed from one of:
+//
+//	lvm:VG/LV[:SIZE]    snapshot of a logical volume, SIZE as accepted by lvcreate --size or --extents
+//	                    when it contains %, e.g. 10%ORIGIN; without it only thin volumes can be snapshotted
+//	zfs:DATASET         snapshot of a ZFS dataset
+//	btrfs:PATH[:DIR]    read-only snapshot of a btrfs subvolume into DIR, PATH/.cronmgr-snapshots by default
+type Spec struct {
+	// Kind is LVM, ZFS or Btrfs
+	Kind string
+	// Target is the logical volume, dataset or subvolume path
+	Target string
+	// Option is the size of an LVM snapshot or the directory of btrfs snapshots, empty for the default
+	Option string
+}
+
+// Parse parses a snapshot spec such as zfs:tank/data
+func Parse(spec string) (Spec, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	s := Spec{Kind: kind, Target: target}
+	switch kind {
+	case LVM:
+		s.Target, s.Option, _ = strings.Cut(target, ":")
+		vg, lv, ok := strings.Cut(s.Target, "/")
+		if !ok || vg == "" || lv == "" || strings.Contains(lv, "/") {
+			return Spec{}, fmt.Errorf("invalid logical volume %q, expected VG/LV", s.Target)
+		}
+	case ZFS:
+		// Dataset names may contain colons
+		if target == "" || strings.ContainsAny(target, "@# ") {
+			return Spec{}, fmt.Errorf("invalid dataset %q", target)
+		}
+	case Btrfs:
+		s.Target, s.Option, _ = strings.Cut(target, ":")
+		if !filepath.IsAbs(s.Target) {
+			return Spec{}, fmt.Errorf("subvolume path %q is not absolute", s.Target)
+		}
+		if s.Option != "" && !filepath.IsAbs(s.Option) {
+			return Spec{}, fmt.Errorf("snapshot directory %q is not absolute", s.Option)
+		}
+	default:
+		return Spec{}, fmt.Errorf("unknown snapshot kind %q in %q, expected lvm, zfs or btrfs", kind, spec)
+	}
+	if strings.ContainsAny(s.Option, " \t") {
+		return Spec{}, fmt.Errorf("invalid option %q", s.Option)
+	}
+	return s, nil
+}
+
+// String returns the spec as it is parsed
+func (s Spec) String() string {
+	if s.Option == "" {
+		return s.Kind + ":" + s.Target
+	}
+	return s.Kind + ":" + s.Target + ":" + s.Option
+}
+
+// Snapshot is a snapshot taken by Spec.Take
+type Snapshot struct {
+	Spec
+	// Name is the snapshot as named by its file system tools, e.g. tank/data@cronmgr-backup-20240101T020000Z-42
+	Name string
+}
+
+// String returns the name of the snapshot
+func (s Snapshot) String() string {
+	return s.Name
+}
+
+// Take takes a snapshot for the run runID of the job
+func (s Spec) Take(job, runID string) (Snapshot, error) {
+	name := "cronmgr-" + safeName(job) + "-" + runID
+	var snap Snapshot
+	var command []string
+	switch s.Kind {
+	case LVM:
+		vg, _ := path.Split(s.Target)
+		snap = Snapshot{Spec: s, Name: vg + name}
+		command = []string{"lvcreate", "--snapshot", "--name", name}
+		switch {
+		case strings.Contains(s.Option, "%"):
+			command = append(command, "--extents", s.Option)
+		case s.Option != "":
+			command = append(command, "--size", s.Option)
+		}
+		command = append(command, s.Target)
+	case ZFS:
+		snap = Snapshot{Spec: s, Name: s.Target + "@" + name}
+		command = []string{"zfs", "snapshot", snap.Name}
+	case Btrfs:
+		dir := s.Option
+		if dir == "" {
+			dir = filepath.Join(s.Target, btrfsDir)
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return Snapshot{}, err
+		}
+		snap = Snapshot{Spec: s, Name: filepath.Join(dir, name)}
+		command = []string{"btrfs", "subvolume", "snapshot", "-r", s.Target, snap.Name}
+	default:
+		return Snapshot{}, errors.ErrUnsupported
+	}
+	if err := runCommand(command[0], command[1:]...); err != nil {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+// Drop removes the snapshot
+func (s Snapshot) Drop() error {
+	switch s.Kind {
+	case LVM:
+		return runCommand("lvremove", "--yes", s.Name)
+	case ZFS:
+		return runCommand("zfs", "destroy", s.Name)
+	case Btrfs:
+		return runCommand("btrfs", "subvolume", "delete", s.Name)
+	default:
+		return errors.ErrUnsupported
+	}
+}
+
+// safeName replaces the characters of a job name that are not valid in the name of a snapshot
+func safeName(job string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, job)
+}
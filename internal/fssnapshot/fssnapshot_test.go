@@ -0,0 +1,138 @@
+package fssnapshot
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// recordCommands replaces runCommand with one recording the command lines and failing with err
+func recordCommands(t *testing.T, err error) *[][]string {
+	t.Helper()
+	var commands [][]string
+	previous := runCommand
+	runCommand = func(name string, args ...string) error {
+		commands = append(commands, append([]string{name}, args...))
+		return err
+	}
+	t.Cleanup(func() { runCommand = previous })
+	return &commands
+}
+
+// TestParse tests parsing snapshot specs
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Spec
+		wantErr bool
+	}{
+		{spec: "lvm:vg0/data", want: Spec{Kind: LVM, Target: "vg0/data"}},
+		{spec: "lvm:vg0/data:5G", want: Spec{Kind: LVM, Target: "vg0/data", Option: "5G"}},
+		{spec: "zfs:tank/data", want: Spec{Kind: ZFS, Target: "tank/data"}},
+		{spec: "zfs:tank/data:2024", want: Spec{Kind: ZFS, Target: "tank/data:2024"}},
+		{spec: "btrfs:/srv/data", want: Spec{Kind: Btrfs, Target: "/srv/data"}},
+		{spec: "btrfs:/srv/data:/srv/snapshots", want: Spec{Kind: Btrfs, Target: "/srv/data", Option: "/srv/snapshots"}},
+		{spec: "lvm:data", wantErr: true},
+		{spec: "lvm:vg0/data:5 G", wantErr: true},
+		{spec: "zfs:", wantErr: true},
+		{spec: "zfs:tank/data@daily", wantErr: true},
+		{spec: "btrfs:srv/data", wantErr: true},
+		{spec: "btrfs:/srv/data:snapshots", wantErr: true},
+		{spec: "xfs:/srv", wantErr: true},
+		{spec: "/srv", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+			if !tt.wantErr && got.String() != tt.spec {
+				t.Errorf("String() = %s, want %s", got, tt.spec)
+			}
+		})
+	}
+}
+
+// TestTakeDrop tests the commands taking and dropping snapshots
+func TestTakeDrop(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		spec     Spec
+		wantName string
+		wantTake []string
+		wantDrop []string
+	}{
+		{
+			spec:     Spec{Kind: LVM, Target: "vg0/data"},
+			wantName: "vg0/cronmgr-db_migrate-20240101T020000Z-42",
+			wantTake: []string{"lvcreate", "--snapshot", "--name", "cronmgr-db_migrate-20240101T020000Z-42", "vg0/data"},
+			wantDrop: []string{"lvremove", "--yes", "vg0/cronmgr-db_migrate-20240101T020000Z-42"},
+		},
+		{
+			spec:     Spec{Kind: LVM, Target: "vg0/data", Option: "5G"},
+			wantName: "vg0/cronmgr-db_migrate-20240101T020000Z-42",
+			wantTake: []string{"lvcreate", "--snapshot", "--name", "cronmgr-db_migrate-20240101T020000Z-42", "--size", "5G", "vg0/data"},
+			wantDrop: []string{"lvremove", "--yes", "vg0/cronmgr-db_migrate-20240101T020000Z-42"},
+		},
+		{
+			spec:     Spec{Kind: LVM, Target: "vg0/data", Option: "10%ORIGIN"},
+			wantName: "vg0/cronmgr-db_migrate-20240101T020000Z-42",
+			wantTake: []string{"lvcreate", "--snapshot", "--name", "cronmgr-db_migrate-20240101T020000Z-42", "--extents", "10%ORIGIN", "vg0/data"},
+			wantDrop: []string{"lvremove", "--yes", "vg0/cronmgr-db_migrate-20240101T020000Z-42"},
+		},
+		{
+			spec:     Spec{Kind: ZFS, Target: "tank/data"},
+			wantName: "tank/data@cronmgr-db_migrate-20240101T020000Z-42",
+			wantTake: []string{"zfs", "snapshot", "tank/data@cronmgr-db_migrate-20240101T020000Z-42"},
+			wantDrop: []string{"zfs", "destroy", "tank/data@cronmgr-db_migrate-20240101T020000Z-42"},
+		},
+		{
+			spec:     Spec{Kind: Btrfs, Target: dir},
+			wantName: filepath.Join(dir, btrfsDir, "cronmgr-db_migrate-20240101T020000Z-42"),
+			wantTake: []string{"btrfs", "subvolume", "snapshot", "-r", dir, filepath.Join(dir, btrfsDir, "cronmgr-db_migrate-20240101T020000Z-42")},
+			wantDrop: []string{"btrfs", "subvolume", "delete", filepath.Join(dir, btrfsDir, "cronmgr-db_migrate-20240101T020000Z-42")},
+		},
+		{
+			spec:     Spec{Kind: Btrfs, Target: dir, Option: filepath.Join(dir, "snapshots")},
+			wantName: filepath.Join(dir, "snapshots", "cronmgr-db_migrate-20240101T020000Z-42"),
+			wantTake: []string{"btrfs", "subvolume", "snapshot", "-r", dir, filepath.Join(dir, "snapshots", "cronmgr-db_migrate-20240101T020000Z-42")},
+			wantDrop: []string{"btrfs", "subvolume", "delete", filepath.Join(dir, "snapshots", "cronmgr-db_migrate-20240101T020000Z-42")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec.String(), func(t *testing.T) {
+			commands := recordCommands(t, nil)
+			snap, err := tt.spec.Take("db/migrate", "20240101T020000Z-42")
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if snap.Name != tt.wantName {
+				t.Errorf("Take() name = %s, want %s", snap.Name, tt.wantName)
+			}
+			if err := snap.Drop(); err != nil {
+				t.Fatalf("Drop() error = %v", err)
+			}
+			if len(*commands) != 2 || !slices.Equal((*commands)[0], tt.wantTake) || !slices.Equal((*commands)[1], tt.wantDrop) {
+				t.Errorf("commands = %q, want %q and %q", *commands, tt.wantTake, tt.wantDrop)
+			}
+		})
+	}
+}
+
+// TestTakeError tests that a failed snapshot command is returned
+func TestTakeError(t *testing.T) {
+	recordCommands(t, errors.New("zfs: exit status 1: dataset does not exist"))
+	snap, err := Spec{Kind: ZFS, Target: "tank/missing"}.Take("backup", "20240101T020000Z-42")
+	if err == nil || !strings.Contains(err.Error(), "dataset does not exist") {
+		t.Errorf("Take() error = %v, want the error of zfs", err)
+	}
+	if snap.Name != "" {
+		t.Errorf("Take() name = %s, want none", snap.Name)
+	}
+}
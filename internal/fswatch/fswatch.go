@@ -0,0 +1,53 @@
+package fswatch
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// MaxChanges bounds the changes kept by a Watcher, further changes are only counted
+const MaxChanges = 100
+
+// Change is a modification of a watched path
+type Change struct {
+	// Path is the file or directory that changed
+	Path string
+	// Op is the kind of change: create, modify, attrib, delete, rename or overflow when changes were lost
+	Op string
+}
+
+// String returns the change as "op path"
+func (c Change) String() string {
+	return c.Op + " " + c.Path
+}
+
+// changes collects the changes of a Watcher, ignoring those below the ignored paths
+type changes struct {
+	ignore []string
+	kept   []Change
+	total  int
+}
+
+// add records the change unless it is ignored or a duplicate
+func (c *changes) add(change Change) {
+	for _, ignored := range c.ignore {
+		if within(change.Path, ignored) || strings.HasPrefix(change.Path, ignored+".") {
+			return
+		}
+	}
+	for _, kept := range c.kept {
+		if kept == change {
+			return
+		}
+	}
+	c.total++
+	if len(c.kept) < MaxChanges {
+		c.kept = append(c.kept, change)
+	}
+}
+
+// within reports whether path is dir or below it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,132 @@
+//go:build linux
+
+package fswatch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// watchMask are the inotify events of writes, reads and closes are not watched
+const watchMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_DELETE | syscall.IN_DELETE_SELF |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_MOVE_SELF
+
+// Watcher records the changes of files and directory trees with inotify. The kernel queues the events,
+// which are read when the watcher stops, so nothing runs while the watched process does.
+type Watcher struct {
+	fd      int
+	paths   map[int32]string
+	changes changes
+}
+
+// Watch starts watching the paths, directories with all their subdirectories. Changes of the ignored
+// paths, below them or of files extending their name are not recorded, e.g. the log file written by
+// cronmgr itself and its chunks job.log.000.
+func Watch(paths []string, ignore []string) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	w := &Watcher{fd: fd, paths: make(map[int32]string), changes: changes{ignore: ignore}}
+	for _, path := range paths {
+		if err := w.addTree(path); err != nil {
+			_ = syscall.Close(fd)
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// addTree watches path and the directories below it, following root if it is a symbolic link
+func (w *Watcher) addTree(root string) error {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && !d.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, watchMask|syscall.IN_DONT_FOLLOW)
+		if err != nil {
+			if errors.Is(err, syscall.ENOSPC) {
+				return fmt.Errorf("watch %s: too many watches, raise fs.inotify.max_user_watches: %w", path, err)
+			}
+			return fmt.Errorf("watch %s: %w", path, err)
+		}
+		w.paths[int32(wd)] = path
+		return nil
+	})
+}
+
+// Stop stops watching and returns the changes recorded, at most MaxChanges, and their total number.
+// Stopping again returns the same changes.
+func (w *Watcher) Stop() ([]Change, int) {
+	if w.fd < 0 {
+		return w.changes.kept, w.changes.total
+	}
+	defer func() {
+		_ = syscall.Close(w.fd)
+		w.fd = -1
+	}()
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		if err != nil || n <= 0 {
+			break
+		}
+		w.parse(buf[:n])
+	}
+	return w.changes.kept, w.changes.total
+}
+
+// parse records the changes of the inotify events in buf
+func (w *Watcher) parse(buf []byte) {
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		offset = nameStart + int(event.Len)
+		if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			w.changes.add(Change{Op: "overflow"})
+			continue
+		}
+		path, ok := w.paths[event.Wd]
+		if !ok || event.Mask&syscall.IN_IGNORED != 0 {
+			continue
+		}
+		if event.Len > 0 {
+			name := buf[nameStart:offset]
+			for i, c := range name {
+				if c == 0 {
+					name = name[:i]
+					break
+				}
+			}
+			path = filepath.Join(path, string(name))
+		}
+		w.changes.add(Change{Path: path, Op: op(event.Mask)})
+	}
+}
+
+// op names the change of the event mask
+func op(mask uint32) string {
+	switch {
+	case mask&syscall.IN_CREATE != 0:
+		return "create"
+	case mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0:
+		return "delete"
+	case mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVED_TO|syscall.IN_MOVE_SELF) != 0:
+		return "rename"
+	case mask&syscall.IN_ATTRIB != 0:
+		return "attrib"
+	default:
+		return "modify"
+	}
+}
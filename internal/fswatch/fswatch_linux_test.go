@@ -0,0 +1,65 @@
+//go:build linux
+
+package fswatch
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestWatch tests recording the changes of a directory tree and a file
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	tree := filepath.Join(dir, "tree")
+	for _, d := range []string{filepath.Join(tree, "sub"), filepath.Join(tree, "logs")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(dir, "config.ini")
+	for _, path := range []string{file, filepath.Join(tree, "sub", "data.csv"), filepath.Join(tree, "old.txt")} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := Watch([]string{tree, file}, []string{filepath.Join(tree, "logs")})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	// Reads are not changes
+	if _, err := os.ReadFile(filepath.Join(tree, "sub", "data.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tree, "sub", "data.csv"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tree, "logs", "run.log"), []byte("ignored"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tree, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	changes, total := w.Stop()
+
+	want := []Change{
+		{Path: filepath.Join(tree, "sub", "data.csv"), Op: "modify"},
+		{Path: filepath.Join(tree, "old.txt"), Op: "delete"},
+		{Path: file, Op: "attrib"},
+	}
+	if !slices.Equal(changes, want) || total != len(want) {
+		t.Errorf("Stop() = %v, %d, want %v", changes, total, want)
+	}
+}
+
+// TestWatchMissing tests that watching a missing path fails
+func TestWatchMissing(t *testing.T) {
+	if _, err := Watch([]string{filepath.Join(t.TempDir(), "missing")}, nil); err == nil {
+		t.Error("Watch() of a missing path succeeded")
+	}
+}
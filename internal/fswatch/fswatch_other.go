@@ -0,0 +1,18 @@
+//go:build !linux
+
+package fswatch
+
+import "errors"
+
+// Watcher records the changes of files, it is not supported on this platform
+type Watcher struct{}
+
+// Watch returns errors.ErrUnsupported, inotify only exists on Linux
+func Watch(paths []string, ignore []string) (*Watcher, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Stop returns no change
+func (w *Watcher) Stop() ([]Change, int) {
+	return nil, 0
+}
@@ -0,0 +1,25 @@
+package fswatch
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestChangesAdd tests ignoring, deduplicating and bounding the recorded changes
+func TestChangesAdd(t *testing.T) {
+	c := changes{ignore: []string{"/var/log/cronmgr", "/srv/backup.log"}}
+	c.add(Change{Path: "/var/log/cronmgr/backup.log", Op: "modify"})
+	c.add(Change{Path: "/srv/backup.log.000", Op: "create"})
+	c.add(Change{Path: "/var/log/cronmgr", Op: "attrib"})
+	c.add(Change{Path: "/var/log/cronmgr-other/a", Op: "modify"})
+	c.add(Change{Path: "/var/log/cronmgr-other/a", Op: "modify"})
+	for i := range MaxChanges + 10 {
+		c.add(Change{Path: fmt.Sprintf("/srv/data/%d", i), Op: "create"})
+	}
+	if len(c.kept) != MaxChanges || c.total != MaxChanges+11 {
+		t.Errorf("kept %d changes out of %d, want %d out of %d", len(c.kept), c.total, MaxChanges, MaxChanges+11)
+	}
+	if c.kept[0] != (Change{Path: "/var/log/cronmgr-other/a", Op: "modify"}) {
+		t.Errorf("first change = %v", c.kept[0])
+	}
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Path is the URL path the health of the command is served on
+const Path = "/healthz"
+
+// States of the command reported by the server
+const (
+	// StateStarting is reported until the command is started, e.g. while the run waits for its dependencies
+	StateStarting = "starting"
+	// StateRunning is reported while the command runs
+	StateRunning = "running"
+	// StateRetrying is reported between a failed attempt and the next one
+	StateRetrying = "retrying"
+	// StateExited is reported once the command exited, the only state that is not healthy
+	StateExited = "exited"
+)
+
+// Report is the health of the command, served as JSON
+type Report struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// PID is the process ID of the command, once it was started
+	PID     int `json:"pid,omitempty"`
+	Attempt int `json:"attempt,omitempty"`
+	// ElapsedSeconds is how long the command has been running, or ran until it exited
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// ExitCode is the exit code of the command, once it exited
+	ExitCode *int `json:"exit_code,omitempty"`
+}
+
+// Server serves the health of the command wrapped by cronmgr over HTTP, so that Kubernetes or monit can
+// health-check a long-running command through cronmgr. It answers 200 while the command is alive, or about
+// to be started, and 503 once it exited.
+type Server struct {
+	name     string
+	now      func() time.Time
+	mu       sync.Mutex
+	state    string
+	pid      int
+	attempt  int
+	started  time.Time
+	exitedAt time.Time
+	exitCode int
+	server   *http.Server
+	addr     string
+}
+
+// New creates the Server of job name, reporting StateStarting until Started is called
+func New(name string) *Server {
+	return &Server{name: name, now: time.Now, state: StateStarting}
+}
+
+// Listen serves the health on the TCP address addr, e.g. :8081 or 127.0.0.1:8081, until Close
+func (s *Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(Path, s)
+	s.addr = listener.Addr().String()
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = s.server.Serve(listener) }()
+	return nil
+}
+
+// Addr returns the address the health is served on, once Listen succeeded
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Close stops serving the health
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	if err := s.server.Close(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Started records that attempt of the command was started as process pid
+func (s *Server) Started(pid, attempt int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state, s.pid, s.attempt, s.started = StateRunning, pid, attempt, s.now()
+}
+
+// Exited records that the command exited with exitCode
+func (s *Server) Exited(exitCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state, s.exitCode, s.exitedAt = StateExited, exitCode, s.now()
+}
+
+// Retrying records that the command is started again after a failed attempt
+func (s *Server) Retrying() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = StateRetrying
+}
+
+// Report returns the current health of the command
+func (s *Server) Report() Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := Report{Name: s.name, State: s.state, PID: s.pid, Attempt: s.attempt}
+	switch s.state {
+	case StateRunning:
+		report.ElapsedSeconds = s.now().Sub(s.started).Seconds()
+	case StateExited, StateRetrying:
+		report.ElapsedSeconds = s.exitedAt.Sub(s.started).Seconds()
+		exitCode := s.exitCode
+		report.ExitCode = &exitCode
+	}
+	return report
+}
+
+// ServeHTTP answers with the Report of the command, with status 503 once it exited
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	report := s.Report()
+	status := http.StatusOK
+	if report.State == StateExited {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,131 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTP tests the report and status served in each state of the command
+func TestServeHTTP(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		update      func(s *Server, now *time.Time)
+		wantStatus  int
+		wantState   string
+		wantElapsed float64
+		// wantExit is the exit code in the report, nil without one
+		wantExit any
+	}{
+		{
+			name:       "starting",
+			update:     func(s *Server, now *time.Time) {},
+			wantStatus: http.StatusOK,
+			wantState:  StateStarting,
+		},
+		{
+			name: "running",
+			update: func(s *Server, now *time.Time) {
+				s.Started(1234, 1)
+				*now = now.Add(2 * time.Hour)
+			},
+			wantStatus:  http.StatusOK,
+			wantState:   StateRunning,
+			wantElapsed: 7200,
+		},
+		{
+			name: "retrying",
+			update: func(s *Server, now *time.Time) {
+				s.Started(1234, 1)
+				*now = now.Add(time.Minute)
+				s.Exited(1)
+				s.Retrying()
+				*now = now.Add(time.Minute)
+			},
+			wantStatus:  http.StatusOK,
+			wantState:   StateRetrying,
+			wantElapsed: 60,
+			wantExit:    1,
+		},
+		{
+			name: "exited",
+			update: func(s *Server, now *time.Time) {
+				s.Started(1234, 1)
+				*now = now.Add(time.Minute)
+				s.Exited(0)
+				*now = now.Add(time.Minute)
+			},
+			wantStatus:  http.StatusServiceUnavailable,
+			wantState:   StateExited,
+			wantElapsed: 60,
+			wantExit:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			s := New("worker")
+			s.now = func() time.Time { return now }
+			tt.update(s, &now)
+
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var report Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("invalid report %s: %v", rec.Body, err)
+			}
+			if report.Name != "worker" || report.State != tt.wantState || report.ElapsedSeconds != tt.wantElapsed {
+				t.Errorf("report = %+v, want state %s after %vs", report, tt.wantState, tt.wantElapsed)
+			}
+			if got := deref(report.ExitCode); got != tt.wantExit {
+				t.Errorf("ExitCode = %v, want %v", got, tt.wantExit)
+			}
+		})
+	}
+}
+
+// deref returns the value of an optional exit code, or nil
+func deref(code *int) any {
+	if code == nil {
+		return nil
+	}
+	return *code
+}
+
+// TestListen tests serving the health over HTTP
+func TestListen(t *testing.T) {
+	s := New("worker")
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer func() { _ = s.Close() }()
+	s.Started(1234, 1)
+
+	url := "http://" + s.Addr() + Path
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", url, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	resp, err = http.Post(url, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("POST %s error = %v", url, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", resp.StatusCode)
+	}
+
+	if err := New("other").Listen(s.Addr()); err == nil {
+		t.Error("Listen() on an address in use should fail")
+	}
+}
@@ -0,0 +1,230 @@
+package history
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// DailyDir is the directory of the daily aggregates inside the journal directory
+const DailyDir = "daily"
+
+// dayLayout is the format of Daily.Day
+const dayLayout = time.DateOnly
+
+// Daily aggregates the runs of a job that started on one day (UTC)
+type Daily struct {
+	// Name is the job name
+	Name string `json:"name"`
+	// Day is the day the runs started, formatted as YYYY-MM-DD
+	Day string `json:"day"`
+	// Runs is the number of runs
+	Runs int `json:"runs"`
+	// Failures is the number of failed runs
+	Failures int `json:"failures"`
+	// P50Seconds is the median duration of the runs
+	P50Seconds float64 `json:"p50_duration_seconds"`
+	// P95Seconds is the 95th percentile duration of the runs
+	P95Seconds float64 `json:"p95_duration_seconds"`
+}
+
+// Retention configures how long runs are kept in the journal
+type Retention struct {
+	// Runs is how long individual runs are kept before they are compacted into daily aggregates
+	Runs time.Duration
+	// Daily is how long daily aggregates are kept, 0 keeps them forever
+	Daily time.Duration
+}
+
+// dailyPath returns the daily aggregates file of the job name
+func (j *Journal) dailyPath(name string) string {
+	return filepath.Join(j.dir, DailyDir, fileName(name))
+}
+
+// Compact replaces the runs of the job name that started before the retention of runs, counted in
+// whole days (UTC) before now, with daily aggregates, and drops aggregates older than their retention.
+// It returns the number of compacted runs.
+func (j *Journal) Compact(name string, retention Retention, now time.Time) (int, error) {
+	if retention.Runs <= 0 {
+		return 0, nil
+	}
+	// Only whole days are compacted, so each day is aggregated exactly once
+	cutoff := now.Add(-retention.Runs).UTC().Truncate(24 * time.Hour)
+
+	locker, err := j.lock(name)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	records, err := j.Read(name, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	// Runs are appended as they finish, overlapping runs may be out of start time order
+	var compacted, kept []Record
+	for _, record := range records {
+		if record.StartTime.Before(cutoff) {
+			compacted = append(compacted, record)
+		} else {
+			kept = append(kept, record)
+		}
+	}
+	if len(compacted) == 0 {
+		return 0, nil
+	}
+
+	daily, err := j.ReadDaily(name)
+	if err != nil {
+		return 0, err
+	}
+	daily = append(daily, aggregate(name, compacted)...)
+	if retention.Daily > 0 {
+		oldest := now.Add(-retention.Daily).UTC().Format(dayLayout)
+		daily = slices.DeleteFunc(daily, func(d Daily) bool { return d.Day < oldest })
+	}
+
+	// Write the aggregates first, a failure in between duplicates counts instead of losing runs
+	if err := writeLines(j, j.dailyPath(name), daily); err != nil {
+		return 0, err
+	}
+	if err := writeLines(j, j.path(name), kept); err != nil {
+		return 0, err
+	}
+	return len(compacted), nil
+}
+
+// ReadDaily returns the daily aggregates of the job name, oldest first
+func (j *Journal) ReadDaily(name string) ([]Daily, error) {
+	daily, err := j.readDaily(j.dailyPath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return daily, err
+}
+
+// readDaily parses the daily aggregates file at path
+func (j *Journal) readDaily(path string) ([]Daily, error) {
+	return readLines(j, path, func(Daily) bool { return true })
+}
+
+// ReadAllDaily returns the daily aggregates of all jobs, ordered by day
+func (j *Journal) ReadAllDaily() ([]Daily, error) {
+	entries, err := afero.ReadDir(j.fs, filepath.Join(j.dir, DailyDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var daily []Daily
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".jsonl" {
+			continue
+		}
+		jobDaily, err := j.readDaily(filepath.Join(j.dir, DailyDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		daily = append(daily, jobDaily...)
+	}
+	slices.SortStableFunc(daily, func(a, b Daily) int {
+		return strings.Compare(a.Day, b.Day)
+	})
+	return daily, nil
+}
+
+// aggregate groups runs by the day (UTC) they started, in order of the days
+func aggregate(name string, records []Record) []Daily {
+	durations := map[string][]float64{}
+	failures := map[string]int{}
+	var days []string
+	for _, record := range records {
+		day := record.StartTime.UTC().Format(dayLayout)
+		if _, ok := durations[day]; !ok {
+			days = append(days, day)
+		}
+		durations[day] = append(durations[day], record.DurationSeconds)
+		if record.Status != "success" {
+			failures[day]++
+		}
+	}
+	slices.Sort(days)
+
+	daily := make([]Daily, 0, len(days))
+	for _, day := range days {
+		sorted := slices.Sorted(slices.Values(durations[day]))
+		daily = append(daily, Daily{
+			Name:       name,
+			Day:        day,
+			Runs:       len(sorted),
+			Failures:   failures[day],
+			P50Seconds: percentile(sorted, 0.5),
+			P95Seconds: percentile(sorted, 0.95),
+		})
+	}
+	return daily
+}
+
+// percentile returns the nearest-rank percentile p of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// TypicalDuration returns the median duration of the successful runs in records, zero if there is none
+func TypicalDuration(records []Record) time.Duration {
+	var durations []float64
+	for _, record := range records {
+		if record.Status == "success" {
+			durations = append(durations, record.DurationSeconds)
+		}
+	}
+	slices.Sort(durations)
+	return time.Duration(percentile(durations, 0.5) * float64(time.Second))
+}
+
+// writeLines atomically replaces the file at path with one journal line per value
+func writeLines[T any](j *Journal, path string, values []T) error {
+	if err := j.fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	file, err := j.fs.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, value := range values {
+		line, err := j.encodeLine(value)
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		if _, err := writer.Write(line); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return j.fs.Rename(tmpPath, path)
+}
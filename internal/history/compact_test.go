@@ -0,0 +1,147 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// TestJournalCompact tests compacting old runs into daily aggregates
+func TestJournalCompact(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := day.Add(9*24*time.Hour + 12*time.Hour)
+	var records []Record
+	// Day 1: durations 1..20 seconds with 2 failures, day 2: one run, days 9 and 10: recent runs
+	for i := 1; i <= 20; i++ {
+		status := "success"
+		if i%10 == 0 {
+			status = "failed"
+		}
+		records = append(records, Record{Name: "job", StartTime: day.Add(time.Duration(i) * time.Minute), DurationSeconds: float64(i), Status: status})
+	}
+	records = append(records,
+		Record{Name: "job", StartTime: day.Add(24*time.Hour + time.Hour), DurationSeconds: 5, Status: "success"},
+		Record{Name: "job", StartTime: day.Add(8*24*time.Hour + time.Hour), DurationSeconds: 7, Status: "success"},
+		Record{Name: "job", StartTime: now.Add(-time.Hour), DurationSeconds: 8, Status: "failed"},
+	)
+
+	journal := NewJournal(afero.NewMemMapFs(), "/history")
+	for _, record := range records {
+		if err := journal.Append(record); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	// Keeping 2 days of runs compacts everything before the start of day 8
+	compacted, err := journal.Compact("job", Retention{Runs: 2 * 24 * time.Hour}, now)
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if compacted != 21 {
+		t.Errorf("Compact() = %d, want 21", compacted)
+	}
+	kept, err := journal.Read("job", time.Time{})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !reflect.DeepEqual(kept, records[21:]) {
+		t.Errorf("Read() after compaction = %+v, want %+v", kept, records[21:])
+	}
+	wantDaily := []Daily{
+		{Name: "job", Day: "2024-01-01", Runs: 20, Failures: 2, P50Seconds: 10, P95Seconds: 19},
+		{Name: "job", Day: "2024-01-02", Runs: 1, P50Seconds: 5, P95Seconds: 5},
+	}
+	daily, err := journal.ReadDaily("job")
+	if err != nil {
+		t.Fatalf("ReadDaily() error = %v", err)
+	}
+	if !reflect.DeepEqual(daily, wantDaily) {
+		t.Errorf("ReadDaily() = %+v, want %+v", daily, wantDaily)
+	}
+
+	// Nothing is left to compact
+	if compacted, err := journal.Compact("job", Retention{Runs: 2 * 24 * time.Hour}, now); err != nil || compacted != 0 {
+		t.Errorf("second Compact() = %d, %v, want 0", compacted, err)
+	}
+
+	// Two days later the day 9 run is compacted and aggregates older than 10 days are dropped
+	compacted, err = journal.Compact("job", Retention{Runs: 2 * 24 * time.Hour, Daily: 10 * 24 * time.Hour}, now.Add(48*time.Hour))
+	if err != nil || compacted != 1 {
+		t.Fatalf("Compact() two days later = %d, %v, want 1", compacted, err)
+	}
+	daily, err = journal.ReadAllDaily()
+	if err != nil {
+		t.Fatalf("ReadAllDaily() error = %v", err)
+	}
+	wantDaily = []Daily{
+		{Name: "job", Day: "2024-01-02", Runs: 1, P50Seconds: 5, P95Seconds: 5},
+		{Name: "job", Day: "2024-01-09", Runs: 1, P50Seconds: 7, P95Seconds: 7},
+	}
+	if !reflect.DeepEqual(daily, wantDaily) {
+		t.Errorf("ReadAllDaily() = %+v, want %+v", daily, wantDaily)
+	}
+}
+
+// TestJournalCompactDisabled tests that runs are kept without a retention
+func TestJournalCompactDisabled(t *testing.T) {
+	journal := NewJournal(afero.NewMemMapFs(), "/history")
+	if err := journal.Append(Record{Name: "job", Status: "success"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if compacted, err := journal.Compact("job", Retention{}, time.Now()); err != nil || compacted != 0 {
+		t.Errorf("Compact() = %d, %v, want 0", compacted, err)
+	}
+}
+
+// TestPercentile tests nearest-rank percentiles
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{name: "empty", p: 0.5, want: 0},
+		{name: "single", values: []float64{3}, p: 0.95, want: 3},
+		{name: "median of four", values: []float64{1, 2, 3, 4}, p: 0.5, want: 2},
+		{name: "p95 of ten", values: []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, p: 0.95, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.values, tt.p); got != tt.want {
+				t.Errorf("percentile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestTypicalDuration tests the median duration of successful runs
+func TestTypicalDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []Record
+		want    time.Duration
+	}{
+		{name: "no runs", want: 0},
+		{name: "only failures", records: []Record{{Status: "failed", DurationSeconds: 5}}, want: 0},
+		{
+			name: "failures ignored",
+			records: []Record{
+				{Status: "success", DurationSeconds: 30},
+				{Status: "failed", DurationSeconds: 1},
+				{Status: "success", DurationSeconds: 10},
+				{Status: "success", DurationSeconds: 20},
+			},
+			want: 20 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TypicalDuration(tt.records); got != tt.want {
+				t.Errorf("TypicalDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Formats supported by Export
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// csvHeader are the columns of the CSV export
+var csvHeader = []string{"name", "owner", "start_time", "finish_time", "duration_seconds", "status", "error_type", "exit_code", "attempts", "run_id"}
+
+// dailyCSVHeader are the columns of the CSV export of daily aggregates
+var dailyCSVHeader = []string{"name", "day", "runs", "failures", "p50_duration_seconds", "p95_duration_seconds"}
+
+// Export writes records to w in format, csv or json
+func Export(w io.Writer, format string, records []Record) error {
+	return export(w, format, records, csvHeader, recordRow)
+}
+
+// ExportDaily writes daily aggregates to w in format, csv or json
+func ExportDaily(w io.Writer, format string, daily []Daily) error {
+	return export(w, format, daily, dailyCSVHeader, dailyRow)
+}
+
+// export writes values to w in format, CSV rows are built by row
+func export[T any](w io.Writer, format string, values []T, header []string, row func(T) []string) error {
+	switch format {
+	case FormatCSV:
+		return exportCSV(w, values, header, row)
+	case FormatJSON:
+		if values == nil {
+			values = []T{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(values)
+	default:
+		return fmt.Errorf("unsupported format %q, use %s or %s", format, FormatCSV, FormatJSON)
+	}
+}
+
+// exportCSV writes values as CSV with a header line
+func exportCSV[T any](w io.Writer, values []T, header []string, row func(T) []string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := writer.Write(row(value)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// recordRow returns the CSV row of a run, times in RFC 3339
+func recordRow(record Record) []string {
+	return []string{
+		record.Name,
+		record.Owner,
+		record.StartTime.Format(time.RFC3339),
+		record.FinishTime.Format(time.RFC3339),
+		strconv.FormatFloat(record.DurationSeconds, 'f', 2, 64),
+		record.Status,
+		record.ErrorType,
+		strconv.Itoa(record.ExitCode),
+		strconv.Itoa(record.Attempts),
+		record.RunID,
+	}
+}
+
+// dailyRow returns the CSV row of a daily aggregate
+func dailyRow(daily Daily) []string {
+	return []string{
+		daily.Name,
+		daily.Day,
+		strconv.Itoa(daily.Runs),
+		strconv.Itoa(daily.Failures),
+		strconv.FormatFloat(daily.P50Seconds, 'f', 2, 64),
+		strconv.FormatFloat(daily.P95Seconds, 'f', 2, 64),
+	}
+}
@@ -0,0 +1,77 @@
+package history
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestExport tests the CSV and JSON exports
+func TestExport(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Name: "backup", Owner: "team-a", StartTime: start, FinishTime: start.Add(90 * time.Second), DurationSeconds: 90, Status: "failed", ErrorType: "job", ExitCode: 2, Attempts: 1, RunID: "20240101T020000Z-42"},
+	}
+
+	tests := []struct {
+		name      string
+		format    string
+		records   []Record
+		want      string
+		wantError bool
+	}{
+		{
+			name:    "csv",
+			format:  FormatCSV,
+			records: records,
+			want: "name,owner,start_time,finish_time,duration_seconds,status,error_type,exit_code,attempts,run_id\n" +
+				"backup,team-a,2024-01-01T02:00:00Z,2024-01-01T02:01:30Z,90.00,failed,job,2,1,20240101T020000Z-42\n",
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			records: []Record{
+				{Name: "backup", StartTime: start, FinishTime: start, Status: "success"},
+			},
+			want: `[
+  {
+    "name": "backup",
+    "start_time": "2024-01-01T02:00:00Z",
+    "finish_time": "2024-01-01T02:00:00Z",
+    "duration_seconds": 0,
+    "status": "success",
+    "exit_code": 0
+  }
+]
+`,
+		},
+		{name: "empty json", format: FormatJSON, want: "[]\n"},
+		{name: "unsupported", format: "xml", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Export(&buf, tt.format, tt.records)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Export() error = %v, wantError %v", err, tt.wantError)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Export() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestExportDaily tests the CSV export of daily aggregates
+func TestExportDaily(t *testing.T) {
+	var buf bytes.Buffer
+	daily := []Daily{{Name: "backup", Day: "2024-01-01", Runs: 24, Failures: 1, P50Seconds: 61.5, P95Seconds: 90}}
+	if err := ExportDaily(&buf, FormatCSV, daily); err != nil {
+		t.Fatalf("ExportDaily() error = %v", err)
+	}
+	want := "name,day,runs,failures,p50_duration_seconds,p95_duration_seconds\n" +
+		"backup,2024-01-01,24,1,61.50,90.00\n"
+	if buf.String() != want {
+		t.Errorf("ExportDaily() = %q, want %q", buf.String(), want)
+	}
+}
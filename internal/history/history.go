@@ -0,0 +1,221 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/spf13/afero"
+)
+
+// Record is a finished run of a job
+type Record struct {
+	// Name is the job name
+	Name string `json:"name"`
+	// Owner is the owner the metrics of the job are sharded by, empty if they are not
+	Owner string `json:"owner,omitempty"`
+	// RunID identifies the run, see runner.RunID
+	RunID string `json:"run_id,omitempty"`
+	// StartTime is the time the run started
+	StartTime time.Time `json:"start_time"`
+	// FinishTime is the time the run finished
+	FinishTime time.Time `json:"finish_time"`
+	// DurationSeconds is the time the command took to run, excluding idle wait
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Status is the status the run was counted with in runs_total
+	Status string `json:"status"`
+	// ErrorType is the error type of a failed run: exec, job, timeout or readonly
+	ErrorType string `json:"error_type,omitempty"`
+	// ExitCode is the exit code of the job
+	ExitCode int `json:"exit_code"`
+	// Attempts is the number of times the command was started
+	Attempts int `json:"attempts,omitempty"`
+	// LogFile is the path the output of the run was written to, empty if it was discarded
+	LogFile string `json:"log_file,omitempty"`
+	// Args are the command and its arguments as executed, for cronmgr replay
+	Args []string `json:"args,omitempty"`
+	// Env is the environment of the command with the values of secrets redacted, see RedactEnv
+	Env []string `json:"env,omitempty"`
+	// Dir is the working directory of the command
+	Dir string `json:"dir,omitempty"`
+}
+
+// Journal appends the finished runs of each job to a JSON lines file named after the job in a directory
+type Journal struct {
+	fs  afero.Fs
+	dir string
+	// useOsLock locks journal files with file system locks, only possible on the OS file system
+	useOsLock bool
+	// cipher encrypts each line of the journal files, nil stores them as plain JSON
+	cipher *crypt.Cipher
+}
+
+// Option is a function that configures a Journal
+type Option func(*Journal)
+
+// WithCipher encrypts the journal files at rest
+func WithCipher(c *crypt.Cipher) Option {
+	return func(j *Journal) {
+		j.cipher = c
+	}
+}
+
+// NewJournal creates a Journal keeping its files in dir
+func NewJournal(fs afero.Fs, dir string, opts ...Option) *Journal {
+	_, isOsFs := fs.(*afero.OsFs)
+	j := &Journal{fs: fs, dir: dir, useOsLock: isOsFs}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// path returns the journal file of the job name
+func (j *Journal) path(name string) string {
+	return filepath.Join(j.dir, fileName(name))
+}
+
+// fileName returns the name of the journal files of the job name
+func fileName(name string) string {
+	// Job names are free text, keep them from escaping the journal directory
+	return strings.ReplaceAll(name, string(filepath.Separator), "_") + ".jsonl"
+}
+
+// lock locks the journal files of the job name against concurrent appends and compaction
+func (j *Journal) lock(name string) (fslock.Locker, error) {
+	locker := fslock.NewLocker(j.path(name), j.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return nil, fmt.Errorf("couldn't lock journal of %s: %w", name, err)
+	}
+	return locker, nil
+}
+
+// Append adds a finished run to the journal of its job
+func (j *Journal) Append(record Record) error {
+	if err := j.fs.MkdirAll(j.dir, 0755); err != nil {
+		return err
+	}
+	line, err := j.encodeLine(record)
+	if err != nil {
+		return err
+	}
+	locker, err := j.lock(record.Name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	file, err := j.fs.OpenFile(j.path(record.Name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Read returns the runs of the job name that started at or after since, oldest first
+func (j *Journal) Read(name string, since time.Time) ([]Record, error) {
+	records, err := j.read(j.path(name), since)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return records, err
+}
+
+// ReadAll returns the runs of all jobs that started at or after since, oldest first
+func (j *Journal) ReadAll(since time.Time) ([]Record, error) {
+	entries, err := afero.ReadDir(j.fs, j.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".jsonl" {
+			continue
+		}
+		jobRecords, err := j.read(filepath.Join(j.dir, entry.Name()), since)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, jobRecords...)
+	}
+	sort.SliceStable(records, func(a, b int) bool {
+		return records[a].StartTime.Before(records[b].StartTime)
+	})
+	return records, nil
+}
+
+// read parses the journal file at path, keeping runs started at or after since
+func (j *Journal) read(path string, since time.Time) ([]Record, error) {
+	return readLines(j, path, func(record Record) bool {
+		return !record.StartTime.Before(since)
+	})
+}
+
+// encodeLine encodes value as a journal line, encrypted if the journal has a cipher
+func (j *Journal) encodeLine(value any) ([]byte, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if j.cipher != nil {
+		content = j.cipher.SealLine(content)
+	}
+	return append(content, '\n'), nil
+}
+
+// decodeLine decodes a journal line into value
+func (j *Journal) decodeLine(line []byte, value any) error {
+	if j.cipher != nil {
+		plaintext, err := j.cipher.OpenLine(line)
+		if err != nil {
+			return err
+		}
+		line = plaintext
+	}
+	return json.Unmarshal(line, value)
+}
+
+// readLines parses the journal lines of the file at path, keeping the values keep returns true for
+func readLines[T any](j *Journal, path string, keep func(T) bool) ([]T, error) {
+	file, err := j.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var values []T
+	// A run killed while appending leaves a truncated last line, only lines followed by others must be valid
+	var lastErr error
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		var value T
+		if err := j.decodeLine(scanner.Bytes(), &value); err != nil {
+			lastErr = fmt.Errorf("invalid journal line %s:%d: %w", path, line, err)
+			continue
+		}
+		if keep(value) {
+			values = append(values, value)
+		}
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,122 @@
+package history
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/spf13/afero"
+)
+
+// TestJournal tests appending and reading runs
+func TestJournal(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	journal := NewJournal(fs, "/state/history")
+
+	if records, err := journal.ReadAll(time.Time{}); err != nil || records != nil {
+		t.Fatalf("ReadAll() of empty journal = %v, %v, want nil", records, err)
+	}
+
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Name: "backup", StartTime: start, FinishTime: start.Add(time.Minute), DurationSeconds: 60, Status: "success"},
+		{Name: "team/report", StartTime: start.Add(time.Hour), FinishTime: start.Add(2 * time.Hour), Status: "failed", ErrorType: "job", ExitCode: 2},
+		{Name: "backup", StartTime: start.Add(24 * time.Hour), FinishTime: start.Add(25 * time.Hour), Status: "failed", ErrorType: "timeout", ExitCode: -1, Attempts: 3},
+	}
+	for _, record := range records {
+		if err := journal.Append(record); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		job   string
+		since time.Time
+		want  []Record
+	}{
+		{name: "all jobs", want: records},
+		{name: "all jobs since", since: start.Add(time.Hour), want: records[1:]},
+		{name: "one job", job: "backup", want: []Record{records[0], records[2]}},
+		{name: "job with separator", job: "team/report", want: records[1:2]},
+		{name: "unknown job", job: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Record
+			var err error
+			if tt.job != "" {
+				got, err = journal.Read(tt.job, tt.since)
+			} else {
+				got, err = journal.ReadAll(tt.since)
+			}
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if exists, _ := afero.Exists(fs, "/state/history/team_report.jsonl"); !exists {
+		t.Error("Job names with path separators should stay in the journal directory")
+	}
+}
+
+// TestJournalTruncatedLine tests that a line cut short by a killed run is skipped
+func TestJournalTruncatedLine(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := `{"name":"job","start_time":"2024-01-01T02:00:00Z","finish_time":"2024-01-01T02:01:00Z","duration_seconds":60,"status":"success","exit_code":0}
+{"name":"job","start_time":"2024-01-02T02:00:00Z","finish_ti
+`
+	if err := afero.WriteFile(fs, "/history/job.jsonl", []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	records, err := NewJournal(fs, "/history").Read("job", time.Time{})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("Read() returned %d records, want 1", len(records))
+	}
+	// A corrupted line followed by others is an error
+	if err := afero.WriteFile(fs, "/history/job.jsonl", []byte(content+content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := NewJournal(fs, "/history").Read("job", time.Time{}); err == nil {
+		t.Error("Read() expected error for corrupted line")
+	}
+}
+
+// TestJournalCipher tests that an encrypted journal is readable with its key only
+func TestJournalCipher(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	c, err := crypt.NewCipher(bytes.Repeat([]byte{1}, crypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	record := Record{Name: "job", StartTime: time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC), Status: "success"}
+	if err := NewJournal(fs, "/history", WithCipher(c)).Append(record); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	content, err := afero.ReadFile(fs, "/history/job.jsonl")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if bytes.Contains(content, []byte("success")) {
+		t.Errorf("journal is not encrypted: %s", content)
+	}
+
+	records, err := NewJournal(fs, "/history", WithCipher(c)).Read("job", time.Time{})
+	if err != nil || !reflect.DeepEqual(records, []Record{record}) {
+		t.Errorf("Read() with key = %+v, %v, want %+v", records, err, record)
+	}
+	// The only line is treated like a truncated one without the key
+	if records, _ := NewJournal(fs, "/history").Read("job", time.Time{}); len(records) != 0 {
+		t.Errorf("Read() without key = %+v, want no records", records)
+	}
+}
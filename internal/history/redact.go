@@ -0,0 +1,41 @@
+package history
+
+import (
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// Redacted replaces the values of secret environment variables in the run history
+const Redacted = "[REDACTED]"
+
+// secretNameParts are parts of the names of environment variables holding secrets
+var secretNameParts = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "KEY", "CREDENTIAL", "AUTH", "COOKIE", "SESSION", "PRIVATE"}
+
+// RedactEnv returns env with the values of the variables named like secrets, e.g. DB_PASSWORD or
+// INFLUX_TOKEN, replaced by Redacted. Variables naming the file of a secret keep their path.
+func RedactEnv(env []string) []string {
+	redacted := make([]string, 0, len(env))
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if IsSecretName(name) {
+			entry = name + "=" + Redacted
+		}
+		redacted = append(redacted, entry)
+	}
+	return redacted
+}
+
+// IsSecretName reports whether the environment variable name is redacted by RedactEnv
+func IsSecretName(name string) bool {
+	upper := strings.ToUpper(name)
+	if strings.HasSuffix(upper, secret.FileSuffix) {
+		return false
+	}
+	for _, part := range secretNameParts {
+		if strings.Contains(upper, part) {
+			return true
+		}
+	}
+	return false
+}
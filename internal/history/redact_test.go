@@ -0,0 +1,31 @@
+package history
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestRedactEnv tests that the values of secrets are redacted from the recorded environment
+func TestRedactEnv(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin:/bin",
+		"DB_PASSWORD=hunter2",
+		"influx_token=abc",
+		"AWS_SECRET_ACCESS_KEY=xyz",
+		"INFLUX_TOKEN_FILE=/run/secrets/influx",
+		"HOME=/root",
+		"EMPTY",
+	}
+	want := []string{
+		"PATH=/usr/bin:/bin",
+		"DB_PASSWORD=" + Redacted,
+		"influx_token=" + Redacted,
+		"AWS_SECRET_ACCESS_KEY=" + Redacted,
+		"INFLUX_TOKEN_FILE=/run/secrets/influx",
+		"HOME=/root",
+		"EMPTY",
+	}
+	if got := RedactEnv(env); !slices.Equal(got, want) {
+		t.Errorf("RedactEnv() = %v, want %v", got, want)
+	}
+}
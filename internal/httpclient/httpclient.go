@@ -0,0 +1,109 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/netdial"
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// DefaultTimeout is the timeout of a request when none is configured
+const DefaultTimeout = 10 * time.Second
+
+// ProxyPasswordEnv is the environment variable with the password of the proxy user
+const ProxyPasswordEnv = "CRONMGR_PROXY_PASSWORD"
+
+// Config configures the HTTP client shared by the push backends and notifiers
+type Config struct {
+	// Proxy is the URL of the proxy all requests go through, e.g. http://user@proxy:3128.
+	// Empty uses the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables
+	Proxy string
+	// ProxyPassword authenticates the user of the Proxy URL, replacing the password of the URL if any.
+	// It is read again for each connection so it can be rotated
+	ProxyPassword *secret.Secret
+	// CAFile is a PEM bundle of CAs trusted in addition to the system roots, e.g. of a TLS-inspecting proxy
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key presented to the servers asking for one
+	CertFile string
+	KeyFile  string
+	// Timeout bounds each request, 0 uses DefaultTimeout
+	Timeout time.Duration
+	// BindInterface is the interface name or local address the connections are made from, see netdial.New
+	BindInterface string
+	// DNSCache records the address of each server, used while its name cannot be resolved, nil disables it
+	DNSCache *netdial.Cache
+}
+
+// New creates an HTTP client for cfg
+func New(cfg Config) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer, err := netdial.New(cfg.BindInterface, cfg.DNSCache)
+	if err != nil {
+		return nil, err
+	}
+	transport.DialContext = dialer.DialContext
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", cfg.Proxy)
+		}
+		if cfg.ProxyPassword != nil && (proxy.User == nil || proxy.User.Username() == "") {
+			return nil, fmt.Errorf("proxy URL %q has no user for the proxy password", cfg.Proxy)
+		}
+		transport.Proxy = func(*http.Request) (*url.URL, error) {
+			if cfg.ProxyPassword == nil {
+				return proxy, nil
+			}
+			password, err := cfg.ProxyPassword.Get()
+			if err != nil {
+				return nil, fmt.Errorf("proxy password: %w", err)
+			}
+			authenticated := *proxy
+			authenticated.User = url.UserPassword(proxy.User.Username(), password)
+			return &authenticated, nil
+		}
+	} else if cfg.ProxyPassword != nil {
+		return nil, errors.New("a proxy password requires a proxy URL")
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("the client certificate and key must be set together")
+	}
+	if cfg.CAFile != "" || cfg.CertFile != "" {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.CAFile != "" {
+		content, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("CA bundle: no PEM certificate in %s", cfg.CAFile)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
@@ -0,0 +1,176 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// writeCertificate writes a self-signed client certificate and its key as PEM files in dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "batch-host"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// TestNewProxy tests sending the requests through an authenticated proxy
+func TestNewProxy(t *testing.T) {
+	tests := []struct {
+		name              string
+		cfg               Config
+		wantAuthorization string
+	}{
+		{name: "anonymous"},
+		{name: "credentials in URL", cfg: Config{Proxy: "http://batch:secret@"}, wantAuthorization: "batch:secret"},
+		{name: "password", cfg: Config{Proxy: "http://batch@", ProxyPassword: secret.Value("s3cret")}, wantAuthorization: "batch:s3cret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotURL, gotAuthorization string
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotURL = r.URL.String()
+				gotAuthorization = r.Header.Get("Proxy-Authorization")
+			}))
+			defer proxy.Close()
+
+			cfg := tt.cfg
+			if cfg.Proxy == "" {
+				cfg.Proxy = "http://"
+			}
+			cfg.Proxy += proxy.Listener.Addr().String()
+			client, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			resp, err := client.Get("http://pushgateway.example.com:9091/metrics")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if gotURL != "http://pushgateway.example.com:9091/metrics" {
+				t.Errorf("proxied URL = %s, want http://pushgateway.example.com:9091/metrics", gotURL)
+			}
+			wantAuthorization := ""
+			if tt.wantAuthorization != "" {
+				wantAuthorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(tt.wantAuthorization))
+			}
+			if gotAuthorization != wantAuthorization {
+				t.Errorf("Proxy-Authorization = %q, want %q", gotAuthorization, wantAuthorization)
+			}
+		})
+	}
+}
+
+// TestNewTLS tests trusting a CA bundle and presenting a client certificate
+func TestNewTLS(t *testing.T) {
+	var gotClient string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			gotClient = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := writeCertificate(t, dir)
+
+	client, err := New(Config{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if gotClient != "batch-host" {
+		t.Errorf("client certificate = %q, want batch-host", gotClient)
+	}
+
+	// The server certificate is not trusted without the CA bundle
+	client, err = New(Config{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if resp, err := client.Get(server.URL); err == nil {
+		_ = resp.Body.Close()
+		t.Error("Get() succeeded without the CA bundle")
+	}
+}
+
+// TestNewInvalid tests rejecting invalid configurations
+func TestNewInvalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "proxy without host", cfg: Config{Proxy: "proxy:3128"}},
+		{name: "password without proxy", cfg: Config{ProxyPassword: secret.Value("secret")}},
+		{name: "password without user", cfg: Config{Proxy: "http://proxy:3128", ProxyPassword: secret.Value("secret")}},
+		{name: "missing CA bundle", cfg: Config{CAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "CA bundle without certificate", cfg: Config{CAFile: notPEM}},
+		{name: "certificate without key", cfg: Config{CertFile: certFile}},
+		{name: "mismatched key", cfg: Config{CertFile: keyFile, KeyFile: certFile}},
+		{name: "unknown bind interface", cfg: Config{BindInterface: "cronmgr-missing0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("New() error = nil, want an error")
+			}
+		})
+	}
+}
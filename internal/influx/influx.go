@@ -0,0 +1,160 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// DefaultTimeout is the timeout of a write when none is configured
+const DefaultTimeout = 10 * time.Second
+
+// TokenEnv is the environment variable with the API token of InfluxDB, as used by the influx CLI
+const TokenEnv = "INFLUX_TOKEN"
+
+// Point is a point in the InfluxDB line protocol
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	Time        time.Time
+}
+
+// Line renders the point in the line protocol with a nanosecond timestamp, tags and fields sorted by key.
+// Tags with an empty value are skipped, the line protocol does not allow them.
+func (p Point) Line() string {
+	var b strings.Builder
+	b.WriteString(escape(p.Measurement, ", "))
+	for _, key := range slices.Sorted(maps.Keys(p.Tags)) {
+		if p.Tags[key] == "" {
+			continue
+		}
+		b.WriteString("," + escape(key, ",= ") + "=" + escape(p.Tags[key], ",= "))
+	}
+	for i, key := range slices.Sorted(maps.Keys(p.Fields)) {
+		if i == 0 {
+			b.WriteString(" ")
+		} else {
+			b.WriteString(",")
+		}
+		b.WriteString(escape(key, ",= ") + "=" + strconv.FormatFloat(p.Fields[key], 'g', -1, 64))
+	}
+	b.WriteString(" " + strconv.FormatInt(p.Time.UnixNano(), 10) + "\n")
+	return b.String()
+}
+
+// escape escapes the special characters of the line protocol element with a backslash
+func escape(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Lines renders points in the line protocol
+func Lines(points []Point) []byte {
+	var b bytes.Buffer
+	for _, p := range points {
+		b.WriteString(p.Line())
+	}
+	return b.Bytes()
+}
+
+// AppendFile appends points to the file at path in a single write, e.g. for the tail input of Telegraf.
+// Runs of several jobs can share the file, appends of a few lines are not interleaved.
+func AppendFile(path string, points []Point) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(Lines(points))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Config configures a Writer
+type Config struct {
+	// URL is the base URL of InfluxDB, e.g. http://influxdb:8086
+	URL    string
+	Org    string
+	Bucket string
+	// Token is the API token, read again for each write so it can be rotated; nil sends no authorization
+	Token *secret.Secret
+	// Timeout bounds each write, 0 uses DefaultTimeout
+	Timeout time.Duration
+	// HTTPClient sends the writes, e.g. through a proxy, nil uses a client with Timeout
+	HTTPClient *http.Client
+}
+
+// Writer writes points to the v2 write API of InfluxDB
+type Writer struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewWriter creates a Writer for cfg
+func NewWriter(cfg Config) *Writer {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	return &Writer{cfg: cfg, client: client}
+}
+
+// Target identifies the bucket the writer writes to
+func (w *Writer) Target() string {
+	return strings.TrimSuffix(w.cfg.URL, "/") + " " + w.cfg.Org + "/" + w.cfg.Bucket
+}
+
+// Write writes points to the configured bucket
+func (w *Writer) Write(ctx context.Context, points []Point) error {
+	query := url.Values{"org": {w.cfg.Org}, "bucket": {w.cfg.Bucket}, "precision": {"ns"}}
+	endpoint := strings.TrimSuffix(w.cfg.URL, "/") + "/api/v2/write?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(Lines(points)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	token, err := w.cfg.Token.Get()
+	if err != nil {
+		return fmt.Errorf("write to influxdb: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("write to influxdb: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("write to influxdb: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package influx
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// TestPointLine tests rendering points in the line protocol
+func TestPointLine(t *testing.T) {
+	at := time.Unix(1714528800, 5)
+	tests := []struct {
+		name  string
+		point Point
+		want  string
+	}{
+		{
+			name:  "sorted tags and fields",
+			point: Point{Measurement: "crontab", Tags: map[string]string{"name": "backup", "env": "prod"}, Fields: map[string]float64{"failed": 1, "duration_seconds": 12.5}, Time: at},
+			want:  "crontab,env=prod,name=backup duration_seconds=12.5,failed=1 1714528800000000005\n",
+		},
+		{
+			name:  "escaped",
+			point: Point{Measurement: "cron jobs", Tags: map[string]string{"name": "a,b=c d"}, Fields: map[string]float64{"exit code": 2}, Time: at},
+			want:  `cron\ jobs,name=a\,b\=c\ d exit\ code=2 1714528800000000005` + "\n",
+		},
+		{
+			name:  "empty tag skipped",
+			point: Point{Measurement: "crontab", Tags: map[string]string{"name": "backup", "owner": ""}, Fields: map[string]float64{"failed": 0}, Time: at},
+			want:  "crontab,name=backup failed=0 1714528800000000005\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.point.Line(); got != tt.want {
+				t.Errorf("Line() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAppendFile tests appending the lines of successive runs to the same file
+func TestAppendFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cron.influx")
+	for _, failed := range []float64{1, 0} {
+		point := Point{Measurement: "crontab", Tags: map[string]string{"name": "backup"}, Fields: map[string]float64{"failed": failed}, Time: time.Unix(1, 0)}
+		if err := AppendFile(path, []Point{point}); err != nil {
+			t.Fatalf("AppendFile() error = %v", err)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "crontab,name=backup failed=1 1000000000\ncrontab,name=backup failed=0 1000000000\n"
+	if string(content) != want {
+		t.Errorf("file = %q, want %q", content, want)
+	}
+}
+
+// TestWriterWrite tests the request of the v2 write API
+func TestWriterWrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantError bool
+	}{
+		{name: "written", status: http.StatusNoContent},
+		{name: "unauthorized", status: http.StatusUnauthorized, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery, gotAuthorization, gotBody string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v2/write" {
+					t.Errorf("path = %s, want /api/v2/write", r.URL.Path)
+				}
+				gotQuery = r.URL.RawQuery
+				gotAuthorization = r.Header.Get("Authorization")
+				body, _ := io.ReadAll(r.Body)
+				gotBody = string(body)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			w := NewWriter(Config{URL: server.URL + "/", Org: "ops", Bucket: "cron", Token: secret.Value("secret")})
+			point := Point{Measurement: "crontab", Tags: map[string]string{"name": "backup"}, Fields: map[string]float64{"failed": 1}, Time: time.Unix(1, 0)}
+			err := w.Write(context.Background(), []Point{point})
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Write() error = %v, wantError %v", err, tt.wantError)
+			}
+			if gotQuery != "bucket=cron&org=ops&precision=ns" {
+				t.Errorf("query = %s, want bucket=cron&org=ops&precision=ns", gotQuery)
+			}
+			if gotAuthorization != "Token secret" {
+				t.Errorf("Authorization = %q, want Token secret", gotAuthorization)
+			}
+			if gotBody != point.Line() {
+				t.Errorf("body = %q, want %q", gotBody, point.Line())
+			}
+		})
+	}
+}
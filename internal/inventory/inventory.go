@@ -0,0 +1,150 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/registry"
+	"github.com/alswl/cron-manager/internal/secret"
+	"github.com/alswl/cron-manager/internal/version"
+)
+
+// DefaultInterval is how often the jobs of a host are pushed when no other interval is configured
+const DefaultInterval = 24 * time.Hour
+
+// DefaultTimeout is the timeout of a push when none is configured
+const DefaultTimeout = 10 * time.Second
+
+// KeyEnv is the environment variable with the key signing the pushes
+const KeyEnv = "CRONMGR_INVENTORY_KEY"
+
+// SignatureHeader is the header carrying the signature of a push: sha256= followed by the hex encoded
+// HMAC-SHA256 of the body with the shared key
+const SignatureHeader = "X-Cronmgr-Signature"
+
+// Host describes the host pushing its jobs
+type Host struct {
+	Hostname string `json:"hostname"`
+	// MachineID is the ID of the installation from /etc/machine-id, stable across renames, empty if unknown
+	MachineID string `json:"machine_id,omitempty"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	// Version is the version of cronmgr
+	Version string `json:"cronmgr_version"`
+}
+
+// CurrentHost describes the host cronmgr runs on
+func CurrentHost() Host {
+	hostname, _ := os.Hostname()
+	machineID, _ := os.ReadFile("/etc/machine-id")
+	return Host{
+		Hostname:  hostname,
+		MachineID: strings.TrimSpace(string(machineID)),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Version:   version.Version,
+	}
+}
+
+// Payload is the body of a push, the complete inventory of a host replacing its previous push
+type Payload struct {
+	Host Host `json:"host"`
+	// SentAt lets the endpoint reject replayed pushes, it is covered by the signature
+	SentAt time.Time      `json:"sent_at"`
+	Jobs   []registry.Job `json:"jobs"`
+}
+
+// Config configures a Pusher
+type Config struct {
+	// URL is the endpoint the inventory is posted to
+	URL string
+	// Key signs the pushes, read again for each push so it can be rotated
+	Key *secret.Secret
+	// Interval is the minimum time between two pushes of a host, 0 uses DefaultInterval
+	Interval time.Duration
+	// Timeout bounds each push, 0 uses DefaultTimeout
+	Timeout time.Duration
+	// HTTPClient sends the pushes, e.g. through a proxy, nil uses a client with Timeout
+	HTTPClient *http.Client
+}
+
+// Pusher pushes the jobs of the host to a central inventory
+type Pusher struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewPusher creates a Pusher for cfg
+func NewPusher(cfg Config) *Pusher {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	return &Pusher{cfg: cfg, client: client}
+}
+
+// Interval returns the minimum time between two pushes of the host
+func (p *Pusher) Interval() time.Duration {
+	return p.cfg.Interval
+}
+
+// Push posts payload as JSON, signed with the key
+func (p *Pusher) Push(ctx context.Context, payload Payload) error {
+	if payload.Jobs == nil {
+		payload.Jobs = []registry.Job{}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	key, err := p.cfg.Key.Get()
+	if err != nil {
+		return fmt.Errorf("push inventory: %w", err)
+	}
+	if key == "" {
+		return errors.New("push inventory: the signing key is empty")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(key, body))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push inventory: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push inventory: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
+
+// Sign returns the value of SignatureHeader for body, for endpoints to verify pushes
+func Sign(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,82 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/registry"
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// TestSign tests the signature against a value computed with openssl dgst -sha256 -hmac
+func TestSign(t *testing.T) {
+	want := "sha256=16d8bd1d8ea276f6868d99c0b87ed14db2ebf02b4b5a444f1c21760c9dacc489"
+	if got := Sign("key", []byte(`{"jobs":[]}`)); got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+// TestPusherPush tests that the inventory is posted signed, with the host metadata
+func TestPusherPush(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		key       *secret.Secret
+		wantError bool
+	}{
+		{name: "pushed", status: http.StatusNoContent, key: secret.Value("key")},
+		{name: "rejected", status: http.StatusUnauthorized, key: secret.Value("key"), wantError: true},
+		{name: "no key", status: http.StatusNoContent, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSignature string
+			var gotBody []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotSignature = r.Header.Get(SignatureHeader)
+				gotBody, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			payload := Payload{
+				Host:   Host{Hostname: "web-1", OS: "linux", Arch: "amd64", Version: "1.0.0"},
+				SentAt: time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC),
+				Jobs:   []registry.Job{{Name: "backup", Command: "/usr/bin/backup", Schedule: "0 2 * * *"}},
+			}
+			err := NewPusher(Config{URL: server.URL, Key: tt.key}).Push(context.Background(), payload)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Push() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.key == nil {
+				if gotBody != nil {
+					t.Errorf("unsigned inventory was pushed: %s", gotBody)
+				}
+				return
+			}
+			if want := Sign("key", gotBody); gotSignature != want {
+				t.Errorf("%s = %q, want %q", SignatureHeader, gotSignature, want)
+			}
+			var got Payload
+			if err := json.Unmarshal(gotBody, &got); err != nil {
+				t.Fatalf("invalid body %s: %v", gotBody, err)
+			}
+			if got.Host != payload.Host || !got.SentAt.Equal(payload.SentAt) || len(got.Jobs) != 1 || got.Jobs[0].Schedule != "0 2 * * *" {
+				t.Errorf("body = %+v, want %+v", got, payload)
+			}
+		})
+	}
+}
+
+// TestCurrentHost tests the metadata of the host
+func TestCurrentHost(t *testing.T) {
+	host := CurrentHost()
+	if host.Hostname == "" || host.OS == "" || host.Arch == "" || host.Version == "" {
+		t.Errorf("CurrentHost() = %+v, want the hostname, OS, architecture and version", host)
+	}
+}
@@ -0,0 +1,58 @@
+package job
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ExecErrorType classifies why a command could not be executed at all
+type ExecErrorType string
+
+const (
+	// ExecErrorNotFound means the command executable does not exist
+	ExecErrorNotFound ExecErrorType = "not_found"
+	// ExecErrorPermissionDenied means the command exists but is not executable
+	ExecErrorPermissionDenied ExecErrorType = "permission_denied"
+	// ExecErrorBadInterpreter means the command exists but its #! interpreter does not
+	ExecErrorBadInterpreter ExecErrorType = "bad_interpreter"
+	// ExecErrorFormat means the command is not a valid executable for this system
+	ExecErrorFormat ExecErrorType = "exec_format"
+	// ExecErrorOther is any other failure to start the command
+	ExecErrorOther ExecErrorType = "other"
+)
+
+// execErrorExitCodes maps exec error types to the exit code of cronmgr itself.
+// 126 and 127 follow the shell conventions for "cannot execute" and "not found".
+var execErrorExitCodes = map[ExecErrorType]int{
+	ExecErrorNotFound:         127,
+	ExecErrorPermissionDenied: 126,
+	ExecErrorBadInterpreter:   125,
+	ExecErrorFormat:           123,
+	ExecErrorOther:            122,
+}
+
+// ExitCode returns the exit code cronmgr uses when the command failed to execute
+func (t ExecErrorType) ExitCode() int {
+	if code, ok := execErrorExitCodes[t]; ok {
+		return code
+	}
+	return execErrorExitCodes[ExecErrorOther]
+}
+
+// ClassifyExecError classifies the error returned when starting command
+func ClassifyExecError(command string, err error) ExecErrorType {
+	switch {
+	case errors.Is(err, syscall.ENOENT) || IsNotFound(err):
+		// The kernel reports ENOENT both for a missing file and a missing interpreter
+		if info, statErr := os.Stat(command); statErr == nil && !info.IsDir() {
+			return ExecErrorBadInterpreter
+		}
+		return ExecErrorNotFound
+	case errors.Is(err, syscall.EACCES) || errors.Is(err, os.ErrPermission):
+		return ExecErrorPermissionDenied
+	case errors.Is(err, syscall.ENOEXEC):
+		return ExecErrorFormat
+	}
+	return ExecErrorOther
+}
@@ -0,0 +1,89 @@
+package job
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestClassifyExecError tests the ClassifyExecError function with real exec failures
+func TestClassifyExecError(t *testing.T) {
+	dir := t.TempDir()
+	notExecutable := writeExecutable(t, dir, "not-executable", 0644)
+	badInterpreter := filepath.Join(dir, "bad-interpreter")
+	writeScript(t, badInterpreter, "#!/nonexistent/interpreter\n")
+	badFormat := filepath.Join(dir, "bad-format")
+	writeScript(t, badFormat, "\x7fELF garbage")
+
+	tests := []struct {
+		name     string
+		command  string
+		expected ExecErrorType
+	}{
+		{
+			name:     "command not in PATH",
+			command:  "cronmgr-no-such-tool",
+			expected: ExecErrorNotFound,
+		},
+		{
+			name:     "absolute path does not exist",
+			command:  filepath.Join(dir, "missing"),
+			expected: ExecErrorNotFound,
+		},
+		{
+			name:     "file is not executable",
+			command:  notExecutable,
+			expected: ExecErrorPermissionDenied,
+		},
+		{
+			name:     "interpreter does not exist",
+			command:  badInterpreter,
+			expected: ExecErrorBadInterpreter,
+		},
+		{
+			name:     "invalid executable format",
+			command:  badFormat,
+			expected: ExecErrorFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exec.Command(tt.command).Start()
+			if err == nil {
+				t.Fatalf("expected exec of %v to fail", tt.command)
+			}
+			result := ClassifyExecError(tt.command, err)
+			if result != tt.expected {
+				t.Errorf("ClassifyExecError(%v) = %v, want %v", err, result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("unrelated error", func(t *testing.T) {
+		if result := ClassifyExecError("cmd", errors.New("boom")); result != ExecErrorOther {
+			t.Errorf("ClassifyExecError() = %v, want %v", result, ExecErrorOther)
+		}
+	})
+}
+
+// TestExecErrorExitCode tests that every exec error type has a distinct exit code
+func TestExecErrorExitCode(t *testing.T) {
+	types := []ExecErrorType{ExecErrorNotFound, ExecErrorPermissionDenied, ExecErrorBadInterpreter, ExecErrorFormat, ExecErrorOther}
+	seen := make(map[int]ExecErrorType)
+	for _, typ := range types {
+		code := typ.ExitCode()
+		if code == 0 {
+			t.Errorf("%v.ExitCode() = 0, want non-zero", typ)
+		}
+		if other, exists := seen[code]; exists {
+			t.Errorf("%v and %v share exit code %d", typ, other, code)
+		}
+		seen[code] = typ
+	}
+
+	if ExecErrorType("unknown").ExitCode() != ExecErrorOther.ExitCode() {
+		t.Error("unknown type should use the exit code of ExecErrorOther")
+	}
+}
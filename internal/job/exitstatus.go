@@ -0,0 +1,41 @@
+package job
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// ExitStatus describes how a finished command exited
+type ExitStatus struct {
+	// Code is the exit code of the command, -1 if it was terminated by a signal
+	Code int
+	// Signal is the name of the signal that terminated the command, empty if it exited normally
+	Signal string
+	// CoreDumped is set if the signal made the kernel dump the core of the command
+	CoreDumped bool
+}
+
+// Signaled reports whether the command was terminated by a signal
+func (s ExitStatus) Signaled() bool {
+	return s.Signal != ""
+}
+
+// ExitStatusFromError extracts the exit status from the error returned by exec.Cmd.Wait.
+// A nil error is a successful exit. The boolean result is false if err is not an exit error,
+// e.g. an I/O error while waiting for the command.
+func ExitStatusFromError(err error) (ExitStatus, bool) {
+	if err == nil {
+		return ExitStatus{Code: 0}, true
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ExitStatus{}, false
+	}
+
+	return ExitStatus{
+		Code:       exitErr.ExitCode(),
+		Signal:     terminationSignal(exitErr),
+		CoreDumped: coreDumped(exitErr),
+	}, true
+}
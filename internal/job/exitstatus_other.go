@@ -0,0 +1,17 @@
+//go:build !unix
+
+package job
+
+import (
+	"os/exec"
+)
+
+// terminationSignal returns an empty string, processes are not terminated by signals on this platform
+func terminationSignal(exitErr *exec.ExitError) string {
+	return ""
+}
+
+// coreDumped returns false, there are no core dumps on this platform
+func coreDumped(exitErr *exec.ExitError) bool {
+	return false
+}
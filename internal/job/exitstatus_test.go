@@ -0,0 +1,22 @@
+package job
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestExitStatusFromError tests the ExitStatusFromError function with non-exit errors
+func TestExitStatusFromError(t *testing.T) {
+	t.Run("nil error is success", func(t *testing.T) {
+		status, ok := ExitStatusFromError(nil)
+		if !ok || status.Code != 0 || status.Signaled() {
+			t.Errorf("ExitStatusFromError(nil) = %+v, %v, want code 0", status, ok)
+		}
+	})
+
+	t.Run("other error is not an exit status", func(t *testing.T) {
+		if _, ok := ExitStatusFromError(errors.New("i/o error")); ok {
+			t.Error("ExitStatusFromError() ok = true for non-exit error")
+		}
+	})
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package job
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// terminationSignal returns the name of the signal that terminated the process
+func terminationSignal(exitErr *exec.ExitError) string {
+	waitStatus, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !waitStatus.Signaled() {
+		return ""
+	}
+	return waitStatus.Signal().String()
+}
+
+// coreDumped reports whether the kernel dumped the core of the process terminated by a signal
+func coreDumped(exitErr *exec.ExitError) bool {
+	waitStatus, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && waitStatus.CoreDump()
+}
@@ -0,0 +1,69 @@
+//go:build unix
+
+package job
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+// TestExitStatusFromErrorUnix tests exit codes and signals of real processes
+func TestExitStatusFromErrorUnix(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantCode   int
+		wantSignal string
+	}{
+		{
+			name:     "exit code",
+			script:   "exit 3",
+			wantCode: 3,
+		},
+		{
+			name:     "high exit code",
+			script:   "exit 255",
+			wantCode: 255,
+		},
+		{
+			name:       "terminated by signal",
+			script:     "kill -TERM $$",
+			wantCode:   -1,
+			wantSignal: "terminated",
+		},
+		{
+			name:       "killed",
+			script:     "kill -KILL $$",
+			wantCode:   -1,
+			wantSignal: "killed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := exec.Command("sh", "-c", tt.script).Run()
+			status, ok := ExitStatusFromError(err)
+			if !ok {
+				t.Fatalf("ExitStatusFromError(%v) ok = false", err)
+			}
+			if status.Code != tt.wantCode {
+				t.Errorf("Code = %d, want %d", status.Code, tt.wantCode)
+			}
+			if status.Signal != tt.wantSignal {
+				t.Errorf("Signal = %q, want %q", status.Signal, tt.wantSignal)
+			}
+			if status.Signaled() != (tt.wantSignal != "") {
+				t.Errorf("Signaled() = %v, want %v", status.Signaled(), tt.wantSignal != "")
+			}
+		})
+	}
+
+	t.Run("wrapped exit error", func(t *testing.T) {
+		err := exec.Command("sh", "-c", "exit 7").Run()
+		status, ok := ExitStatusFromError(fmt.Errorf("run: %w", err))
+		if !ok || status.Code != 7 {
+			t.Errorf("ExitStatusFromError() = %+v, %v, want code 7", status, ok)
+		}
+	})
+}
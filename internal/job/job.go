@@ -3,21 +3,23 @@ package job
 import (
 	"fmt"
 	"time"
+
+	"github.com/alswl/cron-manager/internal/clock"
 )
 
 // IdleWait waits for the remaining idleSeconds so Prometheus can notice that something is happening.
 // If the job has already run longer than idleSeconds, it will not wait.
-func IdleWait(jobStart time.Time, idleSeconds int) {
+func IdleWait(clk clock.Clock, jobStart time.Time, idleSeconds int) {
 	if idleSeconds <= 0 {
 		return
 	}
 
 	// Calculate remaining time to reach idleSeconds
-	elapsed := time.Since(jobStart)
+	elapsed := clk.Since(jobStart)
 	remaining := time.Duration(idleSeconds)*time.Second - elapsed
 
 	if remaining > 0 {
 		fmt.Printf("Idle flag active, waiting for additional %v\n", remaining)
-		time.Sleep(remaining)
+		clk.Sleep(remaining)
 	}
 }
@@ -3,47 +3,48 @@ package job
 import (
 	"testing"
 	"time"
+
+	"github.com/alswl/cron-manager/internal/testutil"
 )
 
 // TestIdleWait tests the IdleWait function
 func TestIdleWait(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+
 	t.Run("idle seconds is 0, should not wait", func(t *testing.T) {
-		start := time.Now()
-		IdleWait(start, 0)
-		elapsed := time.Since(start)
-		if elapsed > 100*time.Millisecond {
+		clk := testutil.NewFakeClock(start)
+		IdleWait(clk, start, 0)
+		if elapsed := clk.Since(start); elapsed != 0 {
 			t.Errorf("IdleWait with 0 seconds should not wait, but waited %v", elapsed)
 		}
 	})
 
 	t.Run("idle seconds is negative, should not wait", func(t *testing.T) {
-		start := time.Now()
-		IdleWait(start, -10)
-		elapsed := time.Since(start)
-		if elapsed > 100*time.Millisecond {
+		clk := testutil.NewFakeClock(start)
+		IdleWait(clk, start, -10)
+		if elapsed := clk.Since(start); elapsed != 0 {
 			t.Errorf("IdleWait with negative seconds should not wait, but waited %v", elapsed)
 		}
 	})
 
 	t.Run("idle seconds is positive, should wait remaining time", func(t *testing.T) {
-		start := time.Now()
-		// Wait a bit first
-		time.Sleep(50 * time.Millisecond)
-		IdleWait(start, 1) // 1 second total
-		elapsed := time.Since(start)
-		// Should have waited approximately 950ms (1 second - 50ms already elapsed)
-		if elapsed < 900*time.Millisecond || elapsed > 1100*time.Millisecond {
-			t.Errorf("IdleWait should wait approximately 950ms, but elapsed %v", elapsed)
+		clk := testutil.NewFakeClock(start)
+		// The job ran for a bit first
+		clk.Advance(50 * time.Millisecond)
+		IdleWait(clk, start, 1) // 1 second total
+		// Should have waited 950ms (1 second - 50ms already elapsed)
+		if elapsed := clk.Since(start); elapsed != time.Second {
+			t.Errorf("IdleWait should wait until 1s elapsed, but elapsed %v", elapsed)
 		}
 	})
 
 	t.Run("job already ran longer than idle seconds, should not wait", func(t *testing.T) {
-		start := time.Now().Add(-2 * time.Second) // Job started 2 seconds ago
-		beforeWait := time.Now()
-		IdleWait(start, 1) // Only need 1 second, but job already ran 2 seconds
-		waitDuration := time.Since(beforeWait)
+		clk := testutil.NewFakeClock(start)
+		clk.Advance(2 * time.Second) // Job started 2 seconds ago
+		beforeWait := clk.Now()
+		IdleWait(clk, start, 1) // Only need 1 second, but job already ran 2 seconds
 		// Should not wait since job already ran for 2 seconds (longer than 1 second required)
-		if waitDuration > 100*time.Millisecond {
+		if waitDuration := clk.Since(beforeWait); waitDuration != 0 {
 			t.Errorf("IdleWait should not wait if job already ran longer, but waited %v", waitDuration)
 		}
 	})
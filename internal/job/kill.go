@@ -0,0 +1,32 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Kill kills a started command together with the processes it spawned, if it was
+// started with SetProcessGroup. A command that already exited is not an error.
+func Kill(cmd *exec.Cmd) error {
+	return Signal(cmd, os.Kill)
+}
+
+// Signal sends sig to a started command together with the processes it spawned, if it was
+// started with SetProcessGroup. A command that already exited is not an error.
+func Signal(cmd *exec.Cmd, sig os.Signal) error {
+	if err := signalProcessGroup(cmd, sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+// ParseSignal returns the signal of a name such as SIGINT, INT or int
+func ParseSignal(name string) (os.Signal, error) {
+	if sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+	return nil, fmt.Errorf("unknown signal %q", name)
+}
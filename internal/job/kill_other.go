@@ -0,0 +1,22 @@
+//go:build !unix
+
+package job
+
+import (
+	"os"
+	"os/exec"
+)
+
+// signals are the signals supported on this platform by name
+var signals = map[string]os.Signal{
+	"INT":  os.Interrupt,
+	"KILL": os.Kill,
+}
+
+// SetProcessGroup does nothing, process groups are not supported on this platform
+func SetProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup signals the command, its children are left running on this platform
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
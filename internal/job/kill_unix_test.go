@@ -0,0 +1,92 @@
+//go:build unix
+
+package job
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestKill tests that killing a command also kills the processes it spawned
+func TestKill(t *testing.T) {
+	// The background sleep keeps stdout open as long as it runs
+	cmd := exec.Command("sh", "-c", "sleep 30 & wait")
+	SetProcessGroup(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe() error = %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := Kill(cmd); err != nil {
+		t.Fatalf("Kill() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.ReadAll(stdout)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("output still open, the child of the command was not killed")
+	}
+
+	status, ok := ExitStatusFromError(cmd.Wait())
+	if !ok || status.Signal != "killed" {
+		t.Errorf("ExitStatusFromError() = %+v, %v, want killed", status, ok)
+	}
+
+	// Killing a command that already exited is not an error
+	if err := Kill(cmd); err != nil {
+		t.Errorf("Kill() after exit error = %v", err)
+	}
+}
+
+// TestSignal tests that a command can handle the signal it is sent
+func TestSignal(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "trap 'exit 3' INT; sleep 30")
+	SetProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	// Let the shell set its trap
+	time.Sleep(200 * time.Millisecond)
+	if err := Signal(cmd, syscall.SIGINT); err != nil {
+		t.Fatalf("Signal() error = %v", err)
+	}
+	status, ok := ExitStatusFromError(cmd.Wait())
+	if !ok || status.Code != 3 {
+		t.Errorf("ExitStatusFromError() = %+v, %v, want exit code 3", status, ok)
+	}
+}
+
+// TestParseSignal tests parsing signal names
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    os.Signal
+		wantErr bool
+	}{
+		{name: "SIGINT", want: syscall.SIGINT},
+		{name: "TERM", want: syscall.SIGTERM},
+		{name: "usr1", want: syscall.SIGUSR1},
+		{name: "sigquit", want: syscall.SIGQUIT},
+		{name: "SIGFOO", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSignal(tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseSignal() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
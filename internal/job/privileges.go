@@ -0,0 +1,46 @@
+package job
+
+import "errors"
+
+// DropPrivilegesCommand is the cronmgr subcommand dropping privileges before executing a command
+const DropPrivilegesCommand = "drop-privileges"
+
+// ErrPrivilegesUnsupported is returned by Privileges.Exec on platforms without Linux capabilities
+var ErrPrivilegesUnsupported = errors.New("dropping privileges is only supported on Linux")
+
+// ErrDropPrivileges is wrapped by the errors of Privileges.Exec failing to drop the privileges,
+// as opposed to failing to execute the command
+var ErrDropPrivileges = errors.New("drop privileges")
+
+// Privileges are the privileges dropped by a command before it executes the job, so a job
+// started as root can do less harm. Go cannot run code between fork and exec, so the
+// cronmgr executable is started again to drop them and then replace itself with the job.
+type Privileges struct {
+	// Executable is the path of the cronmgr executable
+	Executable string
+	// DropCaps drops all Linux capabilities, including from the bounding and ambient sets,
+	// so the job cannot gain them back even when running as root
+	DropCaps bool
+	// NoNewPrivs sets no_new_privs, so setuid executables and file capabilities grant nothing to the job
+	NoNewPrivs bool
+	// SeccompProfile is the path of a seccomp profile in the JSON format of Docker filtering the syscalls
+	// of the job, empty for none. It implies NoNewPrivs.
+	SeccompProfile string
+}
+
+// Command wraps a command in `cronmgr drop-privileges`, which keeps the PID, exit code and signals
+// of the original process as it replaces itself with the command
+func (p Privileges) Command(command string, args []string) (string, []string) {
+	wrapped := []string{DropPrivilegesCommand}
+	if p.DropCaps {
+		wrapped = append(wrapped, "--drop-caps")
+	}
+	if p.NoNewPrivs {
+		wrapped = append(wrapped, "--no-new-privs")
+	}
+	if p.SeccompProfile != "" {
+		wrapped = append(wrapped, "--seccomp-profile", p.SeccompProfile)
+	}
+	wrapped = append(wrapped, "--", command)
+	return p.Executable, append(wrapped, args...)
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package job
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/alswl/cron-manager/internal/seccomp"
+)
+
+const (
+	prCapbsetDrop           = 24
+	prSetNoNewPrivs         = 38
+	prCapAmbient            = 47
+	prCapAmbientClearAll    = 4
+	linuxCapabilityVersion3 = 0x20080522
+)
+
+// capHeader and capData are the arguments of capset(2)
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// Exec drops the privileges p of the current process and replaces it with command.
+// It only returns if dropping the privileges or executing the command failed.
+func (p Privileges) Exec(command string, args []string) error {
+	// Capabilities and no_new_privs belong to the thread, which must be the one calling execve
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := p.drop(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDropPrivileges, err)
+	}
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, append([]string{command}, args...), os.Environ())
+}
+
+// drop drops the privileges of the calling thread
+func (p Privileges) drop() error {
+	var filter []seccomp.Instruction
+	if p.SeccompProfile != "" {
+		var err error
+		if filter, err = p.seccompFilter(); err != nil {
+			return err
+		}
+	}
+	if p.DropCaps {
+		// Dropping from the bounding set needs CAP_SETPCAP, so it goes first. The kernel
+		// rejects the first capability it does not know with EINVAL.
+		for c := uintptr(0); ; c++ {
+			_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapbsetDrop, c, 0, 0, 0, 0)
+			if errno == syscall.EINVAL && c > 0 {
+				break
+			}
+			if errno != 0 {
+				return fmt.Errorf("drop capability %d from the bounding set: %w", c, errno)
+			}
+		}
+		// Ambient capabilities do not exist before Linux 4.3
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0, 0, 0, 0); errno != 0 && errno != syscall.EINVAL {
+			return fmt.Errorf("clear ambient capabilities: %w", errno)
+		}
+		header := capHeader{version: linuxCapabilityVersion3}
+		var data [2]capData
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+			return fmt.Errorf("clear capabilities: %w", errno)
+		}
+	}
+	// Installing a seccomp filter requires no_new_privs without CAP_SYS_ADMIN
+	if p.NoNewPrivs || filter != nil {
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+			return fmt.Errorf("set no_new_privs: %w", errno)
+		}
+	}
+	// The filter goes last, as it may deny the syscalls dropping the other privileges
+	if filter != nil {
+		if err := seccomp.Install(filter); err != nil {
+			return fmt.Errorf("install seccomp filter: %w", err)
+		}
+	}
+	return nil
+}
+
+// seccompFilter compiles the seccomp profile for this system
+func (p Privileges) seccompFilter() ([]seccomp.Instruction, error) {
+	profile, err := seccomp.Load(p.SeccompProfile)
+	if err != nil {
+		return nil, err
+	}
+	// An unknown kernel release passes the minKernel of all rules
+	release, _ := os.ReadFile("/proc/sys/kernel/osrelease")
+	return profile.Compile(seccomp.Host{
+		Arch:       runtime.GOARCH,
+		Privileged: !p.DropCaps && os.Geteuid() == 0,
+		Kernel:     strings.TrimSpace(string(release)),
+	})
+}
@@ -0,0 +1,94 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// threadStatus returns the fields of /proc/thread-self/status
+func threadStatus() (map[string]string, error) {
+	content, err := os.ReadFile("/proc/thread-self/status")
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			status[key] = strings.TrimSpace(value)
+		}
+	}
+	return status, nil
+}
+
+// TestPrivilegesDrop tests dropping the capabilities and setting no_new_privs of a thread
+func TestPrivilegesDrop(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("dropping the bounding set needs root")
+	}
+	var got map[string]string
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The thread is never unlocked, so it exits with the goroutine instead of serving other goroutines
+		runtime.LockOSThread()
+		if err = (Privileges{DropCaps: true, NoNewPrivs: true}).drop(); err == nil {
+			got, err = threadStatus()
+		}
+	}()
+	<-done
+	if err != nil {
+		t.Fatalf("drop() error = %v", err)
+	}
+	for _, key := range []string{"CapInh", "CapPrm", "CapEff", "CapBnd", "CapAmb"} {
+		if value, ok := got[key]; ok && strings.Trim(value, "0") != "" {
+			t.Errorf("%s = %s, want no capability", key, value)
+		}
+	}
+	if got["NoNewPrivs"] != "1" {
+		t.Errorf("NoNewPrivs = %q, want 1", got["NoNewPrivs"])
+	}
+}
+
+// TestPrivilegesDropSeccomp tests filtering the syscalls of a thread with a seccomp profile
+func TestPrivilegesDropSeccomp(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" && runtime.GOARCH != "arm" {
+		t.Skip("no seccomp syscall table for " + runtime.GOARCH)
+	}
+	profile := filepath.Join(t.TempDir(), "profile.json")
+	content := `{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["uname"], "action": "SCMP_ACT_ERRNO", "errnoRet": 38}]}`
+	if err := os.WriteFile(profile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]string
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+		if err = (Privileges{SeccompProfile: profile}).drop(); err != nil {
+			return
+		}
+		var uts syscall.Utsname
+		if err = syscall.Uname(&uts); err == nil {
+			err = errors.New("uname was not filtered")
+		} else if errors.Is(err, syscall.ENOSYS) {
+			got, err = threadStatus()
+		}
+	}()
+	<-done
+	if err != nil {
+		t.Fatalf("drop() error = %v", err)
+	}
+	if got["NoNewPrivs"] != "1" || got["Seccomp"] != "2" {
+		t.Errorf("NoNewPrivs = %q, Seccomp = %q, want 1 and 2", got["NoNewPrivs"], got["Seccomp"])
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package job
+
+// Exec returns ErrPrivilegesUnsupported, capabilities and no_new_privs only exist on Linux
+func (p Privileges) Exec(command string, args []string) error {
+	return ErrPrivilegesUnsupported
+}
@@ -0,0 +1,31 @@
+package job
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestPrivilegesCommand tests the cronmgr drop-privileges command line wrapping a command
+func TestPrivilegesCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		privileges Privileges
+		want       []string
+	}{
+		{name: "none", want: []string{"drop-privileges", "--", "/usr/bin/backup", "--full", ""}},
+		{name: "all", privileges: Privileges{DropCaps: true, NoNewPrivs: true, SeccompProfile: "/etc/cronmgr/parser.json"},
+			want: []string{"drop-privileges", "--drop-caps", "--no-new-privs", "--seccomp-profile", "/etc/cronmgr/parser.json", "--", "/usr/bin/backup", "--full", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.privileges.Executable = "/usr/local/bin/cronmgr"
+			command, args := tt.privileges.Command("/usr/bin/backup", []string{"--full", ""})
+			if command != "/usr/local/bin/cronmgr" {
+				t.Errorf("Command() command = %q, want /usr/local/bin/cronmgr", command)
+			}
+			if !slices.Equal(args, tt.want) {
+				t.Errorf("Command() args = %q, want %q", args, tt.want)
+			}
+		})
+	}
+}
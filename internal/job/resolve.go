@@ -0,0 +1,99 @@
+package job
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// systemSearchDirs are common binary locations that are often missing from the
+// minimal PATH cron provides (usually just /usr/bin:/bin)
+var systemSearchDirs = []string{
+	"/usr/local/bin",
+	"/usr/local/sbin",
+	"/usr/sbin",
+	"/sbin",
+	"/opt/homebrew/bin",
+	"/snap/bin",
+}
+
+// homeSearchDirs are per-user binary locations relative to the home directory,
+// including shims of common language version managers. Glob patterns are allowed.
+var homeSearchDirs = []string{
+	"bin",
+	".local/bin",
+	"go/bin",
+	".cargo/bin",
+	".rbenv/shims",
+	".pyenv/shims",
+	".asdf/shims",
+	".volta/bin",
+	".nvm/versions/node/*/bin",
+	".sdkman/candidates/*/current/bin",
+}
+
+// SearchDirs returns the directories searched when a command cannot be found in PATH.
+// home is the user's home directory; per-user directories are skipped if it is empty.
+func SearchDirs(home string) []string {
+	dirs := append([]string{}, systemSearchDirs...)
+	if home == "" {
+		return dirs
+	}
+	for _, dir := range homeSearchDirs {
+		pattern := filepath.Join(home, dir)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, matches...)
+	}
+	return dirs
+}
+
+// FindCandidates searches dirs for executables with the base name of command.
+// It returns all matches in the order of dirs.
+func FindCandidates(command string, dirs []string) []string {
+	name := filepath.Base(command)
+	var candidates []string
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+		candidates = append(candidates, path)
+	}
+	return candidates
+}
+
+// CommandCandidates returns executables named like command found in SearchDirs
+// of the current user
+func CommandCandidates(command string) []string {
+	home, _ := os.UserHomeDir()
+	return FindCandidates(command, SearchDirs(home))
+}
+
+// ResolveCommand returns command unchanged if it contains a path separator or can be
+// found in PATH. Otherwise it returns the first candidate from CommandCandidates.
+// The boolean result reports whether the command was resolved outside of PATH.
+func ResolveCommand(command string) (string, bool) {
+	if strings.ContainsRune(command, filepath.Separator) {
+		return command, false
+	}
+	if _, err := exec.LookPath(command); err == nil {
+		return command, false
+	}
+	candidates := CommandCandidates(command)
+	if len(candidates) == 0 {
+		return command, false
+	}
+	return candidates[0], true
+}
+
+// IsNotFound reports whether err means the command executable does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,148 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeExecutable creates a file in dir with the given mode
+func writeExecutable(t *testing.T, dir, name string, mode os.FileMode) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	return path
+}
+
+// writeScript creates an executable file with the given content
+func writeScript(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+// TestSearchDirs tests the SearchDirs function
+func TestSearchDirs(t *testing.T) {
+	t.Run("without home only system dirs", func(t *testing.T) {
+		dirs := SearchDirs("")
+		if len(dirs) != len(systemSearchDirs) {
+			t.Errorf("SearchDirs(\"\") returned %d dirs, want %d", len(dirs), len(systemSearchDirs))
+		}
+	})
+
+	t.Run("expands version manager globs", func(t *testing.T) {
+		home := t.TempDir()
+		nodeBin := filepath.Join(home, ".nvm/versions/node/v20.1.0/bin")
+		if err := os.MkdirAll(nodeBin, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+
+		dirs := SearchDirs(home)
+		found := false
+		for _, dir := range dirs {
+			if dir == nodeBin {
+				found = true
+			}
+			if strings.Contains(dir, "*") {
+				t.Errorf("SearchDirs() returned unexpanded pattern %v", dir)
+			}
+		}
+		if !found {
+			t.Errorf("SearchDirs() = %v, want to contain %v", dirs, nodeBin)
+		}
+	})
+}
+
+// TestFindCandidates tests the FindCandidates function
+func TestFindCandidates(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "a")
+	dirB := filepath.Join(root, "b")
+	dirC := filepath.Join(root, "c")
+
+	pathA := writeExecutable(t, dirA, "tool", 0755)
+	writeExecutable(t, dirB, "tool", 0644) // not executable
+	pathC := writeExecutable(t, dirC, "tool", 0755)
+	if err := os.MkdirAll(filepath.Join(root, "d", "tool"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	dirs := []string{dirA, dirB, filepath.Join(root, "missing"), dirC, filepath.Join(root, "d")}
+
+	t.Run("finds executables in order", func(t *testing.T) {
+		got := FindCandidates("tool", dirs)
+		want := []string{pathA, pathC}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("FindCandidates() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("uses base name of absolute command", func(t *testing.T) {
+		got := FindCandidates("/usr/bin/tool", dirs)
+		if len(got) != 2 {
+			t.Errorf("FindCandidates() = %v, want 2 candidates", got)
+		}
+	})
+
+	t.Run("no candidates", func(t *testing.T) {
+		if got := FindCandidates("nothing", dirs); len(got) != 0 {
+			t.Errorf("FindCandidates() = %v, want none", got)
+		}
+	})
+}
+
+// TestResolveCommand tests the ResolveCommand function
+func TestResolveCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	localBin := filepath.Join(home, ".local/bin")
+	toolPath := writeExecutable(t, localBin, "cronmgr-test-tool", 0755)
+
+	t.Run("command with path is unchanged", func(t *testing.T) {
+		got, resolved := ResolveCommand("./cronmgr-test-tool")
+		if got != "./cronmgr-test-tool" || resolved {
+			t.Errorf("ResolveCommand() = %v, %v, want unchanged", got, resolved)
+		}
+	})
+
+	t.Run("command outside PATH is resolved", func(t *testing.T) {
+		got, resolved := ResolveCommand("cronmgr-test-tool")
+		if got != toolPath || !resolved {
+			t.Errorf("ResolveCommand() = %v, %v, want %v, true", got, resolved, toolPath)
+		}
+	})
+
+	t.Run("unknown command is unchanged", func(t *testing.T) {
+		got, resolved := ResolveCommand("cronmgr-no-such-tool")
+		if got != "cronmgr-no-such-tool" || resolved {
+			t.Errorf("ResolveCommand() = %v, %v, want unchanged", got, resolved)
+		}
+	})
+}
+
+// TestIsNotFound tests the IsNotFound function
+func TestIsNotFound(t *testing.T) {
+	lookErr := exec.Command("cronmgr-no-such-tool").Start()
+	if !IsNotFound(lookErr) {
+		t.Errorf("IsNotFound(%v) = false, want true", lookErr)
+	}
+
+	pathErr := exec.Command(filepath.Join(t.TempDir(), "missing")).Start()
+	if !IsNotFound(pathErr) {
+		t.Errorf("IsNotFound(%v) = false, want true", pathErr)
+	}
+
+	if IsNotFound(errors.New("other")) {
+		t.Error("IsNotFound() = true for unrelated error")
+	}
+}
@@ -0,0 +1,52 @@
+package job
+
+import (
+	"strings"
+)
+
+// DefaultLoginShell is the shell used by LoginShellCommand when no shell is given
+const DefaultLoginShell = "bash"
+
+// LoginShellCommand wraps a command so it runs inside a login shell.
+// The command is executed via `<shell> -lc 'exec <command> <args...>'`, so the shell
+// sources the user's profile (PATH, rbenv/nvm, etc.) and then replaces itself with
+// the command, keeping the exit code and signals of the original process.
+// If shell is empty, DefaultLoginShell is used.
+func LoginShellCommand(shell string, command string, args []string) (string, []string) {
+	if shell == "" {
+		shell = DefaultLoginShell
+	}
+
+	return shell, []string{"-lc", "exec " + CommandLine(command, args)}
+}
+
+// CommandLine returns command and its args quoted as a POSIX shell command line
+func CommandLine(command string, args []string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, ShellQuote(command))
+	for _, arg := range args {
+		quoted = append(quoted, ShellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ShellQuote quotes s for safe use as a single word in a POSIX shell command line
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, needsQuote) == -1 {
+		return s
+	}
+	// Close the quote, emit an escaped single quote, then reopen the quote
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// needsQuote reports whether r has a special meaning for the shell
+func needsQuote(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("-_./:=,+@%", r)
+}
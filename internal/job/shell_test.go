@@ -0,0 +1,93 @@
+package job
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// TestShellQuote tests the ShellQuote function
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "plain word",
+			input:    "script.py",
+			expected: "script.py",
+		},
+		{
+			name:     "path with safe characters",
+			input:    "/usr/local/bin/task:run",
+			expected: "/usr/local/bin/task:run",
+		},
+		{
+			name:     "empty string",
+			input:    "",
+			expected: "''",
+		},
+		{
+			name:     "with spaces",
+			input:    "hello world",
+			expected: "'hello world'",
+		},
+		{
+			name:     "with single quote",
+			input:    "it's",
+			expected: `'it'\''s'`,
+		},
+		{
+			name:     "with shell metacharacters",
+			input:    "$(rm -rf /); echo `id` > out",
+			expected: "'$(rm -rf /); echo `id` > out'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ShellQuote(tt.input)
+			if result != tt.expected {
+				t.Errorf("ShellQuote(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestLoginShellCommand tests the LoginShellCommand function
+func TestLoginShellCommand(t *testing.T) {
+	t.Run("default shell", func(t *testing.T) {
+		shell, args := LoginShellCommand("", "/usr/bin/php", []string{"console", "task:run"})
+		if shell != DefaultLoginShell {
+			t.Errorf("shell = %v, want %v", shell, DefaultLoginShell)
+		}
+		if len(args) != 2 || args[0] != "-lc" {
+			t.Fatalf("args = %v, want [-lc <script>]", args)
+		}
+		if args[1] != "exec /usr/bin/php console task:run" {
+			t.Errorf("script = %q, want %q", args[1], "exec /usr/bin/php console task:run")
+		}
+	})
+
+	t.Run("custom shell", func(t *testing.T) {
+		shell, _ := LoginShellCommand("/bin/zsh", "ls", nil)
+		if shell != "/bin/zsh" {
+			t.Errorf("shell = %v, want /bin/zsh", shell)
+		}
+	})
+
+	t.Run("arguments are preserved through the shell", func(t *testing.T) {
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("sh not available")
+		}
+		want := "a 'quoted' $HOME arg"
+		shell, args := LoginShellCommand("sh", "printf", []string{"%s", want})
+		out, err := exec.Command(shell, args...).Output()
+		if err != nil {
+			t.Fatalf("command failed: %v", err)
+		}
+		if string(out) != want {
+			t.Errorf("output = %q, want %q", string(out), want)
+		}
+	})
+}
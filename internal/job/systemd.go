@@ -0,0 +1,36 @@
+package job
+
+// SystemdRun is the command starting transient systemd units
+const SystemdRun = "systemd-run"
+
+// SystemdScope is a transient systemd scope a command runs in, for systemd resource accounting and limits
+type SystemdScope struct {
+	// Slice is the slice the scope is placed in, e.g. batch.slice, empty for the default
+	Slice string
+	// Properties are unit properties of the scope, e.g. MemoryMax=1G or CPUQuota=50%
+	Properties []string
+	// Description is shown by systemctl status
+	Description string
+	// User runs the scope in the service manager of the user instead of the system one
+	User bool
+}
+
+// Command wraps a command in `systemd-run --scope`. systemd-run registers the scope and then
+// replaces itself with the command, keeping the PID, exit code and signals of the original process.
+func (s SystemdScope) Command(command string, args []string) (string, []string) {
+	wrapped := []string{"--scope", "--quiet"}
+	if s.User {
+		wrapped = append(wrapped, "--user")
+	}
+	if s.Slice != "" {
+		wrapped = append(wrapped, "--slice="+s.Slice)
+	}
+	for _, property := range s.Properties {
+		wrapped = append(wrapped, "--property="+property)
+	}
+	if s.Description != "" {
+		wrapped = append(wrapped, "--description="+s.Description)
+	}
+	wrapped = append(wrapped, "--", command)
+	return SystemdRun, append(wrapped, args...)
+}
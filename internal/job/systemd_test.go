@@ -0,0 +1,44 @@
+package job
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestSystemdScopeCommand tests the systemd-run command line wrapping a command
+func TestSystemdScopeCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope SystemdScope
+		want  []string
+	}{
+		{
+			name:  "defaults",
+			scope: SystemdScope{},
+			want:  []string{"--scope", "--quiet", "--", "/usr/bin/backup", "--full", ""},
+		},
+		{
+			name: "slice and properties",
+			scope: SystemdScope{
+				Slice:       "batch.slice",
+				Properties:  []string{"MemoryMax=1G", "CPUQuota=50%"},
+				Description: "cronmgr job backup",
+			},
+			want: []string{"--scope", "--quiet", "--slice=batch.slice", "--property=MemoryMax=1G", "--property=CPUQuota=50%",
+				"--description=cronmgr job backup", "--", "/usr/bin/backup", "--full", ""},
+		},
+		{
+			name:  "user manager",
+			scope: SystemdScope{User: true},
+			want:  []string{"--scope", "--quiet", "--user", "--", "/usr/bin/backup", "--full", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, args := tt.scope.Command("/usr/bin/backup", []string{"--full", ""})
+			if bin != SystemdRun || !slices.Equal(args, tt.want) {
+				t.Errorf("Command() = %s %q, want %s %q", bin, args, SystemdRun, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package lease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/spf13/afero"
+)
+
+// TokenEnv is the environment variable with the fencing token of the lease, passed to the command so it can
+// tag its writes and let the systems it writes to reject those of an older holder
+const TokenEnv = "CRONMGR_FENCING_TOKEN"
+
+// record is the content of the lease file
+type record struct {
+	// Holder identifies the process holding the lease, empty once it was released
+	Holder string `json:"holder"`
+	// Token is incremented by each acquisition, it never decreases
+	Token uint64 `json:"token"`
+	// Expires is when the lease may be taken over unless the holder renews it
+	Expires time.Time `json:"expires"`
+}
+
+// HeldError is returned by Acquire while another holder renews the lease
+type HeldError struct {
+	Holder  string
+	Expires time.Time
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("lease held by %s until %s", e.Holder, e.Expires.Format(time.RFC3339))
+}
+
+// Lease is a lease kept in a file on storage shared by the hosts running a job, e.g. NFS, so that only one
+// of them runs it at a time. The holder renews it every third of its TTL; a holder that stops renewing,
+// e.g. because it crashed or lost the storage, is taken over once the lease expired.
+type Lease struct {
+	fs        afero.Fs
+	path      string
+	holder    string
+	ttl       time.Duration
+	now       func() time.Time
+	useOsLock bool
+}
+
+// New creates the Lease of the file path, held by holder for ttl after each renewal
+func New(fs afero.Fs, path, holder string, ttl time.Duration) *Lease {
+	_, isOsFs := fs.(*afero.OsFs)
+	return &Lease{fs: fs, path: path, holder: holder, ttl: ttl, now: time.Now, useOsLock: isOsFs}
+}
+
+// TTL returns how long the lease is held after each renewal
+func (l *Lease) TTL() time.Duration {
+	return l.ttl
+}
+
+// Path returns the file of the lease
+func (l *Lease) Path() string {
+	return l.path
+}
+
+// Acquire takes the lease if it is free, released or expired, with the next fencing token, and starts
+// renewing it. It returns a *HeldError if another holder keeps it.
+func (l *Lease) Acquire() (*Holding, error) {
+	var token uint64
+	start := l.now()
+	err := l.update(func(r *record) error {
+		if r.Holder != "" && start.Before(r.Expires) {
+			return &HeldError{Holder: r.Holder, Expires: r.Expires}
+		}
+		r.Holder, r.Token, r.Expires = l.holder, r.Token+1, start.Add(l.ttl)
+		token = r.Token
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	h := &Holding{lease: l, token: token, lost: make(chan struct{}), stop: make(chan struct{}), done: make(chan struct{})}
+	go h.keep()
+	return h, nil
+}
+
+// update applies fn to the record of the lease under the lock of its file, and writes it unless fn fails
+func (l *Lease) update(fn func(r *record) error) error {
+	if err := l.fs.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	locker := fslock.NewLocker(l.path, l.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return fmt.Errorf("couldn't lock %s: %w", l.path, err)
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	var r record
+	content, err := afero.ReadFile(l.fs, l.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(content, &r); err != nil {
+			return fmt.Errorf("invalid lease %s: %w", l.path, err)
+		}
+	}
+	if err := fn(&r); err != nil {
+		return err
+	}
+	content, err = json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	tmpPath := l.path + ".tmp"
+	if err := afero.WriteFile(l.fs, tmpPath, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return l.fs.Rename(tmpPath, l.path)
+}
+
+// errTakenOver is the renewal failure of a lease acquired by another holder
+var errTakenOver = errors.New("lease taken over")
+
+// Holding is a lease taken by Acquire
+type Holding struct {
+	lease *Lease
+	token uint64
+	lost  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+	mu    sync.Mutex
+	err   error
+}
+
+// Token returns the fencing token of the holding, greater than those of all the previous holders
+func (h *Holding) Token() uint64 {
+	return h.token
+}
+
+// keep renews the lease every third of its TTL. Unless a renewal succeeds within two thirds of the TTL
+// after the previous one, the lease is lost: the last third is left to stop the command before the lease
+// expires and another host may take it over. A renewal hanging on unavailable storage counts as failed.
+func (h *Holding) keep() {
+	defer close(h.done)
+	ttl := h.lease.ttl
+	renewed := make(chan time.Time)
+	takenOver := make(chan error, 1)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case <-time.After(ttl / 3):
+			}
+			started := time.Now()
+			err := h.lease.update(func(r *record) error {
+				if r.Token != h.token || r.Holder != h.lease.holder {
+					return fmt.Errorf("%w by %s with token %d", errTakenOver, r.Holder, r.Token)
+				}
+				r.Expires = h.lease.now().Add(ttl)
+				return nil
+			})
+			switch {
+			case err == nil:
+				select {
+				case renewed <- started:
+				case <-quit:
+					return
+				}
+			case errors.Is(err, errTakenOver):
+				takenOver <- err
+				return
+			}
+		}
+	}()
+
+	deadline := time.NewTimer(ttl * 2 / 3)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case started := <-renewed:
+			deadline.Reset(time.Until(started.Add(ttl * 2 / 3)))
+		case err := <-takenOver:
+			h.lose(err)
+			return
+		case <-deadline.C:
+			h.lose(fmt.Errorf("not renewed within %v", ttl*2/3))
+			return
+		}
+	}
+}
+
+// lose records why the lease was lost and closes Lost
+func (h *Holding) lose(err error) {
+	h.mu.Lock()
+	h.err = err
+	h.mu.Unlock()
+	close(h.lost)
+}
+
+// Lost is closed once the lease can no longer be renewed in time, or was taken over; the command must be
+// stopped then. Err tells why.
+func (h *Holding) Lost() <-chan struct{} {
+	return h.lost
+}
+
+// Err returns why the lease was lost, once Lost is closed
+func (h *Holding) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+// Release stops renewing the lease and frees it, keeping its fencing token for the next holder
+func (h *Holding) Release() error {
+	close(h.stop)
+	<-h.done
+	select {
+	case <-h.lost:
+		// Another holder may have it already
+		return nil
+	default:
+	}
+	return h.lease.update(func(r *record) error {
+		if r.Token == h.token {
+			r.Holder, r.Expires = "", time.Time{}
+		}
+		return nil
+	})
+}
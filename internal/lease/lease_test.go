@@ -0,0 +1,119 @@
+package lease
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// TestAcquireRelease tests that a held lease is refused to others, and taken with the next token once released
+func TestAcquireRelease(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	a := New(fs, "/shared/report.lease", "host-a:1", time.Minute)
+	b := New(fs, "/shared/report.lease", "host-b:1", time.Minute)
+
+	held, err := a.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if held.Token() != 1 {
+		t.Errorf("Token() = %d, want 1", held.Token())
+	}
+	var heldErr *HeldError
+	if _, err := b.Acquire(); !errors.As(err, &heldErr) || heldErr.Holder != "host-a:1" {
+		t.Fatalf("Acquire() of a held lease error = %v, want HeldError of host-a:1", err)
+	}
+	if err := held.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	taken, err := b.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() of a released lease error = %v", err)
+	}
+	defer func() { _ = taken.Release() }()
+	if taken.Token() != 2 {
+		t.Errorf("Token() = %d, want 2", taken.Token())
+	}
+}
+
+// TestTakeoverExpired tests that an expired lease is taken over, and that its former holder notices it
+func TestTakeoverExpired(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	a := New(fs, "/shared/report.lease", "host-a:1", 300*time.Millisecond)
+	// The lease of a expired long ago, as if it stopped renewing it
+	a.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	b := New(fs, "/shared/report.lease", "host-b:1", 300*time.Millisecond)
+
+	stale, err := a.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	taken, err := b.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() of an expired lease error = %v", err)
+	}
+	defer func() { _ = taken.Release() }()
+	if taken.Token() != stale.Token()+1 {
+		t.Errorf("Token() = %d, want %d", taken.Token(), stale.Token()+1)
+	}
+
+	select {
+	case <-stale.Lost():
+		if !errors.Is(stale.Err(), errTakenOver) {
+			t.Errorf("Err() = %v, want taken over", stale.Err())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the former holder to lose the lease")
+	}
+	if err := stale.Release(); err != nil {
+		t.Errorf("Release() of a lost lease error = %v", err)
+	}
+	select {
+	case <-taken.Lost():
+		t.Errorf("Expected the new holder to keep the lease, lost: %v", taken.Err())
+	default:
+	}
+}
+
+// failingFs fails to write files once fail is set, like shared storage that became unreachable
+type failingFs struct {
+	afero.Fs
+	fail atomic.Bool
+}
+
+func (f *failingFs) Rename(oldname, newname string) error {
+	if f.fail.Load() {
+		return os.ErrPermission
+	}
+	return f.Fs.Rename(oldname, newname)
+}
+
+// TestLostWhenNotRenewed tests that a lease that cannot be renewed is lost before it expires
+func TestLostWhenNotRenewed(t *testing.T) {
+	fs := &failingFs{Fs: afero.NewMemMapFs()}
+	ttl := 300 * time.Millisecond
+	l := New(fs, "/shared/report.lease", "host-a:1", ttl)
+	held, err := l.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	start := time.Now()
+	fs.fail.Store(true)
+
+	select {
+	case <-held.Lost():
+		if elapsed := time.Since(start); elapsed >= ttl {
+			t.Errorf("lease lost after %v, want before its TTL of %v", elapsed, ttl)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the lease to be lost")
+	}
+	if err := held.Release(); err != nil {
+		t.Errorf("Release() of a lost lease error = %v", err)
+	}
+}
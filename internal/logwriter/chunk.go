@@ -0,0 +1,191 @@
+package logwriter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexExt is the extension of the index of a chunked log file, recording where the output of each minute starts
+const IndexExt = ".idx"
+
+// ChunkPath returns the path of the chunk n of the chunked log file at path, e.g. job.log.000
+func ChunkPath(path string, n int) string {
+	return fmt.Sprintf("%s.%03d", path, n)
+}
+
+// chunkFile writes a log file as numbered chunks of about size bytes, a single write is never split
+type chunkFile struct {
+	path    string
+	size    int64
+	create  func(path string) (*os.File, error)
+	file    *os.File
+	n       int
+	written int64
+}
+
+// newChunkFile creates the first chunk of the log file at path and removes the later chunks of a previous run
+func newChunkFile(path string, size int64, create func(path string) (*os.File, error)) (*chunkFile, error) {
+	for n := 1; ; n++ {
+		if err := os.Remove(ChunkPath(path, n)); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			return nil, err
+		}
+	}
+	file, err := create(ChunkPath(path, 0))
+	if err != nil {
+		return nil, err
+	}
+	return &chunkFile{path: path, size: size, create: create, file: file}, nil
+}
+
+// Write writes p to the current chunk, starting the next one first if p would not fit
+func (c *chunkFile) Write(p []byte) (int, error) {
+	if c.written > 0 && c.written+int64(len(p)) > c.size {
+		file, err := c.create(ChunkPath(c.path, c.n+1))
+		if err != nil {
+			return 0, err
+		}
+		if err := c.file.Close(); err != nil {
+			_ = file.Close()
+			return 0, err
+		}
+		c.file, c.n, c.written = file, c.n+1, 0
+	}
+	n, err := c.file.Write(p)
+	c.written += int64(n)
+	return n, err
+}
+
+// Close closes the current chunk
+func (c *chunkFile) Close() error {
+	return c.file.Close()
+}
+
+// index records the offset of the first output written in each minute, one "<unix time> <offset>" line per minute
+type index struct {
+	file   *os.File
+	minute time.Time
+	// failed stops marking after a write error, a partial index would be misleading
+	failed bool
+}
+
+// mark records offset if now is in a later minute than the previous mark
+func (i *index) mark(now time.Time, offset int64) error {
+	minute := now.Truncate(time.Minute)
+	if i.failed || !minute.After(i.minute) {
+		return nil
+	}
+	i.minute = minute
+	if _, err := fmt.Fprintf(i.file, "%d %d\n", minute.Unix(), offset); err != nil {
+		i.failed = true
+		return err
+	}
+	return nil
+}
+
+// readIndex returns the offset of the first output written in the minute of since or later,
+// math.MaxInt64 if all the output was written before
+func readIndex(path string) (func(since time.Time) int64, error) {
+	file, err := os.Open(path + IndexExt)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	type entry struct {
+		minute time.Time
+		offset int64
+	}
+	var entries []entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid index line %q", scanner.Text())
+		}
+		minute, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index line %q", scanner.Text())
+		}
+		offset, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index line %q", scanner.Text())
+		}
+		entries = append(entries, entry{minute: time.Unix(minute, 0), offset: offset})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return func(since time.Time) int64 {
+		for _, e := range entries {
+			if e.minute.Add(time.Minute).After(since) {
+				return e.offset
+			}
+		}
+		return math.MaxInt64
+	}, nil
+}
+
+// openChunks opens the chunks of the log file at path as a single stream, starting at offset
+func openChunks(path string, offset int64) (io.ReadCloser, error) {
+	chunks := &multiFile{}
+	for n := 0; ; n++ {
+		file, err := os.Open(ChunkPath(path, n))
+		if errors.Is(err, fs.ErrNotExist) && n > 0 {
+			break
+		}
+		if err != nil {
+			_ = chunks.Close()
+			return nil, err
+		}
+		info, err := file.Stat()
+		if err == nil && offset >= info.Size() {
+			offset -= info.Size()
+			err = file.Close()
+			if err == nil {
+				continue
+			}
+		}
+		if err == nil && offset > 0 {
+			_, err = file.Seek(offset, io.SeekStart)
+			offset = 0
+		}
+		if err != nil {
+			_ = file.Close()
+			_ = chunks.Close()
+			return nil, err
+		}
+		chunks.files = append(chunks.files, file)
+	}
+	readers := make([]io.Reader, len(chunks.files))
+	for i, file := range chunks.files {
+		readers[i] = file
+	}
+	chunks.Reader = io.MultiReader(readers...)
+	return chunks, nil
+}
+
+// multiFile reads several files in sequence, closing all of them at once
+type multiFile struct {
+	io.Reader
+	files []*os.File
+}
+
+// Close closes all the files
+func (m *multiFile) Close() error {
+	var errs []error
+	for _, file := range m.files {
+		errs = append(errs, file.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package logwriter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+)
+
+// writeChunked writes lines to a log file chunked every 16 bytes, each line at its time and flushed on its own
+func writeChunked(t *testing.T, path string, lines []string, times []time.Time) {
+	t.Helper()
+	lw, err := NewLogWriter(path, WithChunkSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range lines {
+		lw.now = func() time.Time { return times[i] }
+		if _, err := lw.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		if err := lw.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readAll reads and closes reader
+func readAll(t *testing.T, reader io.ReadCloser) string {
+	t.Helper()
+	defer func() { _ = reader.Close() }()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// TestLogWriterChunks tests splitting the log file in chunks and reading it from a minute with the index
+func TestLogWriterChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.log")
+	start := time.Date(2024, 5, 1, 2, 14, 10, 0, time.Local)
+	writeChunked(t, path,
+		[]string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"},
+		[]time.Time{start, start.Add(40 * time.Second), start.Add(55 * time.Second), start.Add(3 * time.Minute)},
+	)
+
+	for n, want := range []string{"line 1\nline 2\n", "line 3\nline 4\n"} {
+		content, err := os.ReadFile(ChunkPath(path, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("chunk %d = %q, want %q", n, content, want)
+		}
+	}
+	if _, err := os.Stat(ChunkPath(path, 2)); !os.IsNotExist(err) {
+		t.Errorf("unexpected chunk 2, error = %v", err)
+	}
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readAll(t, reader), "line 1\nline 2\nline 3\nline 4\n"; got != want {
+		t.Errorf("Open() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  string
+	}{
+		{name: "before the run", since: start.Add(-time.Hour), want: "line 1\nline 2\nline 3\nline 4\n"},
+		{name: "within the first minute", since: start.Add(30 * time.Second), want: "line 1\nline 2\nline 3\nline 4\n"},
+		{name: "second minute", since: start.Add(50 * time.Second), want: "line 3\nline 4\n"},
+		{name: "minute without output", since: start.Add(2 * time.Minute), want: "line 4\n"},
+		{name: "after the run", since: start.Add(time.Hour), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := OpenSince(path, tt.since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readAll(t, reader); got != tt.want {
+				t.Errorf("OpenSince() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLogWriterChunksRewrite tests that the chunks of a previous run are removed
+func TestLogWriterChunksRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.log")
+	now := time.Now()
+	writeChunked(t, path, []string{"previous 1\n", "previous 2\n", "previous 3\n"}, []time.Time{now, now, now})
+	writeChunked(t, path, []string{"current\n"}, []time.Time{now})
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readAll(t, reader), "current\n"; got != want {
+		t.Errorf("Open() = %q, want %q", got, want)
+	}
+	for _, n := range []int{1, 2} {
+		if _, err := os.Stat(ChunkPath(path, n)); !os.IsNotExist(err) {
+			t.Errorf("stale chunk %d left, error = %v", n, err)
+		}
+	}
+}
+
+// TestLogWriterChunksErrors tests the invalid uses of chunked log files
+func TestLogWriterChunksErrors(t *testing.T) {
+	dir := t.TempDir()
+	c, err := crypt.NewCipher(make([]byte, crypt.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLogWriter(filepath.Join(dir, "encrypted.log"), WithChunkSize(16), WithCipher(c)); err == nil {
+		t.Error("NewLogWriter() with a cipher succeeded, want error")
+	}
+
+	plainPath := filepath.Join(dir, "plain.log")
+	if err := os.WriteFile(plainPath, []byte("output\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSince(plainPath, time.Now()); !os.IsNotExist(err) {
+		t.Errorf("OpenSince() of a log without index error = %v, want not exist", err)
+	}
+}
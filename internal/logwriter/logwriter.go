@@ -2,36 +2,141 @@ package logwriter
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
 )
 
 // LogWriter handles concurrent writing of stdout and stderr to a log file
 type LogWriter struct {
-	file       *os.File
+	path       string
+	out        io.Closer
 	writer     *bufio.Writer
+	index      *index
+	offset     int64
+	now        func() time.Time
 	mu         sync.Mutex
 	wg         sync.WaitGroup
 	stdoutPipe io.ReadCloser
 	stderrPipe io.ReadCloser
 }
 
+// config holds configuration for LogWriter (package-private)
+type config struct {
+	// mode is the permission of the log file, 0 keeps the default 0666 before umask
+	mode os.FileMode
+	// uid and gid are the owner of the log file, -1 keeps the current one
+	uid int
+	gid int
+	// cipher encrypts the log file, nil writes it in plain text
+	cipher *crypt.Cipher
+	// chunkSize splits the log file in chunks of about this size with an index, 0 writes a single file
+	chunkSize int64
+}
+
+// Option is a function that configures a LogWriter
+type Option func(*config)
+
+// WithFileMode sets the permission of the log file, also when it already exists
+func WithFileMode(mode os.FileMode) Option {
+	return func(c *config) {
+		c.mode = mode
+	}
+}
+
+// WithOwner sets the owner of the log file, -1 keeps the current user or group
+func WithOwner(uid, gid int) Option {
+	return func(c *config) {
+		c.uid = uid
+		c.gid = gid
+	}
+}
+
+// WithCipher encrypts the log file, it can be read with cronmgr decrypt
+func WithCipher(c *crypt.Cipher) Option {
+	return func(cfg *config) {
+		cfg.cipher = c
+	}
+}
+
+// WithChunkSize splits the log file in chunks path.000, path.001... of about size bytes, and records
+// in path.idx where the output of each minute starts so that it can be read without scanning the whole log
+func WithChunkSize(size int64) Option {
+	return func(c *config) {
+		c.chunkSize = size
+	}
+}
+
 // NewLogWriter creates a new LogWriter that writes to the specified log file
-func NewLogWriter(logPath string) (*LogWriter, error) {
-	file, err := os.Create(logPath)
+func NewLogWriter(logPath string, opts ...Option) (*LogWriter, error) {
+	cfg := config{uid: -1, gid: -1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.chunkSize <= 0 {
+		file, err := cfg.create(logPath)
+		if err != nil {
+			return nil, err
+		}
+		// Each flush of the buffer is encrypted as a whole
+		var out io.Writer = file
+		if cfg.cipher != nil {
+			out = cfg.cipher.NewWriter(file)
+		}
+		return &LogWriter{path: logPath, out: file, writer: bufio.NewWriter(out), now: time.Now}, nil
+	}
+
+	// The index records plain text offsets, encrypted chunks could not be read from them
+	if cfg.cipher != nil {
+		return nil, errors.New("chunked log files cannot be encrypted")
+	}
+	indexFile, err := cfg.create(logPath + IndexExt)
 	if err != nil {
 		return nil, err
 	}
-
+	chunks, err := newChunkFile(logPath, cfg.chunkSize, cfg.create)
+	if err != nil {
+		_ = indexFile.Close()
+		return nil, err
+	}
 	return &LogWriter{
-		file:   file,
-		writer: bufio.NewWriter(file),
+		path:   logPath,
+		out:    chunks,
+		writer: bufio.NewWriter(chunks),
+		index:  &index{file: indexFile},
+		now:    time.Now,
 	}, nil
 }
 
+// create creates the file at path with the configured permissions
+func (cfg *config) create(path string) (*os.File, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	// Apply permissions before any output is written, the file may have existed with other ones
+	if cfg.mode != 0 {
+		if err := file.Chmod(cfg.mode); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+	if cfg.uid != -1 || cfg.gid != -1 {
+		if err := file.Chown(cfg.uid, cfg.gid); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
 // SetupPipes sets up stdout and stderr pipes for the command
 func (lw *LogWriter) SetupPipes(cmd *exec.Cmd) error {
 	stdoutPipe, err := cmd.StdoutPipe()
@@ -80,14 +185,30 @@ func (lw *LogWriter) Wait() error {
 	return lw.writer.Flush()
 }
 
+// Path returns the path of the log file
+func (lw *LogWriter) Path() string {
+	return lw.path
+}
+
 // Close closes the log file
 func (lw *LogWriter) Close() error {
-	return lw.file.Close()
+	if lw.index != nil {
+		return errors.Join(lw.out.Close(), lw.index.file.Close())
+	}
+	return lw.out.Close()
 }
 
 // Write implements io.Writer interface with thread-safe access
 func (lw *LogWriter) Write(p []byte) (n int, err error) {
 	lw.mu.Lock()
 	defer lw.mu.Unlock()
-	return lw.writer.Write(p)
+	if lw.index != nil {
+		// A broken index only slows down reading, the output itself must not be lost
+		if err := lw.index.mark(lw.now(), lw.offset); err != nil {
+			log.Printf("Error writing log index: %v", err)
+		}
+	}
+	n, err = lw.writer.Write(p)
+	lw.offset += int64(n)
+	return n, err
 }
@@ -1,11 +1,14 @@
 package logwriter
 
 import (
+	"bytes"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/alswl/cron-manager/internal/crypt"
 )
 
 func TestLogWriter(t *testing.T) {
@@ -123,3 +126,73 @@ func TestLogWriterNoRace(t *testing.T) {
 		}
 	}
 }
+
+// TestLogWriterFileOptions tests that the log file mode and owner are applied, also to existing files
+func TestLogWriterFileOptions(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(logPath, []byte("old output"), 0666); err != nil {
+		t.Fatalf("Failed to create log file: %v", err)
+	}
+	if err := os.Chmod(logPath, 0666); err != nil {
+		t.Fatalf("Failed to chmod log file: %v", err)
+	}
+
+	lw, err := NewLogWriter(logPath, WithFileMode(0640), WithOwner(os.Getuid(), os.Getgid()))
+	if err != nil {
+		t.Fatalf("Failed to create LogWriter: %v", err)
+	}
+	defer func() { _ = lw.Close() }()
+
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatalf("Failed to stat log file: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("log file mode = %v, want 0640", info.Mode().Perm())
+	}
+	if info.Size() != 0 {
+		t.Errorf("log file should be truncated, got %d bytes", info.Size())
+	}
+}
+
+// TestLogWriterCipher tests that the log file is encrypted and decrypts to the command output
+func TestLogWriterCipher(t *testing.T) {
+	c, err := crypt.NewCipher(bytes.Repeat([]byte{1}, crypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	lw, err := NewLogWriter(logPath, WithCipher(c))
+	if err != nil {
+		t.Fatalf("Failed to create LogWriter: %v", err)
+	}
+
+	cmd := exec.Command("sh", "-c", "echo secret output")
+	if err := lw.SetupPipes(cmd); err != nil {
+		t.Fatalf("SetupPipes() error = %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	lw.Start()
+	if err := lw.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	_ = cmd.Wait()
+	_ = lw.Close()
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if bytes.Contains(content, []byte("secret")) {
+		t.Fatalf("log file is not encrypted: %s", content)
+	}
+	var decrypted bytes.Buffer
+	if err := c.Decrypt(bytes.NewReader(content), &decrypted); err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if decrypted.String() != "secret output\n" {
+		t.Errorf("decrypted log = %q, want %q", decrypted.String(), "secret output\n")
+	}
+}
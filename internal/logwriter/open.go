@@ -0,0 +1,61 @@
+package logwriter
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// CompressedExt is the extension of compressed log files, as left by log rotation tools
+const CompressedExt = ".gz"
+
+// Open opens the log file at path for reading. If it no longer exists but its compressed
+// copy path.gz does, the decompressed content of the copy is read instead.
+// The chunks of a log file written with WithChunkSize are read in sequence.
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err == nil {
+		return file, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if _, chunkErr := os.Stat(ChunkPath(path, 0)); chunkErr == nil {
+		return openChunks(path, 0)
+	}
+	compressed, gzErr := os.Open(path + CompressedExt)
+	if gzErr != nil {
+		// Report the log file itself, the compressed copy is only a fallback
+		return nil, err
+	}
+	reader, err := gzip.NewReader(compressed)
+	if err != nil {
+		_ = compressed.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: reader, file: compressed}, nil
+}
+
+// OpenSince opens the log file at path written with WithChunkSize for reading from the output
+// written in the minute of since, seeking to it with the index instead of scanning the earlier output
+func OpenSince(path string, since time.Time) (io.ReadCloser, error) {
+	offset, err := readIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	return openChunks(path, offset(since))
+}
+
+// gzipFile reads a compressed file, closing the file with the reader
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close closes the reader and the file
+func (g *gzipFile) Close() error {
+	return errors.Join(g.Reader.Close(), g.file.Close())
+}
@@ -0,0 +1,66 @@
+package logwriter
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpen tests reading plain log files and their compressed copies
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain.log")
+	if err := os.WriteFile(plainPath, []byte("plain output\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	compressedPath := filepath.Join(dir, "rotated.log")
+	file, err := os.Create(compressedPath + CompressedExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	if _, err := gz.Write([]byte("compressed output\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		want      string
+		wantError bool
+	}{
+		{name: "plain", path: plainPath, want: "plain output\n"},
+		{name: "compressed", path: compressedPath, want: "compressed output\n"},
+		{name: "missing", path: filepath.Join(dir, "missing.log"), wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := Open(tt.path)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Open() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err != nil {
+				if !os.IsNotExist(err) {
+					t.Errorf("Open() error = %v, want not exist", err)
+				}
+				return
+			}
+			defer func() { _ = reader.Close() }()
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("Open() content = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
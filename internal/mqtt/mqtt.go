@@ -0,0 +1,297 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/netdial"
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// DefaultTimeout is the timeout of a publish when none is configured
+const DefaultTimeout = 10 * time.Second
+
+// PasswordEnv is the environment variable with the password of the broker user
+const PasswordEnv = "MQTT_PASSWORD"
+
+// Packet types of MQTT 3.1.1, in the high nibble of the fixed header
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPuback     = 0x40
+	packetPubrec     = 0x50
+	packetPubrel     = 0x62
+	packetPubcomp    = 0x70
+	packetDisconnect = 0xe0
+)
+
+// connackErrors are the reasons a broker refuses a connection, by CONNACK return code
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Config configures a Publisher
+type Config struct {
+	// URL is the broker address, tcp://host:1883 or, with TLS, ssl://host:8883 (also mqtts:// and tls://)
+	URL string
+	// ClientID identifies the client to the broker, empty generates a random one
+	ClientID string
+	Username string
+	// Password is read again for each publish so it can be rotated, nil sends no password
+	Password *secret.Secret
+	// QoS is the quality of service of the published messages: 0, 1 or 2
+	QoS byte
+	// Retain asks the broker to keep the last message of the topic for new subscribers
+	Retain bool
+	// TLS configures the TLS connection of ssl:// URLs, nil uses the system roots
+	TLS *tls.Config
+	// Timeout bounds each publish, including the connection, 0 uses DefaultTimeout
+	Timeout time.Duration
+	// BindInterface is the interface name or local address the connections are made from, see netdial.New
+	BindInterface string
+	// DNSCache records the address of the broker, used while its name cannot be resolved, nil disables it
+	DNSCache *netdial.Cache
+}
+
+// Publisher publishes messages to an MQTT 3.1.1 broker, connecting for each message:
+// cron jobs publish once per run, a persistent connection would only hold broker resources
+type Publisher struct {
+	cfg     Config
+	address string
+	tls     bool
+	dialer  *netdial.Dialer
+}
+
+// NewPublisher creates a Publisher for cfg
+func NewPublisher(cfg Config) (*Publisher, error) {
+	if cfg.QoS > 2 {
+		return nil, fmt.Errorf("invalid QoS %d, expected 0, 1 or 2", cfg.QoS)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker URL %q: %w", cfg.URL, err)
+	}
+	p := &Publisher{cfg: cfg, address: u.Host}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		p.tls = true
+		port = "8883"
+	default:
+		return nil, fmt.Errorf("invalid broker URL %q, expected tcp://, mqtt://, ssl://, tls:// or mqtts://", cfg.URL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid broker URL %q: no host", cfg.URL)
+	}
+	if u.Port() == "" {
+		p.address = net.JoinHostPort(u.Hostname(), port)
+	}
+	if p.cfg.Timeout <= 0 {
+		p.cfg.Timeout = DefaultTimeout
+	}
+	if p.dialer, err = netdial.New(cfg.BindInterface, cfg.DNSCache); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Publish connects to the broker, publishes payload to topic with the configured QoS and disconnects
+func (p *Publisher) Publish(ctx context.Context, topic string, payload []byte) error {
+	password, err := p.cfg.Password.Get()
+	if err != nil {
+		return fmt.Errorf("publish to mqtt: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+	conn, err := p.dialer.DialContext(ctx, "tcp", p.address)
+	if err == nil && p.tls {
+		conn, err = p.handshake(ctx, conn)
+	}
+	if err != nil {
+		return fmt.Errorf("publish to mqtt: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("publish to mqtt: %w", err)
+		}
+	}
+
+	if err := p.exchange(bufio.NewReader(conn), conn, topic, payload, password); err != nil {
+		return fmt.Errorf("publish to mqtt: %w", err)
+	}
+	return nil
+}
+
+// handshake starts TLS on conn, verifying the broker certificate for the host name of the broker URL
+// even when conn was made to its cached address
+func (p *Publisher) handshake(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	cfg := &tls.Config{}
+	if p.cfg.TLS != nil {
+		cfg = p.cfg.TLS.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(p.address)
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// exchange runs the connect, publish and disconnect packet exchange, authenticating with password if it is not empty
+func (p *Publisher) exchange(r *bufio.Reader, w io.Writer, topic string, payload []byte, password string) error {
+	clientID := p.cfg.ClientID
+	if clientID == "" {
+		// At most 23 characters, the limit brokers must accept
+		random := make([]byte, 7)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		clientID = "cronmgr-" + hex.EncodeToString(random)
+	}
+	// Clean session, nothing is kept by the broker once the message is delivered
+	flags := byte(0x02)
+	body := appendString(nil, "MQTT")
+	connectPayload := appendString(nil, clientID)
+	if p.cfg.Username != "" {
+		flags |= 0x80
+		connectPayload = appendString(connectPayload, p.cfg.Username)
+	}
+	if password != "" {
+		flags |= 0x40
+		connectPayload = appendString(connectPayload, password)
+	}
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, 60)
+	if err := writePacket(w, packetConnect, append(body, connectPayload...)); err != nil {
+		return err
+	}
+	header, ack, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if header != packetConnack || len(ack) != 2 {
+		return fmt.Errorf("unexpected packet 0x%02x instead of CONNACK", header)
+	}
+	if ack[1] != 0 {
+		reason, ok := connackErrors[ack[1]]
+		if !ok {
+			reason = fmt.Sprintf("return code %d", ack[1])
+		}
+		return fmt.Errorf("connection refused: %s", reason)
+	}
+
+	const packetID = 1
+	publishHeader := byte(packetPublish) | p.cfg.QoS<<1
+	if p.cfg.Retain {
+		publishHeader |= 0x01
+	}
+	body = appendString(nil, topic)
+	if p.cfg.QoS > 0 {
+		body = binary.BigEndian.AppendUint16(body, packetID)
+	}
+	if err := writePacket(w, publishHeader, append(body, payload...)); err != nil {
+		return err
+	}
+	switch p.cfg.QoS {
+	case 1:
+		if err := expectAck(r, packetPuback, packetID); err != nil {
+			return err
+		}
+	case 2:
+		if err := expectAck(r, packetPubrec, packetID); err != nil {
+			return err
+		}
+		if err := writePacket(w, packetPubrel, binary.BigEndian.AppendUint16(nil, packetID)); err != nil {
+			return err
+		}
+		if err := expectAck(r, packetPubcomp, packetID); err != nil {
+			return err
+		}
+	}
+	return writePacket(w, packetDisconnect, nil)
+}
+
+// expectAck reads the acknowledgment packet of type header for the packet id
+func expectAck(r *bufio.Reader, header byte, id uint16) error {
+	got, body, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if got != header || len(body) != 2 || binary.BigEndian.Uint16(body) != id {
+		return fmt.Errorf("unexpected packet 0x%02x instead of acknowledgment 0x%02x", got, header)
+	}
+	return nil
+}
+
+// appendString appends s as a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// writePacket writes a packet with the fixed header byte header and the remaining body
+func writePacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// readPacket reads a packet and returns its fixed header byte and remaining body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
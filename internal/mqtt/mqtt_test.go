@@ -0,0 +1,209 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// received is what the fake broker received from a client
+type received struct {
+	connectFlags byte
+	username     string
+	password     string
+	header       byte
+	topic        string
+	payload      string
+	disconnected bool
+}
+
+// readString reads a length-prefixed string from b and returns the rest
+func readString(b []byte) (string, []byte) {
+	n := binary.BigEndian.Uint16(b)
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+// serveBroker accepts one connection on listener like an MQTT broker answering CONNECT with returnCode
+func serveBroker(t *testing.T, listener net.Listener, returnCode byte) <-chan received {
+	t.Helper()
+	done := make(chan received, 1)
+	go func() {
+		var got received
+		defer func() { done <- got }()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		r := bufio.NewReader(conn)
+
+		_, body, err := readPacket(r)
+		if err != nil {
+			t.Errorf("read CONNECT: %v", err)
+			return
+		}
+		_, rest := readString(body)
+		got.connectFlags = rest[1]
+		_, rest = readString(rest[4:])
+		if got.connectFlags&0x80 != 0 {
+			got.username, rest = readString(rest)
+		}
+		if got.connectFlags&0x40 != 0 {
+			got.password, _ = readString(rest)
+		}
+		if err := writePacket(conn, packetConnack, []byte{0, returnCode}); err != nil || returnCode != 0 {
+			return
+		}
+
+		header, body, err := readPacket(r)
+		if err != nil {
+			t.Errorf("read PUBLISH: %v", err)
+			return
+		}
+		got.header = header
+		got.topic, body = readString(body)
+		switch qos := header >> 1 & 0x03; qos {
+		case 1:
+			_ = writePacket(conn, packetPuback, body[:2])
+		case 2:
+			_ = writePacket(conn, packetPubrec, body[:2])
+			if header, _, err := readPacket(r); err != nil || header != packetPubrel {
+				t.Errorf("read PUBREL: 0x%02x %v", header, err)
+				return
+			}
+			_ = writePacket(conn, packetPubcomp, body[:2])
+		}
+		if qos := header >> 1 & 0x03; qos > 0 {
+			body = body[2:]
+		}
+		got.payload = string(body)
+		header, _, err = readPacket(r)
+		got.disconnected = err == nil && header == packetDisconnect
+	}()
+	return done
+}
+
+// TestPublisherPublish tests the packet exchange with a broker
+func TestPublisherPublish(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		returnCode byte
+		wantHeader byte
+		wantError  bool
+	}{
+		{name: "qos 0", cfg: Config{}, wantHeader: 0x30},
+		{name: "qos 1 retained", cfg: Config{QoS: 1, Retain: true}, wantHeader: 0x33},
+		{name: "qos 2", cfg: Config{QoS: 2}, wantHeader: 0x34},
+		{name: "credentials", cfg: Config{Username: "device", Password: secret.Value("secret"), QoS: 1}, wantHeader: 0x32},
+		{name: "refused", cfg: Config{Username: "device"}, returnCode: 5, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = listener.Close() }()
+			done := serveBroker(t, listener, tt.returnCode)
+
+			cfg := tt.cfg
+			cfg.URL = "tcp://" + listener.Addr().String()
+			p, err := NewPublisher(cfg)
+			if err != nil {
+				t.Fatalf("NewPublisher() error = %v", err)
+			}
+			err = p.Publish(context.Background(), "cron/host/backup/result", []byte(`{"status":"success"}`))
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Publish() error = %v, wantError %v", err, tt.wantError)
+			}
+			got := <-done
+			if tt.wantError {
+				return
+			}
+			if got.header != tt.wantHeader || got.topic != "cron/host/backup/result" || got.payload != `{"status":"success"}` {
+				t.Errorf("PUBLISH = 0x%02x %s %s, want 0x%02x cron/host/backup/result {\"status\":\"success\"}", got.header, got.topic, got.payload, tt.wantHeader)
+			}
+			password, _ := tt.cfg.Password.Get()
+			if got.username != tt.cfg.Username || got.password != password {
+				t.Errorf("credentials = %q %q, want %q %q", got.username, got.password, tt.cfg.Username, password)
+			}
+			if got.connectFlags&0x02 == 0 {
+				t.Error("CONNECT without clean session")
+			}
+			if !got.disconnected {
+				t.Error("client did not send DISCONNECT")
+			}
+		})
+	}
+}
+
+// TestPublisherPublishTLS tests publishing over TLS with the broker certificate trusted
+func TestPublisherPublishTLS(t *testing.T) {
+	// Borrow the certificate of a TLS test server for the broker
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.StartTLS()
+	defer server.Close()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: server.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	done := serveBroker(t, listener, 0)
+
+	p, err := NewPublisher(Config{
+		URL: "ssl://" + listener.Addr().String(),
+		TLS: server.Client().Transport.(*http.Transport).TLSClientConfig,
+	})
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	if err := p.Publish(context.Background(), "cron/host/backup/result", []byte("{}")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if got := <-done; got.payload != "{}" {
+		t.Errorf("payload = %q, want {}", got.payload)
+	}
+}
+
+// TestNewPublisher tests validating the broker URL and QoS
+func TestNewPublisher(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		wantAddress string
+		wantTLS     bool
+		wantError   bool
+	}{
+		{name: "default port", cfg: Config{URL: "tcp://broker"}, wantAddress: "broker:1883"},
+		{name: "tls default port", cfg: Config{URL: "mqtts://broker"}, wantAddress: "broker:8883", wantTLS: true},
+		{name: "explicit port", cfg: Config{URL: "ssl://broker:1884"}, wantAddress: "broker:1884", wantTLS: true},
+		{name: "ipv6 default port", cfg: Config{URL: "tcp://[2001:db8::1]"}, wantAddress: "[2001:db8::1]:1883"},
+		{name: "ipv6 explicit port", cfg: Config{URL: "mqtts://[2001:db8::1]:8884"}, wantAddress: "[2001:db8::1]:8884", wantTLS: true},
+		{name: "unknown scheme", cfg: Config{URL: "http://broker"}, wantError: true},
+		{name: "no host", cfg: Config{URL: "tcp://"}, wantError: true},
+		{name: "invalid qos", cfg: Config{URL: "tcp://broker", QoS: 3}, wantError: true},
+		{name: "unknown bind interface", cfg: Config{URL: "tcp://broker", BindInterface: "cronmgr-missing0"}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPublisher(tt.cfg)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("NewPublisher() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err != nil {
+				return
+			}
+			if p.address != tt.wantAddress || p.tls != tt.wantTLS {
+				t.Errorf("NewPublisher() = %s tls=%v, want %s tls=%v", p.address, p.tls, tt.wantAddress, tt.wantTLS)
+			}
+		})
+	}
+}
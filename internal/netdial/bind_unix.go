@@ -0,0 +1,10 @@
+//go:build unix
+
+package netdial
+
+import "syscall"
+
+// bindFD binds the socket fd to sa
+func bindFD(fd uintptr, sa syscall.Sockaddr) error {
+	return syscall.Bind(int(fd), sa)
+}
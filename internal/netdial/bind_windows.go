@@ -0,0 +1,10 @@
+//go:build windows
+
+package netdial
+
+import "syscall"
+
+// bindFD binds the socket fd to sa
+func bindFD(fd uintptr, sa syscall.Sockaddr) error {
+	return syscall.Bind(syscall.Handle(fd), sa)
+}
@@ -0,0 +1,113 @@
+package netdial
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/spf13/afero"
+)
+
+// CacheFile is the name of the resolution cache in the state directory
+const CacheFile = "dns-cache.json"
+
+// Ages of the cached resolutions
+const (
+	// CacheMaxAge is the age after which a cached address is no longer used, the server may have moved
+	CacheMaxAge = 7 * 24 * time.Hour
+	// cacheRefresh is the age after which the address of a successful connection is written again,
+	// so each connection does not rewrite the file
+	cacheRefresh = time.Hour
+)
+
+// cacheEntry is the address a host name was last reached at
+type cacheEntry struct {
+	Addr     string    `json:"addr"`
+	Resolved time.Time `json:"resolved"`
+}
+
+// Cache keeps the address each host name was last reached at in a file, so the backends are still
+// reached at their last known address while DNS is down. The file is shared by the processes using it.
+type Cache struct {
+	fs        afero.Fs
+	path      string
+	now       func() time.Time
+	useOsLock bool
+}
+
+// NewCache creates a Cache keeping the addresses in the file path
+func NewCache(fs afero.Fs, path string) *Cache {
+	_, isOsFs := fs.(*afero.OsFs)
+	return &Cache{fs: fs, path: path, now: time.Now, useOsLock: isOsFs}
+}
+
+// Lookup returns the address host was last reached at, ok is false if it was never reached or too long ago
+func (c *Cache) Lookup(host string) (addr string, ok bool, err error) {
+	entries, err := c.read()
+	if err != nil {
+		return "", false, err
+	}
+	entry, found := entries[host]
+	if !found || c.now().Sub(entry.Resolved) > CacheMaxAge {
+		return "", false, nil
+	}
+	return entry.Addr, true, nil
+}
+
+// Store records that host was reached at addr
+func (c *Cache) Store(host, addr string) error {
+	now := c.now()
+	// Skip the lock while the file already holds a recent resolution to the same address
+	if entries, err := c.read(); err == nil {
+		if entry, ok := entries[host]; ok && entry.Addr == addr && now.Sub(entry.Resolved) < cacheRefresh {
+			return nil
+		}
+	}
+	if err := c.fs.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	locker := fslock.NewLocker(c.path, c.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return fmt.Errorf("couldn't lock %s: %w", c.path, err)
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	entries, err := c.read()
+	if err != nil {
+		return err
+	}
+	entries[host] = cacheEntry{Addr: addr, Resolved: now}
+	// Forget the hosts no longer used
+	maps.DeleteFunc(entries, func(_ string, entry cacheEntry) bool {
+		return now.Sub(entry.Resolved) > CacheMaxAge
+	})
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := c.path + ".tmp"
+	if err := afero.WriteFile(c.fs, tmpPath, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return c.fs.Rename(tmpPath, c.path)
+}
+
+// read returns the cached addresses by host name
+func (c *Cache) read() (map[string]cacheEntry, error) {
+	entries := map[string]cacheEntry{}
+	content, err := afero.ReadFile(c.fs, c.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("invalid resolution cache %s: %w", c.path, err)
+	}
+	return entries, nil
+}
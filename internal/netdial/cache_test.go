@@ -0,0 +1,72 @@
+package netdial
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// TestCache tests recording and expiring the addresses of host names
+func TestCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	cache := NewCache(afero.NewMemMapFs(), "/state/"+CacheFile)
+	cache.now = func() time.Time { return now }
+
+	if _, ok, err := cache.Lookup("pushgateway.internal"); err != nil || ok {
+		t.Fatalf("Lookup() of an unknown host = %v, %v, want not found", ok, err)
+	}
+	if err := cache.Store("pushgateway.internal", "2001:db8::5"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	now = now.Add(CacheMaxAge - time.Minute)
+	if addr, ok, err := cache.Lookup("pushgateway.internal"); err != nil || !ok || addr != "2001:db8::5" {
+		t.Errorf("Lookup() = %s, %v, %v, want the stored address", addr, ok, err)
+	}
+	now = now.Add(2 * time.Minute)
+	if addr, ok, _ := cache.Lookup("pushgateway.internal"); ok {
+		t.Errorf("Lookup() = %s past the maximum age, want not found", addr)
+	}
+}
+
+// TestDialerCache tests connecting to the cached address of a host name that cannot be resolved
+func TestDialerCache(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	cache := NewCache(afero.NewMemMapFs(), "/state/"+CacheFile)
+	dialer, err := New("", cache)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// .invalid names never resolve (RFC 6761)
+	address := net.JoinHostPort("pushgateway.invalid", port)
+	if conn, err := dialer.DialContext(context.Background(), "tcp", address); err == nil {
+		_ = conn.Close()
+		t.Fatal("DialContext() of an uncached unresolvable host should fail")
+	}
+	if err := cache.Store("pushgateway.invalid", "127.0.0.1"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", address)
+	if err != nil {
+		t.Fatalf("DialContext() error = %v, want the cached address", err)
+	}
+	_ = conn.Close()
+
+	// Successful connections record the address they were made to
+	conn, err = dialer.DialContext(context.Background(), "tcp4", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatalf("DialContext() error = %v", err)
+	}
+	_ = conn.Close()
+	if addr, ok, err := cache.Lookup("localhost"); err != nil || !ok || addr != "127.0.0.1" {
+		t.Errorf("Lookup(localhost) = %s, %v, %v, want 127.0.0.1", addr, ok, err)
+	}
+}
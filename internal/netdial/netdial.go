@@ -0,0 +1,197 @@
+package netdial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Timeouts of the connections, as in the default HTTP transport
+const (
+	dialTimeout = 30 * time.Second
+	keepAlive   = 30 * time.Second
+)
+
+// FallbackDelay is the time an IPv6 connection attempt gets before an IPv4 one is started in parallel
+// (Happy Eyeballs, RFC 6555) when the host has addresses of both families
+const FallbackDelay = 300 * time.Millisecond
+
+// Dialer connects the network backends. Hosts resolving to IPv6 and IPv4 addresses are dialed with
+// Happy Eyeballs.
+type Dialer struct {
+	net   *net.Dialer
+	cache *Cache
+}
+
+// New creates the dialer of the network backends. bind is the interface name or local address connections
+// are made from, empty lets the routing table choose it. Connections to a family bind has no address of
+// fail, so dual-stack hosts fall back to the other family. cache, if not nil, records the address each host
+// was reached at and is used while its name cannot be resolved.
+func New(bind string, cache *Cache) (*Dialer, error) {
+	d := &Dialer{
+		net:   &net.Dialer{Timeout: dialTimeout, KeepAlive: keepAlive, FallbackDelay: FallbackDelay},
+		cache: cache,
+	}
+	if bind == "" {
+		return d, nil
+	}
+	source, err := newSource(bind)
+	if err != nil {
+		return nil, err
+	}
+	d.net.Control = source.control
+	return d, nil
+}
+
+// DialContext connects to address on network. When the host name of address cannot be resolved, it
+// connects to the address the host was last reached at instead.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.net.DialContext(ctx, network, address)
+	host, port, splitErr := net.SplitHostPort(address)
+	if d.cache == nil || splitErr != nil || net.ParseIP(host) != nil {
+		return conn, err
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return d.dialCached(ctx, network, host, port, err)
+	}
+	if err == nil {
+		if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			if err := d.cache.Store(host, remote.IP.String()); err != nil {
+				log.Printf("Failed to cache the address of %s: %v", host, err)
+			}
+		}
+	}
+	return conn, err
+}
+
+// dialCached connects to the cached address of host after its resolution failed with resolveErr
+func (d *Dialer) dialCached(ctx context.Context, network, host, port string, resolveErr error) (net.Conn, error) {
+	addr, ok, err := d.cache.Lookup(host)
+	if err != nil {
+		log.Printf("Failed to read the cached address of %s: %v", host, err)
+	}
+	if !ok {
+		return nil, resolveErr
+	}
+	log.Printf("Failed to resolve %s, connecting to its cached address %s: %v", host, addr, resolveErr)
+	conn, err := d.net.DialContext(ctx, network, net.JoinHostPort(addr, port))
+	if err != nil {
+		return nil, fmt.Errorf("%w; cached address: %w", resolveErr, err)
+	}
+	return conn, nil
+}
+
+// source is the interface or address connections are bound to
+type source struct {
+	// ip is the local address, nil to use the addresses of iface
+	ip    net.IP
+	iface string
+}
+
+// newSource parses bind, an IP address or the name of an existing interface
+func newSource(bind string) (*source, error) {
+	if ip := net.ParseIP(bind); ip != nil {
+		return &source{ip: ip}, nil
+	}
+	if _, err := net.InterfaceByName(bind); err != nil {
+		return nil, fmt.Errorf("bind interface %q: %w", bind, err)
+	}
+	return &source{iface: bind}, nil
+}
+
+// control binds the socket of a connection to network to the source before it connects
+func (s *source) control(network, _ string, c syscall.RawConn) error {
+	ipv6 := strings.HasSuffix(network, "6")
+	sa, err := s.sockaddr(ipv6)
+	if err != nil {
+		return err
+	}
+	var bindErr error
+	if err := c.Control(func(fd uintptr) { bindErr = bindFD(fd, sa) }); err != nil {
+		return err
+	}
+	if bindErr != nil {
+		return fmt.Errorf("bind to %s: %w", s, bindErr)
+	}
+	return nil
+}
+
+// sockaddr returns the local address of the family the connection is made with
+func (s *source) sockaddr(ipv6 bool) (syscall.Sockaddr, error) {
+	if s.ip != nil {
+		if (s.ip.To4() == nil) != ipv6 {
+			return nil, fmt.Errorf("cannot bind to %s: %w", s, errFamily(ipv6))
+		}
+		return toSockaddr(s.ip, 0), nil
+	}
+	iface, err := net.InterfaceByName(s.iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	ip := pickAddr(addrs, ipv6)
+	if ip == nil {
+		return nil, fmt.Errorf("cannot bind to interface %s: %w", s.iface, errFamily(ipv6))
+	}
+	return toSockaddr(ip, iface.Index), nil
+}
+
+func (s *source) String() string {
+	if s.ip != nil {
+		return s.ip.String()
+	}
+	return "interface " + s.iface
+}
+
+// errFamily is the error of binding a connection of a family the source has no address of
+func errFamily(ipv6 bool) error {
+	if ipv6 {
+		return errors.New("no IPv6 address")
+	}
+	return errors.New("no IPv4 address")
+}
+
+// pickAddr returns the first address of the family among addrs, preferring global addresses over
+// link-local ones, nil if there is none
+func pickAddr(addrs []net.Addr, ipv6 bool) net.IP {
+	var linkLocal net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		if ipNet.IP.IsLinkLocalUnicast() {
+			if linkLocal == nil {
+				linkLocal = ipNet.IP
+			}
+			continue
+		}
+		return ipNet.IP
+	}
+	return linkLocal
+}
+
+// toSockaddr returns the socket address of ip with port 0, zone is the interface index of link-local
+// IPv6 addresses
+func toSockaddr(ip net.IP, zone int) syscall.Sockaddr {
+	if ip4 := ip.To4(); ip4 != nil {
+		sa := &syscall.SockaddrInet4{}
+		copy(sa.Addr[:], ip4)
+		return sa
+	}
+	sa := &syscall.SockaddrInet6{}
+	copy(sa.Addr[:], ip.To16())
+	if ip.IsLinkLocalUnicast() {
+		sa.ZoneId = uint32(zone)
+	}
+	return sa
+}
@@ -0,0 +1,73 @@
+package netdial
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+// TestPickAddr tests choosing the address of an interface connections are bound to
+func TestPickAddr(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("fe80::1")},
+		&net.IPNet{IP: net.ParseIP("192.0.2.10").To4()},
+		&net.IPNet{IP: net.ParseIP("2001:db8::10")},
+	}
+	tests := []struct {
+		name  string
+		addrs []net.Addr
+		ipv6  bool
+		want  string
+	}{
+		{name: "ipv4", addrs: addrs, want: "192.0.2.10"},
+		{name: "global ipv6 first", addrs: addrs, ipv6: true, want: "2001:db8::10"},
+		{name: "link-local ipv6", addrs: addrs[:2], ipv6: true, want: "fe80::1"},
+		{name: "no ipv4", addrs: addrs[:1], want: "<nil>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickAddr(tt.addrs, tt.ipv6).String(); got != tt.want {
+				t.Errorf("pickAddr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNewBind tests connecting from the bound address, and failing to reach another family
+func TestNewBind(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	dialer, err := New("127.0.0.1", nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("DialContext() error = %v", err)
+	}
+	_ = conn.Close()
+	if ip := conn.LocalAddr().(*net.TCPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("connected from %s, want 127.0.0.1", ip)
+	}
+
+	listener6, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer func() { _ = listener6.Close() }()
+	if conn, err := dialer.DialContext(context.Background(), "tcp", listener6.Addr().String()); err == nil {
+		_ = conn.Close()
+		t.Error("DialContext() of an IPv6 address from an IPv4 source should fail")
+	}
+}
+
+// TestNewInvalid tests rejecting unknown interfaces
+func TestNewInvalid(t *testing.T) {
+	if _, err := New("cronmgr-missing0", nil); err == nil {
+		t.Error("New() of an unknown interface should fail")
+	}
+}
@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Exec runs a command for each notification, with the message as JSON on stdin,
+// to integrate alerting systems without first-class support
+type Exec struct {
+	command string
+	timeout time.Duration
+}
+
+// NewExec creates an Exec notifier running command with the shell
+func NewExec(command string, timeout time.Duration) *Exec {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Exec{command: command, timeout: timeout}
+}
+
+// Channel returns exec
+func (e *Exec) Channel() string { return "exec" }
+
+// Notify runs the command with msg as JSON on stdin and the job name in CRONMGR_JOB_NAME,
+// the notification failed if the command fails or does not exit within the timeout
+func (e *Exec) Notify(ctx context.Context, msg Message) error {
+	body, err := messageJSON(msg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", e.command)
+	cmd.Env = append(os.Environ(), "CRONMGR_JOB_NAME="+msg.Name)
+	cmd.Stdin = bytes.NewReader(append(body, '\n'))
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Do not wait for background processes of the command holding its output open
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		detail := strings.TrimSpace(output.String())
+		if len(detail) > 512 {
+			detail = detail[len(detail)-512:]
+		}
+		if detail != "" {
+			return fmt.Errorf("notify exec: %w: %s", err, detail)
+		}
+		return fmt.Errorf("notify exec: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecNotify tests running commands with the message as JSON on stdin
+func TestExecNotify(t *testing.T) {
+	msg := Message{Name: "backup", Host: "web-1", Status: "failed", ErrorType: "job", ExitCode: 2}
+	tests := []struct {
+		name      string
+		command   string
+		timeout   time.Duration
+		wantError string
+	}{
+		{name: "delivered", command: `cat > "$OUT"; echo "$CRONMGR_JOB_NAME" >> "$OUT.name"`},
+		{name: "failed", command: `echo "alert api unavailable" >&2; exit 3`, wantError: "exit status 3: alert api unavailable"},
+		{name: "timeout", command: `sleep 5`, timeout: 100 * time.Millisecond, wantError: "context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "message.json")
+			t.Setenv("OUT", out)
+			n := NewExec(tt.command, tt.timeout)
+			if n.Channel() != "exec" {
+				t.Errorf("Channel() = %s, want exec", n.Channel())
+			}
+			err := n.Notify(context.Background(), msg)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Notify() error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			content, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(content, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got["name"] != "backup" || got["exit_code"] != float64(2) || got["text"] != msg.Text() {
+				t.Errorf("stdin = %s, want the message as JSON", content)
+			}
+			name, _ := os.ReadFile(out + ".name")
+			if string(name) != "backup\n" {
+				t.Errorf("CRONMGR_JOB_NAME = %q, want backup", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// File appends notifications as JSON lines to a file, e.g. as the last resort of a fallback chain
+// or for a log shipper
+type File struct {
+	path string
+}
+
+// NewFile creates a File notifier appending to path
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Channel returns file
+func (f *File) Channel() string { return "file" }
+
+// Notify appends msg as one JSON line, the file is only readable by its owner as the log tail may be sensitive
+func (f *File) Notify(_ context.Context, msg Message) error {
+	line, err := messageJSON(msg)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("notify file: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("notify file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("notify file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFileNotify tests appending notifications as JSON lines
+func TestFileNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	n := NewFile(path)
+	for _, name := range []string{"backup", "sync"} {
+		if err := n.Notify(context.Background(), Message{Name: name, Status: "failed"}); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), content)
+	}
+	var got Message
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil || got.Name != "sync" {
+		t.Errorf("line = %s, want the notification of sync (error %v)", lines[1], err)
+	}
+
+	if err := NewFile(filepath.Join(path, "missing", "file")).Notify(context.Background(), Message{}); err == nil {
+		t.Error("Notify() error = nil, want an error for an unwritable path")
+	}
+}
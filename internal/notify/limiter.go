@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/spf13/afero"
+)
+
+// Limit allows Count notifications per Window, the zero Limit allows any number
+type Limit struct {
+	Count  int
+	Window time.Duration
+}
+
+// ParseLimit parses a limit formatted as <count>/<window>, e.g. 3/1h
+func ParseLimit(value string) (Limit, error) {
+	count, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected <count>/<window>, e.g. 3/1h", value)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: the count must be a positive integer", value)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: the window must be a positive duration", value)
+	}
+	return Limit{Count: n, Window: d}, nil
+}
+
+// allows reports whether one more notification is allowed at now after the notifications sent
+func (l Limit) allows(sent []time.Time, now time.Time) bool {
+	return l.Count == 0 || len(l.recent(sent, now)) < l.Count
+}
+
+// recent returns the times of sent still in the window at now
+func (l Limit) recent(sent []time.Time, now time.Time) []time.Time {
+	var kept []time.Time
+	for _, t := range sent {
+		if l.Count > 0 && now.Sub(t) < l.Window {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// Decision is what the Limiter decided for the notification of a failed run, also used as metric label
+type Decision string
+
+const (
+	// Sent notifications are delivered, with the failures batched before them
+	Sent Decision = "sent"
+	// Batched notifications exceed the limit of their job, they are counted in its next notification
+	Batched Decision = "batched"
+	// Dropped notifications exceed the global limit, they are only counted in metrics
+	Dropped Decision = "dropped"
+)
+
+// Digest is the failures of a job batched since its last notification
+type Digest struct {
+	Count int
+	Since time.Time
+}
+
+// limiterState is the content of the file of a Limiter
+type limiterState struct {
+	// Sent are the times of the notifications of all jobs
+	Sent []time.Time `json:"sent,omitempty"`
+	// Jobs are the notifications of each job
+	Jobs map[string]*jobState `json:"jobs,omitempty"`
+}
+
+// jobState are the notifications of a job
+type jobState struct {
+	Sent         []time.Time `json:"sent,omitempty"`
+	Batched      int         `json:"batched,omitempty"`
+	BatchedSince time.Time   `json:"batched_since,omitzero"`
+}
+
+// Limiter limits the notifications of each job and of all jobs sharing its file. Each cronmgr process
+// sends the notification of one run, so the times of the sent notifications and the batched
+// failures are kept in a file.
+type Limiter struct {
+	fs        afero.Fs
+	path      string
+	job       Limit
+	global    Limit
+	useOsLock bool
+}
+
+// NewLimiter creates a Limiter keeping its state in the file path, job limits the notifications of each
+// job and global those of all jobs
+func NewLimiter(fs afero.Fs, path string, job, global Limit) *Limiter {
+	_, isOsFs := fs.(*afero.OsFs)
+	return &Limiter{fs: fs, path: path, job: job, global: global, useOsLock: isOsFs}
+}
+
+// Failure decides whether the failed run of the job name at now is notified. A sent notification
+// carries the digest of the failures batched before it.
+func (l *Limiter) Failure(name string, now time.Time) (Decision, Digest, error) {
+	var decision Decision
+	var digest Digest
+	err := l.update(name, now, func(s *limiterState, job *jobState) {
+		switch {
+		case !l.global.allows(s.Sent, now):
+			decision = Dropped
+		case !l.job.allows(job.Sent, now):
+			decision = Batched
+			if job.Batched == 0 {
+				job.BatchedSince = now
+			}
+			job.Batched++
+		default:
+			decision = Sent
+			digest = send(s, job, now)
+		}
+	})
+	return decision, digest, err
+}
+
+// Recovery decides whether the successful run of the job name at now is notified with the digest of the
+// failures batched before it, so they are not lost once the job recovered. ok is false if no failure
+// is batched or the limits still do not allow a notification.
+func (l *Limiter) Recovery(name string, now time.Time) (digest Digest, ok bool, err error) {
+	err = l.update(name, now, func(s *limiterState, job *jobState) {
+		if job.Batched == 0 || !l.global.allows(s.Sent, now) || !l.job.allows(job.Sent, now) {
+			return
+		}
+		digest, ok = send(s, job, now), true
+	})
+	return digest, ok, err
+}
+
+// send records a notification of job at now and returns the digest it carries
+func send(s *limiterState, job *jobState, now time.Time) Digest {
+	digest := Digest{Count: job.Batched, Since: job.BatchedSince}
+	s.Sent = append(s.Sent, now)
+	job.Sent = append(job.Sent, now)
+	job.Batched, job.BatchedSince = 0, time.Time{}
+	return digest
+}
+
+// update applies fn to the state of the limiter and of the job name, under the lock of the file
+func (l *Limiter) update(name string, now time.Time, fn func(s *limiterState, job *jobState)) error {
+	if err := l.fs.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	locker := fslock.NewLocker(l.path, l.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return fmt.Errorf("couldn't lock %s: %w", l.path, err)
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	var s limiterState
+	content, err := afero.ReadFile(l.fs, l.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(content, &s); err != nil {
+			return fmt.Errorf("invalid notification limits %s: %w", l.path, err)
+		}
+	}
+	if s.Jobs == nil {
+		s.Jobs = map[string]*jobState{}
+	}
+	job, ok := s.Jobs[name]
+	if !ok {
+		job = &jobState{}
+		s.Jobs[name] = job
+	}
+	fn(&s, job)
+
+	// Only keep what the limits still need
+	s.Sent = l.global.recent(s.Sent, now)
+	for jobName, j := range s.Jobs {
+		j.Sent = l.job.recent(j.Sent, now)
+		if len(j.Sent) == 0 && j.Batched == 0 {
+			delete(s.Jobs, jobName)
+		}
+	}
+
+	content, err = json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmpPath := l.path + ".tmp"
+	if err := afero.WriteFile(l.fs, tmpPath, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return l.fs.Rename(tmpPath, l.path)
+}
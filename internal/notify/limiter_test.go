@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// TestParseLimit tests parsing <count>/<window> limits
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      Limit
+		wantError bool
+	}{
+		{value: "3/1h", want: Limit{Count: 3, Window: time.Hour}},
+		{value: "10/15m", want: Limit{Count: 10, Window: 15 * time.Minute}},
+		{value: "3", wantError: true},
+		{value: "0/1h", wantError: true},
+		{value: "x/1h", wantError: true},
+		{value: "3/hour", wantError: true},
+		{value: "3/-1h", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLimit(tt.value)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseLimit() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLimiter tests limiting, batching and dropping the notifications of successive runs
+func TestLimiter(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name         string
+		job          string
+		failed       bool
+		at           time.Duration
+		wantDecision Decision
+		wantOK       bool
+		wantDigest   Digest
+	}{
+		{name: "first failure", job: "backup", failed: true, wantDecision: Sent},
+		{name: "second failure", job: "backup", failed: true, at: time.Minute, wantDecision: Sent},
+		{name: "job limit", job: "backup", failed: true, at: 2 * time.Minute, wantDecision: Batched},
+		{name: "still limited", job: "backup", failed: true, at: 3 * time.Minute, wantDecision: Batched},
+		{name: "recovery while limited", job: "backup", at: 4 * time.Minute},
+		{name: "other job", job: "sync", failed: true, at: 5 * time.Minute, wantDecision: Sent},
+		{name: "global limit", job: "sync", failed: true, at: 6 * time.Minute, wantDecision: Dropped},
+		{name: "recovery digest", job: "backup", at: time.Hour + time.Minute, wantOK: true,
+			wantDigest: Digest{Count: 2, Since: start.Add(2 * time.Minute)}},
+		{name: "nothing batched", job: "backup", at: time.Hour + 2*time.Minute},
+		{name: "failure after window", job: "sync", failed: true, at: 2 * time.Hour, wantDecision: Sent},
+	}
+
+	l := NewLimiter(afero.NewMemMapFs(), "/state/notify/limits.json", Limit{Count: 2, Window: time.Hour}, Limit{Count: 3, Window: time.Hour})
+	for _, step := range steps {
+		now := start.Add(step.at)
+		if step.failed {
+			decision, digest, err := l.Failure(step.job, now)
+			if err != nil {
+				t.Fatalf("%s: Failure() error = %v", step.name, err)
+			}
+			if decision != step.wantDecision || digest != step.wantDigest {
+				t.Errorf("%s: Failure() = %s %+v, want %s %+v", step.name, decision, digest, step.wantDecision, step.wantDigest)
+			}
+			continue
+		}
+		digest, ok, err := l.Recovery(step.job, now)
+		if err != nil {
+			t.Fatalf("%s: Recovery() error = %v", step.name, err)
+		}
+		if ok != step.wantOK || digest != step.wantDigest {
+			t.Errorf("%s: Recovery() = %+v %v, want %+v %v", step.name, digest, ok, step.wantDigest, step.wantOK)
+		}
+	}
+}
+
+// TestLimiterUnlimited tests that zero limits allow every notification
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter(afero.NewMemMapFs(), "/state/notify/limits.json", Limit{}, Limit{})
+	now := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		decision, _, err := l.Failure("backup", now)
+		if err != nil || decision != Sent {
+			t.Fatalf("Failure() #%d = %s, %v, want sent", i, decision, err)
+		}
+	}
+}
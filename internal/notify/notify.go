@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of a notification when none is configured
+const DefaultTimeout = 10 * time.Second
+
+// Message describes the finished run a notification is sent for
+type Message struct {
+	// Name is the job name
+	Name string `json:"name"`
+	// Host is the host the job ran on
+	Host string `json:"host"`
+	// RunID identifies the run, see runner.RunID
+	RunID string `json:"run_id,omitempty"`
+	// Status is the status of the run, e.g. failed
+	Status string `json:"status"`
+	// ErrorType is the error type of a failed run: exec, job, timeout or readonly
+	ErrorType string `json:"error_type,omitempty"`
+	// Severity is the severity of a failed run assigned by an exit code mapping, empty without one
+	Severity string `json:"severity,omitempty"`
+	// ExitCode is the exit code of the job
+	ExitCode int `json:"exit_code"`
+	// Attempts is the number of times the command was started
+	Attempts int `json:"attempts,omitempty"`
+	// StartTime is the time the run started
+	StartTime time.Time `json:"start_time"`
+	// DurationSeconds is the time the command took to run
+	DurationSeconds float64 `json:"duration_seconds"`
+	// LogFile is the path the output of the run was written to, empty if it was discarded
+	LogFile string `json:"log_file,omitempty"`
+	// CoreFile is the core dumped by the crashed job, BacktraceFile the backtraces of its threads
+	CoreFile      string `json:"core_file,omitempty"`
+	BacktraceFile string `json:"backtrace_file,omitempty"`
+	// LogTail is the end of the output of the run
+	LogTail string `json:"log_tail,omitempty"`
+	// RunURL links to the run, e.g. in a dashboard
+	RunURL string `json:"run_url,omitempty"`
+	// Limit is the time limit about to kill a running job, attempt or deadline, set by timeout warnings
+	Limit string `json:"limit,omitempty"`
+	// KillInSeconds is the time left before the job is killed by Limit
+	KillInSeconds float64 `json:"kill_in_seconds,omitempty"`
+	// Batched is the number of failures of the job batched by the limits since its last notification
+	Batched int `json:"batched,omitempty"`
+	// BatchedSince is the time of the first batched failure
+	BatchedSince time.Time `json:"batched_since,omitzero"`
+	// Test marks synthetic messages sent to verify the notifiers
+	Test bool `json:"test,omitempty"`
+	// Body replaces the default text of the message, e.g. rendered with a Template
+	Body string `json:"-"`
+}
+
+// Duration returns the time the command took to run
+func (m Message) Duration() time.Duration {
+	return time.Duration(m.DurationSeconds * float64(time.Second)).Round(100 * time.Millisecond)
+}
+
+// Text returns Body, or else the message as one line of text, e.g.
+// "cronmgr: job backup failed on web-1 (job error, exit code 2) after 1m3s, log: /var/log/backup.log"
+func (m Message) Text() string {
+	var b strings.Builder
+	if m.Test {
+		b.WriteString("[test] ")
+	}
+	if m.Body != "" {
+		b.WriteString(m.Body)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "cronmgr: job %s %s", m.Name, m.Status)
+	if m.Host != "" {
+		fmt.Fprintf(&b, " on %s", m.Host)
+	}
+	if m.ErrorType != "" {
+		fmt.Fprintf(&b, " (%s error, exit code %d", m.ErrorType, m.ExitCode)
+		if m.Severity != "" {
+			fmt.Fprintf(&b, ", severity %s", m.Severity)
+		}
+		b.WriteString(")")
+	}
+	fmt.Fprintf(&b, " after %s", m.Duration())
+	if m.RunID != "" {
+		fmt.Fprintf(&b, ", run %s", m.RunID)
+	}
+	if m.LogFile != "" {
+		fmt.Fprintf(&b, ", log: %s", m.LogFile)
+	}
+	if m.CoreFile != "" {
+		fmt.Fprintf(&b, ", core: %s", m.CoreFile)
+	}
+	if m.Limit != "" {
+		fmt.Fprintf(&b, "; killed by its %s limit in %s", m.Limit, time.Duration(m.KillInSeconds*float64(time.Second)).Round(time.Second))
+	}
+	if m.Batched > 0 {
+		fmt.Fprintf(&b, "; %d more failures since %s", m.Batched, m.BatchedSince.UTC().Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// messageJSON encodes msg as JSON, with its text in the text field
+func messageJSON(msg Message) ([]byte, error) {
+	return json.Marshal(struct {
+		Message
+		Text string `json:"text"`
+	}{Message: msg, Text: msg.Text()})
+}
+
+// Notifier delivers notifications to one channel
+type Notifier interface {
+	// Channel is the kind of channel, e.g. slack, used to select notifiers
+	Channel() string
+	// Notify delivers msg
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Deliver sends msg to every notifier, or with fallback to each notifier in order until one delivers it.
+// failed is called for each failed delivery. It fails if no notifier delivered msg.
+func Deliver(ctx context.Context, notifiers []Notifier, msg Message, fallback bool, failed func(n Notifier, err error)) error {
+	var errs []error
+	delivered := false
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, msg); err != nil {
+			failed(n, err)
+			errs = append(errs, err)
+			continue
+		}
+		delivered = true
+		if fallback {
+			break
+		}
+	}
+	if delivered || len(notifiers) == 0 {
+		return nil
+	}
+	return fmt.Errorf("no notifier delivered the notification: %w", errors.Join(errs...))
+}
+
+// postJSON posts the JSON body to endpoint with the extra header, nil for none, and checks the response status
+func postJSON(ctx context.Context, client *http.Client, endpoint string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestMessageText tests formatting messages as text
+func TestMessageText(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{
+			name: "failed",
+			msg: Message{Name: "backup", Host: "web-1", RunID: "20240101T020000Z-42", Status: "failed", ErrorType: "job", ExitCode: 2,
+				DurationSeconds: 63.21, LogFile: "/var/log/backup.log"},
+			want: "cronmgr: job backup failed on web-1 (job error, exit code 2) after 1m3.2s, run 20240101T020000Z-42, log: /var/log/backup.log",
+		},
+		{
+			name: "digest",
+			msg: Message{Name: "backup", Status: "success", DurationSeconds: 1, Batched: 3,
+				BatchedSince: time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)},
+			want: "cronmgr: job backup success after 1s; 3 more failures since 2024-05-01T02:00:00Z",
+		},
+		{
+			name: "core",
+			msg: Message{Name: "report", Status: "failed", ErrorType: "job", ExitCode: -1, DurationSeconds: 2,
+				LogFile: "/var/log/report.log", CoreFile: "/var/lib/cronmgr/artifacts/20240101T020000Z-42/core.42"},
+			want: "cronmgr: job report failed (job error, exit code -1) after 2s, log: /var/log/report.log, core: /var/lib/cronmgr/artifacts/20240101T020000Z-42/core.42",
+		},
+		{
+			name: "severity",
+			msg:  Message{Name: "sync", Status: "failed", ErrorType: "job", ExitCode: 24, Severity: "warning", DurationSeconds: 5},
+			want: "cronmgr: job sync failed (job error, exit code 24, severity warning) after 5s",
+		},
+		{
+			name: "timeout warning",
+			msg: Message{Name: "backup", Host: "web-1", Status: "running", DurationSeconds: 2880, Limit: "attempt",
+				KillInSeconds: 719.6},
+			want: "cronmgr: job backup running on web-1 after 48m0s; killed by its attempt limit in 12m0s",
+		},
+		{
+			name: "minimal",
+			msg:  Message{Name: "backup", Status: "success", DurationSeconds: 1},
+			want: "cronmgr: job backup success after 1s",
+		},
+		{
+			name: "test",
+			msg:  Message{Name: "backup", Status: "failed", ErrorType: "job", ExitCode: 1, Test: true, StartTime: time.Unix(0, 0)},
+			want: "[test] cronmgr: job backup failed (job error, exit code 1) after 0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.Text(); got != tt.want {
+				t.Errorf("Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeNotifier records its notifications and fails if err is set
+type fakeNotifier struct {
+	channel string
+	err     error
+	sent    int
+}
+
+func (n *fakeNotifier) Channel() string { return n.channel }
+
+func (n *fakeNotifier) Notify(context.Context, Message) error {
+	n.sent++
+	return n.err
+}
+
+// TestDeliver tests sending to every notifier and falling back to the next notifier
+func TestDeliver(t *testing.T) {
+	down := errors.New("down")
+	tests := []struct {
+		name       string
+		errs       []error
+		fallback   bool
+		wantSent   []int
+		wantFailed []string
+		wantError  bool
+	}{
+		{name: "all", errs: []error{nil, nil}, wantSent: []int{1, 1}},
+		{name: "all with a failure", errs: []error{down, nil}, wantSent: []int{1, 1}, wantFailed: []string{"a"}},
+		{name: "fallback first delivers", errs: []error{nil, nil, nil}, fallback: true, wantSent: []int{1, 0, 0}},
+		{name: "fallback to the last", errs: []error{down, down, nil}, fallback: true, wantSent: []int{1, 1, 1}, wantFailed: []string{"a", "b"}},
+		{name: "none delivers", errs: []error{down, down}, fallback: true, wantSent: []int{1, 1}, wantFailed: []string{"a", "b"}, wantError: true},
+		{name: "no notifier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var notifiers []Notifier
+			var fakes []*fakeNotifier
+			for i, err := range tt.errs {
+				fake := &fakeNotifier{channel: string(rune('a' + i)), err: err}
+				fakes = append(fakes, fake)
+				notifiers = append(notifiers, fake)
+			}
+			var failed []string
+			err := Deliver(context.Background(), notifiers, Message{Name: "backup"}, tt.fallback, func(n Notifier, err error) {
+				failed = append(failed, n.Channel())
+			})
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Deliver() error = %v, wantError %v", err, tt.wantError)
+			}
+			var sent []int
+			for _, fake := range fakes {
+				sent = append(sent, fake.sent)
+			}
+			if !slices.Equal(sent, tt.wantSent) || !slices.Equal(failed, tt.wantFailed) {
+				t.Errorf("sent = %v, failed = %v, want %v, %v", sent, failed, tt.wantSent, tt.wantFailed)
+			}
+		})
+	}
+}
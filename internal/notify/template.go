@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// Template renders the text of notifications with a Go template executed on the Message, e.g.
+//
+//	:rotating_light: *{{.Name}}* {{.Status}} on {{.Host}} after {{.Duration}}
+//	{{if .RunURL}}<{{.RunURL}}|Run {{.RunID}}>{{end}}
+//	```{{.LogTail}}```
+type Template struct {
+	tmpl *template.Template
+}
+
+// ParseTemplate parses the template text
+func ParseTemplate(text string) (*Template, error) {
+	tmpl, err := template.New("notification").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Apply renders msg and sets the result as its Body
+func (t *Template) Apply(msg *Message) error {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, msg); err != nil {
+		return err
+	}
+	msg.Body = strings.TrimSpace(b.String())
+	return nil
+}
+
+// RunURL returns the link to the run of msg from pattern, replacing {job}, {run_id} and {host}
+// with the escaped values of msg, e.g. https://grafana/d/cron?var-job={job}&var-run={run_id}
+func RunURL(pattern string, msg Message) string {
+	return strings.NewReplacer(
+		"{job}", url.QueryEscape(msg.Name),
+		"{run_id}", url.QueryEscape(msg.RunID),
+		"{host}", url.QueryEscape(msg.Host),
+	).Replace(pattern)
+}
@@ -0,0 +1,62 @@
+package notify
+
+import "testing"
+
+// TestTemplateApply tests rendering the text of notifications with templates
+func TestTemplateApply(t *testing.T) {
+	msg := Message{Name: "backup", Host: "web-1", Status: "failed", ExitCode: 2, DurationSeconds: 63.21,
+		LogTail: "disk full", RunURL: "https://grafana/d/cron?var-run=42"}
+	tests := []struct {
+		name      string
+		text      string
+		test      bool
+		want      string
+		wantError bool
+	}{
+		{
+			name: "fields",
+			text: "{{.Name}} {{.Status}} on {{.Host}} after {{.Duration}} (exit {{.ExitCode}})\n{{.LogTail}}\n",
+			want: "backup failed on web-1 after 1m3.2s (exit 2)\ndisk full",
+		},
+		{
+			name: "conditional",
+			text: `{{if .RunURL}}<{{.RunURL}}|{{.Name}}>{{else}}{{.Name}}{{end}}`,
+			want: "<https://grafana/d/cron?var-run=42|backup>",
+		},
+		{name: "test message", text: "{{.Name}} {{.Status}}", test: true, want: "[test] backup failed"},
+		{name: "unknown field", text: "{{.Owner}}", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.text)
+			if err != nil {
+				t.Fatalf("ParseTemplate() error = %v", err)
+			}
+			m := msg
+			m.Test = tt.test
+			err = tmpl.Apply(&m)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Apply() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err == nil && m.Text() != tt.want {
+				t.Errorf("Text() = %q, want %q", m.Text(), tt.want)
+			}
+		})
+	}
+}
+
+// TestParseTemplate tests rejecting invalid templates
+func TestParseTemplate(t *testing.T) {
+	if _, err := ParseTemplate("{{.Name"); err == nil {
+		t.Error("ParseTemplate() error = nil, want a syntax error")
+	}
+}
+
+// TestRunURL tests replacing the placeholders of run URLs
+func TestRunURL(t *testing.T) {
+	got := RunURL("https://grafana/d/cron?var-job={job}&var-run={run_id}&host={host}", Message{Name: "db backup", RunID: "20240101T020000Z-42", Host: "web-1"})
+	want := "https://grafana/d/cron?var-job=db+backup&var-run=20240101T020000Z-42&host=web-1"
+	if got != want {
+		t.Errorf("RunURL() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// Slack posts notifications to a Slack incoming webhook
+type Slack struct {
+	webhook *secret.Secret
+	client  *http.Client
+}
+
+// NewSlack creates a Slack notifier posting to the incoming webhook URL with client, nil uses a client
+// with DefaultTimeout. The URL embeds its credentials, it is read again for each notification so it can be rotated.
+func NewSlack(webhook *secret.Secret, client *http.Client) *Slack {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Slack{webhook: webhook, client: client}
+}
+
+// Channel returns slack
+func (s *Slack) Channel() string { return "slack" }
+
+// Notify posts the text of msg
+func (s *Slack) Notify(ctx context.Context, msg Message) error {
+	webhookURL, err := s.webhook.Get()
+	if err != nil {
+		return fmt.Errorf("notify slack: %w", err)
+	}
+	body, err := json.Marshal(map[string]string{"text": msg.Text()})
+	if err != nil {
+		return err
+	}
+	if err := postJSON(ctx, s.client, webhookURL, body, nil); err != nil {
+		return fmt.Errorf("notify slack: %w", err)
+	}
+	return nil
+}
+
+// Headers of the signature of signed webhook notifications
+const (
+	SignatureHeader = "X-Cronmgr-Signature"
+	KeyIDHeader     = "X-Cronmgr-Key-Id"
+)
+
+// Webhook posts notifications as JSON messages to any HTTP endpoint
+type Webhook struct {
+	url    string
+	client *http.Client
+	signer *crypt.Signer
+}
+
+// NewWebhook creates a Webhook notifier posting to endpoint with client, nil uses a client with DefaultTimeout.
+// With a signer, the body of each notification is signed in SignatureHeader, nil sends them unsigned.
+func NewWebhook(endpoint string, client *http.Client, signer *crypt.Signer) *Webhook {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Webhook{url: endpoint, client: client, signer: signer}
+}
+
+// Channel returns webhook
+func (w *Webhook) Channel() string { return "webhook" }
+
+// Notify posts msg as JSON, with its text in the text field, signed if the webhook has a signer
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	body, err := messageJSON(msg)
+	if err != nil {
+		return err
+	}
+	var header http.Header
+	if w.signer != nil {
+		header = http.Header{}
+		header.Set(SignatureHeader, w.signer.Sign(body))
+		header.Set(KeyIDHeader, w.signer.KeyID())
+	}
+	if err := postJSON(ctx, w.client, w.url, body, header); err != nil {
+		return fmt.Errorf("notify webhook: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// TestNotifiers tests posting notifications to Slack and generic webhooks
+func TestNotifiers(t *testing.T) {
+	msg := Message{Name: "backup", Host: "web-1", Status: "failed", ErrorType: "job", ExitCode: 2}
+	tests := []struct {
+		name        string
+		newNotifier func(url string) Notifier
+		status      int
+		wantChannel string
+		wantFields  map[string]any
+		wantError   bool
+	}{
+		{
+			name:        "slack",
+			newNotifier: func(url string) Notifier { return NewSlack(secret.Value(url), nil) },
+			status:      http.StatusOK,
+			wantChannel: "slack",
+			wantFields:  map[string]any{"text": msg.Text()},
+		},
+		{
+			name:        "webhook",
+			newNotifier: func(url string) Notifier { return NewWebhook(url, nil, nil) },
+			status:      http.StatusAccepted,
+			wantChannel: "webhook",
+			wantFields:  map[string]any{"name": "backup", "host": "web-1", "exit_code": float64(2), "text": msg.Text()},
+		},
+		{
+			name:        "rejected",
+			newNotifier: func(url string) Notifier { return NewSlack(secret.Value(url), nil) },
+			status:      http.StatusForbidden,
+			wantChannel: "slack",
+			wantError:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				content, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(content, &body); err != nil {
+					t.Errorf("Unmarshal() error = %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			n := tt.newNotifier(server.URL)
+			if n.Channel() != tt.wantChannel {
+				t.Errorf("Channel() = %s, want %s", n.Channel(), tt.wantChannel)
+			}
+			err := n.Notify(context.Background(), msg)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Notify() error = %v, wantError %v", err, tt.wantError)
+			}
+			for field, want := range tt.wantFields {
+				if body[field] != want {
+					t.Errorf("%s = %v, want %v", field, body[field], want)
+				}
+			}
+		})
+	}
+}
+
+// TestWebhookSigned tests signing the body of webhook notifications
+func TestWebhookSigned(t *testing.T) {
+	signer := crypt.NewSigner(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize)))
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer server.Close()
+
+	if err := NewWebhook(server.URL, nil, signer).Notify(context.Background(), Message{Name: "backup", Status: "failed"}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if !signer.Verify(body, header.Get(SignatureHeader)) {
+		t.Errorf("%s = %q does not verify the body %s", SignatureHeader, header.Get(SignatureHeader), body)
+	}
+	if header.Get(KeyIDHeader) != signer.KeyID() {
+		t.Errorf("%s = %q, want %s", KeyIDHeader, header.Get(KeyIDHeader), signer.KeyID())
+	}
+}
@@ -0,0 +1,97 @@
+package pglock
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// lockMySQL starts a MySQL session on raw and takes the named lock with it
+func (t Target) lockMySQL(raw net.Conn, password string, wait time.Duration) (session, error) {
+	c, err := t.connectMySQL(raw, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// GET_LOCK waits in seconds and a negative timeout waits forever, a shorter wait is rounded up
+	timeout := time.Duration(0)
+	if wait > 0 {
+		timeout = max(1, (wait+time.Second-1)/time.Second)
+	}
+	// The name is sent in hexadecimal, it needs no quoting
+	sql := fmt.Sprintf("SELECT GET_LOCK(_utf8mb4 X'%s', %d)", hex.EncodeToString([]byte(t.Name)), timeout)
+	// The server gives up waiting by itself, the deadline only covers a server that stopped answering
+	if err := c.SetDeadline(time.Now().Add(wait + t.ConnectTimeout)); err != nil {
+		_ = c.Close()
+		return nil, &Error{Cause: CauseConnect, Err: err}
+	}
+	acquired, err := c.query(sql)
+	switch {
+	case err != nil:
+		err = &Error{Cause: CauseQuery, Err: err}
+	case acquired == "0" && wait > 0:
+		err = &Error{Cause: CauseHeld, Err: fmt.Errorf("held by another session for more than %v", wait)}
+	case acquired == "0":
+		err = &Error{Cause: CauseHeld, Err: errors.New("held by another session")}
+	case acquired != "1":
+		// NULL on errors such as the session being killed
+		err = &Error{Cause: CauseQuery, Err: fmt.Errorf("unexpected result %q", acquired)}
+	}
+	if err == nil {
+		err = c.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connectMySQL negotiates TLS as configured by SSLMode and authenticates
+func (t Target) connectMySQL(raw net.Conn, password string) (*mysqlConn, error) {
+	if err := raw.SetDeadline(time.Now().Add(t.ConnectTimeout)); err != nil {
+		return nil, &Error{Cause: CauseConnect, Err: err}
+	}
+	c := newMySQLConn(raw, t.Network == "unix")
+	h, err := c.readHandshake()
+	if err != nil {
+		return nil, &Error{Cause: CauseConnect, Err: err}
+	}
+	if h.capabilities&clientProtocol41 == 0 {
+		return nil, &Error{Cause: CauseConnect, Err: errors.New("the server does not support protocol 4.1")}
+	}
+	capabilities := uint32(mysqlClientCapabilities)
+	seq := byte(1)
+	// Unix sockets are local, as with PostgreSQL they are not encrypted
+	if t.SSLMode != SSLDisable && t.Network == "tcp" {
+		switch {
+		case h.capabilities&clientSSL != 0:
+			capabilities |= clientSSL
+			if err := c.requestTLS(capabilities); err != nil {
+				return nil, &Error{Cause: CauseConnect, Err: err}
+			}
+			cfg, err := t.tlsConfig()
+			if err != nil {
+				return nil, &Error{Cause: CauseTLS, Err: err}
+			}
+			tlsConn := tls.Client(raw, cfg)
+			if err := tlsConn.Handshake(); err != nil {
+				return nil, &Error{Cause: CauseTLS, Err: err}
+			}
+			c, seq = newMySQLConn(tlsConn, true), 2
+		case t.SSLMode != SSLPrefer:
+			return nil, &Error{Cause: CauseTLS, Err: errors.New("the server does not support TLS")}
+		}
+	}
+	if err := c.login(h, capabilities, seq, t.User, t.Database, password); err != nil {
+		var authErr *authError
+		if errors.As(err, &authErr) {
+			return nil, &Error{Cause: CauseAuth, Err: authErr.err}
+		}
+		return nil, &Error{Cause: CauseConnect, Err: err}
+	}
+	return c, nil
+}
@@ -0,0 +1,442 @@
+package pglock
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Codes of the client/server protocol 4.1 of MySQL
+const (
+	mysqlProtocolVersion = 10
+
+	// Capabilities
+	clientLongPassword      = 0x1
+	clientConnectWithDB     = 0x8
+	clientProtocol41        = 0x200
+	clientSSL               = 0x800
+	clientSecureConnection  = 0x8000
+	clientPluginAuth        = 0x80000
+	mysqlClientCapabilities = clientLongPassword | clientProtocol41 | clientSecureConnection | clientPluginAuth
+
+	// utf8mb4Charset is the utf8mb4_general_ci collation
+	utf8mb4Charset = 45
+	// mysqlMaxPacket is the largest packet cronmgr accepts, announced to the server
+	mysqlMaxPacket = 1 << 24
+
+	// First bytes of the packets sent by the server
+	packetOK       = 0x00
+	packetMoreData = 0x01
+	packetNull     = 0xfb
+	packetEOF      = 0xfe
+	packetError    = 0xff
+
+	// Commands sent by cronmgr
+	comQuit  = 0x01
+	comQuery = 0x03
+	comPing  = 0x0e
+
+	// Answers of caching_sha2_password after the scramble
+	cachingSHA2FastAuthOK  = 3
+	cachingSHA2FullAuth    = 4
+	cachingSHA2RequestKey  = 2
+	nativePasswordPlugin   = "mysql_native_password"
+	cachingSHA2Plugin      = "caching_sha2_password"
+	mysqlKeepAliveInterval = time.Minute
+)
+
+// mysqlAuthErrors are the error numbers of a denied login, e.g. 1045 ER_ACCESS_DENIED_ERROR
+var mysqlAuthErrors = []uint16{1044, 1045, 1251, 1698}
+
+// mysqlConn is a connection speaking the protocol of MySQL
+type mysqlConn struct {
+	net.Conn
+	r *bufio.Reader
+	// secure is set on TLS and unix socket connections, which may carry the password in clear
+	secure bool
+	// mu serializes the commands of the keep-alive with close
+	mu     sync.Mutex
+	closed bool
+}
+
+// newMySQLConn wraps c
+func newMySQLConn(c net.Conn, secure bool) *mysqlConn {
+	return &mysqlConn{Conn: c, r: bufio.NewReader(c), secure: secure}
+}
+
+// writePacket writes the packet of sequence number seq holding payload
+func (c *mysqlConn) writePacket(seq byte, payload []byte) error {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), seq}
+	_, err := c.Write(append(header, payload...))
+	return err
+}
+
+// readPacket reads a packet, returning its sequence number and payload
+func (c *mysqlConn) readPacket() (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if length > maxMessageSize {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[3], payload, nil
+}
+
+// mysqlHandshake is the initial handshake of the server
+type mysqlHandshake struct {
+	capabilities uint32
+	scramble     []byte
+	plugin       string
+}
+
+// readHandshake reads the initial handshake of the server
+func (c *mysqlConn) readHandshake() (mysqlHandshake, error) {
+	_, p, err := c.readPacket()
+	if err != nil {
+		return mysqlHandshake{}, err
+	}
+	if len(p) > 0 && p[0] == packetError {
+		// e.g. the host is not allowed to connect
+		return mysqlHandshake{}, parseMySQLError(p)
+	}
+	if len(p) == 0 || p[0] != mysqlProtocolVersion {
+		return mysqlHandshake{}, errors.New("unsupported server protocol version")
+	}
+	// Server version, connection ID, first 8 bytes of the scramble and filler
+	_, rest, ok := bytes.Cut(p[1:], []byte{0})
+	if !ok || len(rest) < 4+8+1+2 {
+		return mysqlHandshake{}, errors.New("malformed handshake")
+	}
+	h := mysqlHandshake{scramble: slices.Clone(rest[4:12])}
+	h.capabilities = uint32(binary.LittleEndian.Uint16(rest[13:]))
+	rest = rest[15:]
+	if len(rest) < 1+2+2+1+10 {
+		return h, nil
+	}
+	h.capabilities |= uint32(binary.LittleEndian.Uint16(rest[3:])) << 16
+	scrambleLength := int(rest[5])
+	rest = rest[16:]
+	if h.capabilities&clientSecureConnection != 0 {
+		n := min(max(13, scrambleLength-8), len(rest))
+		h.scramble = append(h.scramble, bytes.TrimRight(rest[:n], "\x00")...)
+		rest = rest[n:]
+	}
+	if h.capabilities&clientPluginAuth != 0 {
+		name, _, _ := bytes.Cut(rest, []byte{0})
+		h.plugin = string(name)
+	}
+	return h, nil
+}
+
+// requestTLS asks the server to switch to TLS, with the capabilities of the handshake response to follow
+func (c *mysqlConn) requestTLS(capabilities uint32) error {
+	if err := c.writePacket(1, appendLoginHeader(nil, capabilities)); err != nil {
+		return err
+	}
+	if c.r.Buffered() > 0 {
+		// Anything sent before the TLS handshake could have been injected
+		return errors.New("unexpected data before the TLS handshake")
+	}
+	return nil
+}
+
+// login sends the handshake response of user and authenticates with password. Authentication failures
+// are returned as authError.
+func (c *mysqlConn) login(h mysqlHandshake, capabilities uint32, seq byte, user, database, password string) error {
+	plugin := h.plugin
+	if plugin == "" {
+		plugin = nativePasswordPlugin
+	}
+	scramble := h.scramble
+	auth, err := mysqlScramble(plugin, password, scramble)
+	if err != nil {
+		return &authError{err}
+	}
+	if database != "" {
+		capabilities |= clientConnectWithDB
+	}
+	body := appendLoginHeader(nil, capabilities)
+	body = appendCString(body, user)
+	body = append(append(body, byte(len(auth))), auth...)
+	if database != "" {
+		body = appendCString(body, database)
+	}
+	body = appendCString(body, plugin)
+	if err := c.writePacket(seq, body); err != nil {
+		return err
+	}
+
+	for {
+		seq, p, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(p) == 0 {
+			return errors.New("empty packet during authentication")
+		}
+		switch p[0] {
+		case packetOK:
+			return nil
+		case packetError:
+			err := parseMySQLError(p)
+			if !slices.Contains(mysqlAuthErrors, err.Number) {
+				return err
+			}
+			if password == "" {
+				return &authError{fmt.Errorf("%w, set the password in the DSN or %s", err, MySQLPasswordEnv)}
+			}
+			return &authError{err}
+		case packetEOF:
+			// The server switches to another authentication plugin with a new scramble
+			name, data, _ := bytes.Cut(p[1:], []byte{0})
+			plugin, scramble = string(name), bytes.TrimRight(data, "\x00")
+			if auth, err = mysqlScramble(plugin, password, scramble); err != nil {
+				return &authError{err}
+			}
+			err = c.writePacket(seq+1, auth)
+		case packetMoreData:
+			err = c.cachingSHA2(p[1:], seq+1, password, scramble)
+		default:
+			return fmt.Errorf("unexpected packet 0x%02x during authentication", p[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cachingSHA2 answers the data of caching_sha2_password following the scramble: nothing once the server
+// found the password in its cache, the password itself otherwise, in clear on a secure connection and else
+// encrypted with the public key of the server
+func (c *mysqlConn) cachingSHA2(data []byte, seq byte, password string, scramble []byte) error {
+	if len(data) != 1 {
+		return errors.New("unexpected caching_sha2_password data")
+	}
+	switch data[0] {
+	case cachingSHA2FastAuthOK:
+		return nil
+	case cachingSHA2FullAuth:
+	default:
+		return fmt.Errorf("unexpected caching_sha2_password state %d", data[0])
+	}
+	if c.secure {
+		return c.writePacket(seq, appendCString(nil, password))
+	}
+	if err := c.writePacket(seq, []byte{cachingSHA2RequestKey}); err != nil {
+		return err
+	}
+	seq, p, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(p) == 0 || p[0] != packetMoreData {
+		return errors.New("the server sent no public key")
+	}
+	block, _ := pem.Decode(p[1:])
+	if block == nil {
+		return errors.New("invalid public key of the server")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid public key of the server: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("the public key of the server is not an RSA key")
+	}
+	plain := appendCString(nil, password)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	encrypted, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaKey, plain, nil)
+	if err != nil {
+		return err
+	}
+	return c.writePacket(seq+1, encrypted)
+}
+
+// mysqlScramble returns the answer of plugin to the scramble of the server, empty without a password
+func mysqlScramble(plugin, password string, scramble []byte) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	switch plugin {
+	case nativePasswordPlugin:
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		hash := sha1.Sum([]byte(password))
+		double := sha1.Sum(hash[:])
+		mix := sha1.Sum(append(slices.Clone(scramble), double[:]...))
+		for i := range hash {
+			hash[i] ^= mix[i]
+		}
+		return hash[:], nil
+	case cachingSHA2Plugin:
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		hash := sha256.Sum256([]byte(password))
+		double := sha256.Sum256(hash[:])
+		mix := sha256.Sum256(append(double[:], scramble...))
+		for i := range hash {
+			hash[i] ^= mix[i]
+		}
+		return hash[:], nil
+	default:
+		return nil, fmt.Errorf("unsupported authentication plugin %q", plugin)
+	}
+}
+
+// query runs sql and returns the first column of the first row, empty if there is none or it is NULL
+func (c *mysqlConn) query(sql string) (string, error) {
+	if err := c.writePacket(0, append([]byte{comQuery}, sql...)); err != nil {
+		return "", err
+	}
+	_, p, err := c.readPacket()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(p) == 0:
+		return "", errors.New("empty result")
+	case p[0] == packetError:
+		return "", parseMySQLError(p)
+	case p[0] == packetOK:
+		return "", nil
+	}
+	columns, _ := readLengthEncoded(p)
+	// The column definitions, ended by an EOF packet
+	for i := uint64(0); i <= columns; i++ {
+		if _, _, err := c.readPacket(); err != nil {
+			return "", err
+		}
+	}
+	var value string
+	found := false
+	for {
+		_, p, err := c.readPacket()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case len(p) > 0 && p[0] == packetError:
+			return "", parseMySQLError(p)
+		case len(p) > 0 && p[0] == packetEOF && len(p) < 9:
+			return value, nil
+		case found || len(p) == 0 || p[0] == packetNull:
+		default:
+			found = true
+			length, n := readLengthEncoded(p)
+			if n > 0 && uint64(len(p)-n) >= length {
+				value = string(p[n : n+int(length)])
+			}
+		}
+	}
+}
+
+// wait pings the server every mysqlKeepAliveInterval, so that wait_timeout does not end the session, and
+// reads the connection until it is closed
+func (c *mysqlConn) wait() error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(mysqlKeepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.mu.Lock()
+				if !c.closed {
+					_ = c.writePacket(0, []byte{comPing})
+				}
+				c.mu.Unlock()
+			}
+		}
+	}()
+	for {
+		_, p, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(p) > 0 && p[0] == packetError {
+			// e.g. the session was killed by an administrator, the connection is closed next
+			return parseMySQLError(p)
+		}
+	}
+}
+
+// close quits the session, which releases its named locks
+func (c *mysqlConn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return errors.Join(c.writePacket(0, []byte{comQuit}), c.Close())
+}
+
+// parseMySQLError parses an error packet
+func parseMySQLError(p []byte) *ServerError {
+	err := &ServerError{}
+	if len(p) < 3 {
+		err.Message = "malformed error packet"
+		return err
+	}
+	err.Number = binary.LittleEndian.Uint16(p[1:])
+	message := p[3:]
+	if len(message) >= 6 && message[0] == '#' {
+		err.Code, message = string(message[1:6]), message[6:]
+	}
+	err.Message = string(message)
+	return err
+}
+
+// appendLoginHeader appends the capabilities, maximum packet size and character set starting the handshake
+// response and the TLS request
+func appendLoginHeader(b []byte, capabilities uint32) []byte {
+	b = binary.LittleEndian.AppendUint32(b, capabilities)
+	b = binary.LittleEndian.AppendUint32(b, mysqlMaxPacket)
+	return append(append(b, utf8mb4Charset), make([]byte, 23)...)
+}
+
+// readLengthEncoded reads a length-encoded integer at the start of p, returning it and its size, 0 if p is
+// too short
+func readLengthEncoded(p []byte) (uint64, int) {
+	if len(p) == 0 {
+		return 0, 0
+	}
+	size := 1
+	switch p[0] {
+	case 0xfc:
+		size = 3
+	case 0xfd:
+		size = 4
+	case 0xfe:
+		size = 9
+	}
+	if len(p) < size {
+		return 0, 0
+	}
+	if size == 1 {
+		return uint64(p[0]), 1
+	}
+	var buf [8]byte
+	copy(buf[:], p[1:size])
+	return binary.LittleEndian.Uint64(buf[:]), size
+}
@@ -0,0 +1,303 @@
+package pglock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// fakeMySQLServer is a MySQL server serving one session
+type fakeMySQLServer struct {
+	// plugin is the authentication plugin of the handshake, switchTo the one of the user if it differs
+	plugin, switchTo string
+	password         string
+	// fullAuth makes caching_sha2_password ask for the password, as when it is not cached
+	fullAuth bool
+	// lockResult answers GET_LOCK, NULL for a NULL and an error number starting with E: fails it
+	lockResult string
+	// dropAfterLock closes the connection right after the lock was taken
+	dropAfterLock bool
+}
+
+// mysqlReceived is what the fake MySQL server received
+type mysqlReceived struct {
+	user, database string
+	authorized     bool
+	query          string
+	quit           bool
+}
+
+var fakeScramble = []byte("0123456789abcdefghij")
+
+// serve accepts one session on listener
+func (s fakeMySQLServer) serve(t *testing.T, listener net.Listener) <-chan mysqlReceived {
+	t.Helper()
+	done := make(chan mysqlReceived, 1)
+	go func() {
+		var got mysqlReceived
+		defer func() { done <- got }()
+		raw, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = raw.Close() }()
+		c := newMySQLConn(raw, false)
+
+		capabilities := uint32(mysqlClientCapabilities | clientConnectWithDB)
+		handshake := append([]byte{mysqlProtocolVersion}, "8.4.0\x00"...)
+		handshake = binary.LittleEndian.AppendUint32(handshake, 7)
+		handshake = append(append(handshake, fakeScramble[:8]...), 0)
+		handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities))
+		handshake = append(handshake, utf8mb4Charset, 2, 0)
+		handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities>>16))
+		handshake = append(append(handshake, byte(len(fakeScramble)+1)), make([]byte, 10)...)
+		handshake = append(append(handshake, fakeScramble[8:]...), 0)
+		handshake = appendCString(handshake, s.plugin)
+		if err := c.writePacket(0, handshake); err != nil {
+			return
+		}
+
+		seq, p, err := c.readPacket()
+		if errors.Is(err, io.EOF) {
+			// Clients requiring TLS hang up
+			return
+		}
+		if err != nil || len(p) < 32 {
+			t.Errorf("read handshake response: %q %v", p, err)
+			return
+		}
+		flags := binary.LittleEndian.Uint32(p)
+		user, rest, _ := bytes.Cut(p[32:], []byte{0})
+		got.user = string(user)
+		auth := rest[1 : 1+int(rest[0])]
+		rest = rest[1+int(rest[0]):]
+		if flags&clientConnectWithDB != 0 {
+			database, _, _ := bytes.Cut(rest, []byte{0})
+			got.database = string(database)
+		}
+		if got.authorized = s.authenticate(t, c, &seq, auth); !got.authorized {
+			_ = c.writePacket(seq+1, append([]byte{packetError, 0x15, 0x04}, "#28000Access denied for user"...))
+			return
+		}
+		_ = c.writePacket(seq+1, []byte{packetOK, 0, 0, 2, 0, 0, 0})
+
+		_, p, err = c.readPacket()
+		if err != nil || len(p) == 0 || p[0] != comQuery {
+			t.Errorf("read query: %q %v", p, err)
+			return
+		}
+		got.query = string(p[1:])
+		if number, failed := strings.CutPrefix(s.lockResult, "E:"); failed {
+			n, _ := strconv.Atoi(number)
+			_ = c.writePacket(1, append(binary.LittleEndian.AppendUint16([]byte{packetError}, uint16(n)), "#HY000Query failed"...))
+		} else {
+			row := []byte{packetNull}
+			if s.lockResult != "NULL" {
+				row = append([]byte{byte(len(s.lockResult))}, s.lockResult...)
+			}
+			_ = c.writePacket(1, []byte{1})
+			_ = c.writePacket(2, []byte("\x03def\x00\x00\x00\x08GET_LOCK\x00\x0c\x3f\x00\x15\x00\x00\x00\x08\x81\x00\x00\x00\x00"))
+			_ = c.writePacket(3, []byte{packetEOF, 0, 0, 2, 0})
+			_ = c.writePacket(4, row)
+			_ = c.writePacket(5, []byte{packetEOF, 0, 0, 2, 0})
+		}
+		if s.dropAfterLock {
+			return
+		}
+		_, p, err = c.readPacket()
+		got.quit = err == nil && len(p) == 1 && p[0] == comQuit
+	}()
+	return done
+}
+
+// authenticate checks the answer auth to the scramble, switching plugins or asking for the password as
+// configured; seq is the sequence number of the last packet received
+func (s fakeMySQLServer) authenticate(t *testing.T, c *mysqlConn, seq *byte, auth []byte) bool {
+	plugin := s.plugin
+	if s.switchTo != "" {
+		plugin = s.switchTo
+		if err := c.writePacket(*seq+1, appendCString(appendCString([]byte{packetEOF}, plugin), string(fakeScramble))); err != nil {
+			return false
+		}
+		var err error
+		if *seq, auth, err = c.readPacket(); err != nil {
+			return false
+		}
+	}
+	want, _ := mysqlScramble(plugin, s.password, fakeScramble)
+	if !bytes.Equal(auth, want) {
+		return false
+	}
+	if plugin != cachingSHA2Plugin || s.password == "" {
+		return true
+	}
+	if !s.fullAuth {
+		*seq++
+		return c.writePacket(*seq, []byte{packetMoreData, cachingSHA2FastAuthOK}) == nil
+	}
+
+	// The connection is not secure, the client asks for the public key to encrypt the password with
+	if err := c.writePacket(*seq+1, []byte{packetMoreData, cachingSHA2FullAuth}); err != nil {
+		return false
+	}
+	*seq, auth, _ = c.readPacket()
+	if !bytes.Equal(auth, []byte{cachingSHA2RequestKey}) {
+		t.Errorf("public key request = %q", auth)
+		return false
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := c.writePacket(*seq+1, append([]byte{packetMoreData}, pemKey...)); err != nil {
+		return false
+	}
+	*seq, auth, _ = c.readPacket()
+	plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, auth, nil)
+	if err != nil {
+		return false
+	}
+	for i := range plain {
+		plain[i] ^= fakeScramble[i%len(fakeScramble)]
+	}
+	return string(plain) == s.password+"\x00"
+}
+
+// TestAcquireMySQL tests taking named locks from a MySQL server
+func TestAcquireMySQL(t *testing.T) {
+	const tryQuery = "SELECT GET_LOCK(_utf8mb4 X'6e696768746c795f7265706f7274', 0)"
+	tests := []struct {
+		name      string
+		server    fakeMySQLServer
+		password  string
+		wait      time.Duration
+		wantQuery string
+		wantCause string
+	}{
+		{name: "no password", server: fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "1"}, wantQuery: tryQuery},
+		{name: "held", server: fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "0"}, wantQuery: tryQuery, wantCause: CauseHeld},
+		{name: "wait", server: fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "1"}, wait: 5 * time.Second,
+			wantQuery: "SELECT GET_LOCK(_utf8mb4 X'6e696768746c795f7265706f7274', 5)"},
+		{name: "wait timeout", server: fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "0"}, wait: time.Second,
+			wantQuery: "SELECT GET_LOCK(_utf8mb4 X'6e696768746c795f7265706f7274', 1)", wantCause: CauseHeld},
+		{name: "sub-second wait", server: fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "1"}, wait: 100 * time.Millisecond,
+			wantQuery: "SELECT GET_LOCK(_utf8mb4 X'6e696768746c795f7265706f7274', 1)"},
+		{name: "fractional seconds", server: fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "1"}, wait: 1500 * time.Millisecond,
+			wantQuery: "SELECT GET_LOCK(_utf8mb4 X'6e696768746c795f7265706f7274', 2)"},
+		{name: "null", server: fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "NULL"}, wantQuery: tryQuery, wantCause: CauseQuery},
+		{name: "query error", server: fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "E:3058"}, wantQuery: tryQuery,
+			wantCause: CauseQuery},
+		{name: "native", server: fakeMySQLServer{plugin: nativePasswordPlugin, password: "secret", lockResult: "1"}, password: "secret",
+			wantQuery: tryQuery},
+		{name: "caching_sha2", server: fakeMySQLServer{plugin: cachingSHA2Plugin, password: "secret", lockResult: "1"}, password: "secret",
+			wantQuery: tryQuery},
+		{name: "caching_sha2 full", server: fakeMySQLServer{plugin: cachingSHA2Plugin, password: "secret", fullAuth: true, lockResult: "1"},
+			password: "secret", wantQuery: tryQuery},
+		{name: "switch", server: fakeMySQLServer{plugin: cachingSHA2Plugin, switchTo: nativePasswordPlugin, password: "secret", lockResult: "1"},
+			password: "secret", wantQuery: tryQuery},
+		{name: "wrong password", server: fakeMySQLServer{plugin: nativePasswordPlugin, password: "secret"}, password: "guess", wantCause: CauseAuth},
+		{name: "missing password", server: fakeMySQLServer{plugin: cachingSHA2Plugin, password: "secret"}, wantCause: CauseAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = listener.Close() }()
+			done := tt.server.serve(t, listener)
+
+			target := Target{Driver: DriverMySQL, Network: "tcp", Address: listener.Addr().String(), Host: "127.0.0.1", User: "cron",
+				Database: "app", Password: secret.Value(tt.password), SSLMode: SSLPrefer, ConnectTimeout: 5 * time.Second,
+				Name: "nightly_report"}
+			lock, err := target.Acquire(context.Background(), tt.wait)
+			var lockErr *Error
+			switch {
+			case tt.wantCause == "" && err != nil:
+				t.Fatalf("Acquire() error = %v", err)
+			case tt.wantCause != "" && (!errors.As(err, &lockErr) || lockErr.Cause != tt.wantCause):
+				t.Fatalf("Acquire() error = %v, want cause %s", err, tt.wantCause)
+			}
+			if lock != nil {
+				if err := lock.Release(); err != nil {
+					t.Errorf("Release() error = %v", err)
+				}
+			}
+
+			got := <-done
+			if got.user != "cron" || got.database != "app" {
+				t.Errorf("user = %q, database = %q", got.user, got.database)
+			}
+			if got.query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", got.query, tt.wantQuery)
+			}
+			if lock != nil && !got.quit {
+				t.Error("Expected the session to be quit by Release")
+			}
+		})
+	}
+}
+
+// TestAcquireMySQLRequireTLS tests that sslmode=require fails if the MySQL server does not support TLS
+func TestAcquireMySQLRequireTLS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	done := fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "1"}.serve(t, listener)
+
+	target := Target{Driver: DriverMySQL, Network: "tcp", Address: listener.Addr().String(), User: "cron", SSLMode: SSLRequire,
+		ConnectTimeout: 5 * time.Second, Name: "nightly_report"}
+	var lockErr *Error
+	if _, err := target.Acquire(context.Background(), 0); !errors.As(err, &lockErr) || lockErr.Cause != CauseTLS {
+		t.Errorf("Acquire() error = %v, want cause %s", err, CauseTLS)
+	}
+	<-done
+}
+
+// TestMySQLLockLost tests that a named lock whose connection is closed by the server is reported lost
+func TestMySQLLockLost(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	done := fakeMySQLServer{plugin: nativePasswordPlugin, lockResult: "1", dropAfterLock: true}.serve(t, listener)
+
+	target := Target{Driver: DriverMySQL, Network: "tcp", Address: listener.Addr().String(), User: "cron", SSLMode: SSLDisable,
+		ConnectTimeout: 5 * time.Second, Name: "nightly_report"}
+	lock, err := target.Acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	<-done
+	select {
+	case <-lock.Lost():
+		if lock.Err() == nil {
+			t.Error("Expected the reason the lock was lost")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the lock to be lost")
+	}
+	if err := lock.Release(); err != nil {
+		t.Errorf("Release() error = %v, want nil for a lost lock", err)
+	}
+}
@@ -0,0 +1,225 @@
+package pglock
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Causes of a lock that could not be acquired, or was lost while it was held
+const (
+	CauseHeld    = "held"
+	CauseConnect = "connect"
+	CauseTLS     = "tls"
+	CauseAuth    = "auth"
+	CauseQuery   = "query"
+	CauseLost    = "lost"
+)
+
+// lockNotAvailable is the SQLSTATE of a lock wait exceeding lock_timeout
+const lockNotAvailable = "55P03"
+
+// Error is the reason a lock could not be acquired
+type Error struct {
+	// Cause is one of the Cause constants
+	Cause string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("advisory lock (%s): %v", e.Cause, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// session is the database session holding a lock
+type session interface {
+	// wait reads the session until it ends, returning why
+	wait() error
+	// close ends the session, which releases its locks
+	close() error
+}
+
+// Lock is a session advisory lock, held as long as its connection stays open
+type Lock struct {
+	session  session
+	released atomic.Bool
+	lost     chan struct{}
+	done     chan struct{}
+	err      error
+}
+
+// Acquire connects to the database and takes the advisory lock of t, waiting up to wait for another
+// session to release it; with 0 it fails at once if the lock is held. Failures are returned as *Error.
+// MySQL waits in whole seconds, a shorter wait is rounded up.
+func (t Target) Acquire(ctx context.Context, wait time.Duration) (*Lock, error) {
+	password, err := t.Password.Get()
+	if err != nil {
+		return nil, &Error{Cause: CauseAuth, Err: err}
+	}
+	dialer := &net.Dialer{Timeout: t.ConnectTimeout}
+	raw, err := dialer.DialContext(ctx, t.Network, t.Address)
+	if err != nil {
+		return nil, &Error{Cause: CauseConnect, Err: err}
+	}
+	// Closing the connection interrupts the exchange if ctx is canceled
+	stop := context.AfterFunc(ctx, func() { _ = raw.Close() })
+	defer stop()
+	var s session
+	if t.Driver == DriverMySQL {
+		s, err = t.lockMySQL(raw, password, wait)
+	} else {
+		s, err = t.lockPostgres(raw, password, wait)
+	}
+	if err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
+
+	l := &Lock{session: s, lost: make(chan struct{}), done: make(chan struct{})}
+	go l.watch()
+	return l, nil
+}
+
+// lockPostgres starts a PostgreSQL session on raw and takes the advisory lock with it
+func (t Target) lockPostgres(raw net.Conn, password string, wait time.Duration) (session, error) {
+	c, err := t.connect(raw, password)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", t.Key)
+	if wait > 0 {
+		// lock_timeout is in milliseconds and 0 waits forever, a shorter wait is rounded up
+		timeout := max(1, (wait+time.Millisecond-1)/time.Millisecond)
+		sql = fmt.Sprintf("SET lock_timeout = %d; SELECT pg_advisory_lock(%d)", timeout, t.Key)
+	}
+	// The server gives up waiting by itself, the deadline only covers a server that stopped answering
+	if err := c.SetDeadline(time.Now().Add(wait + t.ConnectTimeout)); err != nil {
+		_ = c.Close()
+		return nil, &Error{Cause: CauseConnect, Err: err}
+	}
+	acquired, err := c.query(sql)
+	var serverErr *ServerError
+	switch {
+	case errors.As(err, &serverErr) && serverErr.Code == lockNotAvailable:
+		err = &Error{Cause: CauseHeld, Err: fmt.Errorf("held by another session for more than %v", wait)}
+	case err != nil:
+		err = &Error{Cause: CauseQuery, Err: err}
+	case acquired == "f":
+		err = &Error{Cause: CauseHeld, Err: errors.New("held by another session")}
+	case acquired != "t" && acquired != "":
+		// pg_advisory_lock returns void, an empty value
+		err = &Error{Cause: CauseQuery, Err: fmt.Errorf("unexpected result %q", acquired)}
+	}
+	if err == nil {
+		err = c.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect negotiates TLS as configured by SSLMode and starts the session
+func (t Target) connect(raw net.Conn, password string) (*conn, error) {
+	if err := raw.SetDeadline(time.Now().Add(t.ConnectTimeout)); err != nil {
+		return nil, &Error{Cause: CauseConnect, Err: err}
+	}
+	c := newConn(raw)
+	// Unix sockets are local, libpq does not use TLS on them either
+	if t.SSLMode != SSLDisable && t.Network == "tcp" {
+		accepted, err := c.requestTLS()
+		if err != nil {
+			return nil, &Error{Cause: CauseConnect, Err: err}
+		}
+		switch {
+		case accepted:
+			cfg, err := t.tlsConfig()
+			if err != nil {
+				return nil, &Error{Cause: CauseTLS, Err: err}
+			}
+			tlsConn := tls.Client(raw, cfg)
+			if err := tlsConn.Handshake(); err != nil {
+				return nil, &Error{Cause: CauseTLS, Err: err}
+			}
+			c = newConn(tlsConn)
+		case t.SSLMode != SSLPrefer:
+			return nil, &Error{Cause: CauseTLS, Err: errors.New("the server does not support TLS")}
+		}
+	}
+	if err := c.startup(t.User, t.Database, password); err != nil {
+		var authErr *authError
+		if errors.As(err, &authErr) {
+			return nil, &Error{Cause: CauseAuth, Err: authErr.err}
+		}
+		return nil, &Error{Cause: CauseConnect, Err: err}
+	}
+	return c, nil
+}
+
+// tlsConfig returns the TLS configuration of SSLMode: require encrypts without verifying the server,
+// as in libpq, verify-full verifies its certificate and host name
+func (t Target) tlsConfig() (*tls.Config, error) {
+	if t.SSLMode != SSLVerifyFull {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	cfg := &tls.Config{ServerName: t.Host}
+	if t.RootCert != "" {
+		pem, err := os.ReadFile(t.RootCert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", t.RootCert)
+		}
+	}
+	return cfg, nil
+}
+
+// watch reads the session until it ends, which releases the lock; unless Release ended it, the lock is lost
+func (l *Lock) watch() {
+	defer close(l.done)
+	err := l.session.wait()
+	if !l.released.Load() {
+		l.err = err
+		close(l.lost)
+	}
+}
+
+// Lost is closed if the connection holding the lock is closed before Release, e.g. by a restart of the
+// server; Err tells why
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err returns why the lock was lost, once Lost is closed
+func (l *Lock) Err() error {
+	return l.err
+}
+
+// Release ends the session holding the lock, which releases it
+func (l *Lock) Release() error {
+	if !l.released.CompareAndSwap(false, true) {
+		return nil
+	}
+	err := l.session.close()
+	<-l.done
+	select {
+	case <-l.lost:
+		// Already lost, the session is gone anyway
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,310 @@
+package pglock
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// fakeServer is a PostgreSQL server serving one session
+type fakeServer struct {
+	// auth is the authentication asked for: authOK, authCleartext, authMD5 or authSASL
+	auth     uint32
+	password string
+	// lockResult answers the lock query, an SQLSTATE starting with E: fails it
+	lockResult string
+	// dropAfterLock closes the connection right after the lock was taken
+	dropAfterLock bool
+}
+
+// received is what the fake server received
+type received struct {
+	params     map[string]string
+	authorized bool
+	query      string
+	terminated bool
+}
+
+// serve accepts one session on listener
+func (s fakeServer) serve(t *testing.T, listener net.Listener) <-chan received {
+	t.Helper()
+	done := make(chan received, 1)
+	go func() {
+		got := received{params: make(map[string]string)}
+		defer func() { done <- got }()
+		raw, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = raw.Close() }()
+		c := &conn{Conn: raw, r: bufio.NewReader(raw)}
+
+		body, err := readStartup(c)
+		if err != nil {
+			t.Errorf("read startup: %v", err)
+			return
+		}
+		if binary.BigEndian.Uint32(body) == sslRequestCode {
+			if _, err := raw.Write([]byte{'N'}); err != nil {
+				return
+			}
+			// Clients requiring TLS hang up
+			if body, err = readStartup(c); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Errorf("read startup: %v", err)
+				}
+				return
+			}
+		}
+		fields := strings.Split(strings.TrimRight(string(body[4:]), "\x00"), "\x00")
+		for i := 0; i+1 < len(fields); i += 2 {
+			got.params[fields[i]] = fields[i+1]
+		}
+		if got.authorized = s.authenticate(c, got.params["user"]); !got.authorized {
+			_ = c.send(msgError, []byte("SFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00"))
+			return
+		}
+		_ = c.send(msgAuthentication, binary.BigEndian.AppendUint32(nil, authOK))
+		_ = c.send(msgParameterStatus, []byte("server_version\x0017.0\x00"))
+		_ = c.send(msgReady, []byte{'I'})
+
+		kind, msg, err := c.receive()
+		if err != nil || kind != msgQuery {
+			t.Errorf("read query: %q %v", kind, err)
+			return
+		}
+		got.query = strings.TrimRight(string(msg), "\x00")
+		if code, failed := strings.CutPrefix(s.lockResult, "E:"); failed {
+			_ = c.send(msgError, []byte("SERROR\x00C"+code+"\x00Mcanceling statement due to lock timeout\x00\x00"))
+		} else {
+			_ = c.send(msgRowDescription, []byte{0, 1})
+			row := binary.BigEndian.AppendUint16(nil, 1)
+			row = binary.BigEndian.AppendUint32(row, uint32(len(s.lockResult)))
+			_ = c.send(msgDataRow, append(row, s.lockResult...))
+			_ = c.send(msgCommandComplete, []byte("SELECT 1\x00"))
+		}
+		_ = c.send(msgReady, []byte{'I'})
+		if s.dropAfterLock {
+			return
+		}
+		kind, _, err = c.receive()
+		got.terminated = err == nil && kind == msgTerminate
+	}()
+	return done
+}
+
+// readStartup reads an untyped startup message
+func readStartup(c *conn) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(c.r, length[:]); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(length[:])-4)
+	_, err := io.ReadFull(c.r, body)
+	return body, err
+}
+
+// authenticate asks the client for its password as configured and tells whether it is right
+func (s fakeServer) authenticate(c *conn, user string) bool {
+	switch s.auth {
+	case authCleartext:
+		_ = c.send(msgAuthentication, binary.BigEndian.AppendUint32(nil, authCleartext))
+		_, msg, err := c.receive()
+		return err == nil && string(msg) == s.password+"\x00"
+	case authMD5:
+		salt := []byte{1, 2, 3, 4}
+		_ = c.send(msgAuthentication, append(binary.BigEndian.AppendUint32(nil, authMD5), salt...))
+		_, msg, err := c.receive()
+		inner := md5.Sum([]byte(s.password + user))
+		outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+		return err == nil && string(msg) == "md5"+hex.EncodeToString(outer[:])+"\x00"
+	case authSASL:
+		return s.scram(c)
+	default:
+		return true
+	}
+}
+
+// scram runs the server side of SCRAM-SHA-256
+func (s fakeServer) scram(c *conn) bool {
+	_ = c.send(msgAuthentication, append(binary.BigEndian.AppendUint32(nil, authSASL), "SCRAM-SHA-256-PLUS\x00SCRAM-SHA-256\x00\x00"...))
+	_, msg, err := c.receive()
+	if err != nil {
+		return false
+	}
+	mechanism, rest, _ := strings.Cut(string(msg), "\x00")
+	if mechanism != scramMechanism || len(rest) < 4 {
+		return false
+	}
+	clientFirstBare := strings.TrimPrefix(rest[4:], "n,,")
+	salt, iterations := []byte("pepper"), 4096
+	serverFirst := "r=" + scramAttributes(clientFirstBare)["r"] + "server-nonce,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+	_ = c.send(msgAuthentication, append(binary.BigEndian.AppendUint32(nil, authSASLContinue), serverFirst...))
+
+	_, msg, err = c.receive()
+	if err != nil {
+		return false
+	}
+	clientFinal := string(msg)
+	withoutProof, proof, _ := strings.Cut(clientFinal, ",p=")
+	authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+	saltedPassword, _ := pbkdf2.Key(sha256.New, s.password, salt, iterations, sha256.Size)
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	want := hmacSHA256(storedKey[:], authMessage)
+	for i := range want {
+		want[i] ^= clientKey[i]
+	}
+	if proof != base64.StdEncoding.EncodeToString(want) {
+		return false
+	}
+	serverFinal := "v=" + base64.StdEncoding.EncodeToString(hmacSHA256(hmacSHA256(saltedPassword, "Server Key"), authMessage))
+	_ = c.send(msgAuthentication, append(binary.BigEndian.AppendUint32(nil, authSASLFinal), serverFinal...))
+	return true
+}
+
+// TestAcquire tests taking advisory locks from a server
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name      string
+		server    fakeServer
+		password  string
+		wait      time.Duration
+		wantQuery string
+		wantCause string
+	}{
+		{name: "trust", server: fakeServer{lockResult: "t"}, wantQuery: "SELECT pg_try_advisory_lock(42)"},
+		{name: "held", server: fakeServer{lockResult: "f"}, wantQuery: "SELECT pg_try_advisory_lock(42)", wantCause: CauseHeld},
+		{name: "wait", server: fakeServer{lockResult: ""}, wait: 5 * time.Second,
+			wantQuery: "SET lock_timeout = 5000; SELECT pg_advisory_lock(42)"},
+		{name: "wait timeout", server: fakeServer{lockResult: "E:55P03"}, wait: time.Second,
+			wantQuery: "SET lock_timeout = 1000; SELECT pg_advisory_lock(42)", wantCause: CauseHeld},
+		{name: "sub-millisecond wait", server: fakeServer{lockResult: ""}, wait: 100 * time.Microsecond,
+			wantQuery: "SET lock_timeout = 1; SELECT pg_advisory_lock(42)"},
+		{name: "fractional milliseconds", server: fakeServer{lockResult: ""}, wait: 1500 * time.Microsecond,
+			wantQuery: "SET lock_timeout = 2; SELECT pg_advisory_lock(42)"},
+		{name: "query error", server: fakeServer{lockResult: "E:42883"}, wantQuery: "SELECT pg_try_advisory_lock(42)", wantCause: CauseQuery},
+		{name: "cleartext", server: fakeServer{auth: authCleartext, password: "secret", lockResult: "t"}, password: "secret",
+			wantQuery: "SELECT pg_try_advisory_lock(42)"},
+		{name: "md5", server: fakeServer{auth: authMD5, password: "secret", lockResult: "t"}, password: "secret",
+			wantQuery: "SELECT pg_try_advisory_lock(42)"},
+		{name: "scram", server: fakeServer{auth: authSASL, password: "secret", lockResult: "t"}, password: "secret",
+			wantQuery: "SELECT pg_try_advisory_lock(42)"},
+		{name: "wrong password", server: fakeServer{auth: authMD5, password: "secret"}, password: "guess", wantCause: CauseAuth},
+		{name: "wrong scram password", server: fakeServer{auth: authSASL, password: "secret"}, password: "guess", wantCause: CauseAuth},
+		{name: "no password", server: fakeServer{auth: authSASL, password: "secret"}, wantCause: CauseAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = listener.Close() }()
+			done := tt.server.serve(t, listener)
+
+			target := Target{Network: "tcp", Address: listener.Addr().String(), Host: "127.0.0.1", User: "cron", Database: "app",
+				Password: secret.Value(tt.password), SSLMode: SSLPrefer, ConnectTimeout: 5 * time.Second, Key: 42}
+			lock, err := target.Acquire(context.Background(), tt.wait)
+			var lockErr *Error
+			switch {
+			case tt.wantCause == "" && err != nil:
+				t.Fatalf("Acquire() error = %v", err)
+			case tt.wantCause != "" && (!errors.As(err, &lockErr) || lockErr.Cause != tt.wantCause):
+				t.Fatalf("Acquire() error = %v, want cause %s", err, tt.wantCause)
+			}
+			if lock != nil {
+				if err := lock.Release(); err != nil {
+					t.Errorf("Release() error = %v", err)
+				}
+			}
+
+			got := <-done
+			if got.params["user"] != "cron" || got.params["database"] != "app" || got.params["application_name"] != "cronmgr" {
+				t.Errorf("startup parameters = %v", got.params)
+			}
+			if got.query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", got.query, tt.wantQuery)
+			}
+			if lock != nil && !got.terminated {
+				t.Error("Expected the session to be terminated by Release")
+			}
+		})
+	}
+}
+
+// TestAcquireRequireTLS tests that sslmode=require fails if the server does not support TLS
+func TestAcquireRequireTLS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	done := fakeServer{lockResult: "t"}.serve(t, listener)
+
+	target := Target{Network: "tcp", Address: listener.Addr().String(), User: "cron", Database: "app", SSLMode: SSLRequire,
+		ConnectTimeout: 5 * time.Second, Key: 42}
+	var lockErr *Error
+	if _, err := target.Acquire(context.Background(), 0); !errors.As(err, &lockErr) || lockErr.Cause != CauseTLS {
+		t.Errorf("Acquire() error = %v, want cause %s", err, CauseTLS)
+	}
+	<-done
+}
+
+// TestAcquireConnectError tests that an unreachable server is a connect failure
+func TestAcquireConnectError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	target := Target{Network: "tcp", Address: address, SSLMode: SSLDisable, ConnectTimeout: time.Second, Key: 42}
+	var lockErr *Error
+	if _, err := target.Acquire(context.Background(), 0); !errors.As(err, &lockErr) || lockErr.Cause != CauseConnect {
+		t.Errorf("Acquire() error = %v, want cause %s", err, CauseConnect)
+	}
+}
+
+// TestLockLost tests that a lock whose connection is closed by the server is reported lost
+func TestLockLost(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	done := fakeServer{lockResult: "t", dropAfterLock: true}.serve(t, listener)
+
+	target := Target{Network: "tcp", Address: listener.Addr().String(), User: "cron", Database: "app", SSLMode: SSLDisable,
+		ConnectTimeout: 5 * time.Second, Key: 42}
+	lock, err := target.Acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	<-done
+	select {
+	case <-lock.Lost():
+		if lock.Err() == nil {
+			t.Error("Expected the reason the lock was lost")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the lock to be lost")
+	}
+	if err := lock.Release(); err != nil {
+		t.Errorf("Release() error = %v, want nil for a lost lock", err)
+	}
+}
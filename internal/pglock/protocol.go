@@ -0,0 +1,378 @@
+package pglock
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Codes of the frontend/backend protocol 3.0 of PostgreSQL
+const (
+	protocolVersion = 3 << 16
+	sslRequestCode  = 80877103
+
+	// Message types sent by the server
+	msgAuthentication  = 'R'
+	msgError           = 'E'
+	msgNotice          = 'N'
+	msgParameterStatus = 'S'
+	msgBackendKey      = 'K'
+	msgReady           = 'Z'
+	msgRowDescription  = 'T'
+	msgDataRow         = 'D'
+	msgCommandComplete = 'C'
+	msgEmptyQuery      = 'I'
+	msgNotification    = 'A'
+
+	// Message types sent by cronmgr
+	msgPassword  = 'p'
+	msgQuery     = 'Q'
+	msgTerminate = 'X'
+
+	// Authentication requests
+	authOK           = 0
+	authCleartext    = 3
+	authMD5          = 5
+	authSASL         = 10
+	authSASLContinue = 11
+	authSASLFinal    = 12
+)
+
+// scramMechanism is the only SASL mechanism supported, without channel binding
+const scramMechanism = "SCRAM-SHA-256"
+
+// maxMessageSize bounds the messages read from the server, the lock only exchanges small ones
+const maxMessageSize = 1 << 20
+
+// ServerError is an error reported by the server
+type ServerError struct {
+	// Code is the SQLSTATE of the error, e.g. 55P03 for lock_not_available
+	Code string
+	// Number is the error number of MySQL, e.g. 1045 for ER_ACCESS_DENIED_ERROR, 0 with PostgreSQL
+	Number  uint16
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	if e.Number != 0 {
+		return fmt.Sprintf("%s (error %d, SQLSTATE %s)", e.Message, e.Number, e.Code)
+	}
+	return e.Message + " (SQLSTATE " + e.Code + ")"
+}
+
+// conn is a connection speaking the protocol of PostgreSQL
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// newConn wraps c
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c, r: bufio.NewReader(c)}
+}
+
+// send writes a message of type kind, or an untyped startup message if kind is 0
+func (c *conn) send(kind byte, body []byte) error {
+	var msg []byte
+	if kind != 0 {
+		msg = append(msg, kind)
+	}
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(body)+4))
+	_, err := c.Write(append(msg, body...))
+	return err
+}
+
+// receive reads a message, returning its type and body
+func (c *conn) receive() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > maxMessageSize {
+		return 0, nil, fmt.Errorf("invalid message length %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// requestTLS asks the server for TLS, which it accepts by answering S
+func (c *conn) requestTLS() (bool, error) {
+	body := binary.BigEndian.AppendUint32(nil, sslRequestCode)
+	if err := c.send(0, body); err != nil {
+		return false, err
+	}
+	answer, err := c.r.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	if c.r.Buffered() > 0 {
+		// Anything sent before the TLS handshake could have been injected
+		return false, errors.New("unexpected data after the TLS answer")
+	}
+	return answer == 'S', nil
+}
+
+// startup starts the session of user on database, authenticating with password if the server asks for it.
+// Authentication failures are returned as authError.
+func (c *conn) startup(user, database, password string) error {
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, protocolVersion)
+	for _, param := range [][2]string{{"user", user}, {"database", database}, {"application_name", "cronmgr"}} {
+		body = appendCString(appendCString(body, param[0]), param[1])
+	}
+	if err := c.send(0, append(body, 0)); err != nil {
+		return err
+	}
+	for {
+		kind, msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case msgAuthentication:
+			if err := c.authenticate(msg, user, password); err != nil {
+				return err
+			}
+		case msgError:
+			err := parseError(msg)
+			if strings.HasPrefix(err.Code, "28") {
+				// Class 28 is invalid authorization
+				return &authError{err}
+			}
+			return err
+		case msgReady:
+			return nil
+		case msgParameterStatus, msgBackendKey, msgNotice:
+		default:
+			return fmt.Errorf("unexpected message %q during startup", kind)
+		}
+	}
+}
+
+// authError is an authentication failure
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string { return e.err.Error() }
+
+func (e *authError) Unwrap() error { return e.err }
+
+// authenticate answers an authentication request of the server
+func (c *conn) authenticate(msg []byte, user, password string) error {
+	if len(msg) < 4 {
+		return errors.New("malformed authentication request")
+	}
+	code, data := binary.BigEndian.Uint32(msg), msg[4:]
+	if code == authOK {
+		return nil
+	}
+	if password == "" {
+		return &authError{fmt.Errorf("the server asks for a password, set it in the DSN or %s", PasswordEnv)}
+	}
+	switch code {
+	case authCleartext:
+		return c.send(msgPassword, appendCString(nil, password))
+	case authMD5:
+		if len(data) != 4 {
+			return errors.New("malformed MD5 authentication request")
+		}
+		inner := md5.Sum([]byte(password + user))
+		outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), data...))
+		return c.send(msgPassword, appendCString(nil, "md5"+hex.EncodeToString(outer[:])))
+	case authSASL:
+		mechanisms := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+		if !slices.Contains(mechanisms, scramMechanism) {
+			return &authError{fmt.Errorf("unsupported SASL mechanisms %s", strings.Join(mechanisms, ", "))}
+		}
+		return c.scram(password)
+	default:
+		return &authError{fmt.Errorf("unsupported authentication method %d", code)}
+	}
+}
+
+// scram authenticates with SCRAM-SHA-256 (RFC 5802, RFC 7677), verifying the signature of the server
+func (c *conn) scram(password string) error {
+	random := make([]byte, 18)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	clientNonce := base64.StdEncoding.EncodeToString(random)
+	// The user name of the startup message is used, SCRAM leaves it empty
+	clientFirstBare := "n=,r=" + clientNonce
+	initial := appendCString(nil, scramMechanism)
+	initial = binary.BigEndian.AppendUint32(initial, uint32(len(clientFirstBare)+3))
+	if err := c.send(msgPassword, append(initial, "n,,"+clientFirstBare...)); err != nil {
+		return err
+	}
+
+	serverFirst, err := c.saslMessage(authSASLContinue)
+	if err != nil {
+		return err
+	}
+	attrs := scramAttributes(serverFirst)
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return fmt.Errorf("invalid SCRAM salt: %w", err)
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations <= 0 {
+		return fmt.Errorf("invalid SCRAM iteration count %q", attrs["i"])
+	}
+	if !strings.HasPrefix(attrs["r"], clientNonce) || len(attrs["r"]) == len(clientNonce) {
+		return errors.New("invalid SCRAM nonce")
+	}
+
+	clientFinal := "c=biws,r=" + attrs["r"]
+	authMessage := clientFirstBare + "," + serverFirst + "," + clientFinal
+	saltedPassword, err := pbkdf2.Key(sha256.New, password, salt, iterations, sha256.Size)
+	if err != nil {
+		return err
+	}
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	proof := hmacSHA256(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	clientFinal += ",p=" + base64.StdEncoding.EncodeToString(proof)
+	if err := c.send(msgPassword, []byte(clientFinal)); err != nil {
+		return err
+	}
+
+	serverFinal, err := c.saslMessage(authSASLFinal)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(scramAttributes(serverFinal)["v"])
+	if err != nil || !hmac.Equal(signature, hmacSHA256(hmacSHA256(saltedPassword, "Server Key"), authMessage)) {
+		return errors.New("invalid SCRAM server signature")
+	}
+	return nil
+}
+
+// saslMessage reads the SASL authentication request code and returns its data
+func (c *conn) saslMessage(code uint32) (string, error) {
+	kind, msg, err := c.receive()
+	if err != nil {
+		return "", err
+	}
+	if kind == msgError {
+		return "", &authError{parseError(msg)}
+	}
+	if kind != msgAuthentication || len(msg) < 4 || binary.BigEndian.Uint32(msg) != code {
+		return "", fmt.Errorf("unexpected message %q during SCRAM authentication", kind)
+	}
+	return string(msg[4:]), nil
+}
+
+// query runs sql with the simple query protocol and returns the first column of the first row,
+// empty if there is none
+func (c *conn) query(sql string) (string, error) {
+	if err := c.send(msgQuery, appendCString(nil, sql)); err != nil {
+		return "", err
+	}
+	var value string
+	var queryErr error
+	found := false
+	for {
+		kind, msg, err := c.receive()
+		if err != nil {
+			return "", err
+		}
+		switch kind {
+		case msgDataRow:
+			if found || len(msg) < 6 || binary.BigEndian.Uint16(msg) == 0 {
+				continue
+			}
+			found = true
+			if length := int32(binary.BigEndian.Uint32(msg[2:])); length > 0 && int(length) <= len(msg)-6 {
+				value = string(msg[6 : 6+length])
+			}
+		case msgError:
+			queryErr = parseError(msg)
+		case msgReady:
+			return value, queryErr
+		case msgRowDescription, msgCommandComplete, msgEmptyQuery, msgNotice, msgParameterStatus:
+		default:
+			return "", fmt.Errorf("unexpected message %q during query", kind)
+		}
+	}
+}
+
+// wait reads the session until the connection is closed
+func (c *conn) wait() error {
+	for {
+		kind, msg, err := c.receive()
+		if kind == msgError {
+			// e.g. the session was terminated by an administrator, the connection is closed next
+			err = parseError(msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// close terminates the session, which releases its advisory locks
+func (c *conn) close() error {
+	return errors.Join(c.send(msgTerminate, nil), c.Close())
+}
+
+// parseError parses the fields of an ErrorResponse message
+func parseError(msg []byte) *ServerError {
+	err := &ServerError{}
+	for len(msg) > 1 {
+		field := msg[0]
+		value, rest, _ := bytes.Cut(msg[1:], []byte{0})
+		switch field {
+		case 'C':
+			err.Code = string(value)
+		case 'M':
+			err.Message = string(value)
+		}
+		msg = rest
+	}
+	return err
+}
+
+// scramAttributes parses the comma separated attributes of a SCRAM message
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(msg, ",") {
+		if key, value, ok := strings.Cut(attr, "="); ok {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of msg with key
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// appendCString appends s terminated by a null byte
+func appendCString(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
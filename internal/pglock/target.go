@@ -0,0 +1,197 @@
+package pglock
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// Environment variables of libpq read when the DSN does not set the user, password or sslmode
+const (
+	UserEnv     = "PGUSER"
+	PasswordEnv = "PGPASSWORD"
+	SSLModeEnv  = "PGSSLMODE"
+)
+
+// MySQLPasswordEnv is the environment variable of the mysql client read when the DSN does not set the password
+const MySQLPasswordEnv = "MYSQL_PWD"
+
+// Databases holding the locks
+const (
+	// DriverPostgres takes a session advisory lock with pg_advisory_lock
+	DriverPostgres = "postgres"
+	// DriverMySQL takes a named lock with GET_LOCK
+	DriverMySQL = "mysql"
+)
+
+// Defaults of the connection
+const (
+	DefaultPort           = "5432"
+	DefaultMySQLPort      = "3306"
+	DefaultConnectTimeout = 10 * time.Second
+)
+
+// maxMySQLLockName is the longest name GET_LOCK accepts
+const maxMySQLLockName = 64
+
+// SSL modes of libpq that are supported
+const (
+	SSLDisable    = "disable"
+	SSLPrefer     = "prefer"
+	SSLRequire    = "require"
+	SSLVerifyFull = "verify-full"
+)
+
+// Target is the advisory lock given to --pg-advisory-lock as "DSN KEY", e.g.
+// "postgres://cron@db.example.com/app?sslmode=verify-full nightly_report" or
+// "mysql://cron@db.example.com/app nightly_report"
+type Target struct {
+	// Driver is DriverPostgres or DriverMySQL
+	Driver string
+	// Network is tcp, or unix for a socket given as host
+	Network string
+	// Address is the host and port, or the path of the unix socket
+	Address string
+	// Host is the server name verified with sslmode=verify-full
+	Host     string
+	User     string
+	Database string
+	// Password is sent if the server asks for one, nil if neither the DSN nor PGPASSWORD, or MYSQL_PWD, set it
+	Password *secret.Secret
+	// SSLMode is disable, prefer, require or verify-full
+	SSLMode string
+	// RootCert is the file of the certificate authorities verifying the server, empty for the system roots
+	RootCert string
+	// ConnectTimeout bounds the connection and authentication
+	ConnectTimeout time.Duration
+	// Key is the key of a PostgreSQL lock, Name the key as given and the name of a MySQL lock
+	Key  int64
+	Name string
+}
+
+// Parse parses "DSN KEY". The DSN is a postgres:// or mysql:// URL accepting the sslmode, sslrootcert,
+// connect_timeout, host and port parameters of libpq. A host starting with / is the directory of the unix
+// socket of PostgreSQL, or the unix socket of MySQL. KEY is the bigint key of a PostgreSQL lock, any other
+// string is hashed into one, and the name of a MySQL lock.
+func Parse(value string) (Target, error) {
+	value = strings.TrimSpace(value)
+	i := strings.LastIndexAny(value, " \t")
+	if i < 0 {
+		return Target{}, fmt.Errorf("expected \"DSN KEY\", got %q", value)
+	}
+	dsn, name := strings.TrimSpace(value[:i]), value[i+1:]
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return Target{}, fmt.Errorf("invalid DSN: %w", err)
+	}
+	t := Target{Network: "tcp", Host: u.Hostname(), ConnectTimeout: DefaultConnectTimeout, Name: name}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		t.Driver, t.SSLMode = DriverPostgres, os.Getenv(SSLModeEnv)
+	case "mysql":
+		t.Driver = DriverMySQL
+	default:
+		return Target{}, fmt.Errorf("invalid DSN %q, expected postgres:// or mysql://", u.Redacted())
+	}
+	port := u.Port()
+	for param, values := range u.Query() {
+		v := values[len(values)-1]
+		switch param {
+		case "sslmode":
+			t.SSLMode = v
+		case "sslrootcert":
+			t.RootCert = v
+		case "host":
+			t.Host = v
+		case "port":
+			port = v
+		case "connect_timeout":
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				return Target{}, fmt.Errorf("invalid connect_timeout %q", v)
+			}
+			t.ConnectTimeout = time.Duration(seconds) * time.Second
+		default:
+			return Target{}, fmt.Errorf("unsupported DSN parameter %q", param)
+		}
+	}
+	switch t.SSLMode {
+	case "":
+		t.SSLMode = SSLPrefer
+	case SSLDisable, SSLPrefer, SSLRequire, SSLVerifyFull:
+	default:
+		return Target{}, fmt.Errorf("unsupported sslmode %q, expected disable, prefer, require or verify-full", t.SSLMode)
+	}
+	if t.Host == "" {
+		t.Host = "localhost"
+	}
+	if port == "" {
+		port = DefaultPort
+		if t.Driver == DriverMySQL {
+			port = DefaultMySQLPort
+		}
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return Target{}, fmt.Errorf("invalid port %q", port)
+	}
+	switch {
+	case strings.HasPrefix(t.Host, "/") && t.Driver == DriverMySQL:
+		t.Network, t.Address = "unix", t.Host
+	case strings.HasPrefix(t.Host, "/"):
+		t.Network, t.Address = "unix", path.Join(t.Host, ".s.PGSQL."+port)
+	default:
+		t.Address = net.JoinHostPort(t.Host, port)
+	}
+
+	t.User = u.User.Username()
+	if t.User == "" && t.Driver == DriverPostgres {
+		t.User = os.Getenv(UserEnv)
+	}
+	if t.User == "" {
+		current, err := user.Current()
+		if err != nil {
+			return Target{}, fmt.Errorf("no user in DSN: %w", err)
+		}
+		t.User = current.Username
+	}
+	if password, ok := u.User.Password(); ok {
+		t.Password = secret.Value(password)
+	} else if t.Driver == DriverMySQL {
+		t.Password = secret.Lookup("", MySQLPasswordEnv)
+	} else {
+		t.Password = secret.Lookup("", PasswordEnv)
+	}
+	t.Database = strings.TrimPrefix(u.Path, "/")
+
+	if t.Driver == DriverMySQL {
+		// MySQL sessions need no database, and lock names are strings
+		if utf8.RuneCountInString(name) > maxMySQLLockName {
+			return Target{}, fmt.Errorf("lock name %q is longer than %d characters", name, maxMySQLLockName)
+		}
+		return t, nil
+	}
+	if t.Database == "" {
+		t.Database = t.User
+	}
+	if t.Key, err = strconv.ParseInt(name, 10, 64); err != nil {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(name))
+		t.Key = int64(h.Sum64())
+	}
+	return t, nil
+}
+
+// String returns the database and key of the lock, without the password
+func (t Target) String() string {
+	return t.User + "@" + t.Address + "/" + t.Database + " " + t.Name
+}
@@ -0,0 +1,48 @@
+package precheck
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FileCheck passes while a file exists and was modified recently, e.g. the input a processing job expects
+// to have arrived since its previous run
+type FileCheck struct {
+	// Path is the required file
+	Path string
+	// MaxAge is the maximum age of its modification time, 0 only requires it to exist
+	MaxAge time.Duration
+	// Now returns the current time, defaults to time.Now
+	Now func() time.Time
+}
+
+// Reason returns "stale_input"
+func (c FileCheck) Reason() string {
+	return "stale_input"
+}
+
+// Ready reports whether the file exists and is not older than MaxAge. A file that cannot be read is not
+// ready, the job could not process it either.
+func (c FileCheck) Ready() (bool, string, error) {
+	info, err := os.Stat(c.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Sprintf("%s does not exist", c.Path), nil
+	}
+	if err != nil {
+		return false, err.Error(), nil
+	}
+	if c.MaxAge <= 0 {
+		return true, "", nil
+	}
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	if age := now().Sub(info.ModTime()); age > c.MaxAge {
+		return false, fmt.Sprintf("%s was modified %v ago, more than %v", c.Path, age.Truncate(time.Second), c.MaxAge), nil
+	}
+	return true, "", nil
+}
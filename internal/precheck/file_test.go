@@ -0,0 +1,48 @@
+package precheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestFileCheck tests the check of a required file by its existence and age
+func TestFileCheck(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "export.csv")
+	if err := os.WriteFile(path, []byte("id\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, now.Add(-3*time.Hour), now.Add(-3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		maxAge    time.Duration
+		wantReady bool
+	}{
+		{name: "fresh", path: path, maxAge: 4 * time.Hour, wantReady: true},
+		{name: "stale", path: path, maxAge: 2 * time.Hour},
+		{name: "any age", path: path, wantReady: true},
+		{name: "missing", path: path + ".missing", maxAge: 4 * time.Hour},
+		{name: "missing without age", path: path + ".missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := FileCheck{Path: tt.path, MaxAge: tt.maxAge, Now: func() time.Time { return now }}
+			ready, detail, err := check.Ready()
+			if err != nil {
+				t.Fatalf("Ready() error = %v", err)
+			}
+			if ready != tt.wantReady {
+				t.Errorf("Ready() = %v (%s), want %v", ready, detail, tt.wantReady)
+			}
+			if !ready && detail == "" {
+				t.Error("Expected a detail when the file is not ready")
+			}
+		})
+	}
+}
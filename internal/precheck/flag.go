@@ -0,0 +1,129 @@
+package precheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// FlagTokenEnv is the environment variable with the token authenticating the requests to the feature flag endpoint
+const FlagTokenEnv = "CRONMGR_FEATURE_FLAG_TOKEN"
+
+// flagTimeout bounds a request to the feature flag endpoint, a slow service must not hold the job
+const flagTimeout = 5 * time.Second
+
+// FlagCheck passes while a feature flag served by an HTTP JSON endpoint is on, so jobs can be disabled
+// remotely, e.g. during an incident
+type FlagCheck struct {
+	// URL is the endpoint returning the flag as JSON
+	URL string
+	// Flag is the key of the flag in the JSON object returned by URL, empty if the whole document is the flag
+	Flag string
+	// Token is sent as a bearer token if it is not empty
+	Token *secret.Secret
+	// Client sends the requests, nil uses a client with a short timeout
+	Client *http.Client
+}
+
+// Reason returns "feature_flag"
+func (c FlagCheck) Reason() string {
+	return "feature_flag"
+}
+
+// Ready reports whether the flag is on
+func (c FlagCheck) Ready() (bool, string, error) {
+	content, err := c.fetch()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to read feature flag: %w", err)
+	}
+	on, err := parseFlag(content, c.Flag)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to read feature flag: %w", err)
+	}
+	if !on {
+		return false, fmt.Sprintf("feature flag %s is off", c.name()), nil
+	}
+	return true, "", nil
+}
+
+// name describes the flag in messages
+func (c FlagCheck) name() string {
+	if c.Flag == "" {
+		return c.URL
+	}
+	return c.Flag
+}
+
+// fetch returns the body of the flag endpoint
+func (c FlagCheck) fetch() ([]byte, error) {
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: flagTimeout}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flagTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	token, err := c.Token.Get()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+	return content, nil
+}
+
+// parseFlag returns the value of the flag key in the JSON document content, or of the document itself if key
+// is empty. A flag is a boolean, or an object with a boolean "enabled" or "value" field as returned by
+// feature flag services and their relay proxies.
+func parseFlag(content []byte, key string) (bool, error) {
+	var value any
+	if err := json.Unmarshal(content, &value); err != nil {
+		return false, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if key != "" {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return false, fmt.Errorf("expected an object with the flag %s", key)
+		}
+		if value, ok = object[key]; !ok {
+			return false, fmt.Errorf("flag %s not found", key)
+		}
+	}
+	if object, ok := value.(map[string]any); ok {
+		for _, field := range []string{"enabled", "value"} {
+			if nested, ok := object[field]; ok {
+				value = nested
+				break
+			}
+		}
+	}
+	on, ok := value.(bool)
+	if !ok {
+		return false, errors.New("the flag is not a boolean")
+	}
+	return on, nil
+}
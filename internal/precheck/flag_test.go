@@ -0,0 +1,77 @@
+package precheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/secret"
+)
+
+// TestParseFlag tests reading a flag from the documents returned by flag endpoints
+func TestParseFlag(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		key       string
+		want      bool
+		wantError bool
+	}{
+		{name: "document", content: "true", want: true},
+		{name: "key", content: `{"backup": false, "report": true}`, key: "report", want: true},
+		{name: "enabled field", content: `{"backup": {"enabled": false}}`, key: "backup", want: false},
+		{name: "value field", content: `{"value": true, "variationId": "a1"}`, want: true},
+		{name: "missing key", content: `{"report": true}`, key: "backup", wantError: true},
+		{name: "not a boolean", content: `{"backup": "on"}`, key: "backup", wantError: true},
+		{name: "invalid JSON", content: `{`, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFlag([]byte(tt.content), tt.key)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("parseFlag() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("parseFlag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFlagCheck tests the check against an HTTP endpoint
+func TestFlagCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantReady bool
+		wantError bool
+	}{
+		{name: "on", status: http.StatusOK, body: `{"backup": true}`, wantReady: true},
+		{name: "off", status: http.StatusOK, body: `{"backup": false}`},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAuthorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuthorization = r.Header.Get("Authorization")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			check := FlagCheck{URL: server.URL, Flag: "backup", Token: secret.Value("token")}
+			ready, detail, err := check.Ready()
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Ready() error = %v, wantError %v", err, tt.wantError)
+			}
+			if ready != tt.wantReady {
+				t.Errorf("Ready() = %v (%s), want %v", ready, detail, tt.wantReady)
+			}
+			if gotAuthorization != "Bearer token" {
+				t.Errorf("Authorization = %q, want the bearer token", gotAuthorization)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package precheck
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Host reports the resource usage of the host
+type Host interface {
+	// LoadAverage returns the 1-minute load average
+	LoadAverage() (float64, error)
+	// FreeMemory returns the memory available to new processes in bytes
+	FreeMemory() (uint64, error)
+}
+
+// parseLoadAvg parses the 1-minute load average from the content of /proc/loadavg
+func parseLoadAvg(content string) (float64, error) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// parseMemAvailable parses MemAvailable in bytes from the content of /proc/meminfo
+func parseMemAvailable(content string) (uint64, error) {
+	return parseMemInfo(content, "MemAvailable")
+}
+
+// parseMemInfo parses the field of /proc/meminfo in bytes from its content
+func parseMemInfo(content, field string) (uint64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != field+":" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", field, fields[1], err)
+		}
+		return kb * 1024, nil
+	}
+	return 0, fmt.Errorf("%s not found", field)
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package precheck
+
+import (
+	"os"
+)
+
+// procHost reads the resource usage from /proc
+type procHost struct{}
+
+// NewHost returns the Host of the running system
+func NewHost() Host {
+	return procHost{}
+}
+
+// LoadAverage returns the 1-minute load average from /proc/loadavg
+func (procHost) LoadAverage() (float64, error) {
+	content, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	return parseLoadAvg(string(content))
+}
+
+// FreeMemory returns MemAvailable from /proc/meminfo
+func (procHost) FreeMemory() (uint64, error) {
+	content, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	return parseMemAvailable(string(content))
+}
+
+// TotalMemory returns MemTotal from /proc/meminfo, the memory of the host
+func TotalMemory() (uint64, error) {
+	content, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	return parseMemInfo(string(content), "MemTotal")
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package precheck
+
+import (
+	"errors"
+)
+
+// unsupportedHost is the Host of platforms without /proc, it cannot report resource usage
+type unsupportedHost struct{}
+
+// NewHost returns the Host of the running system
+func NewHost() Host {
+	return unsupportedHost{}
+}
+
+// LoadAverage returns errors.ErrUnsupported
+func (unsupportedHost) LoadAverage() (float64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// FreeMemory returns errors.ErrUnsupported
+func (unsupportedHost) FreeMemory() (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// TotalMemory returns errors.ErrUnsupported
+func TotalMemory() (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
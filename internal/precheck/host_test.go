@@ -0,0 +1,36 @@
+package precheck
+
+import (
+	"testing"
+)
+
+// TestParseLoadAvg tests the parseLoadAvg function
+func TestParseLoadAvg(t *testing.T) {
+	load, err := parseLoadAvg("8.42 6.10 4.00 3/512 12345\n")
+	if err != nil || load != 8.42 {
+		t.Errorf("parseLoadAvg() = %v, %v, want 8.42, nil", load, err)
+	}
+	if _, err := parseLoadAvg(""); err == nil {
+		t.Error("parseLoadAvg() expected error for empty content")
+	}
+}
+
+// TestParseMemAvailable tests the parseMemAvailable function
+func TestParseMemAvailable(t *testing.T) {
+	content := "MemTotal:       16314056 kB\nMemFree:          812340 kB\nMemAvailable:    2097152 kB\n"
+	free, err := parseMemAvailable(content)
+	if err != nil || free != 2<<30 {
+		t.Errorf("parseMemAvailable() = %v, %v, want %v, nil", free, err, uint64(2<<30))
+	}
+	if _, err := parseMemAvailable("MemTotal: 1 kB\n"); err == nil {
+		t.Error("parseMemAvailable() expected error without MemAvailable")
+	}
+}
+
+// TestParseMemInfo tests parsing other fields of /proc/meminfo
+func TestParseMemInfo(t *testing.T) {
+	total, err := parseMemInfo("MemTotal:       16777216 kB\nMemFree:          812340 kB\n", "MemTotal")
+	if err != nil || total != 16<<30 {
+		t.Errorf("parseMemInfo() = %v, %v, want %v, nil", total, err, uint64(16<<30))
+	}
+}
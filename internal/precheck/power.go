@@ -0,0 +1,163 @@
+package precheck
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Power reports the power source of the host
+type Power interface {
+	// OnAC reports whether the host runs on external power, hosts without a battery always do
+	OnAC() (bool, error)
+	// Battery returns the lowest battery capacity in percent, present is false without a battery
+	Battery() (percent int, present bool, err error)
+}
+
+// ACCheck passes while the host runs on external power
+type ACCheck struct {
+	// Power reports the power source, defaults to the system power
+	Power Power
+}
+
+// Reason returns "on_battery"
+func (c ACCheck) Reason() string {
+	return "on_battery"
+}
+
+// Ready reports whether the host runs on external power
+func (c ACCheck) Ready() (bool, string, error) {
+	onAC, err := powerOrDefault(c.Power).OnAC()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to read power source: %w", err)
+	}
+	if !onAC {
+		return false, "running on battery", nil
+	}
+	return true, "", nil
+}
+
+// BatteryCheck passes while the battery is charged enough, hosts without a battery always pass
+type BatteryCheck struct {
+	// Power reports the power source, defaults to the system power
+	Power Power
+	// MinPercent is the minimum battery capacity in percent
+	MinPercent int
+}
+
+// Reason returns "low_battery"
+func (c BatteryCheck) Reason() string {
+	return "low_battery"
+}
+
+// Ready reports whether the battery capacity is at least MinPercent
+func (c BatteryCheck) Ready() (bool, string, error) {
+	percent, present, err := powerOrDefault(c.Power).Battery()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to read battery capacity: %w", err)
+	}
+	if present && percent < c.MinPercent {
+		return false, fmt.Sprintf("battery at %d%% below %d%%", percent, c.MinPercent), nil
+	}
+	return true, "", nil
+}
+
+// powerOrDefault returns power, or the system power if it is nil
+func powerOrDefault(power Power) Power {
+	if power == nil {
+		return NewPower()
+	}
+	return power
+}
+
+// sysfsPower reads the power source from a Linux power_supply class directory
+type sysfsPower struct {
+	dir string
+}
+
+// powerSupply is one entry of the power_supply class
+type powerSupply struct {
+	kind     string
+	online   bool
+	status   string
+	capacity int
+}
+
+// supplies reads all power supplies, a missing directory means there are none
+func (p sysfsPower) supplies() ([]powerSupply, error) {
+	entries, err := os.ReadDir(p.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var supplies []powerSupply
+	for _, entry := range entries {
+		dir := filepath.Join(p.dir, entry.Name())
+		supply := powerSupply{
+			kind:   readAttribute(dir, "type"),
+			online: readAttribute(dir, "online") == "1",
+			status: readAttribute(dir, "status"),
+		}
+		if supply.kind == "Battery" {
+			capacity, err := strconv.Atoi(readAttribute(dir, "capacity"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid capacity of %s: %w", entry.Name(), err)
+			}
+			supply.capacity = capacity
+		}
+		supplies = append(supplies, supply)
+	}
+	return supplies, nil
+}
+
+// OnAC reports whether a mains supply is online, or without mains supplies, no battery is discharging
+func (p sysfsPower) OnAC() (bool, error) {
+	supplies, err := p.supplies()
+	if err != nil {
+		return false, err
+	}
+	hasMains, discharging := false, false
+	for _, supply := range supplies {
+		switch supply.kind {
+		case "Mains", "USB":
+			if supply.online {
+				return true, nil
+			}
+			hasMains = true
+		case "Battery":
+			discharging = discharging || supply.status == "Discharging"
+		}
+	}
+	return !hasMains && !discharging, nil
+}
+
+// Battery returns the lowest capacity of all batteries
+func (p sysfsPower) Battery() (int, bool, error) {
+	supplies, err := p.supplies()
+	if err != nil {
+		return 0, false, err
+	}
+	percent, present := 100, false
+	for _, supply := range supplies {
+		if supply.kind == "Battery" {
+			percent, present = min(percent, supply.capacity), true
+		}
+	}
+	if !present {
+		return 0, false, nil
+	}
+	return percent, true, nil
+}
+
+// readAttribute reads a sysfs attribute, returning an empty string if it does not exist
+func readAttribute(dir, name string) string {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
@@ -0,0 +1,8 @@
+//go:build linux
+
+package precheck
+
+// NewPower returns the Power of the running system
+func NewPower() Power {
+	return sysfsPower{dir: "/sys/class/power_supply"}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package precheck
+
+import (
+	"errors"
+)
+
+// unsupportedPower is the Power of platforms without sysfs, it cannot report the power source
+type unsupportedPower struct{}
+
+// NewPower returns the Power of the running system
+func NewPower() Power {
+	return unsupportedPower{}
+}
+
+// OnAC returns errors.ErrUnsupported
+func (unsupportedPower) OnAC() (bool, error) {
+	return false, errors.ErrUnsupported
+}
+
+// Battery returns errors.ErrUnsupported
+func (unsupportedPower) Battery() (int, bool, error) {
+	return 0, false, errors.ErrUnsupported
+}
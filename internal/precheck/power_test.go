@@ -0,0 +1,121 @@
+package precheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSupply creates a power supply directory with the given attributes
+func writeSupply(t *testing.T, dir, name string, attributes map[string]string) {
+	t.Helper()
+	supplyDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(supplyDir, 0755); err != nil {
+		t.Fatalf("Failed to create supply dir: %v", err)
+	}
+	for attribute, value := range attributes {
+		if err := os.WriteFile(filepath.Join(supplyDir, attribute), []byte(value+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write attribute: %v", err)
+		}
+	}
+}
+
+// TestSysfsPower tests reading the power source from a power_supply directory
+func TestSysfsPower(t *testing.T) {
+	tests := []struct {
+		name        string
+		supplies    map[string]map[string]string
+		wantOnAC    bool
+		wantPercent int
+		wantPresent bool
+	}{
+		{
+			name:     "server without supplies",
+			wantOnAC: true,
+		},
+		{
+			name: "laptop on AC",
+			supplies: map[string]map[string]string{
+				"AC":   {"type": "Mains", "online": "1"},
+				"BAT0": {"type": "Battery", "status": "Charging", "capacity": "80"},
+			},
+			wantOnAC:    true,
+			wantPercent: 80,
+			wantPresent: true,
+		},
+		{
+			name: "laptop on battery",
+			supplies: map[string]map[string]string{
+				"AC":   {"type": "Mains", "online": "0"},
+				"BAT0": {"type": "Battery", "status": "Discharging", "capacity": "40"},
+				"BAT1": {"type": "Battery", "status": "Discharging", "capacity": "25"},
+			},
+			wantPercent: 25,
+			wantPresent: true,
+		},
+		{
+			name: "battery without mains supply",
+			supplies: map[string]map[string]string{
+				"BAT0": {"type": "Battery", "status": "Discharging", "capacity": "90"},
+			},
+			wantPercent: 90,
+			wantPresent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "power_supply")
+			for name, attributes := range tt.supplies {
+				writeSupply(t, dir, name, attributes)
+			}
+			power := sysfsPower{dir: dir}
+
+			onAC, err := power.OnAC()
+			if err != nil || onAC != tt.wantOnAC {
+				t.Errorf("OnAC() = %v, %v, want %v, nil", onAC, err, tt.wantOnAC)
+			}
+			percent, present, err := power.Battery()
+			if err != nil || percent != tt.wantPercent || present != tt.wantPresent {
+				t.Errorf("Battery() = %v, %v, %v, want %v, %v, nil", percent, present, err, tt.wantPercent, tt.wantPresent)
+			}
+		})
+	}
+}
+
+// fakePower is a Power with fixed readings
+type fakePower struct {
+	onAC    bool
+	percent int
+	present bool
+}
+
+func (p fakePower) OnAC() (bool, error)         { return p.onAC, nil }
+func (p fakePower) Battery() (int, bool, error) { return p.percent, p.present, nil }
+
+// TestPowerChecks tests the ACCheck and BatteryCheck Ready functions
+func TestPowerChecks(t *testing.T) {
+	tests := []struct {
+		name      string
+		check     Check
+		wantReady bool
+	}{
+		{name: "on AC", check: ACCheck{Power: fakePower{onAC: true}}, wantReady: true},
+		{name: "on battery", check: ACCheck{Power: fakePower{}}},
+		{name: "battery charged", check: BatteryCheck{Power: fakePower{percent: 30, present: true}, MinPercent: 30}, wantReady: true},
+		{name: "battery low", check: BatteryCheck{Power: fakePower{percent: 29, present: true}, MinPercent: 30}},
+		{name: "no battery", check: BatteryCheck{Power: fakePower{}, MinPercent: 30}, wantReady: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, _, err := tt.check.Ready()
+			if err != nil {
+				t.Fatalf("Ready() error = %v", err)
+			}
+			if ready != tt.wantReady {
+				t.Errorf("Ready() = %v, want %v", ready, tt.wantReady)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package precheck
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Check is a precondition evaluated before a job is started
+type Check interface {
+	// Reason is the skip reason reported when the check does not pass, e.g. "load"
+	Reason() string
+	// Ready reports whether the job may start, detail describes the observed state.
+	// An error means the state could not be observed.
+	Ready() (ready bool, detail string, err error)
+}
+
+// LoadCheck passes while the host load and free memory are within limits
+type LoadCheck struct {
+	// Host reports the resource usage, defaults to the system host
+	Host Host
+	// MaxLoad is the maximum 1-minute load average, 0 disables the check
+	MaxLoad float64
+	// MinFreeMemory is the minimum available memory in bytes, 0 disables the check
+	MinFreeMemory uint64
+}
+
+// Reason returns "load"
+func (c LoadCheck) Reason() string {
+	return "load"
+}
+
+// Ready reports whether the load average and available memory are within limits
+func (c LoadCheck) Ready() (bool, string, error) {
+	host := c.Host
+	if host == nil {
+		host = NewHost()
+	}
+	if c.MaxLoad > 0 {
+		load, err := host.LoadAverage()
+		if err != nil {
+			return false, "", fmt.Errorf("failed to read load average: %w", err)
+		}
+		if load > c.MaxLoad {
+			return false, fmt.Sprintf("load average %.2f exceeds %.2f", load, c.MaxLoad), nil
+		}
+	}
+	if c.MinFreeMemory > 0 {
+		free, err := host.FreeMemory()
+		if err != nil {
+			return false, "", fmt.Errorf("failed to read free memory: %w", err)
+		}
+		if free < c.MinFreeMemory {
+			return false, fmt.Sprintf("free memory %s below %s", FormatBytes(free), FormatBytes(c.MinFreeMemory)), nil
+		}
+	}
+	return true, "", nil
+}
+
+// byteUnits maps size suffixes to their multiplier, sizes are binary (1K = 1024)
+var byteUnits = map[string]uint64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseBytes parses a size such as "512M", "2G" or "2GiB" into bytes
+func ParseBytes(s string) (uint64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	end := len(value)
+	for end > 0 && (value[end-1] < '0' || value[end-1] > '9') && value[end-1] != '.' {
+		end--
+	}
+	multiplier, ok := byteUnits[value[end:]]
+	if !ok || end == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	number, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return uint64(number * float64(multiplier)), nil
+}
+
+// FormatBytes formats bytes with the largest binary unit keeping at least one whole unit
+func FormatBytes(n uint64) string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		if n >= byteUnits[unit] {
+			return strconv.FormatFloat(float64(n)/float64(byteUnits[unit]), 'f', 1, 64) + unit
+		}
+	}
+	return strconv.FormatUint(n, 10)
+}
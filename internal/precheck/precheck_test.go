@@ -0,0 +1,119 @@
+package precheck
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeHost is a Host with fixed readings
+type fakeHost struct {
+	load float64
+	free uint64
+	err  error
+}
+
+func (h fakeHost) LoadAverage() (float64, error) { return h.load, h.err }
+func (h fakeHost) FreeMemory() (uint64, error)   { return h.free, h.err }
+
+// TestLoadCheckReady tests the LoadCheck.Ready function
+func TestLoadCheckReady(t *testing.T) {
+	tests := []struct {
+		name      string
+		check     LoadCheck
+		wantReady bool
+		wantError bool
+	}{
+		{
+			name:      "no limits",
+			check:     LoadCheck{Host: fakeHost{err: errors.ErrUnsupported}},
+			wantReady: true,
+		},
+		{
+			name:      "load within limit",
+			check:     LoadCheck{Host: fakeHost{load: 7.5}, MaxLoad: 8},
+			wantReady: true,
+		},
+		{
+			name:  "load over limit",
+			check: LoadCheck{Host: fakeHost{load: 9}, MaxLoad: 8},
+		},
+		{
+			name:      "enough free memory",
+			check:     LoadCheck{Host: fakeHost{free: 3 << 30}, MinFreeMemory: 2 << 30},
+			wantReady: true,
+		},
+		{
+			name:  "not enough free memory",
+			check: LoadCheck{Host: fakeHost{free: 1 << 30}, MinFreeMemory: 2 << 30},
+		},
+		{
+			name:      "unreadable host",
+			check:     LoadCheck{Host: fakeHost{err: errors.ErrUnsupported}, MaxLoad: 8},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, detail, err := tt.check.Ready()
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Ready() error = %v, wantError %v", err, tt.wantError)
+			}
+			if ready != tt.wantReady {
+				t.Errorf("Ready() = %v, want %v", ready, tt.wantReady)
+			}
+			if !ready && err == nil && detail == "" {
+				t.Error("Ready() should describe why the check did not pass")
+			}
+		})
+	}
+}
+
+// TestParseBytes tests the ParseBytes function
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  uint64
+		wantError bool
+	}{
+		{input: "1024", expected: 1024},
+		{input: "512M", expected: 512 << 20},
+		{input: "2G", expected: 2 << 30},
+		{input: "2g", expected: 2 << 30},
+		{input: "2GiB", expected: 2 << 30},
+		{input: "1.5K", expected: 1536},
+		{input: "", wantError: true},
+		{input: "G", wantError: true},
+		{input: "2X", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseBytes(tt.input)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseBytes(%q) error = %v, wantError %v", tt.input, err, tt.wantError)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseBytes(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestFormatBytes tests the FormatBytes function
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    uint64
+		expected string
+	}{
+		{input: 512, expected: "512"},
+		{input: 1536, expected: "1.5K"},
+		{input: 2 << 30, expected: "2.0G"},
+	}
+
+	for _, tt := range tests {
+		if result := FormatBytes(tt.input); result != tt.expected {
+			t.Errorf("FormatBytes(%v) = %v, want %v", tt.input, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package precheck
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// tcpTimeout bounds a connection to a readiness address
+const tcpTimeout = 5 * time.Second
+
+// TCPCheck passes while a TCP port accepts connections, e.g. of a database or message broker restarting
+type TCPCheck struct {
+	// Address is the host and port connected to
+	Address string
+	// Dialer opens the connections, nil uses a dialer with a short timeout
+	Dialer *net.Dialer
+}
+
+// ParseTCP validates a readiness address given as host:port
+func ParseTCP(value string) (TCPCheck, error) {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil || host == "" {
+		return TCPCheck{}, fmt.Errorf("invalid address %q, expected host:port", value)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return TCPCheck{}, fmt.Errorf("invalid port %q", port)
+	}
+	return TCPCheck{Address: value}, nil
+}
+
+// Reason returns "dependency"
+func (c TCPCheck) Reason() string {
+	return "dependency"
+}
+
+// Ready reports whether a connection to the address can be opened, it is closed at once
+func (c TCPCheck) Ready() (bool, string, error) {
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: tcpTimeout}
+	}
+	conn, err := dialer.Dial("tcp", c.Address)
+	if err != nil {
+		return false, fmt.Sprintf("%s is unreachable: %v", c.Address, err), nil
+	}
+	_ = conn.Close()
+	return true, "", nil
+}
@@ -0,0 +1,53 @@
+package precheck
+
+import (
+	"net"
+	"testing"
+)
+
+// TestParseTCP tests validating readiness addresses
+func TestParseTCP(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "db.example.com:5432"},
+		{value: "[2001:db8::1]:5672"},
+		{value: "db.example.com", wantErr: true},
+		{value: ":5432", wantErr: true},
+		{value: "db.example.com:0", wantErr: true},
+		{value: "db.example.com:postgres", wantErr: true},
+		{value: "db.example.com:70000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTCP(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTCP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Address != tt.value {
+				t.Errorf("Address = %q, want %q", got.Address, tt.value)
+			}
+		})
+	}
+}
+
+// TestTCPCheck tests the check against a listening and a closed port
+func TestTCPCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	ready, detail, err := TCPCheck{Address: address}.Ready()
+	if err != nil || !ready {
+		t.Errorf("Ready() = %v, %q, %v, want ready", ready, detail, err)
+	}
+
+	_ = listener.Close()
+	ready, detail, err = TCPCheck{Address: address}.Ready()
+	if err != nil || ready || detail == "" {
+		t.Errorf("Ready() = %v, %q, %v, want not ready with a detail", ready, detail, err)
+	}
+}
@@ -0,0 +1,62 @@
+package precheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// urlTimeout bounds a request to a readiness URL, a dependency that does not answer in time is not ready
+const urlTimeout = 10 * time.Second
+
+// URLCheck passes while an HTTP endpoint answers with a 2xx status, e.g. the health check of a dependency
+// that must finish its own maintenance window before the job starts
+type URLCheck struct {
+	// URL is the http or https endpoint polled with GET
+	URL string
+	// Client sends the requests, nil uses a client with a short timeout
+	Client *http.Client
+}
+
+// ParseURL validates a readiness URL
+func ParseURL(value string) (URLCheck, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return URLCheck{}, fmt.Errorf("invalid URL %q, expected http:// or https://", value)
+	}
+	return URLCheck{URL: value}, nil
+}
+
+// Reason returns "dependency"
+func (c URLCheck) Reason() string {
+	return "dependency"
+}
+
+// Ready reports whether the URL answers with a 2xx status. An unreachable endpoint is not ready rather
+// than an error, since that is how a dependency under maintenance usually looks.
+func (c URLCheck) Ready() (bool, string, error) {
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: urlTimeout}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), urlTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return false, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Sprintf("%s is unreachable: %v", c.URL, err), nil
+	}
+	// Drain a small body so the connection can be reused by the next poll
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return false, fmt.Sprintf("%s answered %s", c.URL, resp.Status), nil
+	}
+	return true, "", nil
+}
@@ -0,0 +1,70 @@
+package precheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParseURL tests validating readiness URLs
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "https://api.example.com/health"},
+		{value: "http://127.0.0.1:8080/ready"},
+		{value: "ftp://api.example.com/health", wantErr: true},
+		{value: "api.example.com/health", wantErr: true},
+		{value: "https:///health", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseURL(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.URL != tt.value {
+				t.Errorf("URL = %q, want %q", got.URL, tt.value)
+			}
+		})
+	}
+}
+
+// TestURLCheck tests the check against an HTTP endpoint
+func TestURLCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantReady bool
+	}{
+		{name: "healthy", status: http.StatusOK, wantReady: true},
+		{name: "no content", status: http.StatusNoContent, wantReady: true},
+		{name: "maintenance", status: http.StatusServiceUnavailable},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			ready, detail, err := URLCheck{URL: server.URL}.Ready()
+			if err != nil {
+				t.Fatalf("Ready() error = %v", err)
+			}
+			if ready != tt.wantReady {
+				t.Errorf("Ready() = %v (%s), want %v", ready, detail, tt.wantReady)
+			}
+		})
+	}
+
+	// An unreachable dependency is not ready, it is not an error ignored by the run
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	ready, detail, err := URLCheck{URL: server.URL}.Ready()
+	if err != nil || ready || detail == "" {
+		t.Errorf("Ready() = %v, %q, %v, want not ready with a detail", ready, detail, err)
+	}
+}
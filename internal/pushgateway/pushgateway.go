@@ -0,0 +1,101 @@
+package pushgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of a push when none is configured
+const DefaultTimeout = 10 * time.Second
+
+// Gauge is a gauge sample pushed to the Pushgateway
+type Gauge struct {
+	// Name is the full metric name, e.g. "crontab_failed"
+	Name string
+	// Help is the HELP comment of the metric
+	Help string
+	// Value is the sample value
+	Value string
+}
+
+// Pusher pushes the final state of a job to a Prometheus Pushgateway.
+// Unlike the textfile, pushed values stay available until they are replaced,
+// so short-lived jobs are seen by Prometheus without waiting for a scrape.
+type Pusher struct {
+	url    string
+	job    string
+	client *http.Client
+}
+
+// NewPusher creates a Pusher for the Pushgateway at baseURL.
+// job is the value of the "job" grouping label, client sends the pushes, nil uses a client with DefaultTimeout.
+func NewPusher(baseURL string, job string, client *http.Client) *Pusher {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Pusher{
+		url:    strings.TrimSuffix(baseURL, "/"),
+		job:    job,
+		client: client,
+	}
+}
+
+// Push replaces all metrics of the group identified by the job name with gauges.
+// The job name is added as the "name" grouping label, matching the textfile labels.
+func (p *Pusher) Push(ctx context.Context, jobName string, gauges []Gauge) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.groupURL(jobName), bytes.NewReader(FormatGauges(gauges)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push to pushgateway: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push to pushgateway: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// groupURL returns the URL of the grouping key job/<job>/name/<jobName>
+func (p *Pusher) groupURL(jobName string) string {
+	return p.url + "/metrics" + groupingPath("job", p.job) + groupingPath("name", jobName)
+}
+
+// groupingPath encodes one grouping label as URL path segments.
+// Values that cannot be represented in a path segment use the base64 encoding of the Pushgateway.
+func groupingPath(label, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		return "/" + label + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + label + "/" + url.PathEscape(value)
+}
+
+// FormatGauges renders gauges in the Prometheus text format, sorted by name
+func FormatGauges(gauges []Gauge) []byte {
+	sorted := append([]Gauge{}, gauges...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	var buf bytes.Buffer
+	for _, g := range sorted {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", g.Name, g.Help)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", g.Name)
+		fmt.Fprintf(&buf, "%s %s\n", g.Name, g.Value)
+	}
+	return buf.Bytes()
+}
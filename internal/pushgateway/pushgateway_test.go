@@ -0,0 +1,110 @@
+package pushgateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFormatGauges tests the FormatGauges function
+func TestFormatGauges(t *testing.T) {
+	gauges := []Gauge{
+		{Name: "crontab_failed", Help: "Whether the job failed", Value: "0"},
+		{Name: "crontab_duration_seconds", Help: "Duration", Value: "1.50"},
+	}
+
+	expected := `# HELP crontab_duration_seconds Duration
+# TYPE crontab_duration_seconds gauge
+crontab_duration_seconds 1.50
+# HELP crontab_failed Whether the job failed
+# TYPE crontab_failed gauge
+crontab_failed 0
+`
+	if result := string(FormatGauges(gauges)); result != expected {
+		t.Errorf("FormatGauges() = %q, want %q", result, expected)
+	}
+}
+
+// TestGroupingPath tests the groupingPath function
+func TestGroupingPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{
+			name:     "plain value",
+			value:    "daily_backup",
+			expected: "/name/daily_backup",
+		},
+		{
+			name:     "value with spaces",
+			value:    "daily backup",
+			expected: "/name/daily%20backup",
+		},
+		{
+			name:     "value with slash",
+			value:    "team/backup",
+			expected: "/name@base64/dGVhbS9iYWNrdXA",
+		},
+		{
+			name:     "empty value",
+			value:    "",
+			expected: "/name@base64/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := groupingPath("name", tt.value); result != tt.expected {
+				t.Errorf("groupingPath(%q) = %q, want %q", tt.value, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestPusherPush tests pushing to a fake Pushgateway
+func TestPusherPush(t *testing.T) {
+	t.Run("successful push", func(t *testing.T) {
+		var gotMethod, gotPath, gotBody string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotMethod = r.Method
+			gotPath = r.URL.EscapedPath()
+			body, _ := io.ReadAll(r.Body)
+			gotBody = string(body)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		pusher := NewPusher(server.URL+"/", "crontab", nil)
+		err := pusher.Push(context.Background(), "daily_backup", []Gauge{{Name: "crontab_failed", Help: "Failed", Value: "1"}})
+		if err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+		if gotMethod != http.MethodPut {
+			t.Errorf("method = %v, want PUT", gotMethod)
+		}
+		if gotPath != "/metrics/job/crontab/name/daily_backup" {
+			t.Errorf("path = %v, want /metrics/job/crontab/name/daily_backup", gotPath)
+		}
+		if !strings.Contains(gotBody, "crontab_failed 1\n") {
+			t.Errorf("body = %q, want to contain sample", gotBody)
+		}
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad metrics", http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		pusher := NewPusher(server.URL, "crontab", nil)
+		err := pusher.Push(context.Background(), "job", nil)
+		if err == nil || !strings.Contains(err.Error(), "bad metrics") {
+			t.Errorf("Push() error = %v, want error with response body", err)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/state"
+)
+
+// Subdirectories of a queue directory, items move from pending to processing to done or failed
+const (
+	PendingDir    = "pending"
+	ProcessingDir = "processing"
+	DoneDir       = "done"
+	FailedDir     = "failed"
+)
+
+// Queue is a directory of pending work items, each a file or directory in its pending subdirectory.
+// Items are claimed by renaming them into processing, so concurrent consumers never claim the same item.
+type Queue struct {
+	dir string
+}
+
+// New returns the Queue in dir
+func New(dir string) *Queue {
+	return &Queue{dir: dir}
+}
+
+// Init creates the queue subdirectories
+func (q *Queue) Init() error {
+	for _, sub := range []string{PendingDir, ProcessingDir, DoneDir, FailedDir} {
+		if err := os.MkdirAll(filepath.Join(q.dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Item is a claimed work item
+type Item struct {
+	// Name is the name of the item in the pending directory
+	Name string
+	// Path is the path of the item while it is processed
+	Path string
+	q    *Queue
+}
+
+// Claim claims the oldest pending item, returning nil if there is none.
+// Items left in processing by consumers that no longer exist are returned to pending first,
+// so every item is processed at least once.
+func (q *Queue) Claim() (*Item, error) {
+	if err := q.Init(); err != nil {
+		return nil, err
+	}
+	if err := q.recover(); err != nil {
+		return nil, err
+	}
+
+	names, err := q.pending()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		path := filepath.Join(q.dir, ProcessingDir, strconv.Itoa(os.Getpid())+"-"+name)
+		err := os.Rename(filepath.Join(q.dir, PendingDir, name), path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Claimed by another consumer in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Item{Name: name, Path: path, q: q}, nil
+	}
+	return nil, nil
+}
+
+// pending returns the names of the pending items, oldest first
+func (q *Queue) pending() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, PendingDir))
+	if err != nil {
+		return nil, err
+	}
+	type pendingItem struct {
+		name    string
+		modTime int64
+	}
+	items := make([]pendingItem, 0, len(entries))
+	for _, entry := range entries {
+		// Hidden files are items still being written, e.g. ".upload.tmp"
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		items = append(items, pendingItem{name: entry.Name(), modTime: info.ModTime().UnixNano()})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].modTime != items[j].modTime {
+			return items[i].modTime < items[j].modTime
+		}
+		return items[i].name < items[j].name
+	})
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.name
+	}
+	return names, nil
+}
+
+// recover returns items claimed by processes that no longer exist to pending
+func (q *Queue) recover() error {
+	entries, err := os.ReadDir(filepath.Join(q.dir, ProcessingDir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		pidStr, name, found := strings.Cut(entry.Name(), "-")
+		pid, err := strconv.Atoi(pidStr)
+		if !found || err != nil || state.ProcessAlive(pid) {
+			continue
+		}
+		from := filepath.Join(q.dir, ProcessingDir, entry.Name())
+		if err := os.Rename(from, filepath.Join(q.dir, PendingDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to recover %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Done moves the item to the done directory
+func (i *Item) Done() error {
+	return i.moveTo(DoneDir)
+}
+
+// Failed moves the item to the failed directory
+func (i *Item) Failed() error {
+	return i.moveTo(FailedDir)
+}
+
+// Release returns the item to pending, so it is claimed again by a later run
+func (i *Item) Release() error {
+	return i.moveTo(PendingDir)
+}
+
+// moveTo moves the item to the sub directory of the queue under its original name
+func (i *Item) moveTo(sub string) error {
+	target := filepath.Join(i.q.dir, sub, i.Name)
+	// Replace an item of the same name processed before, rename does not replace directories
+	if sub != PendingDir {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+	return os.Rename(i.Path, target)
+}
@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// addItem creates a pending item with the given modification time offset
+func addItem(t *testing.T, dir, name string, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, PendingDir, name)
+	if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+		t.Fatalf("Failed to write item: %v", err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to change times: %v", err)
+	}
+}
+
+// TestQueueClaim tests that items are claimed oldest first, once each
+func TestQueueClaim(t *testing.T) {
+	dir := t.TempDir()
+	q := New(dir)
+	if err := q.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	addItem(t, dir, "new.json", time.Minute)
+	addItem(t, dir, "old.json", time.Hour)
+	addItem(t, dir, ".partial.json", 2*time.Hour)
+
+	for _, want := range []string{"old.json", "new.json"} {
+		item, err := q.Claim()
+		if err != nil || item == nil {
+			t.Fatalf("Claim() = %v, %v, want %s", item, err, want)
+		}
+		if item.Name != want {
+			t.Errorf("Claim() = %s, want %s", item.Name, want)
+		}
+		if content, err := os.ReadFile(item.Path); err != nil || string(content) != want {
+			t.Errorf("claimed item content = %q, %v, want %q", content, err, want)
+		}
+	}
+
+	if item, err := q.Claim(); err != nil || item != nil {
+		t.Errorf("Claim() of empty queue = %v, %v, want nil", item, err)
+	}
+}
+
+// TestItemFinish tests moving claimed items to done, failed and back to pending
+func TestItemFinish(t *testing.T) {
+	tests := []struct {
+		name    string
+		finish  func(*Item) error
+		wantDir string
+	}{
+		{name: "done", finish: (*Item).Done, wantDir: DoneDir},
+		{name: "failed", finish: (*Item).Failed, wantDir: FailedDir},
+		{name: "release", finish: (*Item).Release, wantDir: PendingDir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q := New(dir)
+			if err := q.Init(); err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+			addItem(t, dir, "item", 0)
+
+			item, err := q.Claim()
+			if err != nil || item == nil {
+				t.Fatalf("Claim() = %v, %v", item, err)
+			}
+			if err := tt.finish(item); err != nil {
+				t.Fatalf("finish error = %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.wantDir, "item")); err != nil {
+				t.Errorf("item should be in %s: %v", tt.wantDir, err)
+			}
+			if entries, _ := os.ReadDir(filepath.Join(dir, ProcessingDir)); len(entries) != 0 {
+				t.Errorf("processing should be empty, got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+// TestQueueRecover tests that items of exited consumers are claimed again
+func TestQueueRecover(t *testing.T) {
+	dir := t.TempDir()
+	q := New(dir)
+	if err := q.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	cmd := exec.Command("sh", "-c", "exit 0")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run process: %v", err)
+	}
+	abandoned := filepath.Join(dir, ProcessingDir, strconv.Itoa(cmd.Process.Pid)+"-abandoned-item")
+	if err := os.WriteFile(abandoned, nil, 0644); err != nil {
+		t.Fatalf("Failed to write item: %v", err)
+	}
+	// Items of running consumers are left alone
+	active := filepath.Join(dir, ProcessingDir, strconv.Itoa(os.Getpid())+"-active-item")
+	if err := os.WriteFile(active, nil, 0644); err != nil {
+		t.Fatalf("Failed to write item: %v", err)
+	}
+
+	item, err := q.Claim()
+	if err != nil || item == nil {
+		t.Fatalf("Claim() = %v, %v, want abandoned-item", item, err)
+	}
+	if item.Name != "abandoned-item" {
+		t.Errorf("Claim() = %s, want abandoned-item", item.Name)
+	}
+	if _, err := os.Stat(active); err != nil {
+		t.Errorf("active item should stay in processing: %v", err)
+	}
+}
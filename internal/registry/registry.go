@@ -0,0 +1,163 @@
+package registry
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/spf13/afero"
+)
+
+// DefaultPath is the registry read by cronmgr list when no other path is given
+const DefaultPath = "/var/lib/cronmgr/registry.json"
+
+// Job is a job wrapped by cronmgr on the host, as recorded by its last run
+type Job struct {
+	// Name is the job name
+	Name string `json:"name"`
+	// Owner is the owner the metrics of the job are sharded by, empty if they are not
+	Owner string `json:"owner,omitempty"`
+	// Command is the command line the job runs, quoted for a shell
+	Command string `json:"command"`
+	// Schedule describes when the job runs, e.g. its cron expression, empty if it was not given
+	Schedule string `json:"schedule,omitempty"`
+	// User is the user running the job
+	User string `json:"user,omitempty"`
+	// Provenance describes where the job definition comes from, e.g. repo=infra and commit=abc123
+	Provenance map[string]string `json:"provenance,omitempty"`
+	// FirstSeen is the start time of the first recorded run of the job
+	FirstSeen time.Time `json:"first_seen"`
+	// LastRun is the start time of the last recorded run of the job
+	LastRun time.Time `json:"last_run"`
+}
+
+// file is the content of the registry file
+type file struct {
+	Jobs []Job `json:"jobs"`
+	// PushedAt is the time the jobs were last pushed to a central inventory
+	PushedAt time.Time `json:"pushed_at,omitzero"`
+}
+
+// Registry is the inventory of the jobs of a host, kept in a JSON file shared by all cronmgr processes.
+// Jobs are identified by their name and owner, each run replaces the entry of its job.
+type Registry struct {
+	fs        afero.Fs
+	path      string
+	useOsLock bool
+}
+
+// New creates a Registry kept in the file path
+func New(fs afero.Fs, path string) *Registry {
+	_, isOsFs := fs.(*afero.OsFs)
+	return &Registry{fs: fs, path: path, useOsLock: isOsFs}
+}
+
+// Record adds or replaces the entry of job, keeping the time it was first seen
+func (r *Registry) Record(job Job) error {
+	return r.update(func(f *file) bool {
+		job.FirstSeen = job.LastRun
+		i := slices.IndexFunc(f.Jobs, func(j Job) bool { return j.Name == job.Name && j.Owner == job.Owner })
+		if i == -1 {
+			f.Jobs = append(f.Jobs, job)
+		} else {
+			if !f.Jobs[i].FirstSeen.IsZero() {
+				job.FirstSeen = f.Jobs[i].FirstSeen
+			}
+			f.Jobs[i] = job
+		}
+		sortJobs(f.Jobs)
+		return true
+	})
+}
+
+// ClaimPush returns the jobs to push to a central inventory if their last push is at least interval old at now,
+// and records now as the time of the last push, so the runs of other jobs do not push them as well. ok is false
+// if they were pushed more recently. If the push fails, ReleasePush restores previous for the next run to retry.
+func (r *Registry) ClaimPush(now time.Time, interval time.Duration) (jobs []Job, previous time.Time, ok bool, err error) {
+	err = r.update(func(f *file) bool {
+		previous = f.PushedAt
+		if !f.PushedAt.IsZero() && now.Sub(f.PushedAt) < interval {
+			return false
+		}
+		f.PushedAt = now
+		jobs, ok = slices.Clone(f.Jobs), true
+		return true
+	})
+	return jobs, previous, ok, err
+}
+
+// ReleasePush restores the time of the last push to previous after a claimed push failed
+func (r *Registry) ReleasePush(previous time.Time) error {
+	return r.update(func(f *file) bool {
+		f.PushedAt = previous
+		return true
+	})
+}
+
+// List returns the jobs of the registry sorted by name and owner, none if the file does not exist
+func (r *Registry) List() ([]Job, error) {
+	f, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	sortJobs(f.Jobs)
+	return f.Jobs, nil
+}
+
+// update applies fn to the content of the registry under the lock of the file, and writes it if fn returns true
+func (r *Registry) update(fn func(f *file) bool) error {
+	if err := r.fs.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	locker := fslock.NewLocker(r.path, r.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return fmt.Errorf("couldn't lock %s: %w", r.path, err)
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	f, err := r.read()
+	if err != nil {
+		return err
+	}
+	if !fn(&f) {
+		return nil
+	}
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := r.path + ".tmp"
+	// Readable by everyone, the inventory is meant for audits
+	if err := afero.WriteFile(r.fs, tmpPath, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return r.fs.Rename(tmpPath, r.path)
+}
+
+// read parses the registry file, it is empty if it does not exist
+func (r *Registry) read() (file, error) {
+	content, err := afero.ReadFile(r.fs, r.path)
+	if os.IsNotExist(err) {
+		return file{}, nil
+	}
+	if err != nil {
+		return file{}, err
+	}
+	var f file
+	if err := json.Unmarshal(content, &f); err != nil {
+		return file{}, fmt.Errorf("invalid registry %s: %w", r.path, err)
+	}
+	return f, nil
+}
+
+// sortJobs sorts jobs by name and owner
+func sortJobs(jobs []Job) {
+	slices.SortFunc(jobs, func(a, b Job) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Owner, b.Owner))
+	})
+}
@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// TestRegistry tests recording the runs of several jobs and listing them
+func TestRegistry(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	r := New(afero.NewMemMapFs(), DefaultPath)
+	if jobs, err := r.List(); err != nil || len(jobs) != 0 {
+		t.Fatalf("List() = %v, %v, want no job before the first run", jobs, err)
+	}
+
+	runs := []Job{
+		{Name: "sync", Command: "/usr/bin/sync", LastRun: start},
+		{Name: "backup", Command: "/usr/bin/backup", Schedule: "0 2 * * *", LastRun: start.Add(time.Minute)},
+		{Name: "backup", Owner: "team-b", Command: "/opt/b/backup", LastRun: start.Add(2 * time.Minute)},
+		{Name: "backup", Command: "/usr/bin/backup --full", Schedule: "0 2 * * *", User: "root", LastRun: start.Add(24 * time.Hour)},
+	}
+	for _, run := range runs {
+		if err := r.Record(run); err != nil {
+			t.Fatalf("Record(%s) error = %v", run.Name, err)
+		}
+	}
+
+	jobs, err := r.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []Job{
+		{Name: "backup", Command: "/usr/bin/backup --full", Schedule: "0 2 * * *", User: "root",
+			FirstSeen: start.Add(time.Minute), LastRun: start.Add(24 * time.Hour)},
+		{Name: "backup", Owner: "team-b", Command: "/opt/b/backup", FirstSeen: start.Add(2 * time.Minute), LastRun: start.Add(2 * time.Minute)},
+		{Name: "sync", Command: "/usr/bin/sync", FirstSeen: start, LastRun: start},
+	}
+	if !slices.EqualFunc(jobs, want, func(a, b Job) bool {
+		return a.Name == b.Name && a.Owner == b.Owner && a.Command == b.Command && a.Schedule == b.Schedule &&
+			a.User == b.User && a.FirstSeen.Equal(b.FirstSeen) && a.LastRun.Equal(b.LastRun)
+	}) {
+		t.Errorf("List() = %+v, want %+v", jobs, want)
+	}
+}
+
+// TestRegistryInvalid tests that a corrupted registry is reported instead of being overwritten
+func TestRegistryInvalid(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, DefaultPath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := New(fs, DefaultPath)
+	if _, err := r.List(); err == nil {
+		t.Error("List() error = nil, want an error")
+	}
+	if err := r.Record(Job{Name: "backup"}); err == nil {
+		t.Error("Record() error = nil, want an error")
+	}
+}
+
+// TestRegistryClaimPush tests that the jobs are pushed once per interval by the runs of all jobs
+func TestRegistryClaimPush(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	r := New(afero.NewMemMapFs(), DefaultPath)
+	if err := r.Record(Job{Name: "backup", Command: "/usr/bin/backup", LastRun: start}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	jobs, previous, ok, err := r.ClaimPush(start, 24*time.Hour)
+	if err != nil || !ok || len(jobs) != 1 || !previous.IsZero() {
+		t.Fatalf("first ClaimPush() = %v, %v, %v, %v, want the job", jobs, previous, ok, err)
+	}
+	if _, _, ok, err := r.ClaimPush(start.Add(time.Hour), 24*time.Hour); err != nil || ok {
+		t.Errorf("ClaimPush() within the interval = %v, %v, want no push", ok, err)
+	}
+
+	// A failed push is retried by the next run
+	_, previous, ok, err = r.ClaimPush(start.Add(25*time.Hour), 24*time.Hour)
+	if err != nil || !ok || !previous.Equal(start) {
+		t.Fatalf("ClaimPush() after the interval = %v, %v, %v, want a push after %v", previous, ok, err, start)
+	}
+	if err := r.ReleasePush(previous); err != nil {
+		t.Fatalf("ReleasePush() error = %v", err)
+	}
+	if _, _, ok, err := r.ClaimPush(start.Add(25*time.Hour+time.Minute), 24*time.Hour); err != nil || !ok {
+		t.Errorf("ClaimPush() after a failed push = %v, %v, want a push", ok, err)
+	}
+
+	// Recording runs keeps the time of the last push
+	if err := r.Record(Job{Name: "sync", Command: "/usr/bin/sync", LastRun: start.Add(26 * time.Hour)}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if _, _, ok, err := r.ClaimPush(start.Add(27*time.Hour), 24*time.Hour); err != nil || ok {
+		t.Errorf("ClaimPush() after recording a run = %v, %v, want no push", ok, err)
+	}
+}
@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/alswl/cron-manager/internal/pglock"
+)
+
+// acquireAdvisoryLock takes the AdvisoryLock, waiting up to AdvisoryLockWait. It returns false if the run
+// must be skipped, and otherwise a function releasing the lock once the run finished.
+func (r *Runner) acquireAdvisoryLock() (release func(), ok bool) {
+	target := r.opts.AdvisoryLock
+	if target == nil {
+		return func() {}, true
+	}
+	start := r.clock.Now()
+	lock, err := target.Acquire(context.Background(), r.opts.AdvisoryLockWait)
+	r.exp.WriteGauge("advisory_lock_wait_seconds", r.opts.Name, r.formatSeconds(r.clock.Since(start)), helpLockWait)
+	if err != nil {
+		// Without the lock the job could run concurrently with another host, so failures never start it
+		cause := pglock.CauseConnect
+		var lockErr *pglock.Error
+		if errors.As(err, &lockErr) {
+			cause = lockErr.Cause
+		}
+		if cause == pglock.CauseHeld {
+			r.logf("Skipping job %s, advisory lock %s is %v", r.opts.Name, target, lockErr.Err)
+		} else {
+			log.Printf("Skipping job %s: %v", r.opts.Name, err)
+		}
+		r.countLockFailure(cause)
+		return nil, false
+	}
+	r.logf("Took advisory lock %s", target)
+
+	// The command keeps running if the lock is lost, which is only reported
+	done := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-lock.Lost():
+			log.Printf("Lost advisory lock %s of job %s: %v", target, r.opts.Name, lock.Err())
+			r.countLockFailure(pglock.CauseLost)
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-watched
+		if err := lock.Release(); err != nil {
+			log.Printf("Failed to release advisory lock %s: %v", target, err)
+		}
+	}, true
+}
+
+// countLockFailure counts an advisory lock that could not be taken or was lost, by cause
+func (r *Runner) countLockFailure(cause string) {
+	r.exp.IncrementCounter("advisory_lock_failures_total", r.opts.Name, map[string]string{"cause": cause}, helpLockFailures)
+}
@@ -0,0 +1,50 @@
+package runner
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/pglock"
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// TestRunnerRunAdvisoryLockUnavailable tests that a run whose advisory lock cannot be taken is skipped
+func TestRunnerRunAdvisoryLockUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	mem := testutil.NewMemExporter()
+	marker := filepath.Join(t.TempDir(), "ran")
+	opts := newTestOptions(mem, "touch", marker)
+	opts.AdvisoryLock = &pglock.Target{Network: "tcp", Address: address, SSLMode: pglock.SSLDisable, ConnectTimeout: time.Second, Key: 42}
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	result, err := r.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Skipped != "advisory_lock" {
+		t.Errorf("Skipped = %q, want advisory_lock", result.Skipped)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected the command not to run")
+	}
+	if value, _ := mem.Value(`crontab_runs_total{name="test_job",status="skipped_advisory_lock"}`); value != "1" {
+		t.Errorf("runs_total{status=\"skipped_advisory_lock\"} = %q, want 1", value)
+	}
+	if value, _ := mem.Value(`crontab_advisory_lock_failures_total{name="test_job",cause="connect"}`); value != "1" {
+		t.Errorf("advisory_lock_failures_total{cause=\"connect\"} = %q, want 1", value)
+	}
+	if _, found := mem.Value(`crontab_advisory_lock_wait_seconds{name="test_job"}`); !found {
+		t.Error("Expected advisory_lock_wait_seconds to be written")
+	}
+}
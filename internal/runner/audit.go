@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"log"
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/audit"
+)
+
+// startAudit starts tracing the processes of the run when AuditFile is set, nil without it. Tracing that is
+// not available is logged and the job runs without a summary.
+func (r *Runner) startAudit() *audit.Tracer {
+	if r.opts.AuditFile == "" {
+		return nil
+	}
+	t, err := audit.Start()
+	if err != nil {
+		log.Printf("Failed to audit job %s, running it without: %v", r.opts.Name, err)
+		return nil
+	}
+	return t
+}
+
+// finishAudit stops the tracer and writes the summary of the run of result to AuditFile
+func (r *Runner) finishAudit(t *audit.Tracer, result Result) {
+	if t == nil {
+		return
+	}
+	s := t.Stop()
+	s.Name, s.RunID, s.StartTime, s.FinishTime = r.opts.Name, result.RunID, result.StartTime, r.clock.Now()
+	path := strings.ReplaceAll(r.opts.AuditFile, RunIDPlaceholder, result.RunID)
+	if err := s.WriteFile(path); err != nil {
+		log.Printf("Failed to write the audit of job %s: %v", r.opts.Name, err)
+		return
+	}
+	if s.LostEvents > 0 || s.Omitted > 0 {
+		log.Printf("Audit of job %s is incomplete: %d events lost, %d entries omitted", r.opts.Name, s.LostEvents, s.Omitted)
+	}
+	r.logf("Audit of job %s written to %s", r.opts.Name, path)
+}
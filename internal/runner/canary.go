@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"hash/fnv"
+	"log"
+	"os"
+)
+
+// canaryBucket returns the bucket of hostname among 100, stable across runs so that raising the
+// percentage of a canary keeps the hosts already running the job
+func canaryBucket(hostname string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(hostname))
+	return int(h.Sum32() % 100)
+}
+
+// InCanary reports whether the host hostname executes a job rolled out to percent of the hosts
+func InCanary(hostname string, percent int) bool {
+	return canaryBucket(hostname) < percent
+}
+
+// outsideCanary reports whether this host must skip the run of a job rolled out to Canary percent of the hosts
+func (r *Runner) outsideCanary() bool {
+	if r.opts.Canary == 0 {
+		return false
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		// Without a hostname the host cannot be placed, run the job rather than skipping it everywhere
+		log.Printf("Ignoring canary of job %s: %v", r.opts.Name, err)
+		return false
+	}
+	if InCanary(hostname, r.opts.Canary) {
+		return false
+	}
+	r.logf("Skipping job %s: host %s is not among the %d%% canary hosts", r.opts.Name, hostname, r.opts.Canary)
+	return true
+}
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// TestInCanary tests that hosts are spread over the buckets and stay in the canary as it grows
+func TestInCanary(t *testing.T) {
+	in := 0
+	for i := range 1000 {
+		hostname := fmt.Sprintf("web-%d", i)
+		if InCanary(hostname, 0) || !InCanary(hostname, 100) {
+			t.Fatalf("InCanary(%s) must be false at 0%% and true at 100%%", hostname)
+		}
+		if InCanary(hostname, 10) {
+			in++
+			if !InCanary(hostname, 50) {
+				t.Errorf("host %s leaves the canary when it grows from 10%% to 50%%", hostname)
+			}
+		}
+	}
+	if in < 50 || in > 150 {
+		t.Errorf("%d of 1000 hosts in a 10%% canary, want about 100", in)
+	}
+}
+
+// TestRunnerRunCanary tests that the hosts outside the canary skip the run
+func TestRunnerRunCanary(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("no hostname: %v", err)
+	}
+	bucket := canaryBucket(hostname)
+
+	tests := []struct {
+		name        string
+		canary      int
+		wantSkipped string
+		wantMetric  string
+	}{
+		{name: "disabled", wantMetric: `crontab_runs_total{name="test_job",status="success"} 1`},
+		{name: "in canary", canary: bucket + 1, wantMetric: `crontab_runs_total{name="test_job",status="success"} 1`},
+		{name: "outside canary", canary: bucket, wantSkipped: "canary",
+			wantMetric: `crontab_runs_total{name="test_job",status="skipped_canary"} 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantSkipped != "" && tt.canary == 0 {
+				t.Skipf("host %s is in every canary", hostname)
+			}
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+			opts.Canary = tt.canary
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %q, want %q", result.Skipped, tt.wantSkipped)
+			}
+			if !strings.Contains(mem.Content(), tt.wantMetric+"\n") {
+				t.Errorf("Expected metric %q, got:\n%s", tt.wantMetric, mem.Content())
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// capacityInterval is how often a deferred run checks whether the host has room for it
+const capacityInterval = 5 * time.Second
+
+// reserveCapacity waits up to CapacityWait for the host to have room for the Resources of the job and
+// reserves them. It returns false if the run must be skipped, and otherwise a function releasing them.
+// A ledger that cannot be read is logged and ignored, like the prechecks.
+func (r *Runner) reserveCapacity() (release func(), ok bool) {
+	ledger := r.opts.Capacity
+	if ledger == nil {
+		return func() {}, true
+	}
+	start := r.clock.Now()
+	deadline := start.Add(r.opts.CapacityWait)
+	defer func() {
+		r.exp.WriteGauge("queue_delay_seconds", r.opts.Name, r.formatSeconds(r.clock.Since(start)), helpQueueDelay)
+	}()
+	pid := os.Getpid()
+	for {
+		reserved, detail, err := ledger.Reserve(r.opts.Name, pid, r.opts.Resources)
+		if err != nil {
+			log.Printf("Ignoring the resources of job %s: %v", r.opts.Name, err)
+			return func() {}, true
+		}
+		if reserved {
+			break
+		}
+		if !r.clock.Now().Before(deadline) {
+			r.logf("Skipping job %s: %s", r.opts.Name, detail)
+			return nil, false
+		}
+		r.logf("Deferring job %s: %s", r.opts.Name, detail)
+		r.clock.Sleep(min(capacityInterval, deadline.Sub(r.clock.Now())))
+	}
+	return func() {
+		if err := ledger.Release(pid); err != nil {
+			log.Printf("Failed to release the resources of job %s: %v", r.opts.Name, err)
+		}
+	}, true
+}
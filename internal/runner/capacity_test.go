@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/capacity"
+	"github.com/alswl/cron-manager/internal/testutil"
+	"github.com/spf13/afero"
+)
+
+// TestRunnerRunCapacity tests that a run is deferred while the host has no room for it, then skipped
+func TestRunnerRunCapacity(t *testing.T) {
+	tests := []struct {
+		name        string
+		reserved    float64
+		wantSkipped string
+		wantDelay   time.Duration
+	}{
+		{name: "room", reserved: 1, wantDelay: 0},
+		{name: "full", reserved: 2, wantSkipped: "capacity", wantDelay: 12 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := capacity.New(afero.NewMemMapFs(), "/reservations.json", capacity.Resources{CPU: 2})
+			// Another running job, the parent process stands in for it
+			if ok, _, err := ledger.Reserve("backup", os.Getppid(), capacity.Resources{CPU: tt.reserved}); !ok || err != nil {
+				t.Fatalf("Reserve() = %v, %v", ok, err)
+			}
+			start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+			clk := testutil.NewFakeClock(start)
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+			opts.Capacity = ledger
+			opts.Resources = capacity.Resources{CPU: 1}
+			opts.CapacityWait = 12 * time.Second
+			opts.Clock = clk
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %q, want %q", result.Skipped, tt.wantSkipped)
+			}
+			if delay := result.StartTime.Sub(start); delay != tt.wantDelay {
+				t.Errorf("start delayed by %v, want %v", delay, tt.wantDelay)
+			}
+			want := "0.00"
+			if tt.wantDelay > 0 {
+				want = "12.00"
+			}
+			if value, _ := mem.Value(`crontab_queue_delay_seconds{name="test_job"}`); value != want {
+				t.Errorf("queue_delay_seconds = %q, want %s", value, want)
+			}
+
+			// The reservation of the run is released once it finished
+			if err := ledger.Release(os.Getppid()); err != nil {
+				t.Fatal(err)
+			}
+			if ok, detail, _ := ledger.Reserve("report", os.Getppid(), capacity.Resources{CPU: 2}); !ok {
+				t.Errorf("Reserve() after the run = false, %q", detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package runner
+
+import "sync"
+
+// tailBuffer keeps the last bytes written to it, bounding the memory held by the output of a command.
+// It is safe for concurrent use, stdout and stderr may be copied to it at the same time.
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	data  []byte
+}
+
+// newTailBuffer creates a buffer keeping at most limit bytes
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: max(limit, 0)}
+}
+
+// Write keeps the end of p and drops the oldest bytes over the limit, it never fails
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	if len(p) >= b.limit {
+		b.data = append(b.data[:0], p[len(p)-b.limit:]...)
+		return n, nil
+	}
+	if drop := len(b.data) + len(p) - b.limit; drop > 0 {
+		b.data = append(b.data[:0], b.data[drop:]...)
+	}
+	b.data = append(b.data, p...)
+	return n, nil
+}
+
+// Bytes returns the kept bytes
+func (b *tailBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.data
+}
@@ -0,0 +1,34 @@
+package runner
+
+import (
+	"testing"
+)
+
+// TestTailBuffer tests that only the last bytes up to the limit are kept
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		writes []string
+		want   string
+	}{
+		{name: "under limit", limit: 10, writes: []string{"abc", "def"}, want: "abcdef"},
+		{name: "exact limit", limit: 6, writes: []string{"abc", "def"}, want: "abcdef"},
+		{name: "drops oldest", limit: 4, writes: []string{"abc", "def"}, want: "cdef"},
+		{name: "large write", limit: 3, writes: []string{"ab", "cdefgh"}, want: "fgh"},
+		{name: "zero limit", limit: 0, writes: []string{"abc"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTailBuffer(tt.limit)
+			for _, w := range tt.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if got := string(b.Bytes()); got != tt.want {
+				t.Errorf("Bytes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
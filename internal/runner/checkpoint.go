@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckpointEnv is the environment variable passing the checkpoint directory to the command
+const CheckpointEnv = "CRONMGR_CHECKPOINT_DIR"
+
+// checkpointPath returns the checkpoint directory of the job inside CheckpointDir
+func (r *Runner) checkpointPath() string {
+	// Job names are free text, keep them from escaping the checkpoint directory
+	name := strings.ReplaceAll(r.opts.Name, string(filepath.Separator), "_")
+	if name == "." || name == ".." {
+		name = strings.ReplaceAll(name, ".", "_")
+	}
+	return filepath.Join(r.opts.CheckpointDir, name)
+}
+
+// prepareCheckpoint creates the checkpoint directory of the job, keeping what a previous
+// attempt left in it, and returns the environment of the command; nil inherits the environment
+// of cronmgr when checkpoints are disabled
+func (r *Runner) prepareCheckpoint() ([]string, error) {
+	if r.opts.CheckpointDir == "" {
+		return nil, nil
+	}
+	dir := r.checkpointPath()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	return append(os.Environ(), CheckpointEnv+"="+dir), nil
+}
+
+// clearCheckpoint removes the checkpoint directory after a successful run,
+// the next run starts from scratch
+func (r *Runner) clearCheckpoint(result Result) {
+	if r.opts.CheckpointDir == "" || result.Failed() {
+		return
+	}
+	if err := os.RemoveAll(r.checkpointPath()); err != nil {
+		log.Printf("Failed to remove checkpoint directory: %v", err)
+	}
+}
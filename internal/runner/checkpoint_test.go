@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+func TestRunnerRunCheckpoint(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      int
+		wantFailed   bool
+		wantAttempts int
+		wantProgress string
+	}{
+		{name: "resumed_until_success", retries: 3, wantAttempts: 3},
+		{name: "kept_after_failure", retries: 1, wantFailed: true, wantAttempts: 2, wantProgress: "x\nx\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			// Each attempt records its progress and the third one completes the work
+			script := testutil.WriteScript(t, "resumable.sh", `echo x >> "$CRONMGR_CHECKPOINT_DIR/progress"
+[ "$(wc -l < "$CRONMGR_CHECKPOINT_DIR/progress")" -ge 3 ]`)
+			opts := newTestOptions(mem, script)
+			opts.Retries = tt.retries
+			opts.CheckpointDir = t.TempDir()
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Failed() != tt.wantFailed || result.Attempts != tt.wantAttempts {
+				t.Errorf("Failed() = %v, Attempts = %d, want %v, %d", result.Failed(), result.Attempts, tt.wantFailed, tt.wantAttempts)
+			}
+
+			progress, err := os.ReadFile(filepath.Join(opts.CheckpointDir, "test_job", "progress"))
+			if tt.wantProgress == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("Expected checkpoint directory to be removed, read error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to read checkpoint: %v", err)
+			}
+			if string(progress) != tt.wantProgress {
+				t.Errorf("progress = %q, want %q", progress, tt.wantProgress)
+			}
+		})
+	}
+}
+
+func TestCheckpointPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobName string
+		want    string
+	}{
+		{name: "plain", jobName: "backup", want: "backup"},
+		{name: "separator", jobName: "db/backup", want: "db_backup"},
+		{name: "parent", jobName: "..", want: "__"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{opts: RunnerOptions{Name: tt.jobName, CheckpointDir: "/var/lib/cronmgr"}}
+			if got := r.checkpointPath(); got != filepath.Join("/var/lib/cronmgr", tt.want) {
+				t.Errorf("checkpointPath() = %q, want %q", got, filepath.Join("/var/lib/cronmgr", tt.want))
+			}
+		})
+	}
+}
+
+func TestRunnerRunCheckpointEnv(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	out := filepath.Join(t.TempDir(), "env")
+	opts := newTestOptions(mem, testutil.WriteScript(t, "env.sh", `echo "${CRONMGR_CHECKPOINT_DIR:-unset}" > "$1"`), out)
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if strings.TrimSpace(string(got)) != "unset" {
+		t.Errorf("%s = %q without checkpoint directory, want unset", CheckpointEnv, got)
+	}
+}
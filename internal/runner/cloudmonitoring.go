@@ -0,0 +1,29 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"maps"
+	"strconv"
+
+	"github.com/alswl/cron-manager/internal/cloudmonitoring"
+)
+
+// writeCloudMonitoring writes the final gauges to Cloud Monitoring with the job name and the constant
+// labels as metric labels, failures are logged but do not fail the run
+func (r *Runner) writeCloudMonitoring(gauges []finalGauge) {
+	var points []cloudmonitoring.Point
+	for _, g := range gauges {
+		value, err := strconv.ParseFloat(g.value, 64)
+		if err != nil || remoteSkipped[g.name] {
+			continue
+		}
+		points = append(points, cloudmonitoring.Point{Name: g.name, Value: value})
+	}
+
+	labels := map[string]string{"name": r.opts.Name}
+	maps.Copy(labels, r.exp.ConstLabels())
+	if err := r.opts.CloudMonitoring.Put(context.Background(), labels, points); err != nil {
+		log.Printf("Failed to write metrics to Cloud Monitoring: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/cloudwatch"
+)
+
+// remoteSkipped are the final gauges not sent to CloudWatch, Cloud Monitoring or InfluxDB: each
+// point carries its own timestamp, and a finished job is never running
+var remoteSkipped = map[string]bool{"running": true, "last_run_timestamp_seconds": true}
+
+// cloudWatchPayload is a put of the final gauges of a job to CloudWatch
+type cloudWatchPayload struct {
+	Labels map[string]string  `json:"labels"`
+	Data   []cloudwatch.Datum `json:"data"`
+}
+
+// putCloudWatch puts the final gauges to CloudWatch at completedAt with the job name and the constant
+// labels as dimensions, failures are logged but do not fail the run
+func (r *Runner) putCloudWatch(gauges []finalGauge, completedAt time.Time) {
+	var data []cloudwatch.Datum
+	for _, g := range gauges {
+		value, err := strconv.ParseFloat(g.value, 64)
+		if err != nil || remoteSkipped[g.name] {
+			continue
+		}
+		datum := cloudwatch.Datum{Name: g.name, Value: value, Timestamp: completedAt}
+		switch {
+		case strings.HasSuffix(g.name, "_seconds"):
+			datum.Unit = "Seconds"
+		case g.name == "attempts":
+			datum.Unit = "Count"
+		}
+		data = append(data, datum)
+	}
+
+	payload := cloudWatchPayload{Labels: map[string]string{"name": r.opts.Name}, Data: data}
+	maps.Copy(payload.Labels, r.exp.ConstLabels())
+	err := r.submit(spoolCloudWatch, r.opts.CloudWatch.Target(), "", payload, func(content []byte) error {
+		var p cloudWatchPayload
+		if err := json.Unmarshal(content, &p); err != nil {
+			return err
+		}
+		return r.opts.CloudWatch.Put(context.Background(), p.Labels, p.Data)
+	})
+	if err != nil {
+		log.Printf("Failed to put metrics to CloudWatch: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"log"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/alswl/cron-manager/internal/coredump"
+)
+
+// enableCores lets the command dump its core when it crashes, if ArtifactDir is set to collect it
+func (r *Runner) enableCores() {
+	if r.opts.ArtifactDir == "" {
+		return
+	}
+	if err := coredump.Enable(); err != nil {
+		log.Printf("Failed to enable the core dumps of job %s: %v", r.opts.Name, err)
+	}
+}
+
+// collectCore moves the core dumped by the crashed command of result and its backtrace into the artifact
+// directory of the run. Failures are logged but do not fail the run.
+func (r *Runner) collectCore(cmd *exec.Cmd, result *Result) {
+	if r.opts.ArtifactDir == "" || !result.ExitStatus.CoreDumped {
+		return
+	}
+	p := coredump.Process{PID: cmd.Process.Pid, Executable: cmd.Path, Dir: cmd.Dir}
+	dump, err := coredump.Collect(p, filepath.Join(r.opts.ArtifactDir, result.RunID))
+	if dump.Core == "" {
+		log.Printf("Failed to collect the core of job %s: %v", r.opts.Name, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Collected the core of job %s without a backtrace: %v", r.opts.Name, err)
+	}
+	result.CoreFile, result.BacktraceFile = dump.Core, dump.Backtrace
+	r.logf("Collected the core of job %s to %s", r.opts.Name, dump.Core)
+}
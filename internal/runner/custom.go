@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CustomMetricsEnv is the environment variable passing the custom metrics file to the command
+const CustomMetricsEnv = "CRONMGR_METRICS_FILE"
+
+// customMetricPrefix starts the lines of the custom metrics file reporting a metric
+const customMetricPrefix = "cronmgr-metric"
+
+// customMetricNamePattern matches the names of custom metrics, the characters of Prometheus metric names
+var customMetricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// prepareCustomMetrics creates the file the command reports custom metrics to and returns its path
+// with the environment of the command, env or the environment of cronmgr if env is nil
+func (r *Runner) prepareCustomMetrics(env []string) (string, []string, error) {
+	if !r.opts.CustomMetrics {
+		return "", env, nil
+	}
+	file, err := os.CreateTemp("", "cronmgr-metrics-*")
+	if err != nil {
+		return "", env, fmt.Errorf("failed to create custom metrics file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", env, fmt.Errorf("failed to create custom metrics file: %w", err)
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return file.Name(), append(env, CustomMetricsEnv+"="+file.Name()), nil
+}
+
+// writeCustomMetrics exports the metrics reported to the custom metrics file at path as custom gauges
+func (r *Runner) writeCustomMetrics(path string) {
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Failed to read custom metrics: %v", err)
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	values, err := parseCustomMetrics(file)
+	if err != nil {
+		log.Printf("Invalid custom metrics of job %s: %v", r.opts.Name, err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		r.exp.WriteGaugeWithLabels("custom", r.opts.Name, map[string]string{"metric": name}, values[name], helpCustom)
+	}
+}
+
+// parseCustomMetrics parses lines of the form `cronmgr-metric <name> <value>`, the last value of a name wins.
+// Other lines are ignored; malformed metric lines are skipped and reported in the returned error.
+func parseCustomMetrics(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	var invalid []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != customMetricPrefix {
+			continue
+		}
+		if len(fields) != 3 || !customMetricNamePattern.MatchString(fields[1]) {
+			invalid = append(invalid, strconv.Quote(scanner.Text()))
+			continue
+		}
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			invalid = append(invalid, strconv.Quote(scanner.Text()))
+			continue
+		}
+		values[fields[1]] = fields[2]
+	}
+	if err := scanner.Err(); err != nil {
+		return values, err
+	}
+	if len(invalid) > 0 {
+		return values, fmt.Errorf("skipped lines %s", strings.Join(invalid, ", "))
+	}
+	return values, nil
+}
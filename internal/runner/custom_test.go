@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+// TestParseCustomMetrics tests parsing the lines of the custom metrics file
+func TestParseCustomMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "metrics",
+			input: "cronmgr-metric rows_exported 12345\ncronmgr-metric  ratio\t0.25\n",
+			want:  map[string]string{"rows_exported": "12345", "ratio": "0.25"},
+		},
+		{
+			name:  "last value wins and other lines are ignored",
+			input: "progress: 50%\ncronmgr-metric rows 1\n\ncronmgr-metric rows 2\n",
+			want:  map[string]string{"rows": "2"},
+		},
+		{
+			name:    "malformed lines are skipped",
+			input:   "cronmgr-metric rows\ncronmgr-metric rows many\ncronmgr-metric bad-name 1\ncronmgr-metric ok 1e3\n",
+			want:    map[string]string{"ok": "1e3"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCustomMetrics(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCustomMetrics() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseCustomMetrics() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"log"
+	"os"
+
+	"github.com/alswl/cron-manager/internal/events"
+)
+
+// emit writes a lifecycle event of the run runID if Events is configured, failures are logged
+func (r *Runner) emit(runID string, event events.Event) {
+	if r.opts.Events == nil {
+		return
+	}
+	event.Time = r.clock.Now()
+	event.Name = r.opts.Name
+	event.Owner = r.exp.Owner()
+	event.RunID = runID
+	event.Host, _ = os.Hostname()
+	event.PID = os.Getpid()
+	if err := r.opts.Events.Write(event); err != nil {
+		log.Printf("Failed to write %s event: %v", event.Event, err)
+	}
+}
+
+// finishedEvent returns the finished event of result
+func finishedEvent(result Result) events.Event {
+	status, errorType := result.outcome()
+	exitCode := result.jobExitCode()
+	return events.Event{
+		Event:           events.Finished,
+		ExitCode:        &exitCode,
+		Status:          status,
+		ErrorType:       errorType,
+		DurationSeconds: result.Duration.Seconds(),
+		Attempts:        result.Attempts,
+	}
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/events"
+	"github.com/alswl/cron-manager/internal/precheck"
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// TestRunnerRunEvents tests the lifecycle events written for runs
+func TestRunnerRunEvents(t *testing.T) {
+	tests := []struct {
+		name           string
+		script         func(t *testing.T) string
+		retries        int
+		attemptTimeout time.Duration
+		busy           bool
+		wantEvents     []string
+		wantLast       events.Event
+	}{
+		{
+			name:       "success",
+			script:     func(t *testing.T) string { return testutil.ExitScript(t, 0) },
+			wantEvents: []string{events.Started, events.Finished},
+			wantLast:   events.Event{Status: "success", Attempts: 1},
+		},
+		{
+			name:       "retried",
+			script:     func(t *testing.T) string { return testutil.FailingScript(t, 1, 75) },
+			retries:    1,
+			wantEvents: []string{events.Started, events.Retrying, events.Finished},
+			wantLast:   events.Event{Status: "success", Attempts: 2},
+		},
+		{
+			name:           "timeout",
+			script:         func(t *testing.T) string { return testutil.WriteScript(t, "slow.sh", "sleep 30") },
+			attemptTimeout: 100 * time.Millisecond,
+			wantEvents:     []string{events.Started, events.Timeout, events.Finished},
+			wantLast:       events.Event{Status: "failed", ErrorType: "timeout", Attempts: 1},
+		},
+		{
+			name:       "skipped",
+			script:     func(t *testing.T) string { return testutil.ExitScript(t, 0) },
+			busy:       true,
+			wantEvents: []string{events.Skipped},
+			wantLast:   events.Event{Reason: "load"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.ndjson")
+			opts := newTestOptions(testutil.NewMemExporter(), tt.script(t))
+			opts.Retries = tt.retries
+			opts.RetryDelay = time.Millisecond
+			opts.AttemptTimeout = tt.attemptTimeout
+			if tt.busy {
+				opts.Prechecks = []precheck.Check{&fakeCheck{failures: 1}}
+			}
+			opts.Events = events.NewWriter(path)
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			got := readEvents(t, path)
+			kinds := make([]string, 0, len(got))
+			for _, event := range got {
+				kinds = append(kinds, event.Event)
+				if event.Name != "test_job" || event.RunID != result.RunID || event.PID != os.Getpid() || event.Time.IsZero() {
+					t.Errorf("event %+v does not identify the run %s", event, result.RunID)
+				}
+			}
+			if !slices.Equal(kinds, tt.wantEvents) {
+				t.Fatalf("events = %v, want %v", kinds, tt.wantEvents)
+			}
+			last := got[len(got)-1]
+			if last.Status != tt.wantLast.Status || last.ErrorType != tt.wantLast.ErrorType ||
+				last.Attempts != tt.wantLast.Attempts || last.Reason != tt.wantLast.Reason {
+				t.Errorf("last event = %+v, want %+v", last, tt.wantLast)
+			}
+		})
+	}
+}
+
+// readEvents reads the events of the NDJSON file at path
+func readEvents(t *testing.T, path string) []events.Event {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	var got []events.Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event events.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid event line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, event)
+	}
+	return got
+}
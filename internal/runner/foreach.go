@@ -0,0 +1,181 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alswl/cron-manager/internal/job"
+)
+
+// ItemsFromLines returns the non-empty lines of the file at path, "-" reads standard input
+func ItemsFromLines(path string) ([]string, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = file.Close() }()
+		reader = file
+	}
+
+	items := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			items = append(items, line)
+		}
+	}
+	return items, scanner.Err()
+}
+
+// ItemsFromGlob returns the paths matching pattern in lexical order
+func ItemsFromGlob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	if matches == nil {
+		matches = []string{}
+	}
+	return matches, nil
+}
+
+// itemResult is the outcome of running the command for one item
+type itemResult struct {
+	status    job.ExitStatus
+	execError job.ExecErrorType
+}
+
+// failed reports whether the command failed for the item
+func (i itemResult) failed() bool {
+	return i.execError != "" || i.status.Code != 0
+}
+
+// executeEach runs the command once per item as a single run, at most Parallelism at a time.
+// Each item is counted in items_total; the run fails with the outcome of the first failed item.
+func (r *Runner) executeEach(items []string) (Result, error) {
+	result := r.newResult()
+
+	// Output of all items goes to the log file, the writer is safe for concurrent use
+	out := io.Discard
+	if r.opts.LogFile != "" {
+		logWriter, err := r.openLogWriter(r.opts.LogFile, "log", result.RunID)
+		if err != nil {
+			return result, fmt.Errorf("failed to create log writer: %w", err)
+		}
+		if logWriter != nil {
+			result.LogFile = logWriter.Path()
+			defer func() { _ = logWriter.Close() }()
+			defer func() {
+				if err := logWriter.Wait(); err != nil {
+					log.Printf("Error flushing log file: %v", err)
+				}
+			}()
+			out = logWriter
+		}
+	}
+	errOut := out
+	errorLog, err := r.openErrorLog(&result)
+	if err != nil {
+		return result, err
+	}
+	if errorLog != nil {
+		defer func() { _ = errorLog.Close() }()
+		defer flushLogs(errorLog)
+		errOut = io.MultiWriter(out, errorLog)
+	}
+
+	snapshots, err := r.takeSnapshots(result)
+	if err != nil {
+		return result, err
+	}
+	watcher, err := r.watchReadOnly(result)
+	if err != nil {
+		return result, err
+	}
+	if watcher != nil {
+		defer watcher.Stop()
+	}
+	tracer := r.startAudit()
+	if tracer != nil {
+		defer tracer.Stop()
+	}
+
+	work := &workTimer{clock: r.clock, start: result.StartTime}
+	stop := r.startTicker(work)
+	r.writeStarted(result)
+	r.writeIntent(result)
+
+	results := make([]itemResult, len(items))
+	sem := make(chan struct{}, max(r.opts.Parallelism, 1))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = r.runItem(item, out, errOut)
+		}()
+	}
+	wg.Wait()
+	work.finish()
+	r.finishReadOnly(watcher, &result)
+	r.finishAudit(tracer, result)
+
+	if r.opts.IdleSeconds > 0 {
+		job.IdleWait(r.clock, result.StartTime, r.opts.IdleSeconds)
+	}
+	stop()
+
+	result.Duration = work.duration()
+	result.WallDuration = r.clock.Since(result.StartTime)
+	for _, itemResult := range results {
+		if itemResult.failed() {
+			result.ExitStatus = itemResult.status
+			result.ExecError = itemResult.execError
+			break
+		}
+	}
+	r.finishSnapshots(snapshots, &result)
+
+	result.Severity = r.severity(result)
+	r.writeFinished(result)
+	return result, nil
+}
+
+// runItem runs the command for one item, writing its output to out and errOut, and counts its outcome
+func (r *Runner) runItem(item string, out, errOut io.Writer) itemResult {
+	cmdBin, cmdArgs := r.command(item)
+	cmd := exec.Command(cmdBin, cmdArgs...)
+	cmd.Stdout = out
+	cmd.Stderr = errOut
+
+	var result itemResult
+	if err := cmd.Start(); err != nil {
+		result.execError = r.reportExecError(cmd.Path, err)
+	} else {
+		status, ok := job.ExitStatusFromError(cmd.Wait())
+		if !ok {
+			// Waiting failed without an exit status, the outcome of the item is unknown
+			status = job.ExitStatus{Code: job.ExecErrorOther.ExitCode()}
+		}
+		result.status = status
+	}
+
+	outcome := "success"
+	if result.failed() {
+		outcome = "failed"
+		r.logf("Item %s failed (exit code %d)", item, result.status.Code)
+	}
+	r.exp.IncrementCounter("items_total", r.opts.Name, map[string]string{"status": outcome}, helpItemsTotal)
+	return result
+}
@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+func TestItemsFromLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "lines", content: "a\nb\n", want: []string{"a", "b"}},
+		{name: "blank_lines_skipped", content: "\n  a  \n\n\tb\n", want: []string{"a", "b"}},
+		{name: "no_trailing_newline", content: "a", want: []string{"a"}},
+		{name: "empty", content: "", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "items")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write items: %v", err)
+			}
+			got, err := ItemsFromLines(path)
+			if err != nil {
+				t.Fatalf("ItemsFromLines() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ItemsFromLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ItemsFromLines(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("ItemsFromLines() expected error for missing file")
+	}
+}
+
+func TestItemsFromGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.log", "a.log", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+		wantErr bool
+	}{
+		{name: "sorted_matches", pattern: "*.log", want: []string{"a.log", "b.log"}},
+		{name: "no_match", pattern: "*.gz", want: []string{}},
+		{name: "invalid_pattern", pattern: "[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ItemsFromGlob(filepath.Join(dir, tt.pattern))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ItemsFromGlob() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := []string{}
+			for _, name := range tt.want {
+				want = append(want, filepath.Join(dir, name))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ItemsFromGlob() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRunnerRunForEach(t *testing.T) {
+	tests := []struct {
+		name        string
+		items       []string
+		parallelism int
+		wantFailed  bool
+		wantSkipped string
+		wantMetrics []string
+	}{
+		{
+			name:        "all_succeed",
+			items:       []string{"0", "0", "0"},
+			parallelism: 2,
+			wantMetrics: []string{
+				`crontab_items_total{name="test_job",status="success"} 3`,
+				`crontab_runs_total{name="test_job",status="success"} 1`,
+			},
+		},
+		{
+			name:       "first_failure_wins",
+			items:      []string{"0", "4", "5"},
+			wantFailed: true,
+			wantMetrics: []string{
+				`crontab_items_total{name="test_job",status="success"} 1`,
+				`crontab_items_total{name="test_job",status="failed"} 2`,
+				`crontab_exit_code{name="test_job"} 4`,
+			},
+		},
+		{
+			name:        "no_items",
+			items:       []string{},
+			wantSkipped: "no_items",
+			wantMetrics: []string{
+				`crontab_runs_total{name="test_job",status="skipped_no_items"} 1`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			// The script exits with the code passed as its item
+			opts := newTestOptions(mem, testutil.WriteScript(t, "item.sh", `exit "$1"`))
+			opts.ForEach = true
+			opts.Items = tt.items
+			opts.Parallelism = tt.parallelism
+			opts.LogFile = filepath.Join(t.TempDir(), "job.log")
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Failed() != tt.wantFailed || result.Skipped != tt.wantSkipped {
+				t.Errorf("Failed() = %v, Skipped = %q, want %v, %q", result.Failed(), result.Skipped, tt.wantFailed, tt.wantSkipped)
+			}
+			for _, metric := range tt.wantMetrics {
+				if !strings.Contains(mem.Content(), metric+"\n") {
+					t.Errorf("Expected metric %q, got:\n%s", metric, mem.Content())
+				}
+			}
+		})
+	}
+}
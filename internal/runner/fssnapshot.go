@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alswl/cron-manager/internal/fssnapshot"
+)
+
+// takeSnapshots takes the Snapshots of the run of result. If one fails, those already taken are dropped
+// and the run must not start.
+func (r *Runner) takeSnapshots(result Result) ([]fssnapshot.Snapshot, error) {
+	if len(r.opts.Snapshots) == 0 {
+		return nil, nil
+	}
+	start := r.clock.Now()
+	var taken []fssnapshot.Snapshot
+	for _, spec := range r.opts.Snapshots {
+		snap, err := spec.Take(r.opts.Name, result.RunID)
+		if err != nil {
+			r.countSnapshot("take_failed")
+			r.dropSnapshots(taken)
+			return nil, fmt.Errorf("failed to take snapshot of %s: %w", spec, err)
+		}
+		r.countSnapshot("taken")
+		r.logf("Took snapshot %s", snap)
+		taken = append(taken, snap)
+	}
+	r.exp.WriteGauge("snapshot_duration_seconds", r.opts.Name, r.formatSeconds(r.clock.Since(start)), helpSnapshotTime)
+	return taken, nil
+}
+
+// finishSnapshots drops the snapshots after a successful run, and keeps them in result after a failed
+// one so the file systems can be rolled back
+func (r *Runner) finishSnapshots(snapshots []fssnapshot.Snapshot, result *Result) {
+	if !result.Failed() {
+		r.dropSnapshots(snapshots)
+		return
+	}
+	for _, snap := range snapshots {
+		log.Printf("Kept snapshot %s of failed job %s", snap, r.opts.Name)
+		r.countSnapshot("kept")
+		result.Snapshots = append(result.Snapshots, snap.Name)
+	}
+}
+
+// dropSnapshots drops snapshots, logging those that could not be dropped
+func (r *Runner) dropSnapshots(snapshots []fssnapshot.Snapshot) {
+	for _, snap := range snapshots {
+		if err := snap.Drop(); err != nil {
+			log.Printf("Failed to drop snapshot %s: %v", snap, err)
+			r.countSnapshot("drop_failed")
+			continue
+		}
+		r.logf("Dropped snapshot %s", snap)
+		r.countSnapshot("dropped")
+	}
+}
+
+// countSnapshot counts a step of the lifecycle of a snapshot
+func (r *Runner) countSnapshot(outcome string) {
+	r.exp.IncrementCounter("snapshots_total", r.opts.Name, map[string]string{"outcome": outcome}, helpSnapshots)
+}
@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/fssnapshot"
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// fakeZFS puts a zfs command on PATH appending its arguments to the returned file, failing the
+// snapshot subcommand if failSnapshot is set
+func fakeZFS(t *testing.T, failSnapshot bool) string {
+	t.Helper()
+	calls := filepath.Join(t.TempDir(), "calls")
+	body := `echo "$@" >> "` + calls + `"`
+	if failSnapshot {
+		body += "\n[ \"$1\" != snapshot ] || { echo 'dataset does not exist' >&2; exit 1; }"
+	}
+	script := testutil.WriteScript(t, "zfs", body)
+	t.Setenv("PATH", filepath.Dir(script)+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+// readCalls returns the command lines recorded by fakeZFS
+func readCalls(t *testing.T, path string) []string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestRunnerRunSnapshots(t *testing.T) {
+	tests := []struct {
+		name          string
+		exitCode      int
+		wantSnapshots bool
+		wantDrop      bool
+		wantOutcome   string
+	}{
+		{name: "dropped_after_success", exitCode: 0, wantDrop: true, wantOutcome: "dropped"},
+		{name: "kept_after_failure", exitCode: 3, wantSnapshots: true, wantOutcome: "kept"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeZFS(t, false)
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, testutil.ExitScript(t, tt.exitCode))
+			opts.Snapshots = []fssnapshot.Spec{{Kind: fssnapshot.ZFS, Target: "tank/data"}}
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			name := "tank/data@cronmgr-test_job-" + result.RunID
+			want := []string{"snapshot " + name}
+			if tt.wantDrop {
+				want = append(want, "destroy "+name)
+			}
+			if got := readCalls(t, calls); !slices.Equal(got, want) {
+				t.Errorf("zfs calls = %q, want %q", got, want)
+			}
+			if got := len(result.Snapshots) > 0; got != tt.wantSnapshots {
+				t.Errorf("Snapshots = %q, want kept %v", result.Snapshots, tt.wantSnapshots)
+			}
+			for _, outcome := range []string{"taken", tt.wantOutcome} {
+				if value, _ := mem.Value(`crontab_snapshots_total{name="test_job",outcome="` + outcome + `"}`); value != "1" {
+					t.Errorf("snapshots_total{outcome=%q} = %q, want 1", outcome, value)
+				}
+			}
+			if _, found := mem.Value(`crontab_snapshot_duration_seconds{name="test_job"}`); !found {
+				t.Error("Expected snapshot_duration_seconds to be written")
+			}
+		})
+	}
+}
+
+// TestRunnerRunSnapshotFailed tests that the command does not run without its snapshots
+func TestRunnerRunSnapshotFailed(t *testing.T) {
+	calls := fakeZFS(t, true)
+	mem := testutil.NewMemExporter()
+	marker := filepath.Join(t.TempDir(), "ran")
+	opts := newTestOptions(mem, "touch", marker)
+	opts.Snapshots = []fssnapshot.Spec{{Kind: fssnapshot.ZFS, Target: "tank/missing"}}
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err == nil || !strings.Contains(err.Error(), "dataset does not exist") {
+		t.Errorf("Run() error = %v, want the error of zfs", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected the command not to run")
+	}
+	if got := readCalls(t, calls); len(got) != 1 {
+		t.Errorf("zfs calls = %q, want only the snapshot", got)
+	}
+	if value, _ := mem.Value(`crontab_snapshots_total{name="test_job",outcome="take_failed"}`); value != "1" {
+		t.Errorf("snapshots_total{outcome=\"take_failed\"} = %q, want 1", value)
+	}
+	if _, found := mem.Value(`crontab_runs_total{name="test_job",status="started"}`); found {
+		t.Error("Expected the run not to start")
+	}
+}
@@ -0,0 +1,34 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/health"
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// TestRunnerRunHealth tests that the health server follows the attempts of the command
+func TestRunnerRunHealth(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 3))
+	opts.Retries = 1
+	opts.Health = health.New("test_job")
+	if got := opts.Health.Report().State; got != health.StateStarting {
+		t.Fatalf("State before the run = %s, want %s", got, health.StateStarting)
+	}
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	report := opts.Health.Report()
+	if report.State != health.StateExited || report.Attempt != 2 || report.PID == 0 {
+		t.Errorf("Report() = %+v, want exited after attempt 2 with a PID", report)
+	}
+	if report.ExitCode == nil || *report.ExitCode != 3 {
+		t.Errorf("ExitCode = %v, want 3", report.ExitCode)
+	}
+}
@@ -0,0 +1,18 @@
+package runner
+
+// onHoliday reports whether the run falls on a date of the Holidays calendar and must be skipped
+func (r *Runner) onHoliday() bool {
+	if r.opts.Holidays == nil {
+		return false
+	}
+	now := r.clock.Now().Local()
+	excluded, name := r.opts.Holidays.Contains(now)
+	if !excluded {
+		return false
+	}
+	if name == "" {
+		name = "an excluded date"
+	}
+	r.logf("Skipping job %s: %s is %s", r.opts.Name, now.Format("2006-01-02"), name)
+	return true
+}
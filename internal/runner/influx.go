@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/influx"
+)
+
+// writeInflux writes the final gauges as the fields of one line protocol point at completedAt, tagged
+// with the job name and the constant labels, to InfluxDB and the line protocol file as configured.
+// Failures are logged but do not fail the run.
+func (r *Runner) writeInflux(gauges []finalGauge, completedAt time.Time) {
+	fields := map[string]float64{}
+	for _, g := range gauges {
+		value, err := strconv.ParseFloat(g.value, 64)
+		if err != nil || remoteSkipped[g.name] {
+			continue
+		}
+		fields[g.name] = value
+	}
+	tags := map[string]string{"name": r.opts.Name}
+	maps.Copy(tags, r.exp.ConstLabels())
+	points := []influx.Point{{Measurement: r.exp.MetricPrefix(), Tags: tags, Fields: fields, Time: completedAt}}
+
+	if r.opts.Influx != nil {
+		err := r.submit(spoolInflux, r.opts.Influx.Target(), "", points, func(content []byte) error {
+			var p []influx.Point
+			if err := json.Unmarshal(content, &p); err != nil {
+				return err
+			}
+			return r.opts.Influx.Write(context.Background(), p)
+		})
+		if err != nil {
+			log.Printf("Failed to write metrics to InfluxDB: %v", err)
+		}
+	}
+	if r.opts.InfluxFile != "" {
+		if err := influx.AppendFile(r.opts.InfluxFile, points); err != nil {
+			log.Printf("Failed to write metrics to %s: %v", r.opts.InfluxFile, err)
+		}
+	}
+}
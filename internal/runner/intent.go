@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"log"
+	"os"
+
+	"github.com/alswl/cron-manager/internal/state"
+)
+
+// writeIntent records the intent of the run in the state store before its command is started, so the run
+// is accounted for even if its outcome is never reported. Failures are logged and do not prevent the run.
+func (r *Runner) writeIntent(result Result) {
+	if r.store == nil {
+		return
+	}
+	intent := state.Intent{
+		Name:      r.opts.Name,
+		Owner:     r.exp.Owner(),
+		RunID:     result.RunID,
+		PID:       os.Getpid(),
+		StartTime: result.StartTime,
+	}
+	if err := r.store.WriteIntent(intent); err != nil {
+		log.Printf("Failed to write run intent: %v", err)
+		return
+	}
+	r.intent = &intent
+}
+
+// clearIntent removes the intent of the run once its outcome was reported
+func (r *Runner) clearIntent() {
+	if r.intent == nil {
+		return
+	}
+	if _, err := r.store.ClaimIntent(*r.intent); err != nil {
+		log.Printf("Failed to remove run intent: %v", err)
+	}
+	r.intent = nil
+}
@@ -0,0 +1,36 @@
+package runner
+
+import (
+	"log"
+	"time"
+)
+
+// checkInterval returns why the run must be skipped to keep IntervalAfterRun after the previous run of
+// the job: "running" while it still runs, "interval" until the interval elapsed, empty once the run is due.
+// A previous run that cannot be read or whose process died does not hold the job back.
+func (r *Runner) checkInterval() string {
+	if r.opts.IntervalAfterRun == 0 || r.store == nil {
+		return ""
+	}
+	previous, found, err := r.store.Load(r.opts.Name)
+	if err != nil {
+		log.Printf("Ignoring interval of job %s: %v", r.opts.Name, err)
+		return ""
+	}
+	switch {
+	case !found:
+		return ""
+	case previous.Running:
+		if previous.Stale() {
+			return ""
+		}
+		r.logf("Skipping job %s: previous run started at %s (pid %d) is still running", r.opts.Name, previous.StartTime.Format(time.RFC3339), previous.PID)
+		return "running"
+	}
+	due := previous.FinishTime.Add(r.opts.IntervalAfterRun)
+	if r.clock.Now().Before(due) {
+		r.logf("Skipping job %s: next run is due at %s, %v after the previous one finished", r.opts.Name, due.Format(time.RFC3339), r.opts.IntervalAfterRun)
+		return "interval"
+	}
+	return ""
+}
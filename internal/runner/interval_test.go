@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/alswl/cron-manager/internal/testutil"
+	"github.com/spf13/afero"
+)
+
+// TestRunnerRunIntervalAfterRun tests that a run starts only once the interval elapsed after the previous one finished
+func TestRunnerRunIntervalAfterRun(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		previous    *state.RunState
+		wantSkipped string
+	}{
+		{name: "first run"},
+		{name: "due", previous: &state.RunState{FinishTime: now.Add(-16 * time.Minute)}},
+		{name: "too soon", previous: &state.RunState{FinishTime: now.Add(-5 * time.Minute)}, wantSkipped: "interval"},
+		{name: "still running", previous: &state.RunState{Running: true, PID: os.Getpid(), StartTime: now.Add(-time.Hour)},
+			wantSkipped: "running"},
+		// The process of the previous run died without recording its end
+		{name: "stale", previous: &state.RunState{Running: true, PID: 1 << 30, StartTime: now.Add(-time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateDir := t.TempDir()
+			if tt.previous != nil {
+				tt.previous.Name = "test_job"
+				if err := state.NewStore(afero.NewOsFs(), stateDir).Save(*tt.previous); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mem := testutil.NewMemExporter()
+			marker := filepath.Join(t.TempDir(), "ran")
+			opts := newTestOptions(mem, "touch", marker)
+			opts.StateDir = stateDir
+			opts.IntervalAfterRun = 15 * time.Minute
+			opts.Clock = testutil.NewFakeClock(now)
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %q, want %q", result.Skipped, tt.wantSkipped)
+			}
+			if _, err := os.Stat(marker); (err == nil) != (tt.wantSkipped == "") {
+				t.Errorf("command ran = %v, want %v", err == nil, tt.wantSkipped == "")
+			}
+			if tt.wantSkipped != "" {
+				series := `crontab_runs_total{name="test_job",status="skipped_` + tt.wantSkipped + `"}`
+				if value, _ := mem.Value(series); value != "1" {
+					t.Errorf("%s = %q, want 1", series, value)
+				}
+			}
+		})
+	}
+}
+
+// TestRunnerOptionsIntervalAfterRun tests that the interval requires a state directory
+func TestRunnerOptionsIntervalAfterRun(t *testing.T) {
+	opts := newTestOptions(testutil.NewMemExporter(), "true")
+	opts.IntervalAfterRun = time.Minute
+	if _, err := NewRunner(opts); err == nil {
+		t.Error("NewRunner() without a state directory error = nil, want an error")
+	}
+}
@@ -0,0 +1,31 @@
+package runner
+
+import (
+	"context"
+	"log"
+
+	"github.com/alswl/cron-manager/internal/inventory"
+)
+
+// pushInventory pushes the jobs of the registry to the central inventory if the last push of the host is older
+// than its interval, whichever job runs first. Failures are logged and retried by the next run of any job.
+func (r *Runner) pushInventory() {
+	now := r.clock.Now()
+	jobs, previous, due, err := r.jobs.ClaimPush(now, r.opts.Inventory.Interval())
+	if err != nil {
+		log.Printf("Failed to push the job inventory: %v", err)
+		return
+	}
+	if !due {
+		return
+	}
+	payload := inventory.Payload{Host: inventory.CurrentHost(), SentAt: now, Jobs: jobs}
+	if err := r.opts.Inventory.Push(context.Background(), payload); err != nil {
+		log.Printf("Failed to push the job inventory: %v", err)
+		if err := r.jobs.ReleasePush(previous); err != nil {
+			log.Printf("Failed to record the failed push of the job inventory: %v", err)
+		}
+		return
+	}
+	r.logf("Pushed the inventory of %d jobs", len(jobs))
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/alswl/cron-manager/internal/lease"
+)
+
+// Causes of a lease not acquired or lost
+const (
+	leaseHeld  = "held"
+	leaseError = "error"
+	leaseLost  = "lost"
+)
+
+// acquireLease takes the Lease of the job. It returns false if the run must be skipped, and otherwise a
+// function releasing the lease once the run finished.
+func (r *Runner) acquireLease() (release func(), ok bool) {
+	if r.opts.Lease == nil {
+		return func() {}, true
+	}
+	holding, err := r.opts.Lease.Acquire()
+	if err != nil {
+		// Without the lease the job could run on two hosts, so failures never start it
+		var heldErr *lease.HeldError
+		if errors.As(err, &heldErr) {
+			r.logf("Skipping job %s, %v", r.opts.Name, err)
+			r.countLeaseFailure(leaseHeld)
+		} else {
+			log.Printf("Skipping job %s, failed to acquire lease %s: %v", r.opts.Name, r.opts.Lease.Path(), err)
+			r.countLeaseFailure(leaseError)
+		}
+		return nil, false
+	}
+	r.logf("Acquired lease %s with fencing token %d", r.opts.Lease.Path(), holding.Token())
+	r.exp.WriteGauge("lease_fencing_token", r.opts.Name, strconv.FormatUint(holding.Token(), 10), helpLeaseToken)
+	r.lease = holding
+	return func() {
+		select {
+		case <-holding.Lost():
+			log.Printf("Lost lease %s of job %s: %v", r.opts.Lease.Path(), r.opts.Name, holding.Err())
+			r.countLeaseFailure(leaseLost)
+		default:
+		}
+		if err := holding.Release(); err != nil {
+			log.Printf("Failed to release lease %s: %v", r.opts.Lease.Path(), err)
+		}
+	}, true
+}
+
+// leaseEnv passes the fencing token of the lease to the command in env, nil being the environment of cronmgr
+func (r *Runner) leaseEnv(env []string) []string {
+	if r.lease == nil {
+		return env
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(env, lease.TokenEnv+"="+strconv.FormatUint(r.lease.Token(), 10))
+}
+
+// fenceAttempt stops cmd if the lease is lost before it exited, so it never runs alongside the next holder.
+// The returned channel is closed once the watch ended, with fenced set if cmd was stopped.
+func (r *Runner) fenceAttempt(cmd *exec.Cmd, exited <-chan struct{}, fenced *bool) <-chan struct{} {
+	done := make(chan struct{})
+	if r.lease == nil {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		select {
+		case <-exited:
+		case <-r.lease.Lost():
+			r.stop(cmd, "its lease was lost", exited)
+			*fenced = true
+		}
+	}()
+	return done
+}
+
+// countLeaseFailure counts a lease that could not be acquired or was lost, by cause
+func (r *Runner) countLeaseFailure(cause string) {
+	r.exp.IncrementCounter("lease_failures_total", r.opts.Name, map[string]string{"cause": cause}, helpLeaseFailures)
+}
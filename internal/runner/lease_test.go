@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/lease"
+	"github.com/alswl/cron-manager/internal/testutil"
+	"github.com/spf13/afero"
+)
+
+// TestRunnerRunLease tests that the command gets the fencing token of the lease, released after the run
+func TestRunnerRunLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.lease")
+	out := filepath.Join(t.TempDir(), "token")
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.WriteScript(t, "token.sh", `printf '%s' "$`+lease.TokenEnv+`" > `+out))
+	opts.Lease = lease.New(afero.NewOsFs(), path, "host-a:1", time.Minute)
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	result, err := r.Run()
+	if err != nil || result.Failed() {
+		t.Fatalf("Run() = %+v, %v", result, err)
+	}
+	if token, _ := os.ReadFile(out); string(token) != "1" {
+		t.Errorf("%s = %q, want 1", lease.TokenEnv, token)
+	}
+	if value, _ := mem.Value(`crontab_lease_fencing_token{name="test_job"}`); value != "1" {
+		t.Errorf("lease_fencing_token = %q, want 1", value)
+	}
+
+	next, err := lease.New(afero.NewOsFs(), path, "host-b:1", time.Minute).Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() after the run error = %v", err)
+	}
+	defer func() { _ = next.Release() }()
+	if next.Token() != 2 {
+		t.Errorf("Token() = %d, want 2", next.Token())
+	}
+}
+
+// TestRunnerRunLeaseHeld tests that a run whose lease is held by another host is skipped
+func TestRunnerRunLeaseHeld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.lease")
+	other, err := lease.New(afero.NewOsFs(), path, "host-b:1", time.Minute).Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = other.Release() }()
+
+	mem := testutil.NewMemExporter()
+	marker := filepath.Join(t.TempDir(), "ran")
+	opts := newTestOptions(mem, "touch", marker)
+	opts.Lease = lease.New(afero.NewOsFs(), path, "host-a:1", time.Minute)
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	result, err := r.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Skipped != "lease" {
+		t.Errorf("Skipped = %q, want lease", result.Skipped)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected the command not to run")
+	}
+	if value, _ := mem.Value(`crontab_lease_failures_total{name="test_job",cause="held"}`); value != "1" {
+		t.Errorf("lease_failures_total{cause=\"held\"} = %q, want 1", value)
+	}
+}
+
+// TestRunnerRunLeaseLost tests that the command is stopped when another host takes the lease over
+func TestRunnerRunLeaseLost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.lease")
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, "sleep", "10")
+	opts.Lease = lease.New(afero.NewOsFs(), path, "host-a:1", 300*time.Millisecond)
+	opts.Retries = 2
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	go func() {
+		// Another host takes the lease over, as after a partition hid the renewals
+		time.Sleep(50 * time.Millisecond)
+		record := `{"holder":"host-b:1","token":7,"expires":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`
+		_ = os.WriteFile(path, []byte(record), 0644)
+	}()
+
+	start := time.Now()
+	result, err := r.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %v, expected the command to be stopped", elapsed)
+	}
+	if result.TimedOut != "lease" || result.Attempts != 1 {
+		t.Errorf("TimedOut = %q after %d attempts, want lease after 1", result.TimedOut, result.Attempts)
+	}
+	if value, _ := mem.Value(`crontab_lease_failures_total{name="test_job",cause="lost"}`); value != "1" {
+		t.Errorf("lease_failures_total{cause=\"lost\"} = %q, want 1", value)
+	}
+	if content, _ := os.ReadFile(path); !strings.Contains(string(content), "host-b:1") {
+		t.Errorf("Expected the lease of the new holder to be kept, got %s", content)
+	}
+}
@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/alswl/cron-manager/internal/history"
+)
+
+// DefaultMQTTTopic is the topic the results are published to when none is configured
+const DefaultMQTTTopic = "cron/{host}/{job}/result"
+
+// mqttResult is the message published for a run: its history record and the host it ran on
+type mqttResult struct {
+	Host string `json:"host"`
+	history.Record
+}
+
+// publishResult publishes the result of the run to the MQTT broker, failures are logged but do not fail the run
+func (r *Runner) publishResult(record history.Record) {
+	host := hostname()
+	topic := r.opts.MQTTTopic
+	if topic == "" {
+		topic = DefaultMQTTTopic
+	}
+	// + and # are wildcards and / separates levels, none of them may appear in a level of the topic
+	level := strings.NewReplacer("/", "_", "+", "_", "#", "_")
+	topic = strings.NewReplacer("{host}", level.Replace(host), "{job}", level.Replace(record.Name)).Replace(topic)
+
+	payload, err := json.Marshal(mqttResult{Host: host, Record: record})
+	if err != nil {
+		log.Printf("Failed to publish the result to MQTT: %v", err)
+		return
+	}
+	if err := r.opts.MQTT.Publish(context.Background(), topic, payload); err != nil {
+		log.Printf("Failed to publish the result to MQTT: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/logwriter"
+	"github.com/alswl/cron-manager/internal/notify"
+)
+
+// hostname returns the name of the host, logging why if it is unknown
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		log.Printf("Failed to get the host name: %v", err)
+	}
+	return host
+}
+
+// logTailLines is the number of output lines passed to notifications
+const logTailLines = 20
+
+// logTailBytes bounds the end of the log file read for the log tail of notifications
+const logTailBytes = 64 * 1024
+
+// notify sends the run finished at now to the notifiers of its severity if it failed, within the notification limits.
+// A successful run is only notified when failures were batched before it. Failures are logged but
+// do not fail the run.
+func (r *Runner) notify(result Result, now time.Time) {
+	record := r.record(result, now)
+	msg := notify.Message{
+		Name:            record.Name,
+		RunID:           record.RunID,
+		Status:          record.Status,
+		ErrorType:       record.ErrorType,
+		Severity:        result.Severity,
+		ExitCode:        record.ExitCode,
+		Attempts:        record.Attempts,
+		StartTime:       record.StartTime,
+		DurationSeconds: record.DurationSeconds,
+		LogFile:         record.LogFile,
+		CoreFile:        result.CoreFile,
+		BacktraceFile:   result.BacktraceFile,
+	}
+	failed := record.Status == "failed"
+	notifiers := r.opts.Notifiers
+	if failed {
+		if notifiers = r.notifiers(result.Severity); len(notifiers) == 0 {
+			r.logf("Failure of severity %s not notified, it is routed to no notifier", result.Severity)
+			return
+		}
+	}
+	var digest notify.Digest
+	switch {
+	case r.limiter == nil && !failed:
+		return
+	case r.limiter == nil:
+		r.countNotification(notify.Sent)
+	case failed:
+		decision, d, err := r.limiter.Failure(record.Name, now)
+		if err != nil {
+			// Rather notify too much than lose a failure
+			log.Printf("Failed to apply notification limits: %v", err)
+			decision = notify.Sent
+		}
+		r.countNotification(decision)
+		if decision != notify.Sent {
+			r.logf("Notification of the failure %s by the notification limits", decision)
+			return
+		}
+		digest = d
+	default:
+		d, ok, err := r.limiter.Recovery(record.Name, now)
+		if err != nil {
+			log.Printf("Failed to apply notification limits: %v", err)
+		}
+		if !ok {
+			return
+		}
+		digest = d
+	}
+	msg.Batched, msg.BatchedSince = digest.Count, digest.Since
+
+	msg.Host = hostname()
+	msg.LogTail = r.outputTail(result)
+	r.deliver(notifiers, msg)
+}
+
+// warnTimeout warns the notifiers that the running attempt of result is killed by limit in remaining,
+// bypassing the notification limits which only apply to failures
+func (r *Runner) warnTimeout(result Result, limit string, remaining time.Duration) {
+	log.Printf("Job %s reached %d%% of its %s limit, it is killed in %v", r.opts.Name, r.opts.TimeoutWarning, limit, remaining)
+	if len(r.opts.Notifiers) == 0 {
+		return
+	}
+	r.deliver(r.opts.Notifiers, notify.Message{
+		Name:            r.opts.Name,
+		Host:            hostname(),
+		RunID:           result.RunID,
+		Status:          "running",
+		Attempts:        result.Attempts,
+		StartTime:       result.StartTime,
+		DurationSeconds: r.clock.Since(result.StartTime).Seconds(),
+		LogFile:         result.LogFile,
+		Limit:           limit,
+		KillInSeconds:   remaining.Seconds(),
+	})
+}
+
+// deliver renders msg and sends it to notifiers, counting the failed deliveries
+func (r *Runner) deliver(notifiers []notify.Notifier, msg notify.Message) {
+	if r.opts.NotifyRunURL != "" {
+		msg.RunURL = notify.RunURL(r.opts.NotifyRunURL, msg)
+	}
+	if r.opts.NotifyTemplate != nil {
+		if err := r.opts.NotifyTemplate.Apply(&msg); err != nil {
+			log.Printf("Failed to render the notification template, using the default text: %v", err)
+		}
+	}
+	err := notify.Deliver(context.Background(), notifiers, msg, r.opts.NotifyFallback, func(n notify.Notifier, err error) {
+		log.Printf("Failed to send %s notification: %v", n.Channel(), err)
+		r.exp.IncrementCounter("notification_failures_total", r.opts.Name, map[string]string{"channel": n.Channel()}, helpNotifyFailures)
+	})
+	if err != nil {
+		log.Printf("The notification of job %s was not delivered", r.opts.Name)
+		r.exp.IncrementCounter("notifications_undelivered_total", r.opts.Name, nil, helpUndelivered)
+	}
+}
+
+// countNotification counts the notification of a failed run by decision
+func (r *Runner) countNotification(decision notify.Decision) {
+	r.exp.IncrementCounter("notifications_total", r.opts.Name, map[string]string{"result": string(decision)}, helpNotifications)
+}
+
+// outputTail returns the last lines of the output of the run: the captured output, or the end
+// of the log file. The output of encrypted log files is not sent in notifications.
+func (r *Runner) outputTail(result Result) string {
+	content := result.Output
+	if result.LogFile != "" {
+		if r.opts.Cipher != nil {
+			return ""
+		}
+		file, err := logwriter.Open(result.LogFile)
+		if err != nil {
+			log.Printf("Failed to read the log tail: %v", err)
+			return ""
+		}
+		defer func() { _ = file.Close() }()
+		// Seek close to the end of plain log files, compressed or chunked ones are read through
+		if seeker, ok := file.(io.Seeker); ok {
+			if size, err := seeker.Seek(0, io.SeekEnd); err == nil {
+				_, _ = seeker.Seek(max(size-logTailBytes, 0), io.SeekStart)
+			}
+		}
+		tail := newTailBuffer(logTailBytes)
+		if _, err := io.Copy(tail, file); err != nil {
+			log.Printf("Failed to read the log tail: %v", err)
+		}
+		content = tail.Bytes()
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	return strings.Join(lines[max(len(lines)-logTailLines, 0):], "\n")
+}
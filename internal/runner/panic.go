@@ -0,0 +1,27 @@
+package runner
+
+import (
+	"log"
+)
+
+// recoverPanic writes the final metrics of a run cronmgr panicked during, then panics again with the same
+// value. Without them the run would keep reporting running=1 and the outcome of the previous run. The run is
+// counted in runs_total with the internal_error error type. Panics in other goroutines cannot be recovered.
+func (r *Runner) recoverPanic() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	log.Printf("cronmgr panicked while running job %s, recording it as failed: %v", r.opts.Name, v)
+	name := r.opts.Name
+	r.exp.IncrementCounter("runs_total", name, map[string]string{"status": "failed", "error_type": "internal_error"}, helpRunsTotal)
+	r.exp.WriteGauge("failed", name, "1", helpFailed)
+	r.exp.WriteGauge("running", name, "0", helpRunning)
+	r.exp.WriteGauge("last_run_timestamp_seconds", name, r.formatTimestamp(r.clock.Now()), helpLastRun)
+	if r.opts.LegacyMetrics {
+		r.exp.WriteLegacy(name, "failed", "1")
+		r.exp.WriteLegacy(name, "run", "0")
+	}
+	r.clearIntent()
+	panic(v)
+}
@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// TestRecoverPanic tests that a panic during a run writes the metrics of a failed run and is raised again
+func TestRecoverPanic(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	r, err := NewRunner(newTestOptions(mem, "true"))
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	r.writeStarted(r.newResult())
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("recovered %v, want the panic raised again", v)
+			}
+		}()
+		defer r.recoverPanic()
+		panic("boom")
+	}()
+
+	content := mem.Content()
+	for _, want := range []string{
+		`crontab_failed{name="test_job"} 1`,
+		`crontab_running{name="test_job"} 0`,
+		`crontab_runs_total{name="test_job",error_type="internal_error",status="failed"} 1`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("metrics missing %s:\n%s", want, content)
+		}
+	}
+}
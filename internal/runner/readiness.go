@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"time"
+)
+
+// readinessInterval is how often the readiness checks are polled while the start waits for them
+const readinessInterval = 5 * time.Second
+
+// waitReadiness polls the readiness checks until they all pass or ReadinessTimeout is exceeded.
+// It returns the reason of the failing check if the run must be skipped, empty otherwise.
+func (r *Runner) waitReadiness() string {
+	if len(r.opts.Readiness) == 0 {
+		return ""
+	}
+	start := r.clock.Now()
+	deadline := start.Add(r.opts.ReadinessTimeout)
+	defer func() {
+		r.exp.WriteGauge("readiness_wait_seconds", r.opts.Name, r.formatSeconds(r.clock.Since(start)), helpReadinessWait)
+	}()
+	for _, check := range r.opts.Readiness {
+		for {
+			ready, detail, err := check.Ready()
+			if err != nil {
+				detail = err.Error()
+			}
+			if ready && err == nil {
+				break
+			}
+			if !r.clock.Now().Before(deadline) {
+				r.logf("Skipping job %s: %s", r.opts.Name, detail)
+				return check.Reason()
+			}
+			r.logf("Waiting for job %s: %s", r.opts.Name, detail)
+			r.clock.Sleep(min(readinessInterval, deadline.Sub(r.clock.Now())))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/precheck"
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// fakeReadiness is a readiness check that passes after failing a number of times
+type fakeReadiness struct {
+	failures int
+	calls    int
+}
+
+func (c *fakeReadiness) Reason() string { return "dependency" }
+
+func (c *fakeReadiness) Ready() (bool, string, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return false, "", errors.New("connection refused")
+	}
+	return true, "", nil
+}
+
+// TestRunnerRunReadiness tests that the start waits for the readiness checks, and is skipped after the timeout
+func TestRunnerRunReadiness(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		timeout     time.Duration
+		wantSkipped string
+		wantDelay   time.Duration
+		wantStatus  string
+	}{
+		{name: "ready", timeout: time.Minute, wantStatus: "success"},
+		{name: "skip without timeout", failures: 1, wantSkipped: "dependency", wantStatus: "skipped_dependency"},
+		{name: "wait until ready", failures: 3, timeout: 2 * time.Minute, wantDelay: 15 * time.Second, wantStatus: "success"},
+		{name: "skip after timeout", failures: 100, timeout: 12 * time.Second, wantSkipped: "dependency", wantDelay: 12 * time.Second, wantStatus: "skipped_dependency"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+			clk := testutil.NewFakeClock(start)
+			mem := testutil.NewMemExporter()
+
+			opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+			opts.Readiness = []precheck.Check{&fakeReadiness{failures: tt.failures}}
+			opts.ReadinessTimeout = tt.timeout
+			opts.Clock = clk
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %q, want %q", result.Skipped, tt.wantSkipped)
+			}
+			if delay := result.StartTime.Sub(start); delay != tt.wantDelay {
+				t.Errorf("start delayed by %v, want %v", delay, tt.wantDelay)
+			}
+			if value, _ := mem.Value(`crontab_runs_total{name="test_job",status="` + tt.wantStatus + `"}`); value != "1" {
+				t.Errorf("runs_total{status=%q} = %q, want 1", tt.wantStatus, value)
+			}
+			wantWait := strconv.FormatFloat(tt.wantDelay.Seconds(), 'f', 2, 64)
+			if value, _ := mem.Value(`crontab_readiness_wait_seconds{name="test_job"}`); value != wantWait {
+				t.Errorf("readiness_wait_seconds = %q, want %s", value, wantWait)
+			}
+		})
+	}
+}
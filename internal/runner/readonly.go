@@ -0,0 +1,50 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/alswl/cron-manager/internal/fswatch"
+)
+
+// watchReadOnly starts watching ReadOnlyPaths for changes during the run of result, nil without them.
+// The files cronmgr writes itself and the directories given to the command are ignored.
+func (r *Runner) watchReadOnly(result Result, ignore ...string) (*fswatch.Watcher, error) {
+	if len(r.opts.ReadOnlyPaths) == 0 {
+		return nil, nil
+	}
+	ignore = append(ignore, result.LogFile, result.ErrorLogFile, r.opts.StateDir, r.opts.SpoolDir, r.opts.FallbackDir)
+	if r.opts.CheckpointDir != "" {
+		ignore = append(ignore, r.checkpointPath())
+	}
+	if !r.exp.IsMetricDisabled() {
+		// The textfile is replaced by a temporary file written next to it
+		ignore = append(ignore, filepath.Dir(r.exp.GetExporterPath()))
+	}
+	var ignored []string
+	for _, path := range ignore {
+		if path != "" {
+			ignored = append(ignored, path)
+		}
+	}
+	w, err := fswatch.Watch(r.opts.ReadOnlyPaths, ignored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch read-only paths: %w", err)
+	}
+	return w, nil
+}
+
+// finishReadOnly stops the watcher and fails the run of result if a read-only path changed
+func (r *Runner) finishReadOnly(w *fswatch.Watcher, result *Result) {
+	if w == nil {
+		return
+	}
+	result.ReadOnlyChanges, result.ReadOnlyChangeCount = w.Stop()
+	for _, change := range result.ReadOnlyChanges {
+		log.Printf("Job %s changed read-only path: %s", r.opts.Name, change)
+	}
+	if more := result.ReadOnlyChangeCount - len(result.ReadOnlyChanges); more > 0 {
+		log.Printf("Job %s changed %d more read-only paths", r.opts.Name, more)
+	}
+}
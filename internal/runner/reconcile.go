@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/state"
+)
+
+// Reconcile clears the running flag of jobs whose recorded process no longer exists.
+// Such runs were interrupted between writing running=1 and running=0, e.g. cronmgr was killed,
+// so their gauge would otherwise stay 1 forever. The runs are marked incomplete in the store,
+// so the next run of the job still reports them, and the runs whose intent they left are counted as
+// unreported. Only jobs of the exporter's owner are reconciled, the metrics of other owners live in their
+// own files. It returns the reconciled states, and an error if their gauges could not be written.
+func Reconcile(store *state.Store, exp *exporter.Exporter) ([]state.RunState, error) {
+	states, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var reconciled []state.RunState
+	for _, runState := range states {
+		if runState.Owner != exp.Owner() || !runState.Stale() {
+			continue
+		}
+		log.Printf("Clearing running flag of job %s, its process %d started at %s no longer exists", runState.Name, runState.PID, runState.StartTime.Format(time.RFC3339))
+		exp.WriteGauge("running", runState.Name, "0", helpRunning)
+		runState.Running = false
+		runState.Incomplete = true
+		if err := store.Save(runState); err != nil {
+			return reconciled, err
+		}
+		reconciled = append(reconciled, runState)
+	}
+	if err := reconcileIntents(store, exp); err != nil {
+		return reconciled, err
+	}
+	if err := exp.Err(); err != nil {
+		return reconciled, fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return reconciled, nil
+}
+
+// reconcileIntents counts the runs whose intent was left by a process that no longer exists in
+// unreported_runs_total. Each intent is removed before its run is counted, so concurrent reconciliations
+// count it once.
+func reconcileIntents(store *state.Store, exp *exporter.Exporter) error {
+	intents, err := store.Intents()
+	if err != nil {
+		return err
+	}
+	for _, intent := range intents {
+		if intent.Owner != exp.Owner() || !intent.Stale() {
+			continue
+		}
+		claimed, err := store.ClaimIntent(intent)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		log.Printf("Run %s of job %s started by process %d at %s was never reported", intent.RunID, intent.Name, intent.PID, intent.StartTime.Format(time.RFC3339))
+		exp.IncrementCounter("unreported_runs_total", intent.Name, nil, helpUnreported)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package runner
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/alswl/cron-manager/internal/testutil"
+	"github.com/spf13/afero"
+)
+
+// TestReconcile tests that only runs of exited processes are cleared
+func TestReconcile(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	mem := testutil.NewMemExporter()
+	exp := exporter.NewExporter(mem.Options()...)
+	store := state.NewStore(afero.NewMemMapFs(), "/state")
+
+	states := []state.RunState{
+		{Name: "killed", PID: exitedPID(t), Running: true, StartTime: start},
+		{Name: "running", PID: os.Getpid(), Running: true, StartTime: start},
+		{Name: "finished", PID: exitedPID(t), StartTime: start, FinishTime: start},
+		{Name: "other_owner", Owner: "team-b", PID: exitedPID(t), Running: true, StartTime: start},
+	}
+	for _, runState := range states {
+		if err := store.Save(runState); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		exp.WriteGauge("running", runState.Name, "1", helpRunning)
+	}
+
+	reconciled, err := Reconcile(store, exp)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(reconciled) != 1 || reconciled[0].Name != "killed" {
+		t.Fatalf("Reconcile() = %+v, want only the killed job", reconciled)
+	}
+
+	tests := []struct {
+		name           string
+		wantRunning    string
+		wantIncomplete bool
+	}{
+		{name: "killed", wantRunning: "0", wantIncomplete: true},
+		{name: "running", wantRunning: "1"},
+		{name: "finished", wantRunning: "1"},
+		{name: "other_owner", wantRunning: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if value, _ := mem.Value(`crontab_running{name="` + tt.name + `"}`); value != tt.wantRunning {
+				t.Errorf("running = %v, want %v", value, tt.wantRunning)
+			}
+			runState, _, err := store.Load(tt.name)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if runState.Incomplete != tt.wantIncomplete {
+				t.Errorf("Incomplete = %v, want %v", runState.Incomplete, tt.wantIncomplete)
+			}
+		})
+	}
+}
+
+// TestReconcileMetricsError tests that the runs are reconciled, and the failure reported, when their gauge
+// cannot be written
+func TestReconcileMetricsError(t *testing.T) {
+	store := state.NewStore(afero.NewMemMapFs(), "/state")
+	if err := store.Save(state.RunState{Name: "killed", PID: exitedPID(t), Running: true, StartTime: time.Now()}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	exp := exporter.NewExporter(exporter.WithFileSystem(afero.NewReadOnlyFs(afero.NewMemMapFs())), exporter.WithExporterDir("/metrics"))
+
+	reconciled, err := Reconcile(store, exp)
+	if err == nil {
+		t.Error("Reconcile() should fail when the metrics cannot be written")
+	}
+	if len(reconciled) != 1 {
+		t.Errorf("Reconcile() = %+v, want the killed job reconciled", reconciled)
+	}
+}
+
+// TestReconcileIntents tests that the runs left unreported by exited processes are counted once
+func TestReconcileIntents(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	mem := testutil.NewMemExporter()
+	exp := exporter.NewExporter(mem.Options()...)
+	store := state.NewStore(afero.NewMemMapFs(), "/state")
+
+	intents := []state.Intent{
+		{Name: "killed", RunID: "20240101T020000Z-1", PID: exitedPID(t), StartTime: start},
+		{Name: "killed", RunID: "20240101T030000Z-2", PID: exitedPID(t), StartTime: start.Add(time.Hour)},
+		{Name: "running", RunID: "20240101T020000Z-3", PID: os.Getpid(), StartTime: start},
+		{Name: "other_owner", Owner: "team-b", RunID: "20240101T020000Z-4", PID: exitedPID(t), StartTime: start},
+	}
+	for _, intent := range intents {
+		if err := store.WriteIntent(intent); err != nil {
+			t.Fatalf("WriteIntent() error = %v", err)
+		}
+	}
+
+	for range 2 {
+		if _, err := Reconcile(store, exp); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	if value, _ := mem.Value(`crontab_unreported_runs_total{name="killed"}`); value != "2" {
+		t.Errorf("unreported_runs_total of killed = %v, want 2", value)
+	}
+	for _, name := range []string{"running", "other_owner"} {
+		if value, found := mem.Value(`crontab_unreported_runs_total{name="` + name + `"}`); found {
+			t.Errorf("unreported_runs_total of %s = %v, want none", name, value)
+		}
+	}
+	left, err := store.Intents()
+	if err != nil {
+		t.Fatalf("Intents() error = %v", err)
+	}
+	if len(left) != 2 {
+		t.Errorf("Intents() = %+v, want the running and other owner intents kept", left)
+	}
+}
@@ -0,0 +1,24 @@
+package runner
+
+import "log"
+
+// checkRequiredFiles returns why the first of the RequiredFiles is missing or stale, empty if they are all
+// present and fresh
+func (r *Runner) checkRequiredFiles() string {
+	for _, check := range r.opts.RequiredFiles {
+		if ready, detail, _ := check.Ready(); !ready {
+			return detail
+		}
+	}
+	return ""
+}
+
+// failStaleInput records a run failed because its input is missing or stale, without starting the command
+func (r *Runner) failStaleInput(detail string) Result {
+	log.Printf("Failing job %s: %s", r.opts.Name, detail)
+	result := r.newResult()
+	result.StaleInput = detail
+	result.Severity = r.severity(result)
+	r.writeFinished(result)
+	return result
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/precheck"
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// TestRunnerRunRequiredFiles tests that a missing or stale input skips or fails the run without starting it
+func TestRunnerRunRequiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	fresh := filepath.Join(dir, "fresh.csv")
+	stale := filepath.Join(dir, "stale.csv")
+	for _, path := range []string{fresh, stale} {
+		if err := os.WriteFile(path, []byte("id\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-26 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		fail        bool
+		wantRan     bool
+		wantSkipped string
+		wantSeries  string
+	}{
+		{name: "fresh", path: fresh, wantRan: true, wantSeries: `crontab_runs_total{name="test_job",status="success"}`},
+		{name: "stale skipped", path: stale, wantSkipped: "stale_input", wantSeries: `crontab_runs_total{name="test_job",status="skipped_stale_input"}`},
+		{name: "missing skipped", path: filepath.Join(dir, "missing.csv"), wantSkipped: "stale_input", wantSeries: `crontab_runs_total{name="test_job",status="skipped_stale_input"}`},
+		{name: "stale failed", path: stale, fail: true, wantSeries: `crontab_runs_total{name="test_job",error_type="stale_input",status="failed"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			marker := filepath.Join(t.TempDir(), "ran")
+			opts := newTestOptions(mem, "touch", marker)
+			opts.RequiredFiles = []precheck.FileCheck{{Path: tt.path, MaxAge: 2 * time.Hour}}
+			opts.FailOnStaleInput = tt.fail
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %q, want %q", result.Skipped, tt.wantSkipped)
+			}
+			if result.Failed() != tt.fail {
+				t.Errorf("Failed() = %v, want %v", result.Failed(), tt.fail)
+			}
+			if _, err := os.Stat(marker); (err == nil) != tt.wantRan {
+				t.Errorf("command ran = %v, want %v", err == nil, tt.wantRan)
+			}
+			if value, _ := mem.Value(tt.wantSeries); value != "1" {
+				t.Errorf("%s = %q, want 1, got:\n%s", tt.wantSeries, value, mem.Content())
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/events"
+	"github.com/alswl/cron-manager/internal/job"
+	"github.com/alswl/cron-manager/internal/logwriter"
+)
+
+// Limits that end an attempt by killing the command
+const (
+	// limitAttempt is the timeout of a single attempt
+	limitAttempt = "attempt"
+	// limitDeadline is the overall deadline of the run, covering all attempts and retry delays
+	limitDeadline = "deadline"
+	// limitLease is the lease of the run, lost when it could not be renewed
+	limitLease = "lease"
+)
+
+// attempt runs a prepared command once and records its outcome in result. The command is killed
+// when the attempt timeout or the overall deadline is reached, whichever comes first, or the lease is lost.
+func (r *Runner) attempt(cmd *exec.Cmd, logWriter *logwriter.LogWriter, deadline time.Time, result *Result) error {
+	result.ExitStatus = job.ExitStatus{}
+	result.ExecError = ""
+	result.TimedOut = ""
+
+	timeout, limit := r.attemptLimit(deadline)
+	if timeout > 0 || r.lease != nil {
+		// Kill the processes spawned by the command too, they would keep the output pipes open
+		job.SetProcessGroup(cmd)
+	}
+
+	// Catch the shutdown signals before the command starts, cronmgr must not die without stopping it
+	shutdown, restore := r.trapShutdown()
+	defer restore()
+
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		result.ExecError = r.reportExecError(cmd.Path, err)
+		return nil
+	}
+	if r.opts.Health != nil {
+		r.opts.Health.Started(cmd.Process.Pid, result.Attempts)
+	}
+
+	exited := make(chan struct{})
+	watchDone := make(chan struct{})
+	var timedOut string
+	var warned sync.WaitGroup
+	approaching := false
+	if timeout > 0 {
+		warning := r.timeoutWarning(timeout, limit)
+		go func() {
+			defer close(watchDone)
+			if warning >= 0 {
+				select {
+				case <-exited:
+					return
+				case <-r.clock.After(warning):
+					approaching = true
+					r.exp.WriteGauge("timeout_approaching", r.opts.Name, "1", helpApproaching)
+					// The kill must not wait for slow notifiers
+					warned.Add(1)
+					go func() {
+						defer warned.Done()
+						r.warnTimeout(*result, limit, timeout-warning)
+					}()
+				}
+			}
+			select {
+			case <-exited:
+			case <-r.clock.After(timeout - max(warning, 0)):
+				r.stop(cmd, fmt.Sprintf("its %s limit of %v was reached", limit, timeout), exited)
+				timedOut = limit
+			}
+		}()
+	} else {
+		close(watchDone)
+	}
+
+	var fenced bool
+	fenceDone := r.fenceAttempt(cmd, exited, &fenced)
+	shutdownDone := r.stopOnShutdown(cmd, shutdown, exited)
+
+	// Start copying stdout/stderr to log file if log writer is configured
+	if logWriter != nil {
+		logWriter.Start()
+	}
+
+	// Wait for log copying to complete first — the pipes are closed by the OS
+	// when the child process exits, so the copy goroutines will finish naturally.
+	// Waiting here before cmd.Wait() avoids a race where cmd.Wait() closes the
+	// pipe read ends while the goroutines are still reading from them.
+	if logWriter != nil {
+		if flushErr := logWriter.Wait(); flushErr != nil {
+			log.Printf("Error flushing log file: %v", flushErr)
+		}
+	}
+
+	// Wait for the command to complete and get its exit status
+	waitErr := cmd.Wait()
+	close(exited)
+	<-watchDone
+	<-fenceDone
+	<-shutdownDone
+	warned.Wait()
+	if approaching {
+		r.exp.WriteGauge("timeout_approaching", r.opts.Name, "0", helpApproaching)
+	}
+
+	status, ok := job.ExitStatusFromError(waitErr)
+	if !ok {
+		return fmt.Errorf("cmd.Wait: %w", waitErr)
+	}
+	if status.Signaled() {
+		r.logf("Command terminated by signal: %s", status.Signal)
+	}
+	result.ExitStatus = status
+	if r.opts.Health != nil {
+		r.opts.Health.Exited(status.Code)
+	}
+	if timedOut == "" && fenced {
+		timedOut = limitLease
+	}
+	if timedOut != "" {
+		result.TimedOut = timedOut
+		r.exp.IncrementCounter("timeouts_total", r.opts.Name, map[string]string{"limit": timedOut}, helpTimeouts)
+		r.emit(result.RunID, events.Event{Event: events.Timeout, Attempt: result.Attempts, Limit: timedOut})
+	}
+	return nil
+}
+
+// stop ends an attempt for reason, e.g. a limit it reached. With StopSignal the command is asked to stop
+// first and only killed if it has not exited after StopGrace.
+func (r *Runner) stop(cmd *exec.Cmd, reason string, exited <-chan struct{}) {
+	if r.opts.StopSignal != nil {
+		r.logf("Stopping job %s with %v, %s", r.opts.Name, r.opts.StopSignal, reason)
+		if err := job.Signal(cmd, r.opts.StopSignal); err != nil {
+			log.Printf("Failed to stop job %s: %v", r.opts.Name, err)
+		}
+		select {
+		case <-exited:
+			return
+		case <-r.clock.After(r.opts.StopGrace):
+		}
+		r.logf("Killing job %s, it did not stop within %v", r.opts.Name, r.opts.StopGrace)
+	} else {
+		r.logf("Killing job %s, %s", r.opts.Name, reason)
+	}
+	if err := job.Kill(cmd); err != nil {
+		log.Printf("Failed to kill job %s: %v", r.opts.Name, err)
+	}
+}
+
+// attemptLimit returns how long the next attempt may run and the limit enforcing it, 0 if unlimited
+func (r *Runner) attemptLimit(deadline time.Time) (time.Duration, string) {
+	timeout, limit := r.opts.AttemptTimeout, limitAttempt
+	if !deadline.IsZero() {
+		if remaining := deadline.Sub(r.clock.Now()); timeout <= 0 || remaining < timeout {
+			// The deadline may already be reached, the attempt is killed right away then
+			timeout, limit = max(remaining, time.Nanosecond), limitDeadline
+		}
+	}
+	return timeout, limit
+}
+
+// timeoutWarning returns when the notifiers are warned about an attempt killed after timeout by limit: once
+// TimeoutWarning percent of the limit passed, right away if they already did. It is negative without a warning.
+func (r *Runner) timeoutWarning(timeout time.Duration, limit string) time.Duration {
+	if r.opts.TimeoutWarning <= 0 {
+		return -1
+	}
+	total := r.opts.AttemptTimeout
+	if limit == limitDeadline {
+		total = r.opts.OverallDeadline
+	}
+	// Warn when the remaining time falls below the share of the limit left after the warning
+	return max(timeout-total*time.Duration(100-r.opts.TimeoutWarning)/100, 0)
+}
+
+// retryable reports whether a failed attempt is retried after delay. Commands that could not be
+// executed are not retried, nor are exit codes outside RetryOnExitCodes, and no attempt starts
+// after the overall deadline or RetryMaxElapsed.
+func (r *Runner) retryable(result Result, deadline time.Time, delay time.Duration) bool {
+	switch {
+	case !result.Failed() || result.ExecError != "":
+		return false
+	case result.Attempts > r.opts.Retries:
+		return false
+	case result.TimedOut == limitDeadline || result.TimedOut == limitLease:
+		return false
+	case r.shutdown != nil:
+		r.logf("Not retrying job %s, cronmgr received %v", r.opts.Name, r.shutdown)
+		return false
+	case len(r.opts.RetryOnExitCodes) > 0 && result.TimedOut == "" && !slices.Contains(r.opts.RetryOnExitCodes, result.ExitStatus.Code):
+		r.logf("Not retrying job %s, exit code %d is not a retried exit code", r.opts.Name, result.ExitStatus.Code)
+		return false
+	case r.opts.RetryMaxElapsed > 0 && r.clock.Since(result.StartTime)+delay > r.opts.RetryMaxElapsed:
+		r.logf("Not retrying job %s, the next attempt would start after the retry max elapsed time of %v", r.opts.Name, r.opts.RetryMaxElapsed)
+		return false
+	case !deadline.IsZero() && !r.clock.Now().Add(delay).Before(deadline):
+		r.logf("Not retrying job %s, its overall deadline is reached before the next attempt", r.opts.Name)
+		return false
+	}
+	return true
+}
+
+// jittered shortens delay by up to the jitter fraction, using rnd in [0, 1) as the random factor
+func jittered(delay time.Duration, jitter float64, rnd float64) time.Duration {
+	return delay - time.Duration(float64(delay)*jitter*rnd)
+}
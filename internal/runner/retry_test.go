@@ -0,0 +1,274 @@
+package runner
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/notify"
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+func TestRunnerRunRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       func(t *testing.T) string
+		opts         RunnerOptions
+		wantFailed   bool
+		wantAttempts int
+		wantTimedOut string
+		wantMetrics  []string
+	}{
+		{
+			name:         "succeeds_after_retries",
+			script:       func(t *testing.T) string { return testutil.FailingScript(t, 2, 75) },
+			opts:         RunnerOptions{Retries: 3},
+			wantAttempts: 3,
+			wantMetrics: []string{
+				`crontab_attempts{name="test_job"} 3`,
+				`crontab_runs_total{name="test_job",status="success"} 1`,
+			},
+		},
+		{
+			name:         "retries_exhausted",
+			script:       func(t *testing.T) string { return testutil.FailingScript(t, 5, 75) },
+			opts:         RunnerOptions{Retries: 2, RetryDelay: time.Millisecond},
+			wantFailed:   true,
+			wantAttempts: 3,
+			wantMetrics: []string{
+				`crontab_attempts{name="test_job"} 3`,
+				`crontab_exit_code{name="test_job"} 75`,
+			},
+		},
+		{
+			name:         "retried_exit_code",
+			script:       func(t *testing.T) string { return testutil.FailingScript(t, 1, 75) },
+			opts:         RunnerOptions{Retries: 2, RetryOnExitCodes: []int{75, 111}},
+			wantAttempts: 2,
+		},
+		{
+			name:         "exit_code_not_retried",
+			script:       func(t *testing.T) string { return testutil.FailingScript(t, 1, 75) },
+			opts:         RunnerOptions{Retries: 2, RetryOnExitCodes: []int{111}},
+			wantFailed:   true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry_max_elapsed",
+			script:       func(t *testing.T) string { return testutil.FailingScript(t, 1, 75) },
+			opts:         RunnerOptions{Retries: 2, RetryDelay: time.Hour, RetryMaxElapsed: time.Minute},
+			wantFailed:   true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "attempt_timeout",
+			script:       func(t *testing.T) string { return testutil.WriteScript(t, "slow.sh", "sleep 30") },
+			opts:         RunnerOptions{Retries: 1, AttemptTimeout: 100 * time.Millisecond},
+			wantFailed:   true,
+			wantAttempts: 2,
+			wantTimedOut: limitAttempt,
+			wantMetrics: []string{
+				`crontab_timeouts_total{name="test_job",limit="attempt"} 2`,
+				`crontab_runs_total{name="test_job",error_type="timeout",status="failed"} 1`,
+			},
+		},
+		{
+			name:         "stop_signal",
+			script:       func(t *testing.T) string { return testutil.WriteScript(t, "slow.sh", "trap 'exit 3' INT; sleep 30") },
+			opts:         RunnerOptions{AttemptTimeout: 200 * time.Millisecond, StopSignal: syscall.SIGINT, StopGrace: 10 * time.Second},
+			wantFailed:   true,
+			wantAttempts: 1,
+			wantTimedOut: limitAttempt,
+			wantMetrics: []string{
+				`crontab_exit_code{name="test_job"} 3`,
+			},
+		},
+		{
+			name:         "stop_signal_ignored",
+			script:       func(t *testing.T) string { return testutil.WriteScript(t, "slow.sh", "trap '' INT; sleep 30") },
+			opts:         RunnerOptions{AttemptTimeout: 200 * time.Millisecond, StopSignal: syscall.SIGINT, StopGrace: 100 * time.Millisecond},
+			wantFailed:   true,
+			wantAttempts: 1,
+			wantTimedOut: limitAttempt,
+			wantMetrics: []string{
+				`crontab_timeouts_total{name="test_job",limit="attempt"} 1`,
+			},
+		},
+		{
+			name:         "deadline_without_attempt_timeout",
+			script:       func(t *testing.T) string { return testutil.WriteScript(t, "slow.sh", "sleep 30") },
+			opts:         RunnerOptions{Retries: 3, OverallDeadline: 200 * time.Millisecond},
+			wantFailed:   true,
+			wantAttempts: 1,
+			wantTimedOut: limitDeadline,
+			wantMetrics: []string{
+				`crontab_timeouts_total{name="test_job",limit="deadline"} 1`,
+			},
+		},
+		{
+			name:         "deadline_ends_retries",
+			script:       func(t *testing.T) string { return testutil.WriteScript(t, "slow.sh", "sleep 30") },
+			opts:         RunnerOptions{Retries: 5, AttemptTimeout: 200 * time.Millisecond, OverallDeadline: 500 * time.Millisecond},
+			wantFailed:   true,
+			wantAttempts: 3,
+			wantTimedOut: limitDeadline,
+			wantMetrics: []string{
+				`crontab_timeouts_total{name="test_job",limit="attempt"} 2`,
+				`crontab_timeouts_total{name="test_job",limit="deadline"} 1`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, tt.script(t))
+			opts.Retries = tt.opts.Retries
+			opts.RetryDelay = tt.opts.RetryDelay
+			opts.RetryOnExitCodes = tt.opts.RetryOnExitCodes
+			opts.RetryMaxElapsed = tt.opts.RetryMaxElapsed
+			opts.AttemptTimeout = tt.opts.AttemptTimeout
+			opts.OverallDeadline = tt.opts.OverallDeadline
+			opts.StopSignal = tt.opts.StopSignal
+			opts.StopGrace = tt.opts.StopGrace
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Failed() != tt.wantFailed || result.Attempts != tt.wantAttempts || result.TimedOut != tt.wantTimedOut {
+				t.Errorf("Failed() = %v, Attempts = %d, TimedOut = %q, want %v, %d, %q",
+					result.Failed(), result.Attempts, result.TimedOut, tt.wantFailed, tt.wantAttempts, tt.wantTimedOut)
+			}
+			for _, metric := range tt.wantMetrics {
+				if !strings.Contains(mem.Content(), metric+"\n") {
+					t.Errorf("Expected metric %q, got:\n%s", metric, mem.Content())
+				}
+			}
+		})
+	}
+}
+
+func TestAttemptLimit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		attemptTimeout time.Duration
+		deadline       time.Time
+		wantTimeout    time.Duration
+		wantLimit      string
+	}{
+		{name: "unlimited", wantLimit: limitAttempt},
+		{name: "attempt_timeout", attemptTimeout: time.Minute, wantTimeout: time.Minute, wantLimit: limitAttempt},
+		{name: "deadline_later", attemptTimeout: time.Minute, deadline: start.Add(time.Hour), wantTimeout: time.Minute, wantLimit: limitAttempt},
+		{name: "deadline_sooner", attemptTimeout: time.Hour, deadline: start.Add(time.Minute), wantTimeout: time.Minute, wantLimit: limitDeadline},
+		{name: "deadline_only", deadline: start.Add(time.Minute), wantTimeout: time.Minute, wantLimit: limitDeadline},
+		{name: "deadline_passed", deadline: start.Add(-time.Minute), wantTimeout: time.Nanosecond, wantLimit: limitDeadline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{opts: RunnerOptions{AttemptTimeout: tt.attemptTimeout}, clock: testutil.NewFakeClock(start)}
+			timeout, limit := r.attemptLimit(tt.deadline)
+			if timeout != tt.wantTimeout || limit != tt.wantLimit {
+				t.Errorf("attemptLimit() = %v, %q, want %v, %q", timeout, limit, tt.wantTimeout, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestTimeoutWarning(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    RunnerOptions
+		timeout time.Duration
+		limit   string
+		want    time.Duration
+	}{
+		{name: "disabled", opts: RunnerOptions{AttemptTimeout: time.Hour}, timeout: time.Hour, limit: limitAttempt, want: -1},
+		{name: "attempt", opts: RunnerOptions{AttemptTimeout: time.Hour, TimeoutWarning: 80}, timeout: time.Hour, limit: limitAttempt, want: 48 * time.Minute},
+		{name: "deadline", opts: RunnerOptions{OverallDeadline: time.Hour, TimeoutWarning: 80}, timeout: 30 * time.Minute, limit: limitDeadline, want: 18 * time.Minute},
+		{name: "deadline_past_warning", opts: RunnerOptions{OverallDeadline: time.Hour, TimeoutWarning: 80}, timeout: 5 * time.Minute, limit: limitDeadline, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{opts: tt.opts}
+			if got := r.timeoutWarning(tt.timeout, tt.limit); got != tt.want {
+				t.Errorf("timeoutWarning() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunnerRunTimeoutWarning tests warning the notifiers before an attempt is killed, and not when it
+// finishes in time
+func TestRunnerRunTimeoutWarning(t *testing.T) {
+	tests := []struct {
+		name        string
+		script      string
+		wantWarning bool
+	}{
+		{name: "killed", script: "sleep 30", wantWarning: true},
+		{name: "in_time", script: "exit 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			notifier := &fakeNotifier{}
+			opts := newTestOptions(mem, testutil.WriteScript(t, "job.sh", tt.script))
+			opts.AttemptTimeout = 500 * time.Millisecond
+			opts.TimeoutWarning = 50
+			opts.Notifiers = []notify.Notifier{notifier}
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			if _, err := r.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			var warnings []notify.Message
+			for _, msg := range notifier.messages {
+				if msg.Status == "running" {
+					warnings = append(warnings, msg)
+				}
+			}
+			if !tt.wantWarning {
+				if len(warnings) != 0 || strings.Contains(mem.Content(), "timeout_approaching") {
+					t.Errorf("Warnings = %v, want none", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || warnings[0].Limit != limitAttempt || warnings[0].KillInSeconds != 0.25 {
+				t.Fatalf("Warnings = %+v, want one of the attempt limit", warnings)
+			}
+			// Cleared once the attempt is over
+			if want := `crontab_timeout_approaching{name="test_job"} 0`; !strings.Contains(mem.Content(), want+"\n") {
+				t.Errorf("Expected metric %q, got:\n%s", want, mem.Content())
+			}
+		})
+	}
+}
+
+func TestJittered(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter float64
+		rnd    float64
+		want   time.Duration
+	}{
+		{name: "no_jitter", rnd: 0.9, want: 10 * time.Second},
+		{name: "lowest_random", jitter: 0.5, rnd: 0, want: 10 * time.Second},
+		{name: "half", jitter: 0.5, rnd: 0.5, want: 7500 * time.Millisecond},
+		{name: "full_jitter", jitter: 1, rnd: 0.9, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jittered(10*time.Second, tt.jitter, tt.rnd); got != tt.want {
+				t.Errorf("jittered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
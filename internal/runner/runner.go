@@ -0,0 +1,1347 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/calendar"
+	"github.com/alswl/cron-manager/internal/capacity"
+	"github.com/alswl/cron-manager/internal/clock"
+	"github.com/alswl/cron-manager/internal/cloudmonitoring"
+	"github.com/alswl/cron-manager/internal/cloudwatch"
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/events"
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/fileperm"
+	"github.com/alswl/cron-manager/internal/fssnapshot"
+	"github.com/alswl/cron-manager/internal/fswatch"
+	"github.com/alswl/cron-manager/internal/health"
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/influx"
+	"github.com/alswl/cron-manager/internal/inventory"
+	"github.com/alswl/cron-manager/internal/job"
+	"github.com/alswl/cron-manager/internal/lease"
+	"github.com/alswl/cron-manager/internal/logwriter"
+	"github.com/alswl/cron-manager/internal/mqtt"
+	"github.com/alswl/cron-manager/internal/notify"
+	"github.com/alswl/cron-manager/internal/pglock"
+	"github.com/alswl/cron-manager/internal/precheck"
+	"github.com/alswl/cron-manager/internal/pushgateway"
+	"github.com/alswl/cron-manager/internal/queue"
+	"github.com/alswl/cron-manager/internal/registry"
+	"github.com/alswl/cron-manager/internal/severity"
+	"github.com/alswl/cron-manager/internal/spool"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/alswl/cron-manager/internal/version"
+	"github.com/spf13/afero"
+)
+
+// HELP texts of the metrics written by the runner
+const (
+	helpFailed         = "Whether the job failed (1 = failed, 0 = success)"
+	helpExitCode       = "Exit code of the last job execution"
+	helpDuration       = "Duration of the last job execution in seconds"
+	helpWall           = "Wall-clock duration of the last job execution in seconds, including idle wait"
+	helpLastRun        = "Timestamp of the last job execution"
+	helpRunning        = "Whether the job is currently running (1 = running, 0 = finished)"
+	helpRunsTotal      = "Total number of job runs"
+	helpExecErrsTotal  = "Total number of runs whose command could not be executed"
+	helpTimeouts       = "Total number of attempts killed by a time limit, by limit"
+	helpApproaching    = "Whether the running attempt passed the timeout warning and is about to be killed (1 = approaching)"
+	helpAttempts       = "Number of attempts made by the last run"
+	helpItemsTotal     = "Total number of items processed by a for-each run, by status"
+	helpQueueItems     = "Total number of processed work items by outcome"
+	helpIncomplete     = "Whether the previous run never finished, e.g. cronmgr was killed (1 = incomplete)"
+	helpUnreported     = "Total number of runs whose command was started but whose outcome was never reported"
+	helpBuildInfo      = "Version of cronmgr that last ran the job, always 1"
+	helpProvenance     = "Origin of the job definition given with --provenance, always 1"
+	helpNameCollision  = "Whether another job with a different command line uses the name of the job (1 = collision)"
+	helpTouchFile      = "Modification time of the touch file, touched by each successful run"
+	helpNotifications  = "Total number of notifications of failed runs by result: sent, batched into a later notification or dropped by the global limit"
+	helpNotifyFailures = "Total number of failed notification deliveries, by notifier channel"
+	helpUndelivered    = "Total number of notifications no notifier delivered"
+	helpSpooled        = "Total number of submissions to push backends by result: spooled after a failure, replayed by a later run, expired in the spool or rejected without a valid signature"
+	helpSnapshots      = "Total number of file system snapshots by outcome: taken, take_failed, dropped after a successful run, drop_failed or kept after a failed run"
+	helpSnapshotTime   = "Time taken by the file system snapshots of the last run in seconds"
+	helpLockWait       = "Time waited for the advisory lock by the last run in seconds"
+	helpLockFailures   = "Total number of advisory locks not taken or lost, by cause: held, connect, tls, auth, query or lost"
+	helpLeaseToken     = "Fencing token of the lease held by the last run, incremented by each acquisition"
+	helpLeaseFailures  = "Total number of leases not acquired or lost, by cause: held, error or lost"
+	helpQueueDelay     = "Time the last run was deferred until the host had room for the resources of the job, in seconds"
+	helpReadinessWait  = "Time waited for the readiness URLs and ports by the last run in seconds"
+	helpCustom         = "Business metric reported by the last run of the job through CRONMGR_METRICS_FILE, by metric name"
+)
+
+// legacyGauges are the final gauges also written in the original cronmanager schema, by their dimension there
+var legacyGauges = []exporter.LegacyGauge{
+	{Metric: "failed", Dimension: "failed", Help: helpFailed},
+	{Metric: "running", Dimension: "run", Help: helpRunning},
+	{Metric: "duration_seconds", Dimension: "duration", Help: helpDuration},
+	{Metric: "last_run_timestamp_seconds", Dimension: "last", Help: helpLastRun},
+}
+
+// LegacyGauges returns the gauges written in the original cronmanager schema as well with LegacyMetrics
+func LegacyGauges() []exporter.LegacyGauge {
+	return slices.Clone(legacyGauges)
+}
+
+// RunIDPlaceholder is replaced with the run ID in the log file path
+const RunIDPlaceholder = "{run_id}"
+
+// HistoryDir is the directory of the history journal inside the state directory
+const HistoryDir = "history"
+
+// NotifyLimitsFile is the file of the notification limits inside the state directory
+const NotifyLimitsFile = "notify/limits.json"
+
+// precheckInterval is how often failing prechecks are re-evaluated while the start is delayed
+const precheckInterval = 30 * time.Second
+
+// RunnerOptions holds everything needed to run a job.
+// It is constructed by the CLI from flags, or directly by library users.
+type RunnerOptions struct {
+	// Name is the job name, it appears in metric labels and alerts
+	Name string
+	// Command is the executable to run
+	Command string
+	// Args are the arguments passed to Command
+	Args []string
+	// LogFile is the path of the file storing the command output, empty keeps the output in memory.
+	// A {run_id} placeholder is replaced with the ID of the run, keeping one log file per run.
+	LogFile string
+	// MaxCapturedOutput is the number of bytes of output kept in memory without LogFile, only the end is kept.
+	// Zero discards the output.
+	MaxCapturedOutput int
+	// ErrorLog is the path of a file storing only the stderr of the command, e.g. to keep the diagnostics
+	// of a job with a huge stdout. It is written in addition to LogFile and accepts the {run_id} placeholder too.
+	ErrorLog string
+	// LogFileOptions configure the permissions and owner of the log file
+	LogFileOptions []logwriter.Option
+	// IdleSeconds is the minimum duration of a run so Prometheus can notice it, 0 disables it
+	IdleSeconds int
+	// LoginShell runs the command through this login shell when not empty
+	LoginShell string
+	// ResolvePath resolves the command from common locations if it is not found in PATH
+	ResolvePath bool
+	// SystemdScope runs the command in a transient systemd scope when not nil
+	SystemdScope *job.SystemdScope
+	// Privileges are dropped by the command before it executes the job when not nil
+	Privileges *job.Privileges
+	// ExporterOptions configure the Prometheus exporter
+	ExporterOptions []exporter.Option
+	// PushgatewayURL is the base URL of a Prometheus Pushgateway the final state is pushed to,
+	// empty disables pushing
+	PushgatewayURL string
+	// HTTPClient sends the pushes to the Pushgateway, e.g. through a proxy, nil uses a client with
+	// the default timeout
+	HTTPClient *http.Client
+	// CloudWatch puts the final state to AWS CloudWatch, nil disables it
+	CloudWatch *cloudwatch.Client
+	// CloudMonitoring writes the final state to Google Cloud Monitoring, nil disables it
+	CloudMonitoring *cloudmonitoring.Client
+	// Influx writes the final state to InfluxDB, nil disables it
+	Influx *influx.Writer
+	// InfluxFile is a file the final state is appended to in the InfluxDB line protocol,
+	// e.g. for the tail input of Telegraf. Empty disables it
+	InfluxFile string
+	// SpoolDir is a directory keeping the submissions to the Pushgateway, CloudWatch and InfluxDB that
+	// failed, e.g. during a network outage, so that later runs replay them. Empty disables the spool
+	SpoolDir string
+	// SpoolMaxAge drops the spooled submissions older than it, 0 keeps them until they are replayed
+	SpoolMaxAge time.Duration
+	// Signer signs the spooled submissions, which are only replayed with a valid signature, nil disables it
+	Signer *crypt.Signer
+	// MQTT publishes the result of each run as a JSON message to MQTTTopic, nil disables it
+	MQTT *mqtt.Publisher
+	// MQTTTopic is the topic the results are published to, {host} and {job} are replaced
+	// by the host name and the job name. Empty uses DefaultMQTTTopic
+	MQTTTopic string
+	// Notifiers are sent a notification for each failed run
+	Notifiers []notify.Notifier
+	// NotifyFallback sends each notification to the notifiers in order until one delivers it,
+	// instead of sending it to all of them
+	NotifyFallback bool
+	// NotifyTemplate renders the text of the notifications, nil uses the default text
+	NotifyTemplate *notify.Template
+	// NotifyRunURL is the link to each run passed to notifications, {job}, {run_id} and {host} are
+	// replaced as in notify.RunURL. Empty disables it
+	NotifyRunURL string
+	// NotifyLimit limits the notifications of the job, the failures over it are batched into its next
+	// notification. The zero Limit disables it
+	NotifyLimit notify.Limit
+	// NotifyGlobalLimit limits the notifications of all jobs sharing StateDir, the failures over it are
+	// dropped. The zero Limit disables it
+	NotifyGlobalLimit notify.Limit
+	// Severities assigns a severity to each failed run by exit code, labeling runs_total and choosing the
+	// notifiers of the failure by their channel. nil disables severities
+	Severities *severity.Map
+	// SampleTimestamps writes the final gauges with the completion time of the job as sample timestamp,
+	// only for collectors accepting timestamps (node_exporter's textfile collector does not)
+	SampleTimestamps bool
+	// Health serves the liveness and elapsed time of the command over HTTP, for long-running commands
+	// health-checked by Kubernetes or monit through cronmgr. nil disables it
+	Health *health.Server
+	// Quiet suppresses informational log messages, problems are still logged
+	Quiet bool
+	// LegacyMetrics also writes the run, failed, duration and last series of the original cronmanager schema
+	LegacyMetrics bool
+	// TimePrecision is the number of decimals of the duration and timestamp gauges, all written as float seconds.
+	// 0 keeps the legacy format: durations with 2 decimals and timestamps in whole seconds
+	TimePrecision int
+	// Retries is how many times a failed attempt is retried, 0 disables retries
+	Retries int
+	// RetryDelay is the delay before the first retry, it doubles after each attempt
+	RetryDelay time.Duration
+	// RetryJitter randomly shortens each retry delay by up to this fraction, between 0 and 1,
+	// so jobs failing at the same time across a fleet do not retry in lockstep
+	RetryJitter float64
+	// RetryOnExitCodes restricts retries to attempts exiting with one of these codes, empty retries any failure.
+	// Attempts killed by the attempt timeout are always retried.
+	RetryOnExitCodes []int
+	// RetryMaxElapsed is the time since the start of the run after which no retry starts, 0 disables it.
+	// Unlike OverallDeadline it never kills a running attempt.
+	RetryMaxElapsed time.Duration
+	// CheckpointDir is the directory holding a checkpoint directory per job, passed to the command
+	// as CRONMGR_CHECKPOINT_DIR. It is kept across retries and failed runs and removed after
+	// a successful run, empty disables it
+	CheckpointDir string
+	// ReadOnlyPaths are files and directory trees the command must not change during the run, e.g. for
+	// verification jobs that must be side-effect free. Any change fails the run, with the changes logged.
+	ReadOnlyPaths []string
+	// Snapshots are file systems snapshotted before the command starts. The snapshots are dropped after a
+	// successful run and kept after a failed one; if one cannot be taken, the command does not run.
+	Snapshots []fssnapshot.Spec
+	// ArtifactDir keeps the artifacts of each run in <ArtifactDir>/<run_id>: the core dump of a command
+	// crashing with a signal, and the backtraces of its threads. Empty disables them
+	ArtifactDir string
+	// AuditFile is where a JSON summary of the programs executed, the files opened and the addresses
+	// connected to by the command is written after the run, {run_id} being replaced by the run ID. It traces
+	// with eBPF on Linux as root; where tracing is not available the job runs without it. Empty disables it.
+	AuditFile string
+	// CustomMetrics passes a file to the command as CRONMGR_METRICS_FILE; lines `cronmgr-metric <name> <value>`
+	// written to it are exported as custom{metric="<name>"} gauges after the run
+	CustomMetrics bool
+	// TouchFile is a file whose modification time is set after each successful run, for monitors
+	// alerting on its age. Empty disables it
+	TouchFile string
+	// AttemptTimeout kills an attempt that runs longer, 0 disables it
+	AttemptTimeout time.Duration
+	// OverallDeadline kills the run once it takes longer, including all attempts and retry delays;
+	// no retry starts after it. 0 disables it
+	OverallDeadline time.Duration
+	// StopSignal is sent to an attempt reaching AttemptTimeout or OverallDeadline to stop gracefully, e.g.
+	// SIGINT for workers finishing their current request; it is killed if still running after StopGrace.
+	// nil kills it right away
+	StopSignal os.Signal
+	StopGrace  time.Duration
+	// ShutdownSignals are the signals of cronmgr, e.g. SIGTERM from systemd or docker stop, that stop the
+	// running attempt like a time limit, with StopSignal and StopGrace, instead of leaving the command orphaned.
+	// The run is not retried after them
+	ShutdownSignals []os.Signal
+	// TimeoutWarning is the percentage of AttemptTimeout or OverallDeadline after which the notifiers are
+	// warned that the attempt is about to be killed, giving operators a chance to intervene. 0 disables it
+	TimeoutWarning int
+	// Canary is the percentage of hosts executing the job, chosen by a hash of their hostname, for a staged
+	// rollout of a job shared by a fleet; the runs of the other hosts are skipped. 0 disables it
+	Canary int
+	// ScheduleDates are the only dates on which the job runs, for schedules that cron expressions cannot
+	// express such as the last business day of the month; cron starts cronmgr daily and the runs on the
+	// other dates are skipped. nil disables it
+	ScheduleDates *calendar.Calendar
+	// IntervalAfterRun is how long after the previous run of the job finished the next one may start, for
+	// jobs whose duration varies too much for fixed cron times; cron starts cronmgr often and the runs that
+	// come too early, or while the previous one is still running, are skipped. Requires StateDir, 0 disables it
+	IntervalAfterRun time.Duration
+	// Holidays are the dates on which the runs are skipped, e.g. the public holidays of a job running on
+	// business days only, in the local time of the host. nil disables it
+	Holidays *calendar.Calendar
+	// AdvisoryLock is a PostgreSQL advisory lock or MySQL named lock held during the run, for jobs excluding each other across hosts.
+	// A run that cannot take it within AdvisoryLockWait is skipped, nil disables it
+	AdvisoryLock     *pglock.Target
+	AdvisoryLockWait time.Duration
+	// Lease is a lease on shared storage held during the run, renewed while the command runs, whose fencing
+	// token is passed to the command in CRONMGR_FENCING_TOKEN. The command is stopped if the lease is lost
+	// and a run that cannot acquire it is skipped, nil disables it
+	Lease *lease.Lease
+	// Prechecks must pass before the command is started, otherwise the run is delayed or skipped
+	Prechecks []precheck.Check
+	// PrecheckWait is how long the start may be delayed while a precheck does not pass,
+	// 0 skips the run immediately
+	PrecheckWait time.Duration
+	// Readiness are the dependencies polled until they are ready before the command is started, unlike the
+	// Prechecks a check that cannot be evaluated is not ready
+	Readiness []precheck.Check
+	// ReadinessTimeout is how long the start waits for the Readiness checks before the run is skipped,
+	// 0 checks them once
+	ReadinessTimeout time.Duration
+	// RequiredFiles are the inputs that must exist and be fresh, otherwise the run is skipped as stale_input,
+	// or fails with FailOnStaleInput
+	RequiredFiles    []precheck.FileCheck
+	FailOnStaleInput bool
+	// Capacity is the ledger of the resources reserved by the jobs running on the host. The start is deferred
+	// up to CapacityWait while the host has no room for the Resources of the job, then the run is skipped.
+	// nil disables it
+	Capacity     *capacity.Ledger
+	Resources    capacity.Resources
+	CapacityWait time.Duration
+	// ForEach runs the command once per entry of Items, with the item appended to its arguments
+	ForEach bool
+	// Items are the inputs of a for-each run
+	Items []string
+	// Parallelism is the maximum number of items processed at the same time, defaults to 1
+	Parallelism int
+	// QueueDir is a work queue directory, each run processes one pending item from it, empty disables it
+	QueueDir string
+	// FallbackDir is an alternate writable directory for metrics and the log file,
+	// used when writing them is denied, e.g. by an SELinux or AppArmor policy
+	FallbackDir string
+	// StateDir is the directory the state of each job is recorded in, along with the history of
+	// finished runs in its HistoryDir; empty disables the state store
+	StateDir string
+	// Cipher encrypts the log file and the history journal at rest, nil stores them in plain text
+	Cipher *crypt.Cipher
+	// HistoryRetention configures how long finished runs are kept in the history journal before
+	// they are compacted into daily aggregates, the zero value keeps all runs
+	HistoryRetention history.Retention
+	// RegistryFile is the inventory of the jobs of the host, each run records the command, schedule and owner
+	// of its job in it, see registry.Registry. Empty disables it
+	RegistryFile string
+	// Schedule describes when the job runs, e.g. its cron expression, it is only recorded in RegistryFile
+	Schedule string
+	// Inventory pushes the jobs of RegistryFile to a central inventory at the end of a run, once per interval
+	// for all jobs of the host; nil disables it
+	Inventory *inventory.Pusher
+	// Events receives the lifecycle events of the runs (started, retrying, timeout, skipped and finished),
+	// nil disables them
+	Events *events.Writer
+	// Collisions describe other running jobs using Name with a different command line, e.g. found in the
+	// process table; with StateDir the last recorded run of the job is checked as well
+	Collisions []string
+	// Provenance describes where the job definition comes from, e.g. repo=infra and commit=abc123, to trace
+	// the change that introduced it. It is exported as provenance_info labels and added to the summary
+	Provenance map[string]string
+	// Clock is the source of time for durations, timestamps and waits, defaults to the system clock
+	Clock clock.Clock
+}
+
+// Validate checks that the options describe a runnable job
+func (o RunnerOptions) Validate() error {
+	if o.Name == "" {
+		return errors.New("job name is required")
+	}
+	if o.Command == "" {
+		return errors.New("command is required")
+	}
+	if o.IdleSeconds < 0 {
+		return fmt.Errorf("idle seconds must not be negative, got %d", o.IdleSeconds)
+	}
+	if o.Retries < 0 {
+		return fmt.Errorf("retries must not be negative, got %d", o.Retries)
+	}
+	if o.RetryDelay < 0 || o.RetryMaxElapsed < 0 || o.AttemptTimeout < 0 || o.OverallDeadline < 0 {
+		return errors.New("retry delay, retry max elapsed, attempt timeout and overall deadline must not be negative")
+	}
+	if o.StopGrace < 0 {
+		return fmt.Errorf("stop grace must not be negative, got %v", o.StopGrace)
+	}
+	if o.TimeoutWarning < 0 || o.TimeoutWarning >= 100 {
+		return fmt.Errorf("timeout warning must be a percentage below 100, got %d", o.TimeoutWarning)
+	}
+	if o.RetryJitter < 0 || o.RetryJitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1, got %v", o.RetryJitter)
+	}
+	if o.HistoryRetention.Runs < 0 || o.HistoryRetention.Daily < 0 {
+		return errors.New("history retention must not be negative")
+	}
+	if o.Parallelism < 0 {
+		return fmt.Errorf("parallelism must not be negative, got %d", o.Parallelism)
+	}
+	if o.ForEach && o.QueueDir != "" {
+		return errors.New("for-each items and a work queue cannot be combined")
+	}
+	if o.ForEach && o.Lease != nil {
+		return errors.New("for-each items and a lease cannot be combined")
+	}
+	if o.Canary < 0 || o.Canary > 100 {
+		return fmt.Errorf("canary must be a percentage between 0 and 100, got %d", o.Canary)
+	}
+	if o.PrecheckWait < 0 {
+		return fmt.Errorf("precheck wait must not be negative, got %v", o.PrecheckWait)
+	}
+	if o.CapacityWait < 0 {
+		return fmt.Errorf("capacity wait must not be negative, got %v", o.CapacityWait)
+	}
+	if o.ReadinessTimeout < 0 {
+		return fmt.Errorf("readiness timeout must not be negative, got %v", o.ReadinessTimeout)
+	}
+	if o.AdvisoryLockWait < 0 {
+		return fmt.Errorf("advisory lock wait must not be negative, got %v", o.AdvisoryLockWait)
+	}
+	if o.SpoolMaxAge < 0 {
+		return fmt.Errorf("spool max age must not be negative, got %v", o.SpoolMaxAge)
+	}
+	if o.TimePrecision < 0 || o.TimePrecision > MaxTimePrecision {
+		return fmt.Errorf("time precision must be between 0 and %d, got %d", MaxTimePrecision, o.TimePrecision)
+	}
+	if o.IntervalAfterRun < 0 {
+		return fmt.Errorf("interval after run must not be negative, got %v", o.IntervalAfterRun)
+	}
+	if o.IntervalAfterRun > 0 && o.StateDir == "" {
+		return errors.New("the interval after run requires a state directory")
+	}
+	if (o.NotifyLimit != notify.Limit{} || o.NotifyGlobalLimit != notify.Limit{}) && o.StateDir == "" {
+		return errors.New("notification limits require a state directory")
+	}
+	if o.Inventory != nil && o.RegistryFile == "" {
+		return errors.New("the inventory push requires a registry file")
+	}
+	if err := exporter.ValidateLabels(o.Provenance); err != nil {
+		return fmt.Errorf("provenance: %w", err)
+	}
+	return nil
+}
+
+// Result is the outcome of a run
+type Result struct {
+	// RunID identifies the run in the state store and run history
+	RunID string
+	// LogFile is the path the output was written to, empty if it was discarded
+	LogFile string
+	// ErrorLogFile is the path stderr was also written to, empty without ErrorLog
+	ErrorLogFile string
+	// Output is the end of the command output, at most MaxCapturedOutput bytes, if it was not written to LogFile
+	Output []byte
+	// ExitStatus is the exit status of the command, only meaningful if ExecError is empty
+	ExitStatus job.ExitStatus
+	// ExecError is the reason the command could not be executed, empty if it started
+	ExecError job.ExecErrorType
+	// TimedOut is the limit that killed the last attempt, "attempt" or "deadline", empty if none did
+	TimedOut string
+	// Attempts is the number of times the command was started
+	Attempts int
+	// Args are the command and its arguments as executed
+	Args []string
+	// Env is the environment of the command, nil if it inherited the environment of cronmgr
+	Env []string
+	// CoreFile is the core dumped by the crashed command collected into ArtifactDir, and BacktraceFile the
+	// backtraces of its threads, empty if they were not collected
+	CoreFile      string
+	BacktraceFile string
+	// Severity is the severity of a failed run assigned by RunnerOptions.Severities, empty without them
+	Severity string
+	// ReadOnlyChanges are the first changes of ReadOnlyPaths during the run, out of ReadOnlyChangeCount
+	ReadOnlyChanges     []fswatch.Change
+	ReadOnlyChangeCount int
+	// Snapshots are the file system snapshots kept after the failed run
+	Snapshots []string
+	// StaleInput is why a required file was missing or stale, in which case the command was not started
+	StaleInput string
+	// Skipped is the reason of the precheck that prevented the run, empty if it was not skipped
+	Skipped string
+	// Provenance is the origin of the job definition, see RunnerOptions.Provenance
+	Provenance map[string]string
+	// StartTime is the time the run started
+	StartTime time.Time
+	// Duration is the time the command itself took to run
+	Duration time.Duration
+	// WallDuration is the total duration of the run, including idle wait
+	WallDuration time.Duration
+}
+
+// Failed reports whether the run failed, either to execute, with a non-zero exit code, by changing
+// a read-only path or for lack of fresh input. A skipped run did not fail.
+func (r Result) Failed() bool {
+	return r.ExecError != "" || r.ExitStatus.Code != 0 || r.ReadOnlyChangeCount > 0 || r.StaleInput != ""
+}
+
+// ExitMetricsError is the exit code of cronmgr for a run whose metrics could not all be written, unless the
+// command could not be executed
+const ExitMetricsError = 121
+
+// ExitCode returns the exit code of cronmgr itself for this run.
+// Failures of the job are reported through metrics, only exec errors change the exit code.
+func (r Result) ExitCode() int {
+	if r.ExecError != "" {
+		return r.ExecError.ExitCode()
+	}
+	return 0
+}
+
+// jobExitCode returns the exit code reported for the job, the exec error code if it could not be executed
+func (r Result) jobExitCode() int {
+	if r.ExecError != "" {
+		return r.ExecError.ExitCode()
+	}
+	return r.ExitStatus.Code
+}
+
+// outcome returns the status and error type a finished run is counted with
+func (r Result) outcome() (status, errorType string) {
+	switch {
+	case r.ExecError != "":
+		// The command could not be executed, this is not a failure of the job itself
+		return "failed", "exec"
+	case r.TimedOut != "":
+		// The command was killed by a time limit
+		return "failed", "timeout"
+	case r.ReadOnlyChangeCount > 0:
+		return "failed", "readonly"
+	case r.StaleInput != "":
+		return "failed", "stale_input"
+	case r.Failed():
+		return "failed", "job"
+	default:
+		return "success", ""
+	}
+}
+
+// Runner executes a job and exports its metrics
+type Runner struct {
+	opts    RunnerOptions
+	exp     *exporter.Exporter
+	store   *state.Store
+	journal *history.Journal
+	jobs    *registry.Registry
+	limiter *notify.Limiter
+	spool   *spool.Spool
+	clock   clock.Clock
+	// intent is the intent record of the run in progress, nil if none was written
+	intent *state.Intent
+	// lease is the lease held during the run, nil without RunnerOptions.Lease
+	lease *lease.Holding
+	// shutdown is the shutdown signal that stopped an attempt, nil if none did
+	shutdown os.Signal
+}
+
+// NewRunner creates a Runner after validating the options
+func NewRunner(opts RunnerOptions) (*Runner, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+	var store *state.Store
+	var journal *history.Journal
+	if opts.StateDir != "" {
+		store = state.NewStore(afero.NewOsFs(), opts.StateDir)
+		var journalOpts []history.Option
+		if opts.Cipher != nil {
+			journalOpts = append(journalOpts, history.WithCipher(opts.Cipher))
+		}
+		journal = history.NewJournal(afero.NewOsFs(), filepath.Join(opts.StateDir, HistoryDir), journalOpts...)
+	}
+	var jobs *registry.Registry
+	if opts.RegistryFile != "" {
+		jobs = registry.New(afero.NewOsFs(), opts.RegistryFile)
+	}
+	var limiter *notify.Limiter
+	if opts.NotifyLimit != (notify.Limit{}) || opts.NotifyGlobalLimit != (notify.Limit{}) {
+		limiter = notify.NewLimiter(afero.NewOsFs(), filepath.Join(opts.StateDir, NotifyLimitsFile), opts.NotifyLimit, opts.NotifyGlobalLimit)
+	}
+	var pushSpool *spool.Spool
+	if opts.SpoolDir != "" {
+		pushSpool = spool.New(afero.NewOsFs(), opts.SpoolDir, opts.SpoolMaxAge)
+		if opts.Signer != nil {
+			pushSpool.SignWith(opts.Signer)
+		}
+	}
+	exporterOpts := opts.ExporterOptions
+	if opts.FallbackDir != "" {
+		exporterOpts = slices.Concat(exporterOpts, []exporter.Option{exporter.WithFallbackDir(opts.FallbackDir)})
+	}
+	return &Runner{
+		opts:    opts,
+		exp:     exporter.NewExporter(exporterOpts...),
+		store:   store,
+		journal: journal,
+		jobs:    jobs,
+		limiter: limiter,
+		spool:   pushSpool,
+		clock:   clk,
+	}, nil
+}
+
+// Exporter returns the exporter metrics are written to
+func (r *Runner) Exporter() *exporter.Exporter {
+	return r.exp
+}
+
+// command returns the executable and arguments to run, after applying login shell, path resolution,
+// the dropped privileges and the systemd scope. extraArgs are appended to the configured arguments.
+func (r *Runner) command(extraArgs ...string) (string, []string) {
+	cmdBin, args := r.shellCommand(extraArgs...)
+	if r.opts.Privileges != nil {
+		cmdBin, args = r.opts.Privileges.Command(cmdBin, args)
+	}
+	if r.opts.SystemdScope != nil {
+		return r.opts.SystemdScope.Command(cmdBin, args)
+	}
+	return cmdBin, args
+}
+
+// shellCommand returns the executable and arguments to run in the scope of the job, see command
+func (r *Runner) shellCommand(extraArgs ...string) (string, []string) {
+	args := slices.Concat(r.opts.Args, extraArgs)
+	// Wrap the command in a login shell if requested, the shell resolves the command itself
+	if r.opts.LoginShell != "" {
+		return job.LoginShellCommand(r.opts.LoginShell, r.opts.Command, args)
+	}
+	if r.opts.ResolvePath {
+		if resolved, ok := job.ResolveCommand(r.opts.Command); ok {
+			r.logf("Command %s not found in PATH, resolved to %s", r.opts.Command, resolved)
+			return resolved, args
+		}
+	}
+	return r.opts.Command, args
+}
+
+// Argv returns the command line executed by Run, the executable first.
+// Items of a for-each run are appended to it.
+func (r *Runner) Argv() []string {
+	cmdBin, cmdArgs := r.command()
+	return append([]string{cmdBin}, cmdArgs...)
+}
+
+// Run executes the job, writing metrics while it runs and after it finished.
+// A failing job is not an error, it is reported in the Result; errors are returned
+// when the run could not be carried out, e.g. the log file could not be created.
+// A panic of cronmgr itself still writes the metrics of a failed run before it is raised again.
+func (r *Runner) Run() (Result, error) {
+	defer r.recoverPanic()
+	if r.outsideCanary() {
+		return r.skip("canary"), nil
+	}
+	if r.offSchedule() {
+		return r.skip("not_scheduled"), nil
+	}
+	if r.onHoliday() {
+		return r.skip("holiday"), nil
+	}
+	if reason := r.checkInterval(); reason != "" {
+		return r.skip(reason), nil
+	}
+	// Delay or skip the run while the host is not ready for it
+	if reason := r.waitPrechecks(); reason != "" {
+		return r.skip(reason), nil
+	}
+	if reason := r.waitReadiness(); reason != "" {
+		return r.skip(reason), nil
+	}
+	if detail := r.checkRequiredFiles(); detail != "" {
+		if r.opts.FailOnStaleInput {
+			return r.failStaleInput(detail), nil
+		}
+		r.logf("Skipping job %s: %s", r.opts.Name, detail)
+		return r.skip("stale_input"), nil
+	}
+	releaseCapacity, ok := r.reserveCapacity()
+	if !ok {
+		return r.skip("capacity"), nil
+	}
+	defer releaseCapacity()
+	release, ok := r.acquireAdvisoryLock()
+	if !ok {
+		return r.skip("advisory_lock"), nil
+	}
+	defer release()
+	releaseLease, ok := r.acquireLease()
+	if !ok {
+		return r.skip("lease"), nil
+	}
+	defer releaseLease()
+
+	if r.opts.ForEach {
+		if len(r.opts.Items) == 0 {
+			return r.skip("no_items"), nil
+		}
+		return r.executeEach(r.opts.Items)
+	}
+	if r.opts.QueueDir == "" {
+		return r.execute()
+	}
+
+	// Process one work item, passing its path as the last argument
+	item, err := queue.New(r.opts.QueueDir).Claim()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to claim work item: %w", err)
+	}
+	if item == nil {
+		return r.skip("empty_queue"), nil
+	}
+	r.logf("Processing work item %s", item.Name)
+	result, err := r.execute(item.Path)
+	r.finishItem(item, result, err)
+	return result, err
+}
+
+// MetricsErr returns the error of the first metric of the job that could not be written, nil if all were.
+// Failed metric writes are logged and never fail the job, cronmgr reports them once the run is over.
+func (r *Runner) MetricsErr() error {
+	return r.exp.Err()
+}
+
+// startTicker starts writing progress metrics every second, it returns a function stopping it
+func (r *Runner) startTicker(work *workTimer) (stop func()) {
+	stopTicker := make(chan struct{})
+	tickerDone := make(chan struct{})
+	go func() {
+		defer close(tickerDone)
+		for {
+			select {
+			case <-stopTicker:
+				return
+			case <-r.clock.After(time.Second):
+				r.writeProgress(work)
+			}
+		}
+	}()
+	return func() {
+		close(stopTicker)
+		<-tickerDone
+	}
+}
+
+// writeStarted records the start of a run in the state store and metrics
+func (r *Runner) writeStarted(result Result) {
+	name := r.opts.Name
+	// Report a previous run that never finished or ran another command before this run overwrites its state
+	previous, found := r.checkPreviousRun()
+	r.checkCollision(previous, found)
+	r.saveState(state.RunState{
+		Name:      name,
+		Owner:     r.exp.Owner(),
+		RunID:     result.RunID,
+		PID:       os.Getpid(),
+		Running:   true,
+		StartTime: result.StartTime,
+		LogFile:   result.LogFile,
+		Command:   r.commandLine(),
+	})
+	r.register(result)
+
+	r.exp.WriteInfo("build_info", name, version.Labels(), helpBuildInfo)
+	if len(r.opts.Provenance) > 0 {
+		r.exp.WriteInfo("provenance_info", name, r.opts.Provenance, helpProvenance)
+	}
+	if r.opts.LegacyMetrics {
+		r.exp.WriteLegacy(name, "run", "1")
+	}
+
+	// Job started - increment run counter and set running status
+	r.exp.IncrementCounter("runs_total", name, map[string]string{"status": "started"}, helpRunsTotal)
+	r.exp.WriteGauge("running", name, "1", helpRunning)
+	r.emit(result.RunID, events.Event{Event: events.Started})
+}
+
+// skip records a run skipped for reason
+func (r *Runner) skip(reason string) Result {
+	r.exp.IncrementCounter("runs_total", r.opts.Name, map[string]string{"status": "skipped_" + reason}, helpRunsTotal)
+	result := r.newResult()
+	result.Skipped = reason
+	r.emit(result.RunID, events.Event{Event: events.Skipped, Reason: reason})
+	return result
+}
+
+// newResult starts the result of a run at the current time
+func (r *Runner) newResult() Result {
+	start := r.clock.Now()
+	return Result{RunID: RunID(start, os.Getpid()), StartTime: start, Provenance: r.opts.Provenance}
+}
+
+// RunID returns the ID of a run started at start by the process pid
+func RunID(start time.Time, pid int) string {
+	return start.UTC().Format("20060102T150405Z") + "-" + strconv.Itoa(pid)
+}
+
+// finishItem moves a processed work item to done or failed. Items whose command could not be
+// executed are returned to pending, they were not processed.
+func (r *Runner) finishItem(item *queue.Item, result Result, runErr error) {
+	var err error
+	outcome := "done"
+	switch {
+	case runErr != nil || result.ExecError != "":
+		outcome = "released"
+		err = item.Release()
+	case result.Failed():
+		outcome = "failed"
+		err = item.Failed()
+	default:
+		err = item.Done()
+	}
+	if err != nil {
+		log.Printf("Failed to finish work item %s: %v", item.Name, err)
+		return
+	}
+	r.exp.IncrementCounter("queue_items_total", r.opts.Name, map[string]string{"outcome": outcome}, helpQueueItems)
+}
+
+// execute runs the command, retrying failed attempts as configured; extraArgs are appended to its arguments
+func (r *Runner) execute(extraArgs ...string) (Result, error) {
+	cmdBin, cmdArgs := r.command(extraArgs...)
+
+	//Record the start time of the job
+	result := r.newResult()
+
+	buf := newTailBuffer(r.opts.MaxCapturedOutput)
+	var logWriter *logwriter.LogWriter
+
+	// Setup log writer if log file is specified
+	if r.opts.LogFile != "" {
+		var err error
+		logWriter, err = r.openLogWriter(r.opts.LogFile, "log", result.RunID)
+		if err != nil {
+			return result, fmt.Errorf("failed to create log writer: %w", err)
+		}
+	}
+	if logWriter != nil {
+		result.LogFile = logWriter.Path()
+		defer func() { _ = logWriter.Close() }()
+	}
+	errorLog, err := r.openErrorLog(&result)
+	if err != nil {
+		return result, err
+	}
+	if errorLog != nil {
+		defer func() { _ = errorLog.Close() }()
+	}
+
+	// Attempts share the checkpoint directory, so they can resume where the previous one stopped
+	env, err := r.prepareCheckpoint()
+	if err != nil {
+		return result, err
+	}
+	metricsFile, env, err := r.prepareCustomMetrics(env)
+	if err != nil {
+		return result, err
+	}
+	env = r.leaseEnv(env)
+	if metricsFile != "" {
+		defer func() { _ = os.Remove(metricsFile) }()
+	}
+	result.Args, result.Env = append([]string{cmdBin}, cmdArgs...), env
+
+	// Snapshots are taken before the read-only paths are watched, they may be written inside them
+	snapshots, err := r.takeSnapshots(result)
+	if err != nil {
+		return result, err
+	}
+	watcher, err := r.watchReadOnly(result, metricsFile)
+	if err != nil {
+		return result, err
+	}
+	if watcher != nil {
+		defer watcher.Stop()
+	}
+	tracer := r.startAudit()
+	if tracer != nil {
+		defer tracer.Stop()
+	}
+	r.enableCores()
+
+	// Track the work duration separately, it stops when the command exits while idle wait continues
+	work := &workTimer{clock: r.clock, start: result.StartTime}
+
+	// Stop the ticker before final metrics are written, so they are not overwritten
+	stop := r.startTicker(work)
+	r.writeStarted(result)
+	r.writeIntent(result)
+
+	var deadline time.Time
+	if r.opts.OverallDeadline > 0 {
+		deadline = result.StartTime.Add(r.opts.OverallDeadline)
+	}
+	delay := r.opts.RetryDelay
+	for {
+		result.Attempts++
+		cmd := exec.Command(cmdBin, cmdArgs...)
+		cmd.Env = env
+		pipedLog := logWriter
+		switch {
+		case errorLog != nil:
+			// stderr also goes to the error log, the writers are copied to by exec itself
+			pipedLog = nil
+			var out io.Writer = buf
+			if logWriter != nil {
+				out = logWriter
+			}
+			cmd.Stdout = out
+			cmd.Stderr = io.MultiWriter(out, errorLog)
+		case logWriter != nil:
+			if err := logWriter.SetupPipes(cmd); err != nil {
+				stop()
+				return result, fmt.Errorf("failed to setup pipes: %w", err)
+			}
+		default:
+			cmd.Stdout = buf
+			cmd.Stderr = buf
+		}
+
+		err := r.attempt(cmd, pipedLog, deadline, &result)
+		if errorLog != nil {
+			flushLogs(logWriter, errorLog)
+		}
+		if err != nil {
+			stop()
+			return result, err
+		}
+		r.collectCore(cmd, &result)
+		wait := jittered(delay, r.opts.RetryJitter, rand.Float64())
+		if !r.retryable(result, deadline, wait) {
+			break
+		}
+		r.logf("Attempt %d of job %s failed, retrying in %v", result.Attempts, r.opts.Name, wait)
+		exitCode := result.jobExitCode()
+		r.emit(result.RunID, events.Event{Event: events.Retrying, Attempt: result.Attempts, ExitCode: &exitCode, DelaySeconds: wait.Seconds()})
+		if r.opts.Health != nil {
+			r.opts.Health.Retrying()
+		}
+		r.clock.Sleep(wait)
+		delay *= 2
+	}
+	work.finish()
+	r.finishReadOnly(watcher, &result)
+	r.finishAudit(tracer, result)
+	r.clearCheckpoint(result)
+	r.finishSnapshots(snapshots, &result)
+	r.writeCustomMetrics(metricsFile)
+
+	// wait if idle is active, a command that could not be executed did not run
+	if r.opts.IdleSeconds > 0 && result.ExecError == "" {
+		job.IdleWait(r.clock, result.StartTime, r.opts.IdleSeconds)
+	}
+
+	stop()
+
+	// Calculate final durations
+	result.Duration = work.duration()
+	result.WallDuration = r.clock.Since(result.StartTime)
+	if logWriter == nil {
+		result.Output = buf.Bytes()
+	}
+
+	result.Severity = r.severity(result)
+	r.writeFinished(result)
+	return result, nil
+}
+
+// waitPrechecks evaluates the prechecks until they all pass or PrecheckWait is exceeded.
+// It returns the reason of the failing check if the run must be skipped, empty otherwise.
+func (r *Runner) waitPrechecks() string {
+	if len(r.opts.Prechecks) == 0 {
+		return ""
+	}
+	deadline := r.clock.Now().Add(r.opts.PrecheckWait)
+	for {
+		check, detail := r.failingPrecheck()
+		if check == nil {
+			return ""
+		}
+		if !r.clock.Now().Before(deadline) {
+			r.logf("Skipping job %s: %s", r.opts.Name, detail)
+			return check.Reason()
+		}
+		r.logf("Delaying job %s: %s", r.opts.Name, detail)
+		r.clock.Sleep(min(precheckInterval, deadline.Sub(r.clock.Now())))
+	}
+}
+
+// failingPrecheck returns the first precheck that does not pass and why.
+// Checks that cannot be evaluated are logged and considered passing, so a broken probe never blocks a job.
+func (r *Runner) failingPrecheck() (precheck.Check, string) {
+	for _, check := range r.opts.Prechecks {
+		ready, detail, err := check.Ready()
+		if err != nil {
+			log.Printf("Ignoring %s precheck: %v", check.Reason(), err)
+			continue
+		}
+		if !ready {
+			return check, detail
+		}
+	}
+	return nil, ""
+}
+
+// openErrorLog opens the ErrorLog file of the run and records its path in result, nil if it is not configured
+func (r *Runner) openErrorLog(result *Result) (*logwriter.LogWriter, error) {
+	if r.opts.ErrorLog == "" {
+		return nil, nil
+	}
+	errorLog, err := r.openLogWriter(r.opts.ErrorLog, "error_log", result.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create error log writer: %w", err)
+	}
+	if errorLog != nil {
+		result.ErrorLogFile = errorLog.Path()
+	}
+	return errorLog, nil
+}
+
+// flushLogs flushes the buffered output of the log writers that are not nil
+func flushLogs(logWriters ...*logwriter.LogWriter) {
+	for _, logWriter := range logWriters {
+		if logWriter == nil {
+			continue
+		}
+		if err := logWriter.Wait(); err != nil {
+			log.Printf("Error flushing log file: %v", err)
+		}
+	}
+}
+
+// openLogWriter opens the log file at path for the run runID. If writing it is denied, the log is written to the
+// fallback directory instead, or discarded without one, so the job still runs; it returns a nil writer then.
+// component names the log in the degraded metric.
+func (r *Runner) openLogWriter(path, component, runID string) (*logwriter.LogWriter, error) {
+	logOpts := r.opts.LogFileOptions
+	if r.opts.Cipher != nil {
+		logOpts = slices.Concat(logOpts, []logwriter.Option{logwriter.WithCipher(r.opts.Cipher)})
+	}
+	logPath := strings.ReplaceAll(path, RunIDPlaceholder, runID)
+	logWriter, err := logwriter.NewLogWriter(logPath, logOpts...)
+	if err == nil || !errors.Is(err, fs.ErrPermission) {
+		return logWriter, err
+	}
+	log.Print(fileperm.DiagnoseWriteError(logPath, err))
+	r.exp.WriteDegraded(r.opts.Name, component)
+
+	if r.opts.FallbackDir != "" {
+		fallbackPath := filepath.Join(r.opts.FallbackDir, filepath.Base(logPath))
+		logWriter, err := logwriter.NewLogWriter(fallbackPath, logOpts...)
+		if err == nil {
+			r.logf("Writing job output to fallback log file %s", fallbackPath)
+			return logWriter, nil
+		}
+		log.Print(fileperm.DiagnoseWriteError(fallbackPath, err))
+	}
+	r.logf("Discarding job output")
+	return nil, nil
+}
+
+// checkPreviousRun reconciles runs left running by processes that no longer exist,
+// and exports whether the previous run of the job was one of them
+func (r *Runner) checkPreviousRun() (previous state.RunState, found bool) {
+	if r.store == nil {
+		return state.RunState{}, false
+	}
+	if _, err := Reconcile(r.store, r.exp); err != nil {
+		log.Printf("Failed to reconcile job states: %v", err)
+	}
+	previous, found, err := r.store.Load(r.opts.Name)
+	if err != nil {
+		log.Printf("Failed to load job state: %v", err)
+		return state.RunState{}, false
+	}
+	incomplete := "0"
+	if found && previous.Incomplete {
+		r.logf("Previous run of job %s started at %s (pid %d) never finished", r.opts.Name, previous.StartTime.Format(time.RFC3339), previous.PID)
+		incomplete = "1"
+	}
+	r.exp.WriteGauge("previous_run_incomplete", r.opts.Name, incomplete, helpIncomplete)
+	return previous, found
+}
+
+// checkCollision warns and exports name_collision if another job uses the name with a different command line,
+// either running now or recorded as the previous run, as their metrics are merged
+func (r *Runner) checkCollision(previous state.RunState, found bool) {
+	others := slices.Clone(r.opts.Collisions)
+	// A previous run still running is usually among the collisions already
+	if len(others) == 0 && found && previous.Command != "" && previous.Command != r.commandLine() {
+		others = append(others, fmt.Sprintf("run %s (pid %d) of %s", previous.RunID, previous.PID, previous.Command))
+	}
+	collision := "0"
+	for _, other := range others {
+		// Logged even with Quiet, the jobs silently merge their metrics
+		log.Printf("Job name %s is also used by %s, give the jobs distinct names to keep their metrics apart", r.opts.Name, other)
+		collision = "1"
+	}
+	r.exp.WriteGauge("name_collision", r.opts.Name, collision, helpNameCollision)
+}
+
+// register records the job in the registry if it is enabled, failures are logged
+func (r *Runner) register(result Result) {
+	if r.jobs == nil {
+		return
+	}
+	entry := registry.Job{
+		Name:       r.opts.Name,
+		Owner:      r.exp.Owner(),
+		Command:    r.commandLine(),
+		Schedule:   r.opts.Schedule,
+		User:       currentUser(),
+		Provenance: r.opts.Provenance,
+		LastRun:    result.StartTime,
+	}
+	if err := r.jobs.Record(entry); err != nil {
+		log.Printf("Failed to record job in the registry: %v", err)
+	}
+}
+
+// currentUser returns the name of the user running cronmgr, or its ID if it has no name
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(os.Getuid())
+}
+
+// commandLine returns the command line of the job as recorded in its state
+func (r *Runner) commandLine() string {
+	return job.CommandLine(r.opts.Command, r.opts.Args)
+}
+
+// logf logs an informational message unless Quiet is set, problems are logged with log.Printf
+func (r *Runner) logf(format string, args ...any) {
+	if !r.opts.Quiet {
+		log.Printf(format, args...)
+	}
+}
+
+// saveState records the state of the run if the state store is enabled, failures are logged
+func (r *Runner) saveState(runState state.RunState) {
+	if r.store == nil {
+		return
+	}
+	if err := r.store.Save(runState); err != nil {
+		log.Printf("Failed to save job state: %v", err)
+	}
+}
+
+// appendHistory records the finished run in the history journal if the state store is enabled
+// and compacts runs older than the retention, failures are logged
+func (r *Runner) appendHistory(result Result, finishTime time.Time) {
+	if r.journal == nil {
+		return
+	}
+	if err := r.journal.Append(r.record(result, finishTime)); err != nil {
+		log.Printf("Failed to append run history: %v", err)
+	}
+	if _, err := r.journal.Compact(r.opts.Name, r.opts.HistoryRetention, finishTime); err != nil {
+		log.Printf("Failed to compact run history: %v", err)
+	}
+}
+
+// record returns the history record of the run finished at finishTime
+func (r *Runner) record(result Result, finishTime time.Time) history.Record {
+	status, errorType := result.outcome()
+	env := result.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	// The command runs in the working directory of cronmgr
+	dir, _ := os.Getwd()
+	return history.Record{
+		Name:            r.opts.Name,
+		Owner:           r.exp.Owner(),
+		RunID:           result.RunID,
+		StartTime:       result.StartTime,
+		FinishTime:      finishTime,
+		DurationSeconds: result.Duration.Seconds(),
+		Status:          status,
+		ErrorType:       errorType,
+		ExitCode:        result.jobExitCode(),
+		Attempts:        result.Attempts,
+		LogFile:         result.LogFile,
+		Args:            result.Args,
+		Env:             history.RedactEnv(env),
+		Dir:             dir,
+	}
+}
+
+// reportExecError logs why the command could not be executed and classifies the error
+func (r *Runner) reportExecError(path string, err error) job.ExecErrorType {
+	execErr := job.ClassifyExecError(path, err)
+	if execErr == job.ExecErrorNotFound {
+		// Report where the command might live
+		if candidates := job.CommandCandidates(r.opts.Command); len(candidates) > 0 {
+			log.Printf("%v (found candidates: %s; use an absolute path or --resolve-path)", err, strings.Join(candidates, ", "))
+		} else {
+			log.Printf("%v (PATH=%s)", err, os.Getenv("PATH"))
+		}
+	} else {
+		log.Printf("Failed to execute command (%s): %v", execErr, err)
+	}
+	return execErr
+}
+
+// workTimer measures the time the command runs, excluding idle wait after it exited
+type workTimer struct {
+	clock    clock.Clock
+	start    time.Time
+	mu       sync.Mutex
+	finished bool
+	elapsed  time.Duration
+}
+
+// finish stops the timer
+func (w *workTimer) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.elapsed = w.clock.Since(w.start)
+	w.finished = true
+}
+
+// duration returns the elapsed work time, up to now if the command is still running
+func (w *workTimer) duration() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.finished {
+		return w.elapsed
+	}
+	return w.clock.Since(w.start)
+}
+
+// writeProgress writes the metrics updated every second while the job runs
+func (r *Runner) writeProgress(work *workTimer) {
+	// Log current duration
+	r.exp.WriteGauge("duration_seconds", r.opts.Name, r.formatSeconds(work.duration()), helpDuration)
+	r.exp.WriteGauge("wall_seconds", r.opts.Name, r.formatSeconds(r.clock.Since(work.start)), helpWall)
+	// Store last timestamp
+	r.exp.WriteGauge("last_run_timestamp_seconds", r.opts.Name, r.formatTimestamp(r.clock.Now()), helpLastRun)
+}
+
+// finalGauge is a gauge describing the final state of a run
+type finalGauge struct {
+	name  string
+	value string
+	help  string
+}
+
+// finalGauges returns the gauges describing the final state of a run
+func (r *Runner) finalGauges(result Result) []finalGauge {
+	failed := "0"
+	if result.Failed() {
+		failed = "1"
+	}
+	gauges := []finalGauge{
+		{name: "failed", value: failed, help: helpFailed},
+		{name: "exit_code", value: strconv.Itoa(result.jobExitCode()), help: helpExitCode},
+		// Job is no longer running
+		{name: "running", value: "0", help: helpRunning},
+		// Store final duration and last timestamp
+		{name: "duration_seconds", value: r.formatSeconds(result.Duration), help: helpDuration},
+		{name: "wall_seconds", value: r.formatSeconds(result.WallDuration), help: helpWall},
+		{name: "last_run_timestamp_seconds", value: r.formatTimestamp(r.clock.Now()), help: helpLastRun},
+	}
+	if r.opts.Retries > 0 {
+		gauges = append(gauges, finalGauge{name: "attempts", value: strconv.Itoa(result.Attempts), help: helpAttempts})
+	}
+	return gauges
+}
+
+// writeFinished writes the final metrics of a run and pushes them to the configured Pushgateway and cloud backends
+func (r *Runner) writeFinished(result Result) {
+	name := r.opts.Name
+	status, errorType := result.outcome()
+	labels := map[string]string{"status": status}
+	if errorType != "" {
+		labels["error_type"] = errorType
+	}
+	if result.Severity != "" {
+		labels["severity"] = result.Severity
+	}
+	r.exp.IncrementCounter("runs_total", name, labels, helpRunsTotal)
+	r.emit(result.RunID, finishedEvent(result))
+	if result.ExecError != "" {
+		r.exp.IncrementCounter("exec_errors_total", name, map[string]string{"exec_error": string(result.ExecError)}, helpExecErrsTotal)
+	}
+
+	gauges := r.finalGauges(result)
+	// The job completed when the command exited, before any idle wait
+	completedAt := result.StartTime.Add(result.Duration)
+	for _, g := range gauges {
+		if r.opts.SampleTimestamps {
+			r.exp.WriteGaugeAt(g.name, name, g.value, completedAt, g.help)
+		} else {
+			r.exp.WriteGauge(g.name, name, g.value, g.help)
+		}
+		if i := slices.IndexFunc(legacyGauges, func(l exporter.LegacyGauge) bool { return l.Metric == g.name }); i >= 0 && r.opts.LegacyMetrics {
+			r.exp.WriteLegacy(name, legacyGauges[i].Dimension, g.value)
+		}
+	}
+	r.exp.CheckSize(name)
+
+	// The run is complete once its final metrics are written
+	finishTime := r.clock.Now()
+	r.saveState(state.RunState{
+		Name:       name,
+		Owner:      r.exp.Owner(),
+		RunID:      result.RunID,
+		PID:        os.Getpid(),
+		StartTime:  result.StartTime,
+		FinishTime: finishTime,
+		ExitCode:   result.jobExitCode(),
+		LogFile:    result.LogFile,
+		Command:    r.commandLine(),
+	})
+	r.clearIntent()
+	r.appendHistory(result, finishTime)
+	r.touchFile(result)
+
+	if r.opts.PushgatewayURL != "" {
+		r.push(gauges)
+	}
+	if r.opts.CloudWatch != nil {
+		r.putCloudWatch(gauges, completedAt)
+	}
+	if r.opts.CloudMonitoring != nil {
+		r.writeCloudMonitoring(gauges)
+	}
+	if r.opts.Influx != nil || r.opts.InfluxFile != "" {
+		r.writeInflux(gauges, completedAt)
+	}
+	if r.opts.MQTT != nil {
+		r.publishResult(r.record(result, finishTime))
+	}
+	if len(r.opts.Notifiers) > 0 {
+		r.notify(result, finishTime)
+	}
+	if r.opts.Inventory != nil {
+		r.pushInventory()
+	}
+}
+
+// pushPayload is the push of the final gauges of a job to the Pushgateway
+type pushPayload struct {
+	Name   string              `json:"name"`
+	Gauges []pushgateway.Gauge `json:"gauges"`
+}
+
+// push sends the final gauges to the Pushgateway, failures are logged but do not fail the run
+func (r *Runner) push(gauges []finalGauge) {
+	payload := pushPayload{Name: r.opts.Name}
+	for _, g := range gauges {
+		payload.Gauges = append(payload.Gauges, pushgateway.Gauge{Name: r.exp.FullMetricName(g.name), Help: g.help, Value: g.value})
+	}
+
+	pusher := pushgateway.NewPusher(r.opts.PushgatewayURL, r.exp.MetricPrefix(), r.opts.HTTPClient)
+	// The Pushgateway only keeps the last push of a job, which supersedes the spooled ones
+	target := r.opts.PushgatewayURL + " " + r.exp.MetricPrefix()
+	err := r.submit(spoolPushgateway, target, r.opts.Name, payload, func(content []byte) error {
+		var p pushPayload
+		if err := json.Unmarshal(content, &p); err != nil {
+			return err
+		}
+		return pusher.Push(context.Background(), p.Name, p.Gauges)
+	})
+	if err != nil {
+		log.Printf("Failed to push metrics: %v", err)
+	}
+}
@@ -0,0 +1,1937 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/audit"
+	"github.com/alswl/cron-manager/internal/cloudmonitoring"
+	"github.com/alswl/cron-manager/internal/cloudwatch"
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/alswl/cron-manager/internal/history"
+	"github.com/alswl/cron-manager/internal/influx"
+	"github.com/alswl/cron-manager/internal/inventory"
+	"github.com/alswl/cron-manager/internal/job"
+	"github.com/alswl/cron-manager/internal/mqtt"
+	"github.com/alswl/cron-manager/internal/notify"
+	"github.com/alswl/cron-manager/internal/precheck"
+	"github.com/alswl/cron-manager/internal/queue"
+	"github.com/alswl/cron-manager/internal/registry"
+	"github.com/alswl/cron-manager/internal/secret"
+	"github.com/alswl/cron-manager/internal/severity"
+	"github.com/alswl/cron-manager/internal/state"
+	"github.com/alswl/cron-manager/internal/testutil"
+	"github.com/alswl/cron-manager/internal/version"
+	"github.com/spf13/afero"
+)
+
+// newTestOptions creates RunnerOptions writing metrics to an in-memory exporter
+func newTestOptions(mem *testutil.MemExporter, command string, args ...string) RunnerOptions {
+	return RunnerOptions{
+		Name:            "test_job",
+		Command:         command,
+		Args:            args,
+		ExporterOptions: mem.Options(),
+	}
+}
+
+// TestRunnerOptionsValidate tests the Validate function
+func TestRunnerOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      RunnerOptions
+		wantError bool
+	}{
+		{
+			name: "valid options",
+			opts: RunnerOptions{Name: "job", Command: "echo"},
+		},
+		{
+			name:      "missing name",
+			opts:      RunnerOptions{Command: "echo"},
+			wantError: true,
+		},
+		{
+			name:      "missing command",
+			opts:      RunnerOptions{Name: "job"},
+			wantError: true,
+		},
+		{
+			name:      "negative idle seconds",
+			opts:      RunnerOptions{Name: "job", Command: "echo", IdleSeconds: -1},
+			wantError: true,
+		},
+		{
+			name:      "canary above 100",
+			opts:      RunnerOptions{Name: "job", Command: "echo", Canary: 101},
+			wantError: true,
+		},
+		{
+			name:      "negative stop grace",
+			opts:      RunnerOptions{Name: "job", Command: "echo", StopGrace: -time.Second},
+			wantError: true,
+		},
+		{
+			name:      "timeout warning at 100",
+			opts:      RunnerOptions{Name: "job", Command: "echo", TimeoutWarning: 100},
+			wantError: true,
+		},
+		{
+			name:      "negative precheck wait",
+			opts:      RunnerOptions{Name: "job", Command: "echo", PrecheckWait: -time.Second},
+			wantError: true,
+		},
+		{
+			name:      "negative capacity wait",
+			opts:      RunnerOptions{Name: "job", Command: "echo", CapacityWait: -time.Second},
+			wantError: true,
+		},
+		{
+			name:      "negative readiness timeout",
+			opts:      RunnerOptions{Name: "job", Command: "echo", ReadinessTimeout: -time.Second},
+			wantError: true,
+		},
+		{
+			name:      "negative advisory lock wait",
+			opts:      RunnerOptions{Name: "job", Command: "echo", AdvisoryLockWait: -time.Second},
+			wantError: true,
+		},
+		{
+			name:      "time precision beyond nanoseconds",
+			opts:      RunnerOptions{Name: "job", Command: "echo", TimePrecision: 10},
+			wantError: true,
+		},
+		{
+			name: "inventory without registry",
+			opts: RunnerOptions{Name: "job", Command: "echo",
+				Inventory: inventory.NewPusher(inventory.Config{URL: "http://inventory"})},
+			wantError: true,
+		},
+		{
+			name:      "reserved provenance key",
+			opts:      RunnerOptions{Name: "job", Command: "echo", Provenance: map[string]string{"name": "other"}},
+			wantError: true,
+		},
+		{
+			name:      "invalid provenance key",
+			opts:      RunnerOptions{Name: "job", Command: "echo", Provenance: map[string]string{"git-repo": "infra"}},
+			wantError: true,
+		},
+		{
+			name:      "notification limit without state dir",
+			opts:      RunnerOptions{Name: "job", Command: "echo", NotifyLimit: notify.Limit{Count: 1, Window: time.Hour}},
+			wantError: true,
+		},
+		{
+			name:      "negative retries",
+			opts:      RunnerOptions{Name: "job", Command: "echo", Retries: -1},
+			wantError: true,
+		},
+		{
+			name:      "retry jitter above one",
+			opts:      RunnerOptions{Name: "job", Command: "echo", RetryJitter: 1.5},
+			wantError: true,
+		},
+		{
+			name:      "negative attempt timeout",
+			opts:      RunnerOptions{Name: "job", Command: "echo", AttemptTimeout: -time.Second},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantError {
+				t.Errorf("Validate() error = %v, wantError %v", err, tt.wantError)
+			}
+			if _, err := NewRunner(tt.opts); (err != nil) != tt.wantError {
+				t.Errorf("NewRunner() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+// TestRunnerRun tests complete runs and the metrics they leave behind
+func TestRunnerRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		command      string
+		exitCode     int
+		wantFailed   bool
+		wantExitCode int
+		wantMetrics  []string
+	}{
+		{
+			name:         "successful job",
+			exitCode:     0,
+			wantExitCode: 0,
+			wantMetrics: []string{
+				`crontab_failed{name="test_job"} 0`,
+				`crontab_exit_code{name="test_job"} 0`,
+				`crontab_running{name="test_job"} 0`,
+				`crontab_runs_total{name="test_job",status="started"} 1`,
+				`crontab_runs_total{name="test_job",status="success"} 1`,
+			},
+		},
+		{
+			name:         "failing job",
+			exitCode:     3,
+			wantFailed:   true,
+			wantExitCode: 0,
+			wantMetrics: []string{
+				`crontab_failed{name="test_job"} 1`,
+				`crontab_exit_code{name="test_job"} 3`,
+				`crontab_running{name="test_job"} 0`,
+				`crontab_runs_total{name="test_job",error_type="job",status="failed"} 1`,
+			},
+		},
+		{
+			name:         "command not found",
+			command:      "cronmgr-no-such-command",
+			wantFailed:   true,
+			wantExitCode: job.ExecErrorNotFound.ExitCode(),
+			wantMetrics: []string{
+				`crontab_failed{name="test_job"} 1`,
+				`crontab_exit_code{name="test_job"} 127`,
+				`crontab_running{name="test_job"} 0`,
+				`crontab_runs_total{name="test_job",error_type="exec",status="failed"} 1`,
+				`crontab_exec_errors_total{name="test_job",exec_error="not_found"} 1`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			command := tt.command
+			if command == "" {
+				command = testutil.ExitScript(t, tt.exitCode)
+			}
+			r, err := NewRunner(newTestOptions(mem, command))
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Failed() != tt.wantFailed {
+				t.Errorf("Failed() = %v, want %v", result.Failed(), tt.wantFailed)
+			}
+			if result.ExitCode() != tt.wantExitCode {
+				t.Errorf("ExitCode() = %v, want %v", result.ExitCode(), tt.wantExitCode)
+			}
+
+			content := mem.Content()
+			for _, metric := range tt.wantMetrics {
+				if !strings.Contains(content, metric+"\n") {
+					t.Errorf("Expected metric %q, got:\n%s", metric, content)
+				}
+			}
+
+			// The job was marked as running before it finished
+			if history := mem.History(`crontab_running{name="test_job"}`); fmt.Sprint(history) != "[1 0]" {
+				t.Errorf("running history = %v, want [1 0]", history)
+			}
+		})
+	}
+}
+
+// TestRunnerRunWithLogFile tests that command output is written to the log file
+func TestRunnerRunWithLogFile(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	logPath := filepath.Join(t.TempDir(), "job.log")
+
+	opts := newTestOptions(mem, testutil.OutputScript(t, "out", "err", 0))
+	opts.LogFile = logPath
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(content), "out") || !strings.Contains(string(content), "err") {
+		t.Errorf("Log file should contain stdout and stderr, got %q", content)
+	}
+}
+
+// TestRunnerRunErrorLog tests that only stderr is written to the error log, in addition to the log file
+func TestRunnerRunErrorLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		logFile    bool
+		forEach    bool
+		wantOutput []string
+	}{
+		{name: "without log file", wantOutput: []string{"out\n", "err\n"}},
+		{name: "with log file", logFile: true},
+		{name: "for each", logFile: true, forEach: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := newTestOptions(testutil.NewMemExporter(), testutil.OutputScript(t, "out", "err", 1))
+			opts.MaxCapturedOutput = 1024
+			opts.ErrorLog = filepath.Join(dir, "job.err")
+			if tt.logFile {
+				opts.LogFile = filepath.Join(dir, "job.log")
+			}
+			if tt.forEach {
+				opts.ForEach = true
+				opts.Items = []string{"item"}
+			}
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if result.ErrorLogFile != opts.ErrorLog {
+				t.Errorf("ErrorLogFile = %q, want %q", result.ErrorLogFile, opts.ErrorLog)
+			}
+			content, err := os.ReadFile(opts.ErrorLog)
+			if err != nil {
+				t.Fatalf("Failed to read error log: %v", err)
+			}
+			if string(content) != "err\n" {
+				t.Errorf("Error log = %q, want only stderr", content)
+			}
+			if tt.logFile {
+				content, err := os.ReadFile(opts.LogFile)
+				if err != nil {
+					t.Fatalf("Failed to read log file: %v", err)
+				}
+				if !strings.Contains(string(content), "out") || !strings.Contains(string(content), "err") {
+					t.Errorf("Log file should contain stdout and stderr, got %q", content)
+				}
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(string(result.Output), want) {
+					t.Errorf("Output = %q, want it to contain %q", result.Output, want)
+				}
+			}
+			if len(tt.wantOutput) == 0 && len(result.Output) > 0 {
+				t.Errorf("Output = %q, want none with a log file", result.Output)
+			}
+		})
+	}
+}
+
+// TestRunnerRunLogFilePerRun tests that the run ID placeholder keeps one log file per run,
+// and that the log file of each run is recorded in the state and history
+func TestRunnerRunLogFilePerRun(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	clk := testutil.NewFakeClock(start)
+	mem := testutil.NewMemExporter()
+	dir := t.TempDir()
+
+	opts := newTestOptions(mem, "echo", "out")
+	opts.Clock = clk
+	opts.LogFile = filepath.Join(dir, "job-"+RunIDPlaceholder+".log")
+	opts.StateDir = filepath.Join(dir, "state")
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	var results []Result
+	for range 2 {
+		result, err := r.Run()
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		results = append(results, result)
+		clk.Advance(time.Hour)
+	}
+
+	wantID := RunID(start, os.Getpid())
+	if results[0].RunID != wantID {
+		t.Errorf("RunID = %q, want %q", results[0].RunID, wantID)
+	}
+	if results[0].LogFile == results[1].LogFile {
+		t.Errorf("runs share the log file %s", results[0].LogFile)
+	}
+	if want := filepath.Join(dir, "job-"+wantID+".log"); results[0].LogFile != want {
+		t.Errorf("LogFile = %q, want %q", results[0].LogFile, want)
+	}
+	for _, result := range results {
+		if content, err := os.ReadFile(result.LogFile); err != nil || string(content) != "out\n" {
+			t.Errorf("log file %s = %q, %v, want output of the run", result.LogFile, content, err)
+		}
+	}
+
+	records, err := history.NewJournal(afero.NewOsFs(), filepath.Join(opts.StateDir, HistoryDir)).Read("test_job", time.Time{})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	for i, record := range records {
+		if record.RunID != results[i].RunID || record.LogFile != results[i].LogFile {
+			t.Errorf("record %d = %+v, want run %s logged to %s", i, record, results[i].RunID, results[i].LogFile)
+		}
+	}
+	store := state.NewStore(afero.NewOsFs(), opts.StateDir)
+	latest, _, err := store.Load("test_job")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if latest.RunID != results[1].RunID || latest.LogFile != results[1].LogFile {
+		t.Errorf("state = %+v, want run %s logged to %s", latest, results[1].RunID, results[1].LogFile)
+	}
+	if intents, err := store.Intents(); err != nil || len(intents) != 0 {
+		t.Errorf("Intents() = %+v, %v, want the intents of the reported runs removed", intents, err)
+	}
+}
+
+// TestRunnerArgv tests the command line reported for --print-argv
+func TestRunnerArgv(t *testing.T) {
+	tests := []struct {
+		name       string
+		loginShell string
+		privileges *job.Privileges
+		scope      *job.SystemdScope
+		want       []string
+	}{
+		{name: "verbatim", want: []string{"printf", "%s|", "", "--", "-x"}},
+		{name: "login shell", loginShell: "bash", want: []string{"bash", "-lc", `exec printf '%s|' '' -- -x`}},
+		{name: "systemd scope", scope: &job.SystemdScope{Slice: "batch.slice"},
+			want: []string{"systemd-run", "--scope", "--quiet", "--slice=batch.slice", "--", "printf", "%s|", "", "--", "-x"}},
+		{name: "login shell in systemd scope", loginShell: "bash", scope: &job.SystemdScope{},
+			want: []string{"systemd-run", "--scope", "--quiet", "--", "bash", "-lc", `exec printf '%s|' '' -- -x`}},
+		{name: "dropped privileges in systemd scope", privileges: &job.Privileges{Executable: "/usr/bin/cronmgr", DropCaps: true}, scope: &job.SystemdScope{},
+			want: []string{"systemd-run", "--scope", "--quiet", "--", "/usr/bin/cronmgr", "drop-privileges", "--drop-caps", "--", "printf", "%s|", "", "--", "-x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newTestOptions(testutil.NewMemExporter(), "printf", "%s|", "", "--", "-x")
+			opts.LoginShell = tt.loginShell
+			opts.Privileges = tt.privileges
+			opts.SystemdScope = tt.scope
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			if got := r.Argv(); !slices.Equal(got, tt.want) {
+				t.Errorf("Argv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunnerRunCapturedOutput tests that output without a log file is kept up to MaxCapturedOutput bytes
+func TestRunnerRunCapturedOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		{name: "discarded", limit: 0, want: ""},
+		{name: "tail", limit: 6, want: "\nerr1\n"},
+		{name: "all", limit: 1024, want: "out1\nerr1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newTestOptions(testutil.NewMemExporter(), testutil.OutputScript(t, "out1", "err1", 0))
+			opts.MaxCapturedOutput = tt.limit
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got := string(result.Output); got != tt.want {
+				t.Errorf("Output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunnerRunQuiet tests that Quiet suppresses informational messages but not problems
+func TestRunnerRunQuiet(t *testing.T) {
+	tests := []struct {
+		name       string
+		quiet      bool
+		command    func(t *testing.T) string
+		wantLogged bool
+	}{
+		{name: "retry logged", command: func(t *testing.T) string { return testutil.FailingScript(t, 1, 75) }, wantLogged: true},
+		{name: "retry quiet", quiet: true, command: func(t *testing.T) string { return testutil.FailingScript(t, 1, 75) }},
+		{name: "exec error quiet", quiet: true, command: func(t *testing.T) string { return "/nonexistent/command" }, wantLogged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			defer log.SetOutput(log.Writer())
+			log.SetOutput(&logged)
+
+			opts := newTestOptions(testutil.NewMemExporter(), tt.command(t))
+			opts.Retries = 1
+			opts.Quiet = tt.quiet
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			if _, err := r.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got := logged.Len() > 0; got != tt.wantLogged {
+				t.Errorf("logged %q, want logged %v", logged.String(), tt.wantLogged)
+			}
+		})
+	}
+}
+
+// TestRunnerRunLogFileError tests that an unwritable log file is an error and the job is not started
+func TestRunnerRunLogFileError(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+	opts.LogFile = filepath.Join(t.TempDir(), "missing", "job.log")
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+
+	if _, err := r.Run(); err == nil {
+		t.Fatal("Run() expected error for unwritable log file")
+	}
+	if mem.Content() != "" {
+		t.Error("No metrics should be written when the run could not be set up")
+	}
+}
+
+// TestRunnerRunIdleWait tests that idle wait extends the run on the injected clock without sleeping
+func TestRunnerRunIdleWait(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	clk := testutil.NewFakeClock(start)
+	mem := testutil.NewMemExporter()
+
+	opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+	opts.IdleSeconds = 60
+	opts.Clock = clk
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+
+	before := time.Now()
+	result, err := r.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(before); elapsed > 5*time.Second {
+		t.Errorf("Run() should not sleep for real, took %v", elapsed)
+	}
+
+	// Idle wait counts towards the wall-clock duration only
+	if result.Duration != 0 {
+		t.Errorf("Duration = %v, want 0", result.Duration)
+	}
+	if result.WallDuration != 60*time.Second {
+		t.Errorf("WallDuration = %v, want 60s", result.WallDuration)
+	}
+	if value, _ := mem.Value(`crontab_duration_seconds{name="test_job"}`); value != "0.00" {
+		t.Errorf("duration_seconds = %v, want 0.00", value)
+	}
+	if value, _ := mem.Value(`crontab_wall_seconds{name="test_job"}`); value != "60.00" {
+		t.Errorf("wall_seconds = %v, want 60.00", value)
+	}
+	wantTimestamp := fmt.Sprintf("%d", start.Add(60*time.Second).Unix())
+	if value, _ := mem.Value(`crontab_last_run_timestamp_seconds{name="test_job"}`); value != wantTimestamp {
+		t.Errorf("last_run_timestamp_seconds = %v, want %v", value, wantTimestamp)
+	}
+}
+
+// TestRunnerRunBuildInfo tests that the version of cronmgr running the job is exported
+func TestRunnerRunBuildInfo(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	r, err := NewRunner(newTestOptions(mem, testutil.ExitScript(t, 0)))
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := fmt.Sprintf(`crontab_build_info{name="test_job",commit="%s",go_version="%s",version="%s"} 1`,
+		version.Commit, version.GoVersion, version.Version)
+	if !strings.Contains(mem.Content(), want) {
+		t.Errorf("Expected metric %q, got:\n%s", want, mem.Content())
+	}
+}
+
+// TestRunnerRunProvenance tests that the provenance of the job definition is exported as info metric
+func TestRunnerRunProvenance(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+	opts.Provenance = map[string]string{"repo": "infra", "commit": "abc123"}
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := `crontab_provenance_info{name="test_job",commit="abc123",repo="infra"} 1`
+	if !strings.Contains(mem.Content(), want) {
+		t.Errorf("Expected metric %q, got:\n%s", want, mem.Content())
+	}
+
+	// Without provenance, no info metric is written
+	mem = testutil.NewMemExporter()
+	r, err = NewRunner(newTestOptions(mem, testutil.ExitScript(t, 0)))
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if strings.Contains(mem.Content(), "provenance_info") {
+		t.Errorf("Unexpected provenance_info metric:\n%s", mem.Content())
+	}
+}
+
+// TestRunnerRunCustomMetrics tests that metrics the command writes to CRONMGR_METRICS_FILE are exported
+func TestRunnerRunCustomMetrics(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	script := testutil.WriteScript(t, "report.sh", `echo "cronmgr-metric rows_exported 12345" >> "$CRONMGR_METRICS_FILE"
+echo "$CRONMGR_METRICS_FILE" > "$(dirname "$0")/metrics_file"`)
+	opts := newTestOptions(mem, script)
+	opts.CustomMetrics = true
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := `crontab_custom{name="test_job",metric="rows_exported"} 12345`
+	if !strings.Contains(mem.Content(), want) {
+		t.Errorf("Expected metric %q, got:\n%s", want, mem.Content())
+	}
+
+	path, err := os.ReadFile(filepath.Join(filepath.Dir(script), "metrics_file"))
+	if err != nil {
+		t.Fatalf("Failed to read metrics file path: %v", err)
+	}
+	if _, err := os.Stat(strings.TrimSpace(string(path))); !os.IsNotExist(err) {
+		t.Errorf("Custom metrics file should be removed after the run, stat error = %v", err)
+	}
+}
+
+// TestRunnerRunReadOnly tests that changing a read-only path fails the run, unlike the files of cronmgr itself
+func TestRunnerRunReadOnly(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("read-only paths are watched with inotify")
+	}
+	tests := []struct {
+		name       string
+		script     string
+		wantStatus string
+	}{
+		{name: "read", script: "cat data/input.csv", wantStatus: `status="success"`},
+		{name: "write", script: "echo x >> data/input.csv", wantStatus: `error_type="readonly",status="failed"`},
+		{name: "create", script: "touch data/report.txt", wantStatus: `error_type="readonly",status="failed"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "data", "input.csv"), []byte("a,b\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, "sh", "-c", "cd "+dir+" && "+tt.script)
+			opts.ReadOnlyPaths = []string{filepath.Join(dir, "data")}
+			// The log file of cronmgr is not a change of the job
+			opts.LogFile = filepath.Join(dir, "data", "job.log")
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if !strings.Contains(mem.Content(), tt.wantStatus) {
+				t.Errorf("Expected %s in:\n%s", tt.wantStatus, mem.Content())
+			}
+			if tt.wantStatus == `status="success"` {
+				if result.ReadOnlyChangeCount != 0 {
+					t.Errorf("ReadOnlyChanges = %v, want none", result.ReadOnlyChanges)
+				}
+				return
+			}
+			if result.ReadOnlyChangeCount == 0 || !strings.Contains(result.Summary("test_job"), "readonly_change=") {
+				t.Errorf("Summary() = %s, want the read-only change", result.Summary("test_job"))
+			}
+		})
+	}
+}
+
+// TestRunnerRunAudit tests writing the audit of a run, or running the job without it where tracing is
+// not available
+func TestRunnerRunAudit(t *testing.T) {
+	dir := t.TempDir()
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, "sh", "-c", "cat /etc/hostname > /dev/null; true")
+	opts.AuditFile = filepath.Join(dir, "audit", RunIDPlaceholder+".json")
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	result, err := r.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !strings.Contains(mem.Content(), `status="success"`) {
+		t.Errorf("Expected a successful run in:\n%s", mem.Content())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "audit", result.RunID+".json"))
+	tracer, startErr := audit.Start()
+	if startErr != nil {
+		if err == nil {
+			t.Errorf("Audit written although tracing is not available: %s", data)
+		}
+		return
+	}
+	tracer.Stop()
+	if err != nil {
+		t.Fatalf("Failed to read the audit: %v", err)
+	}
+	var s audit.Summary
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("Invalid audit: %v", err)
+	}
+	if s.Name != "test_job" || s.RunID != result.RunID {
+		t.Errorf("Audit = %s/%s, want test_job/%s", s.Name, s.RunID, result.RunID)
+	}
+	if !slices.ContainsFunc(s.Files, func(f audit.File) bool { return f.Path == "/etc/hostname" }) {
+		t.Errorf("Audit files = %v, want /etc/hostname", s.Files)
+	}
+}
+
+// TestRunnerRunCore tests collecting the core of a crashed command into the artifact directory of the run
+func TestRunnerRunCore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cores are only collected on Linux")
+	}
+	// Cores written to the working directory are not left in the source tree
+	t.Chdir(t.TempDir())
+	mem := testutil.NewMemExporter()
+	notifier := &fakeNotifier{}
+	opts := newTestOptions(mem, testutil.WriteScript(t, "crash.sh", "kill -SEGV $$"))
+	opts.ArtifactDir = filepath.Join(t.TempDir(), "artifacts")
+	opts.Notifiers = []notify.Notifier{notifier}
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	result, err := r.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !result.ExitStatus.CoreDumped || result.CoreFile == "" {
+		t.Skipf("no core collected: %+v", result.ExitStatus)
+	}
+	if dir := filepath.Join(opts.ArtifactDir, result.RunID); filepath.Dir(result.CoreFile) != dir {
+		t.Errorf("CoreFile = %s, want it in %s", result.CoreFile, dir)
+	}
+	if _, err := os.Stat(result.CoreFile); err != nil {
+		t.Errorf("Core not collected: %v", err)
+	}
+	if len(notifier.messages) != 1 || notifier.messages[0].CoreFile != result.CoreFile {
+		t.Errorf("Notifications = %+v, want one with the core", notifier.messages)
+	}
+	if !strings.Contains(result.Summary("test_job"), "core="+result.CoreFile) {
+		t.Errorf("Summary() = %s, want the core", result.Summary("test_job"))
+	}
+}
+
+// TestRunnerRunSeverity tests labeling failed runs with the severity of their exit code and routing
+// their notifications by it
+func TestRunnerRunSeverity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "severity.map")
+	content := "exit 3 => warning\nexit 4 => critical\nnotify warning => none\nnotify critical => fake\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	severities, err := severity.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		exitCode     int
+		wantSeverity string
+		wantNotify   bool
+	}{
+		{name: "success", exitCode: 0},
+		{name: "routed to none", exitCode: 3, wantSeverity: "warning"},
+		{name: "routed", exitCode: 4, wantSeverity: "critical", wantNotify: true},
+		{name: "default", exitCode: 5, wantSeverity: severity.Default, wantNotify: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			notifier := &fakeNotifier{}
+			opts := newTestOptions(mem, testutil.ExitScript(t, tt.exitCode))
+			opts.Severities = severities
+			opts.Notifiers = []notify.Notifier{notifier}
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Severity != tt.wantSeverity {
+				t.Errorf("Severity = %q, want %q", result.Severity, tt.wantSeverity)
+			}
+			if got := strings.Contains(mem.Content(), `severity="`+tt.wantSeverity+`"`); got != (tt.wantSeverity != "") {
+				t.Errorf("severity label written = %v, want %v:\n%s", got, tt.wantSeverity != "", mem.Content())
+			}
+			if got := len(notifier.messages) == 1; got != tt.wantNotify {
+				t.Fatalf("notified = %v, want %v", got, tt.wantNotify)
+			}
+			if tt.wantNotify && notifier.messages[0].Severity != tt.wantSeverity {
+				t.Errorf("notified severity = %q, want %q", notifier.messages[0].Severity, tt.wantSeverity)
+			}
+		})
+	}
+}
+
+// TestRunnerRunTouchFile tests that only successful runs touch the touch file and that its time is exported
+func TestRunnerRunTouchFile(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	previous := start.Add(-24 * time.Hour)
+	tests := []struct {
+		name     string
+		exitCode int
+		existing bool
+		want     time.Time
+	}{
+		{name: "success creates", want: start},
+		{name: "success touches", existing: true, want: start},
+		{name: "failure keeps", exitCode: 3, existing: true, want: previous},
+		{name: "failure without file", exitCode: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "job.ok")
+			if tt.existing {
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, previous, previous); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, testutil.ExitScript(t, tt.exitCode))
+			opts.Clock = testutil.NewFakeClock(start)
+			opts.TouchFile = path
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			if _, err := r.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if tt.want.IsZero() {
+				if !os.IsNotExist(err) {
+					t.Errorf("Touch file should not exist, stat error = %v", err)
+				}
+				if strings.Contains(mem.Content(), "touch_file_timestamp_seconds") {
+					t.Errorf("Unexpected touch file metric:\n%s", mem.Content())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to stat touch file: %v", err)
+			}
+			if !info.ModTime().Equal(tt.want) {
+				t.Errorf("Touch file modification time = %v, want %v", info.ModTime(), tt.want)
+			}
+			want := fmt.Sprintf(`crontab_touch_file_timestamp_seconds{name="test_job"} %d`, tt.want.Unix())
+			if !strings.Contains(mem.Content(), want) {
+				t.Errorf("Expected metric %q, got:\n%s", want, mem.Content())
+			}
+		})
+	}
+}
+
+// TestRunnerRunLegacyMetrics tests that the series of the original cronmanager schema are written next to the new ones
+func TestRunnerRunLegacyMetrics(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 3))
+	opts.Clock = testutil.NewFakeClock(start)
+	opts.LegacyMetrics = true
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	for _, metric := range []string{
+		`crontab_failed{name="test_job"} 1`,
+		`crontab{name="test_job",dimension="failed"} 1`,
+		`crontab{name="test_job",dimension="run"} 0`,
+		`crontab{name="test_job",dimension="duration"} 0.00`,
+		fmt.Sprintf(`crontab{name="test_job",dimension="last"} %d`, start.Unix()),
+	} {
+		if !strings.Contains(mem.Content(), metric) {
+			t.Errorf("Expected metric %q, got:\n%s", metric, mem.Content())
+		}
+	}
+}
+
+// TestRunnerRunSampleTimestamps tests that final gauges carry the completion time of the job
+func TestRunnerRunSampleTimestamps(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	clk := testutil.NewFakeClock(start)
+	mem := testutil.NewMemExporter()
+
+	opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+	opts.IdleSeconds = 60
+	opts.SampleTimestamps = true
+	opts.Clock = clk
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Idle wait does not move the completion time
+	wantTimestamp := fmt.Sprintf("%d", start.UnixMilli())
+	for _, sample := range mem.Samples() {
+		// Counters, the build info and the name collision written at the start are not final gauges
+		if strings.HasPrefix(sample.Series, "crontab_runs_total") || strings.HasPrefix(sample.Series, "crontab_build_info") ||
+			strings.HasPrefix(sample.Series, "crontab_name_collision") {
+			if sample.Timestamp != "" {
+				t.Errorf("%s should not have a timestamp, got %v", sample.Series, sample.Timestamp)
+			}
+			continue
+		}
+		if sample.Timestamp != wantTimestamp {
+			t.Errorf("%s timestamp = %v, want %v", sample.Series, sample.Timestamp, wantTimestamp)
+		}
+	}
+}
+
+// TestRunnerRunPushgateway tests that the final state is pushed to the Pushgateway
+func TestRunnerRunPushgateway(t *testing.T) {
+	var gotPath, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer server.Close()
+
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 2))
+	opts.PushgatewayURL = server.URL
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if gotPath != "/metrics/job/crontab/name/test_job" {
+		t.Errorf("push path = %v, want /metrics/job/crontab/name/test_job", gotPath)
+	}
+	for _, sample := range []string{"crontab_failed 1\n", "crontab_exit_code 2\n", "crontab_running 0\n"} {
+		if !strings.Contains(gotBody, sample) {
+			t.Errorf("pushed body missing %q, got:\n%s", sample, gotBody)
+		}
+	}
+}
+
+// TestRunnerRunCloudWatch tests putting the final state to CloudWatch with the job name and labels as dimensions
+func TestRunnerRunCloudWatch(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error = %v", err)
+		}
+		form = r.PostForm
+	}))
+	defer server.Close()
+
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 2))
+	opts.ExporterOptions = append(opts.ExporterOptions, exporter.WithLabels(map[string]string{"env": "prod"}))
+	opts.CloudWatch = cloudwatch.NewClient(cloudwatch.Config{
+		Namespace:  "Cron",
+		Region:     "us-east-1",
+		Dimensions: map[string]string{"name": "JobName"},
+		Endpoint:   server.URL,
+	})
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := map[string]string{}
+	for i := 1; form.Has(fmt.Sprintf("MetricData.member.%d.MetricName", i)); i++ {
+		member := fmt.Sprintf("MetricData.member.%d.", i)
+		got[form.Get(member+"MetricName")] = form.Get(member + "Value")
+		dimensions := form.Get(member+"Dimensions.member.1.Name") + "=" + form.Get(member+"Dimensions.member.1.Value") + "," +
+			form.Get(member+"Dimensions.member.2.Name") + "=" + form.Get(member+"Dimensions.member.2.Value")
+		if dimensions != "env=prod,JobName=test_job" {
+			t.Errorf("dimensions of %s = %s, want env=prod,JobName=test_job", form.Get(member+"MetricName"), dimensions)
+		}
+	}
+	if got["failed"] != "1" || got["exit_code"] != "2" {
+		t.Errorf("put failed = %q, exit_code = %q, want 1 and 2", got["failed"], got["exit_code"])
+	}
+	for _, name := range []string{"running", "last_run_timestamp_seconds"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("unexpected metric %s put to CloudWatch", name)
+		}
+	}
+}
+
+// TestRunnerRunCloudMonitoring tests writing the final state to Cloud Monitoring from a Compute Engine instance
+func TestRunnerRunCloudMonitoring(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			_, _ = w.Write([]byte(`{"access_token":"instance-token"}`))
+		case "/computeMetadata/v1/project/project-id":
+			_, _ = w.Write([]byte("gce-project"))
+		case "/computeMetadata/v1/instance/id":
+			_, _ = w.Write([]byte("4242"))
+		case "/computeMetadata/v1/instance/zone":
+			_, _ = w.Write([]byte("projects/123/zones/europe-west1-b"))
+		case "/v3/projects/gce-project/timeSeries":
+			content, _ := io.ReadAll(r.Body)
+			body = string(content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv(cloudmonitoring.CredentialsEnv, "")
+	t.Setenv(cloudmonitoring.MetadataHostEnv, strings.TrimPrefix(server.URL, "http://"))
+
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 2))
+	opts.CloudMonitoring = cloudmonitoring.NewClient(cloudmonitoring.Config{
+		MetricPrefix: "custom.googleapis.com/crontab",
+		Endpoint:     server.URL,
+	})
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`"type":"custom.googleapis.com/crontab/failed","labels":{"name":"test_job"}`,
+		`"resource":{"type":"gce_instance"`,
+		`"doubleValue":2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("written body missing %s, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "custom.googleapis.com/crontab/running") {
+		t.Errorf("unexpected running metric written, got:\n%s", body)
+	}
+}
+
+// TestRunnerRunInflux tests writing the final state to InfluxDB and to a line protocol file
+func TestRunnerRunInflux(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		body = string(content)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "cron.influx")
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 2))
+	opts.Clock = testutil.NewFakeClock(start)
+	opts.Influx = influx.NewWriter(influx.Config{URL: server.URL, Org: "ops", Bucket: "cron"})
+	opts.InfluxFile = path
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := fmt.Sprintf("crontab,name=test_job duration_seconds=0,exit_code=2,failed=1,wall_seconds=0 %d\n", start.UnixNano())
+	if body != want {
+		t.Errorf("written body = %q, want %q", body, want)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read line protocol file: %v", err)
+	}
+	if string(content) != want {
+		t.Errorf("line protocol file = %q, want %q", content, want)
+	}
+}
+
+// TestRunnerRunSpool tests spooling the write to InfluxDB that failed and replaying it with the next run
+func TestRunnerRunSpool(t *testing.T) {
+	var bodies []string
+	down := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		content, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(content))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	clk := testutil.NewFakeClock(start)
+	dir := filepath.Join(t.TempDir(), "spool")
+	mem := testutil.NewMemExporter()
+	for _, step := range []struct {
+		down        bool
+		wantMetrics []string
+	}{
+		{down: true, wantMetrics: []string{`crontab_spooled_submissions_total{name="test_job",backend="influxdb",result="spooled"} 1`}},
+		{wantMetrics: []string{`crontab_spooled_submissions_total{name="test_job",backend="influxdb",result="replayed"} 1`}},
+	} {
+		down = step.down
+		opts := newTestOptions(mem, testutil.ExitScript(t, 2))
+		opts.Clock = clk
+		opts.Influx = influx.NewWriter(influx.Config{URL: server.URL, Org: "ops", Bucket: "cron"})
+		opts.SpoolDir = dir
+		r, err := NewRunner(opts)
+		if err != nil {
+			t.Fatalf("NewRunner() error = %v", err)
+		}
+		if _, err := r.Run(); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		body := mem.Content()
+		for _, want := range step.wantMetrics {
+			if !strings.Contains(body, want) {
+				t.Errorf("metrics missing %s, got:\n%s", want, body)
+			}
+		}
+		clk.Advance(2 * time.Minute)
+	}
+
+	want := []string{
+		fmt.Sprintf("crontab,name=test_job duration_seconds=0,exit_code=2,failed=1,wall_seconds=0 %d\n", start.UnixNano()),
+		fmt.Sprintf("crontab,name=test_job duration_seconds=0,exit_code=2,failed=1,wall_seconds=0 %d\n", start.Add(2*time.Minute).UnixNano()),
+	}
+	if !slices.Equal(bodies, want) {
+		t.Errorf("written bodies = %q, want %q", bodies, want)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(entries) > 0 {
+		t.Errorf("spool entries left: %v", entries)
+	}
+}
+
+// TestRunnerRunMQTT tests publishing the result of the run to an MQTT broker
+func TestRunnerRunMQTT(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		// Accept the connection once CONNECT is received, then read the PUBLISH and DISCONNECT packets
+		buf := make([]byte, 1024)
+		if _, err := conn.Read(buf); err != nil {
+			received <- nil
+			return
+		}
+		_, _ = conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		content, _ := io.ReadAll(conn)
+		received <- content
+	}()
+
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 2))
+	opts.MQTT, err = mqtt.NewPublisher(mqtt.Config{URL: "tcp://" + listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	opts.MQTTTopic = "cron/{job}/result"
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	content := string(<-received)
+	for _, want := range []string{"cron/test_job/result", `"host":"`, `"name":"test_job"`, `"status":"failed"`, `"exit_code":2`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("published %q, want it to contain %s", content, want)
+		}
+	}
+}
+
+// fakeNotifier records the notifications it is sent, failing to deliver them if err is set
+type fakeNotifier struct {
+	err      error
+	messages []notify.Message
+}
+
+func (n *fakeNotifier) Channel() string { return "fake" }
+
+func (n *fakeNotifier) Notify(_ context.Context, msg notify.Message) error {
+	n.messages = append(n.messages, msg)
+	return n.err
+}
+
+// TestRunnerRunNotify tests that only failed runs are notified
+func TestRunnerRunNotify(t *testing.T) {
+	tests := []struct {
+		name       string
+		exitCode   int
+		wantNotify bool
+	}{
+		{name: "success", exitCode: 0},
+		{name: "failure", exitCode: 3, wantNotify: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &fakeNotifier{}
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, testutil.ExitScript(t, tt.exitCode))
+			opts.Notifiers = []notify.Notifier{notifier}
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			if _, err := r.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if !tt.wantNotify {
+				if len(notifier.messages) != 0 {
+					t.Errorf("got notifications %+v, want none", notifier.messages)
+				}
+				return
+			}
+			if len(notifier.messages) != 1 {
+				t.Fatalf("got %d notifications, want 1", len(notifier.messages))
+			}
+			msg := notifier.messages[0]
+			if msg.Name != "test_job" || msg.Status != "failed" || msg.ErrorType != "job" || msg.ExitCode != tt.exitCode || msg.RunID == "" {
+				t.Errorf("notification = %+v, want failed job test_job with exit code %d", msg, tt.exitCode)
+			}
+		})
+	}
+}
+
+// TestRunnerRunNotifyFallback tests falling back to the next notifier and counting the failed deliveries
+func TestRunnerRunNotifyFallback(t *testing.T) {
+	down := errors.New("down")
+	tests := []struct {
+		name            string
+		errs            []error
+		wantSent        []int
+		wantMetrics     []string
+		wantUndelivered bool
+	}{
+		{
+			name:        "fallback",
+			errs:        []error{down, nil, nil},
+			wantSent:    []int{1, 1, 0},
+			wantMetrics: []string{`crontab_notification_failures_total{name="test_job",channel="fake"} 1`},
+		},
+		{
+			name:     "undelivered",
+			errs:     []error{down, down},
+			wantSent: []int{1, 1},
+			wantMetrics: []string{
+				`crontab_notification_failures_total{name="test_job",channel="fake"} 2`,
+				`crontab_notifications_undelivered_total{name="test_job"} 1`,
+			},
+			wantUndelivered: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fakes []*fakeNotifier
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, testutil.ExitScript(t, 1))
+			for _, err := range tt.errs {
+				fake := &fakeNotifier{err: err}
+				fakes = append(fakes, fake)
+				opts.Notifiers = append(opts.Notifiers, fake)
+			}
+			opts.NotifyFallback = true
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			if _, err := r.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			var sent []int
+			for _, fake := range fakes {
+				sent = append(sent, len(fake.messages))
+			}
+			if !slices.Equal(sent, tt.wantSent) {
+				t.Errorf("sent = %v, want %v", sent, tt.wantSent)
+			}
+			body := mem.Content()
+			for _, want := range tt.wantMetrics {
+				if !strings.Contains(body, want) {
+					t.Errorf("metrics missing %s, got:\n%s", want, body)
+				}
+			}
+			if !tt.wantUndelivered && strings.Contains(body, "notifications_undelivered_total") {
+				t.Errorf("unexpected undelivered notification, got:\n%s", body)
+			}
+		})
+	}
+}
+
+// TestRunnerRunNotifyTemplate tests passing the log tail and run URL to notifications rendered with a template
+func TestRunnerRunNotifyTemplate(t *testing.T) {
+	var lines []string
+	for i := 6; i <= 25; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	wantTail := strings.Join(lines, "\n")
+	tests := []struct {
+		name    string
+		logFile bool
+	}{
+		{name: "captured output"},
+		{name: "log file", logFile: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := notify.ParseTemplate("{{.Name}} {{.Status}}: {{.RunURL}}")
+			if err != nil {
+				t.Fatalf("ParseTemplate() error = %v", err)
+			}
+			notifier := &fakeNotifier{}
+			mem := testutil.NewMemExporter()
+			script := testutil.WriteScript(t, "lines.sh", `for i in $(seq 1 25); do echo "line $i"; done; exit 1`)
+			opts := newTestOptions(mem, script)
+			opts.MaxCapturedOutput = 4096
+			if tt.logFile {
+				opts.LogFile = filepath.Join(t.TempDir(), "job.log")
+			}
+			opts.Notifiers = []notify.Notifier{notifier}
+			opts.NotifyTemplate = tmpl
+			opts.NotifyRunURL = "https://grafana/d/cron?var-job={job}&var-run={run_id}"
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if len(notifier.messages) != 1 {
+				t.Fatalf("got %d notifications, want 1", len(notifier.messages))
+			}
+			msg := notifier.messages[0]
+			if msg.LogTail != wantTail {
+				t.Errorf("LogTail = %q, want %q", msg.LogTail, wantTail)
+			}
+			wantURL := "https://grafana/d/cron?var-job=test_job&var-run=" + result.RunID
+			if msg.RunURL != wantURL {
+				t.Errorf("RunURL = %s, want %s", msg.RunURL, wantURL)
+			}
+			if want := "test_job failed: " + wantURL; msg.Text() != want {
+				t.Errorf("Text() = %q, want %q", msg.Text(), want)
+			}
+		})
+	}
+}
+
+// TestRunnerRunNotifyLimits tests batching failures over the notification limit of the job into its next notification
+func TestRunnerRunNotifyLimits(t *testing.T) {
+	runs := []struct {
+		exitCode    int
+		advance     time.Duration
+		wantNotify  bool
+		wantBatched int
+	}{
+		{exitCode: 1, wantNotify: true},
+		{exitCode: 1, advance: time.Minute},
+		{exitCode: 0, advance: time.Minute},
+		{exitCode: 0, advance: time.Hour, wantNotify: true, wantBatched: 1},
+		{exitCode: 0, advance: time.Minute},
+	}
+
+	stateDir := t.TempDir()
+	clk := testutil.NewFakeClock(time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC))
+	mem := testutil.NewMemExporter()
+	for i, run := range runs {
+		clk.Advance(run.advance)
+		notifier := &fakeNotifier{}
+		opts := newTestOptions(mem, testutil.ExitScript(t, run.exitCode))
+		opts.Clock = clk
+		opts.StateDir = stateDir
+		opts.Notifiers = []notify.Notifier{notifier}
+		opts.NotifyLimit = notify.Limit{Count: 1, Window: time.Hour}
+		r, err := NewRunner(opts)
+		if err != nil {
+			t.Fatalf("NewRunner() error = %v", err)
+		}
+		if _, err := r.Run(); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		if (len(notifier.messages) == 1) != run.wantNotify {
+			t.Fatalf("run %d: got notifications %+v, want notified %v", i, notifier.messages, run.wantNotify)
+		}
+		if run.wantNotify && notifier.messages[0].Batched != run.wantBatched {
+			t.Errorf("run %d: batched = %d, want %d", i, notifier.messages[0].Batched, run.wantBatched)
+		}
+	}
+
+	body := mem.Content()
+	for _, want := range []string{
+		`crontab_notifications_total{name="test_job",result="sent"} 1`,
+		`crontab_notifications_total{name="test_job",result="batched"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s, got:\n%s", want, body)
+		}
+	}
+}
+
+// fakeCheck is a precheck that passes after failing a number of times
+type fakeCheck struct {
+	failures int
+	calls    int
+}
+
+func (c *fakeCheck) Reason() string { return "load" }
+
+func (c *fakeCheck) Ready() (bool, string, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return false, "load average 9.00 exceeds 8.00", nil
+	}
+	return true, "", nil
+}
+
+// TestRunnerRunPrechecks tests that failing prechecks delay or skip the run
+func TestRunnerRunPrechecks(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		wait        time.Duration
+		wantSkipped string
+		wantDelay   time.Duration
+		wantMetric  string
+	}{
+		{
+			name:       "passing check",
+			wait:       time.Minute,
+			wantMetric: `crontab_runs_total{name="test_job",status="success"} 1`,
+		},
+		{
+			name:        "skip without wait",
+			failures:    1,
+			wantSkipped: "load",
+			wantMetric:  `crontab_runs_total{name="test_job",status="skipped_load"} 1`,
+		},
+		{
+			name:       "delay until check passes",
+			failures:   2,
+			wait:       5 * time.Minute,
+			wantDelay:  time.Minute,
+			wantMetric: `crontab_runs_total{name="test_job",status="success"} 1`,
+		},
+		{
+			name:        "skip after wait is exceeded",
+			failures:    100,
+			wait:        45 * time.Second,
+			wantSkipped: "load",
+			wantDelay:   45 * time.Second,
+			wantMetric:  `crontab_runs_total{name="test_job",status="skipped_load"} 1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+			clk := testutil.NewFakeClock(start)
+			mem := testutil.NewMemExporter()
+
+			opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+			opts.Prechecks = []precheck.Check{&fakeCheck{failures: tt.failures}}
+			opts.PrecheckWait = tt.wait
+			opts.Clock = clk
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %q, want %q", result.Skipped, tt.wantSkipped)
+			}
+			if result.Failed() || result.ExitCode() != 0 {
+				t.Errorf("Run should not fail, got Failed() = %v, ExitCode() = %v", result.Failed(), result.ExitCode())
+			}
+			if delay := result.StartTime.Sub(start); delay != tt.wantDelay {
+				t.Errorf("start delayed by %v, want %v", delay, tt.wantDelay)
+			}
+			if !strings.Contains(mem.Content(), tt.wantMetric+"\n") {
+				t.Errorf("Expected metric %q, got:\n%s", tt.wantMetric, mem.Content())
+			}
+			if tt.wantSkipped != "" && strings.Contains(mem.Content(), "crontab_running") {
+				t.Errorf("Skipped run should not be marked as running, got:\n%s", mem.Content())
+			}
+		})
+	}
+}
+
+// exitedPID returns the PID of a process that already exited
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", "exit 0")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run process: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+// TestRunnerRunPreviousRunIncomplete tests that a run left running by a dead process is reported
+func TestRunnerRunPreviousRunIncomplete(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		previous *state.RunState
+		want     string
+	}{
+		{
+			name: "first run",
+			want: "0",
+		},
+		{
+			name:     "previous run finished",
+			previous: &state.RunState{Name: "test_job", PID: exitedPID(t), StartTime: start, FinishTime: start},
+			want:     "0",
+		},
+		{
+			name:     "previous run killed",
+			previous: &state.RunState{Name: "test_job", PID: exitedPID(t), Running: true, StartTime: start},
+			want:     "1",
+		},
+		{
+			name:     "previous run still running",
+			previous: &state.RunState{Name: "test_job", PID: os.Getpid(), Running: true, StartTime: start},
+			want:     "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			stateDir := t.TempDir()
+			store := state.NewStore(afero.NewOsFs(), stateDir)
+			if tt.previous != nil {
+				if err := store.Save(*tt.previous); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			opts := newTestOptions(mem, testutil.ExitScript(t, 4))
+			opts.StateDir = stateDir
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			if _, err := r.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if value, _ := mem.Value(`crontab_previous_run_incomplete{name="test_job"}`); value != tt.want {
+				t.Errorf("previous_run_incomplete = %v, want %v", value, tt.want)
+			}
+			current, found, err := store.Load("test_job")
+			if err != nil || !found {
+				t.Fatalf("Load() = %v, %v, want found", found, err)
+			}
+			if current.Running || current.PID != os.Getpid() || current.ExitCode != 4 {
+				t.Errorf("state after run = %+v, want finished with exit code 4", current)
+			}
+		})
+	}
+}
+
+// TestRunnerRunRegistry tests that each run records its job in the registry
+func TestRunnerRunRegistry(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	path := filepath.Join(t.TempDir(), "registry.json")
+	opts := newTestOptions(mem, testutil.ExitScript(t, 3))
+	opts.RegistryFile = path
+	opts.Schedule = "0 2 * * *"
+	opts.Provenance = map[string]string{"repo": "infra"}
+	for range 2 {
+		r, err := NewRunner(opts)
+		if err != nil {
+			t.Fatalf("NewRunner() error = %v", err)
+		}
+		if _, err := r.Run(); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+
+	jobs, err := registry.New(afero.NewOsFs(), path).List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("List() = %+v, want the job once", jobs)
+	}
+	got := jobs[0]
+	if got.Name != "test_job" || got.Command != job.CommandLine(opts.Command, opts.Args) || got.Schedule != "0 2 * * *" ||
+		got.User == "" || got.Provenance["repo"] != "infra" || got.FirstSeen.IsZero() || got.LastRun.Before(got.FirstSeen) {
+		t.Errorf("registry entry = %+v, want the job", got)
+	}
+}
+
+// TestRunnerRunInventory tests that the registry is pushed to the central inventory once per interval
+func TestRunnerRunInventory(t *testing.T) {
+	var pushes []inventory.Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var payload inventory.Payload
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid inventory: %v", err)
+		}
+		pushes = append(pushes, payload)
+	}))
+	defer server.Close()
+
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+	opts.RegistryFile = filepath.Join(t.TempDir(), "registry.json")
+	opts.Inventory = inventory.NewPusher(inventory.Config{URL: server.URL, Key: secret.Value("key")})
+	for range 2 {
+		r, err := NewRunner(opts)
+		if err != nil {
+			t.Fatalf("NewRunner() error = %v", err)
+		}
+		if _, err := r.Run(); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+	if len(pushes) != 1 || len(pushes[0].Jobs) != 1 || pushes[0].Jobs[0].Name != "test_job" || pushes[0].Host.Hostname == "" {
+		t.Errorf("pushes = %+v, want one push of the job", pushes)
+	}
+}
+
+// TestRunnerRunNameCollision tests that another job using the name with a different command line is reported
+func TestRunnerRunNameCollision(t *testing.T) {
+	tests := []struct {
+		name        string
+		previous    bool   // a previous run is recorded
+		command     string // command line of the previous run
+		sameCommand bool   // the previous run had the command line of the job
+		collisions  []string
+		want        string
+	}{
+		{name: "first run", want: "0"},
+		{name: "same command", previous: true, sameCommand: true, want: "0"},
+		{name: "previous run without command", previous: true, want: "0"},
+		{name: "different command", previous: true, command: "/usr/bin/backup --team b", want: "1"},
+		{name: "running collision", collisions: []string{"pid 42 running /usr/bin/backup"}, want: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			stateDir := t.TempDir()
+			store := state.NewStore(afero.NewOsFs(), stateDir)
+			opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+			opts.StateDir = stateDir
+			opts.Collisions = tt.collisions
+			commandLine := job.CommandLine(opts.Command, opts.Args)
+			if tt.previous {
+				previous := state.RunState{Name: "test_job", PID: exitedPID(t), Command: tt.command}
+				if tt.sameCommand {
+					previous.Command = commandLine
+				}
+				if err := store.Save(previous); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			if _, err := r.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if value, _ := mem.Value(`crontab_name_collision{name="test_job"}`); value != tt.want {
+				t.Errorf("name_collision = %v, want %v", value, tt.want)
+			}
+			current, _, err := store.Load("test_job")
+			if err != nil || current.Command != commandLine {
+				t.Errorf("state command = %q (%v), want %q", current.Command, err, commandLine)
+			}
+		})
+	}
+}
+
+// TestRunnerRunLogFileDenied tests that a denied log file degrades instead of failing the run
+func TestRunnerRunLogFileDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root is not denied by file modes")
+	}
+
+	tests := []struct {
+		name         string
+		withFallback bool
+	}{
+		{name: "discard output"},
+		{name: "fallback directory", withFallback: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deniedDir := filepath.Join(t.TempDir(), "denied")
+			if err := os.Mkdir(deniedDir, 0500); err != nil {
+				t.Fatalf("Failed to create dir: %v", err)
+			}
+			mem := testutil.NewMemExporter()
+			opts := newTestOptions(mem, testutil.OutputScript(t, "out", "", 0))
+			opts.LogFile = filepath.Join(deniedDir, "job.log")
+			fallbackDir := t.TempDir()
+			if tt.withFallback {
+				opts.FallbackDir = fallbackDir
+			}
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Failed() {
+				t.Error("Run should not fail because of a denied log file")
+			}
+			if value, _ := mem.Value(`crontab_degraded{name="test_job",component="log"}`); value != "1" {
+				t.Errorf("degraded = %v, want 1", value)
+			}
+			content, err := os.ReadFile(filepath.Join(fallbackDir, "job.log"))
+			if tt.withFallback && (err != nil || !strings.Contains(string(content), "out")) {
+				t.Errorf("fallback log = %q, %v, want job output", content, err)
+			}
+		})
+	}
+}
+
+// TestRunnerRunQueue tests that each run processes one work item and files it by outcome
+func TestRunnerRunQueue(t *testing.T) {
+	queueDir := t.TempDir()
+	pendingDir := filepath.Join(queueDir, queue.PendingDir)
+	if err := os.MkdirAll(pendingDir, 0755); err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	start := time.Now()
+	for i, item := range []struct{ name, exitCode string }{{"ok.item", "0"}, {"bad.item", "3"}} {
+		path := filepath.Join(pendingDir, item.name)
+		if err := os.WriteFile(path, []byte(item.exitCode), 0644); err != nil {
+			t.Fatalf("Failed to write item: %v", err)
+		}
+		modTime := start.Add(time.Duration(i) * time.Second)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to change times: %v", err)
+		}
+	}
+
+	mem := testutil.NewMemExporter()
+	// The script exits with the code stored in the item passed as last argument
+	opts := newTestOptions(mem, testutil.WriteScript(t, "consume.sh", `exit "$(cat "$1")"`))
+	opts.QueueDir = queueDir
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+
+	tests := []struct {
+		wantFailed  bool
+		wantSkipped string
+		wantFile    string
+	}{
+		{wantFile: filepath.Join(queueDir, queue.DoneDir, "ok.item")},
+		{wantFailed: true, wantFile: filepath.Join(queueDir, queue.FailedDir, "bad.item")},
+		{wantSkipped: "empty_queue"},
+	}
+	for i, tt := range tests {
+		result, err := r.Run()
+		if err != nil {
+			t.Fatalf("run %d: Run() error = %v", i, err)
+		}
+		if result.Failed() != tt.wantFailed || result.Skipped != tt.wantSkipped {
+			t.Errorf("run %d: Failed() = %v, Skipped = %q, want %v, %q", i, result.Failed(), result.Skipped, tt.wantFailed, tt.wantSkipped)
+		}
+		if tt.wantFile != "" {
+			if _, err := os.Stat(tt.wantFile); err != nil {
+				t.Errorf("run %d: %v", i, err)
+			}
+		}
+	}
+
+	for _, metric := range []string{
+		`crontab_queue_items_total{name="test_job",outcome="done"} 1`,
+		`crontab_queue_items_total{name="test_job",outcome="failed"} 1`,
+		`crontab_runs_total{name="test_job",status="skipped_empty_queue"} 1`,
+	} {
+		if !strings.Contains(mem.Content(), metric+"\n") {
+			t.Errorf("Expected metric %q, got:\n%s", metric, mem.Content())
+		}
+	}
+}
+
+// TestRunnerRunHistory tests that finished runs are appended to the history journal
+func TestRunnerRunHistory(t *testing.T) {
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, "sh", "-c", "exit 3")
+	opts.StateDir = t.TempDir()
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	for range 2 {
+		if _, err := r.Run(); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+
+	records, err := history.NewJournal(afero.NewOsFs(), filepath.Join(opts.StateDir, HistoryDir)).Read("test_job", time.Time{})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Read() returned %d records, want 2", len(records))
+	}
+	if got := records[1]; got.Status != "failed" || got.ErrorType != "job" || got.ExitCode != 3 || got.Attempts != 1 {
+		t.Errorf("record = %+v, want failed job run with exit code 3", got)
+	}
+	t.Setenv("TEST_JOB_PASSWORD", "hunter2")
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	records, err = history.NewJournal(afero.NewOsFs(), filepath.Join(opts.StateDir, HistoryDir)).Read("test_job", time.Time{})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	got := records[len(records)-1]
+	if !slices.Equal(got.Args, []string{"sh", "-c", "exit 3"}) || got.Dir == "" || !slices.Contains(got.Env, "TEST_JOB_PASSWORD="+history.Redacted) {
+		t.Errorf("record = %+v, want the command, working directory and redacted environment", got)
+	}
+}
+
+// TestRunnerRunHistoryCompaction tests that runs older than the retention are compacted after a run
+func TestRunnerRunHistoryCompaction(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	clk := testutil.NewFakeClock(start)
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+	opts.StateDir = t.TempDir()
+	opts.HistoryRetention = history.Retention{Runs: 24 * time.Hour}
+	opts.Clock = clk
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+
+	for range 2 {
+		if _, err := r.Run(); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		clk.Advance(3 * 24 * time.Hour)
+	}
+
+	journal := history.NewJournal(afero.NewOsFs(), filepath.Join(opts.StateDir, HistoryDir))
+	records, err := journal.Read("test_job", time.Time{})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	daily, err := journal.ReadDaily("test_job")
+	if err != nil {
+		t.Fatalf("ReadDaily() error = %v", err)
+	}
+	if len(records) != 1 || len(daily) != 1 || daily[0].Day != "2024-01-01" {
+		t.Errorf("got %d runs and daily aggregates %+v, want 1 run and the aggregate of 2024-01-01", len(records), daily)
+	}
+}
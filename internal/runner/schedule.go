@@ -0,0 +1,14 @@
+package runner
+
+// offSchedule reports whether the run falls outside the dates of the ScheduleDates calendar and must be skipped
+func (r *Runner) offSchedule() bool {
+	if r.opts.ScheduleDates == nil {
+		return false
+	}
+	now := r.clock.Now().Local()
+	if scheduled, _ := r.opts.ScheduleDates.Contains(now); scheduled {
+		return false
+	}
+	r.logf("Skipping job %s: %s is not a scheduled date", r.opts.Name, now.Format("2006-01-02"))
+	return true
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/calendar"
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// loadCalendar loads a calendar from a file named name holding content
+func loadCalendar(t *testing.T, name, content string) *calendar.Calendar {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := calendar.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// TestRunnerRunCalendars tests that only the runs on the dates of the schedule calendar execute the command,
+// unless they fall on a date of the exclusion calendar
+func TestRunnerRunCalendars(t *testing.T) {
+	schedule := loadCalendar(t, "schedule.ics", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:Month end close\n"+
+		"DTSTART;VALUE=DATE:20250101\nRRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1\nEND:VEVENT\nEND:VCALENDAR\n")
+	holidays := loadCalendar(t, "holidays.txt", "2025-12-25 Christmas Day\n2025-12-31 New Year's Eve\n")
+
+	tests := []struct {
+		name        string
+		schedule    *calendar.Calendar
+		holidays    *calendar.Calendar
+		now         time.Time
+		wantSkipped string
+	}{
+		{name: "last business day", schedule: schedule, now: time.Date(2025, 5, 30, 18, 0, 0, 0, time.Local)},
+		{name: "other day", schedule: schedule, now: time.Date(2025, 5, 31, 18, 0, 0, 0, time.Local), wantSkipped: "not_scheduled"},
+		{name: "business day", holidays: holidays, now: time.Date(2025, 12, 24, 9, 0, 0, 0, time.Local)},
+		{name: "holiday", holidays: holidays, now: time.Date(2025, 12, 25, 9, 0, 0, 0, time.Local), wantSkipped: "holiday"},
+		{name: "scheduled on a holiday", schedule: schedule, holidays: holidays,
+			now: time.Date(2025, 12, 31, 18, 0, 0, 0, time.Local), wantSkipped: "holiday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			marker := filepath.Join(t.TempDir(), "ran")
+			opts := newTestOptions(mem, "touch", marker)
+			opts.ScheduleDates = tt.schedule
+			opts.Holidays = tt.holidays
+			opts.Clock = testutil.NewFakeClock(tt.now)
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			result, err := r.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %q, want %q", result.Skipped, tt.wantSkipped)
+			}
+			if _, err := os.Stat(marker); (err == nil) != (tt.wantSkipped == "") {
+				t.Errorf("command ran = %v, want %v", err == nil, tt.wantSkipped == "")
+			}
+			series := `crontab_runs_total{name="test_job",status="success"}`
+			if tt.wantSkipped != "" {
+				series = `crontab_runs_total{name="test_job",status="skipped_` + tt.wantSkipped + `"}`
+			}
+			if value, _ := mem.Value(series); value != "1" {
+				t.Errorf("%s = %q, want 1", series, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package runner
+
+import (
+	"slices"
+
+	"github.com/alswl/cron-manager/internal/notify"
+)
+
+// severity returns the severity of result assigned by Severities, empty if it did not fail or without them.
+// Runs failing without an exit code of the job, e.g. timeouts or crashes, get the default severity.
+func (r *Runner) severity(result Result) string {
+	if r.opts.Severities == nil {
+		return ""
+	}
+	code := -1
+	switch status, errorType := result.outcome(); {
+	case status != "failed":
+		return ""
+	case errorType == "job":
+		code = result.ExitStatus.Code
+	}
+	return r.opts.Severities.Of(code)
+}
+
+// notifiers returns the notifiers of a failure of severity: those whose channel the severity is routed to,
+// or all of them if it is not routed
+func (r *Runner) notifiers(severity string) []notify.Notifier {
+	if r.opts.Severities == nil || severity == "" {
+		return r.opts.Notifiers
+	}
+	channels, ok := r.opts.Severities.Channels(severity)
+	if !ok {
+		return r.opts.Notifiers
+	}
+	var routed []notify.Notifier
+	for _, n := range r.opts.Notifiers {
+		if slices.Contains(channels, n.Channel()) {
+			routed = append(routed, n)
+		}
+	}
+	return routed
+}
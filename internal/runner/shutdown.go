@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// trapShutdown starts catching the ShutdownSignals of cronmgr. It returns the channel receiving them, nil
+// without ShutdownSignals, and a function restoring their default handling.
+func (r *Runner) trapShutdown() (<-chan os.Signal, func()) {
+	if len(r.opts.ShutdownSignals) == 0 {
+		return nil, func() {}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, r.opts.ShutdownSignals...)
+	return signals, func() { signal.Stop(signals) }
+}
+
+// stopOnShutdown stops cmd if a shutdown signal is received from signals before it exited, and records it
+// so that the run is not retried. The returned channel is closed once the watch ended.
+func (r *Runner) stopOnShutdown(cmd *exec.Cmd, signals <-chan os.Signal, exited <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	if signals == nil {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		select {
+		case <-exited:
+		case sig := <-signals:
+			r.shutdown = sig
+			r.stop(cmd, fmt.Sprintf("cronmgr received %v", sig), exited)
+		}
+	}()
+	return done
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// TestRunnerRunShutdown tests that a shutdown signal of cronmgr stops the command in its own process group
+// with the stop signal, and that the run is not retried
+func TestRunnerRunShutdown(t *testing.T) {
+	tests := []struct {
+		name       string
+		stopSignal os.Signal
+		wantCode   int
+		wantSignal string
+	}{
+		{name: "stop signal", stopSignal: syscall.SIGINT, wantCode: 3},
+		{name: "kill", wantCode: -1, wantSignal: "killed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := testutil.NewMemExporter()
+			started := filepath.Join(t.TempDir(), "started")
+			script := testutil.WriteScript(t, "worker.sh", "trap 'kill $!; exit 3' INT\nsleep 30 &\ntouch \"$1\"\nwait")
+			opts := newTestOptions(mem, script, started)
+			opts.Retries = 2
+			// The command runs in its own process group, it would not get the signals of cronmgr otherwise
+			opts.AttemptTimeout = time.Minute
+			opts.StopSignal = tt.stopSignal
+			opts.StopGrace = 10 * time.Second
+			opts.ShutdownSignals = []os.Signal{syscall.SIGHUP}
+			r, err := NewRunner(opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+
+			done := make(chan Result)
+			go func() {
+				result, err := r.Run()
+				if err != nil {
+					t.Errorf("Run() error = %v", err)
+				}
+				done <- result
+			}()
+			for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				if _, err := os.Stat(started); err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("command not started")
+				}
+			}
+			self, _ := os.FindProcess(os.Getpid())
+			if err := self.Signal(syscall.SIGHUP); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case result := <-done:
+				if result.Attempts != 1 || result.ExitStatus.Code != tt.wantCode || result.ExitStatus.Signal != tt.wantSignal {
+					t.Errorf("Attempts = %d, ExitStatus = %+v, want 1, code %d, signal %q",
+						result.Attempts, result.ExitStatus, tt.wantCode, tt.wantSignal)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("command not stopped on shutdown")
+			}
+		})
+	}
+}
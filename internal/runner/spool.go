@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Backends of the spooled submissions, also used as metric label
+const (
+	spoolPushgateway = "pushgateway"
+	spoolCloudWatch  = "cloudwatch"
+	spoolInflux      = "influxdb"
+)
+
+// submit sends payload, encoded as JSON, to the backend with send. With a spool, the submissions earlier
+// runs failed to send to the same target are replayed first, and payload is spooled if it fails too.
+// key identifies the spooled submissions payload supersedes, empty for none. The error of sending
+// payload is returned.
+func (r *Runner) submit(backend, target, key string, payload any, send func(payload []byte) error) error {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if r.spool == nil {
+		return send(content)
+	}
+
+	now := r.clock.Now()
+	if err := r.spool.Discard(backend, target, key); err != nil {
+		log.Printf("Failed to discard the spooled submissions to %s: %v", backend, err)
+	}
+	replay, err := r.spool.Replay(backend, target, now, send)
+	if err != nil {
+		log.Printf("Failed to replay the spooled submissions to %s: %v", backend, err)
+	}
+	if replay.Failure != nil {
+		log.Printf("Failed to replay the spooled submissions to %s, %d left: %v", backend, replay.Pending, replay.Failure)
+	}
+	if replay.Replayed > 0 {
+		r.logf("Replayed %d spooled submissions to %s", replay.Replayed, backend)
+	}
+	if replay.Expired > 0 {
+		log.Printf("Dropped %d spooled submissions to %s older than %s", replay.Expired, backend, r.opts.SpoolMaxAge)
+	}
+	r.countSpooled(backend, "replayed", replay.Replayed)
+	r.countSpooled(backend, "expired", replay.Expired)
+	r.countSpooled(backend, "rejected", replay.Rejected)
+
+	sendErr := send(content)
+	if sendErr == nil {
+		return nil
+	}
+	if err := r.spool.Add(backend, target, key, content, now); err != nil {
+		log.Printf("Failed to spool the submission to %s: %v", backend, err)
+	} else {
+		r.countSpooled(backend, "spooled", 1)
+	}
+	return sendErr
+}
+
+// countSpooled counts n spooled submissions to backend by result: spooled, replayed or expired
+func (r *Runner) countSpooled(backend, result string, n int) {
+	for range n {
+		r.exp.IncrementCounter("spooled_submissions_total", r.opts.Name, map[string]string{"backend": backend, "result": result}, helpSpooled)
+	}
+}
@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Summary returns a one-line logfmt summary of the run of the job name, e.g. for cron to mail it:
+//
+//	cronmgr: job=backup status=failed error_type=job exit_code=2 duration=1m3.2s run_id=20240101T020000Z-42 log=/var/log/backup.log
+func (r Result) Summary(name string) string {
+	status, errorType := r.outcome()
+	var b strings.Builder
+	b.WriteString("cronmgr:")
+	field := func(key, value string) {
+		b.WriteString(" " + key + "=" + logfmtValue(value))
+	}
+	field("job", name)
+	field("status", status)
+	if errorType != "" {
+		field("error_type", errorType)
+	}
+	if r.Severity != "" {
+		field("severity", r.Severity)
+	}
+	if r.ExecError != "" {
+		field("exec_error", string(r.ExecError))
+	}
+	field("exit_code", strconv.Itoa(r.jobExitCode()))
+	if r.ExitStatus.Signaled() {
+		field("signal", r.ExitStatus.Signal)
+	}
+	if r.CoreFile != "" {
+		field("core", r.CoreFile)
+	}
+	if r.TimedOut != "" {
+		field("timeout", r.TimedOut)
+	}
+	if r.ReadOnlyChangeCount > 0 {
+		field("readonly_changes", strconv.Itoa(r.ReadOnlyChangeCount))
+		if len(r.ReadOnlyChanges) > 0 {
+			field("readonly_change", r.ReadOnlyChanges[0].String())
+		}
+	}
+	if r.StaleInput != "" {
+		field("stale_input", r.StaleInput)
+	}
+	if len(r.Snapshots) > 0 {
+		field("snapshots", strings.Join(r.Snapshots, ","))
+	}
+	if r.Attempts > 1 {
+		field("attempts", strconv.Itoa(r.Attempts))
+	}
+	field("duration", r.WallDuration.Round(time.Millisecond).String())
+	if r.RunID != "" {
+		field("run_id", r.RunID)
+	}
+	if r.LogFile != "" {
+		field("log", r.LogFile)
+	}
+	if r.ErrorLogFile != "" {
+		field("error_log", r.ErrorLogFile)
+	}
+	if len(r.Provenance) > 0 {
+		pairs := make([]string, 0, len(r.Provenance))
+		for _, key := range slices.Sorted(maps.Keys(r.Provenance)) {
+			pairs = append(pairs, key+"="+r.Provenance[key])
+		}
+		field("provenance", strings.Join(pairs, ","))
+	}
+	return b.String()
+}
+
+// logfmtValue quotes value if it is empty or contains spaces, quotes or equal signs
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
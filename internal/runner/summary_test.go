@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/job"
+)
+
+// TestResultSummary tests the one-line summary of runs
+func TestResultSummary(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{
+			name: "failed",
+			result: Result{RunID: "20240101T020000Z-42", LogFile: "/var/log/backup.log", ExitStatus: job.ExitStatus{Code: 2},
+				Attempts: 1, WallDuration: 63200 * time.Millisecond},
+			want: "cronmgr: job=backup status=failed error_type=job exit_code=2 duration=1m3.2s run_id=20240101T020000Z-42 log=/var/log/backup.log",
+		},
+		{
+			name:   "timed out after retries",
+			result: Result{ExitStatus: job.ExitStatus{Code: -1, Signal: "killed"}, TimedOut: "deadline", Attempts: 3, WallDuration: time.Minute},
+			want:   "cronmgr: job=backup status=failed error_type=timeout exit_code=-1 signal=killed timeout=deadline attempts=3 duration=1m0s",
+		},
+		{
+			name:   "exec error",
+			result: Result{ExecError: job.ExecErrorNotFound, Attempts: 1},
+			want:   "cronmgr: job=backup status=failed error_type=exec exec_error=not_found exit_code=127 duration=0s",
+		},
+		{
+			name:   "quoted log path",
+			result: Result{LogFile: "/var/log/my backup.log", ErrorLogFile: "/var/log/backup.err"},
+			want:   `cronmgr: job=backup status=success exit_code=0 duration=0s log="/var/log/my backup.log" error_log=/var/log/backup.err`,
+		},
+		{
+			name:   "kept snapshots",
+			result: Result{ExitStatus: job.ExitStatus{Code: 1}, Snapshots: []string{"tank/data@cronmgr-backup-20240101T020000Z-42"}},
+			want:   `cronmgr: job=backup status=failed error_type=job exit_code=1 snapshots=tank/data@cronmgr-backup-20240101T020000Z-42 duration=0s`,
+		},
+		{
+			name:   "stale input",
+			result: Result{StaleInput: "/data/export.csv does not exist"},
+			want:   `cronmgr: job=backup status=failed error_type=stale_input exit_code=0 stale_input="/data/export.csv does not exist" duration=0s`,
+		},
+		{
+			name:   "provenance",
+			result: Result{ExitStatus: job.ExitStatus{Code: 1}, Provenance: map[string]string{"repo": "infra", "commit": "abc123"}},
+			want:   `cronmgr: job=backup status=failed error_type=job exit_code=1 duration=0s provenance="commit=abc123,repo=infra"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.Summary("backup"); got != tt.want {
+				t.Errorf("Summary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MaxTimePrecision is the largest number of decimals of the time gauges, down to the nanosecond
+const MaxTimePrecision = 9
+
+// formatSeconds formats a duration gauge in seconds, with TimePrecision decimals or 2 in the legacy format
+func (r *Runner) formatSeconds(d time.Duration) string {
+	precision := r.opts.TimePrecision
+	if precision == 0 {
+		precision = 2
+	}
+	return strconv.FormatFloat(d.Seconds(), 'f', precision, 64)
+}
+
+// formatTimestamp formats a timestamp gauge in Unix seconds, with TimePrecision decimals or whole seconds in
+// the legacy format. The decimals are cut from the nanoseconds rather than a float64, which cannot hold a
+// current timestamp to the nanosecond.
+func (r *Runner) formatTimestamp(t time.Time) string {
+	precision := r.opts.TimePrecision
+	if precision == 0 {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	fraction := t.Nanosecond()
+	for range MaxTimePrecision - precision {
+		fraction /= 10
+	}
+	return fmt.Sprintf("%d.%0*d", t.Unix(), precision, fraction)
+}
@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/testutil"
+)
+
+// TestFormatTime tests formatting durations and timestamps with each precision
+func TestFormatTime(t *testing.T) {
+	at := time.Date(2024, 1, 1, 2, 0, 0, 123456789, time.UTC)
+	tests := []struct {
+		name          string
+		precision     int
+		wantDuration  string
+		wantTimestamp string
+	}{
+		{name: "legacy", precision: 0, wantDuration: "1.50", wantTimestamp: "1704074400"},
+		{name: "milliseconds", precision: 3, wantDuration: "1.500", wantTimestamp: "1704074400.123"},
+		{name: "tenths", precision: 1, wantDuration: "1.5", wantTimestamp: "1704074400.1"},
+		{name: "nanoseconds", precision: 9, wantDuration: "1.500000000", wantTimestamp: "1704074400.123456789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{opts: RunnerOptions{TimePrecision: tt.precision}}
+			if got := r.formatSeconds(1500 * time.Millisecond); got != tt.wantDuration {
+				t.Errorf("formatSeconds() = %q, want %q", got, tt.wantDuration)
+			}
+			if got := r.formatTimestamp(at); got != tt.wantTimestamp {
+				t.Errorf("formatTimestamp() = %q, want %q", got, tt.wantTimestamp)
+			}
+		})
+	}
+}
+
+// TestRunnerRunTimePrecision tests that the time gauges of a run are written with the configured precision
+func TestRunnerRunTimePrecision(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 250000000, time.UTC)
+	mem := testutil.NewMemExporter()
+	opts := newTestOptions(mem, testutil.ExitScript(t, 0))
+	opts.IdleSeconds = 60
+	opts.Clock = testutil.NewFakeClock(start)
+	opts.TimePrecision = 3
+	r, err := NewRunner(opts)
+	if err != nil {
+		t.Fatalf("NewRunner() error = %v", err)
+	}
+	if _, err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	for series, want := range map[string]string{
+		`crontab_duration_seconds{name="test_job"}`:           "0.000",
+		`crontab_wall_seconds{name="test_job"}`:               "60.000",
+		`crontab_last_run_timestamp_seconds{name="test_job"}`: "1704074460.250",
+	} {
+		if value, _ := mem.Value(series); value != want {
+			t.Errorf("%s = %q, want %q", series, value, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+)
+
+// touchFile sets the modification time of the touch file to the finish time of a successful run,
+// creating it if needed, and exports its modification time so that it survives failed runs
+func (r *Runner) touchFile(result Result) {
+	path := r.opts.TouchFile
+	if path == "" {
+		return
+	}
+	if !result.Failed() {
+		now := r.clock.Now()
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+		if err == nil {
+			err = errors.Join(file.Close(), os.Chtimes(path, now, now))
+		}
+		if err != nil {
+			log.Printf("Failed to touch %s: %v", path, err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to read the modification time of %s: %v", path, err)
+		}
+		return
+	}
+	r.exp.WriteGauge("touch_file_timestamp_seconds", r.opts.Name, r.formatTimestamp(info.ModTime()), helpTouchFile)
+}
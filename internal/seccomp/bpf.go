@@ -0,0 +1,234 @@
+package seccomp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Instruction is a classic BPF instruction, laid out as struct sock_filter
+type Instruction struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+// Classic BPF opcodes used by the filters
+const (
+	bpfLoadAbs = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfAnd     = 0x54 // BPF_ALU | BPF_AND | BPF_K
+	bpfJeq     = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgt     = 0x25 // BPF_JMP | BPF_JGT | BPF_K
+	bpfJge     = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRet     = 0x06 // BPF_RET | BPF_K
+)
+
+// Offsets of the fields of struct seccomp_data, the arguments are little-endian on all supported architectures
+const (
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+)
+
+// maxInstructions is the longest filter accepted by the kernel (BPF_MAXINSNS)
+const maxInstructions = 4096
+
+// maxJumps bounds the syscalls matched by a chain of jumps to one return, as conditional jumps are 8 bits
+const maxJumps = 200
+
+// x32SyscallBit marks the syscalls of the x32 ABI on amd64
+const x32SyscallBit = 0x40000000
+
+// auditArches are the AUDIT_ARCH_* values of seccomp_data.arch for the supported Go architectures
+var auditArches = map[string]uint32{
+	"amd64": 0xc000003e,
+	"arm64": 0xc00000b7,
+	"arm":   0x40000028,
+}
+
+// ErrUnsupportedArch is returned when compiling a profile for an architecture without syscall table
+var ErrUnsupportedArch = errors.New("seccomp filters are only supported on linux/amd64, linux/arm64 and linux/arm")
+
+// Compile compiles the profile into a BPF filter for host. Calls from another architecture kill the process,
+// and each syscall gets the action of the first rule matching it, or else the default action. Syscall
+// names unknown to the architecture are ignored, as the profiles of Docker list those of every architecture.
+func (p *Profile) Compile(host Host) ([]Instruction, error) {
+	audit, ok := auditArches[host.Arch]
+	if !ok || len(syscalls) == 0 {
+		return nil, ErrUnsupportedArch
+	}
+	return p.compile(host, audit, syscalls)
+}
+
+// compile compiles the profile for the architecture of audit with the syscall numbers of table
+func (p *Profile) compile(host Host, audit uint32, table map[string]uint32) ([]Instruction, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	defaultAction, _ := action(p.DefaultAction, p.DefaultErrnoRet, nil)
+
+	var prog program
+	prog.stmt(bpfLoadAbs, offsetArch)
+	prog.jump(bpfJeq, audit, 1, 0)
+	prog.stmt(bpfRet, retKillProcess)
+	prog.stmt(bpfLoadAbs, offsetNr)
+	if host.Arch == "amd64" {
+		prog.jump(bpfJge, x32SyscallBit, 0, 1)
+		prog.stmt(bpfRet, defaultAction)
+	}
+
+	for _, rule := range p.Syscalls {
+		if !rule.applies(host) {
+			continue
+		}
+		ret, _ := action(rule.Action, rule.ErrnoRet, p.DefaultErrnoRet)
+		var numbers []uint32
+		for _, name := range rule.Names {
+			if nr, ok := table[name]; ok {
+				numbers = append(numbers, nr)
+			}
+		}
+		if len(rule.Args) == 0 {
+			for len(numbers) > 0 {
+				chunk := numbers[:min(len(numbers), maxJumps)]
+				numbers = numbers[len(chunk):]
+				prog.stmt(bpfLoadAbs, offsetNr)
+				for i, nr := range chunk {
+					// Matches jump to the return after the chain, the last mismatch jumps over it
+					prog.jump(bpfJeq, nr, len(chunk)-1-i, 0)
+				}
+				prog.insns[len(prog.insns)-1].Jf = 1
+				prog.stmt(bpfRet, ret)
+			}
+			continue
+		}
+		for _, nr := range numbers {
+			prog.conditional(nr, rule.Args, ret)
+		}
+	}
+	prog.stmt(bpfRet, defaultAction)
+	if prog.err != nil {
+		return nil, prog.err
+	}
+	if len(prog.insns) > maxInstructions {
+		return nil, fmt.Errorf("seccomp filter of %d instructions exceeds the limit of %d", len(prog.insns), maxInstructions)
+	}
+	return prog.insns, nil
+}
+
+// program builds a BPF program. Jumps target labels that are resolved when they are placed.
+type program struct {
+	insns []Instruction
+	// pending are the instructions jumping to the label placed next, with whether it is their true branch
+	pending []pendingJump
+	err     error
+}
+
+// pendingJump is the branch of an instruction jumping to the next label
+type pendingJump struct {
+	at       int
+	trueJump bool
+}
+
+// stmt appends an instruction without jump
+func (p *program) stmt(code uint16, k uint32) {
+	p.insns = append(p.insns, Instruction{Code: code, K: k})
+}
+
+// jump appends a conditional jump skipping jt instructions when true and jf when false
+func (p *program) jump(code uint16, k uint32, jt, jf int) {
+	if jt > 255 || jf > 255 {
+		p.err = errors.New("seccomp filter jump out of range")
+	}
+	p.insns = append(p.insns, Instruction{Code: code, Jt: uint8(jt), Jf: uint8(jf), K: k})
+}
+
+// jumpToLabel appends a conditional jump to the next label placed, when true if trueJump and else when false.
+// The other branch continues with the next instruction.
+func (p *program) jumpToLabel(code uint16, k uint32, trueJump bool) {
+	p.pending = append(p.pending, pendingJump{at: len(p.insns), trueJump: trueJump})
+	p.insns = append(p.insns, Instruction{Code: code, K: k})
+}
+
+// label places the target of the pending jumps at the next instruction
+func (p *program) label() {
+	for _, j := range p.pending {
+		offset := len(p.insns) - j.at - 1
+		if offset > 255 {
+			p.err = errors.New("seccomp filter jump out of range")
+		}
+		if j.trueJump {
+			p.insns[j.at].Jt = uint8(offset)
+		} else {
+			p.insns[j.at].Jf = uint8(offset)
+		}
+	}
+	p.pending = nil
+}
+
+// conditional appends the rule returning ret for the syscall nr when all args match
+func (p *program) conditional(nr uint32, args []Arg, ret uint32) {
+	p.stmt(bpfLoadAbs, offsetNr)
+	p.jumpToLabel(bpfJeq, nr, false)
+	var matched []pendingJump
+	for _, arg := range args {
+		// Comparisons of the high words decide unless they are equal, which jumps to the comparison of the low words
+		lo, hi := uint32(offsetArgs+8*arg.Index), uint32(offsetArgs+8*arg.Index+4)
+		value, valueLo, valueHi := arg.Value, uint32(arg.Value), uint32(arg.Value>>32)
+		switch arg.Op {
+		case OpEqual:
+			p.stmt(bpfLoadAbs, hi)
+			p.jumpToLabel(bpfJeq, valueHi, false)
+			p.stmt(bpfLoadAbs, lo)
+			p.jumpToLabel(bpfJeq, valueLo, false)
+		case OpNotEqual:
+			p.stmt(bpfLoadAbs, hi)
+			matched = append(matched, pendingJump{at: len(p.insns), trueJump: false})
+			p.insns = append(p.insns, Instruction{Code: bpfJeq, K: valueHi})
+			p.stmt(bpfLoadAbs, lo)
+			p.jumpToLabel(bpfJeq, valueLo, true)
+		case OpMaskedEqual:
+			maskLo, maskHi := uint32(value), uint32(value>>32)
+			p.stmt(bpfLoadAbs, hi)
+			p.stmt(bpfAnd, maskHi)
+			p.jumpToLabel(bpfJeq, uint32(arg.ValueTwo>>32), false)
+			p.stmt(bpfLoadAbs, lo)
+			p.stmt(bpfAnd, maskLo)
+			p.jumpToLabel(bpfJeq, uint32(arg.ValueTwo), false)
+		case OpGreater, OpGreaterEqual:
+			p.stmt(bpfLoadAbs, hi)
+			matched = append(matched, pendingJump{at: len(p.insns), trueJump: true})
+			p.insns = append(p.insns, Instruction{Code: bpfJgt, K: valueHi})
+			p.jumpToLabel(bpfJeq, valueHi, false)
+			p.stmt(bpfLoadAbs, lo)
+			if arg.Op == OpGreater {
+				p.jumpToLabel(bpfJgt, valueLo, false)
+			} else {
+				p.jumpToLabel(bpfJge, valueLo, false)
+			}
+		case OpLess, OpLessEqual:
+			p.stmt(bpfLoadAbs, hi)
+			matched = append(matched, pendingJump{at: len(p.insns), trueJump: false})
+			p.insns = append(p.insns, Instruction{Code: bpfJge, K: valueHi})
+			p.jumpToLabel(bpfJeq, valueHi, false)
+			p.stmt(bpfLoadAbs, lo)
+			if arg.Op == OpLess {
+				p.jumpToLabel(bpfJge, valueLo, true)
+			} else {
+				p.jumpToLabel(bpfJgt, valueLo, true)
+			}
+		}
+		// Decided comparisons of the high words continue with the next argument
+		for _, j := range matched {
+			offset := len(p.insns) - j.at - 1
+			if j.trueJump {
+				p.insns[j.at].Jt = uint8(offset)
+			} else {
+				p.insns[j.at].Jf = uint8(offset)
+			}
+		}
+		matched = nil
+	}
+	p.stmt(bpfRet, ret)
+	p.label()
+}
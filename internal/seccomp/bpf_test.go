@@ -0,0 +1,132 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// run interprets the BPF filter on the seccomp_data of a call and returns the action
+func run(t *testing.T, filter []Instruction, arch, nr uint32, args ...uint64) uint32 {
+	t.Helper()
+	data := make([]byte, offsetArgs+6*8)
+	binary.LittleEndian.PutUint32(data[offsetNr:], nr)
+	binary.LittleEndian.PutUint32(data[offsetArch:], arch)
+	for i, arg := range args {
+		binary.LittleEndian.PutUint64(data[offsetArgs+8*i:], arg)
+	}
+	var a uint32
+	for pc := 0; pc < len(filter); pc++ {
+		insn := filter[pc]
+		switch insn.Code {
+		case bpfLoadAbs:
+			a = binary.LittleEndian.Uint32(data[insn.K:])
+		case bpfAnd:
+			a &= insn.K
+		case bpfRet:
+			return insn.K
+		case bpfJeq, bpfJgt, bpfJge:
+			taken := (insn.Code == bpfJeq && a == insn.K) || (insn.Code == bpfJgt && a > insn.K) || (insn.Code == bpfJge && a >= insn.K)
+			if taken {
+				pc += int(insn.Jt)
+			} else {
+				pc += int(insn.Jf)
+			}
+		default:
+			t.Fatalf("unknown instruction %#x at %d", insn.Code, pc)
+		}
+	}
+	t.Fatal("filter ended without return")
+	return 0
+}
+
+// TestCompile tests the actions the compiled filter returns for syscalls and their arguments
+func TestCompile(t *testing.T) {
+	table := map[string]uint32{"read": 0, "write": 1, "personality": 135, "clone": 56, "mmap": 9, "ptrace": 101, "kexec_load": 246}
+	errnoRet := uint(38)
+	profile := &Profile{
+		DefaultAction: ActErrno,
+		Syscalls: []Syscall{
+			{Names: []string{"read", "write", "not_on_this_arch"}, Action: ActAllow},
+			{Names: []string{"personality"}, Action: ActAllow, Args: []Arg{{Index: 0, Value: 0xffffffff, Op: OpEqual}}},
+			{Names: []string{"clone"}, Action: ActAllow, Args: []Arg{{Index: 0, Value: 0x7e020000, ValueTwo: 0, Op: OpMaskedEqual}}},
+			{Names: []string{"mmap"}, Action: ActAllow, Args: []Arg{{Index: 1, Value: 1 << 32, Op: OpLessEqual}, {Index: 2, Value: 4, Op: OpNotEqual}}},
+			{Names: []string{"ptrace"}, Action: ActAllow, Includes: Filter{MinKernel: "4.8"}},
+			{Names: []string{"kexec_load"}, Action: ActErrno, ErrnoRet: &errnoRet, Excludes: Filter{Caps: []string{"CAP_SYS_BOOT"}}},
+		},
+	}
+	const audit = 0xc000003e
+	filter, err := profile.compile(Host{Arch: "amd64", Kernel: "4.4.0-210-generic"}, audit, table)
+	if err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+
+	eperm := uint32(retErrno | 1)
+	tests := []struct {
+		name string
+		arch uint32
+		nr   uint32
+		args []uint64
+		want uint32
+	}{
+		{name: "allowed", nr: 1, want: retAllow},
+		{name: "default", nr: 2, want: eperm},
+		{name: "other architecture", arch: 0x40000003, nr: 1, want: retKillProcess},
+		{name: "x32", nr: x32SyscallBit | 1, want: eperm},
+		{name: "equal", nr: 135, args: []uint64{0xffffffff}, want: retAllow},
+		{name: "not equal", nr: 135, args: []uint64{0x1_ffffffff}, want: eperm},
+		{name: "masked equal", nr: 56, args: []uint64{0x11}, want: retAllow},
+		{name: "masked not equal", nr: 56, args: []uint64{0x10000000}, want: eperm},
+		{name: "less equal and not equal", nr: 9, args: []uint64{0, 1 << 32, 3}, want: retAllow},
+		{name: "greater", nr: 9, args: []uint64{0, 1<<32 + 1, 3}, want: eperm},
+		{name: "second argument equal", nr: 9, args: []uint64{0, 4096, 4}, want: eperm},
+		{name: "kernel too old", nr: 101, want: eperm},
+		{name: "errnoRet without capability", nr: 246, want: retErrno | 38},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arch := tt.arch
+			if arch == 0 {
+				arch = audit
+			}
+			if got := run(t, filter, arch, tt.nr, tt.args...); got != tt.want {
+				t.Errorf("filter returned %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+
+	// Privileged hosts on recent kernels get the rules of capabilities and kernels
+	filter, err = profile.compile(Host{Arch: "amd64", Privileged: true, Kernel: "6.8.0"}, audit, table)
+	if err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+	if got := run(t, filter, audit, 101); got != retAllow {
+		t.Errorf("ptrace on a recent kernel returned %#x, want allow", got)
+	}
+	if got := run(t, filter, audit, 246); got != eperm {
+		t.Errorf("kexec_load with capabilities returned %#x, want the default action", got)
+	}
+}
+
+// TestCompileLarge tests a rule with more syscalls than a chain of jumps can reach
+func TestCompileLarge(t *testing.T) {
+	table := make(map[string]uint32)
+	var names []string
+	for nr := range uint32(450) {
+		name := "syscall_" + string(rune('a'+nr%26)) + string(rune('a'+nr/26))
+		table[name] = nr
+		names = append(names, name)
+	}
+	profile := &Profile{DefaultAction: ActKillProcess, Syscalls: []Syscall{{Names: names, Action: ActAllow}}}
+	filter, err := profile.compile(Host{Arch: "arm64"}, 0xc00000b7, table)
+	if err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+	for _, nr := range []uint32{0, 199, 200, 449} {
+		if got := run(t, filter, 0xc00000b7, nr); got != retAllow {
+			t.Errorf("syscall %d returned %#x, want allow", nr, got)
+		}
+	}
+	if got := run(t, filter, 0xc00000b7, 450); got != retKillProcess {
+		t.Errorf("syscall 450 returned %#x, want kill", got)
+	}
+}
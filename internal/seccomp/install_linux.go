@@ -0,0 +1,33 @@
+//go:build linux
+
+package seccomp
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+)
+
+// sockFprog is struct sock_fprog, the filter passed to the kernel
+type sockFprog struct {
+	len    uint16
+	filter *Instruction
+}
+
+// Install applies the filter to the calling thread and the processes it executes. The thread must be
+// locked with runtime.LockOSThread and have no_new_privs set, unless it has CAP_SYS_ADMIN.
+func Install(filter []Instruction) error {
+	if len(filter) == 0 {
+		return errors.New("empty seccomp filter")
+	}
+	prog := sockFprog{len: uint16(len(filter)), filter: &filter[0]}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return errno
+	}
+	return nil
+}
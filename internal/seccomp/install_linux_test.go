@@ -0,0 +1,42 @@
+//go:build linux
+
+package seccomp
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// TestInstall tests that an installed filter denies a syscall to the thread
+func TestInstall(t *testing.T) {
+	profile := &Profile{DefaultAction: ActAllow, Syscalls: []Syscall{{Names: []string{"uname"}, Action: ActErrno}}}
+	filter, err := profile.Compile(Host{Arch: runtime.GOARCH})
+	if errors.Is(err, ErrUnsupportedArch) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The thread is never unlocked, so it exits with the goroutine and its filter
+		runtime.LockOSThread()
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, 38, 1, 0, 0, 0, 0); errno != 0 {
+			err = errno
+			return
+		}
+		if err = Install(filter); err != nil {
+			return
+		}
+		var uts syscall.Utsname
+		err = syscall.Uname(&uts)
+	}()
+	<-done
+	if !errors.Is(err, syscall.EPERM) {
+		t.Errorf("Uname() error = %v, want EPERM", err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package seccomp
+
+// Install returns ErrUnsupportedArch, seccomp only exists on Linux
+func Install(filter []Instruction) error {
+	return ErrUnsupportedArch
+}
@@ -0,0 +1,231 @@
+package seccomp
+
+//go:generate ../../hack/gen-seccomp-syscalls.sh
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Actions of a profile, as named by Docker and libseccomp
+const (
+	ActKill        = "SCMP_ACT_KILL"
+	ActKillThread  = "SCMP_ACT_KILL_THREAD"
+	ActKillProcess = "SCMP_ACT_KILL_PROCESS"
+	ActTrap        = "SCMP_ACT_TRAP"
+	ActErrno       = "SCMP_ACT_ERRNO"
+	ActTrace       = "SCMP_ACT_TRACE"
+	ActLog         = "SCMP_ACT_LOG"
+	ActAllow       = "SCMP_ACT_ALLOW"
+)
+
+// Comparison operators of the syscall arguments
+const (
+	OpNotEqual     = "SCMP_CMP_NE"
+	OpLess         = "SCMP_CMP_LT"
+	OpLessEqual    = "SCMP_CMP_LE"
+	OpEqual        = "SCMP_CMP_EQ"
+	OpGreaterEqual = "SCMP_CMP_GE"
+	OpGreater      = "SCMP_CMP_GT"
+	OpMaskedEqual  = "SCMP_CMP_MASKED_EQ"
+)
+
+// Profile is a seccomp profile in the JSON format of Docker, e.g. its default profile
+type Profile struct {
+	DefaultAction   string    `json:"defaultAction"`
+	DefaultErrnoRet *uint     `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string  `json:"architectures,omitempty"`
+	Syscalls        []Syscall `json:"syscalls,omitempty"`
+}
+
+// Syscall is a rule of a profile, applying its action to the syscalls of names called with matching arguments
+type Syscall struct {
+	Names    []string `json:"names"`
+	Action   string   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []Arg    `json:"args,omitempty"`
+	Includes Filter   `json:"includes,omitempty"`
+	Excludes Filter   `json:"excludes,omitempty"`
+}
+
+// Arg compares the argument of Index with Value, or for OpMaskedEqual masks it with Value and compares it with ValueTwo
+type Arg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo,omitempty"`
+	Op       string `json:"op"`
+}
+
+// Filter restricts a rule to some architectures, capabilities or kernels. Capabilities are satisfied
+// when the command keeps the capabilities of root, see Host.
+type Filter struct {
+	Arches    []string `json:"arches,omitempty"`
+	Caps      []string `json:"caps,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+// Host is the system a profile is compiled for, deciding which rules apply
+type Host struct {
+	// Arch is the Go architecture of the command, e.g. amd64
+	Arch string
+	// Privileged is set when the command keeps the capabilities of root
+	Privileged bool
+	// Kernel is the release of the running kernel, e.g. 6.8.0-45-generic
+	Kernel string
+}
+
+// Load reads the profile of the JSON file path
+func Load(path string) (*Profile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Profile
+	if err := json.Unmarshal(content, &p); err != nil {
+		return nil, fmt.Errorf("parse seccomp profile %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("seccomp profile %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Validate checks the actions and comparisons of the profile
+func (p *Profile) Validate() error {
+	if _, err := action(p.DefaultAction, p.DefaultErrnoRet, nil); err != nil {
+		return fmt.Errorf("defaultAction: %w", err)
+	}
+	for i, rule := range p.Syscalls {
+		if len(rule.Names) == 0 {
+			return fmt.Errorf("syscalls[%d]: no names", i)
+		}
+		if _, err := action(rule.Action, rule.ErrnoRet, p.DefaultErrnoRet); err != nil {
+			return fmt.Errorf("syscalls[%d]: %w", i, err)
+		}
+		for _, arg := range rule.Args {
+			if arg.Index > 5 {
+				return fmt.Errorf("syscalls[%d]: argument index %d out of range", i, arg.Index)
+			}
+			switch arg.Op {
+			case OpNotEqual, OpLess, OpLessEqual, OpEqual, OpGreaterEqual, OpGreater, OpMaskedEqual:
+			default:
+				return fmt.Errorf("syscalls[%d]: unknown operator %q", i, arg.Op)
+			}
+		}
+		for _, version := range []string{rule.Includes.MinKernel, rule.Excludes.MinKernel} {
+			if _, _, err := kernelVersion(version); version != "" && err != nil {
+				return fmt.Errorf("syscalls[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Seccomp return values of the filter, see seccomp(2)
+const (
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retTrap        = 0x00030000
+	retErrno       = 0x00050000
+	retTrace       = 0x7ff00000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+	retDataMask    = 0x0000ffff
+)
+
+// action returns the value returned by the filter for the action name. The errno of SCMP_ACT_ERRNO
+// and the message of SCMP_ACT_TRACE are errnoRet, or else defaultErrnoRet, or else EPERM.
+func action(name string, errnoRet, defaultErrnoRet *uint) (uint32, error) {
+	data := uint(syscall.EPERM)
+	switch {
+	case errnoRet != nil:
+		data = *errnoRet
+	case defaultErrnoRet != nil:
+		data = *defaultErrnoRet
+	}
+	if data > retDataMask {
+		return 0, fmt.Errorf("errnoRet %d out of range", data)
+	}
+	switch name {
+	case ActKill, ActKillThread:
+		return retKillThread, nil
+	case ActKillProcess:
+		return retKillProcess, nil
+	case ActTrap:
+		return retTrap, nil
+	case ActErrno:
+		return retErrno | uint32(data), nil
+	case ActTrace:
+		return retTrace | uint32(data), nil
+	case ActLog:
+		return retLog, nil
+	case ActAllow:
+		return retAllow, nil
+	case "":
+		return 0, fmt.Errorf("no action")
+	}
+	return 0, fmt.Errorf("unsupported action %q", name)
+}
+
+// applies reports whether the rule applies to host according to its includes and excludes
+func (s Syscall) applies(host Host) bool {
+	if len(s.Includes.Arches) > 0 && !slices.Contains(s.Includes.Arches, host.Arch) {
+		return false
+	}
+	if len(s.Includes.Caps) > 0 && !host.Privileged {
+		return false
+	}
+	if s.Includes.MinKernel != "" && !kernelAtLeast(host.Kernel, s.Includes.MinKernel) {
+		return false
+	}
+	if slices.Contains(s.Excludes.Arches, host.Arch) {
+		return false
+	}
+	if len(s.Excludes.Caps) > 0 && host.Privileged {
+		return false
+	}
+	if s.Excludes.MinKernel != "" && kernelAtLeast(host.Kernel, s.Excludes.MinKernel) {
+		return false
+	}
+	return true
+}
+
+// kernelAtLeast reports whether the kernel release is at least the version major.minor.
+// An unknown release is taken as recent.
+func kernelAtLeast(release, version string) bool {
+	major, minor, err := kernelVersion(release)
+	if err != nil {
+		return true
+	}
+	wantMajor, wantMinor, err := kernelVersion(version)
+	if err != nil {
+		return false
+	}
+	return major > wantMajor || (major == wantMajor && minor >= wantMinor)
+}
+
+// kernelVersion parses the major and minor version of a kernel release, e.g. 6.8.0-45-generic
+func kernelVersion(release string) (int, int, error) {
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("invalid kernel version %q", release)
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid kernel version %q", release)
+	}
+	minorDigits := strings.IndexFunc(fields[1], func(r rune) bool { return r < '0' || r > '9' })
+	if minorDigits < 0 {
+		minorDigits = len(fields[1])
+	}
+	minor, err := strconv.Atoi(fields[1][:minorDigits])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid kernel version %q", release)
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,73 @@
+package seccomp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoad tests reading and validating profiles
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "docker style", content: `{
+			"defaultAction": "SCMP_ACT_ERRNO",
+			"defaultErrnoRet": 1,
+			"architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"],
+			"syscalls": [
+				{"names": ["read", "write"], "action": "SCMP_ACT_ALLOW"},
+				{"names": ["personality"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 8, "op": "SCMP_CMP_EQ"}]},
+				{"names": ["bpf"], "action": "SCMP_ACT_ALLOW", "includes": {"caps": ["CAP_SYS_ADMIN"], "minKernel": "4.8"}}
+			]
+		}`},
+		{name: "invalid JSON", content: `{"defaultAction":`, wantErr: true},
+		{name: "no default action", content: `{"syscalls": []}`, wantErr: true},
+		{name: "notify action", content: `{"defaultAction": "SCMP_ACT_NOTIFY"}`, wantErr: true},
+		{name: "no names", content: `{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"action": "SCMP_ACT_ERRNO"}]}`, wantErr: true},
+		{name: "argument index", content: `{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ERRNO",
+			"args": [{"index": 6, "value": 0, "op": "SCMP_CMP_EQ"}]}]}`, wantErr: true},
+		{name: "operator", content: `{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ERRNO",
+			"args": [{"index": 0, "value": 0, "op": "SCMP_CMP_LIKE"}]}]}`, wantErr: true},
+		{name: "kernel version", content: `{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ERRNO",
+			"includes": {"minKernel": "new"}}]}`, wantErr: true},
+		{name: "errnoRet", content: `{"defaultAction": "SCMP_ACT_ERRNO", "defaultErrnoRet": 70000}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "profile.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
+
+// TestKernelAtLeast tests comparing kernel releases with the minKernel of rules
+func TestKernelAtLeast(t *testing.T) {
+	tests := []struct {
+		release string
+		version string
+		want    bool
+	}{
+		{release: "6.8.0-45-generic", version: "4.8", want: true},
+		{release: "4.8.0", version: "4.8", want: true},
+		{release: "4.4.0-210-generic", version: "4.8", want: false},
+		{release: "5.10+", version: "5.10", want: true},
+		{release: "unknown", version: "5.10", want: true},
+	}
+	for _, tt := range tests {
+		if got := kernelAtLeast(tt.release, tt.version); got != tt.want {
+			t.Errorf("kernelAtLeast(%q, %q) = %v, want %v", tt.release, tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !linux || !(amd64 || arm64 || arm)
+
+package seccomp
+
+// syscalls is empty, seccomp filters are only built for the Linux release architectures
+var syscalls map[string]uint32
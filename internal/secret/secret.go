@@ -0,0 +1,84 @@
+package secret
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSuffix is the suffix of the environment variables naming the file of a secret, e.g. INFLUX_TOKEN_FILE
+// for INFLUX_TOKEN, as in the images of Docker and Kubernetes secrets
+const FileSuffix = "_FILE"
+
+// Secret is a credential of an integration, either a fixed value or the content of a file. The file
+// is read again whenever it changed, so credentials rotated by e.g. vault-agent are picked up by
+// runs started before the rotation.
+type Secret struct {
+	value string
+	path  string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// Value returns the secret of the fixed value
+func Value(value string) *Secret {
+	return &Secret{value: value}
+}
+
+// File returns the secret held in the file path, surrounding whitespace excluded
+func File(path string) *Secret {
+	return &Secret{path: path}
+}
+
+// Lookup returns the secret of the file path if it is not empty, or else of the file named by the
+// environment variable env with FileSuffix, or else of the value of env. It returns nil if none is set.
+func Lookup(path, env string) *Secret {
+	switch {
+	case path != "":
+		return File(path)
+	case os.Getenv(env+FileSuffix) != "":
+		return File(os.Getenv(env + FileSuffix))
+	case os.Getenv(env) != "":
+		return Value(os.Getenv(env))
+	}
+	return nil
+}
+
+// Path returns the file of the secret, empty for a fixed value
+func (s *Secret) Path() string {
+	if s == nil {
+		return ""
+	}
+	return s.path
+}
+
+// Get returns the secret, reading its file again if it changed since the last read.
+// A nil Secret is empty.
+func (s *Secret) Get() (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	if s.path == "" {
+		return s.value, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.value, nil
+	}
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	s.value = strings.TrimSpace(string(content))
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return s.value, nil
+}
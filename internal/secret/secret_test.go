@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSecretGet tests reading a secret file again once it is rotated
+func TestSecretGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := File(path)
+	if got, err := s.Get(); err != nil || got != "first" {
+		t.Fatalf("Get() = %q, %v, want first", got, err)
+	}
+
+	// vault-agent renders the rotated secret to a new file renamed over the old one
+	rotated := path + ".tmp"
+	if err := os.WriteFile(rotated, []byte("second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(rotated, time.Time{}, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(rotated, path); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(); err != nil || got != "second" {
+		t.Errorf("Get() after rotation = %q, %v, want second", got, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(); err == nil {
+		t.Error("Get() of a removed file succeeded")
+	}
+}
+
+// TestLookup tests the precedence of the file flag, the _FILE environment variable and the environment variable
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	flagFile := filepath.Join(dir, "flag")
+	envFile := filepath.Join(dir, "env")
+	for path, content := range map[string]string{flagFile: "from-flag", envFile: "from-env-file"} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		envFile string
+		env     string
+		want    string
+	}{
+		{name: "none"},
+		{name: "env", env: "from-env", want: "from-env"},
+		{name: "env file", envFile: envFile, env: "from-env", want: "from-env-file"},
+		{name: "flag", path: flagFile, envFile: envFile, env: "from-env", want: "from-flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_TOKEN", tt.env)
+			t.Setenv("TEST_TOKEN_FILE", tt.envFile)
+			s := Lookup(tt.path, "TEST_TOKEN")
+			if (s == nil) != (tt.want == "") {
+				t.Fatalf("Lookup() = %v, want a secret: %v", s, tt.want != "")
+			}
+			if got, err := s.Get(); err != nil || got != tt.want {
+				t.Errorf("Get() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package severity
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default is the severity of the failures a map does not assign one to
+const Default = "error"
+
+// None is the channel routing the failures of a severity to no notifier
+const None = "none"
+
+// namePattern matches severity and channel names
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// codeRange is a range of exit codes mapped to a severity
+type codeRange struct {
+	from, to int
+	severity string
+}
+
+// Map assigns severities to the exit codes of failed runs and routes their notifications by severity.
+// It is read from a file of lines such as:
+//
+//	# rsync: some files vanished or could not be transferred
+//	exit 23,24 => warning
+//	exit 1-22 => critical
+//	default => error
+//	notify warning => file
+//	notify critical => slack,webhook
+type Map struct {
+	codes    []codeRange
+	fallback string
+	routes   map[string][]string
+}
+
+// Load reads the map from the file at path
+func Load(path string) (*Map, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	m := &Map{fallback: Default, routes: make(map[string][]string)}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if err := m.parseLine(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseLine adds the mapping of a line, ignoring empty lines and comments
+func (m *Map) parseLine(line string) error {
+	line, _, _ = strings.Cut(line, "#")
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	left, right, ok := strings.Cut(line, "=>")
+	if !ok {
+		return fmt.Errorf("missing => in %q", line)
+	}
+	left, right = strings.TrimSpace(left), strings.TrimSpace(right)
+	keyword, args, _ := strings.Cut(left, " ")
+	args = strings.TrimSpace(args)
+	switch keyword {
+	case "exit":
+		if err := checkName("severity", right); err != nil {
+			return err
+		}
+		for _, field := range strings.Split(args, ",") {
+			r, err := parseCodes(strings.TrimSpace(field))
+			if err != nil {
+				return err
+			}
+			r.severity = right
+			m.codes = append(m.codes, r)
+		}
+	case "default":
+		if args != "" {
+			return fmt.Errorf("unexpected %q after default", args)
+		}
+		if err := checkName("severity", right); err != nil {
+			return err
+		}
+		m.fallback = right
+	case "notify":
+		if err := checkName("severity", args); err != nil {
+			return err
+		}
+		var channels []string
+		for _, channel := range strings.Split(right, ",") {
+			channel = strings.TrimSpace(channel)
+			if err := checkName("channel", channel); err != nil {
+				return err
+			}
+			channels = append(channels, channel)
+		}
+		m.routes[args] = channels
+	default:
+		return fmt.Errorf("unknown mapping %q, expected exit, default or notify", keyword)
+	}
+	return nil
+}
+
+// parseCodes parses an exit code or a range of exit codes such as 2-9
+func parseCodes(field string) (codeRange, error) {
+	from, to, isRange := strings.Cut(field, "-")
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 0 || first > 255 {
+		return codeRange{}, fmt.Errorf("invalid exit code %q", field)
+	}
+	last := first
+	if isRange {
+		if last, err = strconv.Atoi(to); err != nil || last < first || last > 255 {
+			return codeRange{}, fmt.Errorf("invalid exit code range %q", field)
+		}
+	}
+	return codeRange{from: first, to: last}, nil
+}
+
+// checkName fails if name is not a valid severity or channel name
+func checkName(kind, name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid %s %q", kind, name)
+	}
+	return nil
+}
+
+// Of returns the severity of a failure with exit code, the first mapping of the code or the default one.
+// Failures without an exit code, e.g. timeouts, pass -1 and get the default severity.
+func (m *Map) Of(code int) string {
+	for _, r := range m.codes {
+		if code >= r.from && code <= r.to {
+			return r.severity
+		}
+	}
+	return m.fallback
+}
+
+// Channels returns the channels notified of the failures of severity, all of them if it is not routed.
+// An empty list notifies none.
+func (m *Map) Channels(severity string) ([]string, bool) {
+	channels, ok := m.routes[severity]
+	if !ok {
+		return nil, false
+	}
+	var routed []string
+	for _, channel := range channels {
+		if channel != None {
+			routed = append(routed, channel)
+		}
+	}
+	return routed, true
+}
+
+// RoutedChannels returns all the channels named by the notify mappings, except None
+func (m *Map) RoutedChannels() []string {
+	var all []string
+	for _, channels := range m.routes {
+		for _, channel := range channels {
+			if channel != None {
+				all = append(all, channel)
+			}
+		}
+	}
+	return all
+}
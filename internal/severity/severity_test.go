@@ -0,0 +1,98 @@
+package severity
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeMap writes content to a map file and returns its path
+func writeMap(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "severity.map")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestMap tests assigning severities to exit codes and routing them to channels
+func TestMap(t *testing.T) {
+	m, err := Load(writeMap(t, `# rsync
+exit 23,24 => warning
+exit 1-30 => critical   # the first mapping wins
+default => major
+
+notify warning => file
+notify critical => slack, webhook
+notify info => none
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for code, want := range map[int]string{24: "warning", 1: "critical", 30: "critical", 31: "major", -1: "major"} {
+		if got := m.Of(code); got != want {
+			t.Errorf("Of(%d) = %q, want %q", code, got, want)
+		}
+	}
+	tests := []struct {
+		severity string
+		want     []string
+		wantOK   bool
+	}{
+		{severity: "warning", want: []string{"file"}, wantOK: true},
+		{severity: "critical", want: []string{"slack", "webhook"}, wantOK: true},
+		{severity: "info", wantOK: true},
+		{severity: "major"},
+	}
+	for _, tt := range tests {
+		got, ok := m.Channels(tt.severity)
+		if !slices.Equal(got, tt.want) || ok != tt.wantOK {
+			t.Errorf("Channels(%s) = %v, %v, want %v, %v", tt.severity, got, ok, tt.want, tt.wantOK)
+		}
+	}
+	routed := m.RoutedChannels()
+	slices.Sort(routed)
+	if !slices.Equal(routed, []string{"file", "slack", "webhook"}) {
+		t.Errorf("RoutedChannels() = %v", routed)
+	}
+}
+
+// TestMapDefault tests the default severity of an empty map
+func TestMapDefault(t *testing.T) {
+	m, err := Load(writeMap(t, ""))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := m.Of(2); got != Default {
+		t.Errorf("Of(2) = %q, want %q", got, Default)
+	}
+}
+
+// TestLoadErrors tests rejecting invalid mappings with their line
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "missing arrow", content: "exit 1 warning", wantErr: ":1: missing =>"},
+		{name: "bad code", content: "\nexit x => warning", wantErr: `:2: invalid exit code "x"`},
+		{name: "code too large", content: "exit 256 => warning", wantErr: "invalid exit code"},
+		{name: "reversed range", content: "exit 9-2 => warning", wantErr: "invalid exit code range"},
+		{name: "bad severity", content: "exit 1 => Warn!", wantErr: "invalid severity"},
+		{name: "bad channel", content: "notify warning => slack,", wantErr: "invalid channel"},
+		{name: "default argument", content: "default 1 => warning", wantErr: "unexpected"},
+		{name: "unknown", content: "signal 9 => critical", wantErr: "unknown mapping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeMap(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
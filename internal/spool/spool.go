@@ -0,0 +1,263 @@
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/alswl/cron-manager/internal/fslock"
+	"github.com/spf13/afero"
+)
+
+// Backoff bounds of the retries of a spooled entry: the delay doubles from MinBackoff after each
+// failed attempt, up to MaxBackoff
+const (
+	MinBackoff = time.Minute
+	MaxBackoff = time.Hour
+)
+
+// Entry is a submission a backend failed to receive, kept in the spool until it is replayed
+type Entry struct {
+	// Backend is the kind of backend, e.g. "pushgateway"
+	Backend string `json:"backend"`
+	// Target identifies the destination of the submission, e.g. the Pushgateway URL: only runs
+	// configured with the same target replay it
+	Target string `json:"target"`
+	// Key identifies what the submission replaces, e.g. the job name for the Pushgateway which only keeps
+	// the last push of a job: a newer submission with the same key discards it. Empty keeps every submission.
+	Key         string          `json:"key,omitempty"`
+	Created     time.Time       `json:"created"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	Payload     json.RawMessage `json:"payload"`
+	// Signature signs the backend, target and payload of the entry when the spool has a signer, see signed
+	Signature string `json:"signature,omitempty"`
+
+	path string
+}
+
+// Result is the outcome of a Replay
+type Result struct {
+	// Replayed entries were delivered and removed from the spool
+	Replayed int
+	// Expired entries were older than the maximum age and removed without being delivered
+	Expired int
+	// Pending entries are left in the spool
+	Pending int
+	// Rejected entries had no valid signature and were removed without being delivered, e.g. forged
+	Rejected int
+	// Failure is the error of the failed delivery that stopped the replay, if any
+	Failure error
+}
+
+// Spool keeps the submissions backends failed to receive in a directory, one file per entry, so that
+// later runs replay them once the network is back. The directory is locked while it is changed, as it is
+// shared by the jobs of the host.
+type Spool struct {
+	fs        afero.Fs
+	dir       string
+	maxAge    time.Duration
+	signer    *crypt.Signer
+	useOsLock bool
+}
+
+// New creates a Spool in dir, entries older than maxAge are dropped, 0 keeps them until they are delivered
+func New(fs afero.Fs, dir string, maxAge time.Duration) *Spool {
+	_, isOsFs := fs.(*afero.OsFs)
+	return &Spool{fs: fs, dir: dir, maxAge: maxAge, useOsLock: isOsFs}
+}
+
+// SignWith signs the entries added to the spool with signer, and only replays the entries it signed
+func (s *Spool) SignWith(signer *crypt.Signer) {
+	s.signer = signer
+}
+
+// signed returns the data the signature of an entry covers
+func signed(backend, target string, payload []byte) []byte {
+	return append([]byte(backend+"\n"+target+"\n"), payload...)
+}
+
+// Backoff returns the delay before the next attempt of an entry after attempts failed attempts
+func Backoff(attempts int) time.Duration {
+	delay := MinBackoff
+	for i := 1; i < attempts && delay < MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxBackoff)
+}
+
+// Add spools the failed submission of payload to backend and target at now. It replaces the entries
+// with the same key, if any.
+func (s *Spool) Add(backend, target, key string, payload []byte, now time.Time) error {
+	return s.locked(func(entries []*Entry) error {
+		if err := s.discard(entries, backend, target, key); err != nil {
+			return err
+		}
+		e := Entry{
+			Backend:     backend,
+			Target:      target,
+			Key:         key,
+			Created:     now,
+			Attempts:    1,
+			NextAttempt: now.Add(Backoff(1)),
+			Payload:     payload,
+		}
+		if s.signer != nil {
+			e.Signature = s.signer.Sign(signed(backend, target, payload))
+		}
+		content, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		f, err := afero.TempFile(s.fs, s.dir, backend+"-*.json.tmp")
+		if err != nil {
+			return err
+		}
+		tmpPath := f.Name()
+		_, err = f.Write(append(content, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = s.fs.Remove(tmpPath)
+			return err
+		}
+		return s.fs.Rename(tmpPath, strings.TrimSuffix(tmpPath, ".tmp"))
+	})
+}
+
+// Discard removes the entries of backend and target with key, superseded by a newer submission.
+// An empty key discards nothing.
+func (s *Spool) Discard(backend, target, key string) error {
+	if key == "" {
+		return nil
+	}
+	return s.locked(func(entries []*Entry) error {
+		return s.discard(entries, backend, target, key)
+	})
+}
+
+// discard removes the entries of backend and target with a non-empty key
+func (s *Spool) discard(entries []*Entry, backend, target, key string) error {
+	if key == "" {
+		return nil
+	}
+	for _, e := range entries {
+		if e.Backend == backend && e.Target == target && e.Key == key {
+			if err := s.fs.Remove(e.path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Replay sends the payloads of the entries of backend and target due at now with send, oldest first.
+// It stops at the first failed delivery, the backend being likely still unreachable, and postpones the
+// remaining due entries with the backoff of the failed one. With a signer, the entries without a valid
+// signature are removed unsent.
+func (s *Spool) Replay(backend, target string, now time.Time, send func(payload []byte) error) (Result, error) {
+	var result Result
+	err := s.locked(func(entries []*Entry) error {
+		var failed *Entry
+		for _, e := range entries {
+			if e.Backend != backend || e.Target != target {
+				continue
+			}
+			if s.signer != nil && !s.signer.Verify(signed(e.Backend, e.Target, e.Payload), e.Signature) {
+				log.Printf("Removing spooled submission %s to %s without a valid signature", e.path, e.Backend)
+				if err := s.fs.Remove(e.path); err != nil {
+					return err
+				}
+				result.Rejected++
+				continue
+			}
+			if s.maxAge > 0 && now.Sub(e.Created) > s.maxAge {
+				if err := s.fs.Remove(e.path); err != nil {
+					return err
+				}
+				result.Expired++
+				continue
+			}
+			result.Pending++
+			if now.Before(e.NextAttempt) {
+				continue
+			}
+			if failed == nil {
+				if result.Failure = send(e.Payload); result.Failure == nil {
+					if err := s.fs.Remove(e.path); err != nil {
+						return err
+					}
+					result.Pending--
+					result.Replayed++
+					continue
+				}
+				failed = e
+				e.Attempts++
+			}
+			e.NextAttempt = now.Add(Backoff(failed.Attempts))
+			if err := s.write(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// write rewrites the file of the entry e
+func (s *Spool) write(e *Entry) error {
+	content, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmpPath := e.path + ".tmp"
+	if err := afero.WriteFile(s.fs, tmpPath, append(content, '\n'), 0600); err != nil {
+		return err
+	}
+	return s.fs.Rename(tmpPath, e.path)
+}
+
+// locked runs fn with the entries of the spool, oldest first, under the lock of the directory
+func (s *Spool) locked(fn func(entries []*Entry) error) error {
+	if err := s.fs.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	locker := fslock.NewLocker(filepath.Join(s.dir, "spool"), s.useOsLock)
+	if err := locker.Lock(); err != nil {
+		return fmt.Errorf("couldn't lock %s: %w", s.dir, err)
+	}
+	defer func() { _ = locker.Unlock() }()
+
+	paths, err := afero.Glob(s.fs, filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	var entries []*Entry
+	for _, path := range paths {
+		content, err := afero.ReadFile(s.fs, path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		e := &Entry{path: path}
+		if err := json.Unmarshal(content, e); err != nil {
+			// A corrupted entry must not block the others
+			log.Printf("Ignoring invalid spool entry %s: %v", path, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return fn(entries)
+}
@@ -0,0 +1,179 @@
+package spool
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alswl/cron-manager/internal/crypt"
+	"github.com/spf13/afero"
+)
+
+// TestBackoff tests doubling the delay between attempts up to MaxBackoff
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Minute},
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 4, want: 8 * time.Minute},
+		{attempts: 7, want: time.Hour},
+		{attempts: 100, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// TestSpoolReplay tests replaying the spooled entries of successive runs, with backoff while the backend is down
+func TestSpoolReplay(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	s := New(afero.NewMemMapFs(), "/state/spool", 24*time.Hour)
+	for i, payload := range []string{`"first"`, `"second"`} {
+		if err := s.Add("pushgateway", "http://pushgateway:9091", "", []byte(payload), start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	if err := s.Add("influxdb", "http://influxdb:8086", "", []byte(`"other"`), start); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	down := errors.New("connection refused")
+	steps := []struct {
+		name         string
+		at           time.Duration
+		err          error
+		wantSent     []string
+		wantResult   Result
+		wantAttempts int
+	}{
+		{name: "not due", at: 30 * time.Second, wantResult: Result{Pending: 2}},
+		{name: "still down", at: time.Minute + time.Second, err: down, wantSent: []string{`"first"`}, wantResult: Result{Pending: 2, Failure: down}},
+		{name: "backoff", at: 2 * time.Minute, wantResult: Result{Pending: 2}},
+		{name: "back up", at: 3*time.Minute + time.Second, wantSent: []string{`"first"`, `"second"`}, wantResult: Result{Replayed: 2}},
+		{name: "empty", at: time.Hour},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			var sent []string
+			result, err := s.Replay("pushgateway", "http://pushgateway:9091", start.Add(step.at), func(payload []byte) error {
+				sent = append(sent, string(payload))
+				return step.err
+			})
+			if err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+			if result != step.wantResult {
+				t.Errorf("Replay() = %+v, want %+v", result, step.wantResult)
+			}
+			if len(sent) != len(step.wantSent) {
+				t.Fatalf("sent %q, want %q", sent, step.wantSent)
+			}
+			for i := range sent {
+				if sent[i] != step.wantSent[i] {
+					t.Errorf("sent %q, want %q", sent, step.wantSent)
+				}
+			}
+		})
+	}
+
+	// The entries of other backends are left alone
+	result, err := s.Replay("influxdb", "http://influxdb:8086", start.Add(time.Hour), func([]byte) error { return nil })
+	if err != nil || result.Replayed != 1 {
+		t.Errorf("Replay() = %+v, %v, want 1 replayed", result, err)
+	}
+}
+
+// TestSpoolKey tests replacing the entries with the key of a newer submission
+func TestSpoolKey(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	s := New(afero.NewMemMapFs(), "/state/spool", 0)
+	for i, payload := range []string{`"backup 1"`, `"sync"`, `"backup 2"`} {
+		key := "backup"
+		if payload == `"sync"` {
+			key = "sync"
+		}
+		if err := s.Add("pushgateway", "http://pushgateway:9091", key, []byte(payload), start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	if err := s.Discard("pushgateway", "http://pushgateway:9091", "sync"); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+
+	var sent []string
+	result, err := s.Replay("pushgateway", "http://pushgateway:9091", start.Add(time.Hour), func(payload []byte) error {
+		sent = append(sent, string(payload))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if result.Replayed != 1 || len(sent) != 1 || sent[0] != `"backup 2"` {
+		t.Errorf("Replay() = %+v sent %q, want only \"backup 2\"", result, sent)
+	}
+}
+
+// TestSpoolExpired tests dropping the entries older than the maximum age, and ignoring corrupted entries
+func TestSpoolExpired(t *testing.T) {
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	fs := afero.NewMemMapFs()
+	s := New(fs, "/state/spool", time.Hour)
+	if err := s.Add("cloudwatch", "Cron", "", []byte(`"old"`), start); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := s.Add("cloudwatch", "Cron", "", []byte(`"recent"`), start.Add(30*time.Minute)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := afero.WriteFile(fs, "/state/spool/corrupted.json", []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []string
+	result, err := s.Replay("cloudwatch", "Cron", start.Add(time.Hour+time.Minute), func(payload []byte) error {
+		sent = append(sent, string(payload))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if result != (Result{Replayed: 1, Expired: 1}) || len(sent) != 1 || sent[0] != `"recent"` {
+		t.Errorf("Replay() = %+v sent %q, want only \"recent\" replayed and 1 expired", result, sent)
+	}
+}
+
+// TestSpoolSigned tests replaying only the entries signed by the signer of the spool
+func TestSpoolSigned(t *testing.T) {
+	now := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	fs := afero.NewMemMapFs()
+	signed := New(fs, "/state/spool", 24*time.Hour)
+	signed.SignWith(crypt.NewSigner(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize))))
+	if err := signed.Add("pushgateway", "http://pushgateway:9091", "", []byte(`"genuine"`), now); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	// An entry written without the key, e.g. by another user of the spool directory
+	if err := New(fs, "/state/spool", 24*time.Hour).Add("pushgateway", "http://pushgateway:9091", "", []byte(`"forged"`), now); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	var sent []string
+	result, err := signed.Replay("pushgateway", "http://pushgateway:9091", now.Add(time.Hour), func(payload []byte) error {
+		sent = append(sent, string(payload))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if len(sent) != 1 || sent[0] != `"genuine"` {
+		t.Errorf("Replay() sent %v, want only the signed entry", sent)
+	}
+	if result.Replayed != 1 || result.Rejected != 1 {
+		t.Errorf("Replay() = %+v, want 1 replayed and 1 rejected", result)
+	}
+}
@@ -0,0 +1,108 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// intentDir is the subdirectory of the store keeping the intent records
+const intentDir = "intents"
+
+// Intent is the record of a run written before its command is started and removed once its outcome was
+// reported. An intent left by a process that no longer exists is a run that was attempted but never reported.
+type Intent struct {
+	// Name is the job name
+	Name string `json:"name"`
+	// Owner is the owner the metrics of the job are sharded by, empty if they are not
+	Owner string `json:"owner,omitempty"`
+	// RunID identifies the run, see runner.RunID
+	RunID string `json:"run_id"`
+	// PID is the process ID of the cronmgr process running the job
+	PID int `json:"pid"`
+	// StartTime is the time the run started
+	StartTime time.Time `json:"start_time"`
+}
+
+// Stale reports whether the process that wrote the intent no longer exists
+func (i Intent) Stale() bool {
+	return !ProcessAlive(i.PID)
+}
+
+// intentPath returns the file of the intent, unique to its run
+func (s *Store) intentPath(intent Intent) string {
+	name := strings.ReplaceAll(intent.Name, string(filepath.Separator), "_")
+	return filepath.Join(s.dir, intentDir, name+"."+intent.RunID+".json")
+}
+
+// WriteIntent durably records the intent before the command of its run is started
+func (s *Store) WriteIntent(intent Intent) error {
+	if err := s.fs.MkdirAll(filepath.Join(s.dir, intentDir), 0755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+	file, err := s.fs.OpenFile(s.intentPath(intent), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Intents returns the intents of the runs whose outcome was not reported yet
+func (s *Store) Intents() ([]Intent, error) {
+	dir := filepath.Join(s.dir, intentDir)
+	entries, err := afero.ReadDir(s.fs, dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var intents []Intent
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		content, err := afero.ReadFile(s.fs, path)
+		if os.IsNotExist(err) {
+			// Removed by the run reporting its outcome or another reconciliation
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var intent Intent
+		if err := json.Unmarshal(content, &intent); err != nil {
+			return nil, fmt.Errorf("invalid intent file %s: %w", path, err)
+		}
+		intents = append(intents, intent)
+	}
+	return intents, nil
+}
+
+// ClaimIntent removes the intent, claimed is false if it was already removed. Only one process claims an
+// intent, so the run it records is accounted for once.
+func (s *Store) ClaimIntent(intent Intent) (claimed bool, err error) {
+	err = s.fs.Remove(s.intentPath(intent))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package state
+
+import (
+	"os"
+)
+
+// processAlive reports whether pid can be found, on these platforms finding fails for exited processes
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
@@ -0,0 +1,16 @@
+package state
+
+import (
+	"os"
+	"testing"
+)
+
+// TestProcessAlive tests the ProcessAlive function
+func TestProcessAlive(t *testing.T) {
+	if !ProcessAlive(os.Getpid()) {
+		t.Error("ProcessAlive() should report the current process as alive")
+	}
+	if ProcessAlive(0) || ProcessAlive(-1) {
+		t.Error("ProcessAlive() should report invalid PIDs as not alive")
+	}
+}
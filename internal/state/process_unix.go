@@ -0,0 +1,15 @@
+//go:build unix
+
+package state
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive sends signal 0 to pid, which checks for its existence without signaling it
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM means the process exists but belongs to another user
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,137 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// RunState is the recorded state of the last run of a job
+type RunState struct {
+	// Name is the job name
+	Name string `json:"name"`
+	// Owner is the owner the metrics of the job are sharded by, empty if they are not
+	Owner string `json:"owner,omitempty"`
+	// RunID identifies the run, see runner.RunID
+	RunID string `json:"run_id,omitempty"`
+	// PID is the process ID of the cronmgr process running the job
+	PID int `json:"pid"`
+	// Running is true from the start of the run until its final metrics were written
+	Running bool `json:"running"`
+	// StartTime is the time the run started
+	StartTime time.Time `json:"start_time"`
+	// FinishTime is the time the run finished, zero while it is running
+	FinishTime time.Time `json:"finish_time,omitzero"`
+	// ExitCode is the exit code of the finished run
+	ExitCode int `json:"exit_code"`
+	// Incomplete is true if the run was found running after its process had exited
+	Incomplete bool `json:"incomplete,omitempty"`
+	// LogFile is the path the output of the run is written to, empty if it is discarded
+	LogFile string `json:"log_file,omitempty"`
+	// Command is the command line the job runs, quoted for a shell, to tell apart jobs sharing a name
+	Command string `json:"command,omitempty"`
+}
+
+// Stale reports whether the run is recorded as running but its process no longer exists
+func (s RunState) Stale() bool {
+	return s.Running && !ProcessAlive(s.PID)
+}
+
+// Store keeps the state of each job in a JSON file named after the job in a directory
+type Store struct {
+	fs  afero.Fs
+	dir string
+}
+
+// NewStore creates a Store keeping state files in dir
+func NewStore(fs afero.Fs, dir string) *Store {
+	return &Store{fs: fs, dir: dir}
+}
+
+// path returns the state file of the job name
+func (s *Store) path(name string) string {
+	// Job names are free text, keep them from escaping the state directory
+	return filepath.Join(s.dir, strings.ReplaceAll(name, string(filepath.Separator), "_")+".json")
+}
+
+// Load returns the state of the job name, found is false if it never ran with this store
+func (s *Store) Load(name string) (state RunState, found bool, err error) {
+	state, err = s.read(s.path(name))
+	if os.IsNotExist(err) {
+		return RunState{}, false, nil
+	}
+	if err != nil {
+		return RunState{}, false, err
+	}
+	return state, true, nil
+}
+
+// List returns the states of all jobs in the store
+func (s *Store) List() ([]RunState, error) {
+	entries, err := afero.ReadDir(s.fs, s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var states []RunState
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		state, err := s.read(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// read parses the state file at path
+func (s *Store) read(path string) (RunState, error) {
+	content, err := afero.ReadFile(s.fs, path)
+	if err != nil {
+		return RunState{}, err
+	}
+	var state RunState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return RunState{}, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// Save atomically replaces the state of the job
+func (s *Store) Save(state RunState) error {
+	if err := s.fs.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.path(state.Name)
+	tmpPath := path + ".tmp"
+	file, err := s.fs.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return s.fs.Rename(tmpPath, path)
+}
@@ -0,0 +1,117 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// TestStoreSaveLoad tests saving and loading job states
+func TestStoreSaveLoad(t *testing.T) {
+	store := NewStore(afero.NewMemMapFs(), "/state")
+
+	if _, found, err := store.Load("job"); err != nil || found {
+		t.Fatalf("Load() of unknown job = %v, %v, want not found", found, err)
+	}
+
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	tests := []RunState{
+		{Name: "job", PID: 42, Running: true, StartTime: start},
+		{Name: "job", PID: 42, StartTime: start, FinishTime: start.Add(time.Minute), ExitCode: 3},
+		{Name: "team/job", PID: 7, Running: true, StartTime: start},
+	}
+	for _, want := range tests {
+		t.Run(want.Name, func(t *testing.T) {
+			if err := store.Save(want); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			got, found, err := store.Load(want.Name)
+			if err != nil || !found {
+				t.Fatalf("Load() = %v, %v, want found", found, err)
+			}
+			if got != want {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	if exists, _ := afero.Exists(store.fs, "/state/team_job.json"); !exists {
+		t.Error("Job names with path separators should stay in the state directory")
+	}
+}
+
+// TestStoreLoadInvalid tests that a corrupted state file is an error
+func TestStoreLoadInvalid(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/state/job.json", []byte("{"), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+	if _, _, err := NewStore(fs, "/state").Load("job"); err == nil {
+		t.Error("Load() expected error for invalid state file")
+	}
+}
+
+// TestStoreList tests listing the states of all jobs
+func TestStoreList(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	store := NewStore(fs, "/state")
+
+	if states, err := store.List(); err != nil || len(states) != 0 {
+		t.Fatalf("List() of missing directory = %v, %v, want empty", states, err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if err := store.Save(RunState{Name: name, PID: 1}); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	// Leftover temporary files are ignored
+	if err := afero.WriteFile(fs, "/state/c.json.tmp", []byte("{"), 0644); err != nil {
+		t.Fatalf("Failed to write temporary file: %v", err)
+	}
+
+	states, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(states) != 2 || states[0].Name != "a" || states[1].Name != "b" {
+		t.Errorf("List() = %+v, want states of a and b", states)
+	}
+}
+
+// TestStoreIntents tests writing, listing and claiming intents
+func TestStoreIntents(t *testing.T) {
+	store := NewStore(afero.NewMemMapFs(), "/state")
+	intent := Intent{Name: "backup/db", RunID: "20240101T020000Z-42", PID: 42, StartTime: time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)}
+
+	if err := store.WriteIntent(intent); err != nil {
+		t.Fatalf("WriteIntent() error = %v", err)
+	}
+	if err := store.WriteIntent(intent); err == nil {
+		t.Error("WriteIntent() of the same run should fail")
+	}
+	if err := store.Save(RunState{Name: "backup/db", PID: 42}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if states, err := store.List(); err != nil || len(states) != 1 {
+		t.Errorf("List() = %+v, %v, want the intents left out", states, err)
+	}
+	intents, err := store.Intents()
+	if err != nil {
+		t.Fatalf("Intents() error = %v", err)
+	}
+	if len(intents) != 1 || !intents[0].StartTime.Equal(intent.StartTime) || intents[0].RunID != intent.RunID {
+		t.Errorf("Intents() = %+v, want %+v", intents, intent)
+	}
+
+	for i, want := range []bool{true, false} {
+		claimed, err := store.ClaimIntent(intent)
+		if err != nil || claimed != want {
+			t.Errorf("ClaimIntent() #%d = %v, %v, want %v", i+1, claimed, err, want)
+		}
+	}
+	if intents, _ := store.Intents(); len(intents) != 0 {
+		t.Errorf("Intents() = %+v after the claim, want none", intents)
+	}
+}
@@ -0,0 +1,71 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFakeClock tests the FakeClock
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+
+	t.Run("time only moves on advance", func(t *testing.T) {
+		clock := NewFakeClock(start)
+		if !clock.Now().Equal(start) {
+			t.Errorf("Now() = %v, want %v", clock.Now(), start)
+		}
+		clock.Advance(90 * time.Second)
+		if clock.Since(start) != 90*time.Second {
+			t.Errorf("Since() = %v, want 90s", clock.Since(start))
+		}
+	})
+
+	t.Run("sleep advances without blocking", func(t *testing.T) {
+		clock := NewFakeClock(start)
+		before := time.Now()
+		clock.Sleep(time.Hour)
+		if time.Since(before) > 100*time.Millisecond {
+			t.Error("Sleep() should not block")
+		}
+		if clock.Since(start) != time.Hour {
+			t.Errorf("Since() = %v, want 1h", clock.Since(start))
+		}
+	})
+
+	t.Run("after fires once deadline is reached", func(t *testing.T) {
+		clock := NewFakeClock(start)
+		ch := clock.After(10 * time.Second)
+		if clock.Waiters() != 1 {
+			t.Errorf("Waiters() = %d, want 1", clock.Waiters())
+		}
+
+		clock.Advance(5 * time.Second)
+		select {
+		case <-ch:
+			t.Fatal("After() fired before deadline")
+		default:
+		}
+
+		clock.Advance(5 * time.Second)
+		select {
+		case got := <-ch:
+			if !got.Equal(start.Add(10 * time.Second)) {
+				t.Errorf("After() sent %v, want %v", got, start.Add(10*time.Second))
+			}
+		default:
+			t.Fatal("After() did not fire at deadline")
+		}
+		if clock.Waiters() != 0 {
+			t.Errorf("Waiters() = %d, want 0", clock.Waiters())
+		}
+	})
+
+	t.Run("after with non-positive duration fires immediately", func(t *testing.T) {
+		clock := NewFakeClock(start)
+		select {
+		case <-clock.After(0):
+		default:
+			t.Fatal("After(0) should fire immediately")
+		}
+	})
+}
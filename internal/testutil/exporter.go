@@ -0,0 +1,186 @@
+package testutil
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+	"github.com/spf13/afero"
+)
+
+// memExporterDir is the directory of the exporter file inside the in-memory file system
+const memExporterDir = "/metrics"
+
+// Sample is one parsed line of a Prometheus text file
+type Sample struct {
+	// Series is the metric name with its labels, e.g. crontab_failed{name="job"}
+	Series string
+	// Value is the sample value as written
+	Value string
+	// Timestamp is the sample timestamp in milliseconds as written, empty if the sample has none
+	Timestamp string
+}
+
+// MemExporter is an in-memory exporter backend for tests.
+// It records the content of the exporter file after every write,
+// so tests can assert the sequence of values a metric went through.
+type MemExporter struct {
+	fs *recordingFs
+}
+
+// NewMemExporter creates an empty in-memory exporter backend
+func NewMemExporter() *MemExporter {
+	return &MemExporter{fs: &recordingFs{Fs: afero.NewMemMapFs()}}
+}
+
+// Options returns the exporter options writing metrics to this backend
+func (m *MemExporter) Options() []exporter.Option {
+	return []exporter.Option{
+		exporter.WithFileSystem(m.fs),
+		exporter.WithExporterDir(memExporterDir),
+	}
+}
+
+// Fs returns the in-memory file system backing the exporter
+func (m *MemExporter) Fs() afero.Fs {
+	return m.fs
+}
+
+// Path returns the path of the exporter file inside the file system
+func (m *MemExporter) Path() string {
+	return filepath.Join(memExporterDir, "crons.prom")
+}
+
+// Content returns the current content of the exporter file
+func (m *MemExporter) Content() string {
+	content, err := afero.ReadFile(m.fs, m.Path())
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// Samples returns the samples currently in the exporter file
+func (m *MemExporter) Samples() []Sample {
+	return ParseSamples(m.Content())
+}
+
+// Value returns the current value of series, e.g. `crontab_failed{name="job"}`
+func (m *MemExporter) Value(series string) (string, bool) {
+	for _, sample := range m.Samples() {
+		if sample.Series == series {
+			return sample.Value, true
+		}
+	}
+	return "", false
+}
+
+// History returns the distinct consecutive values series had over all writes to the exporter file
+func (m *MemExporter) History(series string) []string {
+	var history []string
+	for _, content := range m.fs.snapshots(m.Path()) {
+		for _, sample := range ParseSamples(content) {
+			if sample.Series != series {
+				continue
+			}
+			if len(history) == 0 || history[len(history)-1] != sample.Value {
+				history = append(history, sample.Value)
+			}
+		}
+	}
+	return history
+}
+
+// ParseSamples parses the samples of a Prometheus text file, skipping comments
+func ParseSamples(content string) []Sample {
+	var samples []Sample
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// The series ends after the labels, or at the first space without labels
+		end := strings.LastIndex(line, "}") + 1
+		if end == 0 {
+			end = strings.Index(line, " ")
+		}
+		if end <= 0 {
+			continue
+		}
+		fields := strings.Fields(line[end:])
+		if len(fields) == 0 {
+			continue
+		}
+		sample := Sample{Series: line[:end], Value: fields[0]}
+		if len(fields) > 1 {
+			sample.Timestamp = fields[1]
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// recordingFs is an afero.Fs that keeps the content of each file after every write,
+// including files replaced by renaming a temporary file over them
+type recordingFs struct {
+	afero.Fs
+	mu      sync.Mutex
+	history map[string][]string
+}
+
+// OpenFile opens a file, recording its content when it was opened for writing and is closed
+func (r *recordingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := r.Fs.OpenFile(name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return file, err
+	}
+	return &recordingFile{File: file, fs: r, name: name}, nil
+}
+
+// Rename renames a file, recording the content at its new name
+func (r *recordingFs) Rename(oldname, newname string) error {
+	if err := r.Fs.Rename(oldname, newname); err != nil {
+		return err
+	}
+	r.record(newname)
+	return nil
+}
+
+// record stores the current content of name
+func (r *recordingFs) record(name string) {
+	content, err := afero.ReadFile(r.Fs, name)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.history == nil {
+		r.history = make(map[string][]string)
+	}
+	r.history[name] = append(r.history[name], string(content))
+}
+
+// snapshots returns the recorded contents of name in write order
+func (r *recordingFs) snapshots(name string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.history[name]...)
+}
+
+// recordingFile records the file content on Close
+type recordingFile struct {
+	afero.File
+	fs   *recordingFs
+	name string
+}
+
+// Close closes the file and records its content
+func (f *recordingFile) Close() error {
+	err := f.File.Close()
+	f.fs.record(f.name)
+	return err
+}
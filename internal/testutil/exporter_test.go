@@ -0,0 +1,90 @@
+package testutil
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/alswl/cron-manager/internal/exporter"
+)
+
+// TestParseSamples tests the ParseSamples function
+func TestParseSamples(t *testing.T) {
+	content := `# HELP crontab_failed Whether the job failed
+# TYPE crontab_failed gauge
+crontab_failed{name="a"} 1
+
+crontab_runs_total{name="a",status="started"} 12
+crontab_wall_seconds{name="a"} 0.20 1704074400200
+crontab_up 1
+`
+	samples := ParseSamples(content)
+	expected := []Sample{
+		{Series: `crontab_failed{name="a"}`, Value: "1"},
+		{Series: `crontab_runs_total{name="a",status="started"}`, Value: "12"},
+		{Series: `crontab_wall_seconds{name="a"}`, Value: "0.20", Timestamp: "1704074400200"},
+		{Series: "crontab_up", Value: "1"},
+	}
+	if fmt.Sprint(samples) != fmt.Sprint(expected) {
+		t.Errorf("ParseSamples() = %v, want %v", samples, expected)
+	}
+}
+
+// TestMemExporter tests that the in-memory backend records values and their history
+func TestMemExporter(t *testing.T) {
+	mem := NewMemExporter()
+	exp := exporter.NewExporter(mem.Options()...)
+
+	exp.WriteGauge("running", "job", "1", "Running")
+	exp.WriteGauge("running", "job", "1", "Running")
+	exp.WriteGauge("running", "job", "0", "Running")
+	exp.IncrementCounter("runs_total", "job", nil, "Runs")
+
+	if value, ok := mem.Value(`crontab_running{name="job"}`); !ok || value != "0" {
+		t.Errorf("Value() = %v, %v, want 0, true", value, ok)
+	}
+	if _, ok := mem.Value(`crontab_missing{name="job"}`); ok {
+		t.Error("Value() should not find missing series")
+	}
+	if history := mem.History(`crontab_running{name="job"}`); fmt.Sprint(history) != "[1 0]" {
+		t.Errorf("History() = %v, want [1 0]", history)
+	}
+	if !strings.Contains(mem.Content(), `crontab_runs_total{name="job"} 1`) {
+		t.Errorf("Content() missing counter, got:\n%s", mem.Content())
+	}
+}
+
+// TestScripts tests the script fixtures
+func TestScripts(t *testing.T) {
+	t.Run("exit script", func(t *testing.T) {
+		err := exec.Command(ExitScript(t, 4)).Run()
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 4 {
+			t.Errorf("ExitScript exit = %v, want exit status 4", err)
+		}
+	})
+
+	t.Run("output script", func(t *testing.T) {
+		out, err := exec.Command(OutputScript(t, "it's out", "err", 0)).CombinedOutput()
+		if err != nil {
+			t.Fatalf("OutputScript failed: %v", err)
+		}
+		if !strings.Contains(string(out), "it's out\n") || !strings.Contains(string(out), "err\n") {
+			t.Errorf("OutputScript output = %q", out)
+		}
+	})
+
+	t.Run("failing script", func(t *testing.T) {
+		script := FailingScript(t, 2, 75)
+		for i, want := range []int{75, 75, 0, 0} {
+			err := exec.Command(script).Run()
+			code := 0
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				code = exitErr.ExitCode()
+			}
+			if code != want {
+				t.Errorf("run %d exit code = %d, want %d", i+1, code, want)
+			}
+		}
+	})
+}
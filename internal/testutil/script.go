@@ -0,0 +1,56 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// WriteScript writes an executable shell script with body into a temporary directory
+// and returns its path
+func WriteScript(t testing.TB, name string, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	content := "#!/bin/sh\n" + body
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	return path
+}
+
+// ExitScript returns a script that exits with code
+func ExitScript(t testing.TB, code int) string {
+	t.Helper()
+	return WriteScript(t, "exit.sh", fmt.Sprintf("exit %d", code))
+}
+
+// OutputScript returns a script that writes stdout and stderr, then exits with code
+func OutputScript(t testing.TB, stdout, stderr string, code int) string {
+	t.Helper()
+	return WriteScript(t, "output.sh", fmt.Sprintf("printf '%%s\\n' %s\nprintf '%%s\\n' %s >&2\nexit %d",
+		quote(stdout), quote(stderr), code))
+}
+
+// FailingScript returns a script that fails with code the first failures times it runs
+// and succeeds afterwards; the run count is kept in a file next to the script
+func FailingScript(t testing.TB, failures int, code int) string {
+	t.Helper()
+	return WriteScript(t, "flaky.sh", fmt.Sprintf(`dir=$(dirname "$0")
+count=$(cat "$dir/count" 2>/dev/null || echo 0)
+count=$((count + 1))
+echo "$count" > "$dir/count"
+if [ "$count" -le %d ]; then
+  exit %d
+fi
+exit 0`, failures, code))
+}
+
+// quote quotes s for a shell script
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -3,19 +3,50 @@ package version
 import (
 	"fmt"
 	"runtime"
+	"runtime/debug"
+)
+
+// Placeholders of values not set at build time
+const (
+	unknownVersion = "0.0.0"
+	unknown        = "UNKNOWN"
 )
 
 var (
 	// Version is the version of the build.
 	// it will be overwritten automatically by the build system.
-	Version   = "0.0.0"
-	Commit    = "UNKNOWN"
+	Version   = unknownVersion
+	Commit    = unknown
 	Package   = "github.com/alswl/cron-manager"
-	BuildDate = "UNKNOWN"
+	BuildDate = unknown
 )
 
 var GoVersion = runtime.Version()
 
+func init() {
+	// Builds without the ldflags of the Makefile, e.g. go install, still embed module and VCS information
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fillFromBuildInfo(info)
+	}
+}
+
+// fillFromBuildInfo sets the values not set by ldflags from the build information embedded by the go command
+func fillFromBuildInfo(info *debug.BuildInfo) {
+	if Version == unknownVersion && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		Version = info.Main.Version
+	}
+	settings := map[string]string{}
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if Commit == unknown && settings["vcs.revision"] != "" {
+		Commit = settings["vcs.revision"][:min(len(settings["vcs.revision"]), 7)]
+		if settings["vcs.modified"] == "true" {
+			Commit += "-dirty"
+		}
+	}
+}
+
 func Message() string {
 	const format = `cronmgr:   %s (Revision: %s)
 package:    %s
@@ -24,3 +55,12 @@ go version: %s
 `
 	return fmt.Sprintf(format, Version, Commit, Package, BuildDate, GoVersion)
 }
+
+// Labels returns the labels of the build info metric
+func Labels() map[string]string {
+	return map[string]string{
+		"version":    Version,
+		"commit":     Commit,
+		"go_version": GoVersion,
+	}
+}
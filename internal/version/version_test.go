@@ -0,0 +1,65 @@
+package version
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+// TestFillFromBuildInfo tests that build information only fills values not set by ldflags
+func TestFillFromBuildInfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     string
+		commit      string
+		info        debug.BuildInfo
+		wantVersion string
+		wantCommit  string
+	}{
+		{
+			name:    "go install",
+			version: unknownVersion,
+			commit:  unknown,
+			info: debug.BuildInfo{
+				Main:     debug.Module{Version: "v1.2.3"},
+				Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "0123456789abcdef"}},
+			},
+			wantVersion: "v1.2.3",
+			wantCommit:  "0123456",
+		},
+		{
+			name:    "dirty checkout",
+			version: unknownVersion,
+			commit:  unknown,
+			info: debug.BuildInfo{
+				Main: debug.Module{Version: "(devel)"},
+				Settings: []debug.BuildSetting{
+					{Key: "vcs.revision", Value: "0123456789abcdef"},
+					{Key: "vcs.modified", Value: "true"},
+				},
+			},
+			wantVersion: unknownVersion,
+			wantCommit:  "0123456-dirty",
+		},
+		{
+			name:    "ldflags",
+			version: "v1.0.0-abc1234",
+			commit:  "abc1234",
+			info: debug.BuildInfo{
+				Main:     debug.Module{Version: "v1.2.3"},
+				Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "0123456789abcdef"}},
+			},
+			wantVersion: "v1.0.0-abc1234",
+			wantCommit:  "abc1234",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+			Version, Commit = tt.version, tt.commit
+			fillFromBuildInfo(&tt.info)
+			if Version != tt.wantVersion || Commit != tt.wantCommit {
+				t.Errorf("Version, Commit = %q, %q, want %q, %q", Version, Commit, tt.wantVersion, tt.wantCommit)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package watchdog
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/alswl/cron-manager/internal/job"
+)
+
+// doneMessage is written to the watchdog by a process finishing normally
+const doneMessage = "done"
+
+// Watchdog is a child process reporting the crash of the process that started it
+type Watchdog struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// Start starts the executable of the current process with args as watchdog. The watchdog is
+// connected through its standard input, which is closed by the system if this process dies.
+// It runs in its own process group, so it survives signals sent to the group of this process.
+func Start(args ...string) (*Watchdog, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	job.SetProcessGroup(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &Watchdog{cmd: cmd, stdin: stdin}, nil
+}
+
+// Done tells the watchdog this process finishes normally and waits for it to exit
+func (w *Watchdog) Done() error {
+	_, writeErr := io.WriteString(w.stdin, doneMessage+"\n")
+	closeErr := w.stdin.Close()
+	waitErr := w.cmd.Wait()
+	if writeErr != nil {
+		return writeErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return waitErr
+}
+
+// Watch blocks until the watched process finished or died, reading its messages from r.
+// It reports whether the process died without finishing normally.
+func Watch(r io.Reader) (crashed bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if scanner.Text() == doneMessage {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package watchdog
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestWatch tests telling a normal finish from a crash
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantCrashed bool
+	}{
+		{name: "done", input: "done\n", wantCrashed: false},
+		{name: "done without newline", input: "done", wantCrashed: false},
+		{name: "closed without message", input: "", wantCrashed: true},
+		{name: "other message", input: "starting\n", wantCrashed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Watch(strings.NewReader(tt.input)); got != tt.wantCrashed {
+				t.Errorf("Watch() = %v, want %v", got, tt.wantCrashed)
+			}
+		})
+	}
+}